@@ -48,6 +48,37 @@ const (
 	// and then left alone for the duration of the mount.
 	MountFlagsPreserveTimestamps = MountFlags(1 << iota)
 
+	// MountFlagsShared indicates that the image is mounted read-only and will
+	// be accessed by many goroutines at once. All write-related permissions
+	// are ignored.
+	//
+	// Object data is loaded in its entirety when a file is opened, after which
+	// the cache is immutable and reads require no locking. Implementations
+	// must likewise not modify their internal state after [Mount] returns.
+	MountFlagsShared = MountFlags(1 << iota)
+
+	// MountFlagsNoDecompression disables the decompression filters that
+	// [Driver.ReadFile] applies to files stored in a compressed format, so
+	// that it returns the data exactly as it's stored on the image.
+	MountFlagsNoDecompression = MountFlags(1 << iota)
+
+	// MountFlagsVerifyWrites makes the driver read back every block of file
+	// data it writes and compare it to what was written, retrying the write if
+	// they differ. This is intended for unreliable physical media such as USB
+	// floppy drives. If the data still differs after the configured number of
+	// retries, the write fails with [ErrIOFailed].
+	//
+	// Only file data is verified. Implementations write their own structures,
+	// such as directories and allocation tables, straight to the image when
+	// they're flushed, so the driver never sees those writes.
+	MountFlagsVerifyWrites = MountFlags(1 << iota)
+
+	// MountFlagsLenient lets an image be mounted even if it uses features the
+	// implementation doesn't support. Instead of failing, the implementation
+	// ignores the feature and records a [MountWarning], which can be retrieved
+	// after mounting. Without this flag, such images fail to mount.
+	MountFlagsLenient = MountFlags(1 << iota)
+
 	// MountFlagsCustomStart is the lowest bit flag that is not defined by the
 	// API standard and is free for drivers to use in an implementation-specific
 	// manner. All bits higher than this are guaranteed to be ignored by drivers
@@ -67,6 +98,30 @@ func (flags MountFlags) CanDelete() bool {
 	return flags&MountFlagsAllowDelete != 0
 }
 
+// DecompressesFiles returns true if files stored in a compressed format should
+// be decompressed when read in their entirety. See [MountFlagsNoDecompression].
+func (flags MountFlags) DecompressesFiles() bool {
+	return flags&MountFlagsNoDecompression == 0
+}
+
+// VerifiesWrites returns true if written blocks should be read back and
+// checked. See [MountFlagsVerifyWrites].
+func (flags MountFlags) VerifiesWrites() bool {
+	return flags&MountFlagsVerifyWrites != 0
+}
+
+// IsLenient returns true if unsupported features should produce warnings
+// instead of errors. See [MountFlagsLenient].
+func (flags MountFlags) IsLenient() bool {
+	return flags&MountFlagsLenient != 0
+}
+
+// IsShared returns true if the image is mounted for concurrent read-only access.
+// See [MountFlagsShared] for details.
+func (flags MountFlags) IsShared() bool {
+	return flags&MountFlagsShared != 0
+}
+
 const MountFlagsAllowReadWrite = MountFlagsAllowRead | MountFlagsAllowWrite
 const MountFlagsAllowAll = (MountFlagsAllowRead |
 	MountFlagsAllowWrite |
@@ -86,6 +141,19 @@ type FileSystemImplementer interface {
 	// handles *may* be open when this is called, so implementations must
 	// ensure these remain in a usable state.
 	//
+	// By the time this is called, the driver will have written out the data of
+	// all open files with [ObjectHandle.WriteBlocks]. Implementations must
+	// write out changes in this order, so that if the process crashes partway
+	// through, the image may leak space but never references unwritten data:
+	//
+	//  1. Object data buffered by the implementation itself, if any.
+	//  2. Allocation structures, such as the FAT or free block bitmaps.
+	//  3. Directory entries, inodes, and other metadata pointing at the above.
+	//
+	// Space being freed is the exception: metadata that stops referencing it
+	// must be written out before the allocation structures that mark it free,
+	// or else a crash could leave it both free and in use.
+	//
 	// This will only be called if [Mount] returned successfully.
 	Flush() DriverError
 
@@ -214,6 +282,92 @@ type VolumeLabelImplementer interface {
 	GetVolumeLabel() (string, DriverError)
 }
 
+// An Allocator manages the free space map of a file system, such as a FAT or a
+// free block bitmap. Blocks are in whatever unit the file system allocates
+// space in, e.g. clusters for FAT, and are numbered the same way the file system
+// numbers them.
+//
+// Allocating blocks only marks them as used. Linking them to an object (e.g.
+// chaining clusters in a FAT) is up to the caller.
+type Allocator interface {
+	// Allocate marks `count` free blocks as used and returns their numbers, in
+	// ascending order. If there aren't enough free blocks, nothing is allocated
+	// and it returns [ErrNoSpaceOnDevice].
+	Allocate(count uint) ([]common.PhysicalBlock, DriverError)
+
+	// Free marks blocks as unused. It fails without freeing anything if any of
+	// the blocks are invalid, already free, or listed more than once.
+	Free(blocks []common.PhysicalBlock) DriverError
+
+	// FreeCount returns the number of blocks that are currently unused.
+	FreeCount() uint64
+
+	// IsAllocated returns true if `block` is in use, either by an object or by
+	// the file system itself.
+	IsAllocated(block common.PhysicalBlock) (bool, DriverError)
+}
+
+// An AllocatorImplementer gives access to the free space map of a file system,
+// so that tools such as defragmenters and consistency checkers can work with
+// any file system that has one.
+type AllocatorImplementer interface {
+	// GetAllocator returns the allocator for the mounted file system. Changes
+	// made through it are written out by [FileSystemImplementer.Flush].
+	GetAllocator() Allocator
+}
+
+// DeletedObject describes an object that has been deleted but whose directory
+// entry is still present on the image.
+type DeletedObject struct {
+	// Name is the name of the object, as far as it can be recovered. Some file
+	// systems overwrite part of the name when an object is deleted.
+	Name string
+
+	// Stat is the status of the object at the time it was deleted. DeletedAt
+	// is [UndefinedTimestamp] if the file system doesn't record when objects
+	// were deleted; see [FSFeatures.HasDeletedTime].
+	Stat FileStat
+
+	// Recoverable is true if, as far as the implementation can tell, none of
+	// the object's blocks have been reused since it was deleted.
+	Recoverable bool
+}
+
+// A DeletedObjectsImplementer can list the deleted objects in a directory, for
+// file systems that keep their directory entries around after deletion.
+type DeletedObjectsImplementer interface {
+	// ListDeletedObjects returns all deleted objects in `directory`, in the
+	// order they appear on disk.
+	//
+	// `directory` is guaranteed to be an existing directory.
+	ListDeletedObjects(directory ObjectHandle) ([]DeletedObject, DriverError)
+}
+
+// A GrowImplementer can enlarge a mounted file system and the image it's on,
+// so that users don't need to format a bigger image and copy everything over.
+type GrowImplementer interface {
+	// GrowImage resizes the file system to `newTotalBlocks` blocks, extending
+	// the image if needed. The new blocks must be free once this returns.
+	// Implementations that can't grow the file system as far as requested must
+	// fail without changing anything.
+	//
+	// The following guarantees apply when this function is called:
+	//
+	//	- `newTotalBlocks` is larger than [FSStat.TotalBlocks], and not larger
+	//	  than [FSFeatures.MaxTotalBlocks].
+	//	- The data of all open files has been written out.
+	GrowImage(newTotalBlocks uint64) DriverError
+}
+
+// ObjectIDImplementer is implemented by file systems that can find an object
+// directly from its stable ID, [FileStat.InodeNumber]. Without it, the driver
+// has to search the entire directory tree to open an object by ID.
+type ObjectIDImplementer interface {
+	// GetObjectByID returns a handle to the object whose inode number is
+	// `inodeNumber`, or [ErrNotFound] if there's no such object.
+	GetObjectByID(inodeNumber uint64) (ObjectHandle, DriverError)
+}
+
 type ImplementerConstructor func(stream io.ReadWriteSeeker) (FileSystemImplementer, DriverError)
 
 // ObjectHandle is an interface for a way to interact with on-disk file system
@@ -283,6 +437,8 @@ type ObjectHandle interface {
 	//   - Symbolic links should not be dereferenced, so X and Y are not the same
 	//     even if X is a symbolic link to Y.
 	//   - Hard links are considered the same as the files they refer to.
+	//   - It must still work after either handle is closed, since the driver
+	//     keeps handles around to implement [Driver.SameFile].
 	//
 	// For a UNIX-like file system, this is equivalent to comparing the inumbers.
 	SameAs(other ObjectHandle) bool
@@ -296,6 +452,49 @@ type ObjectHandle interface {
 	Close() error
 }
 
+// SupportsHolesHandle is an interface for an [ObjectHandle] that can tell which
+// of its blocks are holes, i.e. have no storage allocated and read as all null
+// bytes. Reads over holes are filled with zeroes by the driver without calling
+// [ObjectHandle.ReadBlocks], which speeds up reading sparse files.
+type SupportsHolesHandle interface {
+	// IsHole returns true if the block at `index` is a hole. It's only called
+	// for blocks within the current boundaries of the object. Returning false
+	// for a hole is always safe.
+	IsHole(index common.LogicalBlock) bool
+}
+
+// BlockRange is a run of consecutive logical blocks in an object, along with
+// the buffer to read them into or write them from.
+type BlockRange struct {
+	// Start is the first logical block in the run.
+	Start common.LogicalBlock
+	// Data is a nonzero multiple of the size of a block. Its length determines
+	// how many blocks are in the run.
+	Data []byte
+}
+
+// SupportsExtentIOHandle is an interface for an [ObjectHandle] that can read or
+// write several discontiguous runs of blocks in one call. Implementations can
+// use this to batch accesses to fragmented objects into fewer I/O operations.
+//
+// The following guarantees apply when these functions are called:
+//
+//   - `ranges` is not empty.
+//   - All guarantees of [ObjectHandle.ReadBlocks] and [ObjectHandle.WriteBlocks]
+//     apply to each range.
+//   - Ranges are sorted by their starting block and don't overlap.
+type SupportsExtentIOHandle interface {
+	// ReadExtents fills the buffer of each range with data from the blocks it
+	// covers. It's equivalent to calling [ObjectHandle.ReadBlocks] on each
+	// range in turn.
+	ReadExtents(ranges []BlockRange) DriverError
+
+	// WriteExtents writes the buffer of each range to the blocks it covers.
+	// It's equivalent to calling [ObjectHandle.WriteBlocks] on each range in
+	// turn.
+	WriteExtents(ranges []BlockRange) DriverError
+}
+
 // SupportsListDirHandle is an interface for an [ObjectHandle] that represents a
 // directory to implement so that its contents can be accessed.
 type SupportsListDirHandle interface {
@@ -304,6 +503,31 @@ type SupportsListDirHandle interface {
 	ListDir() ([]string, DriverError)
 }
 
+// DirIterator returns the entries of a directory one at a time, so that large
+// directories don't need to be loaded into memory all at once.
+//
+// If the directory is modified while it's being iterated over, entries added or
+// removed may or may not be returned, but no entry may be returned twice.
+type DirIterator interface {
+	// Next returns the name of the next entry in the directory. "." and ".."
+	// may be returned, and are ignored. When there are no more entries, it
+	// returns an empty string and [io.EOF].
+	Next() (string, error)
+
+	// Close frees any resources the iterator holds. It can't be used after this
+	// is called.
+	Close() DriverError
+}
+
+// SupportsDirIterHandle is an interface for an [ObjectHandle] that represents a
+// directory to implement if it can return its entries without materializing
+// them all at once. Directories that don't implement it must implement
+// [SupportsListDirHandle].
+type SupportsDirIterHandle interface {
+	// OpenDirIter returns an iterator over the entries in this directory.
+	OpenDirIter() (DirIterator, DriverError)
+}
+
 // SupportsChtimesHandle is an interface for an [ObjectHandle] that supports
 // changing its created/modified/etc. timestamps.
 type SupportsChtimesHandle interface {
@@ -351,6 +575,19 @@ type SupportsChownHandle interface {
 	Chown(uid, gid int) DriverError
 }
 
+// SupportsXattrHandle is an interface for an [ObjectHandle] with extended
+// attributes, metadata that has no place in [FileStat], such as the load and
+// execution addresses some systems store for programs. Names are prefixed with
+// the file system they come from, e.g. "acorn.load".
+type SupportsXattrHandle interface {
+	// ListXattrs returns the names of the object's extended attributes, sorted.
+	ListXattrs() ([]string, DriverError)
+
+	// GetXattr returns the value of the extended attribute `name`. It fails
+	// with [ErrNotFound] if the object doesn't have it.
+	GetXattr(name string) ([]byte, DriverError)
+}
+
 // UndefinedTimestamp is a timestamp that should be used as an invalid value,
 // equivalent to `nil` for pointers.
 //
@@ -397,6 +634,21 @@ type FSFeatures struct {
 	// this to [UndefinedTimestamp].
 	TimestampEpoch time.Time
 
+	// CreatedTimeResolution, AccessedTimeResolution, ModifiedTimeResolution,
+	// ChangedTimeResolution, and DeletedTimeResolution give the precision each
+	// timestamp is stored at. 0 means nanosecond precision, or that the file
+	// system doesn't have that timestamp.
+	CreatedTimeResolution  time.Duration
+	AccessedTimeResolution time.Duration
+	ModifiedTimeResolution time.Duration
+	ChangedTimeResolution  time.Duration
+	DeletedTimeResolution  time.Duration
+
+	// TimestampRounding is how timestamps are converted to these resolutions
+	// when they're written. Reading back a timestamp written with Chtimes gives
+	// the result of [RoundTimestamp] with the same resolution and rounding.
+	TimestampRounding TimestampRounding
+
 	// DefaultNameEncoding gives the name of the text encoding natively used by
 	// the file system for directory and file names (not file contents!).
 	//
@@ -427,6 +679,22 @@ type FSFeatures struct {
 	// system, this should be 0. If there's no length limit, this should be
 	// [math.MaxInt].
 	MaxVolumeLabelSize int
+
+	// MaxFileSize is the size of the largest possible file, in bytes. File
+	// systems with no limit beyond the size of the image should set this to
+	// [math.MaxInt64]. 0 is treated the same way.
+	MaxFileSize int64
+
+	// MaxPathLength is the length of the longest absolute path an object can
+	// have, in bytes, including the leading slash. This is for limits the
+	// original system imposes beyond the length of each name. 0 means there's
+	// no limit.
+	MaxPathLength int
+
+	// MaxPathDepth is the greatest number of components an object's absolute
+	// path can have, so "/A" has a depth of 1 and "/A/B" a depth of 2. 0 means
+	// there's no limit.
+	MaxPathDepth int
 }
 
 // FileStat is a platform-independent form of [syscall.Stat_t].
@@ -436,7 +704,11 @@ type FSFeatures struct {
 // compatibility they should use 1 for `Nlinks`, and 0o777 for `ModeFlags`.
 // Unsupported timestamps MUST be set to [UndefinedTimestamp].
 type FileStat struct {
-	DeviceID     uint64
+	DeviceID uint64
+	// InodeNumber uniquely identifies the object on the file system, and must
+	// not change for as long as the object exists. Hard links to an object
+	// have the same inode number. Together with DeviceID, it can be used to
+	// open the object again later without knowing its path.
 	InodeNumber  uint64
 	Nlinks       uint64
 	ModeFlags    os.FileMode
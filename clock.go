@@ -0,0 +1,41 @@
+package disko
+
+import "time"
+
+// Clock is the source of the current time for everything that records a
+// timestamp, such as formatting an image or updating an object's modification
+// time. Replacing it makes the resulting images reproducible.
+//
+// Set it with BaseDriver.SetClock in the driver package. The driver uses it to
+// stamp newly created objects, and passes it on to implementations that are
+// [ClockImplementer]s for the timestamps they set themselves.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+}
+
+// SystemClock is a [Clock] that returns the real time. It's the default.
+type SystemClock struct{}
+
+// Now implements [Clock] using [time.Now].
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// FixedClock is a [Clock] that always returns the same time.
+type FixedClock struct {
+	Time time.Time
+}
+
+// Now implements [Clock].
+func (clock FixedClock) Now() time.Time {
+	return clock.Time
+}
+
+// A ClockImplementer records timestamps, and gets the current time from a
+// [Clock] given by the driver instead of calling [time.Now] itself.
+type ClockImplementer interface {
+	// SetClock changes where the implementation gets the current time from.
+	// It may be called at any time, including before [FileSystemImplementer.Mount].
+	SetClock(clock Clock)
+}
@@ -0,0 +1,22 @@
+package disko_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dargueta/disko"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixedClock(t *testing.T) {
+	at := time.Date(1985, time.November, 20, 12, 0, 0, 0, time.UTC)
+	var clock disko.Clock = disko.FixedClock{Time: at}
+	assert.Equal(t, at, clock.Now())
+	assert.Equal(t, at, clock.Now())
+}
+
+func TestSystemClock(t *testing.T) {
+	before := time.Now()
+	now := disko.SystemClock{}.Now()
+	assert.False(t, now.Before(before), "system clock went backwards")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/dargueta/disko/utilities/compression"
+	"github.com/urfave/cli/v2"
+)
+
+type imageAnalysis struct {
+	Image string `json:"image"`
+	compression.ImageAnalysis
+	ZeroBlockRatio float64 `json:"zero_block_ratio"`
+}
+
+func analyzeImage(context *cli.Context) error {
+	if err := checkArgCount(context, 1); err != nil {
+		return err
+	}
+	imagePath := context.Args().First()
+
+	image, closer, err := openImageReader(imagePath)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	analysis, err := compression.AnalyzeImage(image, context.Int64("region-size"))
+	if err != nil {
+		return err
+	}
+	report := imageAnalysis{
+		Image:          imagePath,
+		ImageAnalysis:  analysis,
+		ZeroBlockRatio: analysis.ZeroBlockRatio(),
+	}
+
+	if context.Bool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	printImageAnalysis(report)
+	return nil
+}
+
+func printImageAnalysis(report imageAnalysis) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer writer.Flush()
+
+	fmt.Fprintf(writer, "Image:\t%s\n", report.Image)
+	fmt.Fprintf(writer, "Size:\t%d bytes\n", report.Size)
+	fmt.Fprintf(
+		writer,
+		"Zero blocks:\t%d of %d (%.1f%%)\n",
+		report.ZeroBlocks,
+		report.TotalBlocks,
+		100*report.ZeroBlockRatio,
+	)
+
+	fmt.Fprintln(writer, "\nRun lengths")
+	fmt.Fprintln(writer, "  Length\tRuns\tBytes")
+	for _, bucket := range report.RunLengths {
+		var lengths string
+		switch {
+		case bucket.MaxLength == 0:
+			lengths = fmt.Sprintf("%d+", bucket.MinLength)
+		case bucket.MinLength == bucket.MaxLength:
+			lengths = fmt.Sprintf("%d", bucket.MinLength)
+		default:
+			lengths = fmt.Sprintf("%d-%d", bucket.MinLength, bucket.MaxLength)
+		}
+		fmt.Fprintf(writer, "  %s\t%d\t%d\n", lengths, bucket.Runs, bucket.Bytes)
+	}
+
+	fmt.Fprintln(writer, "\nEntropy (bits per byte)")
+	for _, region := range report.Regions {
+		fmt.Fprintf(
+			writer,
+			"  %d-%d:\t%.3f\n",
+			region.Offset,
+			region.Offset+region.Size-1,
+			region.Entropy,
+		)
+	}
+
+	fmt.Fprintln(writer, "\nCompressed sizes")
+	for _, codec := range report.Codecs {
+		ratio := 0.0
+		if report.Size > 0 {
+			ratio = 100 * float64(codec.Size) / float64(report.Size)
+		}
+		fmt.Fprintf(writer, "  %s:\t%d bytes\t(%.1f%%)\n", codec.Codec, codec.Size, ratio)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/utilities/pathfilter"
+	"github.com/urfave/cli/v2"
+)
+
+// mountedImage is an image mounted with the driver for its file system.
+type mountedImage struct {
+	*driver.BaseDriver
+	implementation disko.FileSystemImplementer
+	source         imageSource
+	flags          disko.MountFlags
+}
+
+// mountImageFile mounts the image at `location`, a local path or a URL
+// accepted by [openImage]. The file system type is detected unless given with
+// the --type flag, and it's expected at the offset given with --fs-offset. The
+// image is opened with [openWritableImage] if `flags` allow any modifications.
+func mountImageFile(
+	context *cli.Context,
+	location string,
+	flags disko.MountFlags,
+) (*mountedImage, error) {
+	var source imageSource
+	var err error
+	if flags.CanWrite() || flags.CanDelete() {
+		source, err = openWritableImage(location)
+	} else {
+		source, err = openImage(location)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := mountImageSource(context, source, flags)
+	if err != nil {
+		source.Close()
+		return nil, err
+	}
+	return image, nil
+}
+
+func mountImageSource(
+	context *cli.Context,
+	source imageSource,
+	flags disko.MountFlags,
+) (*mountedImage, error) {
+	offset, registrations, err := resolveFileSystemsAtOffset(context, source)
+	if err != nil {
+		return nil, err
+	} else if len(registrations) != 1 {
+		return nil, fmt.Errorf(
+			"image could be any of %d file system types; use --type", len(registrations))
+	} else if registrations[0].New == nil {
+		return nil, fmt.Errorf("the %s driver can't mount images yet", registrations[0].Name)
+	}
+
+	image, ok := source.(disks.ReadWriterAt)
+	if !ok {
+		image = readOnlyImage{source}
+	}
+	stream := disks.NewSection(image, offset, source.Size()-offset)
+
+	implementation, driverErr := registrations[0].New(stream)
+	if driverErr != nil {
+		return nil, driverErr
+	}
+	driverErr = implementation.Mount(flags)
+	if driverErr != nil {
+		return nil, driverErr
+	}
+
+	return &mountedImage{
+		BaseDriver:     driver.New(implementation, flags),
+		implementation: implementation,
+		source:         source,
+		flags:          flags,
+	}, nil
+}
+
+// Close writes out all changes if the image was mounted for writing, then
+// unmounts it and closes the image. Anything the driver worked around while the
+// image was mounted is printed to stderr as a warning.
+func (image *mountedImage) Close() error {
+	var err error
+	if image.flags.CanWrite() || image.flags.CanDelete() {
+		err = image.Flush()
+	}
+	for _, diagnostic := range image.Diagnostics() {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", diagnostic)
+	}
+
+	unmountErr := image.implementation.Unmount()
+	closeErr := image.source.Close()
+	if err != nil {
+		return err
+	} else if unmountErr != nil {
+		return unmountErr
+	}
+	return closeErr
+}
+
+func exportImage(context *cli.Context) error {
+	if err := checkArgCount(context, 2); err != nil {
+		return err
+	}
+
+	filter, err := pathFilterFromContext(context)
+	if err != nil {
+		return err
+	}
+
+	jobs := context.Int("jobs")
+	if jobs < 1 {
+		return disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("--jobs must be at least 1, got %d", jobs))
+	}
+
+	// Files can only be read concurrently from a shared mount.
+	mountFlags := disko.MountFlagsAllowRead
+	if jobs > 1 {
+		mountFlags |= disko.MountFlagsShared
+	}
+
+	image, err := mountImageFile(context, context.Args().Get(0), mountFlags)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+	image.SetExportWorkers(jobs)
+
+	var output io.Writer = os.Stdout
+	if archivePath := context.Args().Get(1); archivePath != "-" {
+		archive, err := os.Create(archivePath)
+		if err != nil {
+			return err
+		}
+		defer archive.Close()
+		output = archive
+	}
+
+	return image.ExportTar(context.String("root"), filter, output)
+}
+
+func importImage(context *cli.Context) error {
+	if err := checkArgCount(context, 2); err != nil {
+		return err
+	}
+
+	filter, err := pathFilterFromContext(context)
+	if err != nil {
+		return err
+	}
+
+	var input io.Reader = os.Stdin
+	if archivePath := context.Args().Get(1); archivePath != "-" {
+		archive, err := os.Open(archivePath)
+		if err != nil {
+			return err
+		}
+		defer archive.Close()
+		input = archive
+	}
+
+	if context.Bool("dry-run") {
+		return planImport(context, input, filter)
+	}
+
+	stdinInUse := context.Args().Get(1) == "-"
+	overwrite, err := overwritePolicyFromContext(context, stdinInUse)
+	if err != nil {
+		return err
+	}
+	shortNames, err := shortNamesFromContext(context, stdinInUse, true)
+	if err != nil {
+		return err
+	}
+
+	image, err := mountImageFile(context, context.Args().Get(0), disko.MountFlagsAllowAll)
+	if err != nil {
+		return err
+	}
+	if shortNames != nil {
+		image.SetImportNameMapper(shortNames)
+	}
+
+	_, err = image.ImportTar(input, context.String("root"), filter, overwrite)
+	closeErr := image.Close()
+	listErr := writeRenameList(context, shortNames)
+	if err != nil {
+		return err
+	} else if closeErr != nil {
+		return closeErr
+	}
+	return listErr
+}
+
+// planImport prints what importing an archive would do without modifying the
+// image, which is mounted read-only. Nothing is prompted for; files that would
+// be asked about are shown as overwritten unless --no-clobber is given, and
+// files that would be asked to be renamed are given numeric tails.
+func planImport(context *cli.Context, input io.Reader, filter *pathfilter.Filter) error {
+	imagePath := context.Args().Get(0)
+
+	shortNames, err := shortNamesFromContext(context, false, false)
+	if err != nil {
+		return err
+	}
+
+	// Make sure we'd be able to write to the image for real.
+	writable, err := openWritableImage(imagePath)
+	if err != nil {
+		return err
+	}
+	writable.Close()
+
+	image, err := mountImageFile(context, imagePath, disko.MountFlagsAllowRead)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+	if shortNames != nil {
+		image.SetImportNameMapper(shortNames)
+	}
+
+	var overwrite driver.OverwriteFunc
+	if context.Bool("no-clobber") {
+		overwrite = func(string) (bool, error) { return false, nil }
+	}
+
+	plan, err := image.PlanImportTar(input, context.String("root"), filter, overwrite)
+	for _, operation := range plan.Operations {
+		fmt.Println(operation.String())
+	}
+	fmt.Printf(
+		"about %d blocks needed, %d available\n",
+		plan.BlocksNeeded,
+		plan.BlocksAvailable,
+	)
+	if err != nil {
+		return err
+	}
+	return writeRenameList(context, shortNames)
+}
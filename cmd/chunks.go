@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dargueta/disko/disks/chunked"
+	"github.com/urfave/cli/v2"
+)
+
+func pushImage(context *cli.Context) error {
+	if err := checkArgCount(context, 3); err != nil {
+		return err
+	}
+	imagePath := context.Args().Get(0)
+	storeLocation := context.Args().Get(1)
+	name := context.Args().Get(2)
+
+	store, err := chunked.OpenStore(storeLocation)
+	if err != nil {
+		return err
+	}
+
+	image, closer, err := openImageReader(imagePath)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	stats, err := chunked.Push(image, store, name, context.Int64("chunk-size"))
+	if err != nil {
+		return err
+	}
+	printTransferStats("uploaded", stats)
+	return nil
+}
+
+func pullImage(context *cli.Context) error {
+	if err := checkArgCount(context, 3); err != nil {
+		return err
+	}
+	storeLocation := context.Args().Get(0)
+	name := context.Args().Get(1)
+	imagePath := context.Args().Get(2)
+
+	store, err := chunked.OpenStore(storeLocation)
+	if err != nil {
+		return err
+	}
+
+	image, err := os.OpenFile(imagePath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	info, err := image.Stat()
+	if err != nil {
+		return err
+	}
+
+	stats, err := chunked.Pull(image, info.Size(), store, name)
+	if err != nil {
+		return err
+	}
+	printTransferStats("downloaded", stats)
+	return nil
+}
+
+func printTransferStats(verb string, stats chunked.TransferStats) {
+	fmt.Printf(
+		"%s %d of %d chunks (%d bytes)\n",
+		verb,
+		stats.ChunksTransferred,
+		stats.TotalChunks,
+		stats.BytesTransferred,
+	)
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// The config file gives defaults for command-line flags, so that options used
+// on every invocation don't have to be repeated. It's a small subset of TOML:
+//
+//	# Keys outside of a section apply to every command with that flag.
+//	json = true
+//	type = "fat"
+//
+//	# Keys in a section only apply to the command of the same name.
+//	[export]
+//	exclude = ["*.bak", "re:.*~"]
+//	max-depth = 4
+//
+//	# Subcommands' sections are named with the path to them, as nested
+//	# tables would be in TOML.
+//	[command.subcommand]
+//	json = true
+//
+// Values can be strings, booleans, numbers, or arrays of them for flags that
+// can be repeated. Flags given on the command line take precedence.
+
+// configEnvVar is the environment variable that overrides where the config
+// file is read from.
+const configEnvVar = "DISKO_CONFIG"
+
+// cliConfig holds the flag defaults read from a config file. Each flag maps to
+// one or more values, which are set in order as if the flag had been repeated.
+type cliConfig struct {
+	global   map[string][]string
+	commands map[string]map[string][]string
+}
+
+// defaultConfigPath returns the path to the config file in the user's config
+// directory, e.g. ~/.config/disko/config.toml on Linux.
+func defaultConfigPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "disko", "config.toml")
+}
+
+// installConfigHooks makes every command in `commands` and their subcommands
+// read their flags from the config file before running. `prefix` is the
+// section name of the commands' parent followed by a dot, or empty for
+// top-level commands.
+func installConfigHooks(commands []*cli.Command, prefix string) {
+	for _, command := range commands {
+		section := prefix + command.Name
+		command.Before = func(context *cli.Context) error {
+			return applyConfig(context, section)
+		}
+		installConfigHooks(command.Subcommands, section+".")
+	}
+}
+
+// applyConfig sets the flags of the command being run from the config file,
+// unless they were given on the command line. `section` is the name of the
+// command's section in the file.
+func applyConfig(context *cli.Context, section string) error {
+	path := context.String("config")
+	required := path != ""
+	if path == "" {
+		path = defaultConfigPath()
+	}
+	if path == "" {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	config, err := parseConfig(file, path)
+	if err != nil {
+		return err
+	}
+	return config.apply(context, section)
+}
+
+// apply sets every flag of the current command that the config gives a value
+// for and that wasn't set on the command line. Keys outside of a section that
+// the command has no flag for are ignored, but unknown keys in the command's
+// own section are an error, to catch typos.
+func (config *cliConfig) apply(context *cli.Context, section string) error {
+	command := context.Command
+	flagNames := map[string]bool{}
+	for _, flag := range command.Flags {
+		for _, name := range flag.Names() {
+			flagNames[name] = true
+		}
+	}
+
+	for name := range config.commands[section] {
+		if !flagNames[name] {
+			return fmt.Errorf(
+				"config file section [%s]: %q isn't an option of that command",
+				section,
+				name,
+			)
+		}
+	}
+
+	values := map[string][]string{}
+	for name, value := range config.global {
+		if flagNames[name] {
+			values[name] = value
+		}
+	}
+	for name, value := range config.commands[section] {
+		values[name] = value
+	}
+
+	for name, flagValues := range values {
+		if context.IsSet(name) {
+			continue
+		}
+		for _, value := range flagValues {
+			err := context.Set(name, value)
+			if err != nil {
+				return fmt.Errorf("config file: invalid value %q for %q: %w", value, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// parseConfig reads a config file. `name` is only used for error messages.
+func parseConfig(reader io.Reader, name string) (*cliConfig, error) {
+	config := &cliConfig{
+		global:   map[string][]string{},
+		commands: map[string]map[string][]string{},
+	}
+	section := config.global
+
+	scanner := bufio.NewScanner(reader)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			end := strings.IndexByte(line, ']')
+			if end < 0 || strings.TrimSpace(stripComment(line[end+1:])) != "" {
+				return nil, fmt.Errorf("%s:%d: invalid section header", name, lineNumber)
+			}
+			commandName := strings.TrimSpace(line[1:end])
+			if config.commands[commandName] == nil {
+				config.commands[commandName] = map[string][]string{}
+			}
+			section = config.commands[commandName]
+			continue
+		}
+
+		key, rawValue, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("%s:%d: expected key = value", name, lineNumber)
+		}
+
+		key = strings.Trim(strings.TrimSpace(key), `"`)
+		values, err := parseConfigValue(strings.TrimSpace(rawValue))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, lineNumber, err)
+		}
+		section[key] = values
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// parseConfigValue parses a value, returning it as the strings to pass to the
+// flag. Arrays give one string per element.
+func parseConfigValue(raw string) ([]string, error) {
+	if !strings.HasPrefix(raw, "[") {
+		value, rest, err := parseConfigScalar(raw)
+		if err != nil {
+			return nil, err
+		} else if strings.TrimSpace(stripComment(rest)) != "" {
+			return nil, fmt.Errorf("unexpected %q after value", rest)
+		}
+		return []string{value}, nil
+	}
+
+	values := []string{}
+	rest := strings.TrimSpace(raw[1:])
+	for !strings.HasPrefix(rest, "]") {
+		value, remainder, err := parseConfigScalar(rest)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		rest = strings.TrimSpace(remainder)
+		if strings.HasPrefix(rest, ",") {
+			rest = strings.TrimSpace(rest[1:])
+		} else if !strings.HasPrefix(rest, "]") {
+			return nil, fmt.Errorf("expected , or ] in array, got %q", rest)
+		}
+	}
+
+	if strings.TrimSpace(stripComment(rest[1:])) != "" {
+		return nil, fmt.Errorf("unexpected %q after array", rest[1:])
+	}
+	return values, nil
+}
+
+// parseConfigScalar parses a single string, boolean, or number at the start of
+// `raw`, returning its value and the text after it.
+func parseConfigScalar(raw string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		// Find the closing quote, skipping escaped ones.
+		for i := 1; i < len(raw); i++ {
+			if raw[i] == '\\' {
+				i++
+			} else if raw[i] == '"' {
+				value, err := strconv.Unquote(raw[:i+1])
+				if err != nil {
+					return "", "", fmt.Errorf("invalid string %s", raw[:i+1])
+				}
+				return value, raw[i+1:], nil
+			}
+		}
+		return "", "", fmt.Errorf("unterminated string %s", raw)
+	case strings.HasPrefix(raw, "'"):
+		// Literal strings have no escapes.
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string %s", raw)
+		}
+		return raw[1 : end+1], raw[end+2:], nil
+	}
+
+	end := strings.IndexAny(raw, ",]#")
+	if end < 0 {
+		end = len(raw)
+	}
+	value := strings.TrimSpace(raw[:end])
+
+	if value == "true" || value == "false" {
+		return value, raw[end:], nil
+	}
+	_, err := strconv.ParseFloat(strings.ReplaceAll(value, "_", ""), 64)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid value %q; strings must be quoted", value)
+	}
+	return strings.ReplaceAll(value, "_", ""), raw[end:], nil
+}
+
+// stripComment removes a trailing comment from the rest of a line after a
+// value.
+func stripComment(text string) string {
+	if index := strings.IndexByte(text, '#'); index >= 0 {
+		return text[:index]
+	}
+	return text
+}
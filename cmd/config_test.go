@@ -0,0 +1,202 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestParseConfig(t *testing.T) {
+	config, err := parseConfig(
+		strings.NewReader(`
+# A comment
+json = true   # trailing comment
+"type" = "fat"
+
+[export]
+exclude = ["*.bak", 're:.*~'] # patterns
+max-depth = 4
+
+[ chunks.push ]
+chunk-size = 1_048_576
+`),
+		"config.toml",
+	)
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		map[string][]string{"json": {"true"}, "type": {"fat"}},
+		config.global,
+	)
+	assert.Equal(
+		t,
+		map[string]map[string][]string{
+			"export": {
+				"exclude":   {"*.bak", "re:.*~"},
+				"max-depth": {"4"},
+			},
+			"chunks.push": {"chunk-size": {"1048576"}},
+		},
+		config.commands,
+	)
+}
+
+func TestParseConfig__Errors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		text    string
+		message string
+	}{
+		{
+			name:    "no value",
+			text:    "json",
+			message: "config.toml:1: expected key = value",
+		},
+		{
+			name:    "unclosed section",
+			text:    "\n[export",
+			message: "config.toml:2: invalid section header",
+		},
+		{
+			name:    "text after section",
+			text:    "[export] json = true",
+			message: "config.toml:1: invalid section header",
+		},
+		{
+			name:    "unquoted string",
+			text:    "type = fat",
+			message: `config.toml:1: invalid value "fat"; strings must be quoted`,
+		},
+		{
+			name:    "unterminated string",
+			text:    `type = "fat`,
+			message: `config.toml:1: unterminated string "fat`,
+		},
+		{
+			name:    "unterminated literal string",
+			text:    `type = 'fat`,
+			message: `config.toml:1: unterminated string 'fat`,
+		},
+		{
+			name:    "bad escape",
+			text:    `type = "\q"`,
+			message: `config.toml:1: invalid string "\q"`,
+		},
+		{
+			name:    "text after value",
+			text:    `type = "fat" "fat8"`,
+			message: `config.toml:1: unexpected " \"fat8\"" after value`,
+		},
+		{
+			name:    "missing comma",
+			text:    `exclude = ["a" "b"]`,
+			message: `config.toml:1: expected , or ] in array, got "\"b\"]"`,
+		},
+		{
+			name:    "text after array",
+			text:    `exclude = ["a"] x`,
+			message: `config.toml:1: unexpected " x" after array`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := parseConfig(strings.NewReader(testCase.text), "config.toml")
+			assert.EqualError(t, err, testCase.message)
+		})
+	}
+}
+
+func TestParseConfigScalar(t *testing.T) {
+	testCases := []struct {
+		raw   string
+		value string
+		rest  string
+	}{
+		{raw: `"a \"quoted\" string", 1`, value: `a "quoted" string`, rest: ", 1"},
+		{raw: `"tab\there"`, value: "tab\there"},
+		{raw: `'C:\no\escapes'`, value: `C:\no\escapes`},
+		{raw: `"# not a comment" # comment`, value: "# not a comment", rest: " # comment"},
+		{raw: "false]", value: "false", rest: "]"},
+		{raw: "-12.5 # comment", value: "-12.5", rest: "# comment"},
+		{raw: "1_000", value: "1000"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.raw, func(t *testing.T) {
+			value, rest, err := parseConfigScalar(testCase.raw)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.value, value)
+			assert.Equal(t, testCase.rest, rest)
+		})
+	}
+}
+
+// newConfigTestApp returns an app with a command and a subcommand that record
+// the value of their --name flag, and a config file for it.
+func newConfigTestApp(t *testing.T, configText string) (*cli.App, *string, string) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(configPath, []byte(configText), 0o644))
+
+	name := new(string)
+	action := func(context *cli.Context) error {
+		*name = context.String("name")
+		return nil
+	}
+	app := &cli.App{
+		Flags: []cli.Flag{&cli.StringFlag{Name: "config"}},
+		Commands: []*cli.Command{
+			{
+				Name:   "command",
+				Action: action,
+				Flags:  []cli.Flag{&cli.StringFlag{Name: "name"}},
+				Subcommands: []*cli.Command{
+					{
+						Name:   "subcommand",
+						Action: action,
+						Flags:  []cli.Flag{&cli.StringFlag{Name: "name"}},
+					},
+				},
+			},
+		},
+		ExitErrHandler: func(*cli.Context, error) {},
+	}
+	installConfigHooks(app.Commands, "")
+	return app, name, configPath
+}
+
+func TestApplyConfig(t *testing.T) {
+	app, name, configPath := newConfigTestApp(t, `
+name = "global"
+[command.subcommand]
+name = "sub"
+`)
+
+	require.NoError(t, app.Run([]string{"disko", "--config", configPath, "command"}))
+	assert.Equal(t, "global", *name)
+
+	require.NoError(t, app.Run([]string{"disko", "--config", configPath, "command", "subcommand"}))
+	assert.Equal(t, "sub", *name)
+
+	// The command line takes precedence.
+	err := app.Run(
+		[]string{"disko", "--config", configPath, "command", "subcommand", "--name", "flag"})
+	require.NoError(t, err)
+	assert.Equal(t, "flag", *name)
+}
+
+// Unknown keys in a command's section are an error, but not outside of one.
+func TestApplyConfig__UnknownKey(t *testing.T) {
+	app, _, configPath := newConfigTestApp(t, "unknown = 1\n")
+	require.NoError(t, app.Run([]string{"disko", "--config", configPath, "command"}))
+
+	app, _, configPath = newConfigTestApp(t, "[command.subcommand]\nnmae = 'typo'\n")
+	err := app.Run([]string{"disko", "--config", configPath, "command", "subcommand"})
+	assert.EqualError(
+		t, err, `config file section [command.subcommand]: "nmae" isn't an option of that command`)
+}
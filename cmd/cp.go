@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	posixpath "path"
+	"strings"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/urfave/cli/v2"
+)
+
+// imagePathSpec is an argument of the form IMAGE:PATH, naming an object in an
+// image file.
+type imagePathSpec struct {
+	image string
+	path  string
+}
+
+// parseImagePathSpec splits an IMAGE:PATH argument at the last colon, so image
+// file names may contain colons but paths in the image may not.
+func parseImagePathSpec(spec string) (imagePathSpec, error) {
+	i := strings.LastIndex(spec, ":")
+	if i <= 0 || i == len(spec)-1 {
+		return imagePathSpec{}, disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("expected IMAGE:PATH, got %q", spec))
+	}
+	return imagePathSpec{image: spec[:i], path: spec[i+1:]}, nil
+}
+
+func copyBetweenImages(context *cli.Context) error {
+	if err := checkArgCount(context, 2); err != nil {
+		return err
+	}
+	source, err := parseImagePathSpec(context.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	destination, err := parseImagePathSpec(context.Args().Get(1))
+	if err != nil {
+		return err
+	}
+
+	overwrite, err := overwritePolicyFromContext(context, false)
+	if err != nil {
+		return err
+	}
+
+	sameImage, err := isSameFile(source.image, destination.image)
+	if err != nil {
+		return err
+	}
+
+	destinationImage, err := mountImageFile(context, destination.image, disko.MountFlagsAllowAll)
+	if err != nil {
+		return err
+	}
+
+	// Mounting the same image twice would give two drivers with their own idea
+	// of what's allocated, so copies within one image use one mount.
+	sourceImage := destinationImage
+	if !sameImage {
+		sourceImage, err = mountImageFile(context, source.image, disko.MountFlagsAllowRead)
+		if err != nil {
+			destinationImage.Close()
+			return err
+		}
+		defer sourceImage.Close()
+	}
+
+	err = copyImageObject(context, destinationImage, destination.path, sourceImage, source.path, overwrite)
+	closeErr := destinationImage.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// copyImageObject copies an object like cp(1) does: if `destPath` is an
+// existing directory, the object is copied into it.
+func copyImageObject(
+	context *cli.Context,
+	destination *mountedImage,
+	destPath string,
+	source *mountedImage,
+	sourcePath string,
+	overwrite driver.OverwriteFunc,
+) error {
+	sourcePath = source.NormalizePath(sourcePath)
+	stat, err := source.Lstat(sourcePath)
+	if err != nil {
+		return err
+	} else if stat.IsDir() && !context.Bool("recursive") {
+		return disko.ErrIsADirectory.WithMessage(
+			fmt.Sprintf("%s (use --recursive to copy directories)", sourcePath))
+	}
+
+	destPath = destination.NormalizePath(destPath)
+	destStat, err := destination.Stat(destPath)
+	if err == nil && destStat.IsDir() && sourcePath != "/" {
+		destPath = posixpath.Join(destPath, posixpath.Base(sourcePath))
+	}
+
+	options := driver.CopyOptions{
+		Overwrite:         overwrite,
+		PreserveOwnership: context.Bool("preserve-ownership"),
+	}
+	_, err = driver.CopyTree(destination.BaseDriver, destPath, source.BaseDriver, sourcePath, options)
+	return err
+}
+
+// isSameFile returns true if the local paths `a` and `b` are the same file. URLs
+// are the same image if they're identical.
+func isSameFile(a, b string) (bool, error) {
+	if isRemoteLocation(a) || isRemoteLocation(b) {
+		return a == b, nil
+	}
+
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(aInfo, bInfo), nil
+}
@@ -0,0 +1,13 @@
+package main
+
+// Import all file system drivers so that they register themselves.
+import (
+	_ "github.com/dargueta/disko/file_systems/acorndfs"
+	_ "github.com/dargueta/disko/file_systems/apple2"
+	_ "github.com/dargueta/disko/file_systems/ataridos"
+	_ "github.com/dargueta/disko/file_systems/d64"
+	_ "github.com/dargueta/disko/file_systems/fat"
+	_ "github.com/dargueta/disko/file_systems/fat8"
+	_ "github.com/dargueta/disko/file_systems/trsdos"
+	_ "github.com/dargueta/disko/file_systems/unixv6"
+)
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/dargueta/disko"
+	"github.com/urfave/cli/v2"
+)
+
+// Exit codes returned by the CLI. These are documented in the README, so
+// scripts can rely on them; don't renumber them.
+const (
+	exitSuccess          = 0
+	exitFailure          = 1
+	exitInvalidArgument  = 2
+	exitNotFound         = 3
+	exitExists           = 4
+	exitPermissionDenied = 5
+	exitCorruptImage     = 6
+	exitUnknownImage     = 7
+	exitNotSupported     = 8
+	exitNoSpace          = 9
+	exitIOFailed         = 10
+	exitWrongObjectType  = 11
+)
+
+// errorClass describes how an error is reported.
+type errorClass struct {
+	// target is the error that errors.Is() matches against.
+	target error
+	// code is a stable, machine-readable name for the error.
+	code string
+	// errno is the name of the closest POSIX error number.
+	errno    string
+	exitCode int
+}
+
+// errorClasses maps errors to how they're reported. The first matching entry
+// is used, so if an error wraps several of these, the earlier one wins.
+var errorClasses = []errorClass{
+	{disko.ErrFileSystemCorrupted, "corrupt_image", "EUCLEAN", exitCorruptImage},
+	{disko.ErrInvalidFileSystem, "unknown_image", "EMEDIUMTYPE", exitUnknownImage},
+	{disko.ErrNotFound, "not_found", "ENOENT", exitNotFound},
+	{disko.ErrNoDevice, "no_device", "ENODEV", exitNotFound},
+	{disko.ErrExists, "exists", "EEXIST", exitExists},
+	{disko.ErrPermissionDenied, "permission_denied", "EACCES", exitPermissionDenied},
+	{disko.ErrNotPermitted, "not_permitted", "EPERM", exitPermissionDenied},
+	{disko.ErrReadOnlyFileSystem, "read_only", "EROFS", exitPermissionDenied},
+	{disko.ErrNotSupported, "not_supported", "ENOTSUP", exitNotSupported},
+	{disko.ErrNotImplemented, "not_implemented", "ENOSYS", exitNotSupported},
+	{disko.ErrNoSpaceOnDevice, "no_space", "ENOSPC", exitNoSpace},
+	{disko.ErrDiskQuotaExceeded, "quota_exceeded", "EDQUOT", exitNoSpace},
+	{disko.ErrFileTooLarge, "file_too_large", "EFBIG", exitNoSpace},
+	{disko.ErrIOFailed, "io_failed", "EIO", exitIOFailed},
+	{disko.ErrIsADirectory, "is_a_directory", "EISDIR", exitWrongObjectType},
+	{disko.ErrNotADirectory, "not_a_directory", "ENOTDIR", exitWrongObjectType},
+	{disko.ErrDirectoryNotEmpty, "directory_not_empty", "ENOTEMPTY", exitWrongObjectType},
+	{disko.ErrInvalidArgument, "invalid_argument", "EINVAL", exitInvalidArgument},
+	{disko.ErrArgumentOutOfRange, "argument_out_of_range", "EDOM", exitInvalidArgument},
+	{disko.ErrNameTooLong, "name_too_long", "ENAMETOOLONG", exitInvalidArgument},
+	// Errors from the host file system, e.g. when opening the image.
+	{fs.ErrNotExist, "not_found", "ENOENT", exitNotFound},
+	{fs.ErrExist, "exists", "EEXIST", exitExists},
+	{fs.ErrPermission, "permission_denied", "EACCES", exitPermissionDenied},
+}
+
+// errorReport is the JSON object written to standard error when a command run
+// with --json fails.
+type errorReport struct {
+	Code     string `json:"code"`
+	Errno    string `json:"errno,omitempty"`
+	ExitCode int    `json:"exit_code"`
+	Path     string `json:"path,omitempty"`
+	Message  string `json:"message"`
+}
+
+// classifyError returns how to report `err`.
+func classifyError(err error) errorReport {
+	report := errorReport{
+		Code:     "error",
+		ExitCode: exitFailure,
+		Message:  err.Error(),
+	}
+
+	for _, class := range errorClasses {
+		if errors.Is(err, class.target) {
+			report.Code = class.code
+			report.Errno = class.errno
+			report.ExitCode = class.exitCode
+			break
+		}
+	}
+
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		report.Path = pathErr.Path
+	}
+	return report
+}
+
+// handleExitError is the CLI's [cli.ExitErrHandlerFunc]. It prints the error
+// that a command failed with and exits with the code for that error. If the
+// command was run with --json, the error is printed as an [errorReport].
+func handleExitError(context *cli.Context, err error) {
+	if err == nil {
+		return
+	}
+	os.Exit(reportError(err, context != nil && context.Bool("json")))
+}
+
+// reportError prints `err` to standard error and returns the exit code for it.
+func reportError(err error, asJSON bool) int {
+	report := classifyError(err)
+	if exitErr, ok := err.(cli.ExitCoder); ok {
+		report.ExitCode = exitErr.ExitCode()
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(os.Stderr)
+		encoder.SetIndent("", "  ")
+		if encoder.Encode(map[string]errorReport{"error": report}) == nil {
+			return report.ExitCode
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "fatal error: %s\n", err.Error())
+	return report.ExitCode
+}
+
+// checkArgCount returns an error if the command wasn't given exactly `count`
+// positional arguments.
+func checkArgCount(context *cli.Context, count int) error {
+	if context.NArg() == count {
+		return nil
+	}
+
+	plural := "s"
+	if count == 1 {
+		plural = ""
+	}
+	return disko.ErrInvalidArgument.WithMessage(
+		fmt.Sprintf("expected exactly %d argument%s, got %d", count, plural, context.NArg()))
+}
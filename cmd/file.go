@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/utilities/magic"
+	"github.com/urfave/cli/v2"
+)
+
+// fileTypeInfo is what `file` reports for each path.
+type fileTypeInfo struct {
+	Path string `json:"path"`
+	// Kind is "file", "directory", or "symlink". Only files have Matches.
+	Kind    string        `json:"kind"`
+	Target  string        `json:"target,omitempty"`
+	Matches []magic.Match `json:"matches,omitempty"`
+}
+
+func detectFileTypes(context *cli.Context) error {
+	if context.NArg() < 2 {
+		return disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("expected an image and at least one path, got %d arguments", context.NArg()))
+	}
+	imagePath := context.Args().First()
+
+	image, err := mountImageFile(context, imagePath, disko.MountFlagsAllowRead)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	found := []fileTypeInfo{}
+	for _, objectPath := range context.Args().Tail() {
+		info, err := detectFileType(image, objectPath)
+		if err != nil {
+			return err
+		}
+		found = append(found, info)
+	}
+
+	if context.Bool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(found)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer writer.Flush()
+
+	for _, info := range found {
+		fmt.Fprintf(writer, "%s:\t%s\n", info.Path, describeFileType(info))
+	}
+	return nil
+}
+
+// detectFileType reads the beginning of the object at `objectPath` and guesses
+// what it is. Symbolic links aren't followed.
+func detectFileType(image *mountedImage, objectPath string) (fileTypeInfo, error) {
+	info := fileTypeInfo{Path: objectPath}
+
+	stat, err := image.Lstat(objectPath)
+	if err != nil {
+		return info, err
+	}
+
+	switch {
+	case stat.IsDir():
+		info.Kind = "directory"
+		return info, nil
+	case stat.ModeFlags&os.ModeSymlink != 0:
+		info.Kind = "symlink"
+		info.Target, err = image.Readlink(objectPath)
+		return info, err
+	}
+
+	info.Kind = "file"
+	file, err := image.OpenFile(objectPath, disko.O_RDONLY, 0)
+	if err != nil {
+		return info, err
+	}
+	defer file.Close()
+
+	header := make([]byte, magic.PeekSize)
+	count, err := io.ReadFull(file, header)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return info, err
+	}
+
+	info.Matches = magic.Detect(objectPath, header[:count], stat.Size)
+	return info, nil
+}
+
+// describeFileType gives the text `file` prints for an object: the most likely
+// type, marked if it's only a guess.
+func describeFileType(info fileTypeInfo) string {
+	switch {
+	case info.Kind == "directory":
+		return "directory"
+	case info.Kind == "symlink":
+		return "symbolic link to " + info.Target
+	case len(info.Matches) == 0:
+		return "unknown"
+	case info.Matches[0].Confidence == magic.Guess:
+		return info.Matches[0].Description + "\t(guess)"
+	default:
+		return info.Matches[0].Description
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/dargueta/disko/utilities/pathfilter"
+	"github.com/urfave/cli/v2"
+)
+
+// pathFilterFlags returns the flags for commands that operate on directory
+// trees, which [pathFilterFromContext] turns into a filter.
+func pathFilterFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name: "include",
+			Usage: "Only process paths matching this glob, or regular expression if" +
+				" prefixed with \"re:\". May be repeated.",
+		},
+		&cli.StringSliceFlag{
+			Name:  "exclude",
+			Usage: "Skip paths matching this pattern. May be repeated.",
+		},
+		&cli.IntFlag{
+			Name:  "max-depth",
+			Usage: "Don't go more than this many directories deep (default: no limit)",
+		},
+	}
+}
+
+// pathFilterFromContext creates a filter from the flags given by
+// [pathFilterFlags].
+func pathFilterFromContext(context *cli.Context) (*pathfilter.Filter, error) {
+	return pathfilter.New(
+		context.StringSlice("include"),
+		context.StringSlice("exclude"),
+		context.Int("max-depth"),
+	)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+	"github.com/urfave/cli/v2"
+)
+
+// formatterOptions returns the options to format an image with, from either
+// --size or --geometry.
+func formatterOptions(context *cli.Context) (disks.BasicFormatterOptions, error) {
+	sizeText := context.String("size")
+	slug := context.String("geometry")
+
+	if sizeText != "" && slug != "" {
+		return nil, disko.ErrInvalidArgument.WithMessage(
+			"--size and --geometry can't be used together")
+	} else if slug != "" {
+		geometry, err := disks.GetPredefinedDiskGeometry(slug)
+		if err != nil {
+			return nil, disko.ErrInvalidArgument.Wrap(err)
+		}
+		return disks.FormatterWithGeometryOptions{Geometry: geometry}, nil
+	} else if sizeText != "" {
+		size, err := parseImageSize(sizeText)
+		if err != nil {
+			return nil, disko.ErrInvalidArgument.Wrap(err)
+		}
+		return disks.FormatterSizeOptions{Size: size}, nil
+	}
+	return nil, disko.ErrInvalidArgument.WithMessage("either --size or --geometry is required")
+}
+
+// checkImageSize returns an error if an image of `size` bytes is too small or
+// too large for the file system, according to its features.
+func checkImageSize(registration disko.FileSystemRegistration, size int64) error {
+	features := registration.Features
+	if features.DefaultBlockSize == 0 {
+		return nil
+	}
+
+	blocks := size / int64(features.DefaultBlockSize)
+	if (features.MinTotalBlocks != 0 && blocks < features.MinTotalBlocks) ||
+		(features.MaxTotalBlocks != 0 && blocks > features.MaxTotalBlocks) {
+		return disko.ErrArgumentOutOfRange.WithMessage(
+			fmt.Sprintf(
+				"%s images must be %d to %d blocks of %d bytes, got %d bytes",
+				registration.Name,
+				features.MinTotalBlocks,
+				features.MaxTotalBlocks,
+				features.DefaultBlockSize,
+				size,
+			),
+		)
+	}
+	return nil
+}
+
+func formatImage(context *cli.Context) error {
+	if err := checkArgCount(context, 1); err != nil {
+		return err
+	}
+	imagePath := context.Args().First()
+
+	name := context.String("type")
+	registration, ok := disko.LookUpFileSystem(name)
+	if !ok {
+		return disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("unknown file system type %q", name))
+	} else if registration.New == nil {
+		return disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf("the %s driver can't format images", name))
+	}
+
+	options, err := formatterOptions(context)
+	if err != nil {
+		return err
+	}
+	err = checkImageSize(registration, options.TotalSizeBytes())
+	if err != nil {
+		return err
+	}
+
+	if context.Bool("dry-run") {
+		return planFormat(registration, imagePath, options, context.Bool("force"))
+	} else if context.Bool("force") {
+		err = formatOver(registration, imagePath, options)
+	} else {
+		err = formatNew(registration, imagePath, options)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf(
+		"created %d-byte %s image %s\n", options.TotalSizeBytes(), registration.Name, imagePath)
+	return nil
+}
+
+// formatNew creates the image at `imagePath` and formats it. Wiping an existing
+// image has to be asked for explicitly, so it fails if the file exists.
+func formatNew(
+	registration disko.FileSystemRegistration,
+	imagePath string,
+	options disks.BasicFormatterOptions,
+) error {
+	file, err := os.OpenFile(imagePath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+
+	err = formatFile(registration, file, options)
+	closeErr := file.Close()
+	if err != nil {
+		os.Remove(imagePath)
+		return err
+	}
+	return closeErr
+}
+
+// formatOver formats a new image next to `imagePath` and only replaces the
+// image with it once formatting succeeds. The driver may not reject the options
+// until it's started writing, so formatting the image in place could destroy it
+// and leave nothing usable behind.
+func formatOver(
+	registration disko.FileSystemRegistration,
+	imagePath string,
+	options disks.BasicFormatterOptions,
+) error {
+	tempPath, err := formatTemp(registration, imagePath, options)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tempPath, imagePath)
+	if err != nil {
+		os.Remove(tempPath)
+	}
+	return err
+}
+
+// formatTemp formats a new image in a temporary file in the same directory as
+// `imagePath`, with the same permissions as the image if it exists, and returns
+// the path to the temporary file. It's removed if formatting fails.
+func formatTemp(
+	registration disko.FileSystemRegistration,
+	imagePath string,
+	options disks.BasicFormatterOptions,
+) (string, error) {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(imagePath); err == nil {
+		mode = info.Mode().Perm()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(imagePath), "."+filepath.Base(imagePath)+".*")
+	if err != nil {
+		return "", err
+	}
+	tempPath := file.Name()
+
+	err = formatFile(registration, file, options)
+	if err == nil {
+		err = file.Chmod(mode)
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return "", err
+	}
+	return tempPath, nil
+}
+
+// planFormat prints what formatting the image would do without touching it.
+// The image is formatted in a temporary file that's then deleted, so the
+// driver gets to reject the options exactly as it would for real, and we know
+// the directory can be written to.
+func planFormat(
+	registration disko.FileSystemRegistration,
+	imagePath string,
+	options disks.BasicFormatterOptions,
+	force bool,
+) error {
+	action := "create"
+	if _, err := os.Stat(imagePath); err == nil {
+		if !force {
+			return disko.ErrExists.WithMessage(
+				fmt.Sprintf("%s already exists; use --force to replace it", imagePath))
+		}
+		action = "replace"
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	tempPath, err := formatTemp(registration, imagePath, options)
+	if err != nil {
+		return err
+	}
+	os.Remove(tempPath)
+
+	fmt.Printf(
+		"would %s %d-byte %s image %s\n",
+		action,
+		options.TotalSizeBytes(),
+		registration.Name,
+		imagePath,
+	)
+	return nil
+}
+
+// formatFile has the driver in `registration` create a file system in `file`,
+// after replacing its contents with as many null bytes as `options` asks for.
+func formatFile(
+	registration disko.FileSystemRegistration,
+	file *os.File,
+	options disks.BasicFormatterOptions,
+) error {
+	implementation, driverErr := registration.New(file)
+	if driverErr != nil {
+		return driverErr
+	}
+	formatter, ok := implementation.(disko.FormatImageImplementer)
+	if !ok {
+		return disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf("the %s driver can't format images", registration.Name))
+	}
+
+	err := file.Truncate(0)
+	if err == nil {
+		err = file.Truncate(options.TotalSizeBytes())
+	}
+	if err != nil {
+		return err
+	}
+
+	driverErr = formatter.FormatImage(options)
+	if driverErr != nil {
+		return driverErr
+	}
+	return file.Sync()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+// runCommand runs the CLI with `args` and returns the error the command failed
+// with, instead of exiting.
+func runCommand(t *testing.T, args ...string) error {
+	// Keep the user's config file and plugins out of it.
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	for _, name := range []string{configEnvVar, pluginsEnvVar} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+
+	app := newApp()
+	app.ExitErrHandler = func(*cli.Context, error) {}
+	return app.Run(append([]string{"disko"}, args...))
+}
+
+func TestFormat__FAT(t *testing.T) {
+	imagePath := filepath.Join(t.TempDir(), "floppy.img")
+	require.NoError(t, runCommand(t, "format", "--type", "fat", "--size", "1440K", imagePath))
+
+	info, err := os.Stat(imagePath)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1440*1024, info.Size())
+
+	// The image must be detected as FAT without being told.
+	require.NoError(t, runCommand(t, "ls", imagePath))
+
+	file, err := os.OpenFile(imagePath, os.O_RDWR, 0)
+	require.NoError(t, err)
+	defer file.Close()
+
+	implementation, driverErr := fat.NewDriver(file)
+	require.NoError(t, driverErr)
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowAll))
+	fs := driver.New(implementation, disko.MountFlagsAllowAll)
+
+	entries, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	require.NoError(t, fs.WriteFile("/HELLO.TXT", []byte("hello"), 0o644))
+	data, err := fs.ReadFile("/HELLO.TXT")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), data)
+	require.NoError(t, fs.Flush())
+	require.NoError(t, implementation.Unmount())
+}
+
+func TestFormat__UnsupportedSize(t *testing.T) {
+	imagePath := filepath.Join(t.TempDir(), "floppy.img")
+	err := runCommand(t, "format", "--type", "fat", "--size", "1000K", imagePath)
+	assert.ErrorIs(t, err, disko.ErrNotSupported)
+
+	// The image is only kept if it was there before.
+	_, err = os.Stat(imagePath)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+// If --force is given and formatting fails, the existing image is left alone.
+func TestFormat__ForceUnsupportedSize(t *testing.T) {
+	directory := t.TempDir()
+	imagePath := filepath.Join(directory, "floppy.img")
+	require.NoError(t, runCommand(t, "format", "--type", "fat", "--size", "1440K", imagePath))
+	original, err := os.ReadFile(imagePath)
+	require.NoError(t, err)
+
+	err = runCommand(t, "format", "--force", "--type", "fat", "--size", "1M", imagePath)
+	assert.ErrorIs(t, err, disko.ErrNotSupported)
+
+	current, err := os.ReadFile(imagePath)
+	require.NoError(t, err)
+	assert.Equal(t, original, current)
+
+	// The temporary image was cleaned up.
+	entries, err := os.ReadDir(directory)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestFormat__ForceReplacesImage(t *testing.T) {
+	imagePath := filepath.Join(t.TempDir(), "floppy.img")
+	require.NoError(t, os.WriteFile(imagePath, []byte("not an image"), 0o600))
+
+	err := runCommand(t, "format", "--type", "fat", "--size", "720K", imagePath)
+	assert.ErrorIs(t, err, os.ErrExist)
+
+	require.NoError(t, runCommand(t, "format", "--force", "--type", "fat", "--size", "720K", imagePath))
+	info, err := os.Stat(imagePath)
+	require.NoError(t, err)
+	assert.EqualValues(t, 720*1024, info.Size())
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	require.NoError(t, runCommand(t, "ls", imagePath))
+}
+
+// A dry run checks everything a real format does, without touching the image.
+func TestFormat__DryRun(t *testing.T) {
+	directory := t.TempDir()
+	imagePath := filepath.Join(directory, "floppy.img")
+
+	require.NoError(t, runCommand(t, "format", "--dry-run", "--type", "fat", "--size", "1440K", imagePath))
+	entries, err := os.ReadDir(directory)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	err = runCommand(t, "format", "--dry-run", "--type", "fat", "--size", "1M", imagePath)
+	assert.ErrorIs(t, err, disko.ErrNotSupported)
+
+	require.NoError(t, os.WriteFile(imagePath, []byte("not an image"), 0o644))
+	err = runCommand(t, "format", "--dry-run", "--type", "fat", "--size", "720K", imagePath)
+	assert.ErrorIs(t, err, disko.ErrExists)
+
+	require.NoError(
+		t,
+		runCommand(t, "format", "--dry-run", "--force", "--type", "fat", "--size", "720K", imagePath),
+	)
+	contents, err := os.ReadFile(imagePath)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("not an image"), contents)
+	entries, err = os.ReadDir(directory)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
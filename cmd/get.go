@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/utilities/transcode"
+	"github.com/urfave/cli/v2"
+)
+
+func getFile(context *cli.Context) error {
+	if context.NArg() != 2 && context.NArg() != 3 {
+		return disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("expected 2 or 3 arguments, got %d", context.NArg()))
+	}
+	imagePath := context.Args().Get(0)
+	objectPath := context.Args().Get(1)
+	outputPath := context.Args().Get(2)
+
+	flags := disko.MountFlagsAllowRead
+	if context.Bool("raw") {
+		flags |= disko.MountFlagsNoDecompression
+	}
+	image, err := mountImageFile(context, imagePath, flags)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	// Make sure the file exists before anything is written to the output.
+	_, err = image.Stat(objectPath)
+	if err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	defer reader.Close()
+	go func() {
+		_, err := image.CopyFileTo(objectPath, writer)
+		writer.CloseWithError(err)
+	}()
+
+	var source io.Reader = reader
+	encoding := context.String("text")
+	if encoding != "" || context.Bool("strip-sub") {
+		source, err = transcode.NewReader(
+			source,
+			transcode.Options{
+				Encoding:        encoding,
+				ConvertNewlines: encoding != "",
+				StripSUB:        context.Bool("strip-sub"),
+			},
+		)
+		if err != nil {
+			return disko.ErrInvalidArgument.Wrap(err)
+		}
+	}
+
+	if outputPath == "" || outputPath == "-" {
+		_, err = io.Copy(os.Stdout, source)
+		return err
+	}
+
+	output, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(output, source)
+	closeErr := output.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
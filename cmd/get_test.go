@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Files stored compressed are decompressed unless --raw is given.
+func TestGet__Decompression(t *testing.T) {
+	directory := t.TempDir()
+	imagePath := filepath.Join(directory, "floppy.img")
+	require.NoError(t, runCommand(t, "format", "--type", "fat", "--size", "360K", imagePath))
+
+	original := bytes.Repeat([]byte("compress me "), 100)
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write(original)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	file, err := os.OpenFile(imagePath, os.O_RDWR, 0)
+	require.NoError(t, err)
+	implementation, driverErr := fat.NewDriver(file)
+	require.NoError(t, driverErr)
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowAll))
+	fs := driver.New(implementation, disko.MountFlagsAllowAll)
+	require.NoError(t, fs.WriteFile("/DATA.GZ", compressed.Bytes(), 0o644))
+	require.NoError(t, fs.Flush())
+	require.NoError(t, implementation.Unmount())
+	require.NoError(t, file.Close())
+
+	outputPath := filepath.Join(directory, "data")
+	require.NoError(t, runCommand(t, "get", imagePath, "/DATA.GZ", outputPath))
+	contents, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Equal(t, original, contents)
+
+	require.NoError(t, runCommand(t, "get", "--raw", imagePath, "/DATA.GZ", outputPath))
+	contents, err = os.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Equal(t, compressed.Bytes(), contents)
+
+	err = runCommand(t, "get", imagePath, "/MISSING", outputPath)
+	assert.ErrorIs(t, err, disko.ErrNotFound)
+}
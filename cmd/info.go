@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dargueta/disko"
+	"github.com/urfave/cli/v2"
+)
+
+// fileSystemInfo is what `info` reports for a single file system found on an
+// image.
+type fileSystemInfo struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Features    disko.FSFeatures    `json:"features"`
+	Stat        *disko.FSStat       `json:"stat,omitempty"`
+	Header      []disko.HeaderField `json:"header,omitempty"`
+	Error       string              `json:"error,omitempty"`
+}
+
+type imageInfo struct {
+	Image       string           `json:"image"`
+	Size        int64            `json:"size"`
+	Offset      int64            `json:"offset,omitempty"`
+	FileSystems []fileSystemInfo `json:"file_systems"`
+}
+
+// resolveFileSystems returns the registrations for the file system type the
+// user asked for with --type, or the ones detected on the image otherwise.
+func resolveFileSystems(
+	context *cli.Context,
+	image imageSource,
+) ([]disko.FileSystemRegistration, error) {
+	if name := context.String("type"); name != "" {
+		registration, ok := disko.LookUpFileSystem(name)
+		if !ok {
+			return nil, disko.ErrInvalidArgument.WithMessage(
+				fmt.Sprintf("unknown file system type %q", name))
+		}
+		return []disko.FileSystemRegistration{registration}, nil
+	}
+
+	matches := disko.Detect(image, image.Size())
+	if len(matches) == 0 {
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			"couldn't determine the file system type; use --type")
+	}
+	return matches, nil
+}
+
+func showImageInfo(context *cli.Context) error {
+	if err := checkArgCount(context, 1); err != nil {
+		return err
+	}
+	imagePath := context.Args().First()
+
+	image, err := openImage(imagePath)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	offset, registrations, err := resolveFileSystemsAtOffset(context, image)
+	if err != nil {
+		return err
+	}
+	fsImage := windowImage(image, offset)
+
+	info := imageInfo{Image: imagePath, Size: image.Size(), Offset: offset}
+	for _, registration := range registrations {
+		fsInfo := fileSystemInfo{
+			Name:        registration.Name,
+			Description: registration.Description,
+			Features:    registration.Features,
+		}
+
+		if registration.Describe != nil {
+			description, err := registration.Describe(fsImage, fsImage.Size())
+			if err != nil {
+				fsInfo.Error = err.Error()
+			} else {
+				fsInfo.Stat = &description.Stat
+				fsInfo.Header = description.Header
+			}
+		}
+		info.FileSystems = append(info.FileSystems, fsInfo)
+	}
+
+	if context.Bool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(info)
+	}
+
+	printImageInfo(info)
+	return nil
+}
+
+func printImageInfo(info imageInfo) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer writer.Flush()
+
+	fmt.Fprintf(writer, "Image:\t%s\n", info.Image)
+	fmt.Fprintf(writer, "Size:\t%d bytes\n", info.Size)
+	if info.Offset != 0 {
+		fmt.Fprintf(writer, "File system offset:\t%d bytes\n", info.Offset)
+	}
+
+	for _, fsInfo := range info.FileSystems {
+		fmt.Fprintf(writer, "\nFile system:\t%s (%s)\n", fsInfo.Name, fsInfo.Description)
+		if fsInfo.Error != "" {
+			fmt.Fprintf(writer, "Error:\t%s\n", fsInfo.Error)
+		}
+
+		if fsInfo.Stat != nil {
+			stat := fsInfo.Stat
+			fmt.Fprintln(writer, "\nStatistics")
+			fmt.Fprintf(writer, "  Block size:\t%d bytes\n", stat.BlockSize)
+			fmt.Fprintf(writer, "  Total blocks:\t%d\n", stat.TotalBlocks)
+			fmt.Fprintf(writer, "  Free blocks:\t%d\n", stat.BlocksFree)
+			fmt.Fprintf(writer, "  Available blocks:\t%d\n", stat.BlocksAvailable)
+			if stat.Label != "" {
+				fmt.Fprintf(writer, "  Label:\t%s\n", stat.Label)
+			}
+			if stat.FileSystemID != "" {
+				fmt.Fprintf(writer, "  Serial number:\t%s\n", stat.FileSystemID)
+			}
+		}
+
+		if len(fsInfo.Header) > 0 {
+			fmt.Fprintln(writer, "\nHeader")
+			for _, field := range fsInfo.Header {
+				fmt.Fprintf(writer, "  %s:\t%v\n", field.Name, field.Value)
+			}
+		}
+
+		fmt.Fprintln(writer, "\nFeatures")
+		printStructFields(writer, fsInfo.Features)
+	}
+}
+
+// printStructFields prints every nonzero field of a struct, one per line.
+func printStructFields(writer *tabwriter.Writer, value any) {
+	reflected := reflect.ValueOf(value)
+	for i := 0; i < reflected.NumField(); i++ {
+		field := reflected.Field(i)
+		if field.IsZero() {
+			continue
+		}
+
+		var text string
+		switch typed := field.Interface().(type) {
+		case bool:
+			text = "yes"
+		case time.Time:
+			text = typed.Format(time.DateOnly)
+		default:
+			text = fmt.Sprint(typed)
+		}
+		fmt.Fprintf(writer, "  %s:\t%s\n", reflected.Type().Field(i).Name, text)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dargueta/disko"
+	"github.com/urfave/cli/v2"
+)
+
+// listingEntry is one object listed by `ls`.
+type listingEntry struct {
+	Path   string `json:"path"`
+	Mode   string `json:"mode"`
+	Nlinks uint64 `json:"nlinks"`
+	// Uid and Gid are omitted if the file system doesn't store them.
+	Uid  *uint32 `json:"uid,omitempty"`
+	Gid  *uint32 `json:"gid,omitempty"`
+	Size int64   `json:"size"`
+	// LastModified is omitted if the file system doesn't store it or the
+	// object doesn't have one.
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	// Target is where a symbolic link points.
+	Target string `json:"target,omitempty"`
+}
+
+// newListingEntry creates a [listingEntry] for the object at `path`, on a file
+// system with `features`.
+func newListingEntry(
+	image *mountedImage,
+	path string,
+	stat disko.FileStat,
+	features disko.FSFeatures,
+) (listingEntry, error) {
+	entry := listingEntry{
+		Path:   path,
+		Mode:   stat.ModeFlags.String(),
+		Nlinks: stat.Nlinks,
+		Size:   stat.Size,
+	}
+
+	// Every object has at least one link, even if the file system has no
+	// link counts to go by.
+	if !features.HasHardLinks || entry.Nlinks == 0 {
+		entry.Nlinks = 1
+	}
+	if features.HasUserID {
+		entry.Uid = &stat.Uid
+	}
+	if features.HasGroupID {
+		entry.Gid = &stat.Gid
+	}
+	if features.HasModifiedTime && !stat.LastModified.Equal(disko.UndefinedTimestamp) {
+		entry.LastModified = &stat.LastModified
+	}
+
+	if stat.IsSymlink() {
+		target, err := image.Readlink(path)
+		if err != nil {
+			return listingEntry{}, err
+		}
+		entry.Target = target
+	}
+	return entry, nil
+}
+
+// listImage implements `disko ls`.
+func listImage(context *cli.Context) error {
+	if context.NArg() < 1 || context.NArg() > 2 {
+		return disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("expected 1 or 2 arguments, got %d", context.NArg()))
+	}
+	imagePath := context.Args().Get(0)
+	root := "/"
+	if context.NArg() == 2 {
+		root = context.Args().Get(1)
+	}
+
+	filter, err := pathFilterFromContext(context)
+	if err != nil {
+		return err
+	}
+
+	image, err := mountImageFile(context, imagePath, disko.MountFlagsAllowRead)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	features := image.implementation.GetFSFeatures()
+	stat, err := image.Lstat(root)
+	if err != nil {
+		return err
+	}
+
+	// Like `ls`, a path that isn't a directory lists only itself.
+	entries := []listingEntry{}
+	if !stat.IsDir() {
+		entry, err := newListingEntry(image, image.NormalizePath(root), stat, features)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	} else {
+		err = image.Walk(
+			root,
+			filter,
+			func(path, relPath string, dirent disko.DirectoryEntry) error {
+				entry, err := newListingEntry(image, path, dirent.Stat(), features)
+				if err != nil {
+					return err
+				}
+				entries = append(entries, entry)
+				return nil
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if context.Bool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
+	printListing(entries)
+	return nil
+}
+
+// optionalID formats a user or group ID, or "-" if the file system doesn't
+// have them.
+func optionalID(id *uint32) string {
+	if id == nil {
+		return "-"
+	}
+	return strconv.FormatUint(uint64(*id), 10)
+}
+
+// printListing prints entries in the style of `ls -l`, with the columns padded
+// to line up.
+func printListing(entries []listingEntry) {
+	rows := make([][6]string, len(entries))
+	widths := [6]int{}
+	for i, entry := range entries {
+		modified := "-"
+		if entry.LastModified != nil {
+			modified = entry.LastModified.Format("2006-01-02 15:04")
+		}
+
+		rows[i] = [6]string{
+			entry.Mode,
+			strconv.FormatUint(entry.Nlinks, 10),
+			optionalID(entry.Uid),
+			optionalID(entry.Gid),
+			strconv.FormatInt(entry.Size, 10),
+			modified,
+		}
+		for column, text := range rows[i] {
+			if len(text) > widths[column] {
+				widths[column] = len(text)
+			}
+		}
+	}
+
+	for i, entry := range entries {
+		row := rows[i]
+		name := entry.Path
+		if entry.Target != "" {
+			name += " -> " + entry.Target
+		}
+		fmt.Printf(
+			"%-*s %*s %-*s %-*s %*s %-*s %s\n",
+			widths[0], row[0],
+			widths[1], row[1],
+			widths[2], row[2],
+			widths[3], row[3],
+			widths[4], row[4],
+			widths[5], row[5],
+			name,
+		)
+	}
+}
@@ -1,31 +1,546 @@
 package main
 
 import (
-	"log"
+	"fmt"
 	"os"
+	"strings"
 
+	"github.com/dargueta/disko/utilities/transcode"
 	"github.com/urfave/cli/v2"
 )
 
-func main() {
-	cli := cli.App{
-		Usage: "Manage various types of disk image files",
+// newApp creates the command line interface, with every command.
+func newApp() *cli.App {
+	app := &cli.App{
+		Usage:          "Manage various types of disk image files",
+		ExitErrHandler: handleExitError,
+		Description: "Defaults for any option can be set in a config file, by default" +
+			" " + defaultConfigPath() + ". Keys are option names, e.g. json = true," +
+			" and [COMMAND] sections apply only to that command.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "config",
+				Usage:   "Config file with default options (default: " + defaultConfigPath() + ")",
+				EnvVars: []string{configEnvVar},
+			},
+			&cli.StringSliceFlag{
+				Name:    "plugin",
+				Usage:   "Load file system drivers from a Go plugin (may be repeated)",
+				EnvVars: []string{pluginsEnvVar},
+			},
+		},
+		Before: loadPlugins,
 		Commands: []*cli.Command{
+			{
+				Name:      "analyze",
+				Usage:     "Report how well an image compresses",
+				Action:    analyzeImage,
+				ArgsUsage: "IMAGE",
+				Description: "Shows the distribution of run lengths, the fraction of 512-byte" +
+					" blocks that are all null bytes, the entropy of each region, and the" +
+					" size the image compresses to with RLE8, ULEB128 run lengths, and" +
+					" gzip.",
+				Flags: []cli.Flag{
+					&cli.Int64Flag{
+						Name:  "region-size",
+						Usage: "Size in bytes of the regions to compute the entropy of",
+						Value: 65536,
+					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Print the report as JSON",
+					},
+				},
+			},
+			{
+				Name:      "cp",
+				Usage:     "Copy files from one image to another",
+				Action:    copyBetweenImages,
+				ArgsUsage: "IMAGE:PATH  IMAGE:PATH",
+				Description: "Copies PATH in the first image to PATH in the second, which may" +
+					" be the same image. The source image is mounted read-only. If the" +
+					" destination is an existing directory, the source is copied into" +
+					" it. --type and --fs-offset apply to both images.",
+				Flags: append(
+					[]cli.Flag{
+						&cli.BoolFlag{
+							Name:    "recursive",
+							Aliases: []string{"r"},
+							Usage:   "Copy directories and everything in them",
+						},
+						&cli.BoolFlag{
+							Name:  "preserve-ownership",
+							Usage: "Copy user and group IDs if both file systems have them",
+						},
+						&cli.StringFlag{
+							Name:  "type",
+							Usage: "File system type to use instead of detecting it",
+						},
+						fsOffsetFlag(),
+					},
+					overwriteFlags()...,
+				),
+			},
+			{
+				Name:      "export",
+				Usage:     "Write the files in an image to a tar archive",
+				Action:    exportImage,
+				ArgsUsage: "IMAGE  ARCHIVE",
+				Description: "ARCHIVE may be - to write to standard output. Symbolic links" +
+					" and hard links are stored as links.",
+				Flags: append(
+					[]cli.Flag{
+						&cli.StringFlag{
+							Name:  "root",
+							Usage: "Directory in the image to export",
+							Value: "/",
+						},
+						&cli.IntFlag{
+							Name: "jobs",
+							Usage: "Number of files to read at once; the archive is the same" +
+								" regardless",
+							Value: 1,
+						},
+						&cli.StringFlag{
+							Name:  "type",
+							Usage: "File system type to use instead of detecting it",
+						},
+						fsOffsetFlag(),
+					},
+					pathFilterFlags()...,
+				),
+			},
+			{
+				Name:      "file",
+				Usage:     "Guess the types of files in an image from their contents",
+				Action:    detectFileTypes,
+				ArgsUsage: "IMAGE  PATH...",
+				Description: "Recognizes formats found on vintage disks, such as CP/M and" +
+					" DOS executables, WordStar documents, dBase databases, and" +
+					" tokenized BASIC programs. Types without a signature are marked" +
+					" as guesses.",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Print every possible type of each file as JSON",
+					},
+					&cli.StringFlag{
+						Name:  "type",
+						Usage: "File system type to use instead of detecting it",
+					},
+					fsOffsetFlag(),
+				},
+			},
 			{
 				Name:      "format",
 				Usage:     "Create or wipe an image",
 				Action:    formatImage,
-				ArgsUsage: "HCL_FILE  KML_FILE",
+				ArgsUsage: "IMAGE",
+				Description: "Creates IMAGE with a new, empty file system of the type given" +
+					" with --type. Its size is given with --size, or with --geometry as" +
+					" the name of a predefined disk, e.g. msdos_312in_ds_dd_9. Existing" +
+					" files are only overwritten with --force.",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "type",
+						Usage:    "File system type to create",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "size",
+						Usage: "Size of the image in bytes, with an optional K, M, or G suffix",
+					},
+					&cli.StringFlag{
+						Name:  "geometry",
+						Usage: "Predefined disk geometry to size the image for",
+					},
+					&cli.BoolFlag{
+						Name:    "force",
+						Aliases: []string{"f"},
+						Usage:   "Wipe IMAGE if it already exists",
+					},
+					&cli.BoolFlag{
+						Name: "dry-run",
+						Usage: "Check that IMAGE can be formatted and print what would be" +
+							" done, without changing it",
+					},
+				},
+			},
+			{
+				Name:      "get",
+				Usage:     "Copy a file out of an image",
+				Action:    getFile,
+				ArgsUsage: "IMAGE  PATH  [OUTPUT]",
+				Description: "Writes the file at PATH in IMAGE to OUTPUT, or to standard" +
+					" output if OUTPUT is - or not given. Files stored in a compressed" +
+					" format, such as SQ or gzip, are decompressed unless --raw is" +
+					" given. Text files from old systems can be made readable with" +
+					" --text and --strip-sub.",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "raw",
+						Usage: "Copy the file exactly as it's stored, without decompressing it",
+					},
+					&cli.StringFlag{
+						Name: "text",
+						Usage: "Convert text in this encoding to UTF-8 with LF line endings;" +
+							" one of: " + strings.Join(transcode.EncodingNames(), ", "),
+					},
+					&cli.BoolFlag{
+						Name: "strip-sub",
+						Usage: "Drop everything from the first ^Z, which marks the end of CP/M" +
+							" and DOS text files",
+					},
+					&cli.StringFlag{
+						Name:  "type",
+						Usage: "File system type to use instead of detecting it",
+					},
+					fsOffsetFlag(),
+				},
+			},
+			{
+				Name:      "import",
+				Usage:     "Extract a tar archive into an image",
+				Action:    importImage,
+				ArgsUsage: "IMAGE  ARCHIVE",
+				Description: "ARCHIVE may be - to read from standard input. You're asked" +
+					" before each existing file in the image is overwritten, unless" +
+					" --force or --no-clobber is given.",
+				Flags: append(
+					append(
+						[]cli.Flag{
+							&cli.StringFlag{
+								Name:  "root",
+								Usage: "Directory in the image to extract into",
+								Value: "/",
+							},
+							&cli.BoolFlag{
+								Name: "dry-run",
+								Usage: "Print what would be changed and check that there's room," +
+									" without modifying the image",
+							},
+							&cli.StringFlag{
+								Name:  "type",
+								Usage: "File system type to use instead of detecting it",
+							},
+							fsOffsetFlag(),
+						},
+						overwriteFlags()...,
+					),
+					append(pathFilterFlags(), shortNameFlags()...)...,
+				),
+			},
+			{
+				Name:      "info",
+				Usage:     "Show the file system type, features, and header fields of an image",
+				Action:    showImageInfo,
+				ArgsUsage: "IMAGE",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Print the information as JSON",
+					},
+					&cli.StringFlag{
+						Name:  "type",
+						Usage: "File system type to use instead of detecting it",
+					},
+					fsOffsetFlag(),
+				},
+			},
+			{
+				Name:      "keygen",
+				Usage:     "Create a key pair for signing images",
+				Action:    generateSigningKey,
+				ArgsUsage: "PREFIX",
+				Description: "Writes the private key to PREFIX.key and the public key to" +
+					" PREFIX.pub.",
+			},
+			{
+				Name:      "ls",
+				Usage:     "List the files in an image",
+				Action:    listImage,
+				ArgsUsage: "IMAGE  [PATH]",
+				Description: "Lists everything under PATH, or the whole image if it's not" +
+					" given, with the mode, link count, owner, group, size, and" +
+					" modification time of each object like `ls -l`. Fields the file" +
+					" system doesn't store are shown as -.",
+				Flags: append(
+					[]cli.Flag{
+						&cli.BoolFlag{
+							Name:  "json",
+							Usage: "Print the listing as JSON",
+						},
+						&cli.StringFlag{
+							Name:    "type",
+							Aliases: []string{"fs"},
+							Usage:   "File system type to use instead of detecting it",
+						},
+						fsOffsetFlag(),
+					},
+					pathFilterFlags()...,
+				),
+			},
+			{
+				Name:      "mount",
+				Usage:     "Mount an image on the host with FUSE",
+				Action:    mountOnHost,
+				ArgsUsage: "IMAGE  MOUNT_POINT",
+				Description: "Serves IMAGE at MOUNT_POINT, an existing directory, until" +
+					" it's unmounted with fusermount -u or this command is interrupted." +
+					" The image is read-only unless --write is given. Renaming files" +
+					" isn't supported.",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "write",
+						Usage: "Allow modifying the image",
+					},
+					&cli.BoolFlag{
+						Name:  "allow-other",
+						Usage: "Let other users access the mount point",
+					},
+					&cli.BoolFlag{
+						Name:  "debug",
+						Usage: "Log every FUSE request",
+					},
+					&cli.StringFlag{
+						Name:  "type",
+						Usage: "File system type to use instead of detecting it",
+					},
+					fsOffsetFlag(),
+				},
+			},
+			{
+				Name:      "partitions",
+				Usage:     "List the partitions in a hard disk image",
+				Action:    listPartitions,
+				ArgsUsage: "IMAGE",
+				Description: "Reads the MBR partition table, including logical partitions" +
+					" in an extended partition. Pass a partition's offset to --fs-offset" +
+					" to use the file system in it with other commands.",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Print the partitions as JSON",
+					},
+				},
+			},
+			{
+				Name:      "recluster",
+				Usage:     "Copy a FAT image, changing its cluster size",
+				Action:    reclusterImage,
+				ArgsUsage: "SOURCE  DESTINATION  SECTORS_PER_CLUSTER",
+				Description: "Writes a copy of SOURCE to DESTINATION, which must not exist," +
+					" with SECTORS_PER_CLUSTER sectors in each cluster. The image stays" +
+					" the same size. Deleted files are not copied.",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "type",
+						Usage: "File system type to use instead of detecting it",
+					},
+				},
+			},
+			{
+				Name:      "reformat",
+				Usage:     "Erase everything in a FAT image",
+				Action:    reformatImage,
+				ArgsUsage: "IMAGE",
+				Description: "Clears the FATs and root directory, keeping the image's size and" +
+					" geometry. Clusters marked bad stay marked. The boot sector, including" +
+					" the OEM name, serial number, label, and any boot loader, is kept unless" +
+					" --preserve-boot=false is given, in which case it's replaced with one" +
+					" that can't boot.",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "preserve-boot",
+						Usage: "Keep the existing boot sector",
+						Value: true,
+					},
+					&cli.StringFlag{
+						Name:  "label",
+						Usage: "Volume label for the new boot sector (default: NO NAME)",
+					},
+					&cli.StringFlag{
+						Name:  "oem-name",
+						Usage: "OEM name for the new boot sector (default: MSWIN4.1)",
+					},
+					&cli.StringFlag{
+						Name:  "type",
+						Usage: "File system type to use instead of detecting it",
+					},
+				},
+			},
+			{
+				Name:      "resize",
+				Usage:     "Grow or shrink a FAT image",
+				Action:    resizeImage,
+				ArgsUsage: "IMAGE  SIZE",
+				Description: "SIZE is a number of bytes with an optional K, M, or G suffix," +
+					" e.g. 720K, or \"min\" to shrink the image as far as possible. Files" +
+					" past the new end of the image are moved. Make a copy first; an" +
+					" interrupted resize will corrupt the image.",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "type",
+						Usage: "File system type to use instead of detecting it",
+					},
+				},
+			},
+			{
+				Name:      "scan",
+				Usage:     "List disk images embedded in another file",
+				Action:    scanForImages,
+				ArgsUsage: "FILE",
+				Description: "Searches FILE, e.g. an emulator save state or ROM pack, for" +
+					" file systems with a signature. Pass an offset found this way to" +
+					" --fs-offset to use the image with other commands. Some matches" +
+					" may be false positives.",
+				Flags: []cli.Flag{
+					&cli.Int64Flag{
+						Name:  "alignment",
+						Usage: "Only look for images at multiples of this many bytes",
+						Value: 512,
+					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Print the candidates as JSON",
+					},
+				},
+			},
+			{
+				Name:      "sign",
+				Usage:     "Sign an image or manifest",
+				Action:    signImage,
+				ArgsUsage: "FILE",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "key",
+						Usage:    "Private key file created by the keygen command",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "output",
+						Usage: "Where to write the signature (default: FILE.sig)",
+					},
+				},
+			},
+			{
+				Name:      "stat",
+				Usage:     "Show every status field of a file or directory in an image",
+				Action:    showObjectStat,
+				ArgsUsage: "IMAGE  PATH",
+				Description: "Fields the file system doesn't store are marked as not" +
+					" supported. Symbolic links aren't followed.",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Print the status as JSON",
+					},
+					&cli.StringFlag{
+						Name:  "type",
+						Usage: "File system type to use instead of detecting it",
+					},
+					fsOffsetFlag(),
+				},
+			},
+			{
+				Name:   "newdriver",
+				Usage:  "Generate the skeleton of a new file system driver",
+				Action: generateDriver,
+				Description: "Creates a package with stubs for every method a driver needs" +
+					" to implement, a registration, and tests to start from.",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "name",
+						Usage:    "Name of the file system and package, e.g. \"foofs\"",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "description",
+						Usage: "Human-readable name of the file system (default: NAME in uppercase)",
+					},
+					&cli.StringFlag{
+						Name:  "output",
+						Usage: "Directory to create the package in (default: file_systems/NAME)",
+					},
+				},
+			},
+			{
+				Name:      "push",
+				Usage:     "Upload the chunks of an image that a store doesn't have",
+				Action:    pushImage,
+				ArgsUsage: "IMAGE  STORE  NAME",
+				Description: "STORE is a directory or an s3://bucket/prefix URL. Images are" +
+					" split into fixed-size chunks, and only chunks not already in the" +
+					" store are uploaded.",
+				Flags: []cli.Flag{
+					&cli.Int64Flag{
+						Name:  "chunk-size",
+						Usage: "Chunk size in bytes (default: that of the existing image, or 256 KiB)",
+					},
+				},
+			},
+			{
+				Name:      "pull",
+				Usage:     "Update a local image to match one in a store",
+				Action:    pullImage,
+				ArgsUsage: "STORE  NAME  IMAGE",
+				Description: "Only chunks that differ from the local image are downloaded." +
+					" IMAGE is created if it doesn't exist.",
+			},
+			{
+				Name:      "verify",
+				Usage:     "Verify the signature of an image or manifest",
+				Action:    verifyImage,
+				ArgsUsage: "FILE",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:     "key",
+						Usage:    "File of trusted public keys; may be given multiple times",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "signature",
+						Usage: "Signature file to check (default: FILE.sig)",
+					},
+				},
+			},
+			{
+				Name:      "xxd",
+				Usage:     "Hex dump an image, optionally annotated with its structure",
+				Action:    hexDumpImage,
+				ArgsUsage: "IMAGE",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "annotate",
+						Usage: "Label the FATs, directories, etc. and decode directory entries",
+					},
+					&cli.Int64Flag{
+						Name:  "offset",
+						Usage: "Byte offset to start dumping at",
+					},
+					&cli.Int64Flag{
+						Name:  "length",
+						Usage: "Maximum number of bytes to dump (default: to the end of the image)",
+					},
+					&cli.StringFlag{
+						Name:  "type",
+						Usage: "File system type to use instead of detecting it",
+					},
+				},
 			},
 		},
 	}
 
-	err := cli.Run(os.Args)
-	if err != nil {
-		log.Fatalf("fatal error: %s", err.Error())
-	}
+	installConfigHooks(app.Commands, "")
+	return app
 }
 
-func formatImage(context *cli.Context) error {
-	return nil
+func main() {
+	err := newApp().Run(os.Args)
+	if err != nil {
+		// Errors from commands are reported by handleExitError, so anything that
+		// gets here is a problem with the command line itself.
+		fmt.Fprintf(os.Stderr, "fatal error: %s\n", err.Error())
+		os.Exit(exitInvalidArgument)
+	}
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/fuse"
+	"github.com/urfave/cli/v2"
+)
+
+// mountOnHost serves an image through FUSE until it's unmounted or the command
+// is interrupted.
+func mountOnHost(context *cli.Context) error {
+	if err := checkArgCount(context, 2); err != nil {
+		return err
+	}
+	imagePath := context.Args().Get(0)
+	mountPoint := context.Args().Get(1)
+
+	flags := disko.MountFlagsAllowRead
+	if context.Bool("write") {
+		flags = disko.MountFlagsAllowAll
+	}
+
+	image, err := mountImageFile(context, imagePath, flags)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	server, err := fuse.Mount(
+		image.BaseDriver,
+		flags,
+		mountPoint,
+		fuse.Options{
+			Name:       imagePath,
+			AllowOther: context.Bool("allow-other"),
+			Debug:      context.Bool("debug"),
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupts)
+	go func() {
+		for range interrupts {
+			unmountErr := server.Unmount()
+			if unmountErr != nil {
+				fmt.Fprintf(os.Stderr, "can't unmount %s: %s\n", mountPoint, unmountErr)
+			}
+		}
+	}()
+
+	fmt.Fprintf(os.Stderr, "%s mounted on %s; press Ctrl+C to unmount\n", imagePath, mountPoint)
+	server.Wait()
+	return nil
+}
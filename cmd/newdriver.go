@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"fmt"
+	"go/format"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/urfave/cli/v2"
+)
+
+//go:embed newdriver/*.tmpl
+var driverTemplates embed.FS
+
+// driverNamePattern restricts driver names to what's valid both as a Go package
+// name and as a file system name on the command line.
+var driverNamePattern = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
+
+// driverTemplateData is what the templates in newdriver/ are rendered with.
+type driverTemplateData struct {
+	// Name is the name the driver registers itself under.
+	Name string
+	// Package is the Go package name.
+	Package string
+	// ImportPath is the full import path of the generated package.
+	ImportPath string
+	// Description is the human-readable name of the file system.
+	Description string
+}
+
+func generateDriver(context *cli.Context) error {
+	name := context.String("name")
+	if !driverNamePattern.MatchString(name) {
+		return fmt.Errorf(
+			"invalid driver name %q: must be lowercase letters and digits, starting"+
+				" with a letter",
+			name)
+	}
+
+	description := context.String("description")
+	if description == "" {
+		description = strings.ToUpper(name)
+	}
+
+	outputDir := context.String("output")
+	if outputDir == "" {
+		outputDir = filepath.Join("file_systems", name)
+	}
+
+	importPath, err := importPathForDirectory(outputDir)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(outputDir)
+	if err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s already exists and isn't empty", outputDir)
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	err = os.MkdirAll(outputDir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	data := driverTemplateData{
+		Name:        name,
+		Package:     name,
+		ImportPath:  importPath,
+		Description: description,
+	}
+
+	templates, err := template.ParseFS(driverTemplates, "newdriver/*.tmpl")
+	if err != nil {
+		return err
+	}
+
+	for _, tmpl := range templates.Templates() {
+		var rendered bytes.Buffer
+		err = tmpl.Execute(&rendered, data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", tmpl.Name(), err)
+		}
+
+		source, err := format.Source(rendered.Bytes())
+		if err != nil {
+			return fmt.Errorf("%s: generated invalid code: %w", tmpl.Name(), err)
+		}
+
+		outputPath := filepath.Join(outputDir, strings.TrimSuffix(tmpl.Name(), ".tmpl"))
+		err = os.WriteFile(outputPath, source, 0o644)
+		if err != nil {
+			return err
+		}
+		fmt.Println(outputPath)
+	}
+
+	fmt.Printf(
+		"\nTo make the driver available to the CLI, add this to cmd/drivers.go:\n\n"+
+			"\t_ \"%s\"\n",
+		importPath)
+	return nil
+}
+
+// importPathForDirectory determines the Go import path of a package in
+// `directory` from the module it's in. The directory doesn't need to exist yet.
+func importPathForDirectory(directory string) (string, error) {
+	absDir, err := filepath.Abs(directory)
+	if err != nil {
+		return "", err
+	}
+
+	for moduleRoot := filepath.Dir(absDir); ; moduleRoot = filepath.Dir(moduleRoot) {
+		modulePath, err := readModulePath(filepath.Join(moduleRoot, "go.mod"))
+		if err == nil {
+			relativePath, err := filepath.Rel(moduleRoot, absDir)
+			if err != nil {
+				return "", err
+			}
+			return path.Join(modulePath, filepath.ToSlash(relativePath)), nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		if moduleRoot == filepath.Dir(moduleRoot) {
+			return "", fmt.Errorf("%s isn't inside a Go module", directory)
+		}
+	}
+}
+
+// readModulePath returns the module path declared in a go.mod file.
+func readModulePath(goModPath string) (string, error) {
+	file, err := os.Open(goModPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		modulePath, found := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "module ")
+		if found {
+			return strings.Trim(strings.TrimSpace(modulePath), `"`), nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s has no module declaration", goModPath)
+}
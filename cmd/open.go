@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks/remote"
+	"github.com/urfave/cli/v2"
+)
+
+// With --fs-offset=auto, file systems are searched for at every multiple of
+// autoOffsetAlignment bytes in the first maxAutoOffset bytes of the image.
+const (
+	maxAutoOffset       = 64 * 1024
+	autoOffsetAlignment = 128
+)
+
+// imageSource is an image opened by [openImage].
+type imageSource interface {
+	io.ReaderAt
+	io.Closer
+	Size() int64
+}
+
+// localImage is an [imageSource] for a file on the local file system.
+type localImage struct {
+	*os.File
+	size int64
+}
+
+func (image localImage) Size() int64 {
+	return image.size
+}
+
+// httpImage is a read-only [imageSource] for an image on a web server.
+type httpImage struct {
+	*remote.HTTPStream
+}
+
+func (httpImage) Close() error {
+	return nil
+}
+
+// writableImage is an image opened by [openWritableImage].
+type writableImage interface {
+	imageSource
+	io.WriterAt
+	Truncate(size int64) error
+}
+
+// writableFile is a [writableImage] for a file on the local file system. Its
+// size is looked up every time it's needed, since it changes if the image is
+// resized.
+type writableFile struct {
+	*os.File
+}
+
+func (file writableFile) Size() int64 {
+	info, err := file.Stat()
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// readOnlyImage adds a WriteAt method to an [imageSource] that can't be
+// written, so that it can be mounted.
+type readOnlyImage struct {
+	imageSource
+}
+
+func (readOnlyImage) WriteAt([]byte, int64) (int, error) {
+	return 0, disko.ErrReadOnlyFileSystem
+}
+
+// windowedImage is an [imageSource] for the part of another image that comes
+// after some leading junk. Closing it closes the whole image.
+type windowedImage struct {
+	*io.SectionReader
+	io.Closer
+}
+
+// windowImage returns the part of `image` beginning at byte `offset`.
+func windowImage(image imageSource, offset int64) imageSource {
+	if offset == 0 {
+		return image
+	}
+	return windowedImage{
+		SectionReader: io.NewSectionReader(image, offset, image.Size()-offset),
+		Closer:        image,
+	}
+}
+
+// openImage opens an image for reading. `location` can be a local path, an
+// http:// or https:// URL, or an s3:// URL. S3 credentials are taken from the
+// standard AWS environment variables.
+func openImage(location string) (imageSource, error) {
+	switch {
+	case strings.HasPrefix(location, "s3://"):
+		return remote.OpenS3Image(
+			location, remote.S3ConfigFromEnvironment(), remote.HTTPStreamOptions{})
+	case strings.HasPrefix(location, "http://"), strings.HasPrefix(location, "https://"):
+		stream, err := remote.NewHTTPStream(location, remote.HTTPStreamOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return httpImage{stream}, nil
+	}
+
+	file, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return localImage{File: file, size: info.Size()}, nil
+}
+
+// openWritableImage opens an image for reading and writing. `location` can be
+// a local path or an s3:// URL. Changes to an image in S3 are uploaded when
+// it's closed, so the error from Close must be checked. Images on web servers
+// can't be written.
+func openWritableImage(location string) (writableImage, error) {
+	switch {
+	case strings.HasPrefix(location, "s3://"):
+		image, err := remote.OpenS3Image(
+			location, remote.S3ConfigFromEnvironment(), remote.HTTPStreamOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return image, nil
+	case strings.HasPrefix(location, "http://"), strings.HasPrefix(location, "https://"):
+		return nil, disko.ErrReadOnlyFileSystem.WithMessage(
+			fmt.Sprintf("images on web servers can't be modified: %s", location))
+	}
+
+	file, err := os.OpenFile(location, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return writableFile{file}, nil
+}
+
+// isRemoteLocation returns true if `location` is a URL rather than a local
+// path.
+func isRemoteLocation(location string) bool {
+	return strings.HasPrefix(location, "s3://") ||
+		strings.HasPrefix(location, "http://") ||
+		strings.HasPrefix(location, "https://")
+}
+
+// openImageReader opens an image with [openImage] and returns a stream reading
+// it from the beginning.
+func openImageReader(location string) (io.ReadSeeker, io.Closer, error) {
+	image, err := openImage(location)
+	if err != nil {
+		return nil, nil, err
+	}
+	return io.NewSectionReader(image, 0, image.Size()), image, nil
+}
+
+// fsOffsetFlag is the --fs-offset flag for commands that read a file system.
+func fsOffsetFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name: "fs-offset",
+		Usage: "Byte offset of the file system in the image, for images with a header" +
+			" in front of it, or \"auto\" to search for it",
+		Value: "0",
+	}
+}
+
+// resolveFileSystemsAtOffset is like [resolveFileSystems], but also returns
+// where the file system begins in `image`, as given with --fs-offset. If that's
+// "auto", the beginning of the image is searched for a file system of the type
+// given with --type, or any file system with a signature if there's no --type.
+func resolveFileSystemsAtOffset(
+	context *cli.Context,
+	image imageSource,
+) (int64, []disko.FileSystemRegistration, error) {
+	text := context.String("fs-offset")
+	if text != "auto" {
+		offset, err := strconv.ParseInt(text, 0, 64)
+		if err != nil || offset < 0 || offset >= image.Size() {
+			return 0, nil, disko.ErrInvalidArgument.WithMessage(
+				fmt.Sprintf("invalid file system offset %q", text))
+		}
+		registrations, err := resolveFileSystems(context, windowImage(image, offset))
+		return offset, registrations, err
+	}
+
+	if context.String("type") != "" {
+		registrations, err := resolveFileSystems(context, image)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		offset, found := registrations[0].FindOffset(
+			image, image.Size(), maxAutoOffset, autoOffsetAlignment)
+		if !found {
+			return 0, nil, disko.ErrInvalidFileSystem.WithMessage(
+				fmt.Sprintf(
+					"no %s file system found in the first %d bytes of the image",
+					registrations[0].Name,
+					maxAutoOffset,
+				),
+			)
+		}
+		return offset, registrations, nil
+	}
+
+	offset, matches := disko.DetectWithOffset(
+		image, image.Size(), maxAutoOffset, autoOffsetAlignment)
+	if len(matches) == 0 {
+		return 0, nil, disko.ErrInvalidFileSystem.WithMessage(
+			"couldn't determine the file system type; use --type")
+	}
+	return offset, matches, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xaionaro-go/bytesextra"
+)
+
+// fakeS3 is an S3 server that only supports what a single-part upload needs.
+type fakeS3 struct {
+	lock    sync.Mutex
+	objects map[string][]byte
+}
+
+func (fake *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		fake.objects[r.URL.Path] = body
+	case http.MethodGet, http.MethodHead:
+		object, ok := fake.objects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(object))
+	default:
+		http.Error(w, "unsupported", http.StatusNotImplemented)
+	}
+}
+
+// newFakeS3 starts a fake S3 server and points the AWS environment variables at
+// it.
+func newFakeS3(t *testing.T) *fakeS3 {
+	fake := &fakeS3{objects: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	t.Setenv("AWS_ENDPOINT_URL", server.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	return fake
+}
+
+// newFloppyImage formats a 1.44 MiB FAT image with the CLI and returns its
+// contents.
+func newFloppyImage(t *testing.T) []byte {
+	imagePath := filepath.Join(t.TempDir(), "floppy.img")
+	require.NoError(t, runCommand(t, "format", "--type", "fat", "--size", "1440K", imagePath))
+	data, err := os.ReadFile(imagePath)
+	require.NoError(t, err)
+	return data
+}
+
+// mountFloppyBytes mounts a FAT image held in memory.
+func mountFloppyBytes(t *testing.T, image []byte) *driver.BaseDriver {
+	implementation, err := fat.NewDriver(bytesextra.NewReadWriteSeeker(image))
+	require.NoError(t, err)
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowAll))
+	return driver.New(implementation, disko.MountFlagsAllowAll)
+}
+
+func TestWritableCommands__S3(t *testing.T) {
+	fake := newFakeS3(t)
+	fake.objects["/bucket/floppy.img"] = newFloppyImage(t)
+
+	// A local image with a file to copy.
+	source := newFloppyImage(t)
+	fs := mountFloppyBytes(t, source)
+	require.NoError(t, fs.WriteFile("/HELLO.TXT", []byte("hello"), 0o644))
+	require.NoError(t, fs.Flush())
+	sourcePath := filepath.Join(t.TempDir(), "source.img")
+	require.NoError(t, os.WriteFile(sourcePath, source, 0o644))
+
+	require.NoError(
+		t,
+		runCommand(t, "cp", sourcePath+":/HELLO.TXT", "s3://bucket/floppy.img:/HELLO.TXT"),
+	)
+	data, err := mountFloppyBytes(t, fake.objects["/bucket/floppy.img"]).ReadFile("/HELLO.TXT")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), data)
+
+	require.NoError(t, runCommand(t, "resize", "s3://bucket/floppy.img", "1400K"))
+	assert.Len(t, fake.objects["/bucket/floppy.img"], 1400*1024)
+
+	require.NoError(t, runCommand(t, "reformat", "s3://bucket/floppy.img"))
+	entries, err := mountFloppyBytes(t, fake.objects["/bucket/floppy.img"]).ReadDir("/")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestOpenWritableImage__HTTP(t *testing.T) {
+	_, err := openWritableImage("https://example.com/floppy.img")
+	assert.ErrorIs(t, err, disko.ErrReadOnlyFileSystem)
+}
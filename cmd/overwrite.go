@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dargueta/disko/driver"
+	"github.com/urfave/cli/v2"
+)
+
+// stdinReader is shared by everything that prompts the user, so that one
+// prompt can't buffer the answer to another.
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// overwriteFlags returns the flags for commands that write files into an image,
+// which [overwritePolicyFromContext] turns into an overwrite policy.
+func overwriteFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "force",
+			Aliases: []string{"f"},
+			Usage:   "Overwrite existing files without asking",
+		},
+		&cli.BoolFlag{
+			Name:    "no-clobber",
+			Aliases: []string{"n"},
+			Usage:   "Never overwrite existing files",
+		},
+	}
+}
+
+// overwritePolicyFromContext returns the function deciding whether to replace
+// an existing file, according to the flags from [overwriteFlags]:
+//
+//   - --force overwrites everything.
+//   - --no-clobber skips existing files.
+//   - Otherwise, the user is asked about each file. This requires standard
+//     input to be a terminal not being used for anything else.
+func overwritePolicyFromContext(
+	context *cli.Context,
+	stdinInUse bool,
+) (driver.OverwriteFunc, error) {
+	force := context.Bool("force")
+	noClobber := context.Bool("no-clobber")
+
+	switch {
+	case force && noClobber:
+		return nil, fmt.Errorf("--force and --no-clobber can't be used together")
+	case force:
+		return func(string) (bool, error) { return true, nil }, nil
+	case noClobber:
+		return func(path string) (bool, error) {
+			fmt.Fprintf(os.Stderr, "not overwriting %s\n", path)
+			return false, nil
+		}, nil
+	}
+
+	if stdinInUse {
+		return nil, fmt.Errorf(
+			"can't ask before overwriting files while reading from standard input;" +
+				" use --force or --no-clobber")
+	}
+
+	prompter := overwritePrompter{input: stdinReader}
+	return prompter.confirm, nil
+}
+
+// overwritePrompter asks the user whether to overwrite each existing file.
+type overwritePrompter struct {
+	input *bufio.Reader
+	// all is set once the user says to overwrite everything.
+	all bool
+}
+
+func (prompter *overwritePrompter) confirm(path string) (bool, error) {
+	if prompter.all {
+		return true, nil
+	}
+
+	for {
+		fmt.Fprintf(os.Stderr, "overwrite %s? [y]es, [n]o, [a]ll, [q]uit: ", path)
+		answer, err := prompter.input.ReadString('\n')
+		if err != nil {
+			return false, fmt.Errorf("no answer to overwrite prompt: %w", err)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true, nil
+		case "n", "no", "":
+			return false, nil
+		case "a", "all":
+			prompter.all = true
+			return true, nil
+		case "q", "quit":
+			return false, fmt.Errorf("stopped at %s", path)
+		}
+	}
+}
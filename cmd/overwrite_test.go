@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+// overwriteContext returns a context with the flags from [overwriteFlags]
+// parsed from `args`.
+func overwriteContext(t *testing.T, args ...string) *cli.Context {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	for _, cliFlag := range overwriteFlags() {
+		require.NoError(t, cliFlag.Apply(set))
+	}
+	require.NoError(t, set.Parse(args))
+	return cli.NewContext(cli.NewApp(), set, nil)
+}
+
+func TestOverwritePolicy__Force(t *testing.T) {
+	overwrite, err := overwritePolicyFromContext(overwriteContext(t, "--force"), true)
+	require.NoError(t, err)
+	replace, err := overwrite("/file")
+	require.NoError(t, err)
+	assert.True(t, replace)
+}
+
+func TestOverwritePolicy__NoClobber(t *testing.T) {
+	overwrite, err := overwritePolicyFromContext(overwriteContext(t, "-n"), true)
+	require.NoError(t, err)
+	replace, err := overwrite("/file")
+	require.NoError(t, err)
+	assert.False(t, replace)
+}
+
+func TestOverwritePolicy__Conflict(t *testing.T) {
+	_, err := overwritePolicyFromContext(overwriteContext(t, "-f", "--no-clobber"), false)
+	assert.ErrorContains(t, err, "--force and --no-clobber can't be used together")
+}
+
+// Without either flag the user is asked, which can't be done if standard input
+// is being read for something else.
+func TestOverwritePolicy__PromptNeedsStdin(t *testing.T) {
+	_, err := overwritePolicyFromContext(overwriteContext(t), true)
+	assert.ErrorContains(t, err, "use --force or --no-clobber")
+
+	overwrite, err := overwritePolicyFromContext(overwriteContext(t), false)
+	require.NoError(t, err)
+	assert.NotNil(t, overwrite)
+}
+
+func TestOverwritePrompter(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		replace bool
+	}{
+		{name: "yes", input: "y\n", replace: true},
+		{name: "yes in full", input: " YES \n", replace: true},
+		{name: "no", input: "n\n", replace: false},
+		{name: "no by default", input: "\n", replace: false},
+		{name: "asks again", input: "maybe\nyes\n", replace: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			prompter := overwritePrompter{input: bufio.NewReader(strings.NewReader(testCase.input))}
+			replace, err := prompter.confirm("/file")
+			require.NoError(t, err)
+			assert.Equal(t, testCase.replace, replace)
+		})
+	}
+}
+
+// Once the user answers "all", nothing else is asked.
+func TestOverwritePrompter__All(t *testing.T) {
+	prompter := overwritePrompter{input: bufio.NewReader(strings.NewReader("a\n"))}
+	for i := 0; i < 3; i++ {
+		replace, err := prompter.confirm("/file")
+		require.NoError(t, err)
+		assert.True(t, replace)
+	}
+}
+
+func TestOverwritePrompter__Quit(t *testing.T) {
+	prompter := overwritePrompter{input: bufio.NewReader(strings.NewReader("q\n"))}
+	replace, err := prompter.confirm("/file")
+	assert.ErrorContains(t, err, "stopped at /file")
+	assert.False(t, replace)
+}
+
+func TestOverwritePrompter__NoAnswer(t *testing.T) {
+	prompter := overwritePrompter{input: bufio.NewReader(strings.NewReader("y"))}
+	_, err := prompter.confirm("/file")
+	assert.ErrorContains(t, err, "no answer to overwrite prompt")
+}
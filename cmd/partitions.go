@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+	"github.com/urfave/cli/v2"
+)
+
+// partitionInfo is what `partitions` reports for each partition.
+type partitionInfo struct {
+	Number   int   `json:"number"`
+	Type     uint8 `json:"type"`
+	Bootable bool  `json:"bootable"`
+	Logical  bool  `json:"logical"`
+	Offset   int64 `json:"offset"`
+	Size     int64 `json:"size"`
+	// FileSystems are the file systems the partition appears to contain.
+	FileSystems []string `json:"file_systems"`
+}
+
+func listPartitions(context *cli.Context) error {
+	if err := checkArgCount(context, 1); err != nil {
+		return err
+	}
+
+	image, err := openImage(context.Args().First())
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	partitions, err := disks.ReadPartitions(image)
+	if err != nil {
+		return disko.ErrInvalidArgument.Wrap(err)
+	}
+
+	found := []partitionInfo{}
+	for _, partition := range partitions {
+		info := partitionInfo{
+			Number:      partition.Number,
+			Type:        partition.Type,
+			Bootable:    partition.Bootable,
+			Logical:     partition.Logical,
+			Offset:      partition.Offset(),
+			Size:        partition.Size(),
+			FileSystems: []string{},
+		}
+
+		// A damaged table can have partitions past the end of the image.
+		if info.Offset+info.Size <= image.Size() {
+			section := io.NewSectionReader(image, info.Offset, info.Size)
+			for _, registration := range disko.Detect(section, info.Size) {
+				info.FileSystems = append(info.FileSystems, registration.Name)
+			}
+		}
+		found = append(found, info)
+	}
+
+	if context.Bool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(found)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer writer.Flush()
+
+	fmt.Fprintln(writer, "#\tType\tBoot\tOffset\tSize\tFile systems")
+	for _, info := range found {
+		boot := ""
+		if info.Bootable {
+			boot = "*"
+		}
+		fmt.Fprintf(
+			writer,
+			"%d\t%02X\t%s\t%d\t%d\t%s\n",
+			info.Number,
+			info.Type,
+			boot,
+			info.Offset,
+			info.Size,
+			strings.Join(info.FileSystems, ", "),
+		)
+	}
+	return nil
+}
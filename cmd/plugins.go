@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"plugin"
+
+	"github.com/dargueta/disko"
+	"github.com/urfave/cli/v2"
+)
+
+// pluginsEnvVar is the environment variable listing driver plugins to load,
+// separated by commas.
+const pluginsEnvVar = "DISKO_PLUGINS"
+
+// pluginRegistrationsSymbol is the function a driver plugin must export. It
+// returns the registrations of the file systems in the plugin.
+const pluginRegistrationsSymbol = "Registrations"
+
+// loadPlugins loads the driver plugins given with --plugin, and registers the
+// file systems in them so that they can be detected and mounted like the
+// built-in ones. It's used as the Before hook of the app.
+//
+// Plugins are Go plugins built with `go build -buildmode=plugin` against the
+// same version of disko as this program, exporting:
+//
+//	func Registrations() []disko.FileSystemRegistration
+func loadPlugins(context *cli.Context) error {
+	for _, path := range context.StringSlice("plugin") {
+		err := loadPlugin(path)
+		if err != nil {
+			return disko.ErrInvalidArgument.WithMessage(
+				fmt.Sprintf("failed to load driver plugin %q: %s", path, err.Error()))
+		}
+	}
+	return nil
+}
+
+// loadPlugin loads one driver plugin and registers its file systems.
+func loadPlugin(path string) error {
+	loaded, err := plugin.Open(path)
+	if err != nil {
+		return err
+	}
+
+	symbol, err := loaded.Lookup(pluginRegistrationsSymbol)
+	if err != nil {
+		return err
+	}
+	registrations, ok := symbol.(func() []disko.FileSystemRegistration)
+	if !ok {
+		return fmt.Errorf(
+			"%s has type %T, expected func() []disko.FileSystemRegistration",
+			pluginRegistrationsSymbol,
+			symbol,
+		)
+	}
+
+	for _, registration := range registrations() {
+		err = disko.TryRegisterFileSystem(registration)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
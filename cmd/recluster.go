@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/urfave/cli/v2"
+)
+
+func reclusterImage(context *cli.Context) error {
+	if err := checkArgCount(context, 3); err != nil {
+		return err
+	}
+	sourcePath := context.Args().Get(0)
+	destinationPath := context.Args().Get(1)
+
+	sectorsPerCluster, err := strconv.ParseUint(context.Args().Get(2), 10, 8)
+	if err != nil {
+		return fmt.Errorf("invalid number of sectors per cluster %q", context.Args().Get(2))
+	}
+
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+
+	registrations, err := resolveFileSystems(context, localImage{File: source, size: info.Size()})
+	if err != nil {
+		return err
+	} else if len(registrations) != 1 || registrations[0].Name != "fat" {
+		return disko.ErrNotSupported.WithMessage(
+			"changing the cluster size is only supported for FAT images")
+	}
+
+	// Refuse to overwrite an existing file, since the destination must be empty.
+	destination, err := os.OpenFile(destinationPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+
+	err = fat.ConvertClusterSize(source, destination, uint(sectorsPerCluster))
+	closeErr := destination.Close()
+	if err != nil {
+		os.Remove(destinationPath)
+		return err
+	} else if closeErr != nil {
+		return closeErr
+	}
+
+	fmt.Printf(
+		"wrote %s with %d sectors per cluster to %s\n",
+		sourcePath,
+		sectorsPerCluster,
+		destinationPath,
+	)
+	return nil
+}
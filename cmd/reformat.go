@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/urfave/cli/v2"
+)
+
+func reformatImage(context *cli.Context) error {
+	if err := checkArgCount(context, 1); err != nil {
+		return err
+	}
+	imagePath := context.Args().Get(0)
+
+	if context.Bool("preserve-boot") && (context.IsSet("label") || context.IsSet("oem-name")) {
+		return disko.ErrInvalidArgument.WithMessage(
+			"--label and --oem-name only apply with --preserve-boot=false")
+	}
+
+	image, err := openWritableImage(imagePath)
+	if err != nil {
+		return err
+	}
+
+	// Images in S3 are uploaded when they're closed, so the result is only
+	// printed if that worked.
+	message, err := reformatOpenImage(context, image, imagePath)
+	closeErr := image.Close()
+	if err != nil {
+		return err
+	} else if closeErr != nil {
+		return closeErr
+	}
+	fmt.Println(message)
+	return nil
+}
+
+// reformatOpenImage reformats `image` and returns a message describing the new
+// boot sector.
+func reformatOpenImage(
+	context *cli.Context,
+	image writableImage,
+	imagePath string,
+) (string, error) {
+	registrations, err := resolveFileSystems(context, image)
+	if err != nil {
+		return "", err
+	} else if len(registrations) != 1 || registrations[0].Name != "fat" {
+		return "", disko.ErrNotSupported.WithMessage("reformatting is only supported for FAT images")
+	}
+
+	bootSector, err := fat.NewFATBootSectorFromStreamWithOptions(
+		io.NewSectionReader(image, 0, 512),
+		fat.CompatibilityOptions{AllowSmallSectors: true, AtariST: true},
+	)
+	if err != nil {
+		return "", err
+	}
+	description, err := fat.Describe(image, image.Size())
+	if err != nil {
+		return "", err
+	}
+
+	options := fat.ReformatOptions{
+		PreserveBoot: context.Bool("preserve-boot"),
+		OEMName:      context.String("oem-name"),
+		Label:        context.String("label"),
+		SerialNumber: newVolumeSerialNumber(time.Now()),
+	}
+	err = fat.Reformat(image, options)
+	if err != nil {
+		return "", err
+	}
+
+	if options.PreserveBoot {
+		return fmt.Sprintf(
+			"reformatted %s, keeping its boot sector: OEM name %q, serial number %s, label %q",
+			imagePath,
+			strings.TrimRight(string(bootSector.OEMName[:]), " "),
+			description.Stat.FileSystemID,
+			description.Stat.Label,
+		), nil
+	}
+	return fmt.Sprintf(
+		"reformatted %s with a new boot sector: serial number %04X-%04X",
+		imagePath,
+		options.SerialNumber>>16,
+		options.SerialNumber&0xFFFF,
+	), nil
+}
+
+// newVolumeSerialNumber computes a volume serial number from the time the way
+// DOS 4.0 and later do, so that disks formatted at different times get
+// different serial numbers.
+func newVolumeSerialNumber(now time.Time) uint32 {
+	dateWord := uint32(now.Month())<<8 | uint32(now.Day())
+	dateWord += uint32(now.Second())<<8 | uint32(now.Nanosecond()/10000000)
+	timeWord := uint32(now.Hour())<<8 | uint32(now.Minute())
+	timeWord += uint32(now.Year())
+	return (dateWord&0xFFFF)<<16 | timeWord&0xFFFF
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/urfave/cli/v2"
+)
+
+// parseImageSize parses a size given on the command line: a number of bytes
+// with an optional K, M, or G suffix for kibibytes, mebibytes, or gibibytes.
+func parseImageSize(argument string) (int64, error) {
+	size := argument
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(strings.ToUpper(size), "K"):
+		multiplier = disko.KiB
+	case strings.HasSuffix(strings.ToUpper(size), "M"):
+		multiplier = disko.MiB
+	case strings.HasSuffix(strings.ToUpper(size), "G"):
+		multiplier = disko.GiB
+	}
+	if multiplier != 1 {
+		size = size[:len(size)-1]
+	}
+
+	value, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid size %q", argument)
+	}
+	return value * multiplier, nil
+}
+
+func resizeImage(context *cli.Context) error {
+	if err := checkArgCount(context, 2); err != nil {
+		return err
+	}
+	imagePath := context.Args().Get(0)
+	sizeArgument := context.Args().Get(1)
+
+	image, err := openWritableImage(imagePath)
+	if err != nil {
+		return err
+	}
+
+	// Images in S3 are uploaded when they're closed, so the result is only
+	// printed if that worked.
+	message, err := resizeOpenImage(context, image, imagePath, sizeArgument)
+	closeErr := image.Close()
+	if err != nil {
+		return err
+	} else if closeErr != nil {
+		return closeErr
+	}
+	fmt.Println(message)
+	return nil
+}
+
+// resizeOpenImage resizes `image` to the size given by `sizeArgument` and
+// returns a message giving its new size.
+func resizeOpenImage(
+	context *cli.Context,
+	image writableImage,
+	imagePath string,
+	sizeArgument string,
+) (string, error) {
+	registrations, err := resolveFileSystems(context, image)
+	if err != nil {
+		return "", err
+	} else if len(registrations) != 1 || registrations[0].Name != "fat" {
+		return "", disko.ErrNotSupported.WithMessage("resizing is only supported for FAT images")
+	}
+
+	bootSector, err := fat.NewFATBootSectorFromStreamWithOptions(
+		io.NewSectionReader(image, 0, 512),
+		fat.CompatibilityOptions{AllowSmallSectors: true, AtariST: true},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	var newTotalSectors uint
+	if strings.EqualFold(sizeArgument, "min") {
+		newTotalSectors, err = fat.MinimumTotalSectors(image)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		newSize, err := parseImageSize(sizeArgument)
+		if err != nil {
+			return "", err
+		} else if newSize%int64(bootSector.BytesPerSector) != 0 {
+			return "", fmt.Errorf(
+				"size must be a multiple of the sector size, %d bytes",
+				bootSector.BytesPerSector,
+			)
+		}
+		newTotalSectors = uint(newSize / int64(bootSector.BytesPerSector))
+	}
+
+	err = fat.ResizeImage(image, newTotalSectors)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(
+		"resized %s to %d sectors (%d bytes)",
+		imagePath,
+		newTotalSectors,
+		int64(newTotalSectors)*int64(bootSector.BytesPerSector),
+	), nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dargueta/disko"
+	"github.com/urfave/cli/v2"
+)
+
+// embeddedImageInfo is what `scan` reports for each candidate image.
+type embeddedImageInfo struct {
+	Offset      int64    `json:"offset"`
+	Size        int64    `json:"size,omitempty"`
+	FileSystems []string `json:"file_systems"`
+}
+
+func scanForImages(context *cli.Context) error {
+	if err := checkArgCount(context, 1); err != nil {
+		return err
+	}
+
+	alignment := context.Int64("alignment")
+	if alignment <= 0 {
+		return disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("alignment must be positive, got %d", alignment))
+	}
+
+	file, err := openImage(context.Args().First())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	found := []embeddedImageInfo{}
+	for _, embedded := range disko.FindEmbeddedImages(file, file.Size(), alignment) {
+		info := embeddedImageInfo{Offset: embedded.Offset, Size: embedded.Size}
+		for _, registration := range embedded.FileSystems {
+			info.FileSystems = append(info.FileSystems, registration.Name)
+		}
+		found = append(found, info)
+	}
+
+	if context.Bool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(found)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer writer.Flush()
+
+	fmt.Fprintln(writer, "Offset\tSize\tFile systems")
+	for _, info := range found {
+		size := "?"
+		if info.Size != 0 {
+			size = fmt.Sprint(info.Size)
+		}
+		fmt.Fprintf(
+			writer, "%d\t%s\t%s\n", info.Offset, size, strings.Join(info.FileSystems, ", "))
+	}
+	return nil
+}
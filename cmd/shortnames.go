@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	posixpath "path"
+	"strings"
+
+	"github.com/dargueta/disko/file_systems/common/shortname"
+	"github.com/urfave/cli/v2"
+)
+
+// shortNameFlags returns the flags for commands that import files into an
+// image, which [shortNamesFromContext] turns into a name generator.
+func shortNameFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name: "short-names",
+			Usage: "Rename files that don't have 8.3 names, e.g. for FAT. If two" +
+				" files get the same name, this says what to do: " +
+				strings.Join(shortname.PolicyNames(), ", "),
+		},
+		&cli.StringFlag{
+			Name:  "rename-list",
+			Usage: "Write the files renamed by --short-names to this file, or - for standard error",
+		},
+	}
+}
+
+// shortNamesFromContext returns the generator for the --short-names flag, or
+// nil if it wasn't given. The "ask" policy prompts the user for new names,
+// which requires standard input to be a terminal not being used for anything
+// else. If `canPrompt` is false, "ask" falls back to numeric tails instead.
+func shortNamesFromContext(
+	context *cli.Context,
+	stdinInUse bool,
+	canPrompt bool,
+) (*shortname.Generator, error) {
+	policyName := context.String("short-names")
+	if policyName == "" {
+		if context.String("rename-list") != "" {
+			return nil, fmt.Errorf("--rename-list requires --short-names")
+		}
+		return nil, nil
+	}
+
+	policy, err := shortname.ParsePolicy(policyName)
+	if err != nil {
+		return nil, err
+	}
+
+	if policy != shortname.PolicyAsk {
+		return shortname.New(policy), nil
+	} else if !canPrompt {
+		return shortname.New(shortname.PolicyNumericTail), nil
+	} else if stdinInUse {
+		return nil, fmt.Errorf(
+			"can't ask for new names while reading from standard input;" +
+				" use another --short-names policy")
+	}
+
+	generator := shortname.New(policy)
+	generator.Ask = askForShortName
+	return generator, nil
+}
+
+// askForShortName prompts the user for a new name for `name`, since its short
+// name is taken.
+func askForShortName(directory, name, taken string) (string, error) {
+	fmt.Fprintf(
+		os.Stderr,
+		"%s would be named %s, which is taken or not a valid 8.3 name; new name: ",
+		posixpath.Join(directory, name),
+		taken,
+	)
+	answer, err := stdinReader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("no answer to rename prompt: %w", err)
+	}
+
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return "", fmt.Errorf("stopped at %s", posixpath.Join(directory, name))
+	}
+	return answer, nil
+}
+
+// writeRenameList writes the renames `generator` made to the file given with
+// --rename-list, if any, one per line.
+func writeRenameList(context *cli.Context, generator *shortname.Generator) error {
+	listPath := context.String("rename-list")
+	if generator == nil || listPath == "" {
+		return nil
+	}
+
+	var output io.Writer = os.Stderr
+	if listPath != "-" {
+		file, err := os.Create(listPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		output = file
+	}
+
+	for _, rename := range generator.Renames() {
+		_, err := fmt.Fprintf(
+			output,
+			"%s -> %s\n",
+			posixpath.Join(rename.Directory, rename.Name),
+			posixpath.Join(rename.Directory, rename.ShortName),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
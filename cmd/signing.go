@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dargueta/disko/utilities/signing"
+	"github.com/urfave/cli/v2"
+)
+
+// signatureFileSuffix is appended to a file's path to get the default path of
+// its detached signature.
+const signatureFileSuffix = ".sig"
+
+func generateSigningKey(context *cli.Context) error {
+	if err := checkArgCount(context, 1); err != nil {
+		return err
+	}
+	prefix := context.Args().First()
+
+	publicKey, privateKey, err := signing.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(prefix+".key", []byte(signing.EncodePrivateKey(privateKey)+"\n"), 0o600)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(prefix+".pub", []byte(signing.EncodePublicKey(publicKey)+"\n"), 0o644)
+}
+
+func signImage(context *cli.Context) error {
+	if err := checkArgCount(context, 1); err != nil {
+		return err
+	}
+	imagePath := context.Args().First()
+
+	keyText, err := os.ReadFile(context.String("key"))
+	if err != nil {
+		return err
+	}
+	privateKey, err := signing.DecodePrivateKey(string(keyText))
+	if err != nil {
+		return err
+	}
+
+	image, closer, err := openImageReader(imagePath)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	sig, err := signing.Sign(image, privateKey)
+	if err != nil {
+		return err
+	}
+
+	signaturePath := context.String("output")
+	if signaturePath == "" {
+		signaturePath = imagePath + signatureFileSuffix
+	}
+
+	sigFile, err := os.Create(signaturePath)
+	if err != nil {
+		return err
+	}
+
+	_, err = sig.WriteTo(sigFile)
+	closeErr := sigFile.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func verifyImage(context *cli.Context) error {
+	if err := checkArgCount(context, 1); err != nil {
+		return err
+	}
+	imagePath := context.Args().First()
+
+	trustedKeys, err := loadPublicKeys(context.StringSlice("key"))
+	if err != nil {
+		return err
+	}
+
+	signaturePath := context.String("signature")
+	if signaturePath == "" {
+		signaturePath = imagePath + signatureFileSuffix
+	}
+
+	sigFile, err := os.Open(signaturePath)
+	if err != nil {
+		return err
+	}
+
+	sig, err := signing.ReadSignature(sigFile)
+	closeErr := sigFile.Close()
+	if err != nil {
+		return err
+	} else if closeErr != nil {
+		return closeErr
+	}
+
+	image, closer, err := openImageReader(imagePath)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	err = signing.Verify(image, sig, trustedKeys...)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: signature OK (key %s)\n", imagePath, signing.EncodePublicKey(sig.PublicKey))
+	return nil
+}
+
+// loadPublicKeys reads public keys from each of the given files. A file may
+// contain multiple keys, one per line.
+func loadPublicKeys(paths []string) ([]ed25519.PublicKey, error) {
+	keys := []ed25519.PublicKey{}
+	for _, path := range paths {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, line := range strings.Split(string(contents), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			key, err := signing.DecodePublicKey(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
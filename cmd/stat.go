@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/urfave/cli/v2"
+)
+
+// statField is one field of a [disko.FileStat] as reported by `stat`.
+type statField struct {
+	Name  string `json:"name"`
+	Value any    `json:"value"`
+	// Supported is false if the file system doesn't store this field according
+	// to its [disko.FSFeatures], so Value is only a placeholder.
+	Supported bool `json:"supported"`
+}
+
+type objectStatInfo struct {
+	Image  string      `json:"image"`
+	Path   string      `json:"path"`
+	Fields []statField `json:"fields"`
+	// Xattrs maps the names of the object's extended attributes to their
+	// values. Values that aren't printable text are given in hex.
+	Xattrs map[string]string `json:"xattrs,omitempty"`
+}
+
+// timestampValue returns `timestamp`, or nil if it's [disko.UndefinedTimestamp].
+func timestampValue(timestamp time.Time) any {
+	if timestamp.Equal(disko.UndefinedTimestamp) {
+		return nil
+	}
+	return timestamp
+}
+
+// describeFileStat returns every field of `stat`, along with whether a file
+// system with `features` supports it. Fields that have no corresponding
+// feature are always supported.
+func describeFileStat(stat disko.FileStat, features disko.FSFeatures) []statField {
+	return []statField{
+		{"DeviceID", stat.DeviceID, true},
+		{"InodeNumber", stat.InodeNumber, true},
+		{"Nlinks", stat.Nlinks, features.HasHardLinks},
+		{"ModeFlags", stat.ModeFlags.String(), true},
+		{"Uid", stat.Uid, features.HasUserID},
+		{"Gid", stat.Gid, features.HasGroupID},
+		{"Rdev", stat.Rdev, true},
+		{"Size", stat.Size, true},
+		{"BlockSize", stat.BlockSize, true},
+		{"NumBlocks", stat.NumBlocks, true},
+		{"CreatedAt", timestampValue(stat.CreatedAt), features.HasCreatedTime},
+		{"LastChanged", timestampValue(stat.LastChanged), features.HasChangedTime},
+		{"LastAccessed", timestampValue(stat.LastAccessed), features.HasAccessedTime},
+		{"LastModified", timestampValue(stat.LastModified), features.HasModifiedTime},
+		{"DeletedAt", timestampValue(stat.DeletedAt), features.HasDeletedTime},
+	}
+}
+
+func showObjectStat(context *cli.Context) error {
+	if err := checkArgCount(context, 2); err != nil {
+		return err
+	}
+	imagePath := context.Args().Get(0)
+	objectPath := context.Args().Get(1)
+
+	image, err := mountImageFile(context, imagePath, disko.MountFlagsAllowRead)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	stat, err := image.Lstat(objectPath)
+	if err != nil {
+		return err
+	}
+
+	info := objectStatInfo{
+		Image:  imagePath,
+		Path:   objectPath,
+		Fields: describeFileStat(stat, image.implementation.GetFSFeatures()),
+	}
+
+	// Symbolic links are reported on rather than followed, but extended
+	// attributes are only read from what they point to.
+	if !stat.IsSymlink() {
+		info.Xattrs, err = readXattrs(image.BaseDriver, objectPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	if context.Bool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(info)
+	}
+
+	printObjectStat(info)
+	return nil
+}
+
+// readXattrs returns the extended attributes of the object at `path`, with
+// their values formatted for display.
+func readXattrs(fs *driver.BaseDriver, path string) (map[string]string, error) {
+	names, err := fs.ListXattrs(path)
+	if err != nil || len(names) == 0 {
+		return nil, err
+	}
+
+	xattrs := make(map[string]string, len(names))
+	for _, name := range names {
+		value, err := fs.GetXattr(path, name)
+		if err != nil {
+			return nil, err
+		}
+		if isPrintableText(value) {
+			xattrs[name] = string(value)
+		} else {
+			xattrs[name] = hex.EncodeToString(value)
+		}
+	}
+	return xattrs, nil
+}
+
+// isPrintableText returns true if `value` is valid UTF-8 with no control
+// characters.
+func isPrintableText(value []byte) bool {
+	if !utf8.Valid(value) {
+		return false
+	}
+	for _, char := range string(value) {
+		if !unicode.IsPrint(char) {
+			return false
+		}
+	}
+	return true
+}
+
+func printObjectStat(info objectStatInfo) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer writer.Flush()
+
+	fmt.Fprintf(writer, "Path:\t%s\n", info.Path)
+	for _, field := range info.Fields {
+		var text string
+		switch typed := field.Value.(type) {
+		case nil:
+			text = "undefined"
+		case time.Time:
+			text = typed.Format(time.RFC3339)
+		default:
+			text = fmt.Sprint(typed)
+		}
+
+		if !field.Supported {
+			text += "\t(not supported)"
+		}
+		fmt.Fprintf(writer, "  %s:\t%s\n", field.Name, text)
+	}
+
+	names := make([]string, 0, len(info.Xattrs))
+	for name := range info.Xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(writer, "  %s:\t%s\t(extended attribute)\n", name, info.Xattrs[name])
+	}
+}
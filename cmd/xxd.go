@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/dargueta/disko"
+	"github.com/urfave/cli/v2"
+)
+
+const hexDumpLineWidth = 16
+
+func hexDumpImage(context *cli.Context) error {
+	if err := checkArgCount(context, 1); err != nil {
+		return err
+	}
+
+	image, err := openImage(context.Args().First())
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	start := context.Int64("offset")
+	if start < 0 || start > image.Size() {
+		return fmt.Errorf("offset %d is outside the image", start)
+	}
+	end := image.Size()
+	if length := context.Int64("length"); length > 0 && start+length < end {
+		end = start + length
+	}
+
+	regions := []disko.LayoutRegion{}
+	if context.Bool("annotate") {
+		registrations, err := resolveFileSystems(context, image)
+		if err != nil {
+			return err
+		}
+		if len(registrations) > 1 {
+			return fmt.Errorf(
+				"image matches %d file system types; pick one with --type",
+				len(registrations))
+		}
+		if registrations[0].Layout == nil {
+			return fmt.Errorf(
+				"the %s driver doesn't describe its layout", registrations[0].Name)
+		}
+
+		regions, err = registrations[0].Layout(image, image.Size())
+		if err != nil {
+			return err
+		}
+	}
+
+	output := bufio.NewWriter(os.Stdout)
+	defer output.Flush()
+	return writeHexDump(output, image, start, end, regions)
+}
+
+// writeHexDump writes the bytes from `start` up to `end` in the style of
+// `xxd`, one line per 16 bytes. A heading is printed where each region starts,
+// and each line is labeled with the innermost region containing it. Runs of
+// identical lines in the same region are collapsed to a single "*".
+func writeHexDump(
+	output io.Writer,
+	image io.ReaderAt,
+	start int64,
+	end int64,
+	regions []disko.LayoutRegion,
+) error {
+	// Outer regions come before the regions nested in them.
+	sort.SliceStable(
+		regions,
+		func(i, j int) bool {
+			if regions[i].Offset != regions[j].Offset {
+				return regions[i].Offset < regions[j].Offset
+			}
+			return regions[i].Length > regions[j].Length
+		},
+	)
+
+	// Skip headings for regions that begin before the dumped range, but keep
+	// them for labeling lines.
+	nextHeading := sort.Search(
+		len(regions), func(i int) bool { return regions[i].Offset >= start })
+
+	line := make([]byte, hexDumpLineWidth)
+	var previousLine []byte
+	previousLabel := ""
+	skipping := false
+
+	for offset := start; offset < end; offset += hexDumpLineWidth {
+		lineLength := int64(hexDumpLineWidth)
+		if offset+lineLength > end {
+			lineLength = end - offset
+		}
+
+		n, err := image.ReadAt(line[:lineLength], offset)
+		if err != nil && !(err == io.EOF && int64(n) == lineLength) {
+			return err
+		}
+
+		printedHeading := false
+		for ; nextHeading < len(regions) &&
+			regions[nextHeading].Offset < offset+lineLength; nextHeading++ {
+			region := regions[nextHeading]
+			fmt.Fprintf(
+				output,
+				"-- %s [%#x-%#x, %d bytes]\n",
+				region.Name,
+				region.Offset,
+				region.Offset+region.Length-1,
+				region.Length,
+			)
+			if region.Details != "" {
+				fmt.Fprintf(output, "   %s\n", region.Details)
+			}
+			printedHeading = true
+		}
+
+		label := innermostRegionName(regions, offset)
+		if !printedHeading && label == previousLabel && bytes.Equal(line[:lineLength], previousLine) {
+			if !skipping {
+				fmt.Fprintln(output, "*")
+				skipping = true
+			}
+			continue
+		}
+		skipping = false
+		previousLine = append(previousLine[:0], line[:lineLength]...)
+		previousLabel = label
+
+		writeHexDumpLine(output, offset, line[:lineLength], label)
+	}
+	return nil
+}
+
+// innermostRegionName returns the name of the smallest region containing
+// `offset`, or an empty string if no region does.
+func innermostRegionName(regions []disko.LayoutRegion, offset int64) string {
+	name := ""
+	smallest := int64(-1)
+	for _, region := range regions {
+		if region.Offset > offset {
+			break
+		}
+		if offset < region.Offset+region.Length &&
+			(smallest < 0 || region.Length <= smallest) {
+			name = region.Name
+			smallest = region.Length
+		}
+	}
+	return name
+}
+
+func writeHexDumpLine(output io.Writer, offset int64, data []byte, label string) {
+	fmt.Fprintf(output, "%08x: ", offset)
+	for i := 0; i < hexDumpLineWidth; i++ {
+		if i < len(data) {
+			fmt.Fprintf(output, "%02x", data[i])
+		} else {
+			fmt.Fprint(output, "  ")
+		}
+		if i%2 == 1 {
+			fmt.Fprint(output, " ")
+		}
+	}
+
+	fmt.Fprint(output, " ")
+	for _, b := range data {
+		if b < 0x20 || b > 0x7e {
+			b = '.'
+		}
+		fmt.Fprintf(output, "%c", b)
+	}
+
+	if label != "" {
+		fmt.Fprintf(
+			output, "%*s  %s", hexDumpLineWidth-len(data), "", label)
+	}
+	fmt.Fprintln(output)
+}
@@ -2,16 +2,23 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 
+	"github.com/dargueta/disko/disks/checksums"
 	"github.com/dargueta/disko/utilities/compression"
 )
 
+// checksumBlockSize is the block size used when generating a checksum sidecar.
+const checksumBlockSize = 512
+
 func main() {
-	if len(os.Args) != 3 {
+	if len(os.Args) != 3 && len(os.Args) != 4 {
 		fmt.Fprintf(
 			os.Stderr,
-			"Compress a file using RLE8 and gzip.\nUsage: %s input-file output-file\n",
+			"Compress a file using RLE8 and gzip, optionally writing block checksums of"+
+				" the uncompressed data to a sidecar file.\n"+
+				"Usage: %s input-file output-file [checksum-file]\n",
 			os.Args[0])
 		os.Exit(1)
 	}
@@ -33,13 +40,51 @@ func main() {
 			os.Stderr, "failed to open file for writing: `%v`: %s\n", outputFilePath, errOut)
 		os.Exit(1)
 	}
-	defer outFile.Close()
 
-	nWritten, err := compression.CompressImage(sourceFile, outFile)
+	var input io.Reader = sourceFile
+	var summer *checksums.Writer
+	if len(os.Args) == 4 {
+		var errSummer error
+		summer, errSummer = checksums.NewWriter(checksumBlockSize, checksums.CRC32)
+		if errSummer != nil {
+			fmt.Fprintf(os.Stderr, "failed to create checksum writer: %s\n", errSummer)
+			os.Exit(1)
+		}
+		input = io.TeeReader(sourceFile, summer)
+	}
+
+	nWritten, err := compression.CompressImage(input, outFile)
+	closeErr := outFile.Close()
+	if err == nil {
+		err = closeErr
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error compressing file: %s\n", err)
 		os.Exit(2)
 	}
 
 	fmt.Printf("Compressed input file to %d bytes.\n", nWritten)
+
+	if summer != nil {
+		checksumFilePath := os.Args[3]
+		sumFile, errSum := os.Create(checksumFilePath)
+		if errSum != nil {
+			fmt.Fprintf(
+				os.Stderr,
+				"failed to open file for writing: `%v`: %s\n",
+				checksumFilePath,
+				errSum)
+			os.Exit(1)
+		}
+
+		_, err = summer.Checksums().WriteTo(sumFile)
+		closeErr = sumFile.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error writing checksums: %s\n", err)
+			os.Exit(2)
+		}
+	}
 }
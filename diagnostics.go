@@ -0,0 +1,92 @@
+package disko
+
+import (
+	"fmt"
+	"sync"
+)
+
+// DiagnosticKind identifies what a [Diagnostic] is about.
+type DiagnosticKind string
+
+const (
+	// DiagnosticIgnoredFeature is a [MountWarning]: the image uses a feature the
+	// implementation ignored because it was mounted with [MountFlagsLenient].
+	DiagnosticIgnoredFeature DiagnosticKind = "ignored-feature"
+	// DiagnosticTimestampClamped means a timestamp was outside the range the
+	// file system can store, and the nearest one it can store was used.
+	DiagnosticTimestampClamped DiagnosticKind = "timestamp-clamped"
+	// DiagnosticNameTransliterated means a name was stored differently than it
+	// was given, e.g. in upper case on a file system that only has upper case
+	// names.
+	DiagnosticNameTransliterated DiagnosticKind = "name-transliterated"
+	// DiagnosticCopiesDiffer means redundant copies of a structure, such as the
+	// FATs of a FAT volume, didn't match. One of them was used and the others
+	// will be overwritten with it.
+	DiagnosticCopiesDiffer DiagnosticKind = "copies-differ"
+)
+
+// Diagnostic describes something an implementation worked around without
+// failing. Unlike a [DriverError], it doesn't mean an operation failed, but
+// the result may not be exactly what was asked for.
+type Diagnostic struct {
+	Kind DiagnosticKind
+	// Path is the absolute path of the object the diagnostic is about, or empty
+	// if it's about the image as a whole.
+	Path    string
+	Message string
+}
+
+func (diagnostic Diagnostic) String() string {
+	if diagnostic.Path == "" {
+		return fmt.Sprintf("%s: %s", diagnostic.Kind, diagnostic.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", diagnostic.Kind, diagnostic.Path, diagnostic.Message)
+}
+
+// Diagnostics collects the diagnostics of a mounted image. Implementations
+// should create one in [FileSystemImplementer.Mount] and return its contents
+// from [DiagnosticsImplementer.Diagnostics]. It's safe to use from multiple
+// goroutines.
+type Diagnostics struct {
+	lock        sync.Mutex
+	diagnostics []Diagnostic
+}
+
+// NewDiagnostics creates an empty list of diagnostics.
+func NewDiagnostics() *Diagnostics {
+	return &Diagnostics{}
+}
+
+// Add records a diagnostic. A diagnostic identical to one already recorded
+// isn't recorded again, so repeating an operation doesn't flood the list.
+func (diagnostics *Diagnostics) Add(kind DiagnosticKind, path string, message string) {
+	diagnostics.lock.Lock()
+	defer diagnostics.lock.Unlock()
+
+	diagnostic := Diagnostic{Kind: kind, Path: path, Message: message}
+	for _, existing := range diagnostics.diagnostics {
+		if existing == diagnostic {
+			return
+		}
+	}
+	diagnostics.diagnostics = append(diagnostics.diagnostics, diagnostic)
+}
+
+// List returns all diagnostics recorded so far, in the order they were added.
+func (diagnostics *Diagnostics) List() []Diagnostic {
+	if diagnostics == nil {
+		return nil
+	}
+
+	diagnostics.lock.Lock()
+	defer diagnostics.lock.Unlock()
+	return append([]Diagnostic(nil), diagnostics.diagnostics...)
+}
+
+// A DiagnosticsImplementer reports what it worked around while the image has
+// been mounted.
+type DiagnosticsImplementer interface {
+	// Diagnostics returns the diagnostics recorded since the most recent call
+	// to [FileSystemImplementer.Mount], not including mount warnings.
+	Diagnostics() []Diagnostic
+}
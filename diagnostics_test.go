@@ -0,0 +1,26 @@
+package disko_test
+
+import (
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnostics__Add(t *testing.T) {
+	diagnostics := disko.NewDiagnostics()
+	diagnostics.Add(disko.DiagnosticNameTransliterated, "/FILE.TXT", "renamed")
+	diagnostics.Add(disko.DiagnosticCopiesDiffer, "", "copy 1 differs")
+	diagnostics.Add(disko.DiagnosticNameTransliterated, "/FILE.TXT", "renamed")
+
+	list := diagnostics.List()
+	if assert.Len(t, list, 2) {
+		assert.Equal(t, "name-transliterated: /FILE.TXT: renamed", list[0].String())
+		assert.Equal(t, "copies-differ: copy 1 differs", list[1].String())
+	}
+}
+
+func TestDiagnostics__Nil(t *testing.T) {
+	var diagnostics *disko.Diagnostics
+	assert.Empty(t, diagnostics.List())
+}
@@ -0,0 +1,269 @@
+// Package cdimage reads the user data of CD-ROM images dumped with raw sectors,
+// such as the BIN files of BIN/CUE pairs, as a plain image of 2048-byte
+// sectors that file system drivers can mount.
+//
+// Raw images keep each sector the way the drive sees it: a sync pattern, a
+// header with the sector's address and mode, and error detection and
+// correction codes around the data. Many archived CDs are only available in
+// this form.
+//
+// The supported sector layouts are:
+//
+//   - 2352 bytes, with any mix of Mode 1 and Mode 2 (CD-ROM XA) sectors.
+//   - 2336 bytes, which are Mode 2 sectors without the sync pattern and
+//     header.
+//   - 2048 bytes, which are already just the user data.
+package cdimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+// Sizes of the parts of a sector.
+const (
+	RawSectorSize   = 2352
+	Mode2SectorSize = 2336
+	UserDataSize    = 2048
+	syncSize        = 12
+	headerSize      = 4
+	subheaderSize   = 8
+)
+
+// syncPattern begins every raw data sector, so that the drive can find them.
+var syncPattern = []byte{0, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0}
+
+// mode2Form2 is set in the submode byte of a Mode 2 sector's subheader if it has
+// 2324 bytes of data and no error correction, as used for audio and video.
+const mode2Form2 = 0x20
+
+// edcTable computes the EDC of a sector, a CRC-32 with the polynomial
+// x^32 + x^31 + x^16 + x^15 + x^4 + x^3 + x + 1.
+var edcTable = crc32.MakeTable(0xD8018001)
+
+// edc computes the EDC of `data`. Unlike the usual CRC-32, it starts at 0 and
+// isn't inverted at the end, but [crc32.Update] does both, so it's undone here.
+func edc(data []byte) uint32 {
+	return ^crc32.Update(0xFFFFFFFF, edcTable, data)
+}
+
+// ImageOptions changes the way a [RawImage] reads sectors.
+type ImageOptions struct {
+	// VerifyEDC makes reads fail with [disko.ErrIOFailed] if a Mode 1 or Mode 2
+	// Form 1 sector's data doesn't match its EDC. It's off by default, since
+	// some dumping tools leave the EDC zeroed out.
+	VerifyEDC bool
+}
+
+// RawImage presents the user data of a data track as a sequence of 2048-byte
+// sectors, so that sector N of the track begins at offset N * 2048.
+//
+// RawImage is read-only, since writing a sector would need its error correction
+// codes to be recomputed. To mount it with a driver that needs a stream, wrap it
+// in a Section with disks.NewSection.
+type RawImage struct {
+	image      io.ReaderAt
+	start      int64
+	sectorSize int64
+	sectors    int64
+	options    ImageOptions
+	closer     io.Closer
+}
+
+// NewRawImage creates a [RawImage] for the track of `size` bytes beginning at
+// `start` in `image`, made of `sectorSize`-byte sectors. The size must be a
+// whole number of sectors.
+func NewRawImage(
+	image io.ReaderAt,
+	start, size int64,
+	sectorSize uint,
+	options ImageOptions,
+) (*RawImage, error) {
+	if sectorSize != RawSectorSize && sectorSize != Mode2SectorSize && sectorSize != UserDataSize {
+		return nil, disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf("%d-byte sectors aren't supported", sectorSize))
+	} else if start < 0 || size < 0 || size%int64(sectorSize) != 0 {
+		return nil, disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf(
+				"track must be a whole number of %d-byte sectors, got %d bytes",
+				sectorSize,
+				size,
+			),
+		)
+	}
+
+	return &RawImage{
+		image:      image,
+		start:      start,
+		sectorSize: int64(sectorSize),
+		sectors:    size / int64(sectorSize),
+		options:    options,
+	}, nil
+}
+
+// DetectSectorSize guesses the size of the sectors of a track image `size` bytes
+// long from its first sector. Only 2352-byte sectors can be recognized for
+// certain, by their sync pattern. Otherwise, it goes by whichever size the image
+// is a multiple of, preferring 2048 bytes.
+func DetectSectorSize(image io.ReaderAt, size int64) (uint, error) {
+	sync := make([]byte, syncSize)
+	if size >= RawSectorSize && size%RawSectorSize == 0 {
+		_, err := image.ReadAt(sync, 0)
+		if err != nil {
+			return 0, disko.ErrIOFailed.Wrap(err)
+		} else if bytes.Equal(sync, syncPattern) {
+			return RawSectorSize, nil
+		}
+	}
+
+	if size > 0 && size%UserDataSize == 0 {
+		return UserDataSize, nil
+	} else if size > 0 && size%Mode2SectorSize == 0 {
+		return Mode2SectorSize, nil
+	}
+	return 0, disko.ErrInvalidFileSystem.WithMessage(
+		fmt.Sprintf("%d bytes isn't a whole number of CD sectors", size))
+}
+
+// Size returns the size of the user data of the track, in bytes.
+func (image *RawImage) Size() int64 {
+	return image.sectors * UserDataSize
+}
+
+// Sectors returns the number of sectors in the track.
+func (image *RawImage) Sectors() int64 {
+	return image.sectors
+}
+
+// SectorSize returns the size of each sector in the underlying image.
+func (image *RawImage) SectorSize() uint {
+	return uint(image.sectorSize)
+}
+
+// Close closes the file the image was opened from by [OpenCue]. It does nothing
+// if the image was created with [NewRawImage].
+func (image *RawImage) Close() error {
+	if image.closer == nil {
+		return nil
+	}
+	return image.closer.Close()
+}
+
+// ReadSector reads the user data of sector `index` of the track into `buffer`,
+// which must be [UserDataSize] bytes long. Mode 0 sectors are all null bytes.
+// Only the first 2048 bytes of Mode 2 Form 2 sectors are returned, since they
+// don't fit.
+func (image *RawImage) ReadSector(index int64, buffer []byte) error {
+	if index < 0 || index >= image.sectors {
+		return disko.ErrArgumentOutOfRange.WithMessage(
+			fmt.Sprintf("sector %d isn't in the range [0, %d)", index, image.sectors))
+	} else if len(buffer) != UserDataSize {
+		return disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("buffer must be %d bytes, got %d", UserDataSize, len(buffer)))
+	}
+
+	sector := make([]byte, image.sectorSize)
+	_, err := image.image.ReadAt(sector, image.start+index*image.sectorSize)
+	if err != nil && err != io.EOF {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+
+	data, err := image.userData(index, sector)
+	if err != nil {
+		return err
+	}
+	copy(buffer, data)
+	return nil
+}
+
+// userData returns the user data of a sector, checking its EDC if asked to.
+func (image *RawImage) userData(index int64, sector []byte) ([]byte, error) {
+	var mode byte
+	var subheader []byte
+	switch image.sectorSize {
+	case UserDataSize:
+		return sector, nil
+	case Mode2SectorSize:
+		mode = 2
+		subheader = sector
+	default:
+		if !bytes.Equal(sector[:syncSize], syncPattern) {
+			return nil, disko.ErrIOFailed.WithMessage(
+				fmt.Sprintf("sector %d doesn't begin with a sync pattern", index))
+		}
+		mode = sector[syncSize+3]
+		subheader = sector[syncSize+headerSize:]
+	}
+
+	// The data covered by the EDC, which comes right after it.
+	var covered []byte
+	var storedEDC []byte
+	var userData []byte
+	switch mode {
+	case 0:
+		return make([]byte, UserDataSize), nil
+	case 1:
+		userData = sector[syncSize+headerSize:]
+		covered = sector[:syncSize+headerSize+UserDataSize]
+		storedEDC = sector[len(covered):]
+	case 2:
+		userData = subheader[subheaderSize:]
+		if subheader[2]&mode2Form2 == 0 {
+			covered = subheader[:subheaderSize+UserDataSize]
+			storedEDC = subheader[len(covered):]
+		}
+	default:
+		return nil, disko.ErrIOFailed.WithMessage(
+			fmt.Sprintf("sector %d has invalid mode %d", index, mode))
+	}
+
+	if image.options.VerifyEDC && covered != nil {
+		expected := binary.LittleEndian.Uint32(storedEDC)
+		if actual := edc(covered); actual != expected {
+			return nil, disko.ErrIOFailed.WithMessage(
+				fmt.Sprintf(
+					"sector %d has EDC %08x, but its data gives %08x",
+					index,
+					expected,
+					actual,
+				),
+			)
+		}
+	}
+	return userData[:UserDataSize], nil
+}
+
+// ReadAt implements [io.ReaderAt], reading the user data of the track as if the
+// sectors held nothing else.
+func (image *RawImage) ReadAt(buffer []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset: %d", offset)
+	}
+
+	sector := make([]byte, UserDataSize)
+	total := 0
+	for total < len(buffer) {
+		position := offset + int64(total)
+		if position >= image.Size() {
+			return total, io.EOF
+		}
+
+		err := image.ReadSector(position/UserDataSize, sector)
+		if err != nil {
+			return total, err
+		}
+		total += copy(buffer[total:], sector[position%UserDataSize:])
+	}
+	return total, nil
+}
+
+// WriteAt implements [io.WriterAt]. It always fails with
+// [disko.ErrReadOnlyFileSystem].
+func (image *RawImage) WriteAt(data []byte, offset int64) (int, error) {
+	return 0, disko.ErrReadOnlyFileSystem.WithMessage("raw CD images can't be written")
+}
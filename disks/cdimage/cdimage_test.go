@@ -0,0 +1,280 @@
+package cdimage_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+	"github.com/dargueta/disko/disks/cdimage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// referenceEDC computes a sector's EDC a bit at a time, the way ECMA-130
+// describes it.
+func referenceEDC(data []byte) uint32 {
+	edc := uint32(0)
+	for _, b := range data {
+		edc ^= uint32(b)
+		for i := 0; i < 8; i++ {
+			if edc&1 != 0 {
+				edc = (edc >> 1) ^ 0xD8018001
+			} else {
+				edc >>= 1
+			}
+		}
+	}
+	return edc
+}
+
+// userData returns a sector's worth of data identifying sector `index`.
+func userData(index int) []byte {
+	return bytes.Repeat([]byte{byte(index), byte(index >> 8), 0xA5, 0x5A}, cdimage.UserDataSize/4)
+}
+
+func bcd(value int) byte {
+	return byte(value/10<<4 | value%10)
+}
+
+// makeRawSector creates a 2352-byte sector with the given mode. Mode 2 sectors
+// are Form 1. The ECC is left zeroed out, since it isn't read.
+func makeRawSector(index int, mode byte, data []byte) []byte {
+	sector := make([]byte, cdimage.RawSectorSize)
+	copy(sector, []byte{0, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0})
+
+	// Sector addresses are offset by the two-second lead-in.
+	frame := index + 2*cdimage.FramesPerSecond
+	sector[12] = bcd(frame / cdimage.FramesPerSecond / 60)
+	sector[13] = bcd(frame / cdimage.FramesPerSecond % 60)
+	sector[14] = bcd(frame % cdimage.FramesPerSecond)
+	sector[15] = mode
+
+	if mode == 1 {
+		copy(sector[16:], data)
+		binary.LittleEndian.PutUint32(sector[2064:], referenceEDC(sector[:2064]))
+	} else {
+		copy(sector[24:], data)
+		binary.LittleEndian.PutUint32(sector[2072:], referenceEDC(sector[16:2072]))
+	}
+	return sector
+}
+
+// makeRawTrack creates a track of `count` raw sectors with the given mode.
+func makeRawTrack(count int, mode byte) []byte {
+	track := []byte{}
+	for i := 0; i < count; i++ {
+		track = append(track, makeRawSector(i, mode, userData(i))...)
+	}
+	return track
+}
+
+func TestRawImage__Mode1(t *testing.T) {
+	track := makeRawTrack(3, 1)
+	image, err := cdimage.NewRawImage(
+		bytes.NewReader(track), 0, int64(len(track)), cdimage.RawSectorSize, cdimage.ImageOptions{VerifyEDC: true})
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, image.Sectors())
+	assert.EqualValues(t, 3*cdimage.UserDataSize, image.Size())
+
+	// Read across the boundary between the first two sectors.
+	buffer := make([]byte, 100)
+	n, err := image.ReadAt(buffer, cdimage.UserDataSize-50)
+	require.NoError(t, err)
+	assert.Equal(t, 100, n)
+	assert.Equal(t, userData(0)[cdimage.UserDataSize-50:], buffer[:50])
+	assert.Equal(t, userData(1)[:50], buffer[50:])
+
+	// Reading past the end gets as much as there is.
+	buffer = make([]byte, cdimage.UserDataSize)
+	n, err = image.ReadAt(buffer, 2*cdimage.UserDataSize+1000)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, cdimage.UserDataSize-1000, n)
+}
+
+func TestRawImage__Mode2(t *testing.T) {
+	track := makeRawTrack(2, 2)
+	image, err := cdimage.NewRawImage(
+		bytes.NewReader(track), 0, int64(len(track)), cdimage.RawSectorSize, cdimage.ImageOptions{VerifyEDC: true})
+	require.NoError(t, err)
+
+	buffer := make([]byte, cdimage.UserDataSize)
+	require.NoError(t, image.ReadSector(1, buffer))
+	assert.Equal(t, userData(1), buffer)
+
+	// The same sectors without the sync pattern and header.
+	cooked := []byte{}
+	for i := 0; i < 2; i++ {
+		cooked = append(cooked, track[i*cdimage.RawSectorSize+16:(i+1)*cdimage.RawSectorSize]...)
+	}
+	image, err = cdimage.NewRawImage(
+		bytes.NewReader(cooked), 0, int64(len(cooked)), cdimage.Mode2SectorSize, cdimage.ImageOptions{VerifyEDC: true})
+	require.NoError(t, err)
+	require.NoError(t, image.ReadSector(1, buffer))
+	assert.Equal(t, userData(1), buffer)
+}
+
+func TestRawImage__BadEDC(t *testing.T) {
+	track := makeRawTrack(2, 1)
+	track[cdimage.RawSectorSize+100] ^= 0xFF
+
+	image, err := cdimage.NewRawImage(
+		bytes.NewReader(track), 0, int64(len(track)), cdimage.RawSectorSize, cdimage.ImageOptions{})
+	require.NoError(t, err)
+	buffer := make([]byte, cdimage.UserDataSize)
+	assert.NoError(t, image.ReadSector(1, buffer))
+
+	image, err = cdimage.NewRawImage(
+		bytes.NewReader(track), 0, int64(len(track)), cdimage.RawSectorSize, cdimage.ImageOptions{VerifyEDC: true})
+	require.NoError(t, err)
+	assert.NoError(t, image.ReadSector(0, buffer))
+	err = image.ReadSector(1, buffer)
+	assert.ErrorIs(t, err, disko.ErrIOFailed)
+	assert.ErrorContains(t, err, "sector 1 has EDC")
+}
+
+func TestRawImage__Section(t *testing.T) {
+	track := makeRawTrack(2, 1)
+	image, err := cdimage.NewRawImage(
+		bytes.NewReader(track), 0, int64(len(track)), cdimage.RawSectorSize, cdimage.ImageOptions{})
+	require.NoError(t, err)
+
+	section := disks.NewSection(image, 0, image.Size())
+	_, err = section.Seek(cdimage.UserDataSize, 0)
+	require.NoError(t, err)
+	buffer := make([]byte, cdimage.UserDataSize)
+	_, err = section.Read(buffer)
+	require.NoError(t, err)
+	assert.Equal(t, userData(1), buffer)
+
+	_, err = section.WriteAt([]byte{1}, 0)
+	assert.ErrorIs(t, err, disko.ErrReadOnlyFileSystem)
+}
+
+func TestDetectSectorSize(t *testing.T) {
+	track := makeRawTrack(2, 1)
+	size, err := cdimage.DetectSectorSize(bytes.NewReader(track), int64(len(track)))
+	require.NoError(t, err)
+	assert.EqualValues(t, cdimage.RawSectorSize, size)
+
+	size, err = cdimage.DetectSectorSize(bytes.NewReader(make([]byte, 4096)), 4096)
+	require.NoError(t, err)
+	assert.EqualValues(t, cdimage.UserDataSize, size)
+
+	_, err = cdimage.DetectSectorSize(bytes.NewReader(make([]byte, 1000)), 1000)
+	assert.ErrorIs(t, err, disko.ErrInvalidFileSystem)
+}
+
+const testCueSheet = `REM A mixed-mode CD
+FILE "My Game.bin" BINARY
+  TRACK 01 MODE1/2352
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    INDEX 00 00:00:04
+    INDEX 01 00:00:06
+FILE "Track 3.bin" BINARY
+  TRACK 03 AUDIO
+    PREGAP 00:02:00
+    INDEX 01 00:00:00
+`
+
+func TestParseCueSheet(t *testing.T) {
+	sheet, err := cdimage.ParseCueSheet(strings.NewReader(testCueSheet))
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		&cdimage.CueSheet{
+			Files: []cdimage.CueFile{
+				{
+					Name: "My Game.bin",
+					Type: "BINARY",
+					Tracks: []cdimage.CueTrack{
+						{Number: 1, Type: "MODE1/2352", Indexes: []cdimage.CueIndex{{1, 0}}},
+						{Number: 2, Type: "AUDIO", Indexes: []cdimage.CueIndex{{0, 4}, {1, 6}}},
+					},
+				},
+				{
+					Name: "Track 3.bin",
+					Type: "BINARY",
+					Tracks: []cdimage.CueTrack{
+						{Number: 3, Type: "AUDIO", Indexes: []cdimage.CueIndex{{1, 0}}},
+					},
+				},
+			},
+		},
+		sheet,
+	)
+
+	file, trackIndex, err := sheet.DataTrack()
+	require.NoError(t, err)
+	assert.Equal(t, "My Game.bin", file.Name)
+	assert.Equal(t, 0, trackIndex)
+
+	// The data track ends where the audio track's pregap begins, and the audio
+	// track itself begins after its pregap.
+	fileSize := int64(10 * cdimage.RawSectorSize)
+	start, size, err := file.TrackExtent(0, fileSize)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, start)
+	assert.EqualValues(t, 4*cdimage.RawSectorSize, size)
+
+	start, size, err = file.TrackExtent(1, fileSize)
+	require.NoError(t, err)
+	assert.EqualValues(t, 6*cdimage.RawSectorSize, start)
+	assert.EqualValues(t, 4*cdimage.RawSectorSize, size)
+}
+
+func TestParseCueSheet__Invalid(t *testing.T) {
+	for _, sheet := range []string{
+		"TRACK 01 MODE1/2352\n",
+		"FILE \"a.bin BINARY\n",
+		"FILE a.bin BINARY\nTRACK 01 MODE1/2352\nINDEX 01 00:60:00\n",
+		"FILE a.bin BINARY\nTRACK 01 MODE1/2352\nINDEX 00 00:00:00\n",
+		"FILE a.bin BINARY\nTRACK 01 MODE1/2352\nINDEX 01 00:00:05\n" +
+			"TRACK 02 AUDIO\nINDEX 01 00:00:05\n",
+	} {
+		_, err := cdimage.ParseCueSheet(strings.NewReader(sheet))
+		assert.ErrorIs(t, err, disko.ErrInvalidFileSystem, sheet)
+	}
+}
+
+func TestOpenCue(t *testing.T) {
+	directory := t.TempDir()
+	data := append(makeRawTrack(4, 1), make([]byte, 6*cdimage.RawSectorSize)...)
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "My Game.bin"), data, 0o644))
+	cuePath := filepath.Join(directory, "game.cue")
+	require.NoError(t, os.WriteFile(cuePath, []byte(testCueSheet), 0o644))
+
+	image, err := cdimage.OpenCue(cuePath, cdimage.ImageOptions{VerifyEDC: true})
+	require.NoError(t, err)
+	defer image.Close()
+
+	assert.EqualValues(t, 4, image.Sectors())
+	buffer := make([]byte, cdimage.UserDataSize)
+	require.NoError(t, image.ReadSector(3, buffer))
+	assert.Equal(t, userData(3), buffer)
+}
+
+func TestDetectVolumeFormat(t *testing.T) {
+	iso := make([]byte, 17*cdimage.UserDataSize)
+	copy(iso[16*cdimage.UserDataSize:], "\x01CD001\x01")
+	format, err := cdimage.DetectVolumeFormat(bytes.NewReader(iso))
+	require.NoError(t, err)
+	assert.Equal(t, cdimage.VolumeFormatISO9660, format)
+
+	highSierra := make([]byte, 17*cdimage.UserDataSize)
+	copy(highSierra[16*cdimage.UserDataSize:], "\x10\x00\x00\x00\x00\x00\x00\x10\x01CDROM\x01")
+	format, err = cdimage.DetectVolumeFormat(bytes.NewReader(highSierra))
+	require.NoError(t, err)
+	assert.Equal(t, cdimage.VolumeFormatHighSierra, format)
+
+	_, err = cdimage.DetectVolumeFormat(bytes.NewReader(make([]byte, 17*cdimage.UserDataSize)))
+	assert.ErrorIs(t, err, disko.ErrInvalidFileSystem)
+	_, err = cdimage.DetectVolumeFormat(bytes.NewReader(make([]byte, 100)))
+	assert.ErrorIs(t, err, disko.ErrInvalidFileSystem)
+}
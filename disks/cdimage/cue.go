@@ -0,0 +1,365 @@
+package cdimage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dargueta/disko"
+)
+
+// FramesPerSecond is the number of sectors in one second of a CD, which cue
+// sheets give positions in along with minutes and seconds.
+const FramesPerSecond = 75
+
+// CueSheet is a parsed cue sheet, describing the tracks of a CD and the files
+// holding them.
+type CueSheet struct {
+	Files []CueFile
+}
+
+// CueFile is a file referenced by a cue sheet, and the tracks in it.
+type CueFile struct {
+	// Name is the name of the file as given in the cue sheet, usually relative
+	// to the directory the cue sheet is in.
+	Name string
+	// Type is the type of the file, e.g. "BINARY" for raw sectors in
+	// little-endian order.
+	Type   string
+	Tracks []CueTrack
+}
+
+// CueTrack is a track in a [CueFile].
+type CueTrack struct {
+	Number uint
+	// Type is the track's mode and sector size, e.g. "MODE1/2352" or "AUDIO".
+	Type    string
+	Indexes []CueIndex
+}
+
+// CueIndex is an index point of a track. Index 0 is the beginning of the
+// track's pregap, and index 1 is where the track itself begins.
+type CueIndex struct {
+	Number uint
+	// Frame is the sector the index is at, counting from the beginning of the
+	// file.
+	Frame int64
+}
+
+// trackSectorSizes gives the size of the sectors of each type of track.
+var trackSectorSizes = map[string]uint{
+	"AUDIO":      RawSectorSize,
+	"CDI/2336":   Mode2SectorSize,
+	"CDI/2352":   RawSectorSize,
+	"MODE1/2048": UserDataSize,
+	"MODE1/2352": RawSectorSize,
+	"MODE2/2336": Mode2SectorSize,
+	"MODE2/2352": RawSectorSize,
+}
+
+// SectorSize returns the size of the track's sectors in its file.
+func (track *CueTrack) SectorSize() (uint, error) {
+	size, ok := trackSectorSizes[track.Type]
+	if !ok {
+		return 0, disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf("track %d has unsupported type %q", track.Number, track.Type))
+	}
+	return size, nil
+}
+
+// IsData returns true if the track holds data rather than audio.
+func (track *CueTrack) IsData() bool {
+	return track.Type != "AUDIO"
+}
+
+// Index returns the frame of index point `number`, or false if the track
+// doesn't have it.
+func (track *CueTrack) Index(number uint) (int64, bool) {
+	for _, index := range track.Indexes {
+		if index.Number == number {
+			return index.Frame, true
+		}
+	}
+	return 0, false
+}
+
+// firstFrame returns the frame the track's sectors begin at in its file,
+// including its pregap.
+func (track *CueTrack) firstFrame() int64 {
+	if frame, ok := track.Index(0); ok {
+		return frame
+	}
+	frame, _ := track.Index(1)
+	return frame
+}
+
+// TrackExtent returns the offset and size in bytes of track `trackIndex` in the
+// file, not including its pregap. `fileSize` is needed since the last track runs
+// to the end of the file. Tracks can have different sector sizes, so the
+// offset is found by adding up the sizes of the tracks before it.
+func (file *CueFile) TrackExtent(trackIndex int, fileSize int64) (int64, int64, error) {
+	if trackIndex < 0 || trackIndex >= len(file.Tracks) {
+		return 0, 0, disko.ErrArgumentOutOfRange.WithMessage(
+			fmt.Sprintf("track index %d isn't in the range [0, %d)", trackIndex, len(file.Tracks)))
+	}
+
+	offset := int64(0)
+	for i := 0; i < trackIndex; i++ {
+		sectorSize, err := file.Tracks[i].SectorSize()
+		if err != nil {
+			return 0, 0, err
+		}
+		frames := file.Tracks[i+1].firstFrame() - file.Tracks[i].firstFrame()
+		offset += frames * int64(sectorSize)
+	}
+
+	track := &file.Tracks[trackIndex]
+	sectorSize, err := track.SectorSize()
+	if err != nil {
+		return 0, 0, err
+	}
+	start, _ := track.Index(1)
+	offset += (start - track.firstFrame()) * int64(sectorSize)
+
+	end := fileSize
+	if trackIndex+1 < len(file.Tracks) {
+		frames := file.Tracks[trackIndex+1].firstFrame() - start
+		end = offset + frames*int64(sectorSize)
+	}
+	if offset > end || end > fileSize {
+		return 0, 0, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf(
+				"track %d of %s doesn't fit in the file's %d bytes",
+				track.Number,
+				file.Name,
+				fileSize,
+			),
+		)
+	}
+	return offset, end - offset, nil
+}
+
+// DataTrack returns the first data track in the cue sheet and the file it's in.
+func (sheet *CueSheet) DataTrack() (*CueFile, int, error) {
+	for i := range sheet.Files {
+		for j := range sheet.Files[i].Tracks {
+			if sheet.Files[i].Tracks[j].IsData() {
+				return &sheet.Files[i], j, nil
+			}
+		}
+	}
+	return nil, 0, disko.ErrNotFound.WithMessage("cue sheet has no data tracks")
+}
+
+// ParseCueSheet parses a cue sheet. Only the FILE, TRACK, and INDEX commands
+// matter for reading data, so others such as TITLE and PREGAP are ignored.
+// Tracks must be in order, and each one must have an index 1.
+func ParseCueSheet(reader io.Reader) (*CueSheet, error) {
+	sheet := &CueSheet{}
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		fields, err := splitCueLine(scanner.Text())
+		if err != nil {
+			return nil, cueError(lineNumber, err.Error())
+		} else if len(fields) == 0 {
+			continue
+		}
+
+		command := strings.ToUpper(fields[0])
+		switch command {
+		case "FILE":
+			if len(fields) != 3 {
+				return nil, cueError(lineNumber, "FILE needs a name and a type")
+			}
+			sheet.Files = append(
+				sheet.Files, CueFile{Name: fields[1], Type: strings.ToUpper(fields[2])})
+
+		case "TRACK":
+			if len(fields) != 3 {
+				return nil, cueError(lineNumber, "TRACK needs a number and a type")
+			} else if len(sheet.Files) == 0 {
+				return nil, cueError(lineNumber, "TRACK must come after a FILE")
+			}
+			number, err := strconv.ParseUint(fields[1], 10, 8)
+			if err != nil {
+				return nil, cueError(lineNumber, fmt.Sprintf("invalid track number %q", fields[1]))
+			}
+			file := &sheet.Files[len(sheet.Files)-1]
+			file.Tracks = append(
+				file.Tracks, CueTrack{Number: uint(number), Type: strings.ToUpper(fields[2])})
+
+		case "INDEX":
+			if len(fields) != 3 {
+				return nil, cueError(lineNumber, "INDEX needs a number and a position")
+			}
+			track := sheet.lastTrack()
+			if track == nil {
+				return nil, cueError(lineNumber, "INDEX must come after a TRACK")
+			}
+			number, err := strconv.ParseUint(fields[1], 10, 8)
+			if err != nil {
+				return nil, cueError(lineNumber, fmt.Sprintf("invalid index number %q", fields[1]))
+			}
+			frame, err := parseCueTime(fields[2])
+			if err != nil {
+				return nil, cueError(lineNumber, err.Error())
+			}
+			track.Indexes = append(track.Indexes, CueIndex{Number: uint(number), Frame: frame})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, disko.ErrIOFailed.Wrap(err)
+	}
+
+	for _, file := range sheet.Files {
+		previousFrame := int64(-1)
+		for _, track := range file.Tracks {
+			frame, ok := track.Index(1)
+			if !ok {
+				return nil, disko.ErrInvalidFileSystem.WithMessage(
+					fmt.Sprintf("track %d has no INDEX 01", track.Number))
+			} else if track.firstFrame() > frame || track.firstFrame() <= previousFrame {
+				return nil, disko.ErrInvalidFileSystem.WithMessage(
+					fmt.Sprintf("track %d's indexes are out of order", track.Number))
+			}
+			previousFrame = frame
+		}
+	}
+	return sheet, nil
+}
+
+// lastTrack returns the track most recently added to the cue sheet, or nil if
+// there are none yet.
+func (sheet *CueSheet) lastTrack() *CueTrack {
+	if len(sheet.Files) == 0 {
+		return nil
+	}
+	file := &sheet.Files[len(sheet.Files)-1]
+	if len(file.Tracks) == 0 {
+		return nil
+	}
+	return &file.Tracks[len(file.Tracks)-1]
+}
+
+func cueError(lineNumber int, message string) error {
+	return disko.ErrInvalidFileSystem.WithMessage(
+		fmt.Sprintf("cue sheet line %d: %s", lineNumber, message))
+}
+
+// splitCueLine splits a line of a cue sheet into fields separated by spaces. A
+// field can be put in double quotes to include spaces in it.
+func splitCueLine(line string) ([]string, error) {
+	fields := []string{}
+	line = strings.TrimSpace(line)
+	for line != "" {
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			fields = append(fields, line[1:end+1])
+			line = line[end+2:]
+		} else {
+			end := strings.IndexAny(line, " \t")
+			if end < 0 {
+				end = len(line)
+			}
+			fields = append(fields, line[:end])
+			line = line[end:]
+		}
+		line = strings.TrimLeft(line, " \t")
+	}
+	return fields, nil
+}
+
+// parseCueTime converts a position in MM:SS:FF form to a frame number.
+func parseCueTime(text string) (int64, error) {
+	parts := strings.Split(text, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid position %q", text)
+	}
+
+	values := [3]int64{}
+	for i, part := range parts {
+		value, err := strconv.ParseUint(part, 10, 16)
+		if err != nil {
+			return 0, fmt.Errorf("invalid position %q", text)
+		}
+		values[i] = int64(value)
+	}
+	if values[1] >= 60 || values[2] >= FramesPerSecond {
+		return 0, fmt.Errorf("invalid position %q", text)
+	}
+	return (values[0]*60+values[1])*FramesPerSecond + values[2], nil
+}
+
+// OpenCue opens the first data track of the CD described by the cue sheet at
+// `cuePath`, which usually holds its file system. The file the track is in is
+// found relative to the cue sheet's directory. The image must be closed when no
+// longer needed.
+func OpenCue(cuePath string, options ImageOptions) (*RawImage, error) {
+	cueFile, err := os.Open(cuePath)
+	if err != nil {
+		return nil, err
+	}
+	sheet, err := ParseCueSheet(cueFile)
+	cueFile.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	file, trackIndex, err := sheet.DataTrack()
+	if err != nil {
+		return nil, err
+	} else if file.Type != "BINARY" {
+		return nil, disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf("%s is a %s file; only BINARY files are supported", file.Name, file.Type))
+	}
+
+	binPath := file.Name
+	if !filepath.IsAbs(binPath) {
+		binPath = filepath.Join(filepath.Dir(cuePath), binPath)
+	}
+	binFile, err := os.Open(binPath)
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := openCueTrack(binFile, file, trackIndex, options)
+	if err != nil {
+		binFile.Close()
+		return nil, err
+	}
+	image.closer = binFile
+	return image, nil
+}
+
+// openCueTrack creates a [RawImage] for a track in `file`, whose contents are in
+// `binFile`.
+func openCueTrack(
+	binFile *os.File,
+	file *CueFile,
+	trackIndex int,
+	options ImageOptions,
+) (*RawImage, error) {
+	stat, err := binFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	start, size, err := file.TrackExtent(trackIndex, stat.Size())
+	if err != nil {
+		return nil, err
+	}
+	sectorSize, err := file.Tracks[trackIndex].SectorSize()
+	if err != nil {
+		return nil, err
+	}
+	return NewRawImage(binFile, start, size, sectorSize, options)
+}
@@ -0,0 +1,74 @@
+package cdimage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+// VolumeFormat is the standard a CD's file system follows.
+type VolumeFormat int
+
+const (
+	// VolumeFormatISO9660 is the ISO 9660 (ECMA-119) file system.
+	VolumeFormatISO9660 = VolumeFormat(iota)
+	// VolumeFormatHighSierra is the High Sierra format ISO 9660 is based on,
+	// used by CDs from before 1988. Its structures are laid out much like ISO
+	// 9660's, but many fields are in different places.
+	VolumeFormatHighSierra
+)
+
+func (format VolumeFormat) String() string {
+	switch format {
+	case VolumeFormatISO9660:
+		return "ISO 9660"
+	case VolumeFormatHighSierra:
+		return "High Sierra"
+	default:
+		return fmt.Sprintf("VolumeFormat(%d)", int(format))
+	}
+}
+
+// VolumeDescriptorSector is the sector the first volume descriptor is in. The
+// sectors before it are reserved for booting.
+const VolumeDescriptorSector = 16
+
+// Both formats put a standard identifier in each volume descriptor, after its
+// type, though High Sierra also puts the descriptor's address before it.
+var (
+	iso9660Identifier    = []byte("CD001")
+	highSierraIdentifier = []byte("CDROM")
+)
+
+const (
+	iso9660IdentifierOffset    = 1
+	highSierraIdentifierOffset = 9
+)
+
+// DetectVolumeFormat determines the standard followed by the file system in
+// `image`, a sequence of 2048-byte sectors such as a [RawImage] or an ISO file,
+// from its first volume descriptor.
+func DetectVolumeFormat(image io.ReaderAt) (VolumeFormat, error) {
+	descriptor := make([]byte, UserDataSize)
+	_, err := image.ReadAt(descriptor, VolumeDescriptorSector*UserDataSize)
+	if err == io.EOF {
+		return 0, disko.ErrInvalidFileSystem.WithMessage(
+			"image is too small to have a volume descriptor")
+	} else if err != nil {
+		return 0, disko.ErrIOFailed.Wrap(err)
+	}
+
+	identifier := descriptor[iso9660IdentifierOffset : iso9660IdentifierOffset+len(iso9660Identifier)]
+	if bytes.Equal(identifier, iso9660Identifier) {
+		return VolumeFormatISO9660, nil
+	}
+
+	identifier = descriptor[highSierraIdentifierOffset : highSierraIdentifierOffset+len(highSierraIdentifier)]
+	if bytes.Equal(identifier, highSierraIdentifier) {
+		return VolumeFormatHighSierra, nil
+	}
+	return 0, disko.ErrInvalidFileSystem.WithMessage(
+		"sector 16 isn't an ISO 9660 or High Sierra volume descriptor")
+}
@@ -0,0 +1,390 @@
+// Package checksums generates and verifies per-block checksums of disk images,
+// stored in a sidecar file next to the image. This is used to detect bit rot in
+// archived images.
+package checksums
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dargueta/disko"
+)
+
+// CRC32 is the name of the IEEE CRC-32 block checksum algorithm.
+const CRC32 = "crc32"
+
+// SHA1 is the name of the SHA-1 block checksum algorithm.
+const SHA1 = "sha1"
+
+// sidecarMagic is the first line of every checksum sidecar file.
+const sidecarMagic = "# disko block checksums v1"
+
+var algorithms = map[string]func() hash.Hash{
+	CRC32: func() hash.Hash { return crc32.NewIEEE() },
+	SHA1:  sha1.New,
+}
+
+// RegisterAlgorithm makes a hash function available for generating and
+// verifying block checksums under the given name. Registering a name a second
+// time replaces the previous definition.
+func RegisterAlgorithm(name string, factory func() hash.Hash) {
+	algorithms[name] = factory
+}
+
+// Algorithms returns the names of all registered checksum algorithms, in
+// sorted order.
+func Algorithms() []string {
+	names := make([]string, 0, len(algorithms))
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func getAlgorithm(name string) (func() hash.Hash, error) {
+	factory, ok := algorithms[name]
+	if !ok {
+		return nil, disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf(
+				"unknown checksum algorithm %q; expected one of %v",
+				name,
+				Algorithms(),
+			),
+		)
+	}
+	return factory, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Sidecar holds a checksum for every block of an image. It's intended to be
+// stored in a file next to the image so that bit rot can be detected when the
+// image is read back later.
+type Sidecar struct {
+	// Algorithm is the name of the hash function used, e.g. [CRC32].
+	Algorithm string
+
+	// BlockSize is the size of a single block, in bytes.
+	BlockSize uint
+
+	// ImageSize is the size of the image, in bytes. If it isn't a multiple of
+	// BlockSize, the last block is shorter than the others.
+	ImageSize int64
+
+	// Digests contains the checksum of each block, in order.
+	Digests [][]byte
+
+	newHash func() hash.Hash
+}
+
+// Compute reads `image` until EOF and returns the checksum of each block in it.
+func Compute(
+	image io.Reader,
+	blockSize uint,
+	algorithm string,
+) (*Sidecar, error) {
+	writer, err := NewWriter(blockSize, algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.Copy(writer, image)
+	if err != nil {
+		return nil, err
+	}
+	return writer.Checksums(), nil
+}
+
+// Read parses a sidecar file written by [Sidecar.WriteTo].
+func Read(r io.Reader) (*Sidecar, error) {
+	scanner := bufio.NewScanner(r)
+	sums := &Sidecar{}
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		if lineNumber == 1 {
+			if line != sidecarMagic {
+				return nil, disko.ErrInvalidArgument.WithMessage(
+					"not a block checksum file: header is missing",
+				)
+			}
+			continue
+		} else if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, hasValue := strings.Cut(line, " ")
+		var err error
+
+		switch {
+		case key == "algorithm" && hasValue:
+			sums.Algorithm = value
+			sums.newHash, err = getAlgorithm(value)
+		case key == "block-size" && hasValue:
+			var blockSize uint64
+			blockSize, err = strconv.ParseUint(value, 10, 32)
+			sums.BlockSize = uint(blockSize)
+		case key == "image-size" && hasValue:
+			sums.ImageSize, err = strconv.ParseInt(value, 10, 64)
+		case !hasValue:
+			var digest []byte
+			digest, err = hex.DecodeString(key)
+			sums.Digests = append(sums.Digests, digest)
+		default:
+			err = fmt.Errorf("unrecognized line %q", line)
+		}
+
+		if err != nil {
+			return nil, disko.ErrInvalidArgument.WithMessage(
+				fmt.Sprintf("bad checksum file, line %d: %s", lineNumber, err.Error()),
+			)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, disko.ErrIOFailed.Wrap(err)
+	}
+
+	if sums.newHash == nil || sums.BlockSize == 0 {
+		return nil, disko.ErrInvalidArgument.WithMessage(
+			"bad checksum file: algorithm or block size missing",
+		)
+	}
+
+	expectedBlocks := (sums.ImageSize + int64(sums.BlockSize) - 1) / int64(sums.BlockSize)
+	if int64(len(sums.Digests)) != expectedBlocks {
+		return nil, disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf(
+				"bad checksum file: expected %d checksums for a %d-byte image, got %d",
+				expectedBlocks,
+				sums.ImageSize,
+				len(sums.Digests),
+			),
+		)
+	}
+	return sums, nil
+}
+
+// WriteTo writes the checksums to a stream in a line-oriented text format. It
+// implements [io.WriterTo].
+func (sums *Sidecar) WriteTo(w io.Writer) (int64, error) {
+	buffer := bytes.Buffer{}
+	fmt.Fprintln(&buffer, sidecarMagic)
+	fmt.Fprintf(&buffer, "algorithm %s\n", sums.Algorithm)
+	fmt.Fprintf(&buffer, "block-size %d\n", sums.BlockSize)
+	fmt.Fprintf(&buffer, "image-size %d\n", sums.ImageSize)
+	for _, digest := range sums.Digests {
+		fmt.Fprintln(&buffer, hex.EncodeToString(digest))
+	}
+	return buffer.WriteTo(w)
+}
+
+// TotalBlocks returns the number of blocks covered by the checksums.
+func (sums *Sidecar) TotalBlocks() uint64 {
+	return uint64(len(sums.Digests))
+}
+
+// VerifyBlock checks the data of a single block against its stored checksum.
+// The last block in the image may be shorter than the others; every other
+// block must be exactly [Sidecar.BlockSize] bytes.
+//
+// A mismatch returns [disko.ErrFileSystemCorrupted].
+func (sums *Sidecar) VerifyBlock(index uint64, data []byte) error {
+	if index >= sums.TotalBlocks() {
+		return disko.ErrArgumentOutOfRange.WithMessage(
+			fmt.Sprintf("block %d not in range [0, %d)", index, sums.TotalBlocks()),
+		)
+	}
+
+	h := sums.newHash()
+	h.Write(data)
+	if !bytes.Equal(h.Sum(nil), sums.Digests[index]) {
+		return disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf("%s checksum mismatch in block %d", sums.Algorithm, index),
+		)
+	}
+	return nil
+}
+
+// VerifyImage reads `image` until EOF and checks every block. It returns the
+// indexes of all blocks that failed verification, in ascending order.
+func (sums *Sidecar) VerifyImage(image io.Reader) ([]uint64, error) {
+	actual, err := Compute(image, sums.BlockSize, sums.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	if actual.ImageSize != sums.ImageSize {
+		return nil, disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf(
+				"image is %d bytes, but checksums are for a %d-byte image",
+				actual.ImageSize,
+				sums.ImageSize,
+			),
+		)
+	}
+
+	badBlocks := []uint64{}
+	for i, digest := range actual.Digests {
+		if !bytes.Equal(digest, sums.Digests[i]) {
+			badBlocks = append(badBlocks, uint64(i))
+		}
+	}
+	return badBlocks, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Writer is an [io.Writer] that computes block checksums of all data written to
+// it. This lets checksums be generated in the same pass as
+// another operation, e.g. with [io.TeeReader] when compressing an image.
+type Writer struct {
+	sums    Sidecar
+	current hash.Hash
+	inBlock uint
+}
+
+// NewWriter creates a [Writer] using the given block size and checksum
+// algorithm.
+func NewWriter(blockSize uint, algorithm string) (*Writer, error) {
+	if blockSize == 0 {
+		return nil, disko.ErrInvalidArgument.WithMessage("block size must be nonzero")
+	}
+
+	factory, err := getAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		sums: Sidecar{
+			Algorithm: algorithm,
+			BlockSize: blockSize,
+			newHash:   factory,
+		},
+		current: factory(),
+	}, nil
+}
+
+// Write implements [io.Writer]. It never fails.
+func (w *Writer) Write(data []byte) (int, error) {
+	totalWritten := len(data)
+
+	for len(data) > 0 {
+		chunkSize := w.sums.BlockSize - w.inBlock
+		if uint(len(data)) < chunkSize {
+			chunkSize = uint(len(data))
+		}
+
+		w.current.Write(data[:chunkSize])
+		w.inBlock += chunkSize
+		data = data[chunkSize:]
+
+		if w.inBlock == w.sums.BlockSize {
+			w.sums.Digests = append(w.sums.Digests, w.current.Sum(nil))
+			w.current = w.sums.newHash()
+			w.inBlock = 0
+		}
+	}
+
+	w.sums.ImageSize += int64(totalWritten)
+	return totalWritten, nil
+}
+
+// Checksums returns the checksums of all data written so far. A trailing
+// partial block is included.
+func (w *Writer) Checksums() *Sidecar {
+	result := w.sums
+	result.Digests = make([][]byte, len(w.sums.Digests), len(w.sums.Digests)+1)
+	copy(result.Digests, w.sums.Digests)
+
+	if w.inBlock > 0 {
+		result.Digests = append(result.Digests, w.current.Sum(nil))
+	}
+	return &result
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// VerifyingReaderAt wraps an [io.ReaderAt] for an image and checks every block
+// it reads against a set of [Sidecar]. If a block doesn't match its
+// checksum, the read fails with [disko.ErrFileSystemCorrupted].
+type VerifyingReaderAt struct {
+	source io.ReaderAt
+	sums   *Sidecar
+}
+
+// NewVerifyingReaderAt creates a [VerifyingReaderAt].
+func NewVerifyingReaderAt(source io.ReaderAt, sums *Sidecar) *VerifyingReaderAt {
+	return &VerifyingReaderAt{source: source, sums: sums}
+}
+
+// ReadAt implements [io.ReaderAt]. Whole blocks are always read from the
+// underlying image so that they can be verified, even if `buffer` only covers
+// part of a block.
+func (r *VerifyingReaderAt) ReadAt(buffer []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("negative offset: %d", offset),
+		)
+	} else if offset >= r.sums.ImageSize {
+		return 0, io.EOF
+	} else if len(buffer) == 0 {
+		return 0, nil
+	}
+
+	blockSize := int64(r.sums.BlockSize)
+	endOffset := offset + int64(len(buffer))
+	if endOffset > r.sums.ImageSize {
+		endOffset = r.sums.ImageSize
+	}
+
+	firstBlock := offset / blockSize
+	lastBlock := (endOffset - 1) / blockSize
+	rawStart := firstBlock * blockSize
+	rawEnd := (lastBlock + 1) * blockSize
+	if rawEnd > r.sums.ImageSize {
+		rawEnd = r.sums.ImageSize
+	}
+
+	raw := make([]byte, rawEnd-rawStart)
+	n, err := r.source.ReadAt(raw, rawStart)
+	if n < len(raw) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, disko.ErrIOFailed.Wrap(err)
+	}
+
+	for block := firstBlock; block <= lastBlock; block++ {
+		blockStart := (block - firstBlock) * blockSize
+		blockEnd := blockStart + blockSize
+		if blockEnd > int64(len(raw)) {
+			blockEnd = int64(len(raw))
+		}
+
+		err = r.sums.VerifyBlock(uint64(block), raw[blockStart:blockEnd])
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	copied := copy(buffer, raw[offset-rawStart:endOffset-rawStart])
+	if copied < len(buffer) {
+		return copied, io.EOF
+	}
+	return copied, nil
+}
@@ -0,0 +1,125 @@
+package checksums_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks/checksums"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeRandomData(t *testing.T, size int) []byte {
+	data := make([]byte, size)
+	_, err := rand.Read(data)
+	require.NoError(t, err, "failed to generate random data")
+	return data
+}
+
+func TestSidecar__RoundTrip(t *testing.T) {
+	for _, algorithm := range checksums.Algorithms() {
+		t.Run(algorithm, func(t *testing.T) {
+			data := makeRandomData(t, 1000)
+			sums, err := checksums.Compute(bytes.NewReader(data), 128, algorithm)
+			require.NoError(t, err, "failed to compute checksums")
+			assert.EqualValues(t, 8, sums.TotalBlocks(), "wrong block count")
+			assert.EqualValues(t, 1000, sums.ImageSize, "wrong image size")
+
+			sidecar := bytes.Buffer{}
+			_, err = sums.WriteTo(&sidecar)
+			require.NoError(t, err, "failed to write sidecar")
+
+			loaded, err := checksums.Read(&sidecar)
+			require.NoError(t, err, "failed to read sidecar back")
+			assert.Equal(t, sums.Algorithm, loaded.Algorithm)
+			assert.Equal(t, sums.BlockSize, loaded.BlockSize)
+			assert.Equal(t, sums.ImageSize, loaded.ImageSize)
+			assert.Equal(t, sums.Digests, loaded.Digests)
+
+			badBlocks, err := loaded.VerifyImage(bytes.NewReader(data))
+			require.NoError(t, err, "verification failed")
+			assert.Empty(t, badBlocks, "unmodified image has bad blocks")
+		})
+	}
+}
+
+func TestWriter__SplitWrites(t *testing.T) {
+	data := makeRandomData(t, 777)
+	expected, err := checksums.Compute(bytes.NewReader(data), 64, checksums.SHA1)
+	require.NoError(t, err)
+
+	writer, err := checksums.NewWriter(64, checksums.SHA1)
+	require.NoError(t, err)
+	for i := 0; i < len(data); i += 13 {
+		end := i + 13
+		if end > len(data) {
+			end = len(data)
+		}
+		writer.Write(data[i:end])
+	}
+	assert.Equal(t, expected.Digests, writer.Checksums().Digests)
+}
+
+func TestSidecar__UnknownAlgorithm(t *testing.T) {
+	_, err := checksums.NewWriter(512, "md4-but-worse")
+	assert.ErrorIs(t, err, disko.ErrNotSupported)
+}
+
+func TestRead__Malformed(t *testing.T) {
+	testCases := map[string]string{
+		"no header":     "algorithm crc32\nblock-size 4\nimage-size 0\n",
+		"bad digest":    "# disko block checksums v1\nalgorithm crc32\nblock-size 4\nimage-size 4\nzz\n",
+		"wrong count":   "# disko block checksums v1\nalgorithm crc32\nblock-size 4\nimage-size 9\n00000000\n",
+		"no block size": "# disko block checksums v1\nalgorithm crc32\nimage-size 0\n",
+	}
+
+	for name, text := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := checksums.Read(bytes.NewBufferString(text))
+			assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+		})
+	}
+}
+
+func TestVerifyingReaderAt__DetectsCorruption(t *testing.T) {
+	data := makeRandomData(t, 1000)
+	sums, err := checksums.Compute(bytes.NewReader(data), 100, checksums.CRC32)
+	require.NoError(t, err)
+
+	// Unmodified data reads back exactly, including across block boundaries and
+	// at the end of the image.
+	reader := checksums.NewVerifyingReaderAt(bytes.NewReader(data), sums)
+	buffer := make([]byte, 250)
+	n, err := reader.ReadAt(buffer, 75)
+	require.NoError(t, err)
+	assert.Equal(t, 250, n)
+	assert.Equal(t, data[75:325], buffer)
+
+	n, err = reader.ReadAt(buffer, 900)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 100, n)
+	assert.Equal(t, data[900:], buffer[:n])
+
+	// Flip a bit in block 4. Reads that don't touch it still succeed.
+	corrupted := bytes.Clone(data)
+	corrupted[456] ^= 0x10
+	reader = checksums.NewVerifyingReaderAt(bytes.NewReader(corrupted), sums)
+
+	_, err = reader.ReadAt(buffer[:100], 0)
+	assert.NoError(t, err, "read of intact block failed")
+
+	_, err = reader.ReadAt(buffer[:10], 450)
+	require.ErrorIs(t, err, disko.ErrFileSystemCorrupted)
+	assert.Contains(t, err.Error(), "block 4")
+
+	var driverErr disko.DriverError
+	assert.True(t, errors.As(err, &driverErr), "error isn't a DriverError")
+
+	badBlocks, err := sums.VerifyImage(bytes.NewReader(corrupted))
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{4}, badBlocks)
+}
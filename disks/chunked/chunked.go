@@ -0,0 +1,295 @@
+// Package chunked stores disk images as fixed-size, content-addressed chunks
+// so that only the chunks that changed need to be transferred when an image is
+// updated. This makes it practical to iterate on large test fixtures kept in a
+// shared store.
+//
+// An image in a store is described by a [Manifest], which lists the SHA-256
+// hash of each chunk in order. Chunks are stored once per distinct hash, so
+// identical chunks (e.g. runs of zeros) are shared within and across images.
+package chunked
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+// DefaultChunkSize is the chunk size used by [Push] when none is given.
+const DefaultChunkSize = 256 * 1024
+
+// ManifestVersion is the current version of the manifest format.
+const ManifestVersion = 1
+
+// Manifest describes an image in terms of its chunks.
+type Manifest struct {
+	Version   int   `json:"version"`
+	ChunkSize int64 `json:"chunk_size"`
+	// Size is the size of the image, in bytes. The last chunk is shorter than
+	// the others if this isn't a multiple of ChunkSize.
+	Size int64 `json:"size"`
+	// Chunks holds the hex SHA-256 hash of each chunk, in order.
+	Chunks []string `json:"chunks"`
+}
+
+// HashChunk returns the hash used to address a chunk with the given contents.
+func HashChunk(data []byte) string {
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:])
+}
+
+// BuildManifest reads `image` until EOF and returns a manifest describing it.
+// If `visit` isn't nil, it's called with the index and contents of each chunk
+// as it's read; the slice is only valid until `visit` returns.
+func BuildManifest(
+	image io.Reader,
+	chunkSize int64,
+	visit func(index int, data []byte) error,
+) (*Manifest, error) {
+	if chunkSize <= 0 {
+		return nil, disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("chunk size must be positive, got %d", chunkSize),
+		)
+	}
+
+	manifest := &Manifest{Version: ManifestVersion, ChunkSize: chunkSize}
+	buffer := make([]byte, chunkSize)
+
+	for {
+		n, err := io.ReadFull(image, buffer)
+		if n > 0 {
+			if visit != nil {
+				visitErr := visit(len(manifest.Chunks), buffer[:n])
+				if visitErr != nil {
+					return nil, visitErr
+				}
+			}
+			manifest.Chunks = append(manifest.Chunks, HashChunk(buffer[:n]))
+			manifest.Size += int64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return manifest, nil
+		} else if err != nil {
+			return nil, disko.ErrIOFailed.Wrap(err)
+		}
+	}
+}
+
+// chunkLength returns the length of the chunk at `index`.
+func (manifest *Manifest) chunkLength(index int) int64 {
+	start := int64(index) * manifest.ChunkSize
+	if start+manifest.ChunkSize > manifest.Size {
+		return manifest.Size - start
+	}
+	return manifest.ChunkSize
+}
+
+// validate checks that the manifest is internally consistent.
+func (manifest *Manifest) validate() error {
+	if manifest.Version != ManifestVersion {
+		return disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf("unsupported manifest version %d", manifest.Version),
+		)
+	}
+	if manifest.ChunkSize <= 0 || manifest.Size < 0 {
+		return disko.ErrFileSystemCorrupted.WithMessage(
+			"manifest has an invalid chunk size or image size",
+		)
+	}
+
+	expectedChunks := (manifest.Size + manifest.ChunkSize - 1) / manifest.ChunkSize
+	if int64(len(manifest.Chunks)) != expectedChunks {
+		return disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf(
+				"manifest lists %d chunks but a %d-byte image needs %d",
+				len(manifest.Chunks),
+				manifest.Size,
+				expectedChunks,
+			),
+		)
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// TransferStats summarizes the work done by [Push] or [Pull].
+type TransferStats struct {
+	// TotalChunks is the number of chunks in the image.
+	TotalChunks int
+	// ChunksTransferred is the number of chunks sent to or fetched from the
+	// store.
+	ChunksTransferred int
+	// BytesTransferred is the total size of the transferred chunks.
+	BytesTransferred int64
+}
+
+// Push uploads an image to a store under `name`. Only chunks the store doesn't
+// already have are uploaded. If `chunkSize` is zero and the store already has
+// an image under that name, its chunk size is reused so that unchanged chunks
+// line up; otherwise [DefaultChunkSize] is used.
+func Push(image io.Reader, store Store, name string, chunkSize int64) (TransferStats, error) {
+	stats := TransferStats{}
+
+	if chunkSize == 0 {
+		chunkSize = DefaultChunkSize
+		previous, err := store.GetManifest(name)
+		if err == nil {
+			chunkSize = previous.ChunkSize
+		} else if !isNotFound(err) {
+			return stats, err
+		}
+	}
+
+	uploaded := map[string]bool{}
+	manifest, err := BuildManifest(
+		image,
+		chunkSize,
+		func(index int, data []byte) error {
+			hash := HashChunk(data)
+			if uploaded[hash] {
+				return nil
+			}
+
+			exists, err := store.HasChunk(hash)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				err = store.PutChunk(hash, data)
+				if err != nil {
+					return err
+				}
+				stats.ChunksTransferred++
+				stats.BytesTransferred += int64(len(data))
+			}
+			uploaded[hash] = true
+			return nil
+		},
+	)
+	if err != nil {
+		return stats, err
+	}
+
+	stats.TotalChunks = len(manifest.Chunks)
+	return stats, store.PutManifest(name, manifest)
+}
+
+// LocalImage is the interface [Pull] needs to update an image in place.
+type LocalImage interface {
+	io.ReaderAt
+	io.WriterAt
+	Truncate(size int64) error
+}
+
+// Pull updates `image`, whose current size is `currentSize`, to match the image
+// stored under `name`. Chunks that already match aren't fetched, and neither
+// are chunks whose contents can be found elsewhere in the local image.
+func Pull(image LocalImage, currentSize int64, store Store, name string) (TransferStats, error) {
+	stats := TransferStats{}
+
+	manifest, err := store.GetManifest(name)
+	if err != nil {
+		return stats, err
+	}
+	err = manifest.validate()
+	if err != nil {
+		return stats, err
+	}
+	stats.TotalChunks = len(manifest.Chunks)
+
+	// Hash the local image with the remote chunk size, and remember where each
+	// chunk is so that it can be reused if it moved.
+	localHashes := []string{}
+	localOffsets := map[string]int64{}
+	_, err = BuildManifest(
+		io.NewSectionReader(image, 0, currentSize),
+		manifest.ChunkSize,
+		func(index int, data []byte) error {
+			hash := HashChunk(data)
+			localHashes = append(localHashes, hash)
+			if _, ok := localOffsets[hash]; !ok {
+				localOffsets[hash] = int64(index) * manifest.ChunkSize
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return stats, err
+	}
+
+	// Gather all changed chunks before writing anything, since writing a chunk
+	// could overwrite one we were going to copy from elsewhere in the image.
+	// This means all changed chunks are held in memory at once.
+	updates := map[int][]byte{}
+	for index, hash := range manifest.Chunks {
+		if index < len(localHashes) && localHashes[index] == hash {
+			continue
+		}
+
+		length := manifest.chunkLength(index)
+		var data []byte
+
+		if offset, ok := localOffsets[hash]; ok {
+			data = make([]byte, length)
+			_, err = image.ReadAt(data, offset)
+			if err != nil && err != io.EOF {
+				return stats, disko.ErrIOFailed.Wrap(err)
+			}
+		} else {
+			data, err = store.GetChunk(hash)
+			if err != nil {
+				return stats, err
+			}
+			if HashChunk(data) != hash || int64(len(data)) != length {
+				return stats, disko.ErrFileSystemCorrupted.WithMessage(
+					fmt.Sprintf("chunk %d (%s) in the store is corrupted", index, hash),
+				)
+			}
+			stats.ChunksTransferred++
+			stats.BytesTransferred += length
+		}
+		updates[index] = data
+	}
+
+	err = image.Truncate(manifest.Size)
+	if err != nil {
+		return stats, disko.ErrIOFailed.Wrap(err)
+	}
+	for index, data := range updates {
+		_, err = image.WriteAt(data, int64(index)*manifest.ChunkSize)
+		if err != nil {
+			return stats, disko.ErrIOFailed.Wrap(err)
+		}
+	}
+	return stats, nil
+}
+
+// Verify checks that the image stored under `name` is complete and that every
+// chunk matches its hash.
+func Verify(store Store, name string) error {
+	manifest, err := store.GetManifest(name)
+	if err != nil {
+		return err
+	}
+	err = manifest.validate()
+	if err != nil {
+		return err
+	}
+
+	for index, hash := range manifest.Chunks {
+		data, err := store.GetChunk(hash)
+		if err != nil {
+			return err
+		}
+		if HashChunk(data) != hash || int64(len(data)) != manifest.chunkLength(index) {
+			return disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf("chunk %d (%s) is corrupted", index, hash),
+			)
+		}
+	}
+	return nil
+}
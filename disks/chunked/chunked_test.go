@@ -0,0 +1,117 @@
+package chunked_test
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks/chunked"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testChunkSize = 1024
+
+func writeTempImage(t *testing.T, data []byte) *os.File {
+	file, err := os.Create(filepath.Join(t.TempDir(), "image.img"))
+	require.NoError(t, err, "failed to create image file")
+	t.Cleanup(func() { file.Close() })
+
+	_, err = file.Write(data)
+	require.NoError(t, err, "failed to write image file")
+	return file
+}
+
+func TestPushPull__OnlyChangedChunksTransferred(t *testing.T) {
+	store, err := chunked.NewDirectoryStore(t.TempDir())
+	require.NoError(t, err)
+
+	original := make([]byte, 10*testChunkSize+100)
+	rand.Read(original)
+
+	stats, err := chunked.Push(bytes.NewReader(original), store, "fixture", testChunkSize)
+	require.NoError(t, err, "initial push failed")
+	assert.Equal(t, 11, stats.TotalChunks)
+	assert.Equal(t, 11, stats.ChunksTransferred)
+
+	// Change one chunk and push again; only that chunk should be uploaded.
+	modified := bytes.Clone(original)
+	modified[3*testChunkSize+5] ^= 0xff
+	stats, err = chunked.Push(bytes.NewReader(modified), store, "fixture", 0)
+	require.NoError(t, err, "second push failed")
+	assert.Equal(t, 1, stats.ChunksTransferred, "unchanged chunks were uploaded")
+	assert.EqualValues(t, testChunkSize, stats.BytesTransferred)
+	require.NoError(t, chunked.Verify(store, "fixture"))
+
+	// Pulling into a copy of the original image should fetch only that chunk.
+	local := writeTempImage(t, original)
+	stats, err = chunked.Pull(local, int64(len(original)), store, "fixture")
+	require.NoError(t, err, "pull failed")
+	assert.Equal(t, 1, stats.ChunksTransferred)
+
+	pulled, err := os.ReadFile(local.Name())
+	require.NoError(t, err)
+	assert.Equal(t, modified, pulled)
+}
+
+func TestPull__NewImageReusesDuplicateChunks(t *testing.T) {
+	store, err := chunked.NewDirectoryStore(t.TempDir())
+	require.NoError(t, err)
+
+	// Eight chunks of zeros and one of random data: only two distinct chunks.
+	image := make([]byte, 9*testChunkSize)
+	rand.Read(image[4*testChunkSize : 5*testChunkSize])
+
+	stats, err := chunked.Push(bytes.NewReader(image), store, "sparse", testChunkSize)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.ChunksTransferred, "duplicate chunks were uploaded")
+
+	local := writeTempImage(t, nil)
+	_, err = chunked.Pull(local, 0, store, "sparse")
+	require.NoError(t, err)
+
+	pulled, err := os.ReadFile(local.Name())
+	require.NoError(t, err)
+	assert.Equal(t, image, pulled)
+}
+
+func TestPull__ShrinksImage(t *testing.T) {
+	store, err := chunked.NewDirectoryStore(t.TempDir())
+	require.NoError(t, err)
+
+	image := make([]byte, 2500)
+	rand.Read(image)
+	_, err = chunked.Push(bytes.NewReader(image[:1500]), store, "small", testChunkSize)
+	require.NoError(t, err)
+
+	local := writeTempImage(t, image)
+	_, err = chunked.Pull(local, int64(len(image)), store, "small")
+	require.NoError(t, err)
+
+	pulled, err := os.ReadFile(local.Name())
+	require.NoError(t, err)
+	assert.Equal(t, image[:1500], pulled)
+}
+
+func TestVerify__DetectsCorruptChunk(t *testing.T) {
+	root := t.TempDir()
+	store, err := chunked.NewDirectoryStore(root)
+	require.NoError(t, err)
+
+	image := []byte("some fixture contents")
+	_, err = chunked.Push(bytes.NewReader(image), store, "tiny", testChunkSize)
+	require.NoError(t, err)
+
+	hash := chunked.HashChunk(image)
+	err = os.WriteFile(filepath.Join(root, "chunks", hash[:2], hash), []byte("bit rot"), 0o644)
+	require.NoError(t, err)
+
+	err = chunked.Verify(store, "tiny")
+	assert.ErrorIs(t, err, disko.ErrFileSystemCorrupted)
+
+	_, err = store.GetManifest("missing")
+	assert.ErrorIs(t, err, disko.ErrNotFound)
+}
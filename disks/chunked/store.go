@@ -0,0 +1,288 @@
+package chunked
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks/remote"
+)
+
+// Store is a place chunks and manifests can be kept.
+type Store interface {
+	// HasChunk returns true if the store has a chunk with the given hash.
+	HasChunk(hash string) (bool, error)
+	// GetChunk returns the contents of the chunk with the given hash, or
+	// [disko.ErrNotFound] if the store doesn't have it.
+	GetChunk(hash string) ([]byte, error)
+	// PutChunk adds a chunk to the store.
+	PutChunk(hash string, data []byte) error
+	// GetManifest returns the manifest of the image stored under `name`, or
+	// [disko.ErrNotFound] if there is none.
+	GetManifest(name string) (*Manifest, error)
+	// PutManifest stores a manifest under `name`, replacing any existing one.
+	PutManifest(name string, manifest *Manifest) error
+}
+
+// OpenStore returns a [Store] for `location`, which is either a local directory
+// or an "s3://bucket/prefix" URL. S3 credentials are taken from the standard
+// AWS environment variables.
+func OpenStore(location string) (Store, error) {
+	if strings.HasPrefix(location, "s3://") {
+		return NewS3Store(location, remote.S3ConfigFromEnvironment())
+	}
+	return NewDirectoryStore(location)
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, disko.ErrNotFound)
+}
+
+func validateName(name string) error {
+	if name == "" || strings.ContainsAny(name, "/\\") || name == "." || name == ".." {
+		return disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("invalid image name %q", name),
+		)
+	}
+	return nil
+}
+
+func decodeManifest(data []byte) (*Manifest, error) {
+	manifest := &Manifest{}
+	err := json.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, disko.ErrFileSystemCorrupted.Wrap(err)
+	}
+	return manifest, manifest.validate()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// DirectoryStore is a [Store] in a directory on the local file system, which
+// may also be a network share. Chunks are kept in "chunks/xx/<hash>", where
+// "xx" is the first two characters of the hash, and manifests in
+// "manifests/<name>.json".
+type DirectoryStore struct {
+	root string
+}
+
+// NewDirectoryStore creates a [DirectoryStore] in the directory `root`,
+// creating it if needed.
+func NewDirectoryStore(root string) (*DirectoryStore, error) {
+	for _, subdirectory := range []string{"chunks", "manifests"} {
+		err := os.MkdirAll(filepath.Join(root, subdirectory), 0o755)
+		if err != nil {
+			return nil, disko.ErrIOFailed.Wrap(err)
+		}
+	}
+	return &DirectoryStore{root: root}, nil
+}
+
+func (store *DirectoryStore) chunkPath(hash string) string {
+	prefix := "00"
+	if len(hash) >= 2 {
+		prefix = hash[:2]
+	}
+	return filepath.Join(store.root, "chunks", prefix, hash)
+}
+
+func (store *DirectoryStore) manifestPath(name string) string {
+	return filepath.Join(store.root, "manifests", name+".json")
+}
+
+// HasChunk implements [Store].
+func (store *DirectoryStore) HasChunk(hash string) (bool, error) {
+	_, err := os.Stat(store.chunkPath(hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, disko.ErrIOFailed.Wrap(err)
+	}
+	return true, nil
+}
+
+// GetChunk implements [Store].
+func (store *DirectoryStore) GetChunk(hash string) ([]byte, error) {
+	return readStoreFile(store.chunkPath(hash))
+}
+
+// PutChunk implements [Store].
+func (store *DirectoryStore) PutChunk(hash string, data []byte) error {
+	path := store.chunkPath(hash)
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	return writeStoreFile(path, data)
+}
+
+// GetManifest implements [Store].
+func (store *DirectoryStore) GetManifest(name string) (*Manifest, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	data, err := readStoreFile(store.manifestPath(name))
+	if err != nil {
+		return nil, err
+	}
+	return decodeManifest(data)
+}
+
+// PutManifest implements [Store].
+func (store *DirectoryStore) PutManifest(name string, manifest *Manifest) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStoreFile(store.manifestPath(name), data)
+}
+
+func readStoreFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, disko.ErrNotFound.WithMessage(path)
+	} else if err != nil {
+		return nil, disko.ErrIOFailed.Wrap(err)
+	}
+	return data, nil
+}
+
+// writeStoreFile writes a file atomically, so that a reader never sees a
+// partially written chunk or manifest.
+func writeStoreFile(path string, data []byte) error {
+	tempFile, err := os.CreateTemp(filepath.Dir(path), ".partial-*")
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.Write(data)
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), path)
+	}
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// S3Store is a [Store] in an S3-compatible object store, laid out the same way
+// as a [DirectoryStore] under a common key prefix.
+type S3Store struct {
+	prefix string
+	config remote.S3Config
+}
+
+// NewS3Store creates an [S3Store] for an "s3://bucket/prefix" URL.
+func NewS3Store(location string, config remote.S3Config) (*S3Store, error) {
+	location = strings.TrimSuffix(location, "/")
+	// Only to validate the URL; the prefix may be empty.
+	_, _, err := remote.ParseS3URL(location + "/x")
+	if err != nil {
+		return nil, disko.ErrInvalidArgument.Wrap(err)
+	}
+	return &S3Store{prefix: location, config: config}, nil
+}
+
+func (store *S3Store) chunkURL(hash string) string {
+	prefix := "00"
+	if len(hash) >= 2 {
+		prefix = hash[:2]
+	}
+	return fmt.Sprintf("%s/chunks/%s/%s", store.prefix, prefix, hash)
+}
+
+func (store *S3Store) manifestURL(name string) string {
+	return fmt.Sprintf("%s/manifests/%s.json", store.prefix, name)
+}
+
+func (store *S3Store) getObject(url string) ([]byte, error) {
+	object, err := remote.OpenS3Image(url, store.config, remote.HTTPStreamOptions{})
+	if err != nil {
+		return nil, disko.ErrIOFailed.Wrap(err)
+	}
+	if object.Size() == 0 {
+		return nil, disko.ErrNotFound.WithMessage(url)
+	}
+
+	data := make([]byte, object.Size())
+	_, err = object.ReadAt(data, 0)
+	if err != nil && err != io.EOF {
+		return nil, disko.ErrIOFailed.Wrap(err)
+	}
+	return data, nil
+}
+
+func (store *S3Store) putObject(url string, data []byte) error {
+	object, err := remote.OpenS3Image(url, store.config, remote.HTTPStreamOptions{})
+	if err == nil {
+		err = object.Truncate(0)
+	}
+	if err == nil {
+		_, err = object.WriteAt(data, 0)
+	}
+	if err == nil {
+		err = object.Flush()
+	}
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	return nil
+}
+
+// HasChunk implements [Store].
+func (store *S3Store) HasChunk(hash string) (bool, error) {
+	object, err := remote.OpenS3Image(store.chunkURL(hash), store.config, remote.HTTPStreamOptions{})
+	if err != nil {
+		return false, disko.ErrIOFailed.Wrap(err)
+	}
+	return object.Size() > 0, nil
+}
+
+// GetChunk implements [Store].
+func (store *S3Store) GetChunk(hash string) ([]byte, error) {
+	return store.getObject(store.chunkURL(hash))
+}
+
+// PutChunk implements [Store].
+func (store *S3Store) PutChunk(hash string, data []byte) error {
+	return store.putObject(store.chunkURL(hash), data)
+}
+
+// GetManifest implements [Store].
+func (store *S3Store) GetManifest(name string) (*Manifest, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	data, err := store.getObject(store.manifestURL(name))
+	if err != nil {
+		return nil, err
+	}
+	return decodeManifest(data)
+}
+
+// PutManifest implements [Store].
+func (store *S3Store) PutManifest(name string, manifest *Manifest) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return store.putObject(store.manifestURL(name), data)
+}
@@ -0,0 +1,237 @@
+// Package compose builds partitioned images containing several file systems,
+// such as distribution disks with a FAT boot partition and a Unix root
+// partition.
+package compose
+
+import (
+	"fmt"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+	"github.com/dargueta/disko/driver"
+)
+
+// DefaultAlignment is where partitions start if [Composer.Alignment] isn't set.
+// Modern partitioning tools align to 1 MiB.
+const DefaultAlignment = disko.MiB
+
+// Partition describes one file system in a composed image.
+type Partition struct {
+	// FileSystem is the name the driver was registered under with
+	// [disko.RegisterFileSystem]. The driver must have a constructor, and its
+	// implementer must be a [disko.FormatImageImplementer].
+	FileSystem string
+
+	// Type is the MBR partition type, e.g. [disks.MBRTypeFAT16].
+	Type uint8
+
+	// Bootable marks the partition active.
+	Bootable bool
+
+	// Size is the size of the partition in bytes, and must be a multiple of
+	// [disks.MBRSectorSize]. If 0, FormatOptions.TotalSizeBytes() is used.
+	Size int64
+
+	// FormatOptions is passed to the driver's FormatImage. If nil, the driver
+	// only gets the size of the partition.
+	FormatOptions disks.BasicFormatterOptions
+
+	// MountFlags are used to mount the file system for Populate. If 0,
+	// [disko.MountFlagsAllowAll] is used.
+	MountFlags disko.MountFlags
+
+	// Populate is called with the mounted file system after it's formatted, to
+	// add files to it. Optional. The driver is flushed and the file system
+	// unmounted afterwards, so Populate must close every file it opens.
+	Populate func(fs *driver.BaseDriver) error
+}
+
+// Composer lays out several file systems in a single image with an MBR
+// partition table.
+type Composer struct {
+	// Partitions are placed in the image in the order given. An MBR can only
+	// hold [disks.MaxMBRPartitions] of them.
+	Partitions []Partition
+
+	// Alignment is the boundary each partition starts on, in bytes. It must be
+	// a multiple of [disks.MBRSectorSize]. If 0, [DefaultAlignment] is used.
+	Alignment int64
+}
+
+// Layout returns the partition table for the image and its total size in
+// bytes, without writing anything.
+func (composer *Composer) Layout() ([]disks.MBRPartition, int64, error) {
+	if len(composer.Partitions) == 0 {
+		return nil, 0, disko.ErrInvalidArgument.WithMessage("no partitions given")
+	} else if len(composer.Partitions) > disks.MaxMBRPartitions {
+		return nil, 0, disko.ErrArgumentOutOfRange.WithMessage(
+			fmt.Sprintf(
+				"an MBR can have at most %d partitions, got %d",
+				disks.MaxMBRPartitions,
+				len(composer.Partitions),
+			),
+		)
+	}
+
+	alignment := composer.Alignment
+	if alignment == 0 {
+		alignment = DefaultAlignment
+	} else if alignment < 0 || alignment%disks.MBRSectorSize != 0 {
+		return nil, 0, disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf(
+				"alignment must be a positive multiple of %d, got %d",
+				disks.MBRSectorSize,
+				alignment,
+			),
+		)
+	}
+
+	table := make([]disks.MBRPartition, len(composer.Partitions))
+	// The first sector is taken by the MBR itself.
+	end := int64(disks.MBRSectorSize)
+
+	for i, partition := range composer.Partitions {
+		size := partitionSize(partition)
+		if size <= 0 || size%disks.MBRSectorSize != 0 {
+			return nil, 0, disko.ErrInvalidArgument.WithMessage(
+				fmt.Sprintf(
+					"partition %d: size must be a positive multiple of %d, got %d",
+					i,
+					disks.MBRSectorSize,
+					size,
+				),
+			)
+		}
+
+		start := (end + alignment - 1) / alignment * alignment
+		end = start + size
+		if end/disks.MBRSectorSize > 0xFFFFFFFF {
+			return nil, 0, disko.ErrArgumentOutOfRange.WithMessage(
+				fmt.Sprintf(
+					"partition %d: ends at byte %d, past the 2 TiB an MBR can address",
+					i,
+					end,
+				),
+			)
+		}
+
+		table[i] = disks.MBRPartition{
+			Bootable:     partition.Bootable,
+			Type:         partition.Type,
+			StartSector:  uint32(start / disks.MBRSectorSize),
+			TotalSectors: uint32(size / disks.MBRSectorSize),
+		}
+	}
+	return table, end, nil
+}
+
+// Compose writes the partition table to `image`, then formats and populates
+// each partition with its driver. `image` must be empty or entirely null
+// bytes, since drivers expect to format a blank image. It's extended to the
+// size given by [Composer.Layout].
+func (composer *Composer) Compose(image disks.ReadWriterAt) error {
+	table, totalSize, err := composer.Layout()
+	if err != nil {
+		return err
+	}
+
+	// Check all the drivers before writing anything.
+	registrations := make([]disko.FileSystemRegistration, len(composer.Partitions))
+	for i, partition := range composer.Partitions {
+		registration, ok := disko.LookUpFileSystem(partition.FileSystem)
+		if !ok {
+			return disko.ErrInvalidArgument.WithMessage(
+				fmt.Sprintf("partition %d: unknown file system %q", i, partition.FileSystem))
+		} else if registration.New == nil {
+			return disko.ErrNotSupported.WithMessage(
+				fmt.Sprintf(
+					"partition %d: the %s driver can't create images",
+					i,
+					partition.FileSystem,
+				),
+			)
+		}
+		registrations[i] = registration
+	}
+
+	_, err = image.WriteAt(make([]byte, disks.MBRSectorSize), totalSize-disks.MBRSectorSize)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+
+	err = disks.WriteMBR(image, table)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+
+	for i, partition := range composer.Partitions {
+		section := disks.NewSection(image, table[i].Offset(), table[i].Size())
+		err = buildPartition(registrations[i], partition, section)
+		if err != nil {
+			return fmt.Errorf("partition %d (%s): %w", i, partition.FileSystem, err)
+		}
+	}
+	return nil
+}
+
+// buildPartition formats a single partition and populates it.
+func buildPartition(
+	registration disko.FileSystemRegistration,
+	partition Partition,
+	section *disks.Section,
+) error {
+	implementation, err := registration.New(section)
+	if err != nil {
+		return err
+	}
+
+	formatter, ok := implementation.(disko.FormatImageImplementer)
+	if !ok {
+		return disko.ErrNotSupported.WithMessage("driver can't format images")
+	}
+
+	options := partition.FormatOptions
+	if options == nil {
+		options = disks.FormatterSizeOptions{Size: section.Size()}
+	}
+	err = formatter.FormatImage(options)
+	if err != nil {
+		return err
+	}
+
+	if partition.Populate == nil {
+		return nil
+	}
+
+	flags := partition.MountFlags
+	if flags == 0 {
+		flags = disko.MountFlagsAllowAll
+	}
+	err = implementation.Mount(flags)
+	if err != nil {
+		return err
+	}
+
+	fs := driver.New(implementation, flags)
+	populateErr := partition.Populate(fs)
+	if populateErr == nil {
+		populateErr = fs.Flush()
+	}
+
+	unmountErr := implementation.Unmount()
+	if populateErr != nil {
+		return populateErr
+	} else if unmountErr != nil {
+		return unmountErr
+	}
+	return nil
+}
+
+// partitionSize returns the size of `partition` in bytes, taking it from its
+// format options if it's not given explicitly.
+func partitionSize(partition Partition) int64 {
+	if partition.Size == 0 && partition.FormatOptions != nil {
+		return partition.FormatOptions.TotalSizeBytes()
+	}
+	return partition.Size
+}
@@ -0,0 +1,160 @@
+package compose_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+	"github.com/dargueta/disko/disks/compose"
+	"github.com/dargueta/disko/driver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryImage is an in-memory image that grows when written past the end.
+type memoryImage struct {
+	data []byte
+}
+
+func (image *memoryImage) ReadAt(buffer []byte, offset int64) (int, error) {
+	return bytes.NewReader(image.data).ReadAt(buffer, offset)
+}
+
+func (image *memoryImage) WriteAt(buffer []byte, offset int64) (int, error) {
+	end := int(offset) + len(buffer)
+	if end > len(image.data) {
+		image.data = append(image.data, make([]byte, end-len(image.data))...)
+	}
+	return copy(image.data[offset:], buffer), nil
+}
+
+// stampFS is a minimal file system that formats an image by writing its name
+// and the image size at the beginning.
+type stampFS struct {
+	image   io.ReadWriteSeeker
+	mounted bool
+}
+
+func (fs *stampFS) FormatImage(options disks.BasicFormatterOptions) disko.DriverError {
+	header := []byte("STAMP")
+	header = append(header, byte(options.TotalSizeBytes()/disko.KiB))
+	_, err := fs.image.Write(header)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	return nil
+}
+
+func (fs *stampFS) Mount(flags disko.MountFlags) disko.DriverError {
+	fs.mounted = true
+	return nil
+}
+
+func (fs *stampFS) Flush() disko.DriverError { return nil }
+
+func (fs *stampFS) Unmount() disko.DriverError {
+	fs.mounted = false
+	return nil
+}
+
+func (fs *stampFS) CreateObject(
+	name string, parent disko.ObjectHandle, perm os.FileMode,
+) (disko.ObjectHandle, disko.DriverError) {
+	return nil, disko.ErrNotSupported
+}
+
+func (fs *stampFS) GetObject(
+	name string, parent disko.ObjectHandle,
+) (disko.ObjectHandle, disko.DriverError) {
+	return nil, disko.ErrNotFound
+}
+
+func (fs *stampFS) GetRootDirectory() disko.ObjectHandle { return nil }
+func (fs *stampFS) FSStat() disko.FSStat                 { return disko.FSStat{} }
+func (fs *stampFS) GetFSFeatures() disko.FSFeatures      { return disko.FSFeatures{} }
+
+func init() {
+	disko.RegisterFileSystem(
+		disko.FileSystemRegistration{
+			Name:   "test-stamp",
+			Detect: func(io.ReaderAt, int64) bool { return false },
+			New: func(stream io.ReadWriteSeeker) (disko.FileSystemImplementer, disko.DriverError) {
+				return &stampFS{image: stream}, nil
+			},
+		},
+	)
+}
+
+func TestComposer__Layout(t *testing.T) {
+	composer := compose.Composer{
+		Partitions: []compose.Partition{
+			{Type: disks.MBRTypeFAT12, Size: 1440 * disko.KiB, Bootable: true},
+			{Type: disks.MBRTypeLinux, Size: 512},
+		},
+	}
+
+	table, size, err := composer.Layout()
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		[]disks.MBRPartition{
+			{Bootable: true, Type: disks.MBRTypeFAT12, StartSector: 2048, TotalSectors: 2880},
+			{Type: disks.MBRTypeLinux, StartSector: 6144, TotalSectors: 1},
+		},
+		table,
+	)
+	assert.EqualValues(t, 6145*512, size)
+}
+
+func TestComposer__LayoutBadSize(t *testing.T) {
+	composer := compose.Composer{
+		Partitions: []compose.Partition{{Type: disks.MBRTypeLinux, Size: 1000}},
+	}
+	_, _, err := composer.Layout()
+	assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+}
+
+func TestComposer__Compose(t *testing.T) {
+	populated := false
+	composer := compose.Composer{
+		Alignment: 4 * disko.KiB,
+		Partitions: []compose.Partition{
+			{FileSystem: "test-stamp", Type: disks.MBRTypeFAT12, Size: 8 * disko.KiB},
+			{
+				FileSystem: "test-stamp",
+				Type:       disks.MBRTypeLinux,
+				Size:       16 * disko.KiB,
+				Populate: func(fs *driver.BaseDriver) error {
+					populated = true
+					return nil
+				},
+			},
+		},
+	}
+
+	image := &memoryImage{}
+	require.NoError(t, composer.Compose(image))
+	assert.True(t, populated, "Populate wasn't called")
+	assert.Len(t, image.data, 28*disko.KiB)
+
+	table, err := disks.ReadMBR(image)
+	require.NoError(t, err)
+	require.Len(t, table, 2)
+	assert.Equal(t, "STAMP\x08", string(image.data[table[0].Offset():table[0].Offset()+6]))
+	assert.Equal(t, "STAMP\x10", string(image.data[table[1].Offset():table[1].Offset()+6]))
+}
+
+func TestComposer__UnknownFileSystem(t *testing.T) {
+	composer := compose.Composer{
+		Partitions: []compose.Partition{
+			{FileSystem: "no-such-fs", Type: disks.MBRTypeLinux, Size: 512},
+		},
+	}
+
+	image := &memoryImage{}
+	assert.ErrorIs(t, composer.Compose(image), disko.ErrInvalidArgument)
+	assert.Empty(t, image.data, "image was modified")
+}
@@ -0,0 +1,199 @@
+// Package containers decodes the sector-level image formats used by TRS-80
+// emulators into the sectors they hold.
+//
+// Unlike raw images, these record each sector's ID as it was found on the
+// track, so they can hold disks with a different number of sectors on each
+// track, sectors numbered from 0, mixed densities, and sectors written with a
+// deleted data address mark, all of which TRS-80 operating systems use.
+//
+// The supported formats are:
+//
+//   - JV1, a raw dump of a single density, single-sided disk with ten 256-byte
+//     sectors on each track.
+//   - JV3, a table of sector IDs and flags followed by the sectors' data.
+//   - DMK, a copy of each track as the floppy controller reads it, along with
+//     the positions of its ID address marks.
+package containers
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/dargueta/disko"
+)
+
+// Format is the type of image a [Disk] was decoded from.
+type Format int
+
+const (
+	FormatJV1 = Format(iota)
+	FormatJV3
+	FormatDMK
+)
+
+func (format Format) String() string {
+	switch format {
+	case FormatJV1:
+		return "JV1"
+	case FormatJV3:
+		return "JV3"
+	case FormatDMK:
+		return "DMK"
+	default:
+		return fmt.Sprintf("Format(%d)", int(format))
+	}
+}
+
+// Sector is a sector found in an image, along with its ID.
+type Sector struct {
+	Track  uint8
+	Side   uint8
+	Number uint8
+	// DoubleDensity is true if the sector is recorded in MFM rather than FM.
+	DoubleDensity bool
+	// Deleted is true if the sector was written with a deleted data address
+	// mark. TRS-80 operating systems write their directories this way.
+	Deleted bool
+	// CRCError is true if the sector's data didn't match its checksum when it
+	// was imaged.
+	CRCError bool
+	Data     []byte
+}
+
+// sectorKey identifies a sector by the location given in its ID.
+type sectorKey struct {
+	track  uint8
+	side   uint8
+	number uint8
+}
+
+// Disk is the set of sectors decoded from an image. It's read-only.
+type Disk struct {
+	format  Format
+	sectors []Sector
+	index   map[sectorKey]int
+	tracks  uint
+	sides   uint
+}
+
+// newDisk creates a [Disk] from the sectors of an image. If a sector appears
+// more than once, the first copy is used.
+func newDisk(format Format, sectors []Sector) (*Disk, error) {
+	if len(sectors) == 0 {
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("%s image has no sectors", format))
+	}
+
+	disk := &Disk{
+		format:  format,
+		sectors: sectors,
+		index:   make(map[sectorKey]int, len(sectors)),
+	}
+	for i, sector := range sectors {
+		key := sectorKey{sector.Track, sector.Side, sector.Number}
+		if _, exists := disk.index[key]; !exists {
+			disk.index[key] = i
+		}
+		if uint(sector.Track)+1 > disk.tracks {
+			disk.tracks = uint(sector.Track) + 1
+		}
+		if uint(sector.Side)+1 > disk.sides {
+			disk.sides = uint(sector.Side) + 1
+		}
+	}
+	return disk, nil
+}
+
+// Format returns the type of image the disk was decoded from.
+func (disk *Disk) Format() Format {
+	return disk.format
+}
+
+// Tracks returns the number of tracks on the disk, assuming they're numbered
+// from 0.
+func (disk *Disk) Tracks() uint {
+	return disk.tracks
+}
+
+// Sides returns the number of sides the disk has sectors on.
+func (disk *Disk) Sides() uint {
+	return disk.sides
+}
+
+// Sectors returns every sector on the disk, in the order they're stored in the
+// image. The slice must not be modified.
+func (disk *Disk) Sectors() []Sector {
+	return disk.sectors
+}
+
+// SectorNumbers returns the numbers of the sectors on one side of a track,
+// sorted.
+func (disk *Disk) SectorNumbers(track, side uint) []uint8 {
+	numbers := []uint8{}
+	for key := range disk.index {
+		if uint(key.track) == track && uint(key.side) == side {
+			numbers = append(numbers, key.number)
+		}
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return numbers
+}
+
+// Sector returns the sector with the given ID. It fails with
+// [disko.ErrNotFound] if the disk doesn't have it.
+func (disk *Disk) Sector(track, side, number uint) (*Sector, error) {
+	if track > 0xFF || side > 0xFF || number > 0xFF {
+		return nil, disko.ErrArgumentOutOfRange.WithMessage(
+			fmt.Sprintf("track %d side %d sector %d can't exist", track, side, number))
+	}
+
+	i, ok := disk.index[sectorKey{uint8(track), uint8(side), uint8(number)}]
+	if !ok {
+		return nil, disko.ErrNotFound.WithMessage(
+			fmt.Sprintf("track %d side %d sector %d isn't on the disk", track, side, number))
+	}
+	return &disk.sectors[i], nil
+}
+
+// Open decodes an image `size` bytes long, detecting its format. DMK images
+// have the most distinctive header, so they're tried first, then JV3 images,
+// and finally JV1 images, which only have a size to go by.
+func Open(image io.ReaderAt, size int64) (*Disk, error) {
+	data, err := readAll(image, size)
+	if err != nil {
+		return nil, err
+	}
+
+	if disk, err := DecodeDMK(data); err == nil {
+		return disk, nil
+	}
+	if disk, err := DecodeJV3(data); err == nil {
+		return disk, nil
+	}
+	if disk, err := DecodeJV1(data); err == nil {
+		return disk, nil
+	}
+	return nil, disko.ErrInvalidFileSystem.WithMessage("not a JV1, JV3, or DMK image")
+}
+
+// readAll reads an entire image into memory. TRS-80 images are at most a few
+// megabytes, and the containers have to be parsed from start to finish anyway.
+func readAll(image io.ReaderAt, size int64) ([]byte, error) {
+	if size < 0 || size > maxImageSize {
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("image is %d bytes, which is too large for a floppy disk", size))
+	}
+
+	data := make([]byte, size)
+	_, err := image.ReadAt(data, 0)
+	if err != nil && err != io.EOF {
+		return nil, disko.ErrIOFailed.Wrap(err)
+	}
+	return data, nil
+}
+
+// maxImageSize is the size of the largest image that can be opened. It's big
+// enough for a DMK image of an 8" double-sided, double density disk with every
+// byte of its tracks, with room to spare.
+const maxImageSize = 16 * 1024 * 1024
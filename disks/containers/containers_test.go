@@ -0,0 +1,336 @@
+package containers_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks/containers"
+	"github.com/dargueta/disko/utilities/checksum"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sectorData returns the contents of a sector that identify where it is.
+func sectorData(track, side, number, size int) []byte {
+	data := bytes.Repeat([]byte{byte(track), byte(side), byte(number)}, size/3+1)
+	return data[:size]
+}
+
+// makeJV3 creates a JV3 image of `sectors`, using the IDs and flags in them.
+func makeJV3(sectors []containers.Sector) []byte {
+	header := bytes.Repeat([]byte{0xFF}, containers.JV3HeaderSize)
+	header[containers.JV3HeaderSize-1] = 0
+	data := []byte{}
+
+	for i, sector := range sectors {
+		flags := byte(0)
+		if sector.DoubleDensity {
+			flags |= containers.JV3FlagDoubleDensity
+		}
+		if sector.Deleted {
+			flags |= 0x20
+		}
+		if sector.Side != 0 {
+			flags |= containers.JV3FlagSide
+		}
+		if sector.CRCError {
+			flags |= containers.JV3FlagCRCError
+		}
+		switch len(sector.Data) {
+		case 128:
+			flags |= 1
+		case 1024:
+			flags |= 2
+		case 512:
+			flags |= 3
+		}
+
+		copy(header[3*i:], []byte{sector.Track, sector.Number, flags})
+		data = append(data, sector.Data...)
+	}
+	return append(header, data...)
+}
+
+// dmkTrack builds one side of a track of a DMK image.
+type dmkTrack struct {
+	data    []byte
+	idams   []uint16
+	doubled bool
+	mfm     bool
+}
+
+// write adds bytes to the track, twice each if it's a single density track
+// with doubled bytes.
+func (track *dmkTrack) write(data ...byte) {
+	for _, b := range data {
+		track.data = append(track.data, b)
+		if track.doubled {
+			track.data = append(track.data, b)
+		}
+	}
+}
+
+// writeField writes an address mark and the field after it, followed by its
+// checksum. If `badCRC` is true, the checksum is wrong.
+func (track *dmkTrack) writeField(mark byte, field []byte, badCRC bool) {
+	crc := checksum.CCITT.Checksum(nil)
+	if track.mfm {
+		track.write(0xA1, 0xA1, 0xA1)
+		crc = checksum.CCITT.Update(crc, []byte{0xA1, 0xA1, 0xA1})
+	}
+	crc = checksum.CCITT.Update(crc, []byte{mark})
+	crc = checksum.CCITT.Update(crc, field)
+	if badCRC {
+		crc ^= 0xFFFF
+	}
+
+	track.write(mark)
+	track.write(field...)
+	track.write(byte(crc>>8), byte(crc))
+}
+
+// addSector writes the ID and data fields of a sector.
+func (track *dmkTrack) addSector(sector containers.Sector, badIDCRC bool) {
+	gap := byte(0xFF)
+	if track.mfm {
+		gap = 0x4E
+	}
+
+	track.write(bytes.Repeat([]byte{gap}, 8)...)
+	idamOffset := uint16(containers.DMKIDAMTableSize + len(track.data))
+	if track.mfm {
+		idamOffset += 3
+		idamOffset |= 0x8000
+	}
+	track.idams = append(track.idams, idamOffset)
+
+	sizeCode := byte(0)
+	for 128<<sizeCode < len(sector.Data) {
+		sizeCode++
+	}
+	track.writeField(
+		0xFE,
+		[]byte{sector.Track, sector.Side, sector.Number, sizeCode},
+		badIDCRC,
+	)
+	track.write(bytes.Repeat([]byte{gap}, 11)...)
+
+	mark := byte(0xFB)
+	if sector.Deleted {
+		mark = 0xF8
+	}
+	track.writeField(mark, sector.Data, sector.CRCError)
+}
+
+// bytes returns the track with its ID address mark table, padded to
+// `trackLength` bytes.
+func (track *dmkTrack) bytes(trackLength int) []byte {
+	result := make([]byte, trackLength)
+	for i, idam := range track.idams {
+		binary.LittleEndian.PutUint16(result[2*i:], idam)
+	}
+	copy(result[containers.DMKIDAMTableSize:], track.data)
+	return result
+}
+
+// makeDMK creates a single-sided DMK image from tracks.
+func makeDMK(options byte, tracks []*dmkTrack) []byte {
+	const trackLength = 0x1900
+	header := make([]byte, containers.DMKHeaderSize)
+	header[1] = byte(len(tracks))
+	binary.LittleEndian.PutUint16(header[2:], trackLength)
+	header[4] = options | containers.DMKOptionSingleSided
+
+	image := header
+	for _, track := range tracks {
+		image = append(image, track.bytes(trackLength)...)
+	}
+	return image
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestDecodeJV1(t *testing.T) {
+	image := make([]byte, 35*containers.JV1TrackSize)
+	for track := 0; track < 35; track++ {
+		for sector := 0; sector < containers.JV1SectorsPerTrack; sector++ {
+			offset := track*containers.JV1TrackSize + sector*containers.JV1SectorSize
+			copy(image[offset:], sectorData(track, 0, sector, containers.JV1SectorSize))
+		}
+	}
+
+	disk, err := containers.Open(bytes.NewReader(image), int64(len(image)))
+	require.NoError(t, err)
+	assert.Equal(t, containers.FormatJV1, disk.Format())
+	assert.EqualValues(t, 35, disk.Tracks())
+	assert.EqualValues(t, 1, disk.Sides())
+	assert.Equal(t, []uint8{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, disk.SectorNumbers(3, 0))
+
+	sector, err := disk.Sector(3, 0, 9)
+	require.NoError(t, err)
+	assert.Equal(t, sectorData(3, 0, 9, 256), sector.Data)
+	assert.False(t, sector.Deleted)
+	assert.False(t, sector.DoubleDensity)
+
+	// The directory track is assumed to have deleted data address marks.
+	sector, err = disk.Sector(containers.JV1DirectoryTrack, 0, 0)
+	require.NoError(t, err)
+	assert.True(t, sector.Deleted)
+
+	_, err = disk.Sector(3, 0, 10)
+	assert.ErrorIs(t, err, disko.ErrNotFound)
+}
+
+func TestDecodeJV1__BadSize(t *testing.T) {
+	_, err := containers.DecodeJV1(make([]byte, 3000))
+	assert.ErrorIs(t, err, disko.ErrInvalidFileSystem)
+}
+
+func TestDecodeJV3(t *testing.T) {
+	sectors := []containers.Sector{
+		{Track: 0, Number: 0, Data: sectorData(0, 0, 0, 256)},
+		{Track: 0, Number: 1, Data: sectorData(0, 0, 1, 128)},
+		{Track: 1, Number: 0, DoubleDensity: true, Data: sectorData(1, 0, 0, 512)},
+		{Track: 1, Side: 1, Number: 0, DoubleDensity: true, Data: sectorData(1, 1, 0, 256)},
+		{Track: 17, Number: 2, Deleted: true, Data: sectorData(17, 0, 2, 256)},
+		{Track: 20, Number: 5, CRCError: true, Data: sectorData(20, 0, 5, 1024)},
+	}
+	image := makeJV3(sectors)
+
+	disk, err := containers.Open(bytes.NewReader(image), int64(len(image)))
+	require.NoError(t, err)
+	assert.Equal(t, containers.FormatJV3, disk.Format())
+	assert.EqualValues(t, 21, disk.Tracks())
+	assert.EqualValues(t, 2, disk.Sides())
+	assert.Equal(t, sectors, disk.Sectors())
+
+	sector, err := disk.Sector(1, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, sectors[3], *sector)
+}
+
+func TestDecodeJV3__Truncated(t *testing.T) {
+	image := makeJV3(
+		[]containers.Sector{{Track: 0, Number: 0, Data: sectorData(0, 0, 0, 256)}},
+	)
+	_, err := containers.DecodeJV3(image[:len(image)-1])
+	assert.ErrorIs(t, err, disko.ErrInvalidFileSystem)
+}
+
+func TestDecodeDMK__DoubleDensity(t *testing.T) {
+	track := &dmkTrack{mfm: true}
+	for number := uint8(0); number < 18; number++ {
+		track.addSector(
+			containers.Sector{
+				Track:         0,
+				Number:        number,
+				DoubleDensity: true,
+				Deleted:       number == 1,
+				Data:          sectorData(0, 0, int(number), 256),
+			},
+			false,
+		)
+	}
+	image := makeDMK(0, []*dmkTrack{track})
+
+	disk, err := containers.Open(bytes.NewReader(image), int64(len(image)))
+	require.NoError(t, err)
+	assert.Equal(t, containers.FormatDMK, disk.Format())
+	assert.Len(t, disk.SectorNumbers(0, 0), 18)
+
+	sector, err := disk.Sector(0, 0, 17)
+	require.NoError(t, err)
+	assert.Equal(t, sectorData(0, 0, 17, 256), sector.Data)
+	assert.True(t, sector.DoubleDensity)
+	assert.False(t, sector.Deleted)
+	assert.False(t, sector.CRCError)
+
+	sector, err = disk.Sector(0, 0, 1)
+	require.NoError(t, err)
+	assert.True(t, sector.Deleted)
+}
+
+func TestDecodeDMK__SingleDensity(t *testing.T) {
+	for _, doubled := range []bool{true, false} {
+		options := byte(0)
+		if !doubled {
+			options = containers.DMKOptionSingleDensity
+		}
+
+		tracks := []*dmkTrack{}
+		for trackNumber := uint8(0); trackNumber < 2; trackNumber++ {
+			track := &dmkTrack{doubled: doubled}
+			for number := uint8(0); number < 10; number++ {
+				track.addSector(
+					containers.Sector{
+						Track:  trackNumber,
+						Number: number,
+						Data:   sectorData(int(trackNumber), 0, int(number), 256),
+					},
+					false,
+				)
+			}
+			tracks = append(tracks, track)
+		}
+		image := makeDMK(options, tracks)
+
+		disk, err := containers.DecodeDMK(image)
+		require.NoError(t, err, "doubled = %t", doubled)
+		assert.EqualValues(t, 2, disk.Tracks())
+
+		sector, err := disk.Sector(1, 0, 9)
+		require.NoError(t, err, "doubled = %t", doubled)
+		assert.Equal(t, sectorData(1, 0, 9, 256), sector.Data, "doubled = %t", doubled)
+		assert.False(t, sector.DoubleDensity)
+	}
+}
+
+func TestDecodeDMK__BadChecksums(t *testing.T) {
+	track := &dmkTrack{mfm: true}
+	track.addSector(
+		containers.Sector{Number: 0, DoubleDensity: true, Data: sectorData(0, 0, 0, 256)},
+		true,
+	)
+	track.addSector(
+		containers.Sector{
+			Number:        1,
+			DoubleDensity: true,
+			CRCError:      true,
+			Data:          sectorData(0, 0, 1, 256),
+		},
+		false,
+	)
+	image := makeDMK(0, []*dmkTrack{track})
+
+	disk, err := containers.DecodeDMK(image)
+	require.NoError(t, err)
+
+	// A sector whose ID field is bad can't be found at all, but one with a bad
+	// data field can be read.
+	_, err = disk.Sector(0, 0, 0)
+	assert.ErrorIs(t, err, disko.ErrNotFound)
+	sector, err := disk.Sector(0, 0, 1)
+	require.NoError(t, err)
+	assert.True(t, sector.CRCError)
+	assert.Equal(t, sectorData(0, 0, 1, 256), sector.Data)
+}
+
+func TestDecodeDMK__Truncated(t *testing.T) {
+	track := &dmkTrack{mfm: true}
+	track.addSector(
+		containers.Sector{Number: 0, DoubleDensity: true, Data: sectorData(0, 0, 0, 256)},
+		false,
+	)
+	image := makeDMK(0, []*dmkTrack{track})
+
+	_, err := containers.DecodeDMK(image[:len(image)-1])
+	assert.ErrorIs(t, err, disko.ErrInvalidFileSystem)
+}
+
+func TestOpen__UnknownFormat(t *testing.T) {
+	image := make([]byte, 1000)
+	_, err := containers.Open(bytes.NewReader(image), int64(len(image)))
+	assert.ErrorIs(t, err, disko.ErrInvalidFileSystem)
+}
@@ -0,0 +1,213 @@
+package containers
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/utilities/checksum"
+)
+
+const (
+	// DMKHeaderSize is the size of the header at the beginning of a DMK image.
+	DMKHeaderSize = 16
+	// DMKIDAMTableSize is the size of the table of ID address mark positions at
+	// the beginning of every track. It's included in the track length.
+	DMKIDAMTableSize = 128
+	// dmkNativeSignature is in the header of images that refer to a real floppy
+	// drive rather than containing the disk.
+	dmkNativeSignature = 0x12345678
+)
+
+// Bits in the options byte of a DMK header.
+const (
+	DMKOptionSingleSided = 0x10
+	// DMKOptionSingleDensity is set if every byte of single density sectors is
+	// recorded once. Otherwise, they're written twice so that tracks have the
+	// same length as double density ones.
+	DMKOptionSingleDensity = 0x40
+	// DMKOptionIgnoreDensity is set if bytes are never written twice.
+	DMKOptionIgnoreDensity = 0x80
+)
+
+// Bits of an entry in the ID address mark table of a track.
+const (
+	dmkIDAMDoubleDensity = 0x8000
+	dmkIDAMOffsetMask    = 0x3FFF
+)
+
+// Address marks, as they appear in the track data.
+const (
+	idAddressMark = 0xFE
+	// dataMarkSearchLimit is the farthest past an ID field the data address
+	// mark can be, in bytes. The gap between them is 11 bytes in FM and 22 in
+	// MFM, plus the sync bytes before the mark; this leaves room for drives
+	// that write it a little late.
+	dataMarkSearchLimit = 43
+)
+
+// isDataAddressMark returns true if `mark` is one of the marks that can begin
+// a data field: 0xFB for normal data, and 0xF8 to 0xFA for deleted data.
+func isDataAddressMark(mark byte) bool {
+	return mark >= 0xF8 && mark <= 0xFB
+}
+
+// DecodeDMK decodes a DMK image.
+func DecodeDMK(data []byte) (*Disk, error) {
+	if len(data) < DMKHeaderSize {
+		return nil, disko.ErrInvalidFileSystem.WithMessage("image is too small for a DMK header")
+	}
+
+	writeProtect := data[0]
+	totalTracks := int(data[1])
+	trackLength := int(binary.LittleEndian.Uint16(data[2:]))
+	options := data[4]
+
+	if writeProtect != 0 && writeProtect != 0xFF {
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("invalid DMK write protect flag %#02x", writeProtect))
+	} else if binary.LittleEndian.Uint32(data[12:]) == dmkNativeSignature {
+		return nil, disko.ErrNotSupported.WithMessage(
+			"DMK image refers to a real floppy drive and has no data")
+	} else if trackLength <= DMKIDAMTableSize {
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("DMK track length %d is too short", trackLength))
+	}
+
+	sides := 2
+	if options&DMKOptionSingleSided != 0 {
+		sides = 1
+	}
+	expectedSize := DMKHeaderSize + totalTracks*sides*trackLength
+	if totalTracks == 0 || len(data) < expectedSize {
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf(
+				"DMK header gives %d tracks of %d bytes on %d sides, but the image is %d bytes",
+				totalTracks,
+				trackLength,
+				sides,
+				len(data),
+			),
+		)
+	}
+
+	sectors := []Sector{}
+	for i := 0; i < totalTracks*sides; i++ {
+		start := DMKHeaderSize + i*trackLength
+		trackSectors, err := decodeDMKTrack(data[start:start+trackLength], options)
+		if err != nil {
+			return nil, disko.ErrInvalidFileSystem.WithMessage(
+				fmt.Sprintf("DMK track %d side %d: %s", i/sides, i%sides, err.Error()))
+		}
+		sectors = append(sectors, trackSectors...)
+	}
+	return newDisk(FormatDMK, sectors)
+}
+
+// decodeDMKTrack decodes the sectors in one side of a track of a DMK image.
+// Sectors whose data field can't be found are skipped, like a controller would
+// report them as missing.
+func decodeDMKTrack(track []byte, options byte) ([]Sector, error) {
+	sectors := []Sector{}
+	for i := 0; i < DMKIDAMTableSize; i += 2 {
+		entry := binary.LittleEndian.Uint16(track[i:])
+		if entry == 0 {
+			break
+		}
+
+		doubleDensity := entry&dmkIDAMDoubleDensity != 0
+		step := 2
+		if doubleDensity || options&(DMKOptionSingleDensity|DMKOptionIgnoreDensity) != 0 {
+			step = 1
+		}
+
+		reader := dmkFieldReader{track: track, position: int(entry & dmkIDAMOffsetMask), step: step}
+		sector, found, err := reader.readSector(doubleDensity)
+		if err != nil {
+			return nil, err
+		} else if found {
+			sectors = append(sectors, sector)
+		}
+	}
+	return sectors, nil
+}
+
+// dmkFieldReader reads the bytes of a track, skipping the copies of single
+// density bytes that are recorded twice.
+type dmkFieldReader struct {
+	track    []byte
+	position int
+	step     int
+}
+
+// read returns the next `count` bytes of the track, or false if the track ends
+// first.
+func (reader *dmkFieldReader) read(count int) ([]byte, bool) {
+	if reader.position+count*reader.step > len(reader.track) {
+		return nil, false
+	}
+
+	result := make([]byte, count)
+	for i := range result {
+		result[i] = reader.track[reader.position]
+		reader.position += reader.step
+	}
+	return result, true
+}
+
+// readSector reads the ID field at the reader's position and the data field
+// after it. It returns false if there's no data field, or if the ID field's
+// checksum is wrong, since a controller wouldn't find the sector either way.
+func (reader *dmkFieldReader) readSector(doubleDensity bool) (Sector, bool, error) {
+	// The ID field: the mark, track, side, sector, size code, and checksum.
+	idField, ok := reader.read(7)
+	if !ok {
+		return Sector{}, false, fmt.Errorf("ID field at offset %d is cut off", reader.position)
+	} else if idField[0] != idAddressMark {
+		return Sector{}, false, fmt.Errorf(
+			"expected an ID address mark at offset %d, found %#02x",
+			reader.position-7*reader.step,
+			idField[0],
+		)
+	}
+
+	// MFM address marks are preceded by three 0xA1 sync bytes that are part of
+	// the checksum.
+	var crcSeed uint16
+	if doubleDensity {
+		crcSeed = checksum.CCITT.Checksum([]byte{0xA1, 0xA1, 0xA1})
+	} else {
+		crcSeed = checksum.CCITT.Checksum(nil)
+	}
+	if checksum.CCITT.Update(crcSeed, idField) != 0 {
+		return Sector{}, false, nil
+	}
+
+	sector := Sector{
+		Track:         idField[1],
+		Side:          idField[2],
+		Number:        idField[3],
+		DoubleDensity: doubleDensity,
+	}
+	dataSize := 128 << (idField[4] & 0x03)
+
+	for searched := 0; searched < dataMarkSearchLimit; searched++ {
+		mark, ok := reader.read(1)
+		if !ok {
+			return Sector{}, false, nil
+		} else if !isDataAddressMark(mark[0]) {
+			continue
+		}
+
+		dataField, ok := reader.read(dataSize + 2)
+		if !ok {
+			return Sector{}, false, nil
+		}
+		crc := checksum.CCITT.Update(crcSeed, mark)
+		sector.Deleted = mark[0] != 0xFB
+		sector.CRCError = checksum.CCITT.Update(crc, dataField) != 0
+		sector.Data = dataField[:dataSize]
+		return sector, true, nil
+	}
+	return Sector{}, false, nil
+}
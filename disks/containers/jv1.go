@@ -0,0 +1,51 @@
+package containers
+
+import (
+	"fmt"
+
+	"github.com/dargueta/disko"
+)
+
+// JV1 images hold a single-sided, single density disk, with every track
+// formatted the same way.
+const (
+	JV1SectorSize      = 256
+	JV1SectorsPerTrack = 10
+	JV1TrackSize       = JV1SectorSize * JV1SectorsPerTrack
+	// JV1DirectoryTrack is the track emulators assume the directory is on.
+	// Its sectors are treated as having a deleted data address mark, since
+	// that's how TRSDOS writes them and JV1 has no way to record it.
+	JV1DirectoryTrack = 17
+)
+
+// DecodeJV1 decodes a JV1 image. Since they have no header, any image that's a
+// whole number of tracks is accepted.
+func DecodeJV1(data []byte) (*Disk, error) {
+	if len(data) == 0 || len(data)%JV1TrackSize != 0 {
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf(
+				"JV1 images are a multiple of %d bytes, got %d",
+				JV1TrackSize,
+				len(data),
+			),
+		)
+	} else if len(data)/JV1TrackSize > 0x100 {
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("JV1 image has %d tracks, more than a disk can", len(data)/JV1TrackSize))
+	}
+
+	sectors := make([]Sector, 0, len(data)/JV1SectorSize)
+	for offset := 0; offset < len(data); offset += JV1SectorSize {
+		track := offset / JV1TrackSize
+		sectors = append(
+			sectors,
+			Sector{
+				Track:   uint8(track),
+				Number:  uint8(offset % JV1TrackSize / JV1SectorSize),
+				Deleted: track == JV1DirectoryTrack,
+				Data:    data[offset : offset+JV1SectorSize],
+			},
+		)
+	}
+	return newDisk(FormatJV1, sectors)
+}
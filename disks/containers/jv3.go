@@ -0,0 +1,113 @@
+package containers
+
+import (
+	"fmt"
+
+	"github.com/dargueta/disko"
+)
+
+// A JV3 image is a series of blocks, each with a header of sector IDs followed
+// by the data of those sectors in the same order. There's only more than one
+// block if the first one's table is full.
+const (
+	// JV3SectorsPerHeader is the number of entries in the table of a header.
+	JV3SectorsPerHeader = 2901
+	// JV3HeaderSize is the size of a header: three bytes for each sector, and
+	// a byte that's 0 if the disk is write-protected.
+	JV3HeaderSize = JV3SectorsPerHeader*3 + 1
+)
+
+// Bits in the flags of a JV3 sector entry.
+const (
+	JV3FlagDoubleDensity = 0x80
+	// JV3FlagDAMMask gives the data address mark. 0 is a normal sector; any
+	// other value is one of the deleted marks.
+	JV3FlagDAMMask  = 0x60
+	JV3FlagSide     = 0x10
+	JV3FlagCRCError = 0x08
+	// JV3FlagNonIBM marks a sector in a short, non-IBM format some copy
+	// protection schemes use.
+	JV3FlagNonIBM = 0x04
+	// JV3FlagSizeMask gives the size of the sector, coded differently for free
+	// entries than used ones.
+	JV3FlagSizeMask = 0x03
+)
+
+// jv3Free is the track and sector of an unused entry in a JV3 header.
+const jv3Free = 0xFF
+
+// jv3SectorSize returns the size of the data for a sector, from the size code
+// in its flags.
+func jv3SectorSize(track, flags byte) int {
+	code := flags & JV3FlagSizeMask
+	if track == jv3Free {
+		code ^= 0x03
+	}
+	return [...]int{256, 128, 1024, 512}[code]
+}
+
+// DecodeJV3 decodes a JV3 image.
+func DecodeJV3(data []byte) (*Disk, error) {
+	sectors := []Sector{}
+	blockStart := 0
+
+	for {
+		if len(data)-blockStart < JV3HeaderSize {
+			return nil, disko.ErrInvalidFileSystem.WithMessage(
+				fmt.Sprintf("JV3 header at offset %d is cut off", blockStart))
+		}
+
+		header := data[blockStart : blockStart+JV3HeaderSize]
+		if writeProtect := header[JV3HeaderSize-1]; writeProtect != 0 && writeProtect != 0xFF {
+			return nil, disko.ErrInvalidFileSystem.WithMessage(
+				fmt.Sprintf("invalid JV3 write protect flag %#02x", writeProtect))
+		}
+
+		dataOffset := blockStart + JV3HeaderSize
+		full := true
+		for i := 0; i < JV3SectorsPerHeader; i++ {
+			track, number, flags := header[3*i], header[3*i+1], header[3*i+2]
+			size := jv3SectorSize(track, flags)
+			if track == jv3Free {
+				// Free entries at the end of the table have no data after them.
+				full = false
+				dataOffset += size
+				continue
+			} else if dataOffset+size > len(data) {
+				return nil, disko.ErrInvalidFileSystem.WithMessage(
+					fmt.Sprintf(
+						"JV3 sector entry %d (track %d, sector %d) is past the end of the image",
+						i,
+						track,
+						number,
+					),
+				)
+			}
+
+			side := uint8(0)
+			if flags&JV3FlagSide != 0 {
+				side = 1
+			}
+			sectors = append(
+				sectors,
+				Sector{
+					Track:         track,
+					Side:          side,
+					Number:        number,
+					DoubleDensity: flags&JV3FlagDoubleDensity != 0,
+					Deleted:       flags&JV3FlagDAMMask != 0,
+					CRCError:      flags&JV3FlagCRCError != 0,
+					Data:          data[dataOffset : dataOffset+size],
+				},
+			)
+			dataOffset += size
+		}
+
+		if !full || dataOffset >= len(data) {
+			break
+		}
+		blockStart = dataOffset
+	}
+
+	return newDisk(FormatJV3, sectors)
+}
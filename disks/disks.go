@@ -23,10 +23,26 @@ type FormatterOptionsWithMaxFiles interface {
 	MaxFiles() int64
 }
 
+// FormatterSizeOptions are formatter options that only give the size of the
+// image, leaving everything else up to the driver.
+type FormatterSizeOptions struct {
+	Size int64
+}
+
+func (options FormatterSizeOptions) Metadata() any         { return nil }
+func (options FormatterSizeOptions) TotalSizeBytes() int64 { return options.Size }
+
+// FormatterWithGeometryOptions are formatter options for an image of a disk
+// with a particular geometry. Metadata returns the geometry.
 type FormatterWithGeometryOptions struct {
 	Geometry DiskGeometry
 }
 
+func (options FormatterWithGeometryOptions) Metadata() any { return options.Geometry }
+func (options FormatterWithGeometryOptions) TotalSizeBytes() int64 {
+	return options.Geometry.TotalSizeBytes()
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // Geometry
 
@@ -0,0 +1,270 @@
+package disks
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// MBRSectorSize is the size of a sector as far as an MBR partition table is
+// concerned. Partition boundaries are given in units of this.
+const MBRSectorSize = 512
+
+// MaxMBRPartitions is the number of primary partitions an MBR can describe.
+const MaxMBRPartitions = 4
+
+// Common MBR partition types.
+const (
+	MBRTypeEmpty         = 0x00
+	MBRTypeFAT12         = 0x01
+	MBRTypeFAT16Small    = 0x04
+	MBRTypeExtended      = 0x05
+	MBRTypeFAT16         = 0x06
+	MBRTypeFAT32LBA      = 0x0C
+	MBRTypeExtendedLBA   = 0x0F
+	MBRTypeLinux         = 0x83
+	MBRTypeLinuxExtended = 0x85
+)
+
+// maxLogicalPartitions limits how many extended boot records [ReadPartitions]
+// follows, in case the chain of them loops back on itself.
+const maxLogicalPartitions = 128
+
+const (
+	mbrPartitionTableOffset = 446
+	mbrEntrySize            = 16
+)
+
+// MBRPartition is an entry in a master boot record's partition table.
+type MBRPartition struct {
+	// Bootable is true if the partition is marked active.
+	Bootable bool
+
+	// Type is the partition type, e.g. [MBRTypeFAT16].
+	Type uint8
+
+	// StartSector is the LBA of the first sector of the partition.
+	StartSector uint32
+
+	// TotalSectors is the size of the partition, in sectors.
+	TotalSectors uint32
+}
+
+// IsExtended returns true if the partition is an extended partition, i.e. a
+// container for logical partitions rather than a file system.
+func (partition MBRPartition) IsExtended() bool {
+	switch partition.Type {
+	case MBRTypeExtended, MBRTypeExtendedLBA, MBRTypeLinuxExtended:
+		return true
+	default:
+		return false
+	}
+}
+
+// Offset returns the position of the partition in the image, in bytes.
+func (partition MBRPartition) Offset() int64 {
+	return int64(partition.StartSector) * MBRSectorSize
+}
+
+// Size returns the size of the partition, in bytes.
+func (partition MBRPartition) Size() int64 {
+	return int64(partition.TotalSectors) * MBRSectorSize
+}
+
+// WriteMBR writes a master boot record with the given primary partitions to the
+// first sector of `image`. Everything in the sector before the partition table,
+// such as boot code, is left as it is.
+//
+// Partitions are only addressed by LBA. Their CHS fields are set to the values
+// that tell the BIOS to use the LBA fields instead.
+func WriteMBR(image io.WriterAt, partitions []MBRPartition) error {
+	if len(partitions) > MaxMBRPartitions {
+		return fmt.Errorf(
+			"an MBR can have at most %d partitions, got %d",
+			MaxMBRPartitions,
+			len(partitions),
+		)
+	}
+
+	table := make([]byte, MaxMBRPartitions*mbrEntrySize+2)
+	for i, partition := range partitions {
+		if partition.Type == MBRTypeEmpty {
+			return fmt.Errorf("partition %d has no type", i)
+		}
+
+		entry := table[i*mbrEntrySize : (i+1)*mbrEntrySize]
+		if partition.Bootable {
+			entry[0] = 0x80
+		}
+		copy(entry[1:4], []byte{0xFE, 0xFF, 0xFF})
+		entry[4] = partition.Type
+		copy(entry[5:8], []byte{0xFE, 0xFF, 0xFF})
+		binary.LittleEndian.PutUint32(entry[8:], partition.StartSector)
+		binary.LittleEndian.PutUint32(entry[12:], partition.TotalSectors)
+	}
+	table[len(table)-2] = 0x55
+	table[len(table)-1] = 0xAA
+
+	_, err := image.WriteAt(table, mbrPartitionTableOffset)
+	return err
+}
+
+// ReadMBR returns the non-empty primary partitions in the master boot record of
+// `image`, in the order they appear in the partition table. It fails if the
+// first sector doesn't have a boot signature.
+//
+// Extended partitions are returned as they are. Use [ReadPartitions] to get the
+// logical partitions in them instead.
+func ReadMBR(image io.ReaderAt) ([]MBRPartition, error) {
+	table, err := readPartitionTable(image, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	partitions := []MBRPartition{}
+	for _, partition := range table {
+		if partition.Type != MBRTypeEmpty {
+			partitions = append(partitions, partition)
+		}
+	}
+	return partitions, nil
+}
+
+// readPartitionTable reads all the entries of the partition table in the sector
+// at `sectorOffset`, including empty ones.
+func readPartitionTable(
+	image io.ReaderAt,
+	sectorOffset int64,
+) ([MaxMBRPartitions]MBRPartition, error) {
+	var partitions [MaxMBRPartitions]MBRPartition
+
+	table := make([]byte, MaxMBRPartitions*mbrEntrySize+2)
+	_, err := image.ReadAt(table, sectorOffset+mbrPartitionTableOffset)
+	if err != nil {
+		return partitions, err
+	}
+
+	if table[len(table)-2] != 0x55 || table[len(table)-1] != 0xAA {
+		return partitions, fmt.Errorf(
+			"no MBR boot signature at offset %d: expected 55 AA, got %02X %02X",
+			sectorOffset,
+			table[len(table)-2],
+			table[len(table)-1],
+		)
+	}
+
+	for i := range partitions {
+		entry := table[i*mbrEntrySize : (i+1)*mbrEntrySize]
+		partitions[i] = MBRPartition{
+			Bootable:     entry[0]&0x80 != 0,
+			Type:         entry[4],
+			StartSector:  binary.LittleEndian.Uint32(entry[8:]),
+			TotalSectors: binary.LittleEndian.Uint32(entry[12:]),
+		}
+	}
+	return partitions, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Partition is a partition that can contain a file system, as returned by
+// [ReadPartitions]. Its StartSector is always relative to the beginning of the
+// image, even for logical partitions.
+type Partition struct {
+	MBRPartition
+
+	// Number is the number Linux would give the partition: 1 to 4 for primary
+	// partitions, by their slot in the partition table, and 5 and up for
+	// logical partitions, in the order they're chained together.
+	Number int
+
+	// Logical is true if the partition is inside an extended partition.
+	Logical bool
+}
+
+// Open returns a [Section] covering only the partition, which can be passed to
+// a [disko.ImplementerConstructor] to mount the file system in it.
+func (partition Partition) Open(image ReadWriterAt) *Section {
+	return NewSection(image, partition.Offset(), partition.Size())
+}
+
+// ReadPartitions returns the partitions in `image` that can hold a file system,
+// in order of their [Partition.Number]. Extended partitions aren't returned
+// themselves; the logical partitions in them are instead. It fails if the image
+// has no MBR, or if the chain of logical partitions is damaged.
+func ReadPartitions(image io.ReaderAt) ([]Partition, error) {
+	table, err := readPartitionTable(image, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	partitions := []Partition{}
+	var extended []MBRPartition
+	for i, entry := range table {
+		if entry.Type == MBRTypeEmpty {
+			continue
+		} else if entry.IsExtended() {
+			extended = append(extended, entry)
+			continue
+		}
+		partitions = append(partitions, Partition{MBRPartition: entry, Number: i + 1})
+	}
+
+	// DOS only allows one extended partition; Linux uses the first one it finds.
+	if len(extended) == 0 {
+		return partitions, nil
+	}
+	logical, err := readLogicalPartitions(image, extended[0])
+	if err != nil {
+		return nil, err
+	}
+	return append(partitions, logical...), nil
+}
+
+// readLogicalPartitions follows the chain of extended boot records (EBRs) in
+// `extended`. Each EBR has a partition table with up to two entries: the first
+// is a logical partition, relative to the EBR itself, and the second points to
+// the next EBR, relative to the start of the extended partition.
+func readLogicalPartitions(image io.ReaderAt, extended MBRPartition) ([]Partition, error) {
+	partitions := []Partition{}
+	nextEBR := uint32(0)
+
+	for i := 0; ; i++ {
+		if i == maxLogicalPartitions {
+			return nil, fmt.Errorf(
+				"more than %d logical partitions; the chain of EBRs probably loops",
+				maxLogicalPartitions,
+			)
+		} else if nextEBR >= extended.TotalSectors {
+			return nil, fmt.Errorf(
+				"EBR at sector %d of the extended partition is past its end (%d sectors)",
+				nextEBR,
+				extended.TotalSectors,
+			)
+		}
+
+		ebrSector := extended.StartSector + nextEBR
+		table, err := readPartitionTable(image, int64(ebrSector)*MBRSectorSize)
+		if err != nil {
+			return nil, fmt.Errorf("can't read EBR at sector %d: %w", ebrSector, err)
+		}
+
+		if table[0].Type != MBRTypeEmpty {
+			logical := table[0]
+			logical.StartSector += ebrSector
+			partitions = append(
+				partitions,
+				Partition{
+					MBRPartition: logical,
+					Number:       len(partitions) + 5,
+					Logical:      true,
+				},
+			)
+		}
+
+		if !table[1].IsExtended() {
+			return partitions, nil
+		}
+		nextEBR = table[1].StartSector
+	}
+}
@@ -0,0 +1,211 @@
+package disks_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/dargueta/disko/disks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xaionaro-go/bytesextra"
+)
+
+func TestWriteMBR__RoundTrip(t *testing.T) {
+	image := make(memorySegment, 1024)
+	copy(image, "boot code")
+
+	partitions := []disks.MBRPartition{
+		{Bootable: true, Type: disks.MBRTypeFAT12, StartSector: 2048, TotalSectors: 2880},
+		{Type: disks.MBRTypeLinux, StartSector: 6144, TotalSectors: 10000},
+	}
+	require.NoError(t, disks.WriteMBR(image, partitions))
+	assert.Equal(t, "boot code", string(image[:9]), "boot code was overwritten")
+	assert.Equal(t, []byte{0x55, 0xAA}, []byte(image[510:512]))
+
+	readBack, err := disks.ReadMBR(image)
+	require.NoError(t, err)
+	assert.Equal(t, partitions, readBack)
+	assert.EqualValues(t, 2048*512, readBack[0].Offset())
+	assert.EqualValues(t, 2880*512, readBack[0].Size())
+}
+
+func TestWriteMBR__TooManyPartitions(t *testing.T) {
+	partitions := make([]disks.MBRPartition, 5)
+	for i := range partitions {
+		partitions[i].Type = disks.MBRTypeLinux
+	}
+	assert.Error(t, disks.WriteMBR(make(memorySegment, 512), partitions))
+}
+
+func TestReadMBR__NoSignature(t *testing.T) {
+	_, err := disks.ReadMBR(make(memorySegment, 512))
+	assert.Error(t, err)
+}
+
+// partitionedImage creates a 64-sector image with a primary partition in the
+// first slot, an extended partition in the third, and two logical partitions
+// in the extended partition. The second logical partition is filled with 'L'.
+func partitionedImage(t *testing.T) memorySegment {
+	image := make(memorySegment, 64*512)
+	require.NoError(
+		t,
+		disks.WriteMBR(
+			image,
+			[]disks.MBRPartition{
+				{Type: disks.MBRTypeFAT12, StartSector: 1, TotalSectors: 15},
+				{Type: disks.MBRTypeExtendedLBA, StartSector: 16, TotalSectors: 48},
+			},
+		),
+	)
+	// WriteMBR doesn't leave gaps, so move the extended partition to slot 3.
+	copy(image[446+32:446+48], image[446+16:446+32])
+	copy(image[446+16:446+32], make([]byte, 16))
+
+	// First EBR at sector 16: a logical partition at sectors 17-24, and the
+	// next EBR 16 sectors into the extended partition.
+	require.NoError(
+		t,
+		disks.WriteMBR(
+			disks.NewSection(image, 16*512, 512),
+			[]disks.MBRPartition{
+				{Type: disks.MBRTypeFAT16Small, StartSector: 1, TotalSectors: 8},
+				{Type: disks.MBRTypeExtended, StartSector: 16, TotalSectors: 32},
+			},
+		),
+	)
+	// Second EBR at sector 32, with a logical partition at sectors 34-63.
+	require.NoError(
+		t,
+		disks.WriteMBR(
+			disks.NewSection(image, 32*512, 512),
+			[]disks.MBRPartition{{Type: disks.MBRTypeLinux, StartSector: 2, TotalSectors: 30}},
+		),
+	)
+	copy(image[34*512:], bytes.Repeat([]byte("L"), 30*512))
+	return image
+}
+
+func TestReadPartitions__Logical(t *testing.T) {
+	image := partitionedImage(t)
+
+	partitions, err := disks.ReadPartitions(image)
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		[]disks.Partition{
+			{
+				MBRPartition: disks.MBRPartition{
+					Type: disks.MBRTypeFAT12, StartSector: 1, TotalSectors: 15,
+				},
+				Number: 1,
+			},
+			{
+				MBRPartition: disks.MBRPartition{
+					Type: disks.MBRTypeFAT16Small, StartSector: 17, TotalSectors: 8,
+				},
+				Number:  5,
+				Logical: true,
+			},
+			{
+				MBRPartition: disks.MBRPartition{
+					Type: disks.MBRTypeLinux, StartSector: 34, TotalSectors: 30,
+				},
+				Number:  6,
+				Logical: true,
+			},
+		},
+		partitions,
+	)
+
+	// ReadMBR still returns the extended partition itself.
+	primary, err := disks.ReadMBR(image)
+	require.NoError(t, err)
+	require.Len(t, primary, 2)
+	assert.True(t, primary[1].IsExtended())
+
+	section := partitions[2].Open(image)
+	assert.EqualValues(t, 30*512, section.Size())
+	data, err := io.ReadAll(section)
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte("L"), 30*512), data)
+}
+
+func TestReadPartitions__EBRLoop(t *testing.T) {
+	image := partitionedImage(t)
+	// Point the second EBR back at the first one.
+	require.NoError(
+		t,
+		disks.WriteMBR(
+			disks.NewSection(image, 32*512, 512),
+			[]disks.MBRPartition{
+				{Type: disks.MBRTypeLinux, StartSector: 2, TotalSectors: 30},
+				{Type: disks.MBRTypeExtended, StartSector: 0, TotalSectors: 48},
+			},
+		),
+	)
+
+	_, err := disks.ReadPartitions(image)
+	assert.Error(t, err)
+}
+
+func TestSection__ReadWriteSeek(t *testing.T) {
+	image := make(memorySegment, 100)
+	section := disks.NewSection(image, 10, 20)
+
+	n, err := section.WriteAt([]byte("hello"), 5)
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, "hello", string(image[15:20]))
+
+	_, err = section.WriteAt([]byte("too long"), 15)
+	assert.Error(t, err, "write past the end of the section succeeded")
+
+	position, err := section.Seek(-5, io.SeekEnd)
+	require.NoError(t, err)
+	assert.EqualValues(t, 15, position)
+
+	buffer := make([]byte, 10)
+	n, err = section.Read(buffer)
+	assert.Equal(t, 5, n)
+	assert.ErrorIs(t, err, io.EOF)
+
+	_, err = section.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	n, err = section.Read(buffer)
+	require.NoError(t, err)
+	assert.Equal(t, 10, n)
+	assert.Equal(t, "\x00\x00\x00\x00\x00hello", string(buffer))
+}
+
+func TestNewWindow__SequentialStream(t *testing.T) {
+	data := []byte("header|partition data|trailer")
+	// Embedding hides any ReadAt/WriteAt methods, so that the window has to
+	// seek the stream.
+	stream := struct{ io.ReadWriteSeeker }{bytesextra.NewReadWriteSeeker(data)}
+
+	window, err := disks.NewWindow(stream, 7, 14)
+	require.NoError(t, err)
+	assert.EqualValues(t, 14, window.Size())
+
+	contents, err := io.ReadAll(window)
+	require.NoError(t, err)
+	assert.Equal(t, "partition data", string(contents))
+
+	_, err = window.WriteAt([]byte("PART"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "header|PARTition data|trailer", string(data))
+
+	_, err = window.WriteAt([]byte("overflow"), 10)
+	assert.Error(t, err, "write past the end of the window succeeded")
+}
+
+func TestNewWindow__OutOfBounds(t *testing.T) {
+	stream := bytesextra.NewReadWriteSeeker(make([]byte, 100))
+
+	_, err := disks.NewWindow(stream, 90, 20)
+	assert.Error(t, err, "window past the end of the stream was allowed")
+
+	_, err = disks.NewWindow(stream, -1, 20)
+	assert.Error(t, err, "window with a negative offset was allowed")
+}
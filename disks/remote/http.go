@@ -0,0 +1,268 @@
+// Package remote reads and writes disk images that aren't on the local file
+// system: on web servers that support range requests, and in S3-compatible
+// object stores.
+package remote
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dargueta/disko"
+)
+
+// DefaultHTTPBlockSize is the number of bytes an [HTTPStream] fetches at a time
+// if no block size is given.
+const DefaultHTTPBlockSize = 64 * 1024
+
+// DefaultHTTPCacheBlocks is the maximum number of blocks an [HTTPStream] keeps
+// in memory if no limit is given.
+const DefaultHTTPCacheBlocks = 256
+
+// HTTPStreamOptions controls how an [HTTPStream] fetches and caches data. All
+// fields are optional.
+type HTTPStreamOptions struct {
+	// Client is the HTTP client to make requests with. If nil,
+	// [http.DefaultClient] is used.
+	Client *http.Client
+
+	// BlockSize is the number of bytes fetched in a single request. Reads are
+	// always rounded out to whole blocks. Defaults to [DefaultHTTPBlockSize].
+	BlockSize uint
+
+	// MaxCachedBlocks is the maximum number of blocks kept in memory. When the
+	// cache is full, the least recently used block is discarded. Defaults to
+	// [DefaultHTTPCacheBlocks].
+	MaxCachedBlocks uint
+
+	// PrepareRequest, if given, is called on every request just before it's
+	// sent, e.g. to add authentication headers.
+	PrepareRequest func(request *http.Request)
+}
+
+// HTTPStream is a read-only [io.ReaderAt] for an image hosted on a web server.
+// Data is fetched on demand with HTTP range requests and cached in fixed-size
+// blocks, so an image can be browsed without downloading all of it.
+//
+// HTTPStream is safe for concurrent use. To get an [io.ReadSeeker], wrap it in
+// an [io.SectionReader]:
+//
+//	reader := io.NewSectionReader(stream, 0, stream.Size())
+type HTTPStream struct {
+	url             string
+	client          *http.Client
+	blockSize       int64
+	maxCachedBlocks int
+	size            int64
+	prepareRequest  func(request *http.Request)
+
+	lock sync.Mutex
+	// blocks maps a block index to its element in `lru`.
+	blocks map[int64]*list.Element
+	// lru holds *httpBlock values, most recently used at the front.
+	lru *list.List
+}
+
+type httpBlock struct {
+	index int64
+	data  []byte
+}
+
+// NewHTTPStream creates an [HTTPStream] for the resource at `url`. It makes one
+// request to determine the size of the image, which also fetches the first
+// block. The server must support range requests.
+func NewHTTPStream(url string, options HTTPStreamOptions) (*HTTPStream, error) {
+	stream := &HTTPStream{
+		url:             url,
+		client:          options.Client,
+		blockSize:       int64(options.BlockSize),
+		maxCachedBlocks: int(options.MaxCachedBlocks),
+		prepareRequest:  options.PrepareRequest,
+		blocks:          map[int64]*list.Element{},
+		lru:             list.New(),
+	}
+
+	if stream.client == nil {
+		stream.client = http.DefaultClient
+	}
+	if stream.blockSize == 0 {
+		stream.blockSize = DefaultHTTPBlockSize
+	}
+	if stream.maxCachedBlocks == 0 {
+		stream.maxCachedBlocks = DefaultHTTPCacheBlocks
+	}
+
+	data, totalSize, err := stream.fetchRange(0, stream.blockSize)
+	if err != nil {
+		return nil, err
+	}
+	stream.size = totalSize
+	if len(data) > 0 {
+		stream.cacheBlock(0, data)
+	}
+	return stream, nil
+}
+
+// Size returns the size of the remote image, in bytes.
+func (stream *HTTPStream) Size() int64 {
+	return stream.size
+}
+
+// ReadAt implements [io.ReaderAt]. Blocks not already in the cache are fetched
+// from the server, with runs of adjacent missing blocks fetched in a single
+// request.
+func (stream *HTTPStream) ReadAt(buffer []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, disko.ErrArgumentOutOfRange.WithMessage(
+			fmt.Sprintf("negative offset: %d", offset))
+	} else if offset >= stream.size {
+		return 0, io.EOF
+	} else if len(buffer) == 0 {
+		return 0, nil
+	}
+
+	endOffset := offset + int64(len(buffer))
+	if endOffset > stream.size {
+		endOffset = stream.size
+	}
+	firstBlock := offset / stream.blockSize
+	lastBlock := (endOffset - 1) / stream.blockSize
+
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+
+	blockData := make([][]byte, lastBlock-firstBlock+1)
+	for block := firstBlock; block <= lastBlock; {
+		if element, ok := stream.blocks[block]; ok {
+			stream.lru.MoveToFront(element)
+			blockData[block-firstBlock] = element.Value.(*httpBlock).data
+			block++
+			continue
+		}
+
+		// Find the end of this run of uncached blocks and get them all at once.
+		runEnd := block + 1
+		for runEnd <= lastBlock {
+			if _, ok := stream.blocks[runEnd]; ok {
+				break
+			}
+			runEnd++
+		}
+
+		data, _, err := stream.fetchRange(
+			block*stream.blockSize, (runEnd-block)*stream.blockSize)
+		if err != nil {
+			return 0, err
+		}
+
+		for ; block < runEnd && len(data) > 0; block++ {
+			chunkSize := stream.blockSize
+			if int64(len(data)) < chunkSize {
+				chunkSize = int64(len(data))
+			}
+			blockData[block-firstBlock] = data[:chunkSize:chunkSize]
+			stream.cacheBlock(block, data[:chunkSize:chunkSize])
+			data = data[chunkSize:]
+		}
+		if block < runEnd {
+			return 0, disko.ErrIOFailed.WithMessage(
+				fmt.Sprintf("%s: server returned less data than expected", stream.url))
+		}
+	}
+
+	copied := 0
+	for i, data := range blockData {
+		blockStart := (firstBlock + int64(i)) * stream.blockSize
+		from := int64(0)
+		if blockStart < offset {
+			from = offset - blockStart
+		}
+		copied += copy(buffer[copied:], data[from:])
+	}
+
+	if copied < len(buffer) {
+		return copied, io.EOF
+	}
+	return copied, nil
+}
+
+// cacheBlock adds a block to the cache, evicting the least recently used block
+// if the cache is full. The caller must hold the lock.
+func (stream *HTTPStream) cacheBlock(index int64, data []byte) {
+	if stream.lru.Len() >= stream.maxCachedBlocks {
+		oldest := stream.lru.Back()
+		stream.lru.Remove(oldest)
+		delete(stream.blocks, oldest.Value.(*httpBlock).index)
+	}
+	stream.blocks[index] = stream.lru.PushFront(&httpBlock{index: index, data: data})
+}
+
+// fetchRange gets up to `length` bytes starting at `offset` from the server. It
+// returns the data and the total size of the resource.
+func (stream *HTTPStream) fetchRange(offset, length int64) ([]byte, int64, error) {
+	request, err := http.NewRequest(http.MethodGet, stream.url, nil)
+	if err != nil {
+		return nil, 0, disko.ErrInvalidArgument.Wrap(err)
+	}
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	if stream.prepareRequest != nil {
+		stream.prepareRequest(request)
+	}
+
+	response, err := stream.client.Do(request)
+	if err != nil {
+		return nil, 0, disko.ErrIOFailed.Wrap(err)
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The resource is empty, or shorter than `offset`.
+		totalSize, err := parseContentRangeSize(response.Header.Get("Content-Range"))
+		return nil, totalSize, err
+	case http.StatusOK:
+		return nil, 0, disko.ErrIOFailed.WithMessage(
+			fmt.Sprintf("%s: server doesn't support range requests", stream.url))
+	default:
+		return nil, 0, disko.ErrIOFailed.WithMessage(
+			fmt.Sprintf("%s: unexpected HTTP status %q", stream.url, response.Status))
+	}
+
+	totalSize, err := parseContentRangeSize(response.Header.Get("Content-Range"))
+	if err != nil {
+		return nil, 0, disko.ErrIOFailed.WithMessage(stream.url).Wrap(err)
+	}
+
+	expectedLength := length
+	if offset+expectedLength > totalSize {
+		expectedLength = totalSize - offset
+	}
+
+	data := make([]byte, expectedLength)
+	_, err = io.ReadFull(response.Body, data)
+	if err != nil {
+		return nil, 0, disko.ErrIOFailed.WithMessage(stream.url + ": short read").Wrap(err)
+	}
+	return data, totalSize, nil
+}
+
+// parseContentRangeSize extracts the total size of a resource from the value of
+// a Content-Range header, e.g. "bytes 0-511/1474560" or "bytes */0".
+func parseContentRangeSize(header string) (int64, error) {
+	_, sizeText, found := strings.Cut(header, "/")
+	if !found || sizeText == "*" {
+		return 0, disko.ErrIOFailed.WithMessage(
+			fmt.Sprintf("can't determine resource size from Content-Range %q", header))
+	}
+
+	size, err := strconv.ParseInt(sizeText, 10, 64)
+	if err != nil {
+		return 0, disko.ErrIOFailed.Wrap(err)
+	}
+	return size, nil
+}
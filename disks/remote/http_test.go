@@ -0,0 +1,115 @@
+package remote_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newImageServer starts an HTTP server that serves `image` with range request
+// support. `requestCount` is incremented on every request.
+func newImageServer(t *testing.T, image []byte, requestCount *int64) *httptest.Server {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(requestCount, 1)
+			http.ServeContent(w, r, "image.img", time.Time{}, bytes.NewReader(image))
+		}),
+	)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHTTPStream__ReadAt(t *testing.T) {
+	image := make([]byte, 10000)
+	rand.Read(image)
+
+	requestCount := int64(0)
+	server := newImageServer(t, image, &requestCount)
+
+	stream, err := remote.NewHTTPStream(
+		server.URL, remote.HTTPStreamOptions{BlockSize: 512, MaxCachedBlocks: 4})
+	require.NoError(t, err, "failed to open stream")
+	assert.EqualValues(t, len(image), stream.Size(), "wrong image size")
+	assert.EqualValues(t, 1, requestCount, "wrong number of requests to open stream")
+
+	// The first block was fetched while opening the stream.
+	buffer := make([]byte, 100)
+	_, err = stream.ReadAt(buffer, 10)
+	require.NoError(t, err)
+	assert.Equal(t, image[10:110], buffer)
+	assert.EqualValues(t, 1, requestCount, "cached block was fetched again")
+
+	// Read spanning three uncached blocks should need only one request.
+	buffer = make([]byte, 1200)
+	_, err = stream.ReadAt(buffer, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, image[1000:2200], buffer)
+	assert.EqualValues(t, 2, requestCount, "adjacent missing blocks weren't coalesced")
+
+	// Short read at the end of the image.
+	n, err := stream.ReadAt(buffer, 9500)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 500, n)
+	assert.Equal(t, image[9500:], buffer[:n])
+
+	_, err = stream.ReadAt(buffer, 10000)
+	assert.ErrorIs(t, err, io.EOF)
+
+	_, err = stream.ReadAt(buffer, -1)
+	assert.ErrorIs(t, err, disko.ErrArgumentOutOfRange)
+}
+
+func TestHTTPStream__SectionReader(t *testing.T) {
+	image := make([]byte, 4321)
+	rand.Read(image)
+
+	requestCount := int64(0)
+	server := newImageServer(t, image, &requestCount)
+
+	stream, err := remote.NewHTTPStream(server.URL, remote.HTTPStreamOptions{BlockSize: 100})
+	require.NoError(t, err)
+
+	data, err := io.ReadAll(io.NewSectionReader(stream, 0, stream.Size()))
+	require.NoError(t, err)
+	assert.Equal(t, image, data)
+}
+
+func TestHTTPStream__NoRangeSupport(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("whole file"))
+		}),
+	)
+	defer server.Close()
+
+	_, err := remote.NewHTTPStream(server.URL, remote.HTTPStreamOptions{})
+	assert.ErrorIs(t, err, disko.ErrIOFailed, "server without range support should be rejected")
+	assert.ErrorContains(t, err, "server doesn't support range requests")
+}
+
+func TestHTTPStream__NotFound(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := remote.NewHTTPStream(server.URL, remote.HTTPStreamOptions{})
+	assert.ErrorIs(t, err, disko.ErrIOFailed)
+	assert.ErrorContains(t, err, `unexpected HTTP status "404 Not Found"`)
+}
+
+func TestHTTPStream__ConnectionFails(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	_, err := remote.NewHTTPStream(server.URL, remote.HTTPStreamOptions{})
+	assert.ErrorIs(t, err, disko.ErrIOFailed)
+}
@@ -0,0 +1,527 @@
+package remote
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dargueta/disko"
+)
+
+// DefaultS3PartSize is the size of each part in a multipart upload if no part
+// size is given. S3 requires every part except the last to be at least 5 MiB.
+const DefaultS3PartSize = 8 * 1024 * 1024
+
+// S3Config holds the connection settings for an S3-compatible object store.
+type S3Config struct {
+	// Endpoint is the base URL of the object store, e.g. "http://localhost:9000"
+	// for a local MinIO server. If empty, the AWS endpoint for [Region] is used.
+	Endpoint string
+
+	// Region is the region the bucket is in. Defaults to "us-east-1".
+	Region string
+
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// SessionToken is only needed with temporary credentials.
+	SessionToken string
+
+	// Client is the HTTP client to make requests with. If nil,
+	// [http.DefaultClient] is used.
+	Client *http.Client
+
+	// PartSize is the size of each part when uploading an image. Defaults to
+	// [DefaultS3PartSize]. Images smaller than this are uploaded in a single
+	// request.
+	PartSize int64
+}
+
+// S3ConfigFromEnvironment creates an [S3Config] from the environment variables
+// used by the AWS command line tools: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+// AWS_SESSION_TOKEN, AWS_REGION (or AWS_DEFAULT_REGION), and AWS_ENDPOINT_URL.
+func S3ConfigFromEnvironment() S3Config {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	return S3Config{
+		Endpoint:        os.Getenv("AWS_ENDPOINT_URL"),
+		Region:          region,
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// ParseS3URL splits a URL of the form "s3://bucket/path/to/key" into its
+// bucket and key.
+func ParseS3URL(rawURL string) (bucket string, key string, err error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", disko.ErrInvalidArgument.Wrap(err)
+	}
+	if parsed.Scheme != "s3" {
+		return "", "", disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("not an s3:// URL: %q", rawURL))
+	}
+
+	key = strings.TrimPrefix(parsed.Path, "/")
+	if parsed.Host == "" || key == "" {
+		return "", "", disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("S3 URL must have a bucket and key: %q", rawURL))
+	}
+	return parsed.Host, key, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// S3Image is an image stored as an object in an S3-compatible object store. It
+// implements [io.ReaderAt] and [io.WriterAt].
+//
+// Reads are served with range requests through an [HTTPStream]. Writes are
+// kept in memory until [S3Image.Flush] is called, which uploads the entire
+// image as a new version of the object, using a multipart upload if it's
+// larger than [S3Config.PartSize].
+//
+// S3Image is safe for concurrent use.
+type S3Image struct {
+	config    S3Config
+	objectURL string
+	blockSize int64
+	options   HTTPStreamOptions
+
+	lock sync.Mutex
+	// remote reads the object as it was at the last flush. It's nil if the
+	// object didn't exist or was empty.
+	remote *HTTPStream
+	size   int64
+	// dirty holds modified blocks that haven't been uploaded yet. Every slice
+	// is exactly `blockSize` bytes long.
+	dirty map[int64][]byte
+	// zeroFrom is the lowest size the image has been truncated to since the last
+	// flush. Remote data at or after this offset is treated as zeros.
+	zeroFrom int64
+}
+
+// OpenS3Image opens the object at `rawURL`, an "s3://bucket/key" URL. If the
+// object doesn't exist, the image is empty and will be created on the first
+// [S3Image.Flush]. `options` controls how data is read and cached; its
+// PrepareRequest field is ignored.
+func OpenS3Image(rawURL string, config S3Config, options HTTPStreamOptions) (*S3Image, error) {
+	bucket, key, err := ParseS3URL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	if config.PartSize == 0 {
+		config.PartSize = DefaultS3PartSize
+	}
+	if options.BlockSize == 0 {
+		options.BlockSize = DefaultHTTPBlockSize
+	}
+
+	image := &S3Image{
+		config: config,
+		objectURL: fmt.Sprintf(
+			"%s/%s/%s",
+			strings.TrimSuffix(config.Endpoint, "/"),
+			sigV4Escape(bucket, false),
+			sigV4Escape(key, true),
+		),
+		blockSize: int64(options.BlockSize),
+		options:   options,
+		dirty:     map[int64][]byte{},
+	}
+	image.options.Client = config.Client
+	image.options.PrepareRequest = func(request *http.Request) {
+		image.config.SignRequest(request, nil, time.Now())
+	}
+
+	err = image.openRemote()
+	if err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+// openRemote (re)creates the stream for reading the object as it currently is
+// on the server. The caller must hold the lock, if needed.
+func (image *S3Image) openRemote() error {
+	response, err := image.do(http.MethodHead, "", nil)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	image.remote = nil
+	image.size = 0
+	if response.StatusCode == http.StatusNotFound {
+		image.zeroFrom = 0
+		return nil
+	} else if response.StatusCode != http.StatusOK {
+		return disko.ErrIOFailed.WithMessage(
+			fmt.Sprintf("%s: unexpected HTTP status %q", image.objectURL, response.Status))
+	}
+
+	if response.ContentLength > 0 {
+		image.remote, err = NewHTTPStream(image.objectURL, image.options)
+		if err != nil {
+			return err
+		}
+		image.size = image.remote.Size()
+	}
+	image.zeroFrom = image.size
+	return nil
+}
+
+// Size returns the current size of the image, including unflushed changes.
+func (image *S3Image) Size() int64 {
+	image.lock.Lock()
+	defer image.lock.Unlock()
+	return image.size
+}
+
+// loadBlock returns the current contents of a block, zero-padded to the block
+// size. The returned slice must not be modified unless it's in `dirty`. The
+// caller must hold the lock.
+func (image *S3Image) loadBlock(index int64) ([]byte, error) {
+	if data, ok := image.dirty[index]; ok {
+		return data, nil
+	}
+
+	data := make([]byte, image.blockSize)
+	start := index * image.blockSize
+	if image.remote == nil || start >= image.zeroFrom {
+		return data, nil
+	}
+
+	n, err := image.remote.ReadAt(data, start)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	// Hide any remote data past the point the image was truncated to.
+	validBytes := image.zeroFrom - start
+	for i := validBytes; i < int64(n); i++ {
+		data[i] = 0
+	}
+	return data, nil
+}
+
+// ReadAt implements [io.ReaderAt].
+func (image *S3Image) ReadAt(buffer []byte, offset int64) (int, error) {
+	image.lock.Lock()
+	defer image.lock.Unlock()
+
+	if offset < 0 {
+		return 0, disko.ErrArgumentOutOfRange.WithMessage(
+			fmt.Sprintf("negative offset: %d", offset))
+	} else if offset >= image.size {
+		return 0, io.EOF
+	}
+
+	copied := 0
+	for copied < len(buffer) && offset < image.size {
+		block := offset / image.blockSize
+		data, err := image.loadBlock(block)
+		if err != nil {
+			return copied, err
+		}
+
+		from := offset - block*image.blockSize
+		to := image.blockSize
+		if remaining := image.size - block*image.blockSize; remaining < to {
+			to = remaining
+		}
+
+		n := copy(buffer[copied:], data[from:to])
+		copied += n
+		offset += int64(n)
+	}
+
+	if copied < len(buffer) {
+		return copied, io.EOF
+	}
+	return copied, nil
+}
+
+// WriteAt implements [io.WriterAt]. Writing past the end of the image extends
+// it, and any gap is filled with zeros. Changes aren't visible to other
+// clients of the object store until [S3Image.Flush] is called.
+func (image *S3Image) WriteAt(data []byte, offset int64) (int, error) {
+	image.lock.Lock()
+	defer image.lock.Unlock()
+
+	if offset < 0 {
+		return 0, disko.ErrArgumentOutOfRange.WithMessage(
+			fmt.Sprintf("negative offset: %d", offset))
+	}
+
+	written := 0
+	for written < len(data) {
+		block := offset / image.blockSize
+		blockData, err := image.loadBlock(block)
+		if err != nil {
+			return written, err
+		}
+		if _, ok := image.dirty[block]; !ok {
+			blockData = bytes.Clone(blockData)
+			image.dirty[block] = blockData
+		}
+
+		n := copy(blockData[offset-block*image.blockSize:], data[written:])
+		written += n
+		offset += int64(n)
+	}
+
+	if offset > image.size {
+		image.size = offset
+	}
+	return written, nil
+}
+
+// Truncate changes the size of the image. Growing it fills the new space with
+// zeros. Like writes, this isn't visible to other clients until the image is
+// flushed.
+func (image *S3Image) Truncate(size int64) error {
+	image.lock.Lock()
+	defer image.lock.Unlock()
+
+	if size < 0 {
+		return disko.ErrArgumentOutOfRange.WithMessage(fmt.Sprintf("negative size: %d", size))
+	}
+
+	if size < image.size {
+		// Zero out the tail of the new last block so that it reads back as
+		// zeros if the image grows again.
+		lastBlock := size / image.blockSize
+		if blockData, ok := image.dirty[lastBlock]; ok {
+			for i := size - lastBlock*image.blockSize; i < image.blockSize; i++ {
+				blockData[i] = 0
+			}
+		}
+		for block := range image.dirty {
+			if block > lastBlock {
+				delete(image.dirty, block)
+			}
+		}
+		if size < image.zeroFrom {
+			image.zeroFrom = size
+		}
+	}
+
+	image.size = size
+	return nil
+}
+
+// Flush uploads the image if it's been modified since it was opened or last
+// flushed.
+func (image *S3Image) Flush() error {
+	image.lock.Lock()
+	defer image.lock.Unlock()
+
+	remoteSize := int64(0)
+	if image.remote != nil {
+		remoteSize = image.remote.Size()
+	}
+	// Zeroing the tail of the image changes it even if it grew back to the
+	// same size afterwards.
+	if len(image.dirty) == 0 && image.size == remoteSize && image.zeroFrom >= remoteSize {
+		return nil
+	}
+
+	var err error
+	if image.size < image.config.PartSize {
+		err = image.uploadSingle()
+	} else {
+		err = image.uploadMultipart()
+	}
+	if err != nil {
+		return err
+	}
+
+	image.dirty = map[int64][]byte{}
+	return image.openRemote()
+}
+
+// Close flushes the image. It implements [io.Closer].
+func (image *S3Image) Close() error {
+	return image.Flush()
+}
+
+// readRange gets the current contents of part of the image, without the lock.
+func (image *S3Image) readRange(offset, length int64) ([]byte, error) {
+	data := make([]byte, 0, length)
+	for int64(len(data)) < length {
+		block := (offset + int64(len(data))) / image.blockSize
+		blockData, err := image.loadBlock(block)
+		if err != nil {
+			return nil, err
+		}
+
+		from := offset + int64(len(data)) - block*image.blockSize
+		to := image.blockSize
+		if remaining := length - int64(len(data)) + from; remaining < to {
+			to = remaining
+		}
+		data = append(data, blockData[from:to]...)
+	}
+	return data, nil
+}
+
+func (image *S3Image) uploadSingle() error {
+	payload, err := image.readRange(0, image.size)
+	if err != nil {
+		return err
+	}
+
+	response, err := image.do(http.MethodPut, "", payload)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	return checkS3Response(response, image.objectURL)
+}
+
+type s3InitiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type s3CompletedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletedPart `xml:"Part"`
+}
+
+func (image *S3Image) uploadMultipart() error {
+	response, err := image.do(http.MethodPost, "uploads=", nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if err = checkS3Response(response, image.objectURL); err != nil {
+		return err
+	}
+
+	initResult := s3InitiateMultipartUploadResult{}
+	err = xml.NewDecoder(response.Body).Decode(&initResult)
+	if err != nil {
+		return disko.ErrIOFailed.WithMessage(
+			fmt.Sprintf("%s: bad response to multipart upload request: %s", image.objectURL, err))
+	}
+	uploadQuery := "uploadId=" + url.QueryEscape(initResult.UploadID)
+
+	parts, err := image.uploadParts(uploadQuery)
+	if err != nil {
+		// Abort so the store doesn't keep the uploaded parts around. If this
+		// fails there's nothing more we can do, so ignore the result.
+		abortResponse, abortErr := image.do(http.MethodDelete, uploadQuery, nil)
+		if abortErr == nil {
+			abortResponse.Body.Close()
+		}
+		return err
+	}
+
+	completion, err := xml.Marshal(s3CompleteMultipartUpload{Parts: parts})
+	if err != nil {
+		return err
+	}
+
+	completeResponse, err := image.do(http.MethodPost, uploadQuery, completion)
+	if err != nil {
+		return err
+	}
+	defer completeResponse.Body.Close()
+	return checkS3Response(completeResponse, image.objectURL)
+}
+
+func (image *S3Image) uploadParts(uploadQuery string) ([]s3CompletedPart, error) {
+	parts := []s3CompletedPart{}
+	for offset := int64(0); offset < image.size; offset += image.config.PartSize {
+		partSize := image.config.PartSize
+		if offset+partSize > image.size {
+			partSize = image.size - offset
+		}
+
+		payload, err := image.readRange(offset, partSize)
+		if err != nil {
+			return nil, err
+		}
+
+		partNumber := len(parts) + 1
+		response, err := image.do(
+			http.MethodPut,
+			fmt.Sprintf("partNumber=%d&%s", partNumber, uploadQuery),
+			payload,
+		)
+		if err != nil {
+			return nil, err
+		}
+		response.Body.Close()
+		if err = checkS3Response(response, image.objectURL); err != nil {
+			return nil, err
+		}
+
+		parts = append(
+			parts,
+			s3CompletedPart{PartNumber: partNumber, ETag: response.Header.Get("ETag")},
+		)
+	}
+	return parts, nil
+}
+
+// do sends a signed request for the object.
+func (image *S3Image) do(method string, query string, payload []byte) (*http.Response, error) {
+	requestURL := image.objectURL
+	if query != "" {
+		requestURL += "?" + query
+	}
+
+	request, err := http.NewRequest(method, requestURL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, disko.ErrInvalidArgument.Wrap(err)
+	}
+	image.config.SignRequest(request, payload, time.Now())
+
+	response, err := image.config.Client.Do(request)
+	if err != nil {
+		return nil, disko.ErrIOFailed.Wrap(err)
+	}
+	return response, nil
+}
+
+func checkS3Response(response *http.Response, objectURL string) error {
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	return disko.ErrIOFailed.WithMessage(
+		fmt.Sprintf(
+			"%s: unexpected HTTP status %q: %s",
+			objectURL,
+			response.Status,
+			strings.TrimSpace(string(body)),
+		),
+	)
+}
@@ -0,0 +1,146 @@
+package remote
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptyPayloadHash is the hex SHA-256 digest of an empty request body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+const sigV4Algorithm = "AWS4-HMAC-SHA256"
+const sigV4TimeFormat = "20060102T150405Z"
+
+// SignRequest adds AWS Signature Version 4 authentication headers to a request
+// for the "s3" service, as of time `at`. `payload` must be the request body,
+// or nil if there is none; the request body itself isn't read.
+func (config *S3Config) SignRequest(request *http.Request, payload []byte, at time.Time) {
+	at = at.UTC()
+	amzDate := at.Format(sigV4TimeFormat)
+	shortDate := amzDate[:8]
+
+	payloadHash := emptyPayloadHash
+	if len(payload) > 0 {
+		digest := sha256.Sum256(payload)
+		payloadHash = hex.EncodeToString(digest[:])
+	}
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if config.SessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", config.SessionToken)
+	}
+
+	host := request.Host
+	if host == "" {
+		host = request.URL.Host
+	}
+
+	// Sign the host, the range, and all headers specific to S3.
+	headers := map[string]string{"host": host}
+	for name, values := range request.Header {
+		lowerName := strings.ToLower(name)
+		if lowerName == "range" || strings.HasPrefix(lowerName, "x-amz-") {
+			headers[lowerName] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	headerNames := make([]string, 0, len(headers))
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+
+	canonicalHeaders := strings.Builder{}
+	for _, name := range headerNames {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join(
+		[]string{
+			request.Method,
+			canonicalURIPath(request.URL),
+			canonicalQueryString(request.URL),
+			canonicalHeaders.String(),
+			signedHeaders,
+			payloadHash,
+		},
+		"\n",
+	)
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", shortDate, config.Region)
+	canonicalDigest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join(
+		[]string{sigV4Algorithm, amzDate, scope, hex.EncodeToString(canonicalDigest[:])},
+		"\n",
+	)
+
+	signingKey := hmacSHA256([]byte("AWS4"+config.SecretAccessKey), shortDate)
+	signingKey = hmacSHA256(signingKey, config.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	request.Header.Set(
+		"Authorization",
+		fmt.Sprintf(
+			"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+			sigV4Algorithm,
+			config.AccessKeyID,
+			scope,
+			signedHeaders,
+			signature,
+		),
+	)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// sigV4Escape percent-encodes everything in `text` except the characters AWS
+// considers unreserved. Slashes are encoded unless `keepSlashes` is set.
+func sigV4Escape(text string, keepSlashes bool) string {
+	result := strings.Builder{}
+	for _, b := range []byte(text) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~':
+			result.WriteByte(b)
+		case b == '/' && keepSlashes:
+			result.WriteByte(b)
+		default:
+			fmt.Fprintf(&result, "%%%02X", b)
+		}
+	}
+	return result.String()
+}
+
+func canonicalURIPath(u *url.URL) string {
+	if u.Path == "" {
+		return "/"
+	}
+	return sigV4Escape(u.Path, true)
+}
+
+func canonicalQueryString(u *url.URL) string {
+	query := u.Query()
+	pairs := make([]string, 0, len(query))
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, sigV4Escape(key, false)+"="+sigV4Escape(value, false))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
@@ -0,0 +1,179 @@
+package disks
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ReadWriterAt is an image that can be read and written at arbitrary offsets.
+type ReadWriterAt interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// Section is a fixed-size window into part of a larger image, such as a single
+// partition. Offsets are relative to the start of the section, and it can't be
+// read or written past its end.
+//
+// Besides [io.ReaderAt] and [io.WriterAt], it implements [io.ReadWriteSeeker]
+// so that it can be passed to a [disko.ImplementerConstructor].
+type Section struct {
+	image    ReadWriterAt
+	start    int64
+	size     int64
+	position int64
+}
+
+// NewSection creates a [Section] covering `size` bytes of `image` beginning at
+// `start`.
+func NewSection(image ReadWriterAt, start, size int64) *Section {
+	return &Section{image: image, start: start, size: size}
+}
+
+// NewWindow creates a [Section] covering bytes [offset, offset + length) of
+// `stream`, so that they can be treated as a standalone image. This is useful
+// for partitions, hybrid images, and images with a container header in front.
+//
+// If `stream` implements [io.ReaderAt] and [io.WriterAt], those are used
+// directly. Otherwise, every access seeks the stream first, so it must not be
+// used by anything else while the window is in use. Accesses through the
+// window itself are serialized, so it's safe for concurrent use either way. The window must be entirely
+// within the stream.
+func NewWindow(stream io.ReadWriteSeeker, offset, length int64) (*Section, error) {
+	if offset < 0 || length < 0 {
+		return nil, fmt.Errorf("invalid window: offset %d, length %d", offset, length)
+	}
+
+	streamSize, err := stream.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	} else if offset+length > streamSize {
+		return nil, fmt.Errorf(
+			"window [%d, %d) extends past the end of the %d-byte stream",
+			offset,
+			offset+length,
+			streamSize,
+		)
+	}
+
+	image, ok := stream.(ReadWriterAt)
+	if !ok {
+		image = &seekingReadWriterAt{stream: stream}
+	}
+	return NewSection(image, offset, length), nil
+}
+
+// seekingReadWriterAt implements [ReadWriterAt] for a stream that only supports
+// sequential access, by seeking before every read or write. The lock keeps
+// concurrent accesses from moving the stream's position out from under each
+// other.
+type seekingReadWriterAt struct {
+	stream io.ReadWriteSeeker
+	lock   sync.Mutex
+}
+
+func (adapter *seekingReadWriterAt) ReadAt(buffer []byte, offset int64) (int, error) {
+	adapter.lock.Lock()
+	defer adapter.lock.Unlock()
+
+	_, err := adapter.stream.Seek(offset, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.ReadFull(adapter.stream, buffer)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (adapter *seekingReadWriterAt) WriteAt(data []byte, offset int64) (int, error) {
+	adapter.lock.Lock()
+	defer adapter.lock.Unlock()
+
+	_, err := adapter.stream.Seek(offset, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	return adapter.stream.Write(data)
+}
+
+// Size returns the size of the section, in bytes.
+func (section *Section) Size() int64 {
+	return section.size
+}
+
+// ReadAt implements [io.ReaderAt].
+func (section *Section) ReadAt(buffer []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset: %d", offset)
+	} else if offset >= section.size {
+		return 0, io.EOF
+	}
+
+	truncated := false
+	if remaining := section.size - offset; int64(len(buffer)) > remaining {
+		buffer = buffer[:remaining]
+		truncated = true
+	}
+
+	n, err := section.image.ReadAt(buffer, section.start+offset)
+	if err == nil && truncated {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// WriteAt implements [io.WriterAt]. Writing past the end of the section is an
+// error.
+func (section *Section) WriteAt(data []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset: %d", offset)
+	} else if offset+int64(len(data)) > section.size {
+		return 0, fmt.Errorf(
+			"can't write %d bytes at offset %d: section is only %d bytes",
+			len(data),
+			offset,
+			section.size,
+		)
+	}
+	return section.image.WriteAt(data, section.start+offset)
+}
+
+// Read implements [io.Reader].
+func (section *Section) Read(buffer []byte) (int, error) {
+	n, err := section.ReadAt(buffer, section.position)
+	section.position += int64(n)
+	return n, err
+}
+
+// Write implements [io.Writer].
+func (section *Section) Write(data []byte) (int, error) {
+	n, err := section.WriteAt(data, section.position)
+	section.position += int64(n)
+	return n, err
+}
+
+// Seek implements [io.Seeker]. Seeking past the end of the section is allowed,
+// but reading or writing there isn't.
+func (section *Section) Seek(offset int64, whence int) (int64, error) {
+	var newPosition int64
+	switch whence {
+	case io.SeekStart:
+		newPosition = offset
+	case io.SeekCurrent:
+		newPosition = section.position + offset
+	case io.SeekEnd:
+		newPosition = section.size + offset
+	default:
+		return section.position, fmt.Errorf("invalid whence: %d", whence)
+	}
+
+	if newPosition < 0 {
+		return section.position, fmt.Errorf("can't seek to negative offset %d", newPosition)
+	}
+	section.position = newPosition
+	return newPosition, nil
+}
@@ -0,0 +1,221 @@
+package disks
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Segment is one of the files making up a multi-file image, such as a hard
+// drive dump split into pieces.
+type Segment struct {
+	// Data holds the segment's contents. To write to an image made from the
+	// segment, Data must also implement [io.WriterAt].
+	Data io.ReaderAt
+
+	// Size is the number of bytes in the segment that are part of the image.
+	// Anything in Data past this is ignored.
+	Size int64
+}
+
+// segmentedImage maps offsets in a logical image to segments. It implements
+// [io.ReaderAt] and [io.WriterAt] on top of a `locate` function provided by
+// each layout.
+type segmentedImage struct {
+	segments []Segment
+	size     int64
+
+	// locate returns the index of the segment containing `offset`, the offset
+	// within that segment, and the number of contiguous bytes from there that
+	// map to the same segment. `offset` is always in [0, size).
+	locate func(offset int64) (index int, segmentOffset int64, length int64)
+}
+
+// Size returns the total size of the image, in bytes.
+func (image *segmentedImage) Size() int64 {
+	return image.size
+}
+
+// ReadAt implements [io.ReaderAt].
+func (image *segmentedImage) ReadAt(buffer []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset: %d", offset)
+	} else if offset >= image.size {
+		return 0, io.EOF
+	}
+
+	copied := 0
+	for copied < len(buffer) && offset < image.size {
+		index, segmentOffset, length := image.locate(offset)
+		if remaining := int64(len(buffer) - copied); remaining < length {
+			length = remaining
+		}
+
+		chunk := buffer[copied : int64(copied)+length]
+		n, err := image.segments[index].Data.ReadAt(chunk, segmentOffset)
+		copied += n
+		offset += int64(n)
+
+		if err == io.EOF && n < len(chunk) {
+			return copied, fmt.Errorf(
+				"segment %d is smaller than its declared size of %d bytes: %w",
+				index,
+				image.segments[index].Size,
+				io.ErrUnexpectedEOF,
+			)
+		} else if err != nil && err != io.EOF {
+			return copied, err
+		}
+	}
+
+	if copied < len(buffer) {
+		return copied, io.EOF
+	}
+	return copied, nil
+}
+
+// WriteAt implements [io.WriterAt]. The image can't be resized, so writing past
+// the end of it is an error. All segments touched by the write must implement
+// [io.WriterAt].
+func (image *segmentedImage) WriteAt(data []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset: %d", offset)
+	} else if offset+int64(len(data)) > image.size {
+		return 0, fmt.Errorf(
+			"can't write %d bytes at offset %d: image is only %d bytes",
+			len(data),
+			offset,
+			image.size,
+		)
+	}
+
+	written := 0
+	for written < len(data) {
+		index, segmentOffset, length := image.locate(offset)
+		if remaining := int64(len(data) - written); remaining < length {
+			length = remaining
+		}
+
+		writer, ok := image.segments[index].Data.(io.WriterAt)
+		if !ok {
+			return written, fmt.Errorf("segment %d is read-only", index)
+		}
+
+		n, err := writer.WriteAt(data[written:int64(written)+length], segmentOffset)
+		written += n
+		offset += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// ConcatImage is an image made by joining segments end to end. Segments may be
+// of different sizes.
+type ConcatImage struct {
+	segmentedImage
+	// starts gives the offset in the image where each segment begins.
+	starts []int64
+}
+
+// Concat creates an image from `segments` placed one after the other, in the
+// order given.
+func Concat(segments ...Segment) (*ConcatImage, error) {
+	image := &ConcatImage{
+		segmentedImage: segmentedImage{segments: segments},
+		starts:         make([]int64, len(segments)),
+	}
+
+	for i, segment := range segments {
+		if segment.Size < 0 {
+			return nil, fmt.Errorf("segment %d has a negative size: %d", i, segment.Size)
+		}
+		image.starts[i] = image.size
+		image.size += segment.Size
+	}
+
+	image.locate = image.locateConcat
+	return image, nil
+}
+
+func (image *ConcatImage) locateConcat(offset int64) (int, int64, int64) {
+	// Find the last segment starting at or before `offset`. Empty segments share
+	// their start with the segment after them, so this skips over them.
+	index := sort.Search(
+		len(image.starts),
+		func(i int) bool { return image.starts[i] > offset },
+	) - 1
+
+	segmentOffset := offset - image.starts[index]
+	return index, segmentOffset, image.segments[index].Size - segmentOffset
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// StripedImage is an image whose data is interleaved across several segments
+// in fixed-size stripes, as with RAID 0. Stripe 0 is at the beginning of the
+// first segment, stripe 1 at the beginning of the second, and so on, wrapping
+// around to the first segment after the last.
+type StripedImage struct {
+	segmentedImage
+	stripeSize int64
+}
+
+// Stripe creates an image from `segments` interleaved in stripes of
+// `stripeSize` bytes. All segments must be the same size, and that size must be
+// a multiple of the stripe size.
+func Stripe(stripeSize int64, segments ...Segment) (*StripedImage, error) {
+	if stripeSize <= 0 {
+		return nil, fmt.Errorf("stripe size must be positive, got %d", stripeSize)
+	} else if len(segments) == 0 {
+		return nil, fmt.Errorf("can't make a striped image from no segments")
+	}
+
+	segmentSize := segments[0].Size
+	for i, segment := range segments {
+		if segment.Size != segmentSize {
+			return nil, fmt.Errorf(
+				"all segments must be the same size: segment 0 is %d bytes but"+
+					" segment %d is %d",
+				segmentSize,
+				i,
+				segment.Size,
+			)
+		}
+	}
+	if segmentSize%stripeSize != 0 {
+		return nil, fmt.Errorf(
+			"segment size %d isn't a multiple of the stripe size %d",
+			segmentSize,
+			stripeSize,
+		)
+	}
+
+	image := &StripedImage{
+		segmentedImage: segmentedImage{
+			segments: segments,
+			size:     segmentSize * int64(len(segments)),
+		},
+		stripeSize: stripeSize,
+	}
+	image.locate = image.locateStripe
+	return image, nil
+}
+
+// StripeSize returns the size of a single stripe, in bytes.
+func (image *StripedImage) StripeSize() int64 {
+	return image.stripeSize
+}
+
+func (image *StripedImage) locateStripe(offset int64) (int, int64, int64) {
+	stripe := offset / image.stripeSize
+	withinStripe := offset % image.stripeSize
+	totalSegments := int64(len(image.segments))
+
+	index := int(stripe % totalSegments)
+	segmentOffset := (stripe/totalSegments)*image.stripeSize + withinStripe
+	return index, segmentOffset, image.stripeSize - withinStripe
+}
@@ -0,0 +1,127 @@
+package disks_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/dargueta/disko/disks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memorySegment is a fixed-size in-memory segment that can be read and written.
+type memorySegment []byte
+
+func (segment memorySegment) ReadAt(buffer []byte, offset int64) (int, error) {
+	return bytes.NewReader(segment).ReadAt(buffer, offset)
+}
+
+func (segment memorySegment) WriteAt(data []byte, offset int64) (int, error) {
+	if offset+int64(len(data)) > int64(len(segment)) {
+		return 0, io.ErrShortWrite
+	}
+	return copy(segment[offset:], data), nil
+}
+
+func TestConcat__ReadWrite(t *testing.T) {
+	image := make([]byte, 1000)
+	rand.Read(image)
+
+	pieces := [][]byte{
+		bytes.Clone(image[:300]),
+		{},
+		bytes.Clone(image[300:700]),
+		bytes.Clone(image[700:]),
+	}
+	segments := make([]disks.Segment, len(pieces))
+	for i, piece := range pieces {
+		segments[i] = disks.Segment{Data: memorySegment(piece), Size: int64(len(piece))}
+	}
+
+	concat, err := disks.Concat(segments...)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(image), concat.Size())
+
+	data, err := io.ReadAll(io.NewSectionReader(concat, 0, concat.Size()))
+	require.NoError(t, err)
+	assert.Equal(t, image, data)
+
+	// Write spanning all three non-empty segments.
+	patch := make([]byte, 500)
+	rand.Read(patch)
+	_, err = concat.WriteAt(patch, 250)
+	require.NoError(t, err)
+	copy(image[250:], patch)
+
+	assert.Equal(t, image[:300], pieces[0])
+	assert.Equal(t, image[300:700], pieces[2])
+	assert.Equal(t, image[700:], pieces[3])
+
+	buffer := make([]byte, 100)
+	n, err := concat.ReadAt(buffer, 950)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 50, n)
+	assert.Equal(t, image[950:], buffer[:n])
+
+	_, err = concat.WriteAt(buffer, 950)
+	assert.Error(t, err, "writing past the end of the image should fail")
+}
+
+func TestStripe__ReadWrite(t *testing.T) {
+	const stripeSize = 64
+
+	image := make([]byte, stripeSize*3*4)
+	rand.Read(image)
+
+	// Deal the stripes out to three segments the way a RAID 0 controller would.
+	pieces := make([][]byte, 3)
+	for i := 0; i < len(image)/stripeSize; i++ {
+		pieces[i%3] = append(pieces[i%3], image[i*stripeSize:(i+1)*stripeSize]...)
+	}
+	segments := make([]disks.Segment, len(pieces))
+	for i, piece := range pieces {
+		segments[i] = disks.Segment{Data: memorySegment(piece), Size: int64(len(piece))}
+	}
+
+	striped, err := disks.Stripe(stripeSize, segments...)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(image), striped.Size())
+
+	data, err := io.ReadAll(io.NewSectionReader(striped, 0, striped.Size()))
+	require.NoError(t, err)
+	assert.Equal(t, image, data)
+
+	patch := make([]byte, 3*stripeSize)
+	rand.Read(patch)
+	_, err = striped.WriteAt(patch, stripeSize/2)
+	require.NoError(t, err)
+	copy(image[stripeSize/2:], patch)
+
+	assert.Equal(t, image[:stripeSize], pieces[0][:stripeSize])
+	assert.Equal(t, image[stripeSize:2*stripeSize], pieces[1][:stripeSize])
+	assert.Equal(t, image[2*stripeSize:3*stripeSize], pieces[2][:stripeSize])
+	assert.Equal(t, image[3*stripeSize:4*stripeSize], pieces[0][stripeSize:2*stripeSize])
+}
+
+func TestStripe__InvalidSegments(t *testing.T) {
+	_, err := disks.Stripe(
+		512,
+		disks.Segment{Data: bytes.NewReader(nil), Size: 1024},
+		disks.Segment{Data: bytes.NewReader(nil), Size: 512},
+	)
+	assert.Error(t, err, "segments of different sizes should be rejected")
+
+	_, err = disks.Stripe(512, disks.Segment{Data: bytes.NewReader(nil), Size: 1000})
+	assert.Error(t, err, "segment size not a multiple of the stripe size should be rejected")
+}
+
+func TestConcat__ReadOnlySegment(t *testing.T) {
+	concat, err := disks.Concat(
+		disks.Segment{Data: bytes.NewReader(make([]byte, 10)), Size: 10})
+	require.NoError(t, err)
+
+	_, err = concat.WriteAt([]byte{1}, 0)
+	assert.Error(t, err)
+}
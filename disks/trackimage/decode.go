@@ -0,0 +1,239 @@
+// Package trackimage decodes sector data from raw floppy track images, such as
+// HFE files or MFM bitstream dumps made with Greaseweazle-type hardware, into a
+// plain sector-by-sector image that existing drivers can mount.
+//
+// Only IBM-compatible FM and MFM track formats are supported.
+package trackimage
+
+import (
+	"fmt"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/utilities/checksum"
+)
+
+// Encoding is the way data bits are recorded on a track.
+type Encoding int
+
+const (
+	// EncodingMFM is the IBM double density format, used by PC, Atari ST, MSX,
+	// and most other floppies from the mid-1980s on.
+	EncodingMFM = Encoding(iota)
+	// EncodingFM is the IBM single density format, used by 8" floppies and
+	// early 5.25" ones.
+	EncodingFM
+)
+
+func (encoding Encoding) String() string {
+	switch encoding {
+	case EncodingMFM:
+		return "MFM"
+	case EncodingFM:
+		return "FM"
+	default:
+		return fmt.Sprintf("Encoding(%d)", int(encoding))
+	}
+}
+
+// Bitstream is the sequence of cells recorded on one side of a track. Each cell
+// is one bit: 1 for a flux transition, 0 for none.
+type Bitstream struct {
+	// Data holds the cells, packed eight to a byte.
+	Data []byte
+	// Length is the number of valid cells in Data. If 0, all of Data is used.
+	Length int
+	// LSBFirst is true if the first cell in each byte is its least significant
+	// bit, as in HFE files. Otherwise the most significant bit comes first.
+	LSBFirst bool
+}
+
+// cellCount returns the number of valid cells in the stream.
+func (stream Bitstream) cellCount() int {
+	if stream.Length == 0 || stream.Length > len(stream.Data)*8 {
+		return len(stream.Data) * 8
+	}
+	return stream.Length
+}
+
+// cell returns the value of the cell at index `i`.
+func (stream Bitstream) cell(i int) uint16 {
+	shift := 7 - uint(i%8)
+	if stream.LSBFirst {
+		shift = uint(i % 8)
+	}
+	return uint16(stream.Data[i/8]>>shift) & 1
+}
+
+// rawWord returns the 16 cells beginning at index `i`, the first in the most
+// significant bit. The caller must ensure there are at least 16 cells left.
+func (stream Bitstream) rawWord(i int) uint16 {
+	word := uint16(0)
+	for j := 0; j < 16; j++ {
+		word = word<<1 | stream.cell(i+j)
+	}
+	return word
+}
+
+// decodeBytes decodes `count` bytes beginning at cell `start`. Both FM and MFM
+// store each data bit in the second cell of a pair, so the same function works
+// for either. It returns false if the track ends first.
+func (stream Bitstream) decodeBytes(start int, count int) ([]byte, bool) {
+	if start+count*16 > stream.cellCount() {
+		return nil, false
+	}
+
+	output := make([]byte, count)
+	for i := range output {
+		value := byte(0)
+		for bit := 0; bit < 8; bit++ {
+			value = value<<1 | byte(stream.cell(start+i*16+bit*2+1))
+		}
+		output[i] = value
+	}
+	return output, true
+}
+
+// Sector is a sector decoded from a track.
+type Sector struct {
+	// Cylinder, Head, and Record are the values from the sector's ID field.
+	// They usually, but not always, match the physical location of the sector.
+	Cylinder uint8
+	Head     uint8
+	Record   uint8
+	// Deleted is true if the sector was written with a deleted data mark.
+	Deleted bool
+	Data    []byte
+}
+
+// Raw cell patterns of the address marks. MFM marks are preceded by three A1
+// bytes with a missing clock bit; FM marks are written with the clock pattern
+// C7 instead of FF.
+const (
+	mfmSyncWord = 0x4489
+	fmIDAMWord  = 0xf57e
+	fmDAMWord   = 0xf56f
+	fmDDAMWord  = 0xf56a
+)
+
+const (
+	idAddressMark          = 0xfe
+	dataAddressMark        = 0xfb
+	deletedDataAddressMark = 0xf8
+)
+
+// addressMark is an address mark found on a track.
+type addressMark struct {
+	mark byte
+	// dataStart is the index of the cell immediately after the mark.
+	dataStart int
+	// crcSeed is the CRC of all bytes that precede the data but are included in
+	// its checksum, i.e. the sync bytes and the mark itself.
+	crcSeed uint16
+}
+
+// nextAddressMark finds the first address mark beginning at or after cell
+// `start`. It returns false if there are no more on the track.
+func nextAddressMark(stream Bitstream, encoding Encoding, start int) (addressMark, bool) {
+	totalCells := stream.cellCount()
+	shift := uint16(0)
+
+	for i := start; i < totalCells; i++ {
+		shift = shift<<1 | stream.cell(i)
+		if i-start < 15 {
+			continue
+		}
+
+		switch encoding {
+		case EncodingFM:
+			var mark byte
+			switch shift {
+			case fmIDAMWord:
+				mark = idAddressMark
+			case fmDAMWord:
+				mark = dataAddressMark
+			case fmDDAMWord:
+				mark = deletedDataAddressMark
+			default:
+				continue
+			}
+			return addressMark{
+				mark:      mark,
+				dataStart: i + 1,
+				crcSeed:   checksum.CCITT.Checksum([]byte{mark}),
+			}, true
+
+		case EncodingMFM:
+			if shift != mfmSyncWord {
+				continue
+			}
+			// Skip over the rest of the sync bytes to get to the mark.
+			markStart := i + 1
+			for markStart+16 <= totalCells && stream.rawWord(markStart) == mfmSyncWord {
+				markStart += 16
+			}
+			mark, ok := stream.decodeBytes(markStart, 1)
+			if !ok {
+				return addressMark{}, false
+			}
+			return addressMark{
+				mark:      mark[0],
+				dataStart: markStart + 16,
+				crcSeed:   checksum.CCITT.Checksum([]byte{0xa1, 0xa1, 0xa1, mark[0]}),
+			}, true
+		}
+	}
+	return addressMark{}, false
+}
+
+// DecodeTrack returns all sectors on a track with valid ID and data fields, in
+// the order they appear. Sectors with a bad checksum are skipped.
+func DecodeTrack(stream Bitstream, encoding Encoding) ([]Sector, error) {
+	if encoding != EncodingMFM && encoding != EncodingFM {
+		return nil, disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf("unsupported track encoding: %s", encoding))
+	}
+
+	sectors := []Sector{}
+	var currentID []byte
+
+	for position := 0; ; {
+		mark, ok := nextAddressMark(stream, encoding, position)
+		if !ok {
+			break
+		}
+		position = mark.dataStart
+
+		switch mark.mark {
+		case idAddressMark:
+			// Cylinder, head, record, size code, and two CRC bytes.
+			field, ok := stream.decodeBytes(mark.dataStart, 6)
+			if !ok || checksum.CCITT.Update(mark.crcSeed, field) != 0 {
+				currentID = nil
+				continue
+			}
+			currentID = field[:4]
+			position += len(field) * 16
+
+		case dataAddressMark, deletedDataAddressMark:
+			if currentID == nil {
+				// Data field without an ID field, or one with a bad checksum.
+				continue
+			}
+			sectorSize := 128 << (currentID[3] & 0x07)
+			field, ok := stream.decodeBytes(mark.dataStart, sectorSize+2)
+			if ok && checksum.CCITT.Update(mark.crcSeed, field) == 0 {
+				sectors = append(sectors, Sector{
+					Cylinder: currentID[0],
+					Head:     currentID[1],
+					Record:   currentID[2],
+					Deleted:  mark.mark == deletedDataAddressMark,
+					Data:     field[:sectorSize],
+				})
+				position += len(field) * 16
+			}
+			currentID = nil
+		}
+	}
+
+	return sectors, nil
+}
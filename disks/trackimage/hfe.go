@@ -0,0 +1,158 @@
+package trackimage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+// HFESignature is the magic string at the beginning of every HFE file.
+const HFESignature = "HXCPICFE"
+
+// hfeBlockSize is the unit that offsets in HFE files are measured in. Track
+// data is also interleaved in half-blocks, one for each side.
+const hfeBlockSize = 512
+
+// Values of the track encoding field of an HFE header.
+const (
+	hfeEncodingISOIBMMFM = 0x00
+	hfeEncodingAmigaMFM  = 0x01
+	hfeEncodingISOIBMFM  = 0x02
+	hfeEncodingEmuFM     = 0x03
+)
+
+// HFEHeader is the header of an HFE file. Only the fields needed for decoding
+// are included.
+type HFEHeader struct {
+	FormatRevision uint8
+	TotalTracks    uint8
+	TotalSides     uint8
+	TrackEncoding  uint8
+	// BitRate is the data rate, in kbit/s.
+	BitRate uint16
+	RPM     uint16
+	// TrackListOffset is the offset of the track lookup table, in 512-byte
+	// blocks.
+	TrackListOffset uint16
+}
+
+// ReadHFEHeader reads and validates the header of an HFE file.
+func ReadHFEHeader(stream io.ReaderAt) (HFEHeader, error) {
+	raw := make([]byte, 20)
+	_, err := stream.ReadAt(raw, 0)
+	if err != nil {
+		return HFEHeader{}, disko.ErrIOFailed.Wrap(err)
+	}
+
+	if string(raw[:8]) != HFESignature {
+		return HFEHeader{}, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("not an HFE file: bad signature %q", raw[:8]))
+	}
+
+	header := HFEHeader{
+		FormatRevision:  raw[8],
+		TotalTracks:     raw[9],
+		TotalSides:      raw[10],
+		TrackEncoding:   raw[11],
+		BitRate:         binary.LittleEndian.Uint16(raw[12:]),
+		RPM:             binary.LittleEndian.Uint16(raw[14:]),
+		TrackListOffset: binary.LittleEndian.Uint16(raw[18:]),
+	}
+
+	if header.FormatRevision != 0 {
+		return HFEHeader{}, disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf("unsupported HFE format revision %d", header.FormatRevision))
+	} else if header.TotalSides < 1 || header.TotalSides > 2 {
+		return HFEHeader{}, disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf("invalid number of sides in HFE header: %d", header.TotalSides))
+	}
+	return header, nil
+}
+
+// Encoding returns the track encoding given in the header.
+func (header HFEHeader) Encoding() (Encoding, error) {
+	switch header.TrackEncoding {
+	case hfeEncodingISOIBMMFM:
+		return EncodingMFM, nil
+	case hfeEncodingISOIBMFM, hfeEncodingEmuFM:
+		return EncodingFM, nil
+	case hfeEncodingAmigaMFM:
+		return 0, disko.ErrNotSupported.WithMessage(
+			"Amiga MFM track images aren't supported")
+	default:
+		return 0, disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf("unknown HFE track encoding %#02x", header.TrackEncoding))
+	}
+}
+
+// ReadHFETracks reads the bitstreams of all tracks in an HFE file.
+func ReadHFETracks(stream io.ReaderAt) ([]Track, Encoding, error) {
+	header, err := ReadHFEHeader(stream)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	encoding, err := header.Encoding()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Each entry in the track list is a 16-bit offset to the track data (in
+	// blocks) followed by the 16-bit length of the data for both sides.
+	trackList := make([]byte, int(header.TotalTracks)*4)
+	_, err = stream.ReadAt(trackList, int64(header.TrackListOffset)*hfeBlockSize)
+	if err != nil {
+		return nil, 0, disko.ErrIOFailed.Wrap(err)
+	}
+
+	tracks := make([]Track, 0, int(header.TotalTracks)*int(header.TotalSides))
+	for cylinder := uint(0); cylinder < uint(header.TotalTracks); cylinder++ {
+		entry := trackList[cylinder*4:]
+		offset := int64(binary.LittleEndian.Uint16(entry)) * hfeBlockSize
+		length := int(binary.LittleEndian.Uint16(entry[2:]))
+
+		// Round up to a whole number of blocks, since the sides are interleaved
+		// in half-blocks.
+		rawData := make([]byte, (length+hfeBlockSize-1)/hfeBlockSize*hfeBlockSize)
+		_, err = stream.ReadAt(rawData, offset)
+		if err != nil && err != io.EOF {
+			return nil, 0, disko.ErrIOFailed.Wrap(err)
+		}
+
+		sides := deinterleaveHFETrack(rawData, length)
+		for head := uint(0); head < uint(header.TotalSides); head++ {
+			tracks = append(tracks, Track{
+				Cylinder: cylinder,
+				Head:     head,
+				Cells:    Bitstream{Data: sides[head], LSBFirst: true},
+			})
+		}
+	}
+
+	return tracks, encoding, nil
+}
+
+// deinterleaveHFETrack splits the data for a track into the bitstreams for
+// each side. In each 512-byte block, the first 256 bytes belong to side 0 and
+// the rest to side 1. `length` is the number of bytes of data for both sides.
+func deinterleaveHFETrack(rawData []byte, length int) [2][]byte {
+	var sides [2][]byte
+	half := hfeBlockSize / 2
+
+	for blockStart := 0; blockStart < length; blockStart += hfeBlockSize {
+		// The last block may be partial, with each side getting half of what's
+		// left.
+		perSide := half
+		if remaining := (length - blockStart) / 2; remaining < perSide {
+			perSide = remaining
+		}
+
+		for side := 0; side < 2; side++ {
+			start := blockStart + side*half
+			sides[side] = append(sides[side], rawData[start:start+perSide]...)
+		}
+	}
+	return sides
+}
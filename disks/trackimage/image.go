@@ -0,0 +1,207 @@
+package trackimage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/dargueta/disko"
+)
+
+// Track is the recording of one side of one cylinder.
+type Track struct {
+	Cylinder uint
+	Head     uint
+	Cells    Bitstream
+}
+
+// Image is a sector-by-sector image decoded from a track image. Sectors are in
+// the usual order for raw images: by cylinder, then head, then sector number.
+//
+// Image is read-only. To mount it with a driver that needs a writable stream,
+// wrap a copy of [Image.Bytes]; changes won't be written back to the tracks.
+type Image struct {
+	*bytes.Reader
+	data            []byte
+	bytesPerSector  uint
+	sectorsPerTrack uint
+	cylinders       uint
+	heads           uint
+}
+
+// Bytes returns the contents of the entire image. The slice must not be
+// modified.
+func (image *Image) Bytes() []byte {
+	return image.data
+}
+
+// BytesPerSector returns the size of a single sector, in bytes.
+func (image *Image) BytesPerSector() uint {
+	return image.bytesPerSector
+}
+
+// SectorsPerTrack returns the number of sectors in each track.
+func (image *Image) SectorsPerTrack() uint {
+	return image.sectorsPerTrack
+}
+
+// Cylinders returns the number of cylinders in the image.
+func (image *Image) Cylinders() uint {
+	return image.cylinders
+}
+
+// Heads returns the number of heads, or sides, in the image.
+func (image *Image) Heads() uint {
+	return image.heads
+}
+
+// DecodeImage decodes the sectors from all tracks and arranges them into an
+// image. Every track must have the same number of sectors, all of the same
+// size, numbered consecutively. Unformatted tracks and sectors that couldn't be
+// read are errors, since a driver would silently get garbage for them.
+//
+// If a track contains more than one copy of a sector, the first readable one
+// is used.
+func DecodeImage(tracks []Track, encoding Encoding) (*Image, error) {
+	if len(tracks) == 0 {
+		return nil, disko.ErrInvalidArgument.WithMessage("no tracks to decode")
+	}
+
+	image := &Image{}
+	decodedTracks := make(map[[2]uint]map[uint8]Sector, len(tracks))
+	lowestRecord := uint8(0xff)
+	highestRecord := uint8(0)
+
+	for _, track := range tracks {
+		sectors, err := DecodeTrack(track.Cells, encoding)
+		if err != nil {
+			return nil, err
+		}
+
+		byRecord := map[uint8]Sector{}
+		for _, sector := range sectors {
+			if _, exists := byRecord[sector.Record]; exists {
+				continue
+			}
+			byRecord[sector.Record] = sector
+
+			if image.bytesPerSector == 0 {
+				image.bytesPerSector = uint(len(sector.Data))
+			} else if uint(len(sector.Data)) != image.bytesPerSector {
+				return nil, disko.ErrNotSupported.WithMessage(
+					fmt.Sprintf(
+						"cylinder %d head %d: sector %d is %d bytes, expected %d;"+
+							" mixed sector sizes aren't supported",
+						track.Cylinder,
+						track.Head,
+						sector.Record,
+						len(sector.Data),
+						image.bytesPerSector,
+					),
+				)
+			}
+
+			if sector.Record < lowestRecord {
+				lowestRecord = sector.Record
+			}
+			if sector.Record > highestRecord {
+				highestRecord = sector.Record
+			}
+		}
+
+		decodedTracks[[2]uint{track.Cylinder, track.Head}] = byRecord
+		if track.Cylinder+1 > image.cylinders {
+			image.cylinders = track.Cylinder + 1
+		}
+		if track.Head+1 > image.heads {
+			image.heads = track.Head + 1
+		}
+	}
+
+	if image.bytesPerSector == 0 {
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			"no readable sectors found; is the disk formatted?")
+	}
+	image.sectorsPerTrack = uint(highestRecord-lowestRecord) + 1
+
+	image.data = make(
+		[]byte,
+		0,
+		image.cylinders*image.heads*image.sectorsPerTrack*image.bytesPerSector,
+	)
+	for cylinder := uint(0); cylinder < image.cylinders; cylinder++ {
+		for head := uint(0); head < image.heads; head++ {
+			byRecord, ok := decodedTracks[[2]uint{cylinder, head}]
+			if !ok {
+				return nil, disko.ErrIOFailed.WithMessage(
+					fmt.Sprintf("cylinder %d head %d is missing", cylinder, head))
+			}
+
+			missing := []int{}
+			for record := int(lowestRecord); record <= int(highestRecord); record++ {
+				sector, ok := byRecord[uint8(record)]
+				if !ok {
+					missing = append(missing, record)
+					continue
+				}
+				image.data = append(image.data, sector.Data...)
+			}
+
+			if len(missing) > 0 {
+				sort.Ints(missing)
+				return nil, disko.ErrIOFailed.WithMessage(
+					fmt.Sprintf(
+						"cylinder %d head %d: sectors %v are missing or unreadable",
+						cylinder,
+						head,
+						missing,
+					),
+				)
+			}
+		}
+	}
+
+	image.Reader = bytes.NewReader(image.data)
+	return image, nil
+}
+
+// SplitRawTracks splits a raw bitstream dump into tracks. The dump must contain
+// every track in order of cylinder and then head, each taking up exactly
+// `bytesPerTrack` bytes with the first cell in the most significant bit.
+func SplitRawTracks(dump []byte, bytesPerTrack uint, heads uint) ([]Track, error) {
+	if bytesPerTrack == 0 || heads == 0 {
+		return nil, disko.ErrInvalidArgument.WithMessage(
+			"track size and number of heads must be nonzero")
+	} else if uint(len(dump))%bytesPerTrack != 0 {
+		return nil, disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf(
+				"dump size %d isn't a multiple of the track size %d",
+				len(dump),
+				bytesPerTrack,
+			),
+		)
+	}
+
+	totalTracks := uint(len(dump)) / bytesPerTrack
+	tracks := make([]Track, totalTracks)
+	for i := uint(0); i < totalTracks; i++ {
+		tracks[i] = Track{
+			Cylinder: i / heads,
+			Head:     i % heads,
+			Cells: Bitstream{
+				Data: dump[i*bytesPerTrack : (i+1)*bytesPerTrack],
+			},
+		}
+	}
+	return tracks, nil
+}
+
+// OpenHFE decodes an HFE file into a sector image.
+func OpenHFE(stream io.ReaderAt) (*Image, error) {
+	tracks, encoding, err := ReadHFETracks(stream)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeImage(tracks, encoding)
+}
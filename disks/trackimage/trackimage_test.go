@@ -0,0 +1,257 @@
+package trackimage_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks/trackimage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// trackEncoder writes a track the way a floppy controller would format it.
+type trackEncoder struct {
+	encoding trackimage.Encoding
+	cells    []bool
+	lastBit  bool
+}
+
+func (encoder *trackEncoder) writeRaw(word uint16) {
+	for bit := 15; bit >= 0; bit-- {
+		encoder.cells = append(encoder.cells, word&(1<<bit) != 0)
+	}
+	encoder.lastBit = word&1 != 0
+}
+
+func (encoder *trackEncoder) writeBytes(data ...byte) {
+	for _, value := range data {
+		for bit := 7; bit >= 0; bit-- {
+			dataBit := value&(1<<bit) != 0
+			clockBit := true
+			if encoder.encoding == trackimage.EncodingMFM {
+				clockBit = !encoder.lastBit && !dataBit
+			}
+			encoder.cells = append(encoder.cells, clockBit, dataBit)
+			encoder.lastBit = dataBit
+		}
+	}
+}
+
+func (encoder *trackEncoder) writeFill(value byte, count int) {
+	for i := 0; i < count; i++ {
+		encoder.writeBytes(value)
+	}
+}
+
+// crc16 is an independent implementation of CRC-16/CCITT.
+func crc16(data ...byte) []byte {
+	crc := uint16(0xffff)
+	for _, value := range data {
+		for bit := 7; bit >= 0; bit-- {
+			feedback := (crc>>15)&1 != uint16(value>>bit)&1
+			crc <<= 1
+			if feedback {
+				crc ^= 0x1021
+			}
+		}
+	}
+	return []byte{byte(crc >> 8), byte(crc)}
+}
+
+// writeField writes an address mark followed by `data` and its CRC.
+func (encoder *trackEncoder) writeField(mark byte, data []byte) {
+	var crcPrefix []byte
+	if encoder.encoding == trackimage.EncodingMFM {
+		encoder.writeFill(0x00, 12)
+		encoder.writeRaw(0x4489)
+		encoder.writeRaw(0x4489)
+		encoder.writeRaw(0x4489)
+		encoder.writeBytes(mark)
+		crcPrefix = []byte{0xa1, 0xa1, 0xa1, mark}
+	} else {
+		encoder.writeFill(0x00, 6)
+		encoder.writeRaw(map[byte]uint16{0xfe: 0xf57e, 0xfb: 0xf56f, 0xf8: 0xf56a}[mark])
+		crcPrefix = []byte{mark}
+	}
+
+	encoder.writeBytes(data...)
+	encoder.writeBytes(crc16(append(crcPrefix, data...)...)...)
+}
+
+func (encoder *trackEncoder) writeSector(cylinder, head, record byte, data []byte) {
+	sizeCode := byte(0)
+	for 128<<sizeCode < len(data) {
+		sizeCode++
+	}
+	encoder.writeField(0xfe, []byte{cylinder, head, record, sizeCode})
+	encoder.writeFill(0x4e, 22)
+	encoder.writeField(0xfb, data)
+	encoder.writeFill(0x4e, 40)
+}
+
+func (encoder *trackEncoder) pack(lsbFirst bool) []byte {
+	packed := make([]byte, (len(encoder.cells)+7)/8)
+	for i, cell := range encoder.cells {
+		if !cell {
+			continue
+		}
+		if lsbFirst {
+			packed[i/8] |= 1 << (i % 8)
+		} else {
+			packed[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return packed
+}
+
+// encodeTrack formats a track with sectors in interleaved order and returns the
+// cells. `sectors` is indexed by sector number minus one.
+func encodeTrack(
+	encoding trackimage.Encoding, cylinder, head byte, sectors [][]byte, lsbFirst bool,
+) []byte {
+	encoder := &trackEncoder{encoding: encoding}
+	encoder.writeFill(0x4e, 80)
+	for i := range sectors {
+		// Interleave 2:1 so sectors aren't in order on the track.
+		index := (i * 2) % len(sectors)
+		if len(sectors)%2 == 0 && i >= len(sectors)/2 {
+			index++
+		}
+		encoder.writeSector(cylinder, head, byte(index+1), sectors[index])
+	}
+	encoder.writeFill(0x4e, 100)
+	return encoder.pack(lsbFirst)
+}
+
+func randomSectors(count, size int) [][]byte {
+	sectors := make([][]byte, count)
+	for i := range sectors {
+		sectors[i] = make([]byte, size)
+		rand.Read(sectors[i])
+	}
+	return sectors
+}
+
+func TestDecodeTrack__FM(t *testing.T) {
+	sectors := randomSectors(5, 128)
+	cells := encodeTrack(trackimage.EncodingFM, 3, 0, sectors, false)
+
+	decoded, err := trackimage.DecodeTrack(
+		trackimage.Bitstream{Data: cells}, trackimage.EncodingFM)
+	require.NoError(t, err)
+	require.Len(t, decoded, len(sectors))
+
+	for _, sector := range decoded {
+		assert.EqualValues(t, 3, sector.Cylinder)
+		assert.EqualValues(t, 0, sector.Head)
+		assert.Equal(t, sectors[sector.Record-1], sector.Data, "sector %d", sector.Record)
+	}
+}
+
+func TestDecodeTrack__SkipsBadCRC(t *testing.T) {
+	sectors := randomSectors(4, 256)
+	cells := encodeTrack(trackimage.EncodingMFM, 0, 0, sectors, false)
+
+	// Flip some cells in the data field of the first sector on the track. The
+	// gap and ID field before it take up a little under 300 bytes.
+	cells[400] ^= 0x55
+
+	decoded, err := trackimage.DecodeTrack(
+		trackimage.Bitstream{Data: cells}, trackimage.EncodingMFM)
+	require.NoError(t, err)
+	assert.Len(t, decoded, len(sectors)-1, "corrupted sector wasn't skipped")
+}
+
+// buildHFE creates an HFE file from per-side bitstreams, indexed by cylinder
+// and then head.
+func buildHFE(tracks [][2][]byte, encoding byte) []byte {
+	header := make([]byte, 512)
+	copy(header, trackimage.HFESignature)
+	header[9] = byte(len(tracks))
+	header[10] = 2
+	header[11] = encoding
+	binary.LittleEndian.PutUint16(header[12:], 250)
+	binary.LittleEndian.PutUint16(header[14:], 300)
+	binary.LittleEndian.PutUint16(header[18:], 1)
+
+	trackList := make([]byte, 512)
+	file := append(header, trackList...)
+
+	for i, track := range tracks {
+		sideLength := len(track[0])
+		if len(track[1]) > sideLength {
+			sideLength = len(track[1])
+		}
+		sides := [2][]byte{
+			append(bytes.Clone(track[0]), make([]byte, sideLength-len(track[0]))...),
+			append(bytes.Clone(track[1]), make([]byte, sideLength-len(track[1]))...),
+		}
+
+		binary.LittleEndian.PutUint16(trackList[i*4:], uint16(len(file)/512))
+		binary.LittleEndian.PutUint16(trackList[i*4+2:], uint16(sideLength*2))
+
+		for offset := 0; offset < sideLength; offset += 256 {
+			block := make([]byte, 512)
+			copy(block, sides[0][offset:])
+			copy(block[256:], sides[1][offset:])
+			file = append(file, block...)
+		}
+	}
+
+	copy(file[512:], trackList)
+	return file
+}
+
+func TestOpenHFE(t *testing.T) {
+	const cylinders = 3
+	const sectorsPerTrack = 4
+	const bytesPerSector = 256
+
+	expected := []byte{}
+	tracks := make([][2][]byte, cylinders)
+	for cylinder := 0; cylinder < cylinders; cylinder++ {
+		for head := 0; head < 2; head++ {
+			sectors := randomSectors(sectorsPerTrack, bytesPerSector)
+			for _, sector := range sectors {
+				expected = append(expected, sector...)
+			}
+			tracks[cylinder][head] = encodeTrack(
+				trackimage.EncodingMFM, byte(cylinder), byte(head), sectors, true)
+		}
+	}
+
+	image, err := trackimage.OpenHFE(bytes.NewReader(buildHFE(tracks, 0)))
+	require.NoError(t, err)
+
+	assert.EqualValues(t, cylinders, image.Cylinders())
+	assert.EqualValues(t, 2, image.Heads())
+	assert.EqualValues(t, sectorsPerTrack, image.SectorsPerTrack())
+	assert.EqualValues(t, bytesPerSector, image.BytesPerSector())
+	assert.Equal(t, expected, image.Bytes())
+
+	buffer := make([]byte, 10)
+	_, err = image.ReadAt(buffer, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, expected[1000:1010], buffer)
+}
+
+func TestDecodeImage__MissingSector(t *testing.T) {
+	sectors := randomSectors(4, 512)
+	goodTrack := encodeTrack(trackimage.EncodingMFM, 0, 0, sectors, false)
+	badTrack := encodeTrack(trackimage.EncodingMFM, 1, 0, sectors[:3], false)
+
+	tracks, err := trackimage.SplitRawTracks(
+		append(goodTrack, append(badTrack, make([]byte, len(goodTrack)-len(badTrack))...)...),
+		uint(len(goodTrack)),
+		1,
+	)
+	require.NoError(t, err)
+
+	_, err = trackimage.DecodeImage(tracks, trackimage.EncodingMFM)
+	assert.True(t, errors.Is(err, disko.ErrIOFailed), "wrong error: %v", err)
+	assert.ErrorContains(t, err, "[4]")
+}
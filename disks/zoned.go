@@ -0,0 +1,106 @@
+package disks
+
+import (
+	"fmt"
+)
+
+// Zone is a run of consecutive tracks with the same number of sectors.
+type Zone struct {
+	Tracks          uint
+	SectorsPerTrack uint
+}
+
+// ZonedGeometry describes a disk whose tracks don't all have the same number of
+// sectors, such as the zoned recording of Commodore drives, where the outer
+// tracks hold more sectors than the inner ones. The image holds the sectors
+// track by track with nothing between them.
+type ZonedGeometry struct {
+	BytesPerSector uint
+	// FirstTrack is the number of the first track, usually 0 or 1. Sectors on
+	// a track are always numbered from 0.
+	FirstTrack uint
+	// Zones are given from the first track to the last.
+	Zones []Zone
+}
+
+// TotalTracks returns the number of tracks on the disk.
+func (geometry ZonedGeometry) TotalTracks() uint {
+	total := uint(0)
+	for _, zone := range geometry.Zones {
+		total += zone.Tracks
+	}
+	return total
+}
+
+// TotalSectors returns the number of sectors on the disk.
+func (geometry ZonedGeometry) TotalSectors() uint {
+	total := uint(0)
+	for _, zone := range geometry.Zones {
+		total += zone.Tracks * zone.SectorsPerTrack
+	}
+	return total
+}
+
+// Size returns the size of the disk, in bytes.
+func (geometry ZonedGeometry) Size() int64 {
+	return int64(geometry.TotalSectors()) * int64(geometry.BytesPerSector)
+}
+
+// SectorsOnTrack returns the number of sectors on `track`, or 0 if there's no
+// such track.
+func (geometry ZonedGeometry) SectorsOnTrack(track uint) uint {
+	if track < geometry.FirstTrack {
+		return 0
+	}
+
+	remaining := track - geometry.FirstTrack
+	for _, zone := range geometry.Zones {
+		if remaining < zone.Tracks {
+			return zone.SectorsPerTrack
+		}
+		remaining -= zone.Tracks
+	}
+	return 0
+}
+
+// SectorIndex returns the position of a sector among all sectors of the disk,
+// counting from 0.
+func (geometry ZonedGeometry) SectorIndex(track, sector uint) (uint, error) {
+	if track >= geometry.FirstTrack {
+		index := uint(0)
+		remaining := track - geometry.FirstTrack
+		for _, zone := range geometry.Zones {
+			if remaining >= zone.Tracks {
+				index += zone.Tracks * zone.SectorsPerTrack
+				remaining -= zone.Tracks
+				continue
+			}
+
+			if sector >= zone.SectorsPerTrack {
+				return 0, fmt.Errorf(
+					"track %d has %d sectors, so there's no sector %d",
+					track,
+					zone.SectorsPerTrack,
+					sector,
+				)
+			}
+			return index + remaining*zone.SectorsPerTrack + sector, nil
+		}
+	}
+
+	return 0, fmt.Errorf(
+		"track %d is outside the range [%d, %d)",
+		track,
+		geometry.FirstTrack,
+		geometry.FirstTrack+geometry.TotalTracks(),
+	)
+}
+
+// SectorOffset returns the offset of a sector from the beginning of the image.
+func (geometry ZonedGeometry) SectorOffset(track, sector uint) (int64, error) {
+	index, err := geometry.SectorIndex(track, sector)
+	if err != nil {
+		return 0, err
+	}
+	return int64(index) * int64(geometry.BytesPerSector), nil
+}
@@ -0,0 +1,59 @@
+package disks_test
+
+import (
+	"testing"
+
+	"github.com/dargueta/disko/disks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A 35-track Commodore 1541 disk.
+var commodoreGeometry = disks.ZonedGeometry{
+	BytesPerSector: 256,
+	FirstTrack:     1,
+	Zones: []disks.Zone{
+		{Tracks: 17, SectorsPerTrack: 21},
+		{Tracks: 7, SectorsPerTrack: 19},
+		{Tracks: 6, SectorsPerTrack: 18},
+		{Tracks: 5, SectorsPerTrack: 17},
+	},
+}
+
+func TestZonedGeometry__Totals(t *testing.T) {
+	assert.EqualValues(t, 35, commodoreGeometry.TotalTracks())
+	assert.EqualValues(t, 683, commodoreGeometry.TotalSectors())
+	assert.EqualValues(t, 174848, commodoreGeometry.Size())
+
+	assert.EqualValues(t, 0, commodoreGeometry.SectorsOnTrack(0))
+	assert.EqualValues(t, 21, commodoreGeometry.SectorsOnTrack(17))
+	assert.EqualValues(t, 19, commodoreGeometry.SectorsOnTrack(18))
+	assert.EqualValues(t, 17, commodoreGeometry.SectorsOnTrack(35))
+	assert.EqualValues(t, 0, commodoreGeometry.SectorsOnTrack(36))
+}
+
+func TestZonedGeometry__SectorOffset(t *testing.T) {
+	offset, err := commodoreGeometry.SectorOffset(1, 0)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, offset)
+
+	// The directory track of a 1541 disk.
+	offset, err = commodoreGeometry.SectorOffset(18, 0)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0x16500, offset)
+
+	offset, err = commodoreGeometry.SectorOffset(35, 16)
+	require.NoError(t, err)
+	assert.EqualValues(t, 174848-256, offset)
+}
+
+func TestZonedGeometry__OutOfRange(t *testing.T) {
+	_, err := commodoreGeometry.SectorOffset(0, 0)
+	assert.ErrorContains(t, err, "track 0 is outside the range [1, 36)")
+
+	_, err = commodoreGeometry.SectorOffset(36, 0)
+	assert.ErrorContains(t, err, "track 36 is outside the range [1, 36)")
+
+	_, err = commodoreGeometry.SectorOffset(18, 19)
+	assert.ErrorContains(t, err, "track 18 has 19 sectors, so there's no sector 19")
+}
@@ -0,0 +1,676 @@
+package driver
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	posixpath "path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/utilities/pathfilter"
+)
+
+// objectIdentity identifies an object on the file system independently of the
+// paths pointing to it, so that hard links can be detected.
+type objectIdentity struct {
+	deviceID    uint64
+	inodeNumber uint64
+}
+
+// SetExportWorkers sets how many files [BaseDriver.ExportTar] reads at once.
+// This only has an effect if the image was mounted with
+// [disko.MountFlagsShared], since otherwise the driver can't be used from more
+// than one goroutine. The default, 1, reads files one at a time.
+func (driver *BaseDriver) SetExportWorkers(workers int) {
+	driver.exportWorkers = workers
+}
+
+// ExportTar writes the directory tree at `root` to `destination` as a tar
+// archive, with paths relative to `root`. `filter` selects what's included,
+// and may be nil to include everything.
+//
+// Symbolic links are stored as links, not as the objects they point to. Files
+// with more than one hard link are only stored once; later paths to the same
+// object are stored as hard links to the first one exported. File contents
+// are exported as-is, without decompression.
+//
+// On a shared mount, several files are read at once if more than one worker
+// was set with [BaseDriver.SetExportWorkers]. The archive is the same either
+// way: entries are always written in the order [BaseDriver.Walk] visits them.
+// Only small files are read ahead like this; larger ones are copied straight
+// into the archive when their turn comes, so memory use stays bounded.
+func (driver *BaseDriver) ExportTar(
+	root string,
+	filter *pathfilter.Filter,
+	destination io.Writer,
+) error {
+	archive := tar.NewWriter(destination)
+	exported := map[objectIdentity]string{}
+
+	var err error
+	if driver.exportWorkers > 1 && driver.mountFlags.IsShared() {
+		err = driver.exportParallel(archive, exported, root, filter)
+	} else {
+		err = driver.Walk(
+			root,
+			filter,
+			func(path, relPath string, entry disko.DirectoryEntry) error {
+				header, err := driver.exportHeader(exported, path, relPath, entry.Stat())
+				if err != nil {
+					return err
+				}
+				return driver.exportObject(archive, header, path)
+			},
+		)
+	}
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// exportHeader creates the tar header for an object. `exported` maps objects
+// with several hard links to the first path they were exported as, and is
+// updated if this is the first time we've seen the object.
+func (driver *BaseDriver) exportHeader(
+	exported map[objectIdentity]string,
+	path string,
+	relPath string,
+	stat disko.FileStat,
+) (*tar.Header, error) {
+	header := &tar.Header{
+		Name:    relPath,
+		Mode:    int64(stat.ModeFlags.Perm()),
+		Uid:     int(stat.Uid),
+		Gid:     int(stat.Gid),
+		ModTime: stat.LastModified,
+	}
+	if header.ModTime.IsZero() {
+		header.ModTime = time.Unix(0, 0)
+	}
+
+	switch {
+	case stat.IsDir():
+		header.Typeflag = tar.TypeDir
+		header.Name += "/"
+		return header, nil
+	case stat.IsSymlink():
+		target, err := driver.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+		header.Typeflag = tar.TypeSymlink
+		header.Linkname = target
+		return header, nil
+	case !stat.IsFile():
+		return nil, disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf("can't export %q: unsupported object type %s", path, stat.ModeFlags.Type()))
+	}
+
+	if stat.Nlinks > 1 {
+		identity := objectIdentity{deviceID: stat.DeviceID, inodeNumber: stat.InodeNumber}
+		if firstPath, ok := exported[identity]; ok {
+			header.Typeflag = tar.TypeLink
+			header.Linkname = firstPath
+			return header, nil
+		}
+		exported[identity] = relPath
+	}
+
+	header.Typeflag = tar.TypeReg
+	header.Size = stat.Size
+	return header, nil
+}
+
+// exportObject writes `header` to `archive`, followed by the contents of the
+// file at `path` if it's a regular file.
+func (driver *BaseDriver) exportObject(archive *tar.Writer, header *tar.Header, path string) error {
+	err := archive.WriteHeader(header)
+	if err != nil || header.Typeflag != tar.TypeReg {
+		return err
+	}
+
+	file, err := driver.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(archive, &file)
+	return err
+}
+
+// maxExportBufferSize is the largest file [BaseDriver.exportParallel] reads
+// into memory ahead of writing it to the archive.
+const maxExportBufferSize = 1 * disko.MiB
+
+// exportBufferLimit returns the largest file [BaseDriver.exportParallel] reads
+// into memory. This is [maxExportBufferSize], or the limit set with
+// [BaseDriver.SetMaxReadFileSize] if that's smaller.
+func (driver *BaseDriver) exportBufferLimit() int64 {
+	if driver.maxReadFileSize > 0 && driver.maxReadFileSize < maxExportBufferSize {
+		return driver.maxReadFileSize
+	}
+	return maxExportBufferSize
+}
+
+// exportJob is an object being exported by [BaseDriver.exportParallel].
+type exportJob struct {
+	path   string
+	header *tar.Header
+	// data is the contents of the file, if it's a regular file small enough
+	// to be read by a worker. It's only valid once `done` is closed.
+	data []byte
+	// buffered is true if a worker reads the file into `data`. Other regular
+	// files are copied straight into the archive.
+	buffered bool
+	err      error
+	done     chan struct{}
+}
+
+// errExportStopped stops the walk in [BaseDriver.exportParallel] once writing
+// the archive has failed. It's never returned to the caller.
+var errExportStopped = errors.New("export stopped")
+
+// exportParallel does the same thing as the sequential part of
+// [BaseDriver.ExportTar], but reads file contents with a pool of workers.
+//
+// The tree is walked in one goroutine, which creates the headers (including
+// deciding which files are hard links) in order and hands regular files to the
+// workers. Meanwhile, the calling goroutine writes the entries to the archive
+// in the same order, waiting for each file's data as needed. Files larger than
+// [BaseDriver.exportBufferLimit] are skipped by the workers and copied by the
+// calling goroutine instead, so at most 2 * exportWorkers files of at most that
+// size are held in memory at once.
+func (driver *BaseDriver) exportParallel(
+	archive *tar.Writer,
+	exported map[objectIdentity]string,
+	root string,
+	filter *pathfilter.Filter,
+) error {
+	jobs := make(chan *exportJob)
+	ordered := make(chan *exportJob, driver.exportWorkers)
+	stop := make(chan struct{})
+	bufferLimit := driver.exportBufferLimit()
+
+	var workers sync.WaitGroup
+	for i := 0; i < driver.exportWorkers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range jobs {
+				job.data, job.err = driver.readExportedFile(job.path, job.header.Size)
+				close(job.done)
+			}
+		}()
+	}
+
+	walkResult := make(chan error, 1)
+	go func() {
+		defer close(ordered)
+		defer close(jobs)
+
+		walkResult <- driver.Walk(
+			root,
+			filter,
+			func(path, relPath string, entry disko.DirectoryEntry) error {
+				job := &exportJob{path: path, done: make(chan struct{})}
+				job.header, job.err = driver.exportHeader(exported, path, relPath, entry.Stat())
+				job.buffered = job.err == nil &&
+					job.header.Typeflag == tar.TypeReg &&
+					job.header.Size <= bufferLimit
+				if !job.buffered {
+					close(job.done)
+				} else {
+					select {
+					case jobs <- job:
+					case <-stop:
+						return errExportStopped
+					}
+				}
+
+				select {
+				case ordered <- job:
+					return nil
+				case <-stop:
+					return errExportStopped
+				}
+			},
+		)
+	}()
+
+	var err error
+	for job := range ordered {
+		<-job.done
+		err = job.err
+		if err == nil && job.buffered {
+			err = archive.WriteHeader(job.header)
+			if err == nil {
+				_, err = archive.Write(job.data)
+			}
+		} else if err == nil {
+			err = driver.exportObject(archive, job.header, job.path)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if err != nil {
+		// Stop the walk, and wait for the jobs already started to finish.
+		close(stop)
+		for range ordered {
+		}
+	}
+	workers.Wait()
+
+	walkErr := <-walkResult
+	if err != nil {
+		return err
+	}
+	return walkErr
+}
+
+// readExportedFile returns the contents of the file at `path`, which is `size`
+// bytes long. The caller must make sure `size` is small enough to hold in
+// memory.
+func (driver *BaseDriver) readExportedFile(path string, size int64) ([]byte, error) {
+	file, err := driver.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data := make([]byte, size)
+	_, err = io.ReadFull(&file, data)
+	return data, err
+}
+
+// OverwriteFunc decides whether an existing object at `path` should be
+// replaced. If it returns false, the object is left alone and the entry that
+// would have replaced it is skipped. Errors stop the operation.
+type OverwriteFunc func(path string) (bool, error)
+
+// NameMapper renames objects being imported to names the file system can
+// store, such as 8.3 names on FAT.
+type NameMapper interface {
+	// MapName returns the name to give the object named `name` in `directory`,
+	// an absolute path in the image. `exists` returns true if the directory
+	// already has an object with a given name. A mapper must return the same
+	// name every time it's given the same name in the same directory.
+	MapName(directory, name string, exists func(name string) bool) (string, error)
+}
+
+// SetImportNameMapper makes [BaseDriver.ImportTar] and
+// [BaseDriver.PlanImportTar] rename every path component in the archive with
+// `mapper`. Hard link targets are renamed the same way; symbolic link targets
+// are left alone. Pass nil to keep names as they are, which is the default.
+func (driver *BaseDriver) SetImportNameMapper(mapper NameMapper) {
+	driver.importNameMapper = mapper
+}
+
+// mapImportPath renames each component of `path` below `root` with the
+// driver's name mapper. `exists` returns true if there's an object at an
+// absolute path.
+func (driver *BaseDriver) mapImportPath(
+	root string,
+	path string,
+	exists func(absPath string) bool,
+) (string, error) {
+	if driver.importNameMapper == nil {
+		return path, nil
+	}
+
+	relPath := strings.TrimPrefix(strings.TrimPrefix(path, root), "/")
+	mapped := root
+	for _, component := range strings.Split(relPath, "/") {
+		directory := mapped
+		name, err := driver.importNameMapper.MapName(
+			directory,
+			component,
+			func(name string) bool {
+				return exists(posixpath.Join(directory, name))
+			},
+		)
+		if err != nil {
+			return "", err
+		}
+		mapped = posixpath.Join(directory, name)
+	}
+	return mapped, nil
+}
+
+// ImportStats counts the directories [BaseDriver.ImportTar] created and the
+// metadata work it avoided.
+type ImportStats struct {
+	// DirectoriesCreated is the number of directories that didn't already
+	// exist in the image.
+	DirectoriesCreated int
+
+	// LookupsSaved is the number of times the directory an object goes in was
+	// already known to exist, so it didn't have to be looked up in the image.
+	LookupsSaved int
+
+	// MetadataWritesSaved is the number of mode and timestamp updates that
+	// were skipped because they'd have been redundant: objects created with
+	// the right mode, and directories listed in the archive more than once.
+	MetadataWritesSaved int
+}
+
+// ImportTar extracts a tar archive into the directory `root`, which must
+// already exist. Parent directories missing from the archive are created.
+// `filter` selects which entries are extracted, and may be nil to extract
+// everything. Hard links to entries the filter excludes fail.
+//
+// `overwrite` is called for each file or link that already exists. If it's
+// nil, existing objects are always replaced. Directories are merged, not
+// replaced.
+//
+// Symbolic and hard links are recreated as links, so the file system must
+// support them if the archive has any. Modes and modification times are
+// restored where the file system supports them, and ignored otherwise.
+// Device files and other special objects fail with [disko.ErrNotSupported].
+//
+// Directories aren't created until something is put in them, or the end of
+// the archive is reached, and their modes and timestamps are set last so that
+// adding their contents doesn't change them. Directories already known to
+// exist aren't looked up again.
+func (driver *BaseDriver) ImportTar(
+	source io.Reader,
+	root string,
+	filter *pathfilter.Filter,
+	overwrite OverwriteFunc,
+) (ImportStats, error) {
+	run := tarImport{
+		driver:           driver,
+		root:             driver.NormalizePath(root),
+		overwrite:        overwrite,
+		knownDirectories: map[string]struct{}{},
+		createdModes:     map[string]os.FileMode{},
+		directoryHeaders: map[string]*tar.Header{},
+	}
+
+	err := readTarEntries(source, run.root, filter, run.importEntry)
+	if err != nil {
+		return run.stats, err
+	}
+	return run.stats, run.finishDirectories()
+}
+
+// tarImport tracks the state of a [BaseDriver.ImportTar] call.
+type tarImport struct {
+	driver    *BaseDriver
+	root      string
+	overwrite OverwriteFunc
+	stats     ImportStats
+
+	// knownDirectories has the absolute paths of the directories known to
+	// exist.
+	knownDirectories map[string]struct{}
+
+	// createdModes maps the absolute paths of the directories we created to
+	// the modes they were created with.
+	createdModes map[string]os.FileMode
+
+	// directoryHeaders maps the absolute paths of the directories in the
+	// archive to their headers, and directoryOrder lists them in the order
+	// they first appeared.
+	directoryHeaders map[string]*tar.Header
+	directoryOrder   []string
+}
+
+func (run *tarImport) importEntry(archive *tar.Reader, header *tar.Header, path string) error {
+	path, err := run.mapPath(path)
+	if err != nil {
+		return err
+	}
+
+	if header.Typeflag == tar.TypeDir {
+		if _, ok := run.directoryHeaders[path]; ok {
+			// The later entry wins, so we skip the mode and timestamps of the
+			// earlier one.
+			run.stats.MetadataWritesSaved += 2
+		} else {
+			run.directoryOrder = append(run.directoryOrder, path)
+		}
+		run.directoryHeaders[path] = header
+		return nil
+	}
+
+	err = run.ensureDirectory(posixpath.Dir(path))
+	if err != nil {
+		return err
+	}
+	return run.importObject(archive, header, path)
+}
+
+// mapPath renames the components of `path` with the driver's name mapper, if
+// it has one.
+func (run *tarImport) mapPath(path string) (string, error) {
+	return run.driver.mapImportPath(run.root, path, func(absPath string) bool {
+		_, err := run.driver.Lstat(absPath)
+		return err == nil
+	})
+}
+
+// finishDirectories creates the directories in the archive that nothing was
+// put in, then sets the modes and timestamps of all of them. Subdirectories
+// are done before their parents.
+func (run *tarImport) finishDirectories() error {
+	for _, path := range run.directoryOrder {
+		err := run.ensureDirectory(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := len(run.directoryOrder) - 1; i >= 0; i-- {
+		path := run.directoryOrder[i]
+		header := run.directoryHeaders[path]
+		createdMode, created := run.createdModes[path]
+		hasMode := created && createdMode == os.FileMode(header.Mode).Perm()
+		err := run.setMetadata(path, header, hasMode)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureDirectory creates the directory at `absPath` and any missing parents.
+// Directories in the archive are created with the mode in their header. It
+// fails with [disko.ErrNotADirectory] if something other than a directory is
+// already there.
+func (run *tarImport) ensureDirectory(absPath string) error {
+	if _, ok := run.knownDirectories[absPath]; ok {
+		run.stats.LookupsSaved++
+		return nil
+	}
+
+	stat, err := run.driver.Stat(absPath)
+	if err == nil {
+		if !stat.IsDir() {
+			return disko.ErrNotADirectory.WithMessage(absPath)
+		}
+		run.knownDirectories[absPath] = struct{}{}
+		return nil
+	} else if !errors.Is(err, disko.ErrNotFound) {
+		return err
+	}
+
+	err = run.ensureDirectory(posixpath.Dir(absPath))
+	if err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0o755)
+	if header, ok := run.directoryHeaders[absPath]; ok {
+		mode = os.FileMode(header.Mode).Perm()
+	}
+
+	err = run.driver.Mkdir(absPath, mode)
+	if err != nil {
+		return err
+	}
+	run.stats.DirectoriesCreated++
+	run.knownDirectories[absPath] = struct{}{}
+	run.createdModes[absPath] = mode
+	return nil
+}
+
+// readTarEntries calls `entryFn` for each entry in a tar archive that `filter`
+// includes, with the absolute path it would be extracted to under `root`.
+// `entryFn` can read the entry's contents from `archive`.
+func readTarEntries(
+	source io.Reader,
+	root string,
+	filter *pathfilter.Filter,
+	entryFn func(archive *tar.Reader, header *tar.Header, path string) error,
+) error {
+	archive := tar.NewReader(source)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return disko.ErrIOFailed.Wrap(err)
+		}
+
+		// Cleaning the name as an absolute path keeps ".." from escaping
+		// `root`.
+		relPath := posixpath.Clean("/" + header.Name)[1:]
+		if relPath == "" || !filter.Includes(relPath) {
+			continue
+		}
+
+		err = entryFn(archive, header, posixpath.Join(root, relPath))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (run *tarImport) importObject(
+	archive *tar.Reader,
+	header *tar.Header,
+	path string,
+) error {
+	driver := run.driver
+	mode := os.FileMode(header.Mode).Perm()
+	created := false
+
+	switch header.Typeflag {
+	case tar.TypeReg, tar.TypeRegA:
+		file, err := driver.OpenFile(path, disko.O_WRONLY|disko.O_CREATE|disko.O_EXCL, mode)
+		created = err == nil
+		if errors.Is(err, disko.ErrExists) {
+			// A directory can't be replaced by a file, so don't ask.
+			if stat, statErr := driver.Stat(path); statErr == nil && stat.IsDir() {
+				return disko.ErrIsADirectory.WithMessage(path)
+			}
+			replace, overwriteErr := confirmOverwrite(run.overwrite, path)
+			if overwriteErr != nil || !replace {
+				return overwriteErr
+			}
+			file, err = driver.OpenFile(path, disko.O_WRONLY|disko.O_TRUNC, mode)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(&file, archive)
+		closeErr := file.Close()
+		if err != nil {
+			return err
+		} else if closeErr != nil {
+			return closeErr
+		}
+	case tar.TypeSymlink:
+		// If this replaces a directory, anything later in the archive under
+		// this path goes through the link instead.
+		delete(run.knownDirectories, path)
+		return driver.replaceExisting(path, run.overwrite, func() error {
+			return driver.Symlink(header.Linkname, path)
+		})
+	case tar.TypeLink:
+		delete(run.knownDirectories, path)
+		target, err := run.mapPath(posixpath.Join(run.root, posixpath.Clean("/"+header.Linkname)))
+		if err != nil {
+			return err
+		}
+		return driver.replaceExisting(path, run.overwrite, func() error {
+			return driver.Link(target, path)
+		})
+	default:
+		return disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf(
+				"can't import %q: unsupported tar entry type %q",
+				header.Name,
+				header.Typeflag,
+			),
+		)
+	}
+
+	return run.setMetadata(path, header, created)
+}
+
+// setMetadata sets the mode and timestamps of the object at `path` to those in
+// its header. The mode is left alone if `hasMode` is true because the object
+// was created with it.
+func (run *tarImport) setMetadata(path string, header *tar.Header, hasMode bool) error {
+	if hasMode {
+		run.stats.MetadataWritesSaved++
+	} else {
+		err := ignoreUnsupported(run.driver.Chmod(path, os.FileMode(header.Mode).Perm()))
+		if err != nil {
+			return err
+		}
+	}
+	return ignoreUnsupported(run.driver.Chtimes(path, header.AccessTime, header.ModTime))
+}
+
+// confirmOverwrite calls `overwrite` for `path`, or returns true if it's nil.
+func confirmOverwrite(overwrite OverwriteFunc, path string) (bool, error) {
+	if overwrite == nil {
+		return true, nil
+	}
+	return overwrite(path)
+}
+
+// replaceExisting calls `create`, which fails with [disko.ErrExists] if there's
+// already an object at `path`. If it does, `overwrite` decides whether to
+// remove the existing object and try again.
+func (driver *BaseDriver) replaceExisting(
+	path string,
+	overwrite OverwriteFunc,
+	create func() error,
+) error {
+	err := create()
+	if !errors.Is(err, disko.ErrExists) {
+		return err
+	}
+
+	replace, err := confirmOverwrite(overwrite, path)
+	if err != nil || !replace {
+		return err
+	}
+
+	err = driver.Remove(path)
+	if err != nil {
+		return err
+	}
+	return create()
+}
+
+// ignoreUnsupported returns nil if `err` only says that the file system
+// doesn't support an operation.
+func ignoreUnsupported(err error) error {
+	if errors.Is(err, disko.ErrNotSupported) || errors.Is(err, disko.ErrNotImplemented) {
+		return nil
+	}
+	return err
+}
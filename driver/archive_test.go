@@ -0,0 +1,210 @@
+package driver_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/common/shortname"
+	"github.com/dargueta/disko/file_systems/memfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Exporting with several workers on a shared mount must give exactly the same
+// archive as exporting one file at a time. Run with `-race` to detect
+// unsynchronized access.
+func TestExportTar__ParallelMatchesSequential(t *testing.T) {
+	implementation := newTreeForExport(t)
+	fs := driver.New(implementation, disko.MountFlagsAllowRead)
+
+	var sequential bytes.Buffer
+	require.NoError(t, fs.ExportTar("/", nil, &sequential))
+
+	shared := driver.New(implementation, disko.MountFlagsAllowRead|disko.MountFlagsShared)
+	shared.SetExportWorkers(4)
+
+	var parallel bytes.Buffer
+	require.NoError(t, shared.ExportTar("/", nil, &parallel))
+	assert.Equal(t, sequential.Bytes(), parallel.Bytes())
+}
+
+// Files too large to read ahead are copied straight into the archive, which
+// must still come out the same.
+func TestExportTar__ParallelLargeFiles(t *testing.T) {
+	implementation := newTreeForExport(t)
+	fs := driver.New(implementation, disko.MountFlagsAllowRead)
+
+	var sequential bytes.Buffer
+	require.NoError(t, fs.ExportTar("/", nil, &sequential))
+
+	// Half of the files are larger than this.
+	shared := driver.New(implementation, disko.MountFlagsAllowRead|disko.MountFlagsShared)
+	shared.SetExportWorkers(4)
+	shared.SetMaxReadFileSize(700)
+
+	var parallel bytes.Buffer
+	require.NoError(t, shared.ExportTar("/", nil, &parallel))
+	assert.Equal(t, sequential.Bytes(), parallel.Bytes())
+}
+
+// newTreeForExport creates an image with a few directories of files of
+// different sizes, a hard link, and a symbolic link.
+func newTreeForExport(t *testing.T) *memfs.MemoryFS {
+	implementation := memfs.NewMemoryFS(512, 256)
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowAll))
+	fs := driver.New(implementation, disko.MountFlagsAllowAll)
+	for i := 0; i < 5; i++ {
+		directory := fmt.Sprintf("/dir%d", i)
+		require.NoError(t, fs.Mkdir(directory, 0o755))
+		for j := 0; j < 8; j++ {
+			data := bytes.Repeat([]byte{byte(i*8 + j)}, (i*8+j)*37)
+			require.NoError(t, fs.WriteFile(fmt.Sprintf("%s/file%d", directory, j), data, 0o644))
+		}
+	}
+	require.NoError(t, fs.Link("/dir0/file3", "/dir4/link"))
+	require.NoError(t, fs.Symlink("/dir1/file1", "/symlink"))
+	require.NoError(t, fs.Flush())
+	return implementation
+}
+
+// limitedWriter fails once more than `limit` bytes have been written to it.
+type limitedWriter struct {
+	limit int
+}
+
+var errWriterFull = errors.New("writer is full")
+
+func (writer *limitedWriter) Write(data []byte) (int, error) {
+	if len(data) > writer.limit {
+		return 0, errWriterFull
+	}
+	writer.limit -= len(data)
+	return len(data), nil
+}
+
+// If writing the archive fails partway through, the error is returned and the
+// workers are stopped.
+func TestExportTar__ParallelWriteError(t *testing.T) {
+	shared := driver.New(
+		newTreeForExport(t), disko.MountFlagsAllowRead|disko.MountFlagsShared)
+	shared.SetExportWorkers(4)
+
+	err := shared.ExportTar("/", nil, &limitedWriter{limit: 4096})
+	assert.ErrorIs(t, err, errWriterFull)
+
+	err = shared.ExportTar("/missing", nil, &bytes.Buffer{})
+	assert.ErrorIs(t, err, disko.ErrNotFound)
+}
+
+// Directories are created when something is put in them, their timestamps
+// survive having files added to them, and the metadata updates that were
+// avoided are counted.
+func TestImportTar__LazyDirectories(t *testing.T) {
+	implementation := memfs.NewMemoryFS(512, 256)
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowAll))
+	fs := driver.New(implementation, disko.MountFlagsAllowAll)
+
+	modTime := time.Date(1987, 6, 5, 4, 3, 2, 0, time.UTC)
+	var archive bytes.Buffer
+	writer := tar.NewWriter(&archive)
+	writeEntry := func(name string, typeflag byte, mode int64, data string) {
+		require.NoError(t, writer.WriteHeader(&tar.Header{
+			Name:     name,
+			Typeflag: typeflag,
+			Mode:     mode,
+			Size:     int64(len(data)),
+			ModTime:  modTime,
+		}))
+		_, err := writer.Write([]byte(data))
+		require.NoError(t, err)
+	}
+	writeEntry("docs/", tar.TypeDir, 0o700, "")
+	writeEntry("docs/a.txt", tar.TypeReg, 0o644, "first")
+	writeEntry("docs/b.txt", tar.TypeReg, 0o600, "second")
+	writeEntry("docs/", tar.TypeDir, 0o750, "")
+	writeEntry("docs/deep/c.txt", tar.TypeReg, 0o644, "third")
+	writeEntry("empty/", tar.TypeDir, 0o755, "")
+	require.NoError(t, writer.Close())
+
+	stats, err := fs.ImportTar(&archive, "/", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		driver.ImportStats{
+			// docs, docs/deep, and empty.
+			DirectoriesCreated: 3,
+			// docs for b.txt, docs/deep, and again at the end, and the root
+			// directory for empty.
+			LookupsSaved: 4,
+			// The modes of the three files and empty, and the mode and
+			// timestamps of the first docs entry. docs was created before its
+			// mode changed, so it still needs to be set.
+			MetadataWritesSaved: 6,
+		},
+		stats,
+	)
+
+	docs, err := fs.Stat("/docs")
+	require.NoError(t, err)
+	assert.True(t, docs.IsDir())
+	assert.Equal(t, os.FileMode(0o750), docs.ModeFlags.Perm())
+	assert.True(t, modTime.Equal(docs.LastModified), "docs modified at %s", docs.LastModified)
+
+	empty, err := fs.Stat("/empty")
+	require.NoError(t, err)
+	assert.True(t, empty.IsDir())
+
+	data, err := fs.ReadFile("/docs/deep/c.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "third", string(data))
+}
+
+// Every component of a path is renamed by the name mapper, and hard links
+// point to the renamed target.
+func TestImportTar__NameMapper(t *testing.T) {
+	implementation := memfs.NewMemoryFS(512, 256)
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowAll))
+	fs := driver.New(implementation, disko.MountFlagsAllowAll)
+	fs.SetImportNameMapper(shortname.New(shortname.PolicyNumericTail))
+
+	var archive bytes.Buffer
+	writer := tar.NewWriter(&archive)
+	for _, name := range []string{"Documents/longfilename1.txt", "Documents/longfilename2.txt"} {
+		require.NoError(t, writer.WriteHeader(&tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Mode:     0o644,
+			Size:     int64(len(name)),
+		}))
+		_, err := writer.Write([]byte(name))
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.WriteHeader(&tar.Header{
+		Name:     "Documents/hard link",
+		Typeflag: tar.TypeLink,
+		Linkname: "Documents/longfilename2.txt",
+	}))
+	require.NoError(t, writer.Close())
+
+	_, err := fs.ImportTar(&archive, "/", nil, nil)
+	require.NoError(t, err)
+
+	data, err := fs.ReadFile("/DOCUMENT/LONGFILE.TXT")
+	require.NoError(t, err)
+	assert.Equal(t, "Documents/longfilename1.txt", string(data))
+
+	data, err = fs.ReadFile("/DOCUMENT/LONGFI~1.TXT")
+	require.NoError(t, err)
+	assert.Equal(t, "Documents/longfilename2.txt", string(data))
+
+	data, err = fs.ReadFile("/DOCUMENT/HARDLINK")
+	require.NoError(t, err)
+	assert.Equal(t, "Documents/longfilename2.txt", string(data))
+}
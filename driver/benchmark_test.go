@@ -0,0 +1,167 @@
+package driver_test
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/dargueta/disko/file_systems/memfs"
+	diskotest "github.com/dargueta/disko/testing"
+	"github.com/stretchr/testify/require"
+	"github.com/xaionaro-go/bytesextra"
+)
+
+// benchmarkFileSystems gives the implementations the driver is benchmarked
+// over. Each function returns a newly-formatted, mounted file system.
+var benchmarkFileSystems = []struct {
+	name  string
+	newFS func(b *testing.B) *driver.BaseDriver
+}{
+	{name: "MemoryFS", newFS: newBenchmarkMemoryFS},
+	{name: "FAT", newFS: newBenchmarkFAT},
+}
+
+// newBenchmarkMemoryFS creates a 2 MiB in-memory file system.
+func newBenchmarkMemoryFS(b *testing.B) *driver.BaseDriver {
+	implementation := memfs.NewMemoryFS(512, 4096)
+	require.NoError(b, implementation.Mount(disko.MountFlagsAllowAll))
+	return driver.New(implementation, disko.MountFlagsAllowAll)
+}
+
+// newBenchmarkFAT formats a 1.44 MiB FAT12 floppy image in memory.
+func newBenchmarkFAT(b *testing.B) *driver.BaseDriver {
+	const imageSize = 1440 * 1024
+
+	implementation, err := fat.NewDriver(bytesextra.NewReadWriteSeeker(make([]byte, imageSize)))
+	require.NoError(b, err)
+
+	formatter := implementation.(disko.FormatImageImplementer)
+	require.NoError(b, formatter.FormatImage(disks.FormatterSizeOptions{Size: imageSize}))
+	require.NoError(b, implementation.Mount(disko.MountFlagsAllowAll))
+	return driver.New(implementation, disko.MountFlagsAllowAll)
+}
+
+// runFileSystemBenchmark runs `benchmark` once for each implementation in
+// [benchmarkFileSystems].
+func runFileSystemBenchmark(b *testing.B, benchmark func(b *testing.B, fs *driver.BaseDriver)) {
+	for _, implementation := range benchmarkFileSystems {
+		implementation := implementation
+		b.Run(implementation.name, func(b *testing.B) {
+			benchmark(b, implementation.newFS(b))
+		})
+	}
+}
+
+// Read an entire 256 KiB file from beginning to end in 4 KiB chunks.
+func BenchmarkBaseDriver__Read__Sequential(b *testing.B) {
+	runFileSystemBenchmark(b, func(b *testing.B, fs *driver.BaseDriver) {
+		data := diskotest.CreateRandomImage(512, 512, b)
+		require.NoError(b, fs.WriteFile("/DATA.BIN", data, 0o644))
+		buffer := make([]byte, 4096)
+
+		b.SetBytes(int64(len(data)))
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			file, err := fs.Open("/DATA.BIN")
+			if err != nil {
+				b.Fatalf("failed to open file: %s", err)
+			}
+			for {
+				_, err := file.Read(buffer)
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					b.Fatalf("read failed at offset %d: %s", file.Tell(), err)
+				}
+			}
+			file.Close()
+		}
+	})
+}
+
+// Make small reads at random offsets in a 256 KiB file.
+func BenchmarkBaseDriver__ReadAt__Random(b *testing.B) {
+	runFileSystemBenchmark(b, func(b *testing.B, fs *driver.BaseDriver) {
+		data := diskotest.CreateRandomImage(512, 512, b)
+		require.NoError(b, fs.WriteFile("/DATA.BIN", data, 0o644))
+
+		file, err := fs.Open("/DATA.BIN")
+		require.NoError(b, err)
+		defer file.Close()
+
+		buffer := make([]byte, 32)
+		offsets := make([]int64, 4096)
+		for i := range offsets {
+			offsets[i] = rand.Int63n(int64(len(data) - len(buffer)))
+		}
+
+		b.SetBytes(int64(len(offsets) * len(buffer)))
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			for _, offset := range offsets {
+				_, err := file.ReadAt(buffer, offset)
+				if err != nil {
+					b.Fatalf("read of %d bytes at %d failed: %s", len(buffer), offset, err)
+				}
+			}
+		}
+	})
+}
+
+// Create 100 small files in a directory and flush them to the image. Each
+// iteration starts from a freshly-formatted file system.
+func BenchmarkBaseDriver__CreateStorm(b *testing.B) {
+	data := diskotest.CreateRandomImage(100, 1, b)
+
+	for _, implementation := range benchmarkFileSystems {
+		implementation := implementation
+		b.Run(implementation.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				fs := implementation.newFS(b)
+				require.NoError(b, fs.Mkdir("/STORM", 0o755))
+				b.StartTimer()
+
+				for j := 0; j < 100; j++ {
+					err := fs.WriteFile(fmt.Sprintf("/STORM/F%03d.TXT", j), data, 0o644)
+					if err != nil {
+						b.Fatalf("failed to create file %d: %s", j, err)
+					}
+				}
+				err := fs.Flush()
+				if err != nil {
+					b.Fatalf("flush failed: %s", err)
+				}
+			}
+		})
+	}
+}
+
+// List a directory with 100 files in it.
+func BenchmarkBaseDriver__ReadDir(b *testing.B) {
+	runFileSystemBenchmark(b, func(b *testing.B, fs *driver.BaseDriver) {
+		require.NoError(b, fs.Mkdir("/LIST", 0o755))
+		for i := 0; i < 100; i++ {
+			require.NoError(b, fs.WriteFile(fmt.Sprintf("/LIST/F%03d.TXT", i), nil, 0o644))
+		}
+
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			entries, err := fs.ReadDir("/LIST")
+			if err != nil {
+				b.Fatalf("failed to list directory: %s", err)
+			}
+			if len(entries) < 100 {
+				b.Fatalf("expected at least 100 entries, got %d", len(entries))
+			}
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dargueta/disko"
+)
+
+// errFoundObject stops [BaseDriver.Walk] once the object being searched for has
+// been found.
+var errFoundObject = errors.New("found object")
+
+// OpenByID opens a file for reading given the device ID and inode number from
+// its [disko.FileStat]. This lets tools revisit an object found during a scan
+// even if the path it was found at has since changed.
+//
+// If the implementation doesn't implement [disko.ObjectIDImplementer], the
+// entire directory tree is searched for the object, which can be slow.
+func (driver *BaseDriver) OpenByID(deviceID, inodeNumber uint64) (File, error) {
+	object, err := driver.getObjectByID(deviceID, inodeNumber)
+	if err != nil {
+		return File{}, err
+	}
+
+	stat := object.Stat()
+	if !stat.IsFile() {
+		object.Close()
+		return File{}, disko.ErrIsADirectory.WithMessage(object.AbsolutePath())
+	}
+	return NewFileFromObjectHandle(driver, object, disko.O_RDONLY)
+}
+
+// getObjectByID returns a handle to the object with the given device ID and
+// inode number. If the object was found without searching the directory tree,
+// its path is unknown, and a placeholder is used instead.
+func (driver *BaseDriver) getObjectByID(
+	deviceID uint64,
+	inodeNumber uint64,
+) (extObjectHandle, error) {
+	root := driver.implementation.GetRootDirectory()
+	rootStat := root.Stat()
+	if rootStat.DeviceID != deviceID {
+		return nil, disko.ErrNoDevice.WithMessage(
+			fmt.Sprintf(
+				"object is on device %d, but this image is device %d",
+				deviceID,
+				rootStat.DeviceID,
+			),
+		)
+	} else if rootStat.InodeNumber == inodeNumber {
+		return wrapObjectHandle(root, "/"), nil
+	}
+
+	if implementer, ok := driver.implementation.(disko.ObjectIDImplementer); ok {
+		object, err := implementer.GetObjectByID(inodeNumber)
+		if err != nil {
+			return nil, err
+		}
+		return wrapObjectHandle(object, fmt.Sprintf("<inode %d>", inodeNumber)), nil
+	}
+
+	var foundPath string
+	err := driver.Walk(
+		"/",
+		nil,
+		func(path, relPath string, entry disko.DirectoryEntry) error {
+			if entry.Stat().InodeNumber == inodeNumber {
+				foundPath = path
+				return errFoundObject
+			}
+			return nil
+		},
+	)
+	if errors.Is(err, errFoundObject) {
+		return driver.getObjectAtPathNoFollow(foundPath)
+	} else if err != nil {
+		return nil, err
+	}
+	return nil, disko.ErrNotFound.WithMessage(
+		fmt.Sprintf("no object with inode number %d", inodeNumber))
+}
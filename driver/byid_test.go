@@ -0,0 +1,57 @@
+package driver_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/memfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMountedMemoryFS(t *testing.T) *driver.BaseDriver {
+	implementation := memfs.NewMemoryFS(512, 64)
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowAll))
+	return driver.New(implementation, disko.MountFlagsAllowAll)
+}
+
+func TestOpenByID__Basic(t *testing.T) {
+	fs := newMountedMemoryFS(t)
+	require.NoError(t, fs.Mkdir("/a", 0o755))
+
+	file, err := fs.OpenFile("/a/file.txt", disko.O_WRONLY|disko.O_CREATE, 0o644)
+	require.NoError(t, err)
+	_, err = file.Write([]byte("contents"))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	stat, err := fs.Lstat("/a/file.txt")
+	require.NoError(t, err)
+
+	file, err = fs.OpenByID(stat.DeviceID, stat.InodeNumber)
+	require.NoError(t, err)
+	defer file.Close()
+
+	data, err := io.ReadAll(&file)
+	require.NoError(t, err)
+	assert.Equal(t, "contents", string(data))
+}
+
+func TestOpenByID__Errors(t *testing.T) {
+	fs := newMountedMemoryFS(t)
+	require.NoError(t, fs.Mkdir("/a", 0o755))
+
+	stat, err := fs.Lstat("/a")
+	require.NoError(t, err)
+
+	_, err = fs.OpenByID(stat.DeviceID, stat.InodeNumber)
+	assert.ErrorIs(t, err, disko.ErrIsADirectory)
+
+	_, err = fs.OpenByID(stat.DeviceID, 9999)
+	assert.ErrorIs(t, err, disko.ErrNotFound)
+
+	_, err = fs.OpenByID(stat.DeviceID+1, stat.InodeNumber)
+	assert.ErrorIs(t, err, disko.ErrNoDevice)
+}
@@ -0,0 +1,294 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	posixpath "path"
+	"strings"
+
+	"github.com/dargueta/disko"
+)
+
+// CopyStats counts what [CopyTree] did.
+type CopyStats struct {
+	FilesCopied        int
+	DirectoriesCreated int
+	SymlinksCreated    int
+	// Skipped is the number of existing objects that the [OverwriteFunc]
+	// decided not to replace.
+	Skipped     int
+	BytesCopied int64
+}
+
+// CopyOptions controls how [CopyTree] copies objects.
+type CopyOptions struct {
+	// Overwrite decides whether to replace files and links that already exist.
+	// It may be nil to always replace them.
+	Overwrite OverwriteFunc
+
+	// PreserveOwnership copies the user and group IDs of each object, if both
+	// file systems have them. It's off by default since IDs from one system
+	// rarely mean anything on another.
+	PreserveOwnership bool
+}
+
+// CopyFile copies the file at `sourcePath` on `source` to `destPath` on
+// `destination`. The two may be mounted with different drivers, or be the same
+// driver. The contents are copied byte for byte, without decompressing them
+// like [BaseDriver.ReadFile] does, since the copy keeps the original's name.
+//
+// If `destPath` already exists, `overwrite` decides whether to replace it; it
+// may be nil to always replace. The permissions and the access and modification
+// times are copied where `destination` supports them.
+//
+// It returns the number of bytes written, and whether the file was copied.
+func CopyFile(
+	destination *BaseDriver,
+	destPath string,
+	source *BaseDriver,
+	sourcePath string,
+	overwrite OverwriteFunc,
+) (int64, bool, error) {
+	sourcePath = source.NormalizePath(sourcePath)
+	destPath = destination.NormalizePath(destPath)
+
+	stat, err := source.Stat(sourcePath)
+	if err != nil {
+		return 0, false, err
+	} else if stat.IsDir() {
+		return 0, false, disko.ErrIsADirectory.WithMessage(sourcePath)
+	} else if !stat.IsFile() {
+		return 0, false, disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf("can't copy %q: unsupported object type %s", sourcePath, stat.ModeFlags.Type()))
+	}
+	if source == destination && sourcePath == destPath {
+		return 0, false, disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("can't copy %q onto itself", sourcePath))
+	}
+
+	mode := stat.ModeFlags.Perm()
+	file, err := destination.OpenFile(destPath, disko.O_WRONLY|disko.O_CREATE|disko.O_EXCL, mode)
+	created := err == nil
+	if errors.Is(err, disko.ErrExists) {
+		replace, overwriteErr := confirmOverwrite(overwrite, destPath)
+		if overwriteErr != nil || !replace {
+			return 0, false, overwriteErr
+		}
+		file, err = destination.OpenFile(destPath, disko.O_WRONLY|disko.O_TRUNC, mode)
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	written, err := copyRawContents(&file, source, sourcePath)
+	closeErr := file.Close()
+	if err != nil {
+		return written, false, err
+	} else if closeErr != nil {
+		return written, false, closeErr
+	}
+
+	if !created {
+		err = ignoreUnsupported(destination.Chmod(destPath, mode))
+		if err != nil {
+			return written, true, err
+		}
+	}
+	err = ignoreUnsupported(destination.Chtimes(destPath, stat.LastAccessed, stat.LastModified))
+	return written, true, err
+}
+
+// copyRawContents copies the contents of the file at `sourcePath` on `source`
+// to `destination` as they're stored, without decompressing them.
+func copyRawContents(destination io.Writer, source *BaseDriver, sourcePath string) (int64, error) {
+	file, err := source.Open(sourcePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return io.Copy(destination, &file)
+}
+
+// CopyTree copies the object at `sourcePath` on `source` to `destPath` on
+// `destination`, like [CopyFile]. If it's a directory, everything in it is
+// copied as well, and `destPath` is created if it doesn't exist. Symbolic links
+// are copied as links, and hard links as separate files.
+//
+// Directories that already exist are merged into. `options.Overwrite` decides
+// whether to replace files and links that already exist, as with [CopyFile].
+// Permissions, timestamps, and with `options.PreserveOwnership` user and group
+// IDs are copied where `destination` supports them, and silently dropped
+// otherwise.
+func CopyTree(
+	destination *BaseDriver,
+	destPath string,
+	source *BaseDriver,
+	sourcePath string,
+	options CopyOptions,
+) (CopyStats, error) {
+	sourcePath = source.NormalizePath(sourcePath)
+	destPath = destination.NormalizePath(destPath)
+	stats := CopyStats{}
+
+	stat, err := source.Lstat(sourcePath)
+	if err != nil {
+		return stats, err
+	}
+	if !stat.IsDir() {
+		return stats, copyObject(destination, destPath, source, sourcePath, stat, options, &stats)
+	}
+
+	if source == destination &&
+		(destPath == sourcePath || strings.HasPrefix(destPath, strings.TrimSuffix(sourcePath, "/")+"/")) {
+		return stats, disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("can't copy %q into itself", sourcePath))
+	}
+
+	// Directory timestamps are set last, since copying things into them
+	// changes them. Children come after their parents, so going backwards sets
+	// them before their parents.
+	type copiedDirectory struct{ source, destination string }
+	directories := []copiedDirectory{{sourcePath, destPath}}
+	err = copyDirectory(destination, destPath, source, sourcePath, stat, options, &stats)
+	if err != nil {
+		return stats, err
+	}
+
+	err = source.Walk(sourcePath, nil, func(path, relPath string, entry disko.DirectoryEntry) error {
+		target := posixpath.Join(destPath, relPath)
+		childStat := entry.Stat()
+		if !childStat.IsDir() || childStat.IsSymlink() {
+			return copyObject(destination, target, source, path, childStat, options, &stats)
+		}
+
+		directories = append(directories, copiedDirectory{path, target})
+		return copyDirectory(destination, target, source, path, childStat, options, &stats)
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	for i := len(directories) - 1; i >= 0; i-- {
+		dirStat, err := source.Stat(directories[i].source)
+		if err != nil {
+			return stats, err
+		}
+		err = ignoreUnsupported(
+			destination.Chtimes(
+				directories[i].destination,
+				dirStat.LastAccessed,
+				dirStat.LastModified,
+			),
+		)
+		if err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// copyDirectory creates the directory `destPath` with the permissions in
+// `stat`, unless it already exists.
+func copyDirectory(
+	destination *BaseDriver,
+	destPath string,
+	source *BaseDriver,
+	sourcePath string,
+	stat disko.FileStat,
+	options CopyOptions,
+	stats *CopyStats,
+) error {
+	err := destination.Mkdir(destPath, stat.ModeFlags.Perm())
+	if err == nil {
+		stats.DirectoriesCreated++
+		return copyOwnership(destination, destPath, source, stat, options)
+	} else if !errors.Is(err, disko.ErrExists) {
+		return err
+	}
+
+	existing, statErr := destination.Stat(destPath)
+	if statErr != nil {
+		return statErr
+	} else if !existing.IsDir() {
+		return disko.ErrNotADirectory.WithMessage(
+			fmt.Sprintf("can't copy directory %q over %q", sourcePath, destPath))
+	}
+	return nil
+}
+
+// copyObject copies a file or symbolic link.
+func copyObject(
+	destination *BaseDriver,
+	destPath string,
+	source *BaseDriver,
+	sourcePath string,
+	stat disko.FileStat,
+	options CopyOptions,
+	stats *CopyStats,
+) error {
+	if !stat.IsSymlink() {
+		written, copied, err := CopyFile(destination, destPath, source, sourcePath, options.Overwrite)
+		stats.BytesCopied += written
+		if err != nil {
+			return err
+		} else if !copied {
+			stats.Skipped++
+			return nil
+		}
+		stats.FilesCopied++
+		return copyOwnership(destination, destPath, source, stat, options)
+	}
+
+	target, err := source.Readlink(sourcePath)
+	if err != nil {
+		return err
+	}
+
+	created := false
+	err = destination.replaceExisting(destPath, options.Overwrite, func() error {
+		err := destination.Symlink(target, destPath)
+		created = err == nil
+		return err
+	})
+	if err != nil {
+		return err
+	} else if !created {
+		stats.Skipped++
+		return nil
+	}
+	stats.SymlinksCreated++
+	return copyOwnership(destination, destPath, source, stat, options)
+}
+
+// copyOwnership gives the object at `destPath` the user and group IDs in
+// `stat`, if `options` asks for it and both file systems have them.
+func copyOwnership(
+	destination *BaseDriver,
+	destPath string,
+	source *BaseDriver,
+	stat disko.FileStat,
+	options CopyOptions,
+) error {
+	if !options.PreserveOwnership {
+		return nil
+	}
+
+	sourceFeatures := source.GetFSFeatures()
+	destFeatures := destination.GetFSFeatures()
+	if !sourceFeatures.HasUserID || !destFeatures.HasUserID {
+		return nil
+	}
+
+	// Chown must be given both IDs, so keep the existing group if either side
+	// doesn't have groups.
+	gid := int(stat.Gid)
+	if !sourceFeatures.HasGroupID || !destFeatures.HasGroupID {
+		existing, err := destination.Lstat(destPath)
+		if err != nil {
+			return err
+		}
+		gid = int(existing.Gid)
+	}
+	return ignoreUnsupported(destination.Lchown(destPath, int(stat.Uid), gid))
+}
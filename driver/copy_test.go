@@ -0,0 +1,174 @@
+package driver_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/memfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCopyTestDriver(t *testing.T) *driver.BaseDriver {
+	implementation := memfs.NewMemoryFS(512, 256)
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowAll))
+	return driver.New(implementation, disko.MountFlagsAllowAll)
+}
+
+// Copying a tree between two images recreates its files, directories, and
+// symbolic links, with their permissions and modification times.
+func TestCopyTree__BetweenImages(t *testing.T) {
+	source := newTreeForExport(t)
+	sourceFS := driver.New(source, disko.MountFlagsAllowRead)
+	destination := newCopyTestDriver(t)
+
+	modTime := time.Date(1985, 4, 3, 2, 1, 0, 0, time.UTC)
+	writable := driver.New(source, disko.MountFlagsAllowAll)
+	require.NoError(t, writable.Chmod("/dir2/file5", 0o600))
+	require.NoError(t, writable.Chtimes("/dir2/file5", modTime, modTime))
+	require.NoError(t, writable.Chtimes("/dir2", modTime, modTime))
+
+	stats, err := driver.CopyTree(destination, "/copy", sourceFS, "/", driver.CopyOptions{})
+	require.NoError(t, err)
+	// The hard link is copied as a separate file.
+	assert.Equal(t, 41, stats.FilesCopied)
+	assert.Equal(t, 6, stats.DirectoriesCreated)
+	assert.Equal(t, 1, stats.SymlinksCreated)
+	assert.Zero(t, stats.Skipped)
+
+	for _, path := range []string{"/dir0/file3", "/dir4/link", "/dir3/file7"} {
+		expected, err := sourceFS.ReadFile(path)
+		require.NoError(t, err)
+		actual, err := destination.ReadFile("/copy" + path)
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual, path)
+		stats.BytesCopied -= int64(len(expected))
+	}
+	assert.Positive(t, stats.BytesCopied)
+
+	target, err := destination.Readlink("/copy/symlink")
+	require.NoError(t, err)
+	assert.Equal(t, "/dir1/file1", target)
+
+	stat, err := destination.Stat("/copy/dir2/file5")
+	require.NoError(t, err)
+	assert.Equal(t, "-rw-------", stat.ModeFlags.Perm().String())
+	assert.True(t, modTime.Equal(stat.LastModified), stat.LastModified)
+
+	stat, err = destination.Stat("/copy/dir2")
+	require.NoError(t, err)
+	assert.True(t, modTime.Equal(stat.LastModified), stat.LastModified)
+}
+
+// Existing files are only replaced if the overwrite function says so.
+func TestCopyFile__Overwrite(t *testing.T) {
+	source := newCopyTestDriver(t)
+	destination := newCopyTestDriver(t)
+	require.NoError(t, source.WriteFile("/a.txt", []byte("new contents"), 0o644))
+	require.NoError(t, destination.WriteFile("/a.txt", []byte("old"), 0o644))
+
+	var asked []string
+	refuse := func(path string) (bool, error) {
+		asked = append(asked, path)
+		return false, nil
+	}
+	written, copied, err := driver.CopyFile(destination, "a.txt", source, "/a.txt", refuse)
+	require.NoError(t, err)
+	assert.False(t, copied)
+	assert.Zero(t, written)
+	assert.Equal(t, []string{"/a.txt"}, asked)
+
+	data, err := destination.ReadFile("/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("old"), data)
+
+	written, copied, err = driver.CopyFile(destination, "/a.txt", source, "/a.txt", nil)
+	require.NoError(t, err)
+	assert.True(t, copied)
+	assert.EqualValues(t, 12, written)
+
+	data, err = destination.ReadFile("/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("new contents"), data)
+}
+
+// A directory can be copied elsewhere on the same image, but not into itself.
+func TestCopyTree__SameImage(t *testing.T) {
+	fs := newCopyTestDriver(t)
+	require.NoError(t, fs.Mkdir("/a", 0o755))
+	require.NoError(t, fs.Mkdir("/a/b", 0o755))
+	require.NoError(t, fs.WriteFile("/a/b/c.txt", bytes.Repeat([]byte("x"), 1000), 0o644))
+
+	_, err := driver.CopyTree(fs, "/a/b/copy", fs, "/a", driver.CopyOptions{})
+	assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+	_, _, err = driver.CopyFile(fs, "/a/b/c.txt", fs, "/a/b/c.txt", nil)
+	assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+
+	stats, err := driver.CopyTree(fs, "/a2", fs, "/a", driver.CopyOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, driver.CopyStats{FilesCopied: 1, DirectoriesCreated: 2, BytesCopied: 1000}, stats)
+
+	_, _, err = driver.CopyFile(fs, "/a2", fs, "/a2/b", nil)
+	assert.ErrorIs(t, err, disko.ErrIsADirectory)
+}
+
+// User and group IDs are only copied when asked for.
+func TestCopyTree__PreserveOwnership(t *testing.T) {
+	source := newCopyTestDriver(t)
+	require.NoError(t, source.Mkdir("/dir", 0o755))
+	require.NoError(t, source.WriteFile("/dir/file", []byte("x"), 0o644))
+	require.NoError(t, source.Chown("/dir", 100, 200))
+	require.NoError(t, source.Chown("/dir/file", 101, 201))
+
+	destination := newCopyTestDriver(t)
+	_, err := driver.CopyTree(destination, "/plain", source, "/dir", driver.CopyOptions{})
+	require.NoError(t, err)
+	stat, err := destination.Stat("/plain/file")
+	require.NoError(t, err)
+	assert.Zero(t, stat.Uid)
+
+	options := driver.CopyOptions{PreserveOwnership: true}
+	_, err = driver.CopyTree(destination, "/owned", source, "/dir", options)
+	require.NoError(t, err)
+
+	stat, err = destination.Stat("/owned")
+	require.NoError(t, err)
+	assert.EqualValues(t, 100, stat.Uid)
+	assert.EqualValues(t, 200, stat.Gid)
+
+	stat, err = destination.Stat("/owned/file")
+	require.NoError(t, err)
+	assert.EqualValues(t, 101, stat.Uid)
+	assert.EqualValues(t, 201, stat.Gid)
+}
+
+// Copies are byte for byte, even though the source decompresses files when
+// reading them, since the copy keeps the compressed file's name.
+func TestCopyFile__CompressedFileIsCopiedAsIs(t *testing.T) {
+	implementation := memfs.NewMemoryFS(512, 256)
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowAll))
+	compressed := gzipped(t, bytes.Repeat([]byte("squeeze me "), 100))
+	require.NoError(
+		t,
+		driver.New(implementation, disko.MountFlagsAllowAll).
+			WriteFile("/data.gz", compressed, 0o644),
+	)
+
+	source := driver.New(implementation, disko.MountFlagsAllowRead)
+	destination := newCopyTestDriver(t)
+	written, copied, err := driver.CopyFile(destination, "/data.gz", source, "/data.gz", nil)
+	require.NoError(t, err)
+	assert.True(t, copied)
+	assert.EqualValues(t, len(compressed), written)
+
+	file, err := destination.Open("/data.gz")
+	require.NoError(t, err)
+	defer file.Close()
+	contents, err := io.ReadAll(&file)
+	require.NoError(t, err)
+	assert.Equal(t, compressed, contents)
+}
@@ -0,0 +1,162 @@
+package driver
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	posixpath "path"
+	"strings"
+	"sync"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/utilities/compression"
+)
+
+// DecompressionFilter transparently decompresses files that a file system
+// stores in a compressed format, such as members of an archive or files
+// squeezed with SQ.
+type DecompressionFilter struct {
+	// Name is a short, unique identifier for the filter, e.g. "sq".
+	Name string
+
+	// Magic is the bytes a compressed file begins with. Optional, but if not
+	// given then Extensions must be.
+	Magic []byte
+
+	// Extensions is a list of patterns in the syntax of [path.Match] that the
+	// file's extension (without the leading period) must match one of, e.g.
+	// "?q?" for squeezed files. Matching is case-insensitive. Optional, but if
+	// not given then Magic must be.
+	Extensions []string
+
+	// Decompress decompresses the entire contents of a file.
+	Decompress func(input io.Reader, output io.Writer) (int64, error)
+}
+
+// Matches determines if a file with the given name and contents should be
+// decompressed with this filter.
+func (filter *DecompressionFilter) Matches(name string, data []byte) bool {
+	if len(filter.Magic) > 0 && !bytes.HasPrefix(data, filter.Magic) {
+		return false
+	}
+	if len(filter.Extensions) == 0 {
+		return true
+	}
+
+	extension := strings.ToLower(strings.TrimPrefix(posixpath.Ext(name), "."))
+	for _, pattern := range filter.Extensions {
+		matched, err := posixpath.Match(strings.ToLower(pattern), extension)
+		if err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+var decompressionFiltersLock sync.RWMutex
+var decompressionFilters []DecompressionFilter
+
+// RegisterDecompressionFilter makes a filter available to
+// [BaseDriver.ReadFile]. Filters are tried in the order they're registered. It
+// panics if the filter has no name, magic number, or extensions, or if a filter
+// with the same name is already registered.
+func RegisterDecompressionFilter(filter DecompressionFilter) {
+	if filter.Name == "" || filter.Decompress == nil {
+		panic("decompression filter must have a name and a decompression function")
+	}
+	if len(filter.Magic) == 0 && len(filter.Extensions) == 0 {
+		panic(
+			fmt.Sprintf(
+				"decompression filter %q must have a magic number or extensions",
+				filter.Name,
+			),
+		)
+	}
+
+	decompressionFiltersLock.Lock()
+	defer decompressionFiltersLock.Unlock()
+
+	for _, existing := range decompressionFilters {
+		if existing.Name == filter.Name {
+			panic(fmt.Sprintf("decompression filter %q is already registered", filter.Name))
+		}
+	}
+	decompressionFilters = append(decompressionFilters, filter)
+}
+
+// FindDecompressionFilter returns the first registered filter that matches a
+// file with the given name and contents.
+func FindDecompressionFilter(name string, data []byte) (DecompressionFilter, bool) {
+	decompressionFiltersLock.RLock()
+	defer decompressionFiltersLock.RUnlock()
+
+	for _, filter := range decompressionFilters {
+		if filter.Matches(name, data) {
+			return filter, true
+		}
+	}
+	return DecompressionFilter{}, false
+}
+
+// maxMagicLength is the number of bytes read from the beginning of a file to
+// find a decompression filter that matches it. Magic numbers longer than this
+// never match.
+const maxMagicLength = 16
+
+// copyDecompressed copies a file from `input` to `output`, running it through
+// the first decompression filter that matches it. Files no filter matches are
+// copied unmodified.
+func copyDecompressed(path string, input io.Reader, output io.Writer) (int64, error) {
+	buffered := bufio.NewReader(input)
+	header, err := buffered.Peek(maxMagicLength)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return 0, err
+	}
+
+	filter, found := FindDecompressionFilter(path, header)
+	if !found {
+		return io.Copy(output, buffered)
+	}
+
+	written, err := filter.Decompress(buffered, output)
+	if err != nil {
+		if errors.Is(err, disko.ErrFileTooLarge) {
+			return written, err
+		}
+		return written, disko.ErrIOFailed.WithMessage(
+			fmt.Sprintf("failed to decompress %q with %s: %s", path, filter.Name, err.Error()),
+		)
+	}
+	return written, nil
+}
+
+func decompressGzip(input io.Reader, output io.Writer) (int64, error) {
+	reader, err := gzip.NewReader(input)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	return io.Copy(output, reader)
+}
+
+func init() {
+	RegisterDecompressionFilter(
+		DecompressionFilter{
+			Name:       "sq",
+			Magic:      compression.SqueezeMagic,
+			Extensions: []string{"?q?"},
+			Decompress: compression.DecompressSqueezed,
+		},
+	)
+	RegisterDecompressionFilter(
+		DecompressionFilter{
+			Name:       "gzip",
+			Magic:      []byte{0x1f, 0x8b},
+			Extensions: []string{"gz", "?gz"},
+			Decompress: decompressGzip,
+		},
+	)
+}
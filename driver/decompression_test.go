@@ -0,0 +1,45 @@
+package driver_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/memfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gzipped returns `data` compressed with gzip.
+func gzipped(t *testing.T, data []byte) []byte {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	_, err := writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buffer.Bytes()
+}
+
+// Files are decompressed unless the image was mounted with
+// MountFlagsNoDecompression.
+func TestReadFile__DecompressionIsDefault(t *testing.T) {
+	implementation := memfs.NewMemoryFS(512, 256)
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowAll))
+
+	original := []byte("the quick brown fox jumps over the lazy dog")
+	compressed := gzipped(t, original)
+	writable := driver.New(implementation, disko.MountFlagsAllowAll)
+	require.NoError(t, writable.WriteFile("/fox.txt.gz", compressed, 0o644))
+
+	contents, err := writable.ReadFile("/fox.txt.gz")
+	require.NoError(t, err)
+	assert.Equal(t, original, contents)
+
+	raw := driver.New(
+		implementation, disko.MountFlagsAllowRead|disko.MountFlagsNoDecompression)
+	contents, err = raw.ReadFile("/fox.txt.gz")
+	require.NoError(t, err)
+	assert.Equal(t, compressed, contents)
+}
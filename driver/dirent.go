@@ -14,12 +14,19 @@ type DirectoryEntry struct {
 	name string
 	// stat is a copy of the file's status information.
 	stat disko.FileStat
+	// handle is the handle the entry was created from, for
+	// [BaseDriver.SameFile].
+	handle disko.ObjectHandle
+	// owner is the driver the entry was found on, or nil if it wasn't created
+	// by a [BaseDriver].
+	owner *BaseDriver
 }
 
 func NewDirectoryEntryFromHandle(object disko.ObjectHandle) DirectoryEntry {
 	return DirectoryEntry{
-		name: object.Name(),
-		stat: object.Stat(),
+		name:   object.Name(),
+		stat:   object.Stat(),
+		handle: object,
 	}
 }
 
@@ -54,3 +61,11 @@ func (dirent DirectoryEntry) ModTime() time.Time {
 func (dirent DirectoryEntry) Sys() any {
 	return dirent.stat
 }
+
+func (dirent DirectoryEntry) Stat() disko.FileStat {
+	return dirent.stat
+}
+
+func (dirent DirectoryEntry) identity() (*BaseDriver, disko.ObjectHandle) {
+	return dirent.owner, dirent.handle
+}
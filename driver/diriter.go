@@ -0,0 +1,85 @@
+package driver
+
+import (
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+// sliceDirIterator is a [disko.DirIterator] over names that have already been
+// loaded into memory. It's used for implementations that only support
+// [disko.SupportsListDirHandle].
+type sliceDirIterator struct {
+	names []string
+}
+
+func (iter *sliceDirIterator) Next() (string, error) {
+	if len(iter.names) == 0 {
+		return "", io.EOF
+	}
+	name := iter.names[0]
+	iter.names = iter.names[1:]
+	return name, nil
+}
+
+func (iter *sliceDirIterator) Close() disko.DriverError {
+	iter.names = nil
+	return nil
+}
+
+// openDirIter returns an iterator over the entries of a directory, using the
+// implementation's iterator if it has one, or falling back to
+// [disko.SupportsListDirHandle.ListDir] if not.
+func openDirIter(directory disko.ObjectHandle) (disko.DirIterator, disko.DriverError) {
+	directory = unwrapObjectHandle(directory)
+	if iterHandle, ok := directory.(disko.SupportsDirIterHandle); ok {
+		return iterHandle.OpenDirIter()
+	}
+
+	listHandle, ok := directory.(disko.SupportsListDirHandle)
+	if !ok {
+		return nil, disko.ErrNotSupported.WithMessage(
+			"implementation can't list the contents of directories")
+	}
+
+	names, err := listHandle.ListDir()
+	if err != nil {
+		return nil, err
+	}
+	return &sliceDirIterator{names: names}, nil
+}
+
+// nextDirEntryName returns the name of the next entry from an iterator,
+// skipping "." and "..".
+func nextDirEntryName(iter disko.DirIterator) (string, error) {
+	for {
+		name, err := iter.Next()
+		if err != nil {
+			return "", err
+		}
+		if name != "." && name != ".." {
+			return name, nil
+		}
+	}
+}
+
+// listDirNames returns the names of all entries in a directory, excluding "."
+// and "..".
+func listDirNames(directory disko.ObjectHandle) ([]string, error) {
+	iter, err := openDirIter(directory)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	names := []string{}
+	for {
+		name, err := nextDirEntryName(iter)
+		if err == io.EOF {
+			return names, nil
+		} else if err != nil {
+			return names, err
+		}
+		names = append(names, name)
+	}
+}
@@ -1,14 +1,18 @@
 package driver
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	posixpath "path"
 	"path/filepath"
 	"time"
 
 	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/common/basicstream"
+	"github.com/dargueta/disko/file_systems/memfs"
 )
 
 // BaseDriver is an abstraction layer for all file system implementations,
@@ -20,18 +24,252 @@ type BaseDriver struct {
 	implementation disko.FileSystemImplementer
 	mountFlags     disko.MountFlags
 	workingDirPath string
+	clock          disko.Clock
+	// maxReadFileSize is the largest file [BaseDriver.ReadFile] will return.
+	// 0 means there's no limit.
+	maxReadFileSize int64
+	// openWritableFiles holds the streams of all files currently open for
+	// writing, so that [BaseDriver.Flush] can write out their data before the
+	// file system's metadata.
+	openWritableFiles map[*basicstream.BasicStream]struct{}
+	// writeVerifyRetries is the number of times a block is rewritten if it
+	// doesn't match when read back. Only used with [disko.MountFlagsVerifyWrites].
+	writeVerifyRetries uint
+	// exportWorkers is the number of files [BaseDriver.ExportTar] reads at once
+	// on a shared mount. 0 and 1 both mean one at a time.
+	exportWorkers int
+	// importNameMapper renames objects imported by [BaseDriver.ImportTar], or
+	// is nil to keep their names.
+	importNameMapper NameMapper
+	// tempDir holds the contents of the temporary directory, if it's enabled.
+	// See [BaseDriver.EnableTempDirectory].
+	tempDir *memfs.MemoryFS
+	// subscriptions are the listeners registered with [BaseDriver.Subscribe].
+	subscriptions      []changeSubscription
+	nextSubscriptionID int
 }
 
+// MaxMetadataReadSize is the largest object the driver will load into memory
+// for its own use, such as the target of a symbolic link.
+const MaxMetadataReadSize = 64 * disko.KiB
+
 // New creates a new [BaseDriver] from the given implementation.
+//
+// If `mountFlags` includes [disko.MountFlagsShared], all write-related
+// permissions are removed, and the returned driver can be used by multiple
+// goroutines at once so long as none of them call [BaseDriver.Chdir].
 func New(
 	impl disko.FileSystemImplementer,
 	mountFlags disko.MountFlags,
 ) *BaseDriver {
+	if mountFlags.IsShared() {
+		mountFlags &^= disko.MountFlagsAllowWrite |
+			disko.MountFlagsAllowInsert |
+			disko.MountFlagsAllowDelete |
+			disko.MountFlagsAllowAdminister
+	}
+
 	return &BaseDriver{
-		implementation: impl,
-		mountFlags:     mountFlags,
-		workingDirPath: "/",
+		implementation:     impl,
+		mountFlags:         mountFlags,
+		workingDirPath:     "/",
+		clock:              disko.SystemClock{},
+		openWritableFiles:  map[*basicstream.BasicStream]struct{}{},
+		writeVerifyRetries: DefaultWriteVerifyRetries,
+	}
+}
+
+// SetClock changes where the driver gets the current time from when it sets
+// timestamps. If the implementation is a [disko.ClockImplementer], its clock is
+// changed as well.
+func (driver *BaseDriver) SetClock(clock disko.Clock) {
+	driver.clock = clock
+	if clockImpl, ok := driver.implementation.(disko.ClockImplementer); ok {
+		clockImpl.SetClock(clock)
+	}
+}
+
+// GetAllocator returns the allocator for the free space map of the file system,
+// if the implementation exposes one.
+func (driver *BaseDriver) GetAllocator() (disko.Allocator, error) {
+	allocImpl, ok := driver.implementation.(disko.AllocatorImplementer)
+	if !ok {
+		return nil, disko.ErrNotSupported
+	}
+	return allocImpl.GetAllocator(), nil
+}
+
+// GrowImage enlarges the file system to `newTotalBlocks` blocks, extending the
+// image as needed. The image must be mounted with administrative permissions.
+//
+// This fails with [disko.ErrNotSupported] if the implementation isn't a
+// [disko.GrowImplementer].
+func (driver *BaseDriver) GrowImage(newTotalBlocks uint64) error {
+	grower, ok := driver.implementation.(disko.GrowImplementer)
+	if !ok {
+		return disko.ErrNotSupported
+	}
+
+	if driver.mountFlags&disko.MountFlagsAllowAdminister == 0 {
+		return disko.ErrReadOnlyFileSystem.WithMessage(
+			"can't grow image: not mounted with administrative permissions",
+		)
+	}
+
+	totalBlocks := driver.implementation.FSStat().TotalBlocks
+	if newTotalBlocks <= totalBlocks {
+		return disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf(
+				"can't grow image from %d blocks to %d: new size must be larger",
+				totalBlocks,
+				newTotalBlocks,
+			),
+		)
+	}
+
+	maxBlocks := driver.implementation.GetFSFeatures().MaxTotalBlocks
+	if maxBlocks > 0 && newTotalBlocks > uint64(maxBlocks) {
+		return disko.ErrArgumentOutOfRange.WithMessage(
+			fmt.Sprintf(
+				"can't grow image to %d blocks: file system allows at most %d",
+				newTotalBlocks,
+				maxBlocks,
+			),
+		)
+	}
+
+	err := driver.syncOpenFiles()
+	if err != nil {
+		return err
+	}
+	return grower.GrowImage(newTotalBlocks)
+}
+
+// MountWarnings returns the features of the image the implementation ignored
+// because it was mounted with [disko.MountFlagsLenient]. It's always empty if
+// the implementation isn't a [disko.MountWarningsImplementer].
+func (driver *BaseDriver) MountWarnings() []disko.MountWarning {
+	warningsImpl, ok := driver.implementation.(disko.MountWarningsImplementer)
+	if !ok {
+		return nil
+	}
+	return warningsImpl.MountWarnings()
+}
+
+// Diagnostics returns everything the implementation worked around since the
+// image was mounted without failing the operation: the [MountWarnings] first,
+// as [disko.DiagnosticIgnoredFeature], followed by the diagnostics of the
+// implementation if it's a [disko.DiagnosticsImplementer].
+func (driver *BaseDriver) Diagnostics() []disko.Diagnostic {
+	diagnostics := []disko.Diagnostic{}
+	for _, warning := range driver.MountWarnings() {
+		diagnostics = append(
+			diagnostics,
+			disko.Diagnostic{
+				Kind:    disko.DiagnosticIgnoredFeature,
+				Message: warning.String(),
+			},
+		)
+	}
+
+	diagnosticsImpl, ok := driver.implementation.(disko.DiagnosticsImplementer)
+	if ok {
+		diagnostics = append(diagnostics, diagnosticsImpl.Diagnostics()...)
+	}
+	return diagnostics
+}
+
+// ListDeleted returns the deleted objects in the directory at `path` whose
+// directory entries still exist, if the file system keeps them. Directories
+// that were themselves deleted can't be searched this way.
+//
+// This fails with [disko.ErrNotSupported] if the implementation isn't a
+// [disko.DeletedObjectsImplementer].
+func (driver *BaseDriver) ListDeleted(path string) ([]disko.DeletedObject, error) {
+	lister, ok := driver.implementation.(disko.DeletedObjectsImplementer)
+	if !ok {
+		return nil, disko.ErrNotSupported
+	}
+
+	absPath := driver.NormalizePath(path)
+	directory, err := driver.getObjectAtPathFollowingLink(absPath)
+	if err != nil {
+		return nil, err
+	}
+	defer directory.Close()
+
+	stat := directory.Stat()
+	if !stat.IsDir() {
+		return nil, disko.ErrNotADirectory.WithMessage(absPath)
+	}
+	return lister.ListDeletedObjects(directory.Unwrap())
+}
+
+// SetMaxReadFileSize sets the size of the largest file [BaseDriver.ReadFile]
+// will return, to keep it from exhausting memory on large images. Files larger
+// than this can still be read with [BaseDriver.CopyFileTo] or by opening them.
+// 0, the default, means there's no limit. A parallel [BaseDriver.ExportTar]
+// also won't read files larger than this ahead of time.
+func (driver *BaseDriver) SetMaxReadFileSize(limit int64) {
+	driver.maxReadFileSize = limit
+}
+
+// Flush writes out all pending changes to the image. The data of every file
+// open for writing is written out first, followed by the file system's own
+// structures, so that a crash partway through never leaves metadata pointing
+// at blocks whose contents were never written. See
+// [disko.FileSystemImplementer.Flush] for the guarantees implementations make.
+//
+// If writing out a file's data fails, the file system's metadata is left
+// untouched.
+func (driver *BaseDriver) Flush() error {
+	err := driver.syncOpenFiles()
+	if err != nil {
+		return err
+	}
+	return driver.implementation.Flush()
+}
+
+// syncOpenFiles writes out the data of every file open for writing.
+func (driver *BaseDriver) syncOpenFiles() error {
+	for stream := range driver.openWritableFiles {
+		err := stream.Sync()
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// Now returns the current time according to the driver's clock.
+func (driver *BaseDriver) Now() time.Time {
+	return driver.clock.Now()
+}
+
+// stampNewObject sets all timestamps of a newly created object that the file
+// system supports to the current time.
+func (driver *BaseDriver) stampNewObject(object disko.ObjectHandle) disko.DriverError {
+	chtimesObject, ok := unwrapObjectHandle(object).(disko.SupportsChtimesHandle)
+	if !ok {
+		return nil
+	}
+
+	features := driver.implementation.GetFSFeatures()
+	now := driver.clock.Now()
+	timestampIfSupported := func(supported bool) time.Time {
+		if supported {
+			return now
+		}
+		return disko.UndefinedTimestamp
+	}
+
+	return chtimesObject.Chtimes(
+		timestampIfSupported(features.HasCreatedTime),
+		timestampIfSupported(features.HasAccessedTime),
+		timestampIfSupported(features.HasModifiedTime),
+		timestampIfSupported(features.HasChangedTime),
+		disko.UndefinedTimestamp,
+	)
 }
 
 // NormalizePath converts a file path to an absolute path using `/` as the
@@ -69,7 +307,7 @@ func (driver *BaseDriver) resolveSymlink(
 	pathCache[currentPath] = true
 
 	for stat.IsSymlink() {
-		symlinkText, err := driver.getContentsOfObject(object)
+		symlinkText, err := driver.getContentsOfObject(object, MaxMetadataReadSize)
 		object.Close()
 
 		if err != nil {
@@ -121,7 +359,10 @@ func (driver *BaseDriver) resolveSymlink(
 func (driver *BaseDriver) getObjectAtPathNoFollow(
 	path string,
 ) (extObjectHandle, disko.DriverError) {
-	if path == "/" || path == "" {
+	// Callers often pass directories from posixpath.Split(), which keeps the
+	// trailing slash.
+	path = posixpath.Clean("/" + path)
+	if path == "/" {
 		root := driver.implementation.GetRootDirectory()
 		return wrapObjectHandle(root, path), nil
 	}
@@ -174,20 +415,35 @@ func (driver *BaseDriver) getObjectAtPathFollowingLink(
 
 // getContentsOfObject returns the contents of an object as it exists on the
 // file system, regardless of whether it's a file or directory. Symbolic links
-// are not followed.
+// are not followed. It fails with [disko.ErrFileTooLarge] if the object is
+// bigger than `limit` bytes.
+//
+// This is meant for small metadata reads, such as symbolic links. Use
+// [BaseDriver.CopyFileTo] for file contents.
 func (driver *BaseDriver) getContentsOfObject(
 	object extObjectHandle,
+	limit int64,
 ) ([]byte, disko.DriverError) {
+	stat := object.Stat()
+	if stat.Size > limit {
+		return nil, disko.ErrFileTooLarge.WithMessage(
+			fmt.Sprintf(
+				"%q is %d bytes, more than the limit of %d",
+				object.AbsolutePath(),
+				stat.Size,
+				limit,
+			),
+		)
+	}
+
 	handle, err := NewFileFromObjectHandle(driver, object, disko.O_RDONLY)
 	if err != nil {
 		return nil, disko.ErrIOFailed.Wrap(err)
 	}
 	defer handle.Close()
 
-	stat := object.Stat()
 	buffer := make([]byte, int(stat.Size))
-
-	_, readError := handle.Read(buffer)
+	_, readError := io.ReadFull(&handle, buffer)
 	if readError != nil {
 		return nil, disko.ErrIOFailed.Wrap(readError)
 	}
@@ -199,7 +455,7 @@ func (driver *BaseDriver) getContentsOfObject(
 func (driver *BaseDriver) getExtObjectInDir(
 	baseName string, parentObject extObjectHandle,
 ) (extObjectHandle, disko.DriverError) {
-	object, err := driver.implementation.GetObject(baseName, parentObject)
+	object, err := driver.getObject(baseName, parentObject)
 	if err != nil {
 		return nil, err
 	}
@@ -213,16 +469,24 @@ func (driver *BaseDriver) getExtObjectInDir(
 func (driver *BaseDriver) createExtObject(
 	baseName string, parentObject extObjectHandle, perm os.FileMode,
 ) (extObjectHandle, disko.DriverError) {
-	rawObject, err := driver.implementation.CreateObject(
-		baseName,
-		parentObject,
-		perm,
-	)
+	absPath := posixpath.Join(parentObject.AbsolutePath(), baseName)
+	err := driver.checkNewPath(absPath, baseName)
 	if err != nil {
 		return nil, err
 	}
 
-	absPath := posixpath.Join(parentObject.AbsolutePath(), baseName)
+	rawObject, err := driver.createObject(baseName, parentObject, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	err = driver.stampNewObject(rawObject)
+	if err != nil {
+		rawObject.Close()
+		return nil, err
+	}
+	driver.notify(ChangeCreated, absPath)
+
 	object := wrapObjectHandle(rawObject, absPath)
 	return object, nil
 }
@@ -285,6 +549,9 @@ func (driver *BaseDriver) OpenFile(
 		if err != nil {
 			return File{}, err
 		}
+	} else if ioFlags.Create() && ioFlags.Exclusive() {
+		object.Close()
+		return File{}, disko.ErrExists.WithMessage(absPath)
 	}
 
 	stat := object.Stat()
@@ -326,11 +593,16 @@ func (driver *BaseDriver) Chmod(name string, mode os.FileMode) error {
 		return err
 	}
 
-	chmodObject, ok := object.(disko.SupportsChmodHandle)
+	chmodObject, ok := unwrapObjectHandle(object).(disko.SupportsChmodHandle)
 	if !ok {
 		return disko.ErrNotImplemented
 	}
-	return chmodObject.Chmod(mode)
+
+	err = chmodObject.Chmod(mode)
+	if err == nil {
+		driver.notify(ChangeAttributes, absPath)
+	}
+	return err
 }
 
 func (driver *BaseDriver) Chown(name string, uid, gid int) error {
@@ -340,11 +612,16 @@ func (driver *BaseDriver) Chown(name string, uid, gid int) error {
 		return err
 	}
 
-	chmownObject, ok := object.(disko.SupportsChownHandle)
+	chmownObject, ok := unwrapObjectHandle(object).(disko.SupportsChownHandle)
 	if !ok {
 		return disko.ErrNotImplemented
 	}
-	return chmownObject.Chown(uid, gid)
+
+	err = chmownObject.Chown(uid, gid)
+	if err == nil {
+		driver.notify(ChangeAttributes, absPath)
+	}
+	return err
 }
 
 // TODO(dargueta): This differs from [BaseDriver.Chown] only in that it calls
@@ -357,11 +634,53 @@ func (driver *BaseDriver) Lchown(name string, uid, gid int) error {
 		return err
 	}
 
-	chmownObject, ok := object.(disko.SupportsChownHandle)
+	chmownObject, ok := unwrapObjectHandle(object).(disko.SupportsChownHandle)
 	if !ok {
 		return disko.ErrNotImplemented
 	}
-	return chmownObject.Chown(uid, gid)
+
+	err = chmownObject.Chown(uid, gid)
+	if err == nil {
+		driver.notify(ChangeAttributes, absPath)
+	}
+	return err
+}
+
+// ListXattrs returns the names of the extended attributes of the object at
+// `name`, sorted. Objects on file systems without extended attributes have
+// none. See [disko.SupportsXattrHandle].
+func (driver *BaseDriver) ListXattrs(name string) ([]string, error) {
+	absPath := driver.NormalizePath(name)
+	object, err := driver.getObjectAtPathFollowingLink(absPath)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	xattrObject, ok := unwrapObjectHandle(object).(disko.SupportsXattrHandle)
+	if !ok {
+		return []string{}, nil
+	}
+	return xattrObject.ListXattrs()
+}
+
+// GetXattr returns the value of the extended attribute `attribute` of the
+// object at `name`. It fails with [disko.ErrNotFound] if the object doesn't
+// have that attribute.
+func (driver *BaseDriver) GetXattr(name, attribute string) ([]byte, error) {
+	absPath := driver.NormalizePath(name)
+	object, err := driver.getObjectAtPathFollowingLink(absPath)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	xattrObject, ok := unwrapObjectHandle(object).(disko.SupportsXattrHandle)
+	if !ok {
+		return nil, disko.ErrNotFound.WithMessage(
+			fmt.Sprintf("%q has no extended attribute %q", absPath, attribute))
+	}
+	return xattrObject.GetXattr(attribute)
 }
 
 func (driver *BaseDriver) Chtimes(name string, atime time.Time, mtime time.Time) error {
@@ -371,7 +690,7 @@ func (driver *BaseDriver) Chtimes(name string, atime time.Time, mtime time.Time)
 		return err
 	}
 
-	chmownObject, ok := object.(disko.SupportsChtimesHandle)
+	chmownObject, ok := unwrapObjectHandle(object).(disko.SupportsChtimesHandle)
 	if !ok {
 		return disko.ErrNotImplemented
 	}
@@ -388,35 +707,135 @@ func (driver *BaseDriver) Chtimes(name string, atime time.Time, mtime time.Time)
 
 	// This function only supports the standard `os.Chtimes` interface, so we
 	// pass in UndefinedTimestamp for the values that we want to leave alone.
-	return chmownObject.Chtimes(
+	err = chmownObject.Chtimes(
 		disko.UndefinedTimestamp,
 		atime,
 		mtime,
 		disko.UndefinedTimestamp,
 		disko.UndefinedTimestamp,
 	)
+	if err == nil {
+		driver.notify(ChangeAttributes, absPath)
+	}
+	return err
 }
 
 func (driver *BaseDriver) Open(path string) (File, error) {
 	return driver.OpenFile(path, disko.O_RDONLY, 0)
 }
 
+// ReadFile returns the contents of a file. Files stored in a compressed format
+// that a registered [DecompressionFilter] recognizes are decompressed, unless
+// the image was mounted with [disko.MountFlagsNoDecompression].
+//
+// It fails with [disko.ErrFileTooLarge] if the file (after decompression) is
+// larger than the limit set by [BaseDriver.SetMaxReadFileSize].
 func (driver *BaseDriver) ReadFile(path string) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := limitedWriter{writer: &buffer, limit: driver.maxReadFileSize, path: path}
+
+	_, err := driver.CopyFileTo(path, &writer)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// CopyFileTo writes the contents of a file to `destination` without loading all
+// of it into memory, decompressing it the same way [BaseDriver.ReadFile] does.
+// It returns the number of bytes written.
+func (driver *BaseDriver) CopyFileTo(path string, destination io.Writer) (int64, error) {
 	path = driver.NormalizePath(path)
 
 	object, err := driver.getObjectAtPathFollowingLink(path)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	defer object.Close()
 
-	return driver.getContentsOfObject(object)
+	stat := object.Stat()
+	if stat.IsDir() {
+		return 0, disko.ErrIsADirectory.WithMessage(path)
+	}
+
+	handle, openErr := NewFileFromObjectHandle(driver, object, disko.O_RDONLY)
+	if openErr != nil {
+		return 0, openErr
+	}
+	defer handle.Close()
+
+	if !driver.mountFlags.DecompressesFiles() {
+		return io.Copy(destination, &handle)
+	}
+	return copyDecompressed(path, &handle, destination)
+}
+
+// limitedWriter is an [io.Writer] that fails with [disko.ErrFileTooLarge] if
+// more than `limit` bytes are written to it. A limit of 0 means there's no
+// limit.
+type limitedWriter struct {
+	writer  io.Writer
+	limit   int64
+	written int64
+	path    string
+}
+
+func (writer *limitedWriter) Write(data []byte) (int, error) {
+	if writer.limit > 0 && writer.written+int64(len(data)) > writer.limit {
+		return 0, disko.ErrFileTooLarge.WithMessage(
+			fmt.Sprintf("%q is larger than the limit of %d bytes", writer.path, writer.limit),
+		)
+	}
+
+	n, err := writer.writer.Write(data)
+	writer.written += int64(n)
+	return n, err
+}
+
+// identifiedFileInfo is implemented by the [os.FileInfo] values a [BaseDriver]
+// returns, so that [BaseDriver.SameFile] can ask the implementation whether two
+// of them are the same object.
+type identifiedFileInfo interface {
+	// identity returns the driver the object was found on and its handle. The
+	// handle has been closed, but can still be passed to
+	// [disko.ObjectHandle.SameAs].
+	identity() (*BaseDriver, disko.ObjectHandle)
+}
+
+// fileInfoIdentity returns the driver and handle of `info` if it came from a
+// [BaseDriver], or nil for both otherwise.
+func fileInfoIdentity(info os.FileInfo) (*BaseDriver, disko.ObjectHandle) {
+	identified, ok := info.(identifiedFileInfo)
+	if !ok {
+		return nil, nil
+	}
+	return identified.identity()
+}
+
+// sameFileByStat compares the device IDs and inode numbers of `fi1` and `fi2`.
+// Several file systems have no inode numbers and use 0 for every object, so
+// objects with an inode number of 0 are never the same.
+func sameFileByStat(fi1, fi2 os.FileInfo) bool {
+	stat1, ok1 := fi1.Sys().(disko.FileStat)
+	stat2, ok2 := fi2.Sys().(disko.FileStat)
+	return ok1 && ok2 &&
+		stat1.DeviceID == stat2.DeviceID &&
+		stat1.InodeNumber != 0 &&
+		stat1.InodeNumber == stat2.InodeNumber
 }
 
+// SameFile returns true if `fi1` and `fi2` describe the same object. Objects
+// found on this driver are compared by the implementation with
+// [disko.ObjectHandle.SameAs], and are never the same as objects found on any
+// other driver, even one for the same image. Other [os.FileInfo] values are
+// compared by device ID and inode number.
 func (driver *BaseDriver) SameFile(fi1, fi2 os.FileInfo) bool {
-	stat1 := fi1.Sys().(disko.FileStat)
-	stat2 := fi2.Sys().(disko.FileStat)
-	return stat1.InodeNumber == stat2.InodeNumber
+	owner1, handle1 := fileInfoIdentity(fi1)
+	owner2, handle2 := fileInfoIdentity(fi2)
+	if owner1 == nil && owner2 == nil {
+		return sameFileByStat(fi1, fi2)
+	}
+	return owner1 == driver && owner2 == driver && handle1.SameAs(handle2)
 }
 
 func (driver *BaseDriver) Stat(path string) (disko.FileStat, error) {
@@ -447,29 +866,44 @@ func (driver *BaseDriver) ReadDir(path string) ([]disko.DirectoryEntry, error) {
 func (driver *BaseDriver) readDir(
 	directory extObjectHandle,
 ) ([]disko.DirectoryEntry, error) {
-	direntNames, err := directory.(disko.SupportsListDirHandle).ListDir()
+	iter, err := driver.openDirIter(directory)
 	if err != nil {
 		return nil, err
 	}
-
-	output := make([]disko.DirectoryEntry, 0, len(direntNames))
-	for _, name := range direntNames {
-		// Ignore "." and ".." entries if present
-		if name == "." || name == ".." {
-			continue
-		}
-
-		direntObject, err := driver.implementation.GetObject(name, directory)
-		if err != nil {
+	defer iter.Close()
+
+	output := []disko.DirectoryEntry{}
+	for {
+		dirent, err := driver.readNextDirEntry(directory, iter)
+		if err == io.EOF {
+			return output, nil
+		} else if err != nil {
 			return output, err
 		}
-
-		dirent := NewDirectoryEntryFromHandle(direntObject)
 		output = append(output, dirent)
-		direntObject.Close()
 	}
+}
 
-	return output, nil
+// readNextDirEntry gets the next entry from a directory iterator, skipping "."
+// and "..". It returns [io.EOF] when there are no more entries.
+func (driver *BaseDriver) readNextDirEntry(
+	directory extObjectHandle,
+	iter disko.DirIterator,
+) (disko.DirectoryEntry, error) {
+	name, err := nextDirEntryName(iter)
+	if err != nil {
+		return nil, err
+	}
+
+	direntObject, err := driver.getObject(name, directory)
+	if err != nil {
+		return nil, err
+	}
+	defer direntObject.Close()
+
+	entry := NewDirectoryEntryFromHandle(direntObject)
+	entry.owner = driver
+	return entry, nil
 }
 
 func (driver *BaseDriver) Link(oldname, newname string) error {
@@ -495,13 +929,34 @@ func (driver *BaseDriver) Link(oldname, newname string) error {
 	}
 
 	targetParentPath, targetName := posixpath.Split(absNew)
+	err = driver.checkNewPath(absNew, targetName)
+	if err != nil {
+		return err
+	}
+
 	parentHandle, err := driver.getObjectAtPathFollowingLink(targetParentPath)
 	if err != nil {
 		return err
 	}
 
-	_, err = linker.CreateHardLink(oldHandle, parentHandle, targetName)
-	return err
+	if driver.isTempObject(oldHandle) != driver.isTempObject(parentHandle) {
+		return disko.ErrCrossDeviceLink.WithMessage(
+			fmt.Sprintf(
+				"can't link %q to %q: only one is in the temporary directory", absOld, absNew),
+		)
+	} else if driver.isTempObject(oldHandle) {
+		linker = driver.tempDir
+	}
+
+	_, source := driver.implementationFor(oldHandle)
+	_, targetParent := driver.implementationFor(parentHandle)
+	link, err := linker.CreateHardLink(source, targetParent, targetName)
+	if err != nil {
+		return err
+	}
+	link.Close()
+	driver.notify(ChangeCreated, absNew)
+	return nil
 }
 
 func (driver *BaseDriver) Readlink(path string) (string, error) {
@@ -523,13 +978,62 @@ func (driver *BaseDriver) Readlink(path string) (string, error) {
 		)
 	}
 
-	contents, err := driver.getContentsOfObject(object)
+	contents, err := driver.getContentsOfObject(object, MaxMetadataReadSize)
 	if err != nil {
 		return "", err
 	}
 	return string(contents), nil
 }
 
+// Symlink creates a symbolic link at `newname` pointing to `oldname`. The
+// target isn't required to exist.
+func (driver *BaseDriver) Symlink(oldname, newname string) error {
+	if !driver.implementation.GetFSFeatures().HasSymbolicLinks {
+		return disko.ErrNotSupported
+	}
+
+	absPath := driver.NormalizePath(newname)
+	if !driver.mountFlags.CanWrite() {
+		return disko.ErrReadOnlyFileSystem.WithMessage(
+			fmt.Sprintf("can't create %q: image is mounted read-only", absPath),
+		)
+	}
+
+	existing, err := driver.getObjectAtPathNoFollow(absPath)
+	if err == nil {
+		existing.Close()
+		return disko.ErrExists.WithMessage("symlink target already exists: " + absPath)
+	} else if !errors.Is(err, disko.ErrNotFound) {
+		return err
+	}
+
+	parentDir, baseName := posixpath.Split(absPath)
+	parentObject, err := driver.getObjectAtPathFollowingLink(parentDir)
+	if err != nil {
+		return err
+	}
+	defer parentObject.Close()
+
+	object, err := driver.createExtObject(baseName, parentObject, os.ModeSymlink|0o777)
+	if err != nil {
+		return err
+	}
+
+	// The link's target is stored as its contents.
+	handle, openErr := NewFileFromObjectHandle(driver, object, disko.O_WRONLY)
+	if openErr != nil {
+		object.Close()
+		return openErr
+	}
+
+	_, writeErr := handle.WriteString(oldname)
+	closeErr := handle.Close()
+	if writeErr != nil {
+		return writeErr
+	}
+	return closeErr
+}
+
 func (driver *BaseDriver) Lstat(path string) (disko.FileStat, error) {
 	path = driver.NormalizePath(path)
 	object, err := driver.getObjectAtPathNoFollow(path)
@@ -559,37 +1063,11 @@ func (driver *BaseDriver) Create(path string) (File, error) {
 	)
 }
 
-// removeDotsFromSlice returns a copy of `arr`, filtering out "." and "..". If
-// neither are in the slice, it returns `arr` unmodified.
-func removeDotsFromSlice(arr []string) []string {
-	numToIgnore := 0
-
-	for _, element := range arr {
-		if element == "." || element == ".." {
-			numToIgnore++
-		}
-	}
-
-	// If we didn't find . or .. anywhere then don't bother copying the slice,
-	// and return it unmodified.
-	if numToIgnore == 0 {
-		return arr
-	}
-
-	// We found at least one dot string. Create a copy of the slice while skipping
-	// over the things we don't want.
-	newSlice := make([]string, 0, len(arr)-numToIgnore)
-	for _, element := range arr {
-		if element != "." && element != ".." {
-			newSlice = append(newSlice, element)
-		}
-	}
-	return newSlice
-}
-
+// Remove removes a file, empty directory, or symbolic link. Like [os.Remove],
+// symbolic links are removed themselves, not what they point to.
 func (driver *BaseDriver) Remove(path string) error {
 	absPath := driver.NormalizePath(path)
-	object, err := driver.getObjectAtPathFollowingLink(absPath)
+	object, err := driver.getObjectAtPathNoFollow(absPath)
 	if err != nil {
 		return err
 	}
@@ -599,28 +1077,33 @@ func (driver *BaseDriver) Remove(path string) error {
 	if stat.IsDir() {
 		// Caller wants to remove a directory. The directory must be empty, i.e.
 		// must at most only contain the "." and ".." entries.
-		names, err := object.(disko.SupportsListDirHandle).ListDir()
-		if err != nil {
-			return err
+		iter, openErr := openDirIter(object)
+		if openErr != nil {
+			return openErr
 		}
+		_, err := nextDirEntryName(iter)
+		iter.Close()
 
-		// Remove the "." and ".." since we don't care about them.
-		names = removeDotsFromSlice(names)
-
-		// If there are any other entries in here the directory isn't empty and
-		// we must fail.
-		if len(names) > 0 {
+		// If there are any entries other than "." and ".." in here, the
+		// directory isn't empty and we must fail.
+		if err == nil {
 			return disko.ErrDirectoryNotEmpty.WithMessage(
 				fmt.Sprintf("can't remove %q: directory not empty", absPath),
 			)
+		} else if err != io.EOF {
+			return err
 		}
-	} else if !stat.IsFile() {
+	} else if !stat.IsFile() && !stat.IsSymlink() {
 		return disko.ErrInvalidArgument.WithMessage(
-			fmt.Sprintf("can't remove %q: not a file or directory", absPath),
+			fmt.Sprintf("can't remove %q: not a file, directory, or symlink", absPath),
 		)
 	}
 
-	return object.Unlink()
+	err = object.Unlink()
+	if err == nil {
+		driver.notify(ChangeRemoved, absPath)
+	}
+	return err
 }
 
 // Truncate sets the size of a file to 0.
@@ -636,7 +1119,12 @@ func (driver *BaseDriver) Truncate(path string) error {
 	if stat.IsDir() {
 		return disko.ErrIsADirectory.WithMessage(absPath)
 	}
-	return object.Resize(0)
+
+	err = object.Resize(0)
+	if err == nil {
+		driver.notify(ChangeWritten, absPath)
+	}
+	return err
 }
 
 // WriteFile sets the contents of a file to the given data, creating it if
@@ -654,10 +1142,15 @@ func (driver *BaseDriver) WriteFile(
 	if err != nil {
 		return err
 	}
-	defer handle.Close()
 
+	// The data is only written out to the image when the file is closed, so
+	// failing to close it means the write failed.
 	_, err = handle.Write(data)
-	return err
+	closeErr := handle.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
 }
 
 func (driver *BaseDriver) Mkdir(path string, perm os.FileMode) error {
@@ -686,9 +1179,20 @@ func (driver *BaseDriver) Mkdir(path string, perm os.FileMode) error {
 		)
 	}
 
-	object, err := driver.implementation.CreateObject(baseName, parentObject, perm)
+	err = driver.checkNewPath(absPath, baseName)
+	if err != nil {
+		return err
+	}
+
+	object, err := driver.createObject(baseName, parentObject, perm)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	err = driver.stampNewObject(object)
 	if err == nil {
-		object.Close()
+		driver.notify(ChangeCreated, absPath)
 	}
 	return err
 }
@@ -703,20 +1207,33 @@ func (driver *BaseDriver) MkdirAll(path string, perm os.FileMode) error {
 	perm |= os.ModeDir
 
 	parentObject, err := driver.getObjectAtPathFollowingLink(parentDir)
-	if err != nil {
-		if errors.Is(err, disko.ErrNotFound) {
-			// Parent directory doesn't exist, create it.
-			driver.MkdirAll(parentDir, perm)
-		} else {
-			// Different error, we won't handle it.
-			return err
+	if errors.Is(err, disko.ErrNotFound) {
+		// Parent directory doesn't exist, create it.
+		mkdirErr := driver.MkdirAll(parentDir, perm)
+		if mkdirErr != nil {
+			return mkdirErr
 		}
+		parentObject, err = driver.getObjectAtPathFollowingLink(parentDir)
+	}
+	if err != nil {
+		return err
 	}
 	defer parentObject.Close()
 
-	object, err := driver.implementation.CreateObject(baseName, parentObject, perm)
+	err = driver.checkNewPath(absPath, baseName)
+	if err != nil {
+		return err
+	}
+
+	object, err := driver.createObject(baseName, parentObject, perm)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	err = driver.stampNewObject(object)
 	if err == nil {
-		object.Close()
+		driver.notify(ChangeCreated, absPath)
 	}
 	return err
 }
@@ -736,13 +1253,22 @@ func (driver *BaseDriver) RemoveAll(path string) error {
 
 	// Block an attempt at `rm -rf /`, because some clown is gonna try it.
 	root := driver.implementation.GetRootDirectory()
-	if root.SameAs(directory) {
+	if root.SameAs(directory.Unwrap()) {
 		return disko.ErrPermissionDenied.WithMessage(
 			"you can't remove the root directory",
 		)
 	}
 
-	return driver.removeDirectory(directory)
+	rmErr := driver.removeDirectory(directory)
+	if rmErr != nil {
+		return rmErr
+	}
+
+	err = directory.Unlink()
+	if err == nil {
+		driver.notify(ChangeRemoved, path)
+	}
+	return err
 }
 
 // removeDirectory is equivalent to `rm -rf` for a directory handle.
@@ -752,16 +1278,14 @@ func (driver *BaseDriver) RemoveAll(path string) error {
 func (driver *BaseDriver) removeDirectory(directory extObjectHandle) error {
 	var err error
 
-	direntNames, err := directory.(disko.SupportsListDirHandle).ListDir()
+	// Get all the names up front, since we're going to be modifying the
+	// directory as we go.
+	direntNames, err := listDirNames(directory)
 	if err != nil {
 		return err
 	}
 
 	for _, name := range direntNames {
-		if name == "." || name == ".." {
-			continue
-		}
-
 		dirent, err := driver.getExtObjectInDir(name, directory)
 		if err != nil {
 			return err
@@ -771,10 +1295,7 @@ func (driver *BaseDriver) removeDirectory(directory extObjectHandle) error {
 
 		// If this is a directory, recursively delete its contents.
 		if direntStat.IsDir() {
-			absPath := posixpath.Join(directory.AbsolutePath(), name)
-			wrappedDirent := wrapObjectHandle(dirent, absPath)
-
-			rmErr := driver.removeDirectory(wrappedDirent)
+			rmErr := driver.removeDirectory(dirent)
 			if rmErr != nil {
 				dirent.Close()
 				return rmErr
@@ -787,6 +1308,7 @@ func (driver *BaseDriver) removeDirectory(directory extObjectHandle) error {
 		if err != nil {
 			return err
 		}
+		driver.notify(ChangeRemoved, dirent.AbsolutePath())
 	}
 
 	return nil
@@ -0,0 +1,86 @@
+package driver
+
+// ChangeType is the kind of modification a [ChangeEvent] describes.
+type ChangeType int
+
+const (
+	// ChangeCreated means a file, directory, symbolic link, or hard link was
+	// created.
+	ChangeCreated ChangeType = iota + 1
+
+	// ChangeWritten means the contents or size of a file changed.
+	ChangeWritten
+
+	// ChangeRemoved means an object was removed.
+	ChangeRemoved
+
+	// ChangeAttributes means the mode flags, owner, or timestamps of an object
+	// were changed explicitly.
+	ChangeAttributes
+)
+
+func (changeType ChangeType) String() string {
+	switch changeType {
+	case ChangeCreated:
+		return "created"
+	case ChangeWritten:
+		return "written"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeAttributes:
+		return "attributes"
+	default:
+		return "unknown"
+	}
+}
+
+// ChangeEvent describes a modification made through a [BaseDriver].
+type ChangeEvent struct {
+	Type ChangeType
+	// Path is the absolute path of the object that changed.
+	Path string
+}
+
+// ChangeListener is a function called by [BaseDriver] for every modification.
+type ChangeListener func(event ChangeEvent)
+
+// changeSubscription is a listener registered with [BaseDriver.Subscribe].
+type changeSubscription struct {
+	id       int
+	listener ChangeListener
+}
+
+// Subscribe registers `listener` to be called after every modification made
+// through the driver, so that caches, mirrors, and test harnesses can react to
+// changes without polling. It returns a function that unregisters the listener.
+//
+// Listeners are called synchronously, in the order they were registered, after
+// the change has been made. Writes through a [File] are reported once, when it
+// is closed. Changes made to the image by anything other than the driver aren't
+// reported.
+func (driver *BaseDriver) Subscribe(listener ChangeListener) (unsubscribe func()) {
+	driver.nextSubscriptionID++
+	id := driver.nextSubscriptionID
+	driver.subscriptions = append(
+		driver.subscriptions,
+		changeSubscription{id: id, listener: listener},
+	)
+
+	return func() {
+		for i, subscription := range driver.subscriptions {
+			if subscription.id == id {
+				driver.subscriptions = append(
+					driver.subscriptions[:i:i], driver.subscriptions[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// notify calls every listener registered with [BaseDriver.Subscribe].
+func (driver *BaseDriver) notify(changeType ChangeType, absPath string) {
+	event := ChangeEvent{Type: changeType, Path: absPath}
+	for _, subscription := range driver.subscriptions {
+		subscription.listener(event)
+	}
+}
@@ -0,0 +1,74 @@
+package driver_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribe__Basic(t *testing.T) {
+	fs := newMountedMemoryFS(t)
+	events := []driver.ChangeEvent{}
+	fs.Subscribe(func(event driver.ChangeEvent) {
+		events = append(events, event)
+	})
+
+	require.NoError(t, fs.Mkdir("/dir", 0o755))
+	require.NoError(t, fs.WriteFile("/dir/file", []byte("data"), 0o644))
+	require.NoError(t, fs.Chtimes("/dir/file", time.Now(), time.Now()))
+	require.NoError(t, fs.Link("/dir/file", "/link"))
+	require.NoError(t, fs.Truncate("/link"))
+	require.NoError(t, fs.Remove("/link"))
+	require.NoError(t, fs.RemoveAll("/dir"))
+
+	assert.Equal(
+		t,
+		[]driver.ChangeEvent{
+			{Type: driver.ChangeCreated, Path: "/dir"},
+			{Type: driver.ChangeCreated, Path: "/dir/file"},
+			{Type: driver.ChangeWritten, Path: "/dir/file"},
+			{Type: driver.ChangeAttributes, Path: "/dir/file"},
+			{Type: driver.ChangeCreated, Path: "/link"},
+			{Type: driver.ChangeWritten, Path: "/link"},
+			{Type: driver.ChangeRemoved, Path: "/link"},
+			{Type: driver.ChangeRemoved, Path: "/dir/file"},
+			{Type: driver.ChangeRemoved, Path: "/dir"},
+		},
+		events,
+	)
+}
+
+func TestSubscribe__ReadsAreNotReported(t *testing.T) {
+	fs := newMountedMemoryFS(t)
+	require.NoError(t, fs.WriteFile("/file", []byte("data"), 0o644))
+
+	count := 0
+	fs.Subscribe(func(event driver.ChangeEvent) { count++ })
+
+	_, err := fs.ReadFile("/file")
+	require.NoError(t, err)
+
+	file, err := fs.OpenFile("/file", disko.O_RDWR, 0)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	assert.Zero(t, count, "opening a file for writing without writing to it is not a change")
+}
+
+func TestSubscribe__Unsubscribe(t *testing.T) {
+	fs := newMountedMemoryFS(t)
+	first := 0
+	second := 0
+	unsubscribe := fs.Subscribe(func(event driver.ChangeEvent) { first++ })
+	fs.Subscribe(func(event driver.ChangeEvent) { second++ })
+
+	require.NoError(t, fs.Mkdir("/a", 0o755))
+	unsubscribe()
+	require.NoError(t, fs.Mkdir("/b", 0o755))
+
+	assert.Equal(t, 1, first)
+	assert.Equal(t, 2, second)
+}
@@ -0,0 +1,52 @@
+package driver_test
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/memfs"
+)
+
+func ExampleBaseDriver_OpenFile() {
+	// Mount a file system. Real drivers are created from an image with the
+	// New function of their registration; this one lives in memory.
+	implementation := memfs.NewMemoryFS(512, 64)
+	if err := implementation.Mount(disko.MountFlagsAllowAll); err != nil {
+		panic(err)
+	}
+	fs := driver.New(implementation, disko.MountFlagsAllowAll)
+
+	// Create a file and write to it.
+	err := fs.Mkdir("/docs", 0o755)
+	if err != nil {
+		panic(err)
+	}
+	file, err := fs.OpenFile("/docs/hello.txt", disko.O_WRONLY|disko.O_CREATE|disko.O_EXCL, 0o644)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintln(&file, "Hello from inside the image!")
+	file.Close()
+
+	// Read it back.
+	file, err = fs.OpenFile("/docs/hello.txt", disko.O_RDONLY, 0)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+	io.Copy(os.Stdout, &file)
+
+	info, _ := file.Stat()
+	fmt.Printf("%s is %d bytes\n", info.Name(), info.Size())
+
+	// Write out all changes before unmounting.
+	fs.Flush()
+	implementation.Unmount()
+
+	// Output:
+	// Hello from inside the image!
+	// hello.txt is 29 bytes
+}
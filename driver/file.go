@@ -25,6 +25,9 @@ type FileInfo struct {
 
 	// Fields
 	absolutePath string
+	// owner and handle identify the object for [BaseDriver.SameFile].
+	owner  *BaseDriver
+	handle disko.ObjectHandle
 }
 
 // os.FileInfo implementation --------------------------------------------------
@@ -77,6 +80,10 @@ func (info *FileInfo) Stat() disko.FileStat {
 	return info.FileStat
 }
 
+func (info *FileInfo) identity() (*BaseDriver, disko.ObjectHandle) {
+	return info.owner, info.handle
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 
 // File is more or less a drop-in replacement for [os.File]. Unlike [os.File],
@@ -91,8 +98,15 @@ type File struct {
 	fileInfo     FileInfo
 	ioFlags      disko.IOFlags
 
-	lastReadDirResult    []disko.DirectoryEntry
-	readDirResultPointer int
+	// dirIter is the iterator [File.ReadDir] gets entries from. It's nil if
+	// ReadDir hasn't been called yet. Once it's exhausted, dirExhausted is set
+	// and it's kept until the file is closed, so that later calls return no
+	// entries like [os.File.ReadDir] instead of starting over.
+	dirIter      disko.DirIterator
+	dirExhausted bool
+	// modified is set once the file's data or size has been changed, so that
+	// [File.Close] can report it to listeners.
+	modified *bool
 }
 
 // NewFileFromObjectHandle creates a Disko file object that is (more or less) a
@@ -102,17 +116,24 @@ func NewFileFromObjectHandle(
 	object extObjectHandle,
 	ioFlags disko.IOFlags,
 ) (File, error) {
+	modified := new(bool)
 	fetchCb := func(index common.LogicalBlock, buffer []byte) error {
 		return object.ReadBlocks(index, buffer)
 	}
 	flushCb := func(index common.LogicalBlock, buffer []byte) error {
-		return object.WriteBlocks(index, buffer)
+		*modified = true
+		return driver.writeObjectBlocks(object, index, buffer)
 	}
+	stat := object.Stat()
 	resizeCb := func(newSize common.LogicalBlock) error {
-		return object.Resize(uint64(newSize))
+		err := driver.checkFileSize(object, stat.BlockSize, newSize)
+		if err != nil {
+			return err
+		}
+		*modified = true
+		return object.Resize(uint64(newSize) * uint64(stat.BlockSize))
 	}
 
-	stat := object.Stat()
 	blockCache := blockcache.New(
 		uint(stat.BlockSize),
 		uint(stat.NumBlocks),
@@ -121,19 +142,64 @@ func NewFileFromObjectHandle(
 		resizeCb,
 	)
 
+	// Let the implementation read and write runs of blocks in batches if it
+	// can. Verified writes go one run at a time so we can check each of them.
+	if extentObject, ok := unwrapObjectHandle(object).(disko.SupportsExtentIOHandle); ok {
+		var flushRangesCb blockcache.FlushRangesCallback
+		if !driver.mountFlags.VerifiesWrites() {
+			flushRangesCb = func(ranges []disko.BlockRange) error {
+				*modified = true
+				return extentObject.WriteExtents(ranges)
+			}
+		}
+		blockCache.SetRangeCallbacks(
+			func(ranges []disko.BlockRange) error {
+				return extentObject.ReadExtents(ranges)
+			},
+			flushRangesCb,
+		)
+	}
+
+	if holeObject, ok := unwrapObjectHandle(object).(disko.SupportsHolesHandle); ok {
+		blockCache.SetHoleCallback(holeObject.IsHole)
+	}
+
+	// In shared mode we load the entire object up front, so that reads from
+	// different goroutines never have to touch the implementation or modify
+	// the cache.
+	if driver.mountFlags.IsShared() {
+		if ioFlags.RequiresWritePerm() {
+			return File{}, disko.ErrReadOnlyFileSystem.WithMessage(
+				"can't open a file for writing on a shared mount",
+			)
+		}
+
+		err := blockCache.Freeze()
+		if err != nil {
+			return File{}, err
+		}
+	}
+
 	stream, err := basicstream.New(stat.Size, blockCache, ioFlags)
 	if err != nil {
 		return File{}, err
 	}
 
+	if ioFlags.RequiresWritePerm() {
+		driver.openWritableFiles[stream] = struct{}{}
+	}
+
 	return File{
 		owningDriver: driver,
 		objectHandle: object,
 		ioFlags:      ioFlags,
 		BasicStream:  stream,
+		modified:     modified,
 		fileInfo: FileInfo{
 			FileStat:     stat,
 			absolutePath: object.AbsolutePath(),
+			owner:        driver,
+			handle:       object.Unwrap(),
 		},
 	}, nil
 }
@@ -143,70 +209,109 @@ func (file *File) Chdir() error {
 }
 
 func (file *File) Chmod(mode os.FileMode) error {
-	chmodHandle, ok := file.objectHandle.(disko.SupportsChmodHandle)
-	if ok {
-		return chmodHandle.Chmod(mode)
+	chmodHandle, ok := file.objectHandle.Unwrap().(disko.SupportsChmodHandle)
+	if !ok {
+		return disko.ErrNotSupported
+	}
+
+	err := chmodHandle.Chmod(mode)
+	if err == nil {
+		file.owningDriver.notify(ChangeAttributes, file.objectHandle.AbsolutePath())
 	}
-	return disko.ErrNotSupported
+	return err
 }
 
 func (file *File) Chown(uid, gid int) error {
-	chownHandle, ok := file.objectHandle.(disko.SupportsChownHandle)
-	if ok {
-		return chownHandle.Chown(uid, gid)
+	chownHandle, ok := file.objectHandle.Unwrap().(disko.SupportsChownHandle)
+	if !ok {
+		return disko.ErrNotSupported
+	}
+
+	err := chownHandle.Chown(uid, gid)
+	if err == nil {
+		file.owningDriver.notify(ChangeAttributes, file.objectHandle.AbsolutePath())
 	}
-	return disko.ErrNotSupported
+	return err
 }
 
 func (file *File) Close() error {
-	return file.BasicStream.Close()
+	if file.dirIter != nil {
+		file.dirIter.Close()
+		file.dirIter = nil
+	}
+	// Only writable files are tracked, and read-only ones mustn't touch the map
+	// since they may be closed concurrently on a shared mount.
+	if file.ioFlags.RequiresWritePerm() {
+		delete(file.owningDriver.openWritableFiles, file.BasicStream)
+	}
+	err := file.BasicStream.Close()
+	if err != nil || !file.ioFlags.RequiresWritePerm() {
+		return err
+	}
+
+	// The block cache only resizes the object in whole blocks, so set its exact
+	// size now that all the data has been written.
+	if size := file.BasicStream.Size(); size != file.objectHandle.Stat().Size {
+		err = file.objectHandle.Resize(uint64(size))
+		if err != nil {
+			return err
+		}
+		*file.modified = true
+	}
+
+	if *file.modified {
+		file.owningDriver.notify(ChangeWritten, file.objectHandle.AbsolutePath())
+	}
+	return nil
 }
 
 func (file *File) Name() string {
 	return file.objectHandle.Name()
 }
 
-// ReadDir is equivalent to [os.File.ReadDir].
+// ReadDir is equivalent to [os.File.ReadDir]. Entries are read from the
+// implementation as they're needed, so reading a large directory in batches
+// doesn't require loading it all into memory.
 func (file *File) ReadDir(n int) ([]os.DirEntry, error) {
 	stat := file.objectHandle.Stat()
 	if !stat.IsDir() {
 		return nil, disko.ErrNotADirectory
 	}
 
-	if file.lastReadDirResult == nil {
-		// The function has never been called or was exhausted on a previous
-		// call. Read the contents of the directory and set up the queue.
-		entries, err := file.owningDriver.readDir(file.objectHandle)
+	if file.dirExhausted {
+		// Like os.File, an exhausted directory stays exhausted. Reading one
+		// batch at a time ends with io.EOF, but reading everything doesn't.
+		if n > 0 {
+			return []os.DirEntry{}, io.EOF
+		}
+		return []os.DirEntry{}, nil
+	} else if file.dirIter == nil {
+		// The function has never been called. Start reading from the beginning
+		// of the directory.
+		iter, err := file.owningDriver.openDirIter(file.objectHandle)
 		if err != nil {
 			return nil, err
 		}
-
-		file.lastReadDirResult = entries
-		file.readDirResultPointer = 0
-	}
-
-	entriesRemaining := len(file.lastReadDirResult) - file.readDirResultPointer
-	var numToCopy int
-	if n <= 0 || n > entriesRemaining {
-		numToCopy = entriesRemaining
-	} else {
-		numToCopy = n
+		file.dirIter = iter
 	}
 
-	result := make([]os.DirEntry, numToCopy)
-
-	// If there are no entries remaining, return an empty slice and io.EOF.
-	if entriesRemaining == 0 {
-		file.lastReadDirResult = nil
-		file.readDirResultPointer = 0
-		return result, io.EOF
-	}
-
-	// TODO (dargueta): Is there a way to use copy() for a slice of a superset interface?
-	// It shouldn't be a performance problem but this feels clunky.
-	for i := 0; i < numToCopy; i++ {
-		result[i] = file.lastReadDirResult[file.readDirResultPointer]
-		file.readDirResultPointer++
+	result := []os.DirEntry{}
+	for n <= 0 || len(result) < n {
+		dirent, err := file.owningDriver.readNextDirEntry(file.objectHandle, file.dirIter)
+		if err == io.EOF {
+			file.dirExhausted = true
+
+			// If there are no entries remaining, return an empty slice and
+			// io.EOF, except when reading everything, in which case os.File
+			// returns a nil error.
+			if len(result) == 0 && n > 0 {
+				return result, io.EOF
+			}
+			return result, nil
+		} else if err != nil {
+			return result, err
+		}
+		result = append(result, dirent)
 	}
 	return result, nil
 }
@@ -0,0 +1,82 @@
+package driver
+
+import (
+	"io"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/memfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMemoryFSDriver(t *testing.T) *BaseDriver {
+	implementation := memfs.NewMemoryFS(512, 64)
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowAll))
+	return New(implementation, disko.MountFlagsAllowAll)
+}
+
+// openDirectory opens a directory as a [File]. OpenFile only opens files, so
+// this is the only way to get at [File.ReadDir].
+func openDirectory(t *testing.T, fs *BaseDriver, path string) File {
+	object, err := fs.getObjectAtPathFollowingLink(path)
+	require.NoError(t, err)
+	directory, openErr := NewFileFromObjectHandle(fs, object, disko.O_RDONLY)
+	require.NoError(t, openErr)
+	return directory
+}
+
+func TestFileReadDir__BatchesStayExhausted(t *testing.T) {
+	fs := newMemoryFSDriver(t)
+	require.NoError(t, fs.Mkdir("/dir", 0o755))
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, fs.WriteFile("/dir/"+name, []byte(name), 0o644))
+	}
+
+	directory := openDirectory(t, fs, "/dir")
+	defer directory.Close()
+
+	names := []string{}
+	for {
+		entries, err := directory.ReadDir(2)
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		if err == io.EOF {
+			assert.Empty(t, entries)
+			break
+		}
+		require.NoError(t, err)
+		require.NotEmpty(t, entries)
+	}
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, names)
+
+	// The directory isn't read again from the beginning.
+	entries, err := directory.ReadDir(2)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Empty(t, entries)
+
+	entries, err = directory.ReadDir(-1)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestFileReadDir__AllStaysExhausted(t *testing.T) {
+	fs := newMemoryFSDriver(t)
+	require.NoError(t, fs.WriteFile("/file", []byte("x"), 0o644))
+
+	directory := openDirectory(t, fs, "/")
+	defer directory.Close()
+
+	entries, err := directory.ReadDir(0)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	entries, err = directory.ReadDir(0)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	entries, err = directory.ReadDir(1)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,174 @@
+package driver_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	c "github.com/dargueta/disko/file_systems/common"
+	"github.com/dargueta/disko/file_systems/memfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingFS is a [memfs.MemoryFS] that records the order in which object
+// data is written and the file system is flushed.
+type recordingFS struct {
+	*memfs.MemoryFS
+	events []string
+	// failWrites makes every call to WriteBlocks fail.
+	failWrites bool
+	// corruptWrites is the number of calls to WriteBlocks left that store
+	// corrupted data instead of what they were given.
+	corruptWrites int
+}
+
+// recordingHandle records calls to WriteBlocks in its file system's events.
+type recordingHandle struct {
+	disko.ObjectHandle
+	fs *recordingFS
+}
+
+func newRecordingFS(
+	t *testing.T,
+	flags disko.MountFlags,
+) (*recordingFS, *driver.BaseDriver) {
+	implementation := &recordingFS{MemoryFS: memfs.NewMemoryFS(512, 64)}
+	require.NoError(t, implementation.Mount(flags))
+	return implementation, driver.New(implementation, flags)
+}
+
+// unwrapRecordingHandle returns the MemoryFS handle `handle` wraps, since
+// MemoryFS only accepts its own handles.
+func unwrapRecordingHandle(handle disko.ObjectHandle) disko.ObjectHandle {
+	if wrapped, ok := handle.(recordingHandle); ok {
+		return wrapped.ObjectHandle
+	}
+	return handle
+}
+
+func (fs *recordingFS) wrap(
+	handle disko.ObjectHandle,
+	err disko.DriverError,
+) (disko.ObjectHandle, disko.DriverError) {
+	if err != nil {
+		return nil, err
+	}
+	return recordingHandle{ObjectHandle: handle, fs: fs}, nil
+}
+
+func (fs *recordingFS) Flush() disko.DriverError {
+	fs.events = append(fs.events, "Flush")
+	return fs.MemoryFS.Flush()
+}
+
+func (fs *recordingFS) CreateObject(
+	name string,
+	parent disko.ObjectHandle,
+	perm os.FileMode,
+) (disko.ObjectHandle, disko.DriverError) {
+	return fs.wrap(fs.MemoryFS.CreateObject(name, unwrapRecordingHandle(parent), perm))
+}
+
+func (fs *recordingFS) GetObject(
+	name string,
+	parent disko.ObjectHandle,
+) (disko.ObjectHandle, disko.DriverError) {
+	return fs.wrap(fs.MemoryFS.GetObject(name, unwrapRecordingHandle(parent)))
+}
+
+func (fs *recordingFS) GetRootDirectory() disko.ObjectHandle {
+	root, _ := fs.wrap(fs.MemoryFS.GetRootDirectory(), nil)
+	return root
+}
+
+func (handle recordingHandle) WriteBlocks(index c.LogicalBlock, data []byte) disko.DriverError {
+	handle.fs.events = append(handle.fs.events, "WriteBlocks "+handle.Name())
+	if handle.fs.failWrites {
+		return disko.ErrIOFailed.WithMessage("write failed")
+	} else if handle.fs.corruptWrites > 0 {
+		handle.fs.corruptWrites--
+		corrupted := append([]byte{}, data...)
+		corrupted[0] ^= 0xFF
+		return handle.ObjectHandle.WriteBlocks(index, corrupted)
+	}
+	return handle.ObjectHandle.WriteBlocks(index, data)
+}
+
+func (handle recordingHandle) SameAs(other disko.ObjectHandle) bool {
+	return handle.ObjectHandle.SameAs(unwrapRecordingHandle(other))
+}
+
+// Flush writes out the data of every file open for writing before flushing the
+// file system's metadata.
+func TestFlush__DataBeforeMetadata(t *testing.T) {
+	implementation, fs := newRecordingFS(t, disko.MountFlagsAllowAll)
+
+	first, err := fs.Create("/first")
+	require.NoError(t, err)
+	defer first.Close()
+	second, err := fs.Create("/second")
+	require.NoError(t, err)
+	defer second.Close()
+
+	_, err = first.Write([]byte("first"))
+	require.NoError(t, err)
+	_, err = second.Write([]byte("second"))
+	require.NoError(t, err)
+
+	implementation.events = nil
+	require.NoError(t, fs.Flush())
+
+	require.Len(t, implementation.events, 3)
+	assert.ElementsMatch(
+		t,
+		[]string{"WriteBlocks first", "WriteBlocks second"},
+		implementation.events[:2],
+	)
+	assert.Equal(t, "Flush", implementation.events[2])
+}
+
+// Files are no longer written out by Flush once they're closed, and files only
+// open for reading never are.
+func TestFlush__OnlyOpenWritableFiles(t *testing.T) {
+	implementation, fs := newRecordingFS(t, disko.MountFlagsAllowAll)
+	require.NoError(t, fs.WriteFile("/read", []byte("read"), 0o644))
+
+	reader, err := fs.Open("/read")
+	require.NoError(t, err)
+	defer reader.Close()
+
+	writer, err := fs.Create("/write")
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("data"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	implementation.events = nil
+	require.NoError(t, fs.Flush())
+	assert.Equal(t, []string{"Flush"}, implementation.events)
+
+	data, err := fs.ReadFile("/write")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("data"), data)
+}
+
+// If a file's data can't be written out, the metadata isn't flushed.
+func TestFlush__DataWriteFails(t *testing.T) {
+	implementation, fs := newRecordingFS(t, disko.MountFlagsAllowAll)
+
+	file, err := fs.Create("/file")
+	require.NoError(t, err)
+	_, err = file.Write([]byte("data"))
+	require.NoError(t, err)
+
+	implementation.events = nil
+	implementation.failWrites = true
+	err = fs.Flush()
+	assert.ErrorIs(t, err, disko.ErrIOFailed)
+	assert.Equal(t, []string{"WriteBlocks file"}, implementation.events)
+
+	implementation.failWrites = false
+	file.Close()
+}
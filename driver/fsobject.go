@@ -2,25 +2,52 @@ package driver
 
 import "github.com/dargueta/disko"
 
+// extObjectHandle is an object handle from the implementation along with the
+// absolute path it was found at.
 type extObjectHandle interface {
 	disko.ObjectHandle
 	AbsolutePath() string
+
+	// Unwrap returns the handle the implementation returned. Implementations
+	// only know about their own handle types, so this is what must be passed to
+	// them and checked for optional interfaces such as
+	// [disko.SupportsChmodHandle].
+	Unwrap() disko.ObjectHandle
 }
 
 type tExtObjectHandle struct {
-	extObjectHandle
+	disko.ObjectHandle
 	absolutePath string
 }
 
-// wrapObjectHandle combines
+// wrapObjectHandle combines a handle from the implementation with the absolute
+// path it was found at.
 func wrapObjectHandle(handle disko.ObjectHandle, absolutePath string) extObjectHandle {
 	return &tExtObjectHandle{
-		// FIXME (dargueta): This is hella wrong
-		//extObjectHandle.ObjectHandle: handle,
+		ObjectHandle: handle,
 		absolutePath: absolutePath,
 	}
 }
 
+// unwrapObjectHandle returns the implementation's handle for `handle`, which
+// may or may not be an [extObjectHandle].
+func unwrapObjectHandle(handle disko.ObjectHandle) disko.ObjectHandle {
+	if extHandle, ok := handle.(extObjectHandle); ok {
+		return extHandle.Unwrap()
+	}
+	return handle
+}
+
 func (xh tExtObjectHandle) AbsolutePath() string {
 	return xh.absolutePath
 }
+
+func (xh tExtObjectHandle) Unwrap() disko.ObjectHandle {
+	return xh.ObjectHandle
+}
+
+// SameAs unwraps `other` before comparing, since implementations can only
+// compare against their own handles.
+func (xh tExtObjectHandle) SameAs(other disko.ObjectHandle) bool {
+	return xh.ObjectHandle.SameAs(unwrapObjectHandle(other))
+}
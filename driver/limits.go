@@ -0,0 +1,93 @@
+package driver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/common"
+)
+
+// checkNewPath fails with [disko.ErrNameTooLong] if an object can't be created
+// at `absPath` with the name `name`, because the name is longer than
+// [disko.FSStat.MaxNameLength] allows, or the path is longer or deeper than
+// [disko.FSFeatures.MaxPathLength] and [disko.FSFeatures.MaxPathDepth] allow.
+// This lets the driver reject a path before the implementation starts
+// allocating space for it.
+func (driver *BaseDriver) checkNewPath(absPath, name string) disko.DriverError {
+	if driver.isTempPath(absPath) {
+		return nil
+	}
+
+	maxLength := driver.implementation.FSStat().MaxNameLength
+	if maxLength != 0 && uint(len(name)) > maxLength {
+		return disko.ErrNameTooLong.WithMessage(
+			fmt.Sprintf(
+				"can't create %q: name is %d bytes, file system allows at most %d",
+				absPath,
+				len(name),
+				maxLength,
+			),
+		)
+	}
+
+	features := driver.implementation.GetFSFeatures()
+	if features.MaxPathLength > 0 && len(absPath) > features.MaxPathLength {
+		return disko.ErrNameTooLong.WithMessage(
+			fmt.Sprintf(
+				"can't create %q: path is %d bytes, file system allows at most %d",
+				absPath,
+				len(absPath),
+				features.MaxPathLength,
+			),
+		)
+	}
+
+	depth := strings.Count(strings.TrimSuffix(absPath, "/"), "/")
+	if features.MaxPathDepth > 0 && depth > features.MaxPathDepth {
+		return disko.ErrNameTooLong.WithMessage(
+			fmt.Sprintf(
+				"can't create %q: path is %d levels deep, file system allows at most %d",
+				absPath,
+				depth,
+				features.MaxPathDepth,
+			),
+		)
+	}
+	return nil
+}
+
+// checkFileSize fails with [disko.ErrFileTooLarge] if an object with the given
+// block size can't grow to `newSize` blocks, according to
+// [disko.FSFeatures.MaxFileSize].
+//
+// Since this works in blocks, a file can still grow slightly past the limit if
+// it isn't a multiple of the block size. Implementations must check the exact
+// size themselves.
+func (driver *BaseDriver) checkFileSize(
+	object extObjectHandle,
+	blockSize int64,
+	newSize common.LogicalBlock,
+) disko.DriverError {
+	maxSize := driver.implementation.GetFSFeatures().MaxFileSize
+	if maxSize <= 0 || blockSize <= 0 {
+		return nil
+	}
+
+	maxBlocks := maxSize / blockSize
+	if maxSize%blockSize != 0 {
+		maxBlocks++
+	}
+
+	if uint64(newSize) <= uint64(maxBlocks) {
+		return nil
+	}
+	return disko.ErrFileTooLarge.WithMessage(
+		fmt.Sprintf(
+			"can't resize %q to %d blocks: file system allows at most %d bytes",
+			object.AbsolutePath(),
+			newSize,
+			maxSize,
+		),
+	)
+}
@@ -0,0 +1,122 @@
+package driver_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/memfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// limitedMemoryFS is a [memfs.MemoryFS] with small limits on names, paths,
+// and file sizes.
+type limitedMemoryFS struct {
+	*memfs.MemoryFS
+}
+
+func (fs limitedMemoryFS) FSStat() disko.FSStat {
+	stat := fs.MemoryFS.FSStat()
+	stat.MaxNameLength = 8
+	return stat
+}
+
+func (fs limitedMemoryFS) GetFSFeatures() disko.FSFeatures {
+	features := fs.MemoryFS.GetFSFeatures()
+	features.MaxFileSize = 1000
+	features.MaxPathLength = 24
+	features.MaxPathDepth = 3
+	return features
+}
+
+func newLimitedDriver(t *testing.T) *driver.BaseDriver {
+	implementation := limitedMemoryFS{memfs.NewMemoryFS(512, 64)}
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowAll))
+	fs := driver.New(implementation, disko.MountFlagsAllowAll)
+	require.NoError(t, fs.WriteFile("/file", []byte("data"), 0o644))
+	return fs
+}
+
+func TestLimits__NameTooLong(t *testing.T) {
+	fs := newLimitedDriver(t)
+
+	_, err := fs.Create("/longname1")
+	assert.ErrorIs(t, err, disko.ErrNameTooLong)
+	assert.ErrorContains(t, err, `can't create "/longname1": name is 9 bytes, file system allows at most 8`)
+
+	err = fs.Mkdir("/longname1", 0o755)
+	assert.ErrorIs(t, err, disko.ErrNameTooLong)
+
+	err = fs.MkdirAll("/dir/longname1", 0o755)
+	assert.ErrorIs(t, err, disko.ErrNameTooLong)
+
+	err = fs.Link("/file", "/longname1")
+	assert.ErrorIs(t, err, disko.ErrNameTooLong)
+
+	err = fs.Symlink("/file", "/longname1")
+	assert.ErrorIs(t, err, disko.ErrNameTooLong)
+
+	// Nothing with the long name was created.
+	entries, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotEqual(t, "longname1", entry.Name())
+	}
+
+	// Names right at the limit are fine.
+	_, err = fs.Create("/longname")
+	assert.NoError(t, err)
+}
+
+func TestLimits__PathTooLong(t *testing.T) {
+	fs := newLimitedDriver(t)
+	require.NoError(t, fs.MkdirAll("/aaaaaaaa/bbbbbbbb", 0o755))
+
+	err := fs.WriteFile("/aaaaaaaa/bbbbbbbb/cccccc", nil, 0o644)
+	assert.ErrorIs(t, err, disko.ErrNameTooLong)
+	assert.ErrorContains(t, err, "path is 25 bytes, file system allows at most 24")
+
+	err = fs.Mkdir("/aaaaaaaa/bbbbbbbb/cccccc", 0o755)
+	assert.ErrorIs(t, err, disko.ErrNameTooLong)
+}
+
+func TestLimits__PathTooDeep(t *testing.T) {
+	fs := newLimitedDriver(t)
+
+	err := fs.MkdirAll("/a/b/c/d", 0o755)
+	assert.ErrorIs(t, err, disko.ErrNameTooLong)
+	assert.ErrorContains(t, err, "path is 4 levels deep, file system allows at most 3")
+
+	err = fs.Link("/file", "/a/b/c/d")
+	assert.ErrorIs(t, err, disko.ErrNameTooLong)
+
+	// MkdirAll created everything up to the limit.
+	stat, err := fs.Stat("/a/b/c")
+	require.NoError(t, err)
+	assert.True(t, stat.IsDir())
+}
+
+func TestLimits__FileTooLarge(t *testing.T) {
+	fs := newLimitedDriver(t)
+
+	// The limit is checked in whole blocks, so a file can grow to the end of
+	// the block the limit falls in.
+	require.NoError(t, fs.WriteFile("/file", bytes.Repeat([]byte("x"), 1024), 0o644))
+
+	err := fs.WriteFile("/file", bytes.Repeat([]byte("x"), 1025), 0o644)
+	assert.ErrorIs(t, err, disko.ErrFileTooLarge)
+	assert.ErrorContains(t, err, `can't resize "/file" to 3 blocks: file system allows at most 1000 bytes`)
+
+	file, err := fs.OpenFile("/file", disko.O_RDWR, 0)
+	require.NoError(t, err)
+	defer file.Close()
+
+	err = file.Truncate(2000)
+	assert.ErrorIs(t, err, disko.ErrFileTooLarge)
+	assert.NoError(t, file.Truncate(500))
+
+	// Truncating to 0 never runs into the limit.
+	assert.NoError(t, fs.Truncate("/file"))
+}
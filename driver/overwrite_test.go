@@ -0,0 +1,137 @@
+package driver_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// overwriteArchive replaces /existing.txt from [newImportTestImage], adds a
+// new file after it, and puts a symbolic link where /keep is.
+func overwriteArchive(t *testing.T) []byte {
+	return makeTar(
+		t,
+		tarEntry{name: "existing.txt", typeflag: tar.TypeReg, data: "replaced"},
+		tarEntry{name: "new.txt", typeflag: tar.TypeReg, data: "new"},
+		tarEntry{name: "link", typeflag: tar.TypeSymlink, link: "new.txt"},
+		tarEntry{name: "link", typeflag: tar.TypeSymlink, link: "existing.txt"},
+	)
+}
+
+// recordOverwrites returns an [driver.OverwriteFunc] that gives `answer` for
+// every path, and the list of paths it was asked about.
+func recordOverwrites(answer bool, err error) (driver.OverwriteFunc, *[]string) {
+	asked := []string{}
+	return func(path string) (bool, error) {
+		asked = append(asked, path)
+		return answer, err
+	}, &asked
+}
+
+func TestImportTar__OverwriteNilReplaces(t *testing.T) {
+	_, fs := newImportTestImage(t)
+	_, err := fs.ImportTar(bytes.NewReader(overwriteArchive(t)), "/", nil, nil)
+	require.NoError(t, err)
+
+	contents, err := fs.ReadFile("/existing.txt")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("replaced"), contents)
+
+	target, err := fs.Readlink("/link")
+	require.NoError(t, err)
+	assert.Equal(t, "existing.txt", target)
+}
+
+func TestImportTar__OverwriteAccepted(t *testing.T) {
+	_, fs := newImportTestImage(t)
+	overwrite, asked := recordOverwrites(true, nil)
+	_, err := fs.ImportTar(bytes.NewReader(overwriteArchive(t)), "/", nil, overwrite)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/existing.txt", "/link"}, *asked)
+
+	contents, err := fs.ReadFile("/existing.txt")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("replaced"), contents)
+
+	target, err := fs.Readlink("/link")
+	require.NoError(t, err)
+	assert.Equal(t, "existing.txt", target)
+}
+
+// Refused entries are skipped, and the rest of the archive is still imported.
+func TestImportTar__OverwriteRefused(t *testing.T) {
+	_, fs := newImportTestImage(t)
+	overwrite, asked := recordOverwrites(false, nil)
+	_, err := fs.ImportTar(bytes.NewReader(overwriteArchive(t)), "/", nil, overwrite)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/existing.txt", "/link"}, *asked)
+
+	contents, err := fs.ReadFile("/existing.txt")
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte("x"), 1000), contents)
+
+	contents, err = fs.ReadFile("/new.txt")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("new"), contents)
+
+	target, err := fs.Readlink("/link")
+	require.NoError(t, err)
+	assert.Equal(t, "new.txt", target)
+}
+
+// An error from the overwrite function stops the import.
+func TestImportTar__OverwriteFails(t *testing.T) {
+	_, fs := newImportTestImage(t)
+	stopped := errors.New("stopped")
+	overwrite, asked := recordOverwrites(false, stopped)
+	_, err := fs.ImportTar(bytes.NewReader(overwriteArchive(t)), "/", nil, overwrite)
+	assert.ErrorIs(t, err, stopped)
+	assert.Equal(t, []string{"/existing.txt"}, *asked)
+
+	_, err = fs.Stat("/new.txt")
+	assert.ErrorIs(t, err, disko.ErrNotFound)
+}
+
+// A file and a directory can't replace each other, so the overwrite function
+// isn't asked about them.
+func TestImportTar__OverwriteFileAndDirectory(t *testing.T) {
+	testCases := []struct {
+		name  string
+		entry tarEntry
+		err   error
+	}{
+		{
+			name:  "file over a directory",
+			entry: tarEntry{name: "keep", typeflag: tar.TypeReg, data: "file"},
+			err:   disko.ErrIsADirectory,
+		},
+		{
+			name:  "directory over a file",
+			entry: tarEntry{name: "existing.txt/", typeflag: tar.TypeDir},
+			err:   disko.ErrNotADirectory,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, fs := newImportTestImage(t)
+			overwrite, asked := recordOverwrites(true, nil)
+			_, err := fs.ImportTar(bytes.NewReader(makeTar(t, testCase.entry)), "/", nil, overwrite)
+			assert.ErrorIs(t, err, testCase.err)
+			assert.Empty(t, *asked)
+
+			stat, err := fs.Stat("/keep")
+			require.NoError(t, err)
+			assert.True(t, stat.IsDir())
+			stat, err = fs.Stat("/existing.txt")
+			require.NoError(t, err)
+			assert.EqualValues(t, 1000, stat.Size)
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package driver
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	posixpath "path"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/utilities/pathfilter"
+)
+
+// PlannedOperation is a change that a dry run found an operation would make.
+type PlannedOperation struct {
+	// Action says what would be done: "mkdir", "create", "overwrite",
+	// "remove", "symlink", or "link".
+	Action string
+
+	// Path is the absolute path of the object that would be changed.
+	Path string
+
+	// Target is what a symbolic or hard link would point to. It's empty for
+	// other actions.
+	Target string
+
+	// Size is the number of bytes that would be written to a file.
+	Size int64
+}
+
+func (operation PlannedOperation) String() string {
+	switch operation.Action {
+	case "create", "overwrite":
+		return fmt.Sprintf("%s %s (%d bytes)", operation.Action, operation.Path, operation.Size)
+	case "symlink", "link":
+		return fmt.Sprintf("%s %s -> %s", operation.Action, operation.Path, operation.Target)
+	default:
+		return operation.Action + " " + operation.Path
+	}
+}
+
+// Plan is the result of a dry run of an operation.
+type Plan struct {
+	// Operations lists the changes that would be made, in order.
+	Operations []PlannedOperation
+
+	// BlocksNeeded estimates the number of blocks the changes need, less the
+	// blocks freed by overwriting existing files. It doesn't count metadata
+	// such as directory entries, so the real number may be slightly larger.
+	BlocksNeeded int64
+
+	// BlocksAvailable is the number of blocks available on the file system.
+	BlocksAvailable uint64
+}
+
+// dryRun tracks the changes a dry run would have made, so that later steps see
+// the objects earlier ones would have created. Intercepting the writes of a
+// real import on a read-only mount can't do this: the first directory it
+// "creates" wouldn't be there for the files that go in it. Each step here must
+// therefore mirror the corresponding step of [tarImport].
+type dryRun struct {
+	driver    *BaseDriver
+	plan      Plan
+	overwrite OverwriteFunc
+	// created maps the paths of objects that would be created to whether
+	// they're directories.
+	created map[string]bool
+}
+
+// PlanImportTar does a dry run of [BaseDriver.ImportTar]. It resolves every
+// path, checks that the file system supports the objects in the archive and
+// has room for them, and returns the changes that would be made, without
+// writing anything. The file system can be mounted read-only. `overwrite` is
+// called the same way ImportTar would call it.
+//
+// If the import would fail, the plan up to the point of failure is returned
+// along with the error. Running out of space fails with
+// [disko.ErrNoSpaceOnDevice] after the whole archive has been planned.
+func (driver *BaseDriver) PlanImportTar(
+	source io.Reader,
+	root string,
+	filter *pathfilter.Filter,
+	overwrite OverwriteFunc,
+) (Plan, error) {
+	run := dryRun{
+		driver:    driver,
+		plan:      Plan{BlocksAvailable: driver.implementation.FSStat().BlocksAvailable},
+		overwrite: overwrite,
+		created:   map[string]bool{},
+	}
+
+	root = driver.NormalizePath(root)
+	err := readTarEntries(
+		source,
+		root,
+		filter,
+		func(_ *tar.Reader, header *tar.Header, path string) error {
+			return run.planTarEntry(header, root, path)
+		},
+	)
+	if err != nil {
+		return run.plan, err
+	}
+
+	if run.plan.BlocksNeeded > 0 && uint64(run.plan.BlocksNeeded) > run.plan.BlocksAvailable {
+		return run.plan, disko.ErrNoSpaceOnDevice.WithMessage(
+			fmt.Sprintf(
+				"import needs about %d blocks but only %d are available",
+				run.plan.BlocksNeeded,
+				run.plan.BlocksAvailable,
+			),
+		)
+	}
+	return run.plan, nil
+}
+
+func (run *dryRun) planTarEntry(header *tar.Header, root, path string) error {
+	path, err := run.mapPath(root, path)
+	if err != nil {
+		return err
+	}
+
+	err = run.ensureDirectory(posixpath.Dir(path))
+	if err != nil {
+		return err
+	}
+
+	isDir, exists, err := run.lookUp(path)
+	if err != nil {
+		return err
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if exists && !isDir {
+			return disko.ErrNotADirectory.WithMessage(path)
+		}
+		return run.ensureDirectory(path)
+	case tar.TypeReg, tar.TypeRegA:
+		if isDir {
+			return disko.ErrIsADirectory.WithMessage(path)
+		}
+		return run.writeFile(path, header.Size, exists)
+	case tar.TypeSymlink:
+		if !run.driver.implementation.GetFSFeatures().HasSymbolicLinks {
+			return disko.ErrNotSupported.WithMessage(
+				fmt.Sprintf("can't create symlink %q: file system doesn't support them", path))
+		}
+		return run.link("symlink", header.Linkname, path, exists)
+	case tar.TypeLink:
+		if _, ok := run.driver.implementation.(disko.HardLinkImplementer); !ok {
+			return disko.ErrNotSupported.WithMessage(
+				fmt.Sprintf("can't create hard link %q: file system doesn't support them", path))
+		}
+
+		target, err := run.mapPath(root, posixpath.Join(root, posixpath.Clean("/"+header.Linkname)))
+		if err != nil {
+			return err
+		}
+		_, targetExists, err := run.lookUp(target)
+		if err != nil {
+			return err
+		} else if !targetExists {
+			return disko.ErrNotFound.WithMessage(
+				fmt.Sprintf("can't create hard link %q: target %q doesn't exist", path, target))
+		}
+		return run.link("link", target, path, exists)
+	default:
+		return disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf(
+				"can't import %q: unsupported tar entry type %q",
+				header.Name,
+				header.Typeflag,
+			),
+		)
+	}
+}
+
+// mapPath renames the components of `path` with the driver's name mapper, if
+// it has one, taking the objects the plan would create into account.
+func (run *dryRun) mapPath(root, path string) (string, error) {
+	return run.driver.mapImportPath(root, path, func(absPath string) bool {
+		_, exists, err := run.lookUp(absPath)
+		return err == nil && exists
+	})
+}
+
+// lookUp returns whether there would be an object at `absPath` after the
+// changes planned so far, and if so, whether it's a directory.
+func (run *dryRun) lookUp(absPath string) (isDir bool, exists bool, err error) {
+	if isDir, ok := run.created[absPath]; ok {
+		return isDir, true, nil
+	}
+
+	stat, err := run.driver.Stat(absPath)
+	if errors.Is(err, disko.ErrNotFound) {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, err
+	}
+	return stat.IsDir(), true, nil
+}
+
+// ensureDirectory plans the same changes as [tarImport.ensureDirectory].
+func (run *dryRun) ensureDirectory(absPath string) error {
+	isDir, exists, err := run.lookUp(absPath)
+	if err != nil {
+		return err
+	} else if exists {
+		if !isDir {
+			return disko.ErrNotADirectory.WithMessage(absPath)
+		}
+		return nil
+	}
+
+	err = run.ensureDirectory(posixpath.Dir(absPath))
+	if err != nil {
+		return err
+	}
+
+	run.created[absPath] = true
+	run.plan.Operations = append(
+		run.plan.Operations, PlannedOperation{Action: "mkdir", Path: absPath})
+	return nil
+}
+
+func (run *dryRun) writeFile(absPath string, size int64, exists bool) error {
+	blocks := run.blocksFor(size)
+	action := "create"
+
+	if exists {
+		replace, err := confirmOverwrite(run.overwrite, absPath)
+		if err != nil || !replace {
+			return err
+		}
+
+		action = "overwrite"
+		if _, createdByPlan := run.created[absPath]; !createdByPlan {
+			stat, err := run.driver.Stat(absPath)
+			if err != nil {
+				return err
+			}
+			blocks -= run.blocksFor(stat.Size)
+		}
+	}
+
+	run.created[absPath] = false
+	run.plan.BlocksNeeded += blocks
+	run.plan.Operations = append(
+		run.plan.Operations,
+		PlannedOperation{Action: action, Path: absPath, Size: size},
+	)
+	return nil
+}
+
+func (run *dryRun) link(action, target, absPath string, exists bool) error {
+	if exists {
+		replace, err := confirmOverwrite(run.overwrite, absPath)
+		if err != nil || !replace {
+			return err
+		}
+		run.plan.Operations = append(
+			run.plan.Operations, PlannedOperation{Action: "remove", Path: absPath})
+	}
+
+	// Symbolic links store their target as their contents.
+	if action == "symlink" {
+		run.plan.BlocksNeeded += run.blocksFor(int64(len(target)))
+	}
+
+	run.created[absPath] = false
+	run.plan.Operations = append(
+		run.plan.Operations,
+		PlannedOperation{Action: action, Path: absPath, Target: target},
+	)
+	return nil
+}
+
+// blocksFor returns the number of blocks needed to store `size` bytes.
+func (run *dryRun) blocksFor(size int64) int64 {
+	blockSize := int64(run.driver.implementation.FSStat().BlockSize)
+	if blockSize <= 0 {
+		return 0
+	}
+	return (size + blockSize - 1) / blockSize
+}
@@ -0,0 +1,223 @@
+package driver_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/memfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tarEntry is an entry in an archive created by [makeTar].
+type tarEntry struct {
+	name     string
+	typeflag byte
+	data     string
+	// link is the target of a symbolic or hard link.
+	link string
+}
+
+// makeTar creates a tar archive with the given entries, in order.
+func makeTar(t *testing.T, entries ...tarEntry) []byte {
+	var archive bytes.Buffer
+	writer := tar.NewWriter(&archive)
+	for _, entry := range entries {
+		require.NoError(t, writer.WriteHeader(&tar.Header{
+			Name:     entry.name,
+			Typeflag: entry.typeflag,
+			Mode:     0o644,
+			Size:     int64(len(entry.data)),
+			Linkname: entry.link,
+		}))
+		_, err := writer.Write([]byte(entry.data))
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+	return archive.Bytes()
+}
+
+// newImportTestImage creates an image with a 1000-byte /existing.txt and an
+// empty directory /keep.
+func newImportTestImage(t *testing.T) (*memfs.MemoryFS, *driver.BaseDriver) {
+	implementation := memfs.NewMemoryFS(512, 64)
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowAll))
+	fs := driver.New(implementation, disko.MountFlagsAllowAll)
+	require.NoError(t, fs.WriteFile("/existing.txt", bytes.Repeat([]byte("x"), 1000), 0o644))
+	require.NoError(t, fs.Mkdir("/keep", 0o755))
+	return implementation, fs
+}
+
+// listTree returns the absolute paths of everything in `fs`, sorted.
+func listTree(t *testing.T, fs *driver.BaseDriver) []string {
+	paths := []string{}
+	err := fs.Walk("/", nil, func(path, _ string, _ disko.DirectoryEntry) error {
+		paths = append(paths, path)
+		return nil
+	})
+	require.NoError(t, err)
+	sort.Strings(paths)
+	return paths
+}
+
+// The plan must list exactly the changes the real import makes.
+func TestPlanImportTar__MatchesImport(t *testing.T) {
+	archive := makeTar(
+		t,
+		tarEntry{name: "a/", typeflag: tar.TypeDir},
+		tarEntry{name: "a/b/c.txt", typeflag: tar.TypeReg, data: strings.Repeat("c", 700)},
+		tarEntry{name: "existing.txt", typeflag: tar.TypeReg, data: strings.Repeat("e", 1500)},
+		tarEntry{name: "keep/new.txt", typeflag: tar.TypeReg, data: "new"},
+		tarEntry{name: "sym", typeflag: tar.TypeSymlink, link: "a/b/c.txt"},
+		tarEntry{name: "a/hard", typeflag: tar.TypeLink, link: "a/b/c.txt"},
+	)
+
+	implementation, fs := newImportTestImage(t)
+	before := listTree(t, fs)
+	freeBefore := implementation.FSStat().BlocksFree
+
+	readOnly := driver.New(implementation, disko.MountFlagsAllowRead)
+	plan, err := readOnly.PlanImportTar(bytes.NewReader(archive), "/", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, before, listTree(t, fs), "the dry run changed the image")
+
+	_, err = fs.ImportTar(bytes.NewReader(archive), "/", nil, nil)
+	require.NoError(t, err)
+
+	planned := []string{}
+	for _, operation := range plan.Operations {
+		switch operation.Action {
+		case "mkdir":
+			planned = append(planned, operation.Path)
+			stat, err := fs.Stat(operation.Path)
+			require.NoError(t, err, operation.String())
+			assert.True(t, stat.IsDir(), operation.String())
+		case "create", "overwrite":
+			if operation.Action == "create" {
+				planned = append(planned, operation.Path)
+			}
+			stat, err := fs.Stat(operation.Path)
+			require.NoError(t, err, operation.String())
+			assert.Equal(t, operation.Size, stat.Size, operation.String())
+		case "symlink":
+			planned = append(planned, operation.Path)
+			target, err := fs.Readlink(operation.Path)
+			require.NoError(t, err, operation.String())
+			assert.Equal(t, operation.Target, target, operation.String())
+		case "link":
+			planned = append(planned, operation.Path)
+			linked, err := fs.Lstat(operation.Path)
+			require.NoError(t, err, operation.String())
+			target, err := fs.Lstat(operation.Target)
+			require.NoError(t, err, operation.String())
+			assert.Equal(t, target.InodeNumber, linked.InodeNumber, operation.String())
+		default:
+			t.Errorf("unexpected operation: %s", operation.String())
+		}
+	}
+
+	existed := map[string]bool{}
+	for _, path := range before {
+		existed[path] = true
+	}
+	created := []string{}
+	for _, path := range listTree(t, fs) {
+		if !existed[path] {
+			created = append(created, path)
+		}
+	}
+	assert.ElementsMatch(t, created, planned)
+	assert.Equal(
+		t,
+		[]string{"/a", "/a/b", "/a/b/c.txt", "/a/hard", "/keep/new.txt", "/sym"},
+		created,
+	)
+
+	// MemoryFS doesn't use blocks for metadata, so the estimate is exact.
+	assert.EqualValues(t, freeBefore-implementation.FSStat().BlocksFree, plan.BlocksNeeded)
+}
+
+// An archive the import would fail on fails the same way when planned.
+func TestPlanImportTar__FailsLikeImport(t *testing.T) {
+	testCases := []struct {
+		name    string
+		entries []tarEntry
+		err     error
+	}{
+		{
+			name:    "file in a file",
+			entries: []tarEntry{{name: "existing.txt/x", typeflag: tar.TypeReg, data: "x"}},
+			err:     disko.ErrNotADirectory,
+		},
+		{
+			name:    "directory over a file",
+			entries: []tarEntry{{name: "existing.txt/", typeflag: tar.TypeDir}},
+			err:     disko.ErrNotADirectory,
+		},
+		{
+			name:    "file over a directory",
+			entries: []tarEntry{{name: "keep", typeflag: tar.TypeReg, data: "x"}},
+			err:     disko.ErrIsADirectory,
+		},
+		{
+			name:    "hard link to nothing",
+			entries: []tarEntry{{name: "hard", typeflag: tar.TypeLink, link: "missing"}},
+			err:     disko.ErrNotFound,
+		},
+		{
+			name: "out of space",
+			entries: []tarEntry{
+				{name: "big", typeflag: tar.TypeReg, data: strings.Repeat("x", 64*512)},
+			},
+			err: disko.ErrNoSpaceOnDevice,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			archive := makeTar(t, testCase.entries...)
+			implementation, fs := newImportTestImage(t)
+
+			readOnly := driver.New(implementation, disko.MountFlagsAllowRead)
+			_, err := readOnly.PlanImportTar(bytes.NewReader(archive), "/", nil, nil)
+			assert.ErrorIs(t, err, testCase.err, "plan")
+
+			_, err = fs.ImportTar(bytes.NewReader(archive), "/", nil, nil)
+			assert.ErrorIs(t, err, testCase.err, "import")
+		})
+	}
+}
+
+// Files the overwrite policy refuses to replace are left out of the plan.
+func TestPlanImportTar__NoClobber(t *testing.T) {
+	archive := makeTar(
+		t,
+		tarEntry{name: "existing.txt", typeflag: tar.TypeReg, data: "replaced"},
+		tarEntry{name: "new.txt", typeflag: tar.TypeReg, data: "new"},
+	)
+	implementation, _ := newImportTestImage(t)
+	readOnly := driver.New(implementation, disko.MountFlagsAllowRead)
+
+	asked := []string{}
+	plan, err := readOnly.PlanImportTar(
+		bytes.NewReader(archive),
+		"/",
+		nil,
+		func(path string) (bool, error) {
+			asked = append(asked, path)
+			return false, nil
+		},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/existing.txt"}, asked)
+	assert.Equal(
+		t,
+		[]driver.PlannedOperation{{Action: "create", Path: "/new.txt", Size: 3}},
+		plan.Operations,
+	)
+}
@@ -0,0 +1,112 @@
+package driver
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/memfs"
+	diskotest "github.com/dargueta/disko/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFile__NoLimitByDefault(t *testing.T) {
+	fs := newMemoryFSDriver(t)
+	data := bytes.Repeat([]byte("x"), 10000)
+	require.NoError(t, fs.WriteFile("/file", data, 0o644))
+
+	contents, err := fs.ReadFile("/file")
+	require.NoError(t, err)
+	assert.Equal(t, data, contents)
+}
+
+func TestReadFile__AtLimit(t *testing.T) {
+	fs := newMemoryFSDriver(t)
+	fs.SetMaxReadFileSize(1000)
+	data := bytes.Repeat([]byte("x"), 1000)
+	require.NoError(t, fs.WriteFile("/file", data, 0o644))
+
+	contents, err := fs.ReadFile("/file")
+	require.NoError(t, err)
+	assert.Equal(t, data, contents)
+}
+
+func TestReadFile__OverLimit(t *testing.T) {
+	fs := newMemoryFSDriver(t)
+	fs.SetMaxReadFileSize(1000)
+	require.NoError(t, fs.WriteFile("/file", bytes.Repeat([]byte("x"), 1001), 0o644))
+
+	contents, err := fs.ReadFile("/file")
+	assert.ErrorIs(t, err, disko.ErrFileTooLarge)
+	assert.ErrorContains(t, err, `"/file" is larger than the limit of 1000 bytes`)
+	assert.Nil(t, contents)
+}
+
+// The limit only applies to ReadFile, so larger files can still be streamed.
+func TestCopyFileTo__IgnoresReadLimit(t *testing.T) {
+	fs := newMemoryFSDriver(t)
+	fs.SetMaxReadFileSize(1000)
+	data := diskotest.CreateRandomImage(512, 8, t)
+	require.NoError(t, fs.WriteFile("/file", data, 0o644))
+
+	var output bytes.Buffer
+	n, err := fs.CopyFileTo("/file", &output)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(data), n)
+	assert.Equal(t, data, output.Bytes())
+}
+
+func TestLimitedWriter(t *testing.T) {
+	var output bytes.Buffer
+	writer := limitedWriter{writer: &output, limit: 10, path: "/file"}
+
+	n, err := writer.Write([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	n, err = writer.Write([]byte("world"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	// Nothing is written once the limit would be passed, not even the part
+	// that fits.
+	n, err = writer.Write([]byte("!"))
+	assert.ErrorIs(t, err, disko.ErrFileTooLarge)
+	assert.Zero(t, n)
+	assert.Equal(t, "helloworld", output.String())
+}
+
+func TestLimitedWriter__NoLimit(t *testing.T) {
+	var output bytes.Buffer
+	writer := limitedWriter{writer: &output, path: "/file"}
+
+	data := bytes.Repeat([]byte("x"), 100000)
+	n, err := writer.Write(data)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	assert.EqualValues(t, len(data), writer.written)
+}
+
+func TestGetContentsOfObject__MetadataLimit(t *testing.T) {
+	implementation := memfs.NewMemoryFS(512, 512)
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowAll))
+	fs := New(implementation, disko.MountFlagsAllowAll)
+
+	atLimit := bytes.Repeat([]byte("x"), MaxMetadataReadSize)
+	require.NoError(t, fs.WriteFile("/small", atLimit, 0o644))
+	require.NoError(t, fs.WriteFile("/big", append(atLimit, 'x'), 0o644))
+
+	object, err := fs.getObjectAtPathNoFollow("/small")
+	require.NoError(t, err)
+	contents, err := fs.getContentsOfObject(object, MaxMetadataReadSize)
+	require.NoError(t, err)
+	assert.Equal(t, atLimit, contents)
+
+	object, err = fs.getObjectAtPathNoFollow("/big")
+	require.NoError(t, err)
+	contents, err = fs.getContentsOfObject(object, MaxMetadataReadSize)
+	assert.ErrorIs(t, err, disko.ErrFileTooLarge)
+	assert.ErrorContains(t, err, `"/big" is 65537 bytes, more than the limit of 65536`)
+	assert.Nil(t, contents)
+}
@@ -0,0 +1,65 @@
+package driver_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fileInfoFromReadDir returns the entry for `name` in the root directory.
+func fileInfoFromReadDir(t *testing.T, fs *driver.BaseDriver, name string) os.FileInfo {
+	entries, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	for _, entry := range entries {
+		if entry.Name() == name {
+			info, err := entry.Info()
+			require.NoError(t, err)
+			return info
+		}
+	}
+	require.Failf(t, "entry not found", "no entry named %q", name)
+	return nil
+}
+
+func TestSameFile__SameDriver(t *testing.T) {
+	fs := newCopyTestDriver(t)
+	require.NoError(t, fs.WriteFile("/a", []byte("a"), 0o644))
+	require.NoError(t, fs.WriteFile("/b", []byte("b"), 0o644))
+	require.NoError(t, fs.Link("/a", "/c"))
+
+	file, err := fs.Open("/a")
+	require.NoError(t, err)
+	defer file.Close()
+	opened, err := file.Stat()
+	require.NoError(t, err)
+
+	a := fileInfoFromReadDir(t, fs, "a")
+	assert.True(t, fs.SameFile(a, opened))
+	assert.True(t, fs.SameFile(a, fileInfoFromReadDir(t, fs, "a")))
+	assert.True(t, fs.SameFile(a, fileInfoFromReadDir(t, fs, "c")))
+	assert.False(t, fs.SameFile(a, fileInfoFromReadDir(t, fs, "b")))
+}
+
+// Objects on different images are never the same, even if they have the same
+// device ID and inode number.
+func TestSameFile__DifferentDrivers(t *testing.T) {
+	fs1 := newCopyTestDriver(t)
+	fs2 := newCopyTestDriver(t)
+	require.NoError(t, fs1.WriteFile("/a", []byte("a"), 0o644))
+	require.NoError(t, fs2.WriteFile("/a", []byte("a"), 0o644))
+
+	a1 := fileInfoFromReadDir(t, fs1, "a")
+	a2 := fileInfoFromReadDir(t, fs2, "a")
+	stat1 := a1.Sys().(disko.FileStat)
+	stat2 := a2.Sys().(disko.FileStat)
+	require.Equal(t, stat1.DeviceID, stat2.DeviceID)
+	require.Equal(t, stat1.InodeNumber, stat2.InodeNumber)
+
+	assert.False(t, fs1.SameFile(a1, a2))
+	assert.False(t, fs2.SameFile(a1, a2))
+	assert.False(t, fs1.SameFile(a2, a2))
+}
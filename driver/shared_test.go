@@ -0,0 +1,84 @@
+package driver_test
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/fat"
+	diskotest "github.com/dargueta/disko/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xaionaro-go/bytesextra"
+)
+
+// newSharedFAT formats a FAT12 floppy image with `files`, then mounts it again
+// with [disko.MountFlagsShared].
+func newSharedFAT(t *testing.T, files map[string][]byte) *driver.BaseDriver {
+	const imageSize = 1440 * 1024
+	image := make([]byte, imageSize)
+
+	implementation, err := fat.NewDriver(bytesextra.NewReadWriteSeeker(image))
+	require.NoError(t, err)
+	formatter := implementation.(disko.FormatImageImplementer)
+	require.NoError(t, formatter.FormatImage(disks.FormatterSizeOptions{Size: imageSize}))
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowAll))
+
+	fs := driver.New(implementation, disko.MountFlagsAllowAll)
+	require.NoError(t, fs.Mkdir("/DIR", 0o755))
+	for path, data := range files {
+		require.NoError(t, fs.WriteFile(path, data, 0o644))
+	}
+	require.NoError(t, implementation.Unmount())
+
+	const flags = disko.MountFlagsAllowRead | disko.MountFlagsShared
+	implementation, err = fat.NewDriver(bytesextra.NewReadWriteSeeker(image))
+	require.NoError(t, err)
+	require.NoError(t, implementation.Mount(flags))
+	t.Cleanup(func() { implementation.Unmount() })
+	return driver.New(implementation, flags)
+}
+
+// Many goroutines opening and reading the same files on a shared mount must
+// all get the right data. Run with `-race` to detect unsynchronized access.
+func TestSharedMount__ConcurrentReads(t *testing.T) {
+	files := map[string][]byte{}
+	for i := 0; i < 4; i++ {
+		files[fmt.Sprintf("/FILE%d.BIN", i)] = diskotest.CreateRandomImage(512, uint(i*7+1), t)
+		files[fmt.Sprintf("/DIR/FILE%d.BIN", i)] = diskotest.CreateRandomImage(100, uint(i+1), t)
+	}
+	fs := newSharedFAT(t, files)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path, expected := range files {
+				file, err := fs.Open(path)
+				if !assert.NoError(t, err, "failed to open %s", path) {
+					continue
+				}
+				data, err := io.ReadAll(file)
+				assert.NoError(t, err, "failed to read %s", path)
+				assert.Equal(t, expected, data, "wrong contents for %s", path)
+				assert.NoError(t, file.Close())
+
+				stat, err := fs.Stat(path)
+				if assert.NoError(t, err) {
+					assert.EqualValues(t, len(expected), stat.Size)
+				}
+			}
+
+			entries, err := fs.ReadDir("/DIR")
+			if assert.NoError(t, err) {
+				assert.Len(t, entries, 4)
+			}
+		}()
+	}
+	wg.Wait()
+}
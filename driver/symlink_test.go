@@ -0,0 +1,89 @@
+package driver_test
+
+import (
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/memfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lookupFS is a [memfs.MemoryFS] that counts the handles to the object named
+// `tracked` that are open, and fails to look up the object named `broken`.
+type lookupFS struct {
+	*memfs.MemoryFS
+	tracked    string
+	broken     string
+	openCount  int
+	closeCount int
+}
+
+// countingHandle tells its file system when it's closed.
+type countingHandle struct {
+	disko.ObjectHandle
+	fs *lookupFS
+}
+
+func (fs *lookupFS) GetObject(
+	name string,
+	parent disko.ObjectHandle,
+) (disko.ObjectHandle, disko.DriverError) {
+	if name == fs.broken {
+		return nil, disko.ErrIOFailed.WithMessage("can't read directory entry")
+	}
+
+	handle, err := fs.MemoryFS.GetObject(name, parent)
+	if err != nil || name != fs.tracked {
+		return handle, err
+	}
+	fs.openCount++
+	return countingHandle{ObjectHandle: handle, fs: fs}, nil
+}
+
+func (handle countingHandle) Close() error {
+	handle.fs.closeCount++
+	return handle.ObjectHandle.Close()
+}
+
+func newLookupFS(t *testing.T) (*lookupFS, *driver.BaseDriver) {
+	implementation := &lookupFS{
+		MemoryFS: memfs.NewMemoryFS(512, 64),
+		tracked:  "file",
+		broken:   "broken",
+	}
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowAll))
+	fs := driver.New(implementation, disko.MountFlagsAllowAll)
+	require.NoError(t, fs.WriteFile("/file", []byte("data"), 0o644))
+	return implementation, fs
+}
+
+// The handle used to check whether the link already exists must be closed.
+func TestSymlink__Exists(t *testing.T) {
+	implementation, fs := newLookupFS(t)
+	implementation.openCount = 0
+	implementation.closeCount = 0
+
+	err := fs.Symlink("/target", "/file")
+	assert.ErrorIs(t, err, disko.ErrExists)
+	assert.Equal(t, 1, implementation.openCount)
+	assert.Equal(t, implementation.openCount, implementation.closeCount)
+}
+
+// Only a missing object means the link can be created. Other errors looking
+// it up are returned.
+func TestSymlink__LookupFails(t *testing.T) {
+	_, fs := newLookupFS(t)
+
+	err := fs.Symlink("/target", "/broken")
+	assert.ErrorIs(t, err, disko.ErrIOFailed)
+
+	err = fs.Symlink("/target", "/file/link")
+	assert.ErrorIs(t, err, disko.ErrNotADirectory)
+
+	entries, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "file", entries[0].Name())
+}
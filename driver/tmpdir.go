@@ -0,0 +1,176 @@
+package driver
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/memfs"
+)
+
+// TempDirectoryName is the name of the directory [BaseDriver.EnableTempDirectory]
+// adds to the root directory.
+const TempDirectoryName = ".disko-tmp"
+
+// tempDirBlockSize is the block size of the file system behind the temporary
+// directory. It has no effect on the image.
+const tempDirBlockSize = 512
+
+// tempRootHandle is the root of the file system behind the temporary directory.
+// It's wrapped so that it has the right name when it's listed in the root of
+// the image.
+type tempRootHandle struct {
+	disko.ObjectHandle
+}
+
+func (handle tempRootHandle) Name() string {
+	return TempDirectoryName
+}
+
+func (handle tempRootHandle) Unlink() disko.DriverError {
+	return disko.ErrNotPermitted.WithMessage(
+		fmt.Sprintf("can't remove /%s", TempDirectoryName))
+}
+
+func (handle tempRootHandle) ListDir() ([]string, disko.DriverError) {
+	return handle.ObjectHandle.(disko.SupportsListDirHandle).ListDir()
+}
+
+// SameAs unwraps `other` if it's also the temporary directory.
+func (handle tempRootHandle) SameAs(other disko.ObjectHandle) bool {
+	if otherRoot, ok := other.(tempRootHandle); ok {
+		other = otherRoot.ObjectHandle
+	}
+	return handle.ObjectHandle.SameAs(other)
+}
+
+// tempDirIterator lists the root directory of the image with the temporary
+// directory added at the end.
+type tempDirIterator struct {
+	disko.DirIterator
+	done bool
+}
+
+func (iter *tempDirIterator) Next() (string, error) {
+	name, err := iter.DirIterator.Next()
+	if err == nil && name == TempDirectoryName {
+		// Shadowed by the temporary directory, which is listed below.
+		return iter.Next()
+	} else if err == nil || iter.done || err != io.EOF {
+		return name, err
+	}
+	iter.done = true
+	return TempDirectoryName, nil
+}
+
+// EnableTempDirectory adds a directory named [TempDirectoryName] to the root
+// directory, whose contents are kept in memory and never written to the image.
+// It's meant for staging data during conversions and tests without using up
+// space in the image. Everything in it is lost when the driver is discarded.
+//
+// The directory can hold up to `maxSize` bytes. It's shown in listings of the
+// root directory and can be used like any other directory, except that it
+// can't be removed and objects can't be hard linked into or out of it. It
+// shadows an object with the same name in the image, if there is one. Files in
+// it can only be modified if the image is mounted with write permissions.
+func (driver *BaseDriver) EnableTempDirectory(maxSize uint64) error {
+	if driver.tempDir != nil {
+		return disko.ErrAlreadyInProgress.WithMessage("temporary directory already enabled")
+	}
+
+	tempDir := memfs.NewMemoryFS(tempDirBlockSize, maxSize/tempDirBlockSize)
+	err := tempDir.Mount(disko.MountFlagsAllowAll)
+	if err != nil {
+		return err
+	}
+	driver.tempDir = tempDir
+	return nil
+}
+
+// isTempObject returns true if `handle` is in the temporary directory,
+// including the directory itself.
+func (driver *BaseDriver) isTempObject(handle disko.ObjectHandle) bool {
+	handle = unwrapObjectHandle(handle)
+	if _, ok := handle.(tempRootHandle); ok {
+		return true
+	}
+	return driver.tempDir != nil && driver.tempDir.Owns(handle)
+}
+
+// isTempPath returns true if the normalized path `absPath` is in the temporary
+// directory.
+func (driver *BaseDriver) isTempPath(absPath string) bool {
+	return driver.tempDir != nil &&
+		(absPath == "/"+TempDirectoryName ||
+			strings.HasPrefix(absPath, "/"+TempDirectoryName+"/"))
+}
+
+// isRootDirectory returns true if `handle` is the root directory of the image.
+func (driver *BaseDriver) isRootDirectory(handle disko.ObjectHandle) bool {
+	handle = unwrapObjectHandle(handle)
+	if driver.isTempObject(handle) {
+		return false
+	}
+
+	root := driver.implementation.GetRootDirectory()
+	defer root.Close()
+	return root.SameAs(handle)
+}
+
+// implementationFor returns the implementation `handle` belongs to, along with
+// the handle that implementation expects to be given.
+func (driver *BaseDriver) implementationFor(
+	handle disko.ObjectHandle,
+) (disko.FileSystemImplementer, disko.ObjectHandle) {
+	handle = unwrapObjectHandle(handle)
+	if root, ok := handle.(tempRootHandle); ok {
+		return driver.tempDir, root.ObjectHandle
+	} else if driver.isTempObject(handle) {
+		return driver.tempDir, handle
+	}
+	return driver.implementation, handle
+}
+
+// getObject is [disko.FileSystemImplementer.GetObject], routed to the
+// implementation that owns `parent`.
+func (driver *BaseDriver) getObject(
+	name string,
+	parent disko.ObjectHandle,
+) (disko.ObjectHandle, disko.DriverError) {
+	if name == TempDirectoryName && driver.tempDir != nil && driver.isRootDirectory(parent) {
+		return tempRootHandle{driver.tempDir.GetRootDirectory()}, nil
+	}
+
+	implementation, parent := driver.implementationFor(parent)
+	return implementation.GetObject(name, parent)
+}
+
+// createObject is [disko.FileSystemImplementer.CreateObject], routed to the
+// implementation that owns `parent`.
+func (driver *BaseDriver) createObject(
+	name string,
+	parent disko.ObjectHandle,
+	perm os.FileMode,
+) (disko.ObjectHandle, disko.DriverError) {
+	if name == TempDirectoryName && driver.tempDir != nil && driver.isRootDirectory(parent) {
+		return nil, disko.ErrExists.WithMessage(
+			fmt.Sprintf("/%s is the temporary directory", TempDirectoryName))
+	}
+
+	implementation, parent := driver.implementationFor(parent)
+	return implementation.CreateObject(name, parent, perm)
+}
+
+// openDirIter wraps the package-level [openDirIter], adding the temporary
+// directory to listings of the root directory.
+func (driver *BaseDriver) openDirIter(
+	directory disko.ObjectHandle,
+) (disko.DirIterator, disko.DriverError) {
+	iter, err := openDirIter(directory)
+	if err != nil || driver.tempDir == nil || !driver.isRootDirectory(directory) {
+		return iter, err
+	}
+	return &tempDirIterator{DirIterator: iter}, nil
+}
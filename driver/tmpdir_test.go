@@ -0,0 +1,72 @@
+package driver_test
+
+import (
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnableTempDirectory__Basic(t *testing.T) {
+	fs := newMountedMemoryFS(t)
+	require.NoError(t, fs.EnableTempDirectory(4096))
+	rootBefore, err := fs.Stat("/")
+	require.NoError(t, err)
+
+	require.NoError(t, fs.Mkdir("/.disko-tmp/stage", 0o755))
+	require.NoError(t, fs.WriteFile("/.disko-tmp/stage/data.bin", []byte("staged"), 0o644))
+
+	data, err := fs.ReadFile("/.disko-tmp/stage/data.bin")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("staged"), data)
+
+	entries, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, driver.TempDirectoryName, entries[0].Name())
+	assert.True(t, entries[0].IsDir())
+
+	// The root directory of the underlying file system wasn't touched.
+	rootAfter, err := fs.Stat("/")
+	require.NoError(t, err)
+	assert.Equal(t, rootBefore, rootAfter)
+}
+
+func TestEnableTempDirectory__SizeLimit(t *testing.T) {
+	fs := newMountedMemoryFS(t)
+	require.NoError(t, fs.EnableTempDirectory(1024))
+
+	err := fs.WriteFile("/.disko-tmp/big", make([]byte, 2048), 0o644)
+	assert.ErrorIs(t, err, disko.ErrNoSpaceOnDevice)
+}
+
+func TestEnableTempDirectory__CantRemoveOrRecreate(t *testing.T) {
+	fs := newMountedMemoryFS(t)
+	require.NoError(t, fs.EnableTempDirectory(4096))
+
+	assert.ErrorIs(t, fs.Remove("/.disko-tmp"), disko.ErrNotPermitted)
+	assert.ErrorIs(t, fs.Mkdir("/.disko-tmp", 0o755), disko.ErrExists)
+}
+
+func TestEnableTempDirectory__NoCrossLinks(t *testing.T) {
+	fs := newMountedMemoryFS(t)
+	require.NoError(t, fs.EnableTempDirectory(4096))
+	require.NoError(t, fs.WriteFile("/file", []byte("x"), 0o644))
+
+	err := fs.Link("/file", "/.disko-tmp/file")
+	assert.ErrorIs(t, err, disko.ErrCrossDeviceLink)
+
+	require.NoError(t, fs.WriteFile("/.disko-tmp/a", []byte("y"), 0o644))
+	require.NoError(t, fs.Link("/.disko-tmp/a", "/.disko-tmp/b"))
+	data, err := fs.ReadFile("/.disko-tmp/b")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("y"), data)
+}
+
+func TestEnableTempDirectory__Disabled(t *testing.T) {
+	fs := newMountedMemoryFS(t)
+	_, err := fs.Stat("/.disko-tmp")
+	assert.ErrorIs(t, err, disko.ErrNotFound)
+}
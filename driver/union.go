@@ -0,0 +1,297 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	posixpath "path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/dargueta/disko"
+)
+
+// UnionDriver presents several mounted file systems as a single read-only
+// [disko.Driver], e.g. a base OS image with an application floppy on top of it.
+//
+// Layers are given from the bottom up, and objects in later layers shadow
+// objects with the same path in earlier ones. Directories present in more than
+// one layer are merged, unless a layer has a non-directory at that path, which
+// hides everything below it.
+//
+// Symbolic links are resolved within the layer they're in, not across the whole
+// union. The layers are never modified; every operation that would write to
+// them fails with [disko.ErrReadOnlyFileSystem].
+type UnionDriver struct {
+	// Interfaces
+	// disko.Driver
+
+	layers         []*BaseDriver
+	workingDirPath string
+}
+
+// NewUnion creates a [UnionDriver] from already-mounted file systems, ordered
+// from the bottom layer to the top. The caller is responsible for unmounting
+// the layers once it's done with the union.
+func NewUnion(layers ...*BaseDriver) (*UnionDriver, error) {
+	if len(layers) == 0 {
+		return nil, disko.ErrInvalidArgument.WithMessage("a union needs at least one layer")
+	}
+	return &UnionDriver{layers: layers, workingDirPath: "/"}, nil
+}
+
+// findLayer returns the topmost layer containing `absPath`, and the status of
+// the object there as given by [BaseDriver.Lstat].
+func (union *UnionDriver) findLayer(absPath string) (*BaseDriver, disko.FileStat, error) {
+	for i := len(union.layers) - 1; i >= 0; i-- {
+		stat, err := union.layers[i].Lstat(absPath)
+		if err == nil {
+			return union.layers[i], stat, nil
+		} else if !errors.Is(err, disko.ErrNotFound) {
+			return nil, disko.FileStat{}, err
+		}
+	}
+	return nil, disko.FileStat{}, disko.ErrNotFound.WithMessage(absPath)
+}
+
+// readOnlyError returns the error for an attempt to modify `path`.
+func (union *UnionDriver) readOnlyError(operation, path string) error {
+	return disko.ErrReadOnlyFileSystem.WithMessage(
+		fmt.Sprintf("can't %s %q: union mounts are read-only", operation, path),
+	)
+}
+
+// NormalizePath converts a file path to an absolute path, the same way
+// [BaseDriver.NormalizePath] does.
+func (union *UnionDriver) NormalizePath(path string) string {
+	path = posixpath.Clean(filepath.ToSlash(path))
+	if path == "." {
+		path = "/"
+	}
+	if posixpath.IsAbs(path) {
+		return path
+	}
+	return posixpath.Join(union.workingDirPath, path)
+}
+
+// GetFSFeatures returns the features of the bottom layer.
+func (union *UnionDriver) GetFSFeatures() disko.FSFeatures {
+	return union.layers[0].GetFSFeatures()
+}
+
+// Layers returns the file systems making up the union, from the bottom up.
+func (union *UnionDriver) Layers() []*BaseDriver {
+	return union.layers
+}
+
+func (union *UnionDriver) Chdir(path string) error {
+	absPath := union.NormalizePath(path)
+	stat, err := union.Stat(absPath)
+	if err != nil {
+		return err
+	} else if !stat.IsDir() {
+		return disko.ErrNotADirectory.WithMessage(absPath)
+	}
+
+	union.workingDirPath = absPath
+	return nil
+}
+
+func (union *UnionDriver) Getwd() (string, error) {
+	return union.workingDirPath, nil
+}
+
+func (union *UnionDriver) Stat(path string) (disko.FileStat, error) {
+	absPath := union.NormalizePath(path)
+	layer, _, err := union.findLayer(absPath)
+	if err != nil {
+		return disko.FileStat{}, err
+	}
+	return layer.Stat(absPath)
+}
+
+func (union *UnionDriver) Lstat(path string) (disko.FileStat, error) {
+	_, stat, err := union.findLayer(union.NormalizePath(path))
+	return stat, err
+}
+
+func (union *UnionDriver) Open(path string) (disko.File, error) {
+	return union.OpenFile(path, disko.O_RDONLY, 0)
+}
+
+// OpenFile opens a file from the topmost layer that has it. It fails with
+// [disko.ErrReadOnlyFileSystem] if `flags` require write access.
+func (union *UnionDriver) OpenFile(
+	path string,
+	flags disko.IOFlags,
+	perm os.FileMode,
+) (disko.File, error) {
+	absPath := union.NormalizePath(path)
+	if flags.RequiresWritePerm() {
+		return nil, union.readOnlyError("open for writing", absPath)
+	}
+
+	layer, _, err := union.findLayer(absPath)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := layer.OpenFile(absPath, flags, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+func (union *UnionDriver) ReadFile(path string) ([]byte, error) {
+	absPath := union.NormalizePath(path)
+	layer, _, err := union.findLayer(absPath)
+	if err != nil {
+		return nil, err
+	}
+	return layer.ReadFile(absPath)
+}
+
+// CopyFileTo writes the contents of the file at `path` to `destination`. See
+// [BaseDriver.CopyFileTo].
+func (union *UnionDriver) CopyFileTo(path string, destination io.Writer) (int64, error) {
+	absPath := union.NormalizePath(path)
+	layer, _, err := union.findLayer(absPath)
+	if err != nil {
+		return 0, err
+	}
+	return layer.CopyFileTo(absPath, destination)
+}
+
+func (union *UnionDriver) Readlink(path string) (string, error) {
+	absPath := union.NormalizePath(path)
+	layer, _, err := union.findLayer(absPath)
+	if err != nil {
+		return "", err
+	}
+	return layer.Readlink(absPath)
+}
+
+// ReadDir returns the merged contents of the directory at `path` in every layer
+// that has it, sorted by name. Where more than one layer has an entry with the
+// same name, the one from the topmost layer is returned.
+func (union *UnionDriver) ReadDir(path string) ([]disko.DirectoryEntry, error) {
+	absPath := union.NormalizePath(path)
+
+	found := false
+	seen := map[string]struct{}{}
+	merged := []disko.DirectoryEntry{}
+
+	for i := len(union.layers) - 1; i >= 0; i-- {
+		layer := union.layers[i]
+		stat, err := layer.Stat(absPath)
+		if errors.Is(err, disko.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if !stat.IsDir() {
+			if !found {
+				return nil, disko.ErrNotADirectory.WithMessage(absPath)
+			}
+			// A non-directory hides any directories below it.
+			break
+		}
+		found = true
+
+		entries, err := layer.ReadDir(absPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if _, exists := seen[entry.Name()]; !exists {
+				seen[entry.Name()] = struct{}{}
+				merged = append(merged, entry)
+			}
+		}
+	}
+
+	if !found {
+		return nil, disko.ErrNotFound.WithMessage(absPath)
+	}
+
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Name() < merged[j].Name() })
+	return merged, nil
+}
+
+// SameFile returns true if both objects come from the same layer and refer to
+// the same object there. Objects from different layers are never the same.
+func (union *UnionDriver) SameFile(fi1, fi2 os.FileInfo) bool {
+	owner, _ := fileInfoIdentity(fi1)
+	if owner == nil {
+		return sameFileByStat(fi1, fi2)
+	}
+	return owner.SameFile(fi1, fi2)
+}
+
+// Unmount does nothing, since the union doesn't own its layers.
+func (union *UnionDriver) Unmount() error {
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+// Functions that modify the file system, all of which fail.
+
+func (union *UnionDriver) Chmod(name string, mode os.FileMode) error {
+	return union.readOnlyError("change the mode of", union.NormalizePath(name))
+}
+
+func (union *UnionDriver) Chown(name string, uid, gid int) error {
+	return union.readOnlyError("change the owner of", union.NormalizePath(name))
+}
+
+func (union *UnionDriver) Lchown(name string, uid, gid int) error {
+	return union.readOnlyError("change the owner of", union.NormalizePath(name))
+}
+
+func (union *UnionDriver) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return union.readOnlyError("change the timestamps of", union.NormalizePath(name))
+}
+
+func (union *UnionDriver) Create(path string) (disko.File, error) {
+	return nil, union.readOnlyError("create", union.NormalizePath(path))
+}
+
+func (union *UnionDriver) Link(oldname, newname string) error {
+	return union.readOnlyError("create", union.NormalizePath(newname))
+}
+
+func (union *UnionDriver) Symlink(oldname, newname string) error {
+	return union.readOnlyError("create", union.NormalizePath(newname))
+}
+
+func (union *UnionDriver) Mkdir(path string, perm os.FileMode) error {
+	return union.readOnlyError("create", union.NormalizePath(path))
+}
+
+func (union *UnionDriver) MkdirAll(path string, perm os.FileMode) error {
+	return union.readOnlyError("create", union.NormalizePath(path))
+}
+
+func (union *UnionDriver) Remove(path string) error {
+	return union.readOnlyError("remove", union.NormalizePath(path))
+}
+
+func (union *UnionDriver) RemoveAll(path string) error {
+	return union.readOnlyError("remove", union.NormalizePath(path))
+}
+
+func (union *UnionDriver) Rename(old string, new string) error {
+	return union.readOnlyError("rename", union.NormalizePath(old))
+}
+
+func (union *UnionDriver) Truncate(path string) error {
+	return union.readOnlyError("truncate", union.NormalizePath(path))
+}
+
+func (union *UnionDriver) WriteFile(path string, data []byte, perm os.FileMode) error {
+	return union.readOnlyError("write to", union.NormalizePath(path))
+}
@@ -0,0 +1,91 @@
+package driver
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/common"
+)
+
+// DefaultWriteVerifyRetries is the number of times a block is rewritten when
+// reading it back gives different data, if [disko.MountFlagsVerifyWrites] is
+// set and no other limit was given.
+const DefaultWriteVerifyRetries = 3
+
+// SetWriteVerifyRetries sets the number of times a block of file data is
+// written again after reading it back shows it wasn't stored correctly. It has
+// no effect unless the image was mounted with [disko.MountFlagsVerifyWrites].
+// 0 means a mismatch fails immediately.
+func (driver *BaseDriver) SetWriteVerifyRetries(retries uint) {
+	driver.writeVerifyRetries = retries
+}
+
+// writeObjectBlocks writes `buffer` to an object's blocks starting at `index`.
+// If writes are being verified, the blocks are read back afterwards and
+// rewritten until they match or we run out of retries. This is only used for
+// file data; see [disko.MountFlagsVerifyWrites].
+func (driver *BaseDriver) writeObjectBlocks(
+	object extObjectHandle,
+	index common.LogicalBlock,
+	buffer []byte,
+) error {
+	err := object.WriteBlocks(index, buffer)
+	if err != nil || !driver.mountFlags.VerifiesWrites() {
+		return err
+	}
+
+	readBack := make([]byte, len(buffer))
+	blockSize := len(buffer)
+	if stat := object.Stat(); stat.BlockSize > 0 {
+		blockSize = int(stat.BlockSize)
+	}
+
+	for attempt := uint(0); ; attempt++ {
+		err = object.ReadBlocks(index, readBack)
+		if err != nil {
+			return err
+		}
+
+		mismatched := findMismatchedBlocks(buffer, readBack, blockSize, index)
+		if len(mismatched) == 0 {
+			return nil
+		} else if attempt == driver.writeVerifyRetries {
+			return disko.ErrIOFailed.WithMessage(
+				fmt.Sprintf(
+					"%s: blocks %v differ from what was written after %d retries",
+					object.AbsolutePath(),
+					mismatched,
+					attempt,
+				),
+			)
+		}
+
+		err = object.WriteBlocks(index, buffer)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// findMismatchedBlocks compares two buffers block by block and returns the
+// logical block numbers of all blocks that differ. `first` is the block number
+// of the beginning of the buffers.
+func findMismatchedBlocks(
+	expected, actual []byte,
+	blockSize int,
+	first common.LogicalBlock,
+) []common.LogicalBlock {
+	mismatched := []common.LogicalBlock{}
+	for offset := 0; offset < len(expected); offset += blockSize {
+		end := offset + blockSize
+		if end > len(expected) {
+			end = len(expected)
+		}
+		if !bytes.Equal(expected[offset:end], actual[offset:end]) {
+			mismatched = append(
+				mismatched, first+common.LogicalBlock(offset/blockSize))
+		}
+	}
+	return mismatched
+}
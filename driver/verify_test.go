@@ -0,0 +1,62 @@
+package driver_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const verifyFlags = disko.MountFlagsAllowAll | disko.MountFlagsVerifyWrites
+
+// A block that's corrupted fewer times than the number of retries is rewritten
+// until it's stored correctly.
+func TestVerifyWrites__RetriesUntilCorrect(t *testing.T) {
+	implementation, fs := newRecordingFS(t, verifyFlags)
+	data := bytes.Repeat([]byte("x"), 512)
+
+	implementation.corruptWrites = 3
+	require.NoError(t, fs.WriteFile("/file", data, 0o644))
+	assert.Len(t, implementation.events, 4, "expected the original write and three retries")
+
+	contents, err := fs.ReadFile("/file")
+	require.NoError(t, err)
+	assert.Equal(t, data, contents)
+}
+
+func TestVerifyWrites__RunsOutOfRetries(t *testing.T) {
+	implementation, fs := newRecordingFS(t, verifyFlags)
+	fs.SetWriteVerifyRetries(2)
+
+	implementation.corruptWrites = 3
+	err := fs.WriteFile("/file", bytes.Repeat([]byte("x"), 512), 0o644)
+	assert.ErrorIs(t, err, disko.ErrIOFailed)
+	assert.ErrorContains(t, err, "/file: blocks [0] differ from what was written after 2 retries")
+	assert.Len(t, implementation.events, 3)
+}
+
+func TestVerifyWrites__NoRetries(t *testing.T) {
+	implementation, fs := newRecordingFS(t, verifyFlags)
+	fs.SetWriteVerifyRetries(0)
+
+	implementation.corruptWrites = 1
+	err := fs.WriteFile("/file", []byte("data"), 0o644)
+	assert.ErrorIs(t, err, disko.ErrIOFailed)
+	assert.ErrorContains(t, err, "after 0 retries")
+	assert.Len(t, implementation.events, 1)
+}
+
+// Without the flag, blocks aren't read back so corruption goes unnoticed.
+func TestVerifyWrites__Disabled(t *testing.T) {
+	implementation, fs := newRecordingFS(t, disko.MountFlagsAllowAll)
+
+	implementation.corruptWrites = 1
+	require.NoError(t, fs.WriteFile("/file", []byte("data"), 0o644))
+	assert.Len(t, implementation.events, 1)
+
+	contents, err := fs.ReadFile("/file")
+	require.NoError(t, err)
+	assert.NotEqual(t, []byte("data"), contents)
+}
@@ -0,0 +1,71 @@
+package driver
+
+import (
+	"errors"
+	"io/fs"
+	posixpath "path"
+	"sort"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/utilities/pathfilter"
+)
+
+// WalkFunc is called by [BaseDriver.Walk] for each object it visits. `path` is
+// the absolute path to the object, and `relPath` is the path relative to the
+// root of the walk, as given to the [pathfilter.Filter].
+//
+// If it returns [fs.SkipDir] for a directory, the walk doesn't descend into
+// it. Any other error stops the walk and is returned from Walk.
+type WalkFunc func(path, relPath string, entry disko.DirectoryEntry) error
+
+// Walk calls `walkFn` for every object under the directory `root` that
+// `filter` includes, parents before their contents, and the entries of each
+// directory sorted by name. The root itself isn't visited. `filter` may be nil
+// to visit everything.
+//
+// Directories that the filter doesn't include are still searched for objects
+// it does include, unless [pathfilter.Filter.ShouldDescend] says otherwise, so
+// `walkFn` may see an object without having seen its parent directory.
+func (driver *BaseDriver) Walk(
+	root string,
+	filter *pathfilter.Filter,
+	walkFn WalkFunc,
+) error {
+	return driver.walkDirectory(driver.NormalizePath(root), "", filter, walkFn)
+}
+
+func (driver *BaseDriver) walkDirectory(
+	absPath string,
+	relPath string,
+	filter *pathfilter.Filter,
+	walkFn WalkFunc,
+) error {
+	entries, err := driver.ReadDir(absPath)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		childPath := posixpath.Join(absPath, entry.Name())
+		childRelPath := posixpath.Join(relPath, entry.Name())
+
+		descend := entry.IsDir() && filter.ShouldDescend(childRelPath)
+		if filter.Includes(childRelPath) {
+			err = walkFn(childPath, childRelPath, entry)
+			if errors.Is(err, fs.SkipDir) {
+				descend = false
+			} else if err != nil {
+				return err
+			}
+		}
+
+		if descend {
+			err = driver.walkDirectory(childPath, childRelPath, filter, walkFn)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
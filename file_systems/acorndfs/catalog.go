@@ -0,0 +1,231 @@
+package acorndfs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dargueta/disko"
+)
+
+const (
+	// SectorSize is the size of a sector, in bytes.
+	SectorSize = 256
+	// SectorsPerTrack is the number of sectors on each track.
+	SectorsPerTrack = 10
+	// CatalogSectors is the number of sectors at the start of a side holding
+	// the catalog.
+	CatalogSectors = 2
+	// MaxFiles is the number of files the catalog of a side has room for.
+	MaxFiles = 31
+	// MaxNameLength is the length of the longest file name, without the
+	// directory.
+	MaxNameLength = 7
+	// MaxSectorsPerSide is the number of sectors on a side of an 80-track disk.
+	MaxSectorsPerSide = 80 * SectorsPerTrack
+)
+
+// catalogEntrySize is the size of a file's entry in each catalog sector.
+const catalogEntrySize = 8
+
+// rootDirectory is the directory files are in unless they say otherwise.
+const rootDirectory = '$'
+
+// flagLocked is set in the directory byte of a locked file's catalog entry.
+const flagLocked = 0x80
+
+// Boot options, in [Catalog.BootOption]. They say what to do with the file
+// "!BOOT" when the machine is started with Shift-Break.
+const (
+	BootOptionNone = 0
+	BootOptionLoad = 1
+	BootOptionRun  = 2
+	BootOptionExec = 3
+)
+
+// bootOptionNames gives the DFS command used for each boot option.
+var bootOptionNames = [...]string{"none", "*LOAD", "*RUN", "*EXEC"}
+
+// Catalog is the catalog of one side of a disk.
+type Catalog struct {
+	// Title is the disk's title, padded with nulls or spaces.
+	Title [12]byte
+	// CycleNumber is incremented each time the catalog is written, and is
+	// stored in BCD.
+	CycleNumber uint8
+	BootOption  uint8
+	// TotalSectors is the number of sectors on the side.
+	TotalSectors uint16
+	Entries      []RawFileEntry
+}
+
+// RawFileEntry is a file's entry in the catalog.
+type RawFileEntry struct {
+	// Name is the file name, padded with spaces.
+	Name      [MaxNameLength]byte
+	Directory byte
+	Locked    bool
+	// LoadAddress, ExecAddress, and Length are 18 bits each.
+	LoadAddress uint32
+	ExecAddress uint32
+	Length      uint32
+	// StartSector is the first sector of the file, counting from the start of
+	// the side.
+	StartSector uint16
+}
+
+// parseRawFileEntry decodes a file's entry from its part of the first catalog
+// sector, `names`, and of the second, `info`.
+func parseRawFileEntry(names, info []byte) RawFileEntry {
+	entry := RawFileEntry{
+		Directory: names[7] &^ flagLocked,
+		Locked:    names[7]&flagLocked != 0,
+	}
+	copy(entry.Name[:], names[:MaxNameLength])
+
+	// The low two bits of each value are stored together in one byte.
+	highBits := uint32(info[6])
+	entry.LoadAddress = uint32(info[0]) | uint32(info[1])<<8 | (highBits>>2&3)<<16
+	entry.ExecAddress = uint32(info[2]) | uint32(info[3])<<8 | (highBits>>6&3)<<16
+	entry.Length = uint32(info[4]) | uint32(info[5])<<8 | (highBits>>4&3)<<16
+	entry.StartSector = uint16(info[7]) | uint16(highBits&3)<<8
+	return entry
+}
+
+// Sectors returns the number of sectors the file uses.
+func (entry *RawFileEntry) Sectors() uint16 {
+	return uint16((entry.Length + SectorSize - 1) / SectorSize)
+}
+
+// NameString returns the name of the file, with the directory in front unless
+// it's "$". Characters that can't be in a file name on most systems are
+// escaped. See [escapeName].
+func (entry *RawFileEntry) NameString() string {
+	if entry.Directory == rootDirectory {
+		return entry.baseName()
+	}
+	return escapeName(string(entry.Directory)) + "." + entry.baseName()
+}
+
+// baseName returns the escaped name of the file, without its directory.
+func (entry *RawFileEntry) baseName() string {
+	return escapeName(strings.TrimRight(string(entry.Name[:]), " \x00"))
+}
+
+// escapeName writes every byte of `name` that isn't printable ASCII as a
+// percent sign and two hex digits, as well as spaces, "/", and "%".
+func escapeName(name string) string {
+	var builder strings.Builder
+	for i := 0; i < len(name); i++ {
+		char := name[i]
+		if char > ' ' && char < 0x7F && char != '/' && char != '%' {
+			builder.WriteByte(char)
+		} else {
+			fmt.Fprintf(&builder, "%%%02X", char)
+		}
+	}
+	return builder.String()
+}
+
+// expandAddress converts an 18-bit address to 32 bits the way DFS does. The
+// top two bits being set means the address is in the BBC Micro's own memory
+// rather than a second processor's, which is written as FFFFxxxx.
+func expandAddress(address uint32) uint32 {
+	if address&0x30000 == 0x30000 {
+		return address | 0xFFFC0000
+	}
+	return address
+}
+
+// TitleString returns the title of the disk, without padding.
+func (catalog *Catalog) TitleString() string {
+	return strings.TrimRight(string(catalog.Title[:]), " \x00")
+}
+
+// BootOptionString returns the command used to start "!BOOT".
+func (catalog *Catalog) BootOptionString() string {
+	return bootOptionNames[catalog.BootOption]
+}
+
+// usedSectors returns the number of sectors used by the catalog and files.
+func (catalog *Catalog) usedSectors() int {
+	used := CatalogSectors
+	for i := range catalog.Entries {
+		used += int(catalog.Entries[i].Sectors())
+	}
+	return used
+}
+
+// readCatalog reads and checks the catalog at the start of `side`.
+func readCatalog(side io.ReaderAt) (*Catalog, disko.DriverError) {
+	data := make([]byte, CatalogSectors*SectorSize)
+	_, err := side.ReadAt(data, 0)
+	if err != nil {
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			"image is too small to contain a catalog")
+	}
+	names := data[:SectorSize]
+	info := data[SectorSize:]
+
+	catalog := &Catalog{
+		CycleNumber:  info[4],
+		BootOption:   info[6] >> 4 & 3,
+		TotalSectors: uint16(info[7]) | uint16(info[6]&3)<<8,
+	}
+	copy(catalog.Title[:8], names)
+	copy(catalog.Title[8:], info)
+
+	for _, char := range catalog.Title {
+		if char != 0 && (char < ' ' || char >= 0x7F) {
+			return nil, disko.ErrInvalidFileSystem.WithMessage(
+				fmt.Sprintf("disk title has the unprintable character 0x%02X", char))
+		}
+	}
+
+	entriesSize := int(info[5])
+	if entriesSize%catalogEntrySize != 0 || entriesSize > MaxFiles*catalogEntrySize {
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("catalog says its entries take %d bytes", entriesSize))
+	} else if catalog.TotalSectors < CatalogSectors || catalog.TotalSectors > MaxSectorsPerSide {
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("catalog says the disk has %d sectors", catalog.TotalSectors))
+	}
+
+	for offset := catalogEntrySize; offset <= entriesSize; offset += catalogEntrySize {
+		entry := parseRawFileEntry(names[offset:], info[offset:])
+		if entry.Directory <= ' ' || entry.Directory >= 0x7F {
+			return nil, disko.ErrInvalidFileSystem.WithMessage(
+				fmt.Sprintf("file has the invalid directory 0x%02X", entry.Directory))
+		}
+		for _, char := range entry.Name {
+			if char != 0 && (char < ' ' || char >= 0x7F) {
+				return nil, disko.ErrInvalidFileSystem.WithMessage(
+					fmt.Sprintf("file name has the unprintable character 0x%02X", char))
+			}
+		}
+
+		if entry.StartSector < CatalogSectors ||
+			int(entry.StartSector)+int(entry.Sectors()) > int(catalog.TotalSectors) {
+			return nil, disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf(
+					"%s: sectors %d through %d aren't all on the disk",
+					entry.NameString(),
+					entry.StartSector,
+					int(entry.StartSector)+int(entry.Sectors())-1,
+				),
+			)
+		}
+		catalog.Entries = append(catalog.Entries, entry)
+	}
+	return catalog, nil
+}
+
+// ConvertFlagsToStandard returns the mode of a file. DFS has no permissions, so
+// files are readable and writable by everyone unless they're locked.
+func ConvertFlagsToStandard(entry *RawFileEntry) os.FileMode {
+	if entry.Locked {
+		return 0o444
+	}
+	return 0o666
+}
@@ -0,0 +1,2 @@
+// https://en.wikipedia.org/wiki/Disc_Filing_System
+package acorndfs
@@ -0,0 +1,206 @@
+package acorndfs
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+	"github.com/dargueta/disko/file_systems/common/archivefs"
+)
+
+// Names of the extended attributes files have. Values are eight hex digits,
+// as in the .inf files used to keep them when copying files off a disk.
+const (
+	XattrLoadAddress = "acorn.load"
+	XattrExecAddress = "acorn.exec"
+)
+
+// Driver implements [disko.FileSystemImplementer] for Acorn DFS disks in SSD
+// and DSD images. It only supports mounting images read-only.
+//
+// There are no real directories, so everything besides reading the catalogs is
+// done by an [archivefs.FileSystem]. On a double-sided disk, the files on the
+// second side have ":2." and their directory in front of their names, which is
+// how DFS refers to files on drive 2.
+type Driver struct {
+	*archivefs.FileSystem
+	stream io.ReadWriteSeeker
+	sides  []diskSide
+	files  []diskFile
+	stat   disko.FSStat
+}
+
+// diskSide is one side of a disk.
+type diskSide struct {
+	reader  *sideReader
+	catalog *Catalog
+}
+
+// diskFile is a file on one of the sides of the disk.
+type diskFile struct {
+	side  *diskSide
+	entry RawFileEntry
+	name  string
+}
+
+// NewDriver creates a DFS implementation for the image in `stream`. It
+// implements [disko.ImplementerConstructor].
+func NewDriver(stream io.ReadWriteSeeker) (disko.FileSystemImplementer, disko.DriverError) {
+	return &Driver{stream: stream}, nil
+}
+
+// readSides reads the catalogs of the sides of the disk in `image`, which is
+// `size` bytes long.
+//
+// Nothing in the image says how many sides it has, so it's double-sided if
+// it's larger than the first side's catalog says that side is, and there's a
+// valid catalog where the second side would begin.
+func readSides(image io.ReaderAt, size int64) ([]diskSide, disko.DriverError) {
+	if size < CatalogSectors*SectorSize {
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			"image is too small to contain a catalog")
+	}
+
+	first := &sideReader{image: image, imageSize: size, side: 0, sides: 1}
+	catalog, err := readCatalog(first)
+	if err != nil {
+		return nil, err
+	}
+	sides := []diskSide{{reader: first, catalog: catalog}}
+	if size <= int64(catalog.TotalSectors)*SectorSize {
+		return sides, nil
+	}
+
+	second := &sideReader{image: image, imageSize: size, side: 1, sides: 2}
+	secondCatalog, err := readCatalog(second)
+	if err != nil {
+		return sides, nil
+	}
+	first.sides = 2
+	return append(sides, diskSide{reader: second, catalog: secondCatalog}), nil
+}
+
+func (driver *Driver) Mount(flags disko.MountFlags) disko.DriverError {
+	if driver.sides != nil {
+		return disko.ErrAlreadyInProgress
+	}
+
+	writeFlags := disko.MountFlagsAllowWrite |
+		disko.MountFlagsAllowInsert |
+		disko.MountFlagsAllowDelete |
+		disko.MountFlagsAllowAdminister
+	if flags&writeFlags != 0 && !flags.IsShared() {
+		return disko.ErrReadOnlyFileSystem.WithMessage(
+			"DFS images can only be mounted read-only")
+	}
+
+	size, err := driver.stream.Seek(0, io.SeekEnd)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	image, err := disks.NewWindow(driver.stream, 0, size)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+
+	sides, driverErr := readSides(image, size)
+	if driverErr != nil {
+		return driverErr
+	}
+
+	files := []diskFile{}
+	for i := range sides {
+		side := &sides[i]
+		for _, entry := range side.catalog.Entries {
+			name := entry.NameString()
+			if i > 0 {
+				name = fmt.Sprintf(":%d.%s.%s", 2*i, escapeName(string(entry.Directory)), entry.baseName())
+			}
+			files = append(files, diskFile{side: side, entry: entry, name: name})
+		}
+	}
+
+	driver.files = files
+	driver.FileSystem = archivefs.New(driver, SectorSize, Features)
+	driverErr = driver.FileSystem.Mount(flags)
+	if driverErr != nil {
+		driver.FileSystem = nil
+		driver.files = nil
+		return driverErr
+	}
+
+	driver.sides = sides
+	driver.stat = statFileSystem(sides)
+	return nil
+}
+
+// Members implements [archivefs.Archive].
+func (driver *Driver) Members() ([]archivefs.Member, error) {
+	members := make([]archivefs.Member, len(driver.files))
+	for i := range driver.files {
+		file := &driver.files[i]
+		members[i] = archivefs.Member{
+			Name:         file.name,
+			Size:         int64(file.entry.Length),
+			LastModified: disko.UndefinedTimestamp,
+			Mode:         ConvertFlagsToStandard(&file.entry),
+			Xattrs: map[string][]byte{
+				XattrLoadAddress: []byte(fmt.Sprintf("%08X", expandAddress(file.entry.LoadAddress))),
+				XattrExecAddress: []byte(fmt.Sprintf("%08X", expandAddress(file.entry.ExecAddress))),
+			},
+		}
+	}
+	return members, nil
+}
+
+// OpenMember implements [archivefs.Archive].
+func (driver *Driver) OpenMember(index int) (io.ReaderAt, error) {
+	file := &driver.files[index]
+	return io.NewSectionReader(
+		file.side.reader,
+		int64(file.entry.StartSector)*SectorSize,
+		int64(file.entry.Length),
+	), nil
+}
+
+func (driver *Driver) Unmount() disko.DriverError {
+	if driver.FileSystem != nil {
+		driver.FileSystem.Unmount()
+	}
+	driver.FileSystem = nil
+	driver.sides = nil
+	driver.files = nil
+	return nil
+}
+
+// FSStat implements [disko.FileSystemImplementer], with the space and catalog
+// entries of both sides of double-sided disks added together.
+func (driver *Driver) FSStat() disko.FSStat {
+	return driver.stat
+}
+
+func (driver *Driver) GetFSFeatures() disko.FSFeatures {
+	return Features
+}
+
+// statFileSystem returns the statistics of a disk with the given sides.
+func statFileSystem(sides []diskSide) disko.FSStat {
+	stat := disko.FSStat{
+		BlockSize:     SectorSize,
+		MaxNameLength: MaxNameLength,
+	}
+	for _, side := range sides {
+		// Files can overlap on a damaged disk.
+		free := uint64(0)
+		if used := side.catalog.usedSectors(); used < int(side.catalog.TotalSectors) {
+			free = uint64(int(side.catalog.TotalSectors) - used)
+		}
+		stat.TotalBlocks += uint64(side.catalog.TotalSectors)
+		stat.BlocksFree += free
+		stat.BlocksAvailable += free
+		stat.Files += uint64(len(side.catalog.Entries))
+		stat.FilesFree += uint64(MaxFiles - len(side.catalog.Entries))
+	}
+	return stat
+}
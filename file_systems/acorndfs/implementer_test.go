@@ -0,0 +1,248 @@
+package acorndfs_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/acorndfs"
+	diskotest "github.com/dargueta/disko/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xaionaro-go/bytesextra"
+)
+
+// dfsSide is one side of a disk, with its sectors in order.
+type dfsSide []byte
+
+// newDFSSide creates an empty side of a 40-track disk with the given title.
+func newDFSSide(title string) dfsSide {
+	side := dfsSide(make([]byte, 400*acorndfs.SectorSize))
+	copy(side[0:8], title)
+	if len(title) > 8 {
+		copy(side[256:260], title[8:])
+	}
+	side[256+7] = 400 & 0xFF
+	side[256+6] = 400 >> 8
+	return side
+}
+
+// addFile adds a file to the end of the catalog and writes its contents.
+func (side dfsSide) addFile(
+	directory byte,
+	name string,
+	locked bool,
+	load, exec uint32,
+	start int,
+	contents []byte,
+) {
+	offset := 8 + int(side[256+5])
+	side[256+5] += 8
+
+	entry := side[offset : offset+8]
+	copy(entry, "       ")
+	copy(entry, name)
+	entry[7] = directory
+	if locked {
+		entry[7] |= 0x80
+	}
+
+	info := side[256+offset : 256+offset+8]
+	length := uint32(len(contents))
+	info[0], info[1] = byte(load), byte(load>>8)
+	info[2], info[3] = byte(exec), byte(exec>>8)
+	info[4], info[5] = byte(length), byte(length>>8)
+	info[6] = byte(exec>>16&3)<<6 | byte(length>>16&3)<<4 | byte(load>>16&3)<<2 | byte(start>>8&3)
+	info[7] = byte(start)
+
+	copy(side[start*acorndfs.SectorSize:], contents)
+}
+
+// makeDSD interleaves the tracks of two sides into a DSD image.
+func makeDSD(first, second dfsSide) []byte {
+	const trackSize = acorndfs.SectorsPerTrack * acorndfs.SectorSize
+	image := []byte{}
+	for offset := 0; offset < len(first); offset += trackSize {
+		image = append(image, first[offset:offset+trackSize]...)
+		image = append(image, second[offset:offset+trackSize]...)
+	}
+	return image
+}
+
+var (
+	bootScript = []byte("CHAIN \"GAME\"\r")
+	gameData   = bytes.Repeat([]byte{0x20, 0x00, 0x19, 0x60}, 200)
+)
+
+// makeSSD creates a side with these files:
+//
+//	$.!BOOT  script run by *EXEC
+//	$.GAME   locked program of 800 bytes loaded at &1900
+//	B.SAVE/1 empty data file in directory B
+func makeSSD() dfsSide {
+	side := newDFSSide("HELLO WORLD!")
+	side[256+6] |= acorndfs.BootOptionExec << 4
+	side.addFile('$', "!BOOT", false, 0, 0, 2, bootScript)
+	side.addFile('$', "GAME", true, 0x31900, 0x38023, 3, gameData)
+	side.addFile('B', "SAVE/1", false, 0x3000, 0x3000, 7, nil)
+	return side
+}
+
+func mount(t *testing.T, image []byte) (*driver.BaseDriver, disko.FileSystemImplementer) {
+	implementation := diskotest.MountImplementer(
+		t, acorndfs.NewDriver, image, disko.MountFlagsAllowRead)
+	return driver.New(implementation, disko.MountFlagsAllowRead), implementation
+}
+
+func TestDriver__ReadFiles(t *testing.T) {
+	image := makeSSD()
+	assert.True(t, acorndfs.Detect(bytes.NewReader(image), int64(len(image))))
+	fs, implementation := mount(t, image)
+
+	entries, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"!BOOT", "GAME", "B.SAVE%2F1"}, names)
+
+	data, err := fs.ReadFile("/!BOOT")
+	require.NoError(t, err)
+	assert.Equal(t, bootScript, data)
+
+	data, err = fs.ReadFile("/GAME")
+	require.NoError(t, err)
+	assert.Equal(t, gameData, data)
+
+	data, err = fs.ReadFile("/B.SAVE%2F1")
+	require.NoError(t, err)
+	assert.Empty(t, data)
+
+	stat, err := fs.Stat("/GAME")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o444), stat.ModeFlags)
+
+	fsStat := implementation.FSStat()
+	assert.EqualValues(t, 400, fsStat.TotalBlocks)
+	assert.EqualValues(t, 400-2-1-4, fsStat.BlocksFree)
+	assert.EqualValues(t, 3, fsStat.Files)
+	assert.EqualValues(t, 28, fsStat.FilesFree)
+}
+
+// Load and execution addresses are extended attributes, with addresses in the
+// I/O processor written as FFFFxxxx.
+func TestDriver__Addresses(t *testing.T) {
+	fs, _ := mount(t, makeSSD())
+
+	names, err := fs.ListXattrs("/GAME")
+	require.NoError(t, err)
+	assert.Equal(t, []string{acorndfs.XattrExecAddress, acorndfs.XattrLoadAddress}, names)
+
+	value, err := fs.GetXattr("/GAME", acorndfs.XattrLoadAddress)
+	require.NoError(t, err)
+	assert.Equal(t, "FFFF1900", string(value))
+
+	value, err = fs.GetXattr("/GAME", acorndfs.XattrExecAddress)
+	require.NoError(t, err)
+	assert.Equal(t, "FFFF8023", string(value))
+
+	value, err = fs.GetXattr("/B.SAVE%2F1", acorndfs.XattrLoadAddress)
+	require.NoError(t, err)
+	assert.Equal(t, "00003000", string(value))
+}
+
+// SSD images are often cut off after the last sector in use.
+func TestDriver__TruncatedImage(t *testing.T) {
+	image := makeSSD()[:3*acorndfs.SectorSize+100]
+	assert.True(t, acorndfs.Detect(bytes.NewReader(image), int64(len(image))))
+
+	fs, _ := mount(t, image)
+	data, err := fs.ReadFile("/GAME")
+	require.NoError(t, err)
+	assert.Equal(t, gameData[:100], data[:100])
+	assert.Equal(t, make([]byte, len(gameData)-100), data[100:])
+}
+
+func TestDriver__DoubleSided(t *testing.T) {
+	second := newDFSSide("SIDE TWO")
+	second.addFile('$', "README", false, 0, 0, 2, []byte("Hello from drive 2\r"))
+	second.addFile('C', "CODE", false, 0x1100, 0x1100, 12, gameData)
+	image := makeDSD(makeSSD(), second)
+	assert.True(t, acorndfs.Detect(bytes.NewReader(image), int64(len(image))))
+
+	fs, implementation := mount(t, image)
+	entries, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(
+		t, []string{"!BOOT", "GAME", "B.SAVE%2F1", ":2.$.README", ":2.C.CODE"}, names)
+
+	data, err := fs.ReadFile("/GAME")
+	require.NoError(t, err)
+	assert.Equal(t, gameData, data)
+
+	// Sector 12 is on the second track, so this only works if the tracks of
+	// the two sides are told apart.
+	data, err = fs.ReadFile("/:2.C.CODE")
+	require.NoError(t, err)
+	assert.Equal(t, gameData, data)
+
+	fsStat := implementation.FSStat()
+	assert.EqualValues(t, 800, fsStat.TotalBlocks)
+	assert.EqualValues(t, 5, fsStat.Files)
+
+	description, driverErr := acorndfs.Describe(bytes.NewReader(image), int64(len(image)))
+	require.NoError(t, driverErr)
+	assert.Contains(t, description.Header, disko.HeaderField{Name: "Drive 2: Title", Value: "SIDE TWO"})
+}
+
+func TestDriver__FileOffDisk(t *testing.T) {
+	image := newDFSSide("BAD")
+	image.addFile('$', "BIG", false, 0, 0, 399, gameData)
+
+	implementation, err := acorndfs.NewDriver(bytesextra.NewReadWriteSeeker(image))
+	require.NoError(t, err)
+	err = implementation.Mount(disko.MountFlagsAllowRead)
+	assert.ErrorIs(t, err, disko.ErrFileSystemCorrupted)
+	assert.ErrorContains(t, err, "BIG: sectors 399 through 402 aren't all on the disk")
+}
+
+func TestDescribe(t *testing.T) {
+	image := makeSSD()
+	description, err := acorndfs.Describe(bytes.NewReader(image), int64(len(image)))
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		[]disko.HeaderField{
+			{Name: "Sides", Value: 1},
+			{Name: "Title", Value: "HELLO WORLD!"},
+			{Name: "Cycle number", Value: uint8(0)},
+			{Name: "Boot option", Value: "*EXEC"},
+			{Name: "Sectors", Value: uint16(400)},
+			{Name: "Files", Value: 3},
+		},
+		description.Header,
+	)
+}
+
+func TestDetect(t *testing.T) {
+	binary := makeSSD()
+	binary[3] = 0x01
+
+	diskotest.RunDetectConformanceTests(
+		t,
+		acorndfs.Detect,
+		makeSSD(),
+		map[string][]byte{"binary in the title": binary},
+	)
+}
+
+func TestDriver__Conformance(t *testing.T) {
+	diskotest.RunReadOnlyConformanceTests(t, acorndfs.NewDriver, makeSSD())
+}
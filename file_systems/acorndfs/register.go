@@ -0,0 +1,69 @@
+package acorndfs
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+// Features gives the features supported by Acorn DFS.
+var Features = disko.FSFeatures{
+	DefaultNameEncoding: disko.FSTextEncodingASCII,
+	DefaultBlockSize:    SectorSize,
+	MinTotalBlocks:      40 * SectorsPerTrack,
+	MaxTotalBlocks:      2 * MaxSectorsPerSide,
+	MaxVolumeLabelSize:  12,
+	// Lengths are stored in 18 bits.
+	MaxFileSize: 1<<18 - 1,
+}
+
+func init() {
+	disko.RegisterFileSystem(
+		disko.FileSystemRegistration{
+			Name:        "acorndfs",
+			Description: "Acorn DFS (SSD or DSD image)",
+			Features:    Features,
+			Detect:      Detect,
+			Describe:    Describe,
+			New:         NewDriver,
+		},
+	)
+}
+
+// Detect returns true if `image` appears to be an SSD or DSD image of an Acorn
+// DFS disk. It implements the detection function for
+// [disko.FileSystemRegistration].
+//
+// There's no magic number, so this relies on the catalog holding printable
+// names, and files that fit on the disk.
+func Detect(image io.ReaderAt, size int64) bool {
+	_, err := readSides(image, size)
+	return err == nil
+}
+
+// Describe decodes the catalogs of an image. It implements the description
+// function for [disko.FileSystemRegistration].
+func Describe(image io.ReaderAt, size int64) (disko.ImageDescription, disko.DriverError) {
+	sides, err := readSides(image, size)
+	if err != nil {
+		return disko.ImageDescription{}, err
+	}
+
+	header := []disko.HeaderField{{Name: "Sides", Value: len(sides)}}
+	for i, side := range sides {
+		prefix := ""
+		if len(sides) > 1 {
+			prefix = fmt.Sprintf("Drive %d: ", 2*i)
+		}
+		header = append(
+			header,
+			disko.HeaderField{Name: prefix + "Title", Value: side.catalog.TitleString()},
+			disko.HeaderField{Name: prefix + "Cycle number", Value: side.catalog.CycleNumber},
+			disko.HeaderField{Name: prefix + "Boot option", Value: side.catalog.BootOptionString()},
+			disko.HeaderField{Name: prefix + "Sectors", Value: side.catalog.TotalSectors},
+			disko.HeaderField{Name: prefix + "Files", Value: len(side.catalog.Entries)},
+		)
+	}
+	return disko.ImageDescription{Stat: statFileSystem(sides), Header: header}, nil
+}
@@ -0,0 +1,66 @@
+package acorndfs
+
+import (
+	"io"
+)
+
+// sideReader is an [io.ReaderAt] for one side of a disk, as if its sectors were
+// stored one after the other. Sectors past the end of the image read as null
+// bytes, since SSD images are often cut off after the last sector in use.
+type sideReader struct {
+	image     io.ReaderAt
+	imageSize int64
+	side      int
+	// sides is the number of sides in the image, whose tracks alternate.
+	sides int
+}
+
+// imageOffset returns the offset in the image of `offset` bytes into the side.
+func (reader *sideReader) imageOffset(offset int64) int64 {
+	const trackSize = SectorsPerTrack * SectorSize
+	track := offset / trackSize
+	return (track*int64(reader.sides)+int64(reader.side))*trackSize + offset%trackSize
+}
+
+func (reader *sideReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	const trackSize = SectorsPerTrack * SectorSize
+	if offset >= MaxSectorsPerSide*SectorSize {
+		return 0, io.EOF
+	}
+
+	n := 0
+	for n < len(buffer) && offset+int64(n) < MaxSectorsPerSide*SectorSize {
+		position := offset + int64(n)
+		chunk := buffer[n:]
+		if remaining := trackSize - position%trackSize; int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+
+		start := reader.imageOffset(position)
+		available := reader.imageSize - start
+		if available < 0 {
+			available = 0
+		}
+		if available < int64(len(chunk)) {
+			for i := available; i < int64(len(chunk)); i++ {
+				chunk[i] = 0
+			}
+		}
+		if available > 0 {
+			toRead := chunk
+			if int64(len(toRead)) > available {
+				toRead = toRead[:available]
+			}
+			_, err := reader.image.ReadAt(toRead, start)
+			if err != nil {
+				return n, err
+			}
+		}
+		n += len(chunk)
+	}
+
+	if n < len(buffer) {
+		return n, io.EOF
+	}
+	return n, nil
+}
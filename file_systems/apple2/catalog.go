@@ -0,0 +1,159 @@
+package apple2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dargueta/disko"
+)
+
+const (
+	// FileEntrySize is the size of a file entry in the catalog, in bytes.
+	FileEntrySize = 35
+	// FileEntriesPerSector is the number of file entries in a catalog sector.
+	FileEntriesPerSector = 7
+	// MaxNameLength is the length of the longest file name.
+	MaxNameLength = 30
+)
+
+// catalogEntriesOffset is the offset of the first file entry in a catalog
+// sector.
+const catalogEntriesOffset = 0x0B
+
+// Values of the track of a file entry's first track/sector list with special
+// meanings.
+const (
+	// entryTrackUnused marks an entry that has never been used. DOS stops
+	// searching the catalog at the first one of these.
+	entryTrackUnused = 0x00
+	// entryTrackDeleted marks a deleted file. The original track is moved to
+	// the last byte of the name.
+	entryTrackDeleted = 0xFF
+)
+
+// File types, in the low seven bits of [RawFileEntry.TypeFlags].
+const (
+	FileTypeText       = 0x00
+	FileTypeInteger    = 0x01
+	FileTypeApplesoft  = 0x02
+	FileTypeBinary     = 0x04
+	FileTypeS          = 0x08
+	FileTypeRelocating = 0x10
+	FileTypeA          = 0x20
+	FileTypeB          = 0x40
+)
+
+// FlagLocked is set in [RawFileEntry.TypeFlags] if the file is locked.
+const FlagLocked = 0x80
+
+// RawFileEntry is an entry in the catalog.
+type RawFileEntry struct {
+	FirstTSList TrackSector
+	TypeFlags   uint8
+	// Name is the file name in ASCII with the high bit set, padded with spaces.
+	Name [MaxNameLength]byte
+	// SectorCount is the number of sectors the file uses, including its
+	// track/sector lists.
+	SectorCount uint16
+}
+
+// parseRawFileEntry decodes a file entry.
+func parseRawFileEntry(data []byte) RawFileEntry {
+	entry := RawFileEntry{
+		FirstTSList: parseTrackSector(data[0x00:]),
+		TypeFlags:   data[0x02],
+		SectorCount: binary.LittleEndian.Uint16(data[0x21:]),
+	}
+	copy(entry.Name[:], data[0x03:0x21])
+	return entry
+}
+
+// IsUnused returns true if the entry has never been used.
+func (entry *RawFileEntry) IsUnused() bool {
+	return entry.FirstTSList.Track == entryTrackUnused
+}
+
+// IsDeleted returns true if the entry is for a deleted file.
+func (entry *RawFileEntry) IsDeleted() bool {
+	return entry.FirstTSList.Track == entryTrackDeleted
+}
+
+// FileType returns the type of the file, without the locked flag.
+func (entry *RawFileEntry) FileType() uint8 {
+	return entry.TypeFlags &^ FlagLocked
+}
+
+// NameString returns the name of the file in ASCII, without the spaces padding
+// it.
+func (entry *RawFileEntry) NameString() string {
+	name := make([]byte, len(entry.Name))
+	for i, char := range entry.Name {
+		name[i] = char & 0x7F
+	}
+	return string(bytes.TrimRight(name, " "))
+}
+
+// catalog is the contents of the catalog.
+type catalog struct {
+	// entries holds the file entries up to the first unused one.
+	entries []RawFileEntry
+	// capacity is the number of entries in all catalog sectors, used or not.
+	capacity int
+}
+
+// readCatalog follows the chain of catalog sectors beginning at the one given
+// in the VTOC, and reads the file entries up to the first unused one.
+func readCatalog(image io.ReaderAt, vtoc *RawVTOC) (catalog, disko.DriverError) {
+	result := catalog{}
+	reachedEnd := false
+	visited := map[TrackSector]bool{}
+
+	for location := vtoc.FirstCatalogSector; !location.IsZero(); {
+		if visited[location] {
+			return catalog{}, disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf("catalog sector chain has a cycle at %s", location))
+		}
+		visited[location] = true
+
+		data, err := readSector(image, vtoc, location)
+		if err != nil {
+			return catalog{}, err
+		}
+
+		for i := 0; i < FileEntriesPerSector && !reachedEnd; i++ {
+			entry := parseRawFileEntry(data[catalogEntriesOffset+i*FileEntrySize:])
+			if entry.IsUnused() {
+				reachedEnd = true
+			} else {
+				result.entries = append(result.entries, entry)
+			}
+		}
+		result.capacity += FileEntriesPerSector
+		location = parseTrackSector(data[0x01:])
+	}
+	return result, nil
+}
+
+// countFiles returns the number of entries in `entries` that aren't deleted.
+func countFiles(entries []RawFileEntry) int {
+	count := 0
+	for i := range entries {
+		if !entries[i].IsDeleted() {
+			count++
+		}
+	}
+	return count
+}
+
+// ConvertFlagsToStandard returns the mode of a file with the given type and
+// flags. DOS has no permissions, so files are readable and writable by everyone
+// unless they're locked.
+func ConvertFlagsToStandard(typeFlags uint8) os.FileMode {
+	if typeFlags&FlagLocked != 0 {
+		return 0o444
+	}
+	return 0o666
+}
@@ -0,0 +1,2 @@
+// https://en.wikipedia.org/wiki/Apple_DOS
+package apple2
@@ -0,0 +1,170 @@
+package apple2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+// Offsets of the fields of a track/sector list.
+const (
+	// tsListFirstIndexOffset is the offset of the index in the file of the
+	// first sector the list gives.
+	tsListFirstIndexOffset = 0x05
+	tsListPairsOffset      = 0x0C
+	// maxTSPairs is the number of track/sector pairs that fit in a list.
+	maxTSPairs = (SectorSize - tsListPairsOffset) / 2
+)
+
+// fileSectors follows the track/sector lists of the file with catalog entry
+// `entry`, and returns the locations of its data sectors in order. Sectors that
+// were never written are zero.
+func fileSectors(image io.ReaderAt, vtoc *RawVTOC, entry *RawFileEntry) ([]TrackSector, disko.DriverError) {
+	name := entry.NameString()
+	sectors := []TrackSector{}
+	visited := map[TrackSector]bool{}
+
+	for list := entry.FirstTSList; !list.IsZero(); {
+		if visited[list] {
+			return nil, disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf("%s: track/sector list chain has a cycle at %s", name, list))
+		}
+		visited[list] = true
+
+		data, err := readSector(image, vtoc, list)
+		if err != nil {
+			return nil, err
+		}
+
+		firstIndex := int(binary.LittleEndian.Uint16(data[tsListFirstIndexOffset:]))
+		for i := 0; i < int(vtoc.MaxTSPairs); i++ {
+			location := parseTrackSector(data[tsListPairsOffset+2*i:])
+			if location.IsZero() {
+				continue
+			}
+
+			index := firstIndex + i
+			if !vtoc.isValidSector(location) {
+				return nil, disko.ErrFileSystemCorrupted.WithMessage(
+					fmt.Sprintf("%s: sector %d is at %s, which isn't on the disk", name, index, location))
+			} else if index >= vtoc.totalSectors() {
+				return nil, disko.ErrFileSystemCorrupted.WithMessage(
+					fmt.Sprintf("%s: has sector %d, but the disk only has %d", name, index, vtoc.totalSectors()))
+			}
+
+			for len(sectors) <= index {
+				sectors = append(sectors, TrackSector{})
+			}
+			sectors[index] = location
+		}
+		list = parseTrackSector(data[0x01:])
+	}
+	return sectors, nil
+}
+
+// fileSize returns the size of the file with catalog entry `entry` and data in
+// `sectors`. See the package documentation for how it's determined.
+func fileSize(
+	image io.ReaderAt,
+	vtoc *RawVTOC,
+	entry *RawFileEntry,
+	sectors []TrackSector,
+) (int64, disko.DriverError) {
+	dataSize := int64(len(sectors)) * SectorSize
+	if len(sectors) == 0 {
+		return 0, nil
+	}
+
+	var headerSize int64
+	var lengthOffset int
+	switch entry.FileType() {
+	case FileTypeBinary:
+		headerSize, lengthOffset = 4, 2
+	case FileTypeInteger, FileTypeApplesoft:
+		headerSize, lengthOffset = 2, 0
+	case FileTypeText:
+		return textFileSize(image, vtoc, sectors)
+	default:
+		return dataSize, nil
+	}
+
+	if sectors[0].IsZero() {
+		return dataSize, nil
+	}
+	data, err := readSector(image, vtoc, sectors[0])
+	if err != nil {
+		return 0, err
+	}
+
+	// A length that doesn't fit in the file's sectors is wrong, but the data
+	// is still there, so return all of it.
+	size := headerSize + int64(binary.LittleEndian.Uint16(data[lengthOffset:]))
+	if size > dataSize {
+		return dataSize, nil
+	}
+	return size, nil
+}
+
+// textFileSize returns the size of a text file with data in `sectors`, which
+// ends after its last non-null byte.
+func textFileSize(image io.ReaderAt, vtoc *RawVTOC, sectors []TrackSector) (int64, disko.DriverError) {
+	for i := len(sectors) - 1; i >= 0; i-- {
+		if sectors[i].IsZero() {
+			continue
+		}
+
+		data, err := readSector(image, vtoc, sectors[i])
+		if err != nil {
+			return 0, err
+		}
+		trimmed := bytes.TrimRight(data, "\x00")
+		if len(trimmed) > 0 {
+			return int64(i)*SectorSize + int64(len(trimmed)), nil
+		}
+	}
+	return 0, nil
+}
+
+// fileReader is an [io.ReaderAt] for the contents of a file.
+type fileReader struct {
+	image   io.ReaderAt
+	sectors []TrackSector
+	size    int64
+}
+
+func (reader *fileReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	n := 0
+	for n < len(buffer) && offset+int64(n) < reader.size {
+		position := offset + int64(n)
+		location := reader.sectors[position/SectorSize]
+		start := position % SectorSize
+
+		chunk := buffer[n:]
+		if int64(len(chunk)) > SectorSize-start {
+			chunk = chunk[:SectorSize-start]
+		}
+		if int64(len(chunk)) > reader.size-position {
+			chunk = chunk[:reader.size-position]
+		}
+
+		if location.IsZero() {
+			for i := range chunk {
+				chunk[i] = 0
+			}
+		} else {
+			_, err := reader.image.ReadAt(chunk, sectorOffset(location)+start)
+			if err != nil {
+				return n, err
+			}
+		}
+		n += len(chunk)
+	}
+
+	if n < len(buffer) {
+		return n, io.EOF
+	}
+	return n, nil
+}
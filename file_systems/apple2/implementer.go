@@ -0,0 +1,144 @@
+package apple2
+
+import (
+	"io"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+	"github.com/dargueta/disko/file_systems/common/archivefs"
+)
+
+// Driver implements [disko.FileSystemImplementer] for Apple DOS 3.3 disks in
+// DOS-order images. It only supports mounting images read-only.
+//
+// The disk has no subdirectories, so everything besides reading the VTOC, the
+// catalog, and track/sector lists is done by an [archivefs.FileSystem]. Each
+// file's lists are read when the disk is mounted, since that's the only way to
+// get its size.
+type Driver struct {
+	*archivefs.FileSystem
+	stream io.ReadWriteSeeker
+	image  *disks.Section
+	vtoc   *RawVTOC
+	files  []diskFile
+	stat   disko.FSStat
+}
+
+// diskFile is a file on the disk.
+type diskFile struct {
+	entry   RawFileEntry
+	sectors []TrackSector
+	size    int64
+}
+
+// NewDriver creates an Apple DOS implementation for the image in `stream`. It
+// implements [disko.ImplementerConstructor].
+func NewDriver(stream io.ReadWriteSeeker) (disko.FileSystemImplementer, disko.DriverError) {
+	return &Driver{stream: stream}, nil
+}
+
+func (driver *Driver) Mount(flags disko.MountFlags) disko.DriverError {
+	if driver.vtoc != nil {
+		return disko.ErrAlreadyInProgress
+	}
+
+	writeFlags := disko.MountFlagsAllowWrite |
+		disko.MountFlagsAllowInsert |
+		disko.MountFlagsAllowDelete |
+		disko.MountFlagsAllowAdminister
+	if flags&writeFlags != 0 && !flags.IsShared() {
+		return disko.ErrReadOnlyFileSystem.WithMessage(
+			"Apple DOS images can only be mounted read-only")
+	}
+
+	size, err := driver.stream.Seek(0, io.SeekEnd)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	image, err := disks.NewWindow(driver.stream, 0, size)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+
+	vtoc, driverErr := readVTOC(image, size)
+	if driverErr != nil {
+		return driverErr
+	}
+	catalog, driverErr := readCatalog(image, vtoc)
+	if driverErr != nil {
+		return driverErr
+	}
+
+	files := []diskFile{}
+	for i := range catalog.entries {
+		entry := &catalog.entries[i]
+		if entry.IsDeleted() {
+			continue
+		}
+
+		sectors, driverErr := fileSectors(image, vtoc, entry)
+		if driverErr != nil {
+			return driverErr
+		}
+		size, driverErr := fileSize(image, vtoc, entry, sectors)
+		if driverErr != nil {
+			return driverErr
+		}
+		files = append(files, diskFile{entry: *entry, sectors: sectors, size: size})
+	}
+
+	driver.image = image
+	driver.files = files
+	driver.FileSystem = archivefs.New(driver, SectorSize, Features)
+	driverErr = driver.FileSystem.Mount(flags)
+	if driverErr != nil {
+		driver.FileSystem = nil
+		driver.files = nil
+		return driverErr
+	}
+
+	driver.vtoc = vtoc
+	driver.stat = statFileSystem(vtoc, len(files), catalog.capacity)
+	return nil
+}
+
+// Members implements [archivefs.Archive].
+func (driver *Driver) Members() ([]archivefs.Member, error) {
+	members := make([]archivefs.Member, len(driver.files))
+	for i, file := range driver.files {
+		members[i] = archivefs.Member{
+			Name:         file.entry.NameString(),
+			Size:         file.size,
+			LastModified: disko.UndefinedTimestamp,
+			Mode:         ConvertFlagsToStandard(file.entry.TypeFlags),
+		}
+	}
+	return members, nil
+}
+
+// OpenMember implements [archivefs.Archive].
+func (driver *Driver) OpenMember(index int) (io.ReaderAt, error) {
+	file := &driver.files[index]
+	return &fileReader{image: driver.image, sectors: file.sectors, size: file.size}, nil
+}
+
+func (driver *Driver) Unmount() disko.DriverError {
+	if driver.FileSystem != nil {
+		driver.FileSystem.Unmount()
+	}
+	driver.FileSystem = nil
+	driver.image = nil
+	driver.vtoc = nil
+	driver.files = nil
+	return nil
+}
+
+// FSStat implements [disko.FileSystemImplementer], with the free space from
+// the VTOC.
+func (driver *Driver) FSStat() disko.FSStat {
+	return driver.stat
+}
+
+func (driver *Driver) GetFSFeatures() disko.FSFeatures {
+	return Features
+}
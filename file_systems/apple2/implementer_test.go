@@ -0,0 +1,211 @@
+package apple2_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/apple2"
+	diskotest "github.com/dargueta/disko/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xaionaro-go/bytesextra"
+)
+
+// dos33Image is a DOS-order image of a 35-track disk.
+type dos33Image []byte
+
+// newDOS33Image creates an image of an empty disk with the catalog in track 17
+// sectors 15 to 1, and tracks 3 and up free except for track 17.
+func newDOS33Image() dos33Image {
+	image := dos33Image(make([]byte, apple2.StandardTracks*apple2.SectorsPerTrack*apple2.SectorSize))
+
+	vtoc := image.sector(apple2.VTOCTrack, 0)
+	vtoc[0x01] = apple2.VTOCTrack
+	vtoc[0x02] = 15
+	vtoc[0x03] = 3
+	vtoc[0x06] = 254
+	vtoc[0x27] = 122
+	vtoc[0x34] = apple2.StandardTracks
+	vtoc[0x35] = apple2.SectorsPerTrack
+	binary.LittleEndian.PutUint16(vtoc[0x36:], apple2.SectorSize)
+	for track := 3; track < apple2.StandardTracks; track++ {
+		if track != apple2.VTOCTrack {
+			vtoc[0x38+4*track] = 0xFF
+			vtoc[0x39+4*track] = 0xFF
+		}
+	}
+
+	for sector := 15; sector > 1; sector-- {
+		catalog := image.sector(apple2.VTOCTrack, sector)
+		catalog[0x01] = apple2.VTOCTrack
+		catalog[0x02] = byte(sector - 1)
+	}
+	return image
+}
+
+func (image dos33Image) sector(track, sector int) []byte {
+	offset := (track*apple2.SectorsPerTrack + sector) * apple2.SectorSize
+	return image[offset : offset+apple2.SectorSize]
+}
+
+// setEntry fills in entry `index` of the catalog.
+func (image dos33Image) setEntry(index int, tsList apple2.TrackSector, typeFlags byte, name string) {
+	entry := image.sector(apple2.VTOCTrack, 15-index/7)[0x0B+35*(index%7):]
+	entry[0x00] = tsList.Track
+	entry[0x01] = tsList.Sector
+	entry[0x02] = typeFlags
+	for i := 0; i < 30; i++ {
+		entry[0x03+i] = ' ' | 0x80
+		if i < len(name) {
+			entry[0x03+i] = name[i] | 0x80
+		}
+	}
+}
+
+// writeTSList writes a track/sector list at `location` giving the sectors of
+// the file beginning at index `firstIndex`.
+func (image dos33Image) writeTSList(
+	location apple2.TrackSector,
+	next apple2.TrackSector,
+	firstIndex int,
+	sectors ...apple2.TrackSector,
+) {
+	list := image.sector(int(location.Track), int(location.Sector))
+	list[0x01] = next.Track
+	list[0x02] = next.Sector
+	binary.LittleEndian.PutUint16(list[0x05:], uint16(firstIndex))
+	for i, sector := range sectors {
+		list[0x0C+2*i] = sector.Track
+		list[0x0D+2*i] = sector.Sector
+	}
+}
+
+func ts(track, sector uint8) apple2.TrackSector {
+	return apple2.TrackSector{Track: track, Sector: sector}
+}
+
+var (
+	helloProgram = []byte{0x05, 0x00, 0x01, 0x02, 0x03, 0x04, 0x05}
+	binaryFile   = append([]byte{0x00, 0x20, 0x2C, 0x01}, bytes.Repeat([]byte{0xEA}, 300)...)
+	notesText    = append(append(bytes.Repeat([]byte("NOTE\x8D"), 51), make([]byte, 257)...), "END"...)
+)
+
+// makeDOS33Image creates a disk with these files:
+//
+//	HELLO     Applesoft program of 5 bytes
+//	OLD       deleted
+//	BIN FILE  locked binary file of 300 bytes, in two sectors
+//	NOTES     text file with a sector that was never written
+//	RANDOM    S file with two track/sector lists
+func makeDOS33Image() dos33Image {
+	image := newDOS33Image()
+
+	image.setEntry(0, ts(19, 15), apple2.FileTypeApplesoft, "HELLO")
+	image.writeTSList(ts(19, 15), ts(0, 0), 0, ts(19, 14))
+	copy(image.sector(19, 14), helloProgram)
+
+	image.setEntry(1, ts(0xFF, 0), apple2.FileTypeText, "OLD")
+
+	image.setEntry(2, ts(20, 15), apple2.FileTypeBinary|apple2.FlagLocked, "BIN FILE")
+	image.writeTSList(ts(20, 15), ts(0, 0), 0, ts(20, 0), ts(20, 1))
+	copy(image.sector(20, 0), binaryFile)
+	copy(image.sector(20, 1), binaryFile[256:])
+	image.sector(20, 1)[100] = 0xFF // Past the end of the file
+
+	image.setEntry(3, ts(21, 15), apple2.FileTypeText, "NOTES")
+	image.writeTSList(ts(21, 15), ts(0, 0), 0, ts(21, 0), ts(0, 0), ts(21, 1))
+	copy(image.sector(21, 0), notesText)
+	copy(image.sector(21, 1), notesText[512:])
+
+	image.setEntry(4, ts(22, 15), apple2.FileTypeS, "RANDOM")
+	image.writeTSList(ts(22, 15), ts(22, 14), 0, ts(22, 0))
+	image.writeTSList(ts(22, 14), ts(0, 0), 122, ts(22, 1))
+	image.sector(22, 0)[0] = 'A'
+	image.sector(22, 1)[255] = 'Z'
+	return image
+}
+
+func mount(t *testing.T, image []byte) (*driver.BaseDriver, disko.FileSystemImplementer) {
+	implementation := diskotest.MountImplementer(
+		t, apple2.NewDriver, image, disko.MountFlagsAllowRead)
+	return driver.New(implementation, disko.MountFlagsAllowRead), implementation
+}
+
+func TestDriver__ReadFiles(t *testing.T) {
+	image := makeDOS33Image()
+	assert.True(t, apple2.Detect(bytes.NewReader(image), int64(len(image))))
+	fs, implementation := mount(t, image)
+
+	entries, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"HELLO", "BIN FILE", "NOTES", "RANDOM"}, names)
+
+	data, err := fs.ReadFile("/HELLO")
+	require.NoError(t, err)
+	assert.Equal(t, helloProgram, data)
+
+	data, err = fs.ReadFile("/BIN FILE")
+	require.NoError(t, err)
+	assert.Equal(t, binaryFile, data)
+
+	data, err = fs.ReadFile("/NOTES")
+	require.NoError(t, err)
+	assert.Equal(t, notesText, data)
+
+	data, err = fs.ReadFile("/RANDOM")
+	require.NoError(t, err)
+	require.Len(t, data, 123*apple2.SectorSize)
+	assert.EqualValues(t, 'A', data[0])
+	assert.EqualValues(t, 'Z', data[len(data)-1])
+	assert.Equal(t, make([]byte, 121*apple2.SectorSize), data[256:122*256])
+
+	stat, err := fs.Stat("/BIN FILE")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o444), stat.ModeFlags)
+
+	_, err = fs.Stat("/OLD")
+	assert.ErrorIs(t, err, disko.ErrNotFound)
+
+	fsStat := implementation.FSStat()
+	assert.EqualValues(t, 256, fsStat.BlockSize)
+	assert.EqualValues(t, 560, fsStat.TotalBlocks)
+	assert.EqualValues(t, 31*16, fsStat.BlocksFree)
+	assert.EqualValues(t, 4, fsStat.Files)
+	assert.EqualValues(t, 15*7-4, fsStat.FilesFree)
+}
+
+func TestDriver__TSListCycle(t *testing.T) {
+	image := makeDOS33Image()
+	image.writeTSList(ts(22, 14), ts(22, 15), 122, ts(22, 1))
+
+	implementation, err := apple2.NewDriver(bytesextra.NewReadWriteSeeker(image))
+	require.NoError(t, err)
+	err = implementation.Mount(disko.MountFlagsAllowRead)
+	assert.ErrorIs(t, err, disko.ErrFileSystemCorrupted)
+	assert.ErrorContains(t, err, "RANDOM: track/sector list chain has a cycle at T22 S15")
+}
+
+func TestDetect(t *testing.T) {
+	// 13-sector disks aren't supported.
+	thirteenSector := makeDOS33Image()
+	thirteenSector.sector(apple2.VTOCTrack, 0)[0x35] = 13
+
+	diskotest.RunDetectConformanceTests(
+		t,
+		apple2.Detect,
+		makeDOS33Image(),
+		map[string][]byte{"13-sector disk": thirteenSector},
+	)
+}
+
+func TestDriver__Conformance(t *testing.T) {
+	diskotest.RunReadOnlyConformanceTests(t, apple2.NewDriver, makeDOS33Image())
+}
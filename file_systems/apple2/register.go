@@ -0,0 +1,76 @@
+package apple2
+
+import (
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+// Features gives the features supported by Apple DOS 3.3.
+var Features = disko.FSFeatures{
+	DefaultNameEncoding: disko.FSTextEncodingASCII,
+	// DOS itself is stored on the first three tracks, and booting a disk loads
+	// it from there.
+	SupportsBootCode: true,
+	MaxBootCodeSize:  3 * SectorsPerTrack * SectorSize,
+	DefaultBlockSize: SectorSize,
+	MinTotalBlocks:   (VTOCTrack + 1) * SectorsPerTrack,
+	MaxTotalBlocks:   MaxTracks * SectorsPerTrack,
+	// A file can't be larger than the largest disk.
+	MaxFileSize: MaxTracks * SectorsPerTrack * SectorSize,
+}
+
+func init() {
+	disko.RegisterFileSystem(
+		disko.FileSystemRegistration{
+			Name:        "apple2",
+			Description: "Apple DOS 3.3 (DOS-order image)",
+			Features:    Features,
+			Detect:      Detect,
+			Describe:    Describe,
+			New:         NewDriver,
+		},
+	)
+}
+
+// Detect returns true if `image` appears to be a DOS-order image of an Apple
+// DOS 3.3 disk. It implements the detection function for
+// [disko.FileSystemRegistration].
+//
+// There's no magic number, so this relies on the VTOC describing a disk that
+// fits in the image, with a catalog that can be read.
+func Detect(image io.ReaderAt, size int64) bool {
+	vtoc, err := readVTOC(image, size)
+	if err != nil {
+		return false
+	}
+	_, err = readCatalog(image, vtoc)
+	return err == nil
+}
+
+// Describe decodes the VTOC of an image, and counts the files in the catalog.
+// It implements the description function for [disko.FileSystemRegistration].
+func Describe(image io.ReaderAt, size int64) (disko.ImageDescription, disko.DriverError) {
+	vtoc, err := readVTOC(image, size)
+	if err != nil {
+		return disko.ImageDescription{}, err
+	}
+	catalog, err := readCatalog(image, vtoc)
+	if err != nil {
+		return disko.ImageDescription{}, err
+	}
+
+	files := countFiles(catalog.entries)
+	return disko.ImageDescription{
+		Stat: statFileSystem(vtoc, files, catalog.capacity),
+		Header: []disko.HeaderField{
+			{Name: "DOS release", Value: vtoc.DOSRelease},
+			{Name: "Volume number", Value: vtoc.VolumeNumber},
+			{Name: "Tracks", Value: vtoc.Tracks},
+			{Name: "Sectors per track", Value: vtoc.SectorsPerTrack},
+			{Name: "First catalog sector", Value: vtoc.FirstCatalogSector.String()},
+			{Name: "Free sectors", Value: vtoc.countFree()},
+			{Name: "Files", Value: files},
+		},
+	}, nil
+}
@@ -0,0 +1,194 @@
+package apple2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+const (
+	// SectorSize is the size of a sector, in bytes.
+	SectorSize = 256
+	// SectorsPerTrack is the number of sectors on each track of a DOS 3.3
+	// disk. DOS 3.2 disks with 13 sectors per track aren't supported.
+	SectorsPerTrack = 16
+	// VTOCTrack is the track holding the VTOC, in sector 0.
+	VTOCTrack = 17
+	// MaxTracks is the number of tracks the VTOC's bitmap has room for.
+	MaxTracks = 50
+	// StandardTracks is the number of tracks on a 5.25" floppy.
+	StandardTracks = 35
+)
+
+// Offsets of the fields of the VTOC.
+const (
+	vtocBitmapOffset = 0x38
+	// vtocBitmapEntrySize is the number of bytes of the bitmap for each track.
+	// Only the first two are used.
+	vtocBitmapEntrySize = 4
+)
+
+// TrackSector is the location of a sector on the disk.
+type TrackSector struct {
+	Track  uint8
+	Sector uint8
+}
+
+// IsZero returns true for track 0 sector 0, which is used to mean "no sector"
+// since it always holds the boot loader.
+func (location TrackSector) IsZero() bool {
+	return location.Track == 0 && location.Sector == 0
+}
+
+func (location TrackSector) String() string {
+	return fmt.Sprintf("T%d S%d", location.Track, location.Sector)
+}
+
+// parseTrackSector decodes a track number and sector number stored next to each
+// other.
+func parseTrackSector(data []byte) TrackSector {
+	return TrackSector{Track: data[0], Sector: data[1]}
+}
+
+// RawVTOC is the volume table of contents.
+type RawVTOC struct {
+	FirstCatalogSector TrackSector
+	DOSRelease         uint8
+	VolumeNumber       uint8
+	// MaxTSPairs is the number of track/sector pairs in a track/sector list.
+	MaxTSPairs      uint8
+	Tracks          uint8
+	SectorsPerTrack uint8
+	BytesPerSector  uint16
+	// Bitmap has two bytes for each track. A set bit means the sector is free.
+	// The most significant bit of the first byte is sector 15, and the least
+	// significant bit of the second byte is sector 0.
+	Bitmap [MaxTracks][2]byte
+}
+
+// readVTOC reads and checks the VTOC of the disk in `image`, which is `size`
+// bytes long.
+func readVTOC(image io.ReaderAt, size int64) (*RawVTOC, disko.DriverError) {
+	data := make([]byte, SectorSize)
+	_, err := image.ReadAt(data, VTOCTrack*SectorsPerTrack*SectorSize)
+	if err != nil {
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			"image is too small to contain a VTOC")
+	}
+
+	vtoc := &RawVTOC{
+		FirstCatalogSector: parseTrackSector(data[0x01:]),
+		DOSRelease:         data[0x03],
+		VolumeNumber:       data[0x06],
+		MaxTSPairs:         data[0x27],
+		Tracks:             data[0x34],
+		SectorsPerTrack:    data[0x35],
+		BytesPerSector:     binary.LittleEndian.Uint16(data[0x36:]),
+	}
+	for track := 0; track < MaxTracks; track++ {
+		copy(vtoc.Bitmap[track][:], data[vtocBitmapOffset+track*vtocBitmapEntrySize:])
+	}
+
+	switch {
+	case vtoc.SectorsPerTrack != SectorsPerTrack:
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf(
+				"VTOC says there are %d sectors per track, expected %d",
+				vtoc.SectorsPerTrack,
+				SectorsPerTrack,
+			),
+		)
+	case vtoc.BytesPerSector != SectorSize:
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("VTOC says sectors are %d bytes, expected %d", vtoc.BytesPerSector, SectorSize))
+	case vtoc.Tracks <= VTOCTrack || vtoc.Tracks > MaxTracks:
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("VTOC says the disk has %d tracks", vtoc.Tracks))
+	case int64(vtoc.Tracks)*SectorsPerTrack*SectorSize > size:
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf(
+				"VTOC says the disk has %d tracks, but the image is only %d bytes",
+				vtoc.Tracks,
+				size,
+			),
+		)
+	case vtoc.MaxTSPairs == 0 || int(vtoc.MaxTSPairs) > maxTSPairs:
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("VTOC says track/sector lists hold %d sectors", vtoc.MaxTSPairs))
+	case !vtoc.isValidSector(vtoc.FirstCatalogSector):
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("catalog begins at %s, which isn't on the disk", vtoc.FirstCatalogSector))
+	}
+	return vtoc, nil
+}
+
+// isValidSector returns true if `location` is on the disk.
+func (vtoc *RawVTOC) isValidSector(location TrackSector) bool {
+	return location.Track < vtoc.Tracks && location.Sector < vtoc.SectorsPerTrack
+}
+
+// totalSectors returns the number of sectors on the disk.
+func (vtoc *RawVTOC) totalSectors() int {
+	return int(vtoc.Tracks) * int(vtoc.SectorsPerTrack)
+}
+
+// IsFree returns true if the bitmap marks `location` as free.
+func (vtoc *RawVTOC) IsFree(location TrackSector) bool {
+	if !vtoc.isValidSector(location) {
+		return false
+	}
+	bits := binary.BigEndian.Uint16(vtoc.Bitmap[location.Track][:])
+	return bits&(1<<location.Sector) != 0
+}
+
+// countFree returns the number of sectors the bitmap marks as free.
+func (vtoc *RawVTOC) countFree() int {
+	count := 0
+	for track := uint8(0); track < vtoc.Tracks; track++ {
+		for sector := uint8(0); sector < vtoc.SectorsPerTrack; sector++ {
+			if vtoc.IsFree(TrackSector{Track: track, Sector: sector}) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// readSector reads the sector at `location` into a new buffer.
+func readSector(image io.ReaderAt, vtoc *RawVTOC, location TrackSector) ([]byte, disko.DriverError) {
+	if !vtoc.isValidSector(location) {
+		return nil, disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf("%s is outside the disk's %d tracks", location, vtoc.Tracks))
+	}
+
+	data := make([]byte, SectorSize)
+	_, err := image.ReadAt(data, sectorOffset(location))
+	if err != nil {
+		return nil, disko.ErrIOFailed.Wrap(
+			fmt.Errorf("failed to read %s: %w", location, err))
+	}
+	return data, nil
+}
+
+// sectorOffset returns the offset of the sector at `location` in a DOS-order
+// image.
+func sectorOffset(location TrackSector) int64 {
+	return (int64(location.Track)*SectorsPerTrack + int64(location.Sector)) * SectorSize
+}
+
+// statFileSystem returns the statistics of a disk from its VTOC, the number of
+// files on it, and the number of entries in the catalog.
+func statFileSystem(vtoc *RawVTOC, files int, catalogEntries int) disko.FSStat {
+	free := uint64(vtoc.countFree())
+	return disko.FSStat{
+		BlockSize:       SectorSize,
+		TotalBlocks:     uint64(vtoc.totalSectors()),
+		BlocksFree:      free,
+		BlocksAvailable: free,
+		Files:           uint64(files),
+		FilesFree:       uint64(catalogEntries - files),
+		MaxNameLength:   MaxNameLength,
+	}
+}
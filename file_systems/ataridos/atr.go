@@ -0,0 +1,131 @@
+package ataridos
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+const (
+	// ATRMagic is the first word of an ATR image's header.
+	ATRMagic = 0x0296
+	// ATRHeaderSize is the size of an ATR image's header, in bytes.
+	ATRHeaderSize = 16
+)
+
+// Sector numbers of the file system's structures.
+const (
+	VTOCSector           = 360
+	FirstDirectorySector = 361
+	DirectorySectors     = 8
+	// VTOC2Sector is the second VTOC of enhanced density disks.
+	VTOC2Sector = 1024
+)
+
+// bootSectors is the number of sectors at the beginning of the disk that are
+// 128 bytes long, even on double density disks.
+const bootSectors = 3
+
+// RawATRHeader is the header of an ATR image.
+type RawATRHeader struct {
+	Magic uint16
+	// Paragraphs is the size of the disk data in 16-byte paragraphs. The high
+	// byte is stored separately in the header.
+	Paragraphs uint32
+	SectorSize uint16
+	Flags      uint8
+}
+
+// Geometry describes where the sectors are in an ATR image.
+type Geometry struct {
+	SectorSize   int
+	TotalSectors int
+	// PaddedBootSectors is true if the first three sectors each take up a full
+	// sector in the image on a double density disk. Some tools write images
+	// this way; the extra 128 bytes of each are unused.
+	PaddedBootSectors bool
+}
+
+// readATRHeader reads the header of an ATR image `size` bytes long, and works
+// out the image's geometry from it.
+func readATRHeader(image io.ReaderAt, size int64) (RawATRHeader, Geometry, disko.DriverError) {
+	data := make([]byte, ATRHeaderSize)
+	_, err := image.ReadAt(data, 0)
+	if err != nil {
+		return RawATRHeader{}, Geometry{}, disko.ErrInvalidFileSystem.WithMessage(
+			"image is too small to contain an ATR header")
+	}
+
+	header := RawATRHeader{
+		Magic:      binary.LittleEndian.Uint16(data[0:]),
+		Paragraphs: uint32(binary.LittleEndian.Uint16(data[2:])) | uint32(data[6])<<16,
+		SectorSize: binary.LittleEndian.Uint16(data[4:]),
+		Flags:      data[15],
+	}
+	if header.Magic != ATRMagic {
+		return header, Geometry{}, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("not an ATR image: magic number is %#04x", header.Magic))
+	}
+
+	dataSize := int64(header.Paragraphs) * 16
+	if dataSize+ATRHeaderSize > size {
+		return header, Geometry{}, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf(
+				"header says the disk is %d bytes, but the image only has %d",
+				dataSize,
+				size-ATRHeaderSize,
+			),
+		)
+	}
+
+	geometry := Geometry{SectorSize: int(header.SectorSize)}
+	switch header.SectorSize {
+	case 128:
+		geometry.TotalSectors = int(dataSize / 128)
+	case 256:
+		if dataSize%256 == 0 {
+			geometry.PaddedBootSectors = true
+			geometry.TotalSectors = int(dataSize / 256)
+		} else {
+			geometry.TotalSectors = bootSectors + int((dataSize-bootSectors*128)/256)
+		}
+	default:
+		return header, Geometry{}, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("unsupported sector size %d", header.SectorSize))
+	}
+	return header, geometry, nil
+}
+
+// sectorLength returns the size of sector `sector`, in bytes.
+func (geometry Geometry) sectorLength(sector int) int {
+	if sector <= bootSectors {
+		return 128
+	}
+	return geometry.SectorSize
+}
+
+// sectorOffset returns the offset of sector `sector` in the image.
+func (geometry Geometry) sectorOffset(sector int) int64 {
+	if sector <= bootSectors || geometry.PaddedBootSectors {
+		return ATRHeaderSize + int64(sector-1)*int64(geometry.sectorLength(sector))
+	}
+	return ATRHeaderSize + bootSectors*128 + int64(sector-bootSectors-1)*int64(geometry.SectorSize)
+}
+
+// readSector reads sector `sector` of the disk into a new buffer.
+func readSector(image io.ReaderAt, geometry Geometry, sector int) ([]byte, disko.DriverError) {
+	if sector < 1 || sector > geometry.TotalSectors {
+		return nil, disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf("sector %d is outside the disk's %d sectors", sector, geometry.TotalSectors))
+	}
+
+	data := make([]byte, geometry.sectorLength(sector))
+	_, err := image.ReadAt(data, geometry.sectorOffset(sector))
+	if err != nil {
+		return nil, disko.ErrIOFailed.Wrap(
+			fmt.Errorf("failed to read sector %d: %w", sector, err))
+	}
+	return data, nil
+}
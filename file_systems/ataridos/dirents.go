@@ -0,0 +1,124 @@
+package ataridos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dargueta/disko"
+)
+
+const (
+	// DirentSize is the size of a directory entry, in bytes.
+	DirentSize = 16
+	// DirentsPerSector is the number of directory entries in a directory
+	// sector. Only the first 128 bytes of double density sectors are used.
+	DirentsPerSector = 8
+	// MaxFiles is the number of entries in the directory.
+	MaxFiles = DirectorySectors * DirentsPerSector
+	// MaxNameLength is the length of the longest name, "FILENAME.EXT".
+	MaxNameLength = 12
+)
+
+// Flags of a directory entry.
+const (
+	FlagOpenForOutput = 0x01
+	FlagDOS2          = 0x02
+	FlagLocked        = 0x20
+	FlagInUse         = 0x40
+	FlagDeleted       = 0x80
+)
+
+// RawDirent is an entry in the directory.
+type RawDirent struct {
+	Flags       uint8
+	SectorCount uint16
+	FirstSector uint16
+	Name        [8]byte
+	Extension   [3]byte
+}
+
+// parseRawDirent decodes a directory entry.
+func parseRawDirent(data []byte) RawDirent {
+	dirent := RawDirent{
+		Flags:       data[0],
+		SectorCount: binary.LittleEndian.Uint16(data[1:]),
+		FirstSector: binary.LittleEndian.Uint16(data[3:]),
+	}
+	copy(dirent.Name[:], data[5:13])
+	copy(dirent.Extension[:], data[13:16])
+	return dirent
+}
+
+// IsUnused returns true if the entry has never been used. DOS stops searching
+// the directory at the first one of these.
+func (dirent *RawDirent) IsUnused() bool {
+	return dirent.Flags == 0
+}
+
+// IsLive returns true if the entry is for a file that exists.
+func (dirent *RawDirent) IsLive() bool {
+	return dirent.Flags&FlagInUse != 0 && dirent.Flags&FlagDeleted == 0
+}
+
+// NameString returns the name of the file, with the spaces padding the name
+// and extension removed. The extension and the dot before it are omitted if the
+// extension is blank.
+func (dirent *RawDirent) NameString() string {
+	name := string(bytes.TrimRight(dirent.Name[:], " "))
+	extension := string(bytes.TrimRight(dirent.Extension[:], " "))
+	if extension == "" {
+		return name
+	}
+	return name + "." + extension
+}
+
+// matchesName returns true if `name` refers to this entry. Names are
+// case-insensitive, since DOS only creates uppercase names.
+func (dirent *RawDirent) matchesName(name string) bool {
+	return strings.EqualFold(dirent.NameString(), name)
+}
+
+// readDirectory reads all the entries in the directory, stopping at the first
+// unused one.
+func readDirectory(image io.ReaderAt, geometry Geometry) ([]RawDirent, disko.DriverError) {
+	entries := make([]RawDirent, 0, MaxFiles)
+	for i := 0; i < DirectorySectors; i++ {
+		data, err := readSector(image, geometry, FirstDirectorySector+i)
+		if err != nil {
+			return nil, err
+		}
+
+		for offset := 0; offset < DirentsPerSector*DirentSize; offset += DirentSize {
+			dirent := parseRawDirent(data[offset:])
+			if dirent.IsUnused() {
+				return entries, nil
+			}
+			entries = append(entries, dirent)
+		}
+	}
+	return entries, nil
+}
+
+// countFiles returns the number of live entries in `entries`.
+func countFiles(entries []RawDirent) int {
+	count := 0
+	for i := range entries {
+		if entries[i].IsLive() {
+			count++
+		}
+	}
+	return count
+}
+
+// ConvertFlagsToStandard returns the mode of a file with the given directory
+// entry flags. DOS has no permissions, so files are readable and writable by
+// everyone unless they're locked.
+func ConvertFlagsToStandard(flags uint8) os.FileMode {
+	if flags&FlagLocked != 0 {
+		return 0o444
+	}
+	return 0o666
+}
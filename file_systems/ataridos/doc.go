@@ -0,0 +1,2 @@
+// https://atariwiki.org/wiki/Wiki.jsp?page=Atari%20DOS%202%20Disk%20Format
+package ataridos
@@ -0,0 +1,123 @@
+package ataridos
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/dargueta/disko"
+)
+
+// trailerSize is the number of bytes at the end of each data sector that link
+// it to the rest of the file.
+const trailerSize = 3
+
+// segment is the part of one sector of a file that holds data.
+type segment struct {
+	sector int
+	// offset is where the data in this sector begins in the file.
+	offset int64
+	length int
+}
+
+// fileSegments follows the chain of sectors of the file with directory entry
+// `dirent`, which is entry `fileNumber` in the directory, and returns where its
+// data is.
+func fileSegments(
+	image io.ReaderAt,
+	geometry Geometry,
+	fileNumber int,
+	dirent *RawDirent,
+) ([]segment, disko.DriverError) {
+	segments := make([]segment, 0, dirent.SectorCount)
+	offset := int64(0)
+
+	for sector := int(dirent.FirstSector); sector != 0; {
+		// Each sector is in the chain at most once, so a longer chain must go
+		// in circles.
+		if len(segments) >= geometry.TotalSectors {
+			return nil, disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf("%s: sector chain has a cycle", dirent.NameString()))
+		}
+
+		data, err := readSector(image, geometry, sector)
+		if err != nil {
+			return nil, err
+		}
+
+		trailer := data[len(data)-trailerSize:]
+		owner := int(trailer[0] >> 2)
+		next := int(trailer[0]&0x03)<<8 | int(trailer[1])
+		length := int(trailer[2])
+		if geometry.sectorLength(sector) == 128 {
+			// The high bit marks a short sector on single density disks.
+			length &= 0x7F
+		}
+
+		if owner != fileNumber {
+			return nil, disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf(
+					"%s: sector %d belongs to file %d, expected %d",
+					dirent.NameString(),
+					sector,
+					owner,
+					fileNumber,
+				),
+			)
+		} else if length > len(data)-trailerSize {
+			return nil, disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf("%s: sector %d claims to hold %d bytes", dirent.NameString(), sector, length))
+		}
+
+		segments = append(segments, segment{sector: sector, offset: offset, length: length})
+		offset += int64(length)
+		sector = next
+	}
+
+	if len(segments) != int(dirent.SectorCount) {
+		return nil, disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf(
+				"%s: directory says the file has %d sectors, but its chain has %d",
+				dirent.NameString(),
+				dirent.SectorCount,
+				len(segments),
+			),
+		)
+	}
+	return segments, nil
+}
+
+// fileReader is an [io.ReaderAt] for the contents of a file.
+type fileReader struct {
+	image    io.ReaderAt
+	geometry Geometry
+	segments []segment
+}
+
+func (reader *fileReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	segments := reader.segments
+	i := sort.Search(len(segments), func(i int) bool {
+		return segments[i].offset+int64(segments[i].length) > offset
+	})
+
+	n := 0
+	for ; i < len(segments) && n < len(buffer); i++ {
+		current := segments[i]
+		start := int(offset + int64(n) - current.offset)
+		chunk := buffer[n:]
+		if len(chunk) > current.length-start {
+			chunk = chunk[:current.length-start]
+		}
+
+		_, err := reader.image.ReadAt(chunk, reader.geometry.sectorOffset(current.sector)+int64(start))
+		if err != nil {
+			return n, err
+		}
+		n += len(chunk)
+	}
+
+	if n < len(buffer) {
+		return n, io.EOF
+	}
+	return n, nil
+}
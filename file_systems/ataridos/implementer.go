@@ -0,0 +1,168 @@
+package ataridos
+
+import (
+	"io"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+	"github.com/dargueta/disko/file_systems/common/archivefs"
+)
+
+// Driver implements [disko.FileSystemImplementer] for Atari DOS 2 disks in ATR
+// images. It only supports mounting images read-only.
+//
+// The disk has no subdirectories, so everything besides reading the VTOC and
+// following sector chains is done by an [archivefs.FileSystem]. Each file's
+// chain is followed when the disk is mounted, since that's the only way to get
+// its size.
+type Driver struct {
+	*archivefs.FileSystem
+	stream   io.ReadWriteSeeker
+	image    *disks.Section
+	geometry Geometry
+	vtoc     *RawVTOC
+	files    []diskFile
+	stat     disko.FSStat
+}
+
+// diskFile is a file on the disk.
+type diskFile struct {
+	dirent   RawDirent
+	segments []segment
+	size     int64
+}
+
+// NewDriver creates an Atari DOS implementation for the image in `stream`. It
+// implements [disko.ImplementerConstructor].
+func NewDriver(stream io.ReadWriteSeeker) (disko.FileSystemImplementer, disko.DriverError) {
+	return &Driver{stream: stream}, nil
+}
+
+func (driver *Driver) Mount(flags disko.MountFlags) disko.DriverError {
+	if driver.vtoc != nil {
+		return disko.ErrAlreadyInProgress
+	}
+
+	writeFlags := disko.MountFlagsAllowWrite |
+		disko.MountFlagsAllowInsert |
+		disko.MountFlagsAllowDelete |
+		disko.MountFlagsAllowAdminister
+	if flags&writeFlags != 0 && !flags.IsShared() {
+		return disko.ErrReadOnlyFileSystem.WithMessage(
+			"Atari DOS images can only be mounted read-only")
+	}
+
+	size, err := driver.stream.Seek(0, io.SeekEnd)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	image, err := disks.NewWindow(driver.stream, 0, size)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+
+	_, geometry, driverErr := readATRHeader(image, size)
+	if driverErr != nil {
+		return driverErr
+	}
+	vtoc, driverErr := readVTOC(image, geometry)
+	if driverErr != nil {
+		return driverErr
+	}
+	entries, driverErr := readDirectory(image, geometry)
+	if driverErr != nil {
+		return driverErr
+	}
+
+	files := []diskFile{}
+	for fileNumber := range entries {
+		dirent := &entries[fileNumber]
+		if !dirent.IsLive() {
+			continue
+		}
+
+		segments, driverErr := fileSegments(image, geometry, fileNumber, dirent)
+		if driverErr != nil {
+			return driverErr
+		}
+		file := diskFile{dirent: *dirent, segments: segments}
+		if len(segments) > 0 {
+			last := segments[len(segments)-1]
+			file.size = last.offset + int64(last.length)
+		}
+		files = append(files, file)
+	}
+
+	driver.image = image
+	driver.geometry = geometry
+	driver.files = files
+	driver.FileSystem = archivefs.New(driver, uint(geometry.SectorSize), Features)
+	driverErr = driver.FileSystem.Mount(flags)
+	if driverErr != nil {
+		driver.FileSystem = nil
+		driver.files = nil
+		return driverErr
+	}
+
+	driver.vtoc = vtoc
+	driver.stat = statFileSystem(geometry, vtoc, len(files))
+	return nil
+}
+
+// Members implements [archivefs.Archive].
+func (driver *Driver) Members() ([]archivefs.Member, error) {
+	members := make([]archivefs.Member, len(driver.files))
+	for i, file := range driver.files {
+		members[i] = archivefs.Member{
+			Name:         file.dirent.NameString(),
+			Size:         file.size,
+			LastModified: disko.UndefinedTimestamp,
+			Mode:         ConvertFlagsToStandard(file.dirent.Flags),
+		}
+	}
+	return members, nil
+}
+
+// OpenMember implements [archivefs.Archive].
+func (driver *Driver) OpenMember(index int) (io.ReaderAt, error) {
+	return &fileReader{
+		image:    driver.image,
+		geometry: driver.geometry,
+		segments: driver.files[index].segments,
+	}, nil
+}
+
+func (driver *Driver) Unmount() disko.DriverError {
+	if driver.FileSystem != nil {
+		driver.FileSystem.Unmount()
+	}
+	driver.FileSystem = nil
+	driver.image = nil
+	driver.vtoc = nil
+	driver.files = nil
+	return nil
+}
+
+// GetObject implements [disko.FileSystemImplementer]. Names are
+// case-insensitive, since DOS only creates uppercase names.
+func (driver *Driver) GetObject(
+	name string,
+	parent disko.ObjectHandle,
+) (disko.ObjectHandle, disko.DriverError) {
+	for _, file := range driver.files {
+		if file.dirent.matchesName(name) {
+			return driver.FileSystem.GetObject(file.dirent.NameString(), parent)
+		}
+	}
+	return driver.FileSystem.GetObject(name, parent)
+}
+
+// FSStat implements [disko.FileSystemImplementer], with the free space from
+// the VTOC.
+func (driver *Driver) FSStat() disko.FSStat {
+	return driver.stat
+}
+
+func (driver *Driver) GetFSFeatures() disko.FSFeatures {
+	return Features
+}
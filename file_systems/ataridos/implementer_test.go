@@ -0,0 +1,192 @@
+package ataridos_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/ataridos"
+	diskotest "github.com/dargueta/disko/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xaionaro-go/bytesextra"
+)
+
+// atrImage builds an ATR image sector by sector.
+type atrImage struct {
+	data       []byte
+	sectorSize int
+}
+
+// newATRImage creates a blank ATR image of an Atari DOS 2 disk. The first
+// three sectors of double density disks aren't padded.
+func newATRImage(sectorSize, totalSectors, freeSectors int) atrImage {
+	dataSize := 3*128 + (totalSectors-3)*sectorSize
+	image := atrImage{data: make([]byte, 16+dataSize), sectorSize: sectorSize}
+	binary.LittleEndian.PutUint16(image.data, ataridos.ATRMagic)
+	binary.LittleEndian.PutUint16(image.data[2:], uint16(dataSize/16))
+	binary.LittleEndian.PutUint16(image.data[4:], uint16(sectorSize))
+	image.data[6] = byte(dataSize / 16 >> 16)
+
+	vtoc := image.sector(ataridos.VTOCSector)
+	vtoc[0] = ataridos.DOSCode
+	binary.LittleEndian.PutUint16(vtoc[1:], 707)
+	binary.LittleEndian.PutUint16(vtoc[3:], uint16(freeSectors))
+	for sector := 720 - freeSectors; sector < 720; sector++ {
+		vtoc[10+sector/8] |= 0x80 >> (sector % 8)
+	}
+	return image
+}
+
+func (image atrImage) sector(number int) []byte {
+	if number <= 3 {
+		return image.data[16+(number-1)*128 : 16+number*128]
+	}
+	offset := 16 + 3*128 + (number-4)*image.sectorSize
+	return image.data[offset : offset+image.sectorSize]
+}
+
+func (image atrImage) setDirent(fileNumber int, flags byte, name string, sectors ...int) {
+	entry := image.sector(ataridos.FirstDirectorySector + fileNumber/8)[16*(fileNumber%8):]
+	entry[0] = flags
+	binary.LittleEndian.PutUint16(entry[1:], uint16(len(sectors)))
+	if len(sectors) > 0 {
+		binary.LittleEndian.PutUint16(entry[3:], uint16(sectors[0]))
+	}
+	copy(entry[5:16], name)
+}
+
+// writeFile writes `contents` to `sectors` in order, putting as many bytes in
+// each sector as the corresponding entry of `lengths` says.
+func (image atrImage) writeFile(fileNumber int, contents []byte, sectors []int, lengths []int) {
+	for i, number := range sectors {
+		sector := image.sector(number)
+		copy(sector, contents[:lengths[i]])
+		contents = contents[lengths[i]:]
+
+		next := 0
+		if i+1 < len(sectors) {
+			next = sectors[i+1]
+		}
+		trailer := sector[len(sector)-3:]
+		trailer[0] = byte(fileNumber<<2) | byte(next>>8)
+		trailer[1] = byte(next)
+		trailer[2] = byte(lengths[i])
+	}
+}
+
+var (
+	helloContents  = bytes.Repeat([]byte("HELLO, ATARI! "), 10)
+	readmeContents = bytes.Repeat([]byte{0x9B, 'A', 'B', 'C'}, 45)
+)
+
+// makeDOS2Image creates a single density disk with these files:
+//
+//	HELLO.TXT    file 0, two sectors
+//	AUTORUN.SYS  file 1, deleted
+//	README       file 2, locked, with a short sector in the middle
+func makeDOS2Image() []byte {
+	image := newATRImage(128, 720, 700)
+	image.setDirent(0, ataridos.FlagInUse|ataridos.FlagDOS2, "HELLO   TXT", 4, 5)
+	image.writeFile(0, helloContents, []int{4, 5}, []int{125, 15})
+
+	image.setDirent(1, ataridos.FlagDeleted|ataridos.FlagDOS2, "AUTORUN SYS", 6)
+
+	image.setDirent(2, ataridos.FlagInUse|ataridos.FlagDOS2|ataridos.FlagLocked, "README     ", 10, 7, 12)
+	image.writeFile(2, readmeContents, []int{10, 7, 12}, []int{50, 125, 5})
+	return image.data
+}
+
+func mount(t *testing.T, image []byte) (*driver.BaseDriver, disko.FileSystemImplementer) {
+	implementation := diskotest.MountImplementer(
+		t, ataridos.NewDriver, image, disko.MountFlagsAllowRead)
+	return driver.New(implementation, disko.MountFlagsAllowRead), implementation
+}
+
+func TestDriver__ReadFiles(t *testing.T) {
+	image := makeDOS2Image()
+	assert.True(t, ataridos.Detect(bytes.NewReader(image), int64(len(image))))
+	fs, implementation := mount(t, image)
+
+	entries, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"HELLO.TXT", "README"}, names)
+
+	data, err := fs.ReadFile("/HELLO.TXT")
+	require.NoError(t, err)
+	assert.Equal(t, helloContents, data)
+
+	data, err = fs.ReadFile("/readme")
+	require.NoError(t, err)
+	assert.Equal(t, readmeContents, data)
+
+	stat, err := fs.Stat("/README")
+	require.NoError(t, err)
+	assert.EqualValues(t, len(readmeContents), stat.Size)
+	assert.Equal(t, os.FileMode(0o444), stat.ModeFlags)
+
+	_, err = fs.Stat("/AUTORUN.SYS")
+	assert.ErrorIs(t, err, disko.ErrNotFound)
+
+	fsStat := implementation.FSStat()
+	assert.EqualValues(t, 128, fsStat.BlockSize)
+	assert.EqualValues(t, 707, fsStat.TotalBlocks)
+	assert.EqualValues(t, 700, fsStat.BlocksFree)
+	assert.EqualValues(t, 2, fsStat.Files)
+	assert.EqualValues(t, 62, fsStat.FilesFree)
+}
+
+// The first three sectors of double density disks are 128 bytes, and data
+// sectors hold up to 253 bytes.
+func TestDriver__DoubleDensity(t *testing.T) {
+	contents := bytes.Repeat([]byte("0123456789"), 40)
+	image := newATRImage(256, 720, 650)
+	image.setDirent(0, ataridos.FlagInUse|ataridos.FlagDOS2, "DATA    BIN", 4, 5)
+	image.writeFile(0, contents, []int{4, 5}, []int{253, 147})
+
+	description, driverErr := ataridos.Describe(bytes.NewReader(image.data), int64(len(image.data)))
+	require.NoError(t, driverErr)
+	assert.EqualValues(t, 650, description.Stat.BlocksFree)
+
+	fs, _ := mount(t, image.data)
+	data, err := fs.ReadFile("/DATA.BIN")
+	require.NoError(t, err)
+	assert.Equal(t, contents, data)
+}
+
+// A sector belonging to another file means the chain is broken.
+func TestDriver__WrongFileNumber(t *testing.T) {
+	image := atrImage{data: makeDOS2Image(), sectorSize: 128}
+	image.sector(5)[125] = 3 << 2
+
+	implementation, err := ataridos.NewDriver(bytesextra.NewReadWriteSeeker(image.data))
+	require.NoError(t, err)
+	err = implementation.Mount(disko.MountFlagsAllowRead)
+	assert.ErrorIs(t, err, disko.ErrFileSystemCorrupted)
+	assert.ErrorContains(t, err, "sector 5 belongs to file 3, expected 0")
+}
+
+func TestDetect(t *testing.T) {
+	wrongDOS := makeDOS2Image()
+	wrongDOS[16+359*128] = 3
+	noMagic := makeDOS2Image()
+	noMagic[0] = 0
+
+	diskotest.RunDetectConformanceTests(
+		t,
+		ataridos.Detect,
+		makeDOS2Image(),
+		map[string][]byte{"other DOS version": wrongDOS, "not an ATR image": noMagic},
+	)
+}
+
+func TestDriver__Conformance(t *testing.T) {
+	diskotest.RunReadOnlyConformanceTests(t, ataridos.NewDriver, makeDOS2Image())
+}
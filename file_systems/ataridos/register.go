@@ -0,0 +1,81 @@
+package ataridos
+
+import (
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+// Features gives the features supported by Atari DOS 2.
+var Features = disko.FSFeatures{
+	DefaultNameEncoding: disko.FSTextEncodingASCII,
+	SupportsBootCode:    true,
+	MaxBootCodeSize:     3 * 128,
+	DefaultBlockSize:    128,
+	MinTotalBlocks:      FirstDirectorySector + DirectorySectors - 1,
+	MaxTotalBlocks:      enhancedDensitySectors,
+	// Sector links are 10 bits, and a sector holds at most 253 bytes.
+	MaxFileSize: 1023 * 253,
+}
+
+func init() {
+	disko.RegisterFileSystem(
+		disko.FileSystemRegistration{
+			Name:         "ataridos",
+			Description:  "Atari DOS 2 (ATR image)",
+			Features:     Features,
+			Detect:       Detect,
+			HasSignature: true,
+			Describe:     Describe,
+			New:          NewDriver,
+		},
+	)
+}
+
+// Detect returns true if `image` is an ATR image of an Atari DOS 2 disk. It
+// implements the detection function for [disko.FileSystemRegistration].
+func Detect(image io.ReaderAt, size int64) bool {
+	_, geometry, err := readATRHeader(image, size)
+	if err != nil {
+		return false
+	}
+	_, err = readVTOC(image, geometry)
+	return err == nil
+}
+
+// Describe decodes the ATR header and VTOC of an image, and counts the files
+// in the directory. It implements the description function for
+// [disko.FileSystemRegistration].
+func Describe(image io.ReaderAt, size int64) (disko.ImageDescription, disko.DriverError) {
+	header, geometry, err := readATRHeader(image, size)
+	if err != nil {
+		return disko.ImageDescription{}, err
+	}
+	vtoc, err := readVTOC(image, geometry)
+	if err != nil {
+		return disko.ImageDescription{}, err
+	}
+	entries, err := readDirectory(image, geometry)
+	if err != nil {
+		return disko.ImageDescription{}, err
+	}
+
+	files := countFiles(entries)
+	fields := []disko.HeaderField{
+		{Name: "Sector size", Value: header.SectorSize},
+		{Name: "Total sectors", Value: geometry.TotalSectors},
+		{Name: "DOS code", Value: vtoc.DOSCode},
+		{Name: "Sectors for files", Value: vtoc.TotalSectors},
+		{Name: "Free sectors", Value: vtoc.FreeSectors},
+		{Name: "Free sectors in bitmap", Value: vtoc.countFreeInBitmap()},
+	}
+	if geometry.TotalSectors == enhancedDensitySectors && geometry.SectorSize == 128 {
+		fields = append(fields, disko.HeaderField{Name: "Free sectors past 719", Value: vtoc.FreeSectorsVTOC2})
+	}
+	fields = append(fields, disko.HeaderField{Name: "Files", Value: files})
+
+	return disko.ImageDescription{
+		Stat:   statFileSystem(geometry, vtoc, files),
+		Header: fields,
+	}, nil
+}
@@ -0,0 +1,123 @@
+package ataridos
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+// DOSCode is the first byte of the VTOC of disks written by DOS 2.0 and 2.5.
+const DOSCode = 2
+
+// enhancedDensitySectors is the number of sectors on an enhanced density disk.
+const enhancedDensitySectors = 1040
+
+// Offsets of the fields of the VTOCs.
+const (
+	vtocBitmapOffset = 10
+	// vtocBitmapSectors is the number of sectors the bitmap in the first VTOC
+	// covers.
+	vtocBitmapSectors = 720
+	// vtoc2FreeOffset is the offset of the number of free sectors past 719 in
+	// the VTOC of an enhanced density disk.
+	vtoc2FreeOffset = 122
+)
+
+// RawVTOC is the volume table of contents.
+type RawVTOC struct {
+	DOSCode uint8
+	// TotalSectors is the number of sectors available for files. It excludes
+	// the boot sectors, the VTOC, and the directory.
+	TotalSectors uint16
+	FreeSectors  uint16
+	// Bitmap has a bit for each of sectors 0 to 719, most significant bit
+	// first. A set bit means the sector is free.
+	Bitmap [vtocBitmapSectors / 8]byte
+	// FreeSectorsVTOC2 is the number of free sectors past 719 on an enhanced
+	// density disk, and is always 0 on other disks.
+	FreeSectorsVTOC2 uint16
+}
+
+// readVTOC reads and checks the VTOC of a disk with the given geometry.
+func readVTOC(image io.ReaderAt, geometry Geometry) (*RawVTOC, disko.DriverError) {
+	if geometry.TotalSectors < FirstDirectorySector+DirectorySectors-1 {
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("disk has %d sectors, too few for a VTOC and directory", geometry.TotalSectors))
+	}
+
+	data, err := readSector(image, geometry, VTOCSector)
+	if err != nil {
+		return nil, err
+	}
+
+	vtoc := &RawVTOC{
+		DOSCode:      data[0],
+		TotalSectors: binary.LittleEndian.Uint16(data[1:]),
+		FreeSectors:  binary.LittleEndian.Uint16(data[3:]),
+	}
+	copy(vtoc.Bitmap[:], data[vtocBitmapOffset:])
+
+	switch {
+	case vtoc.DOSCode != DOSCode:
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("VTOC has DOS code %d, expected %d", vtoc.DOSCode, DOSCode))
+	case int(vtoc.TotalSectors) > geometry.TotalSectors:
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf(
+				"VTOC says there are %d sectors for files, but the disk only has %d",
+				vtoc.TotalSectors,
+				geometry.TotalSectors,
+			),
+		)
+	case vtoc.FreeSectors > vtoc.TotalSectors:
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("VTOC says %d of %d sectors are free", vtoc.FreeSectors, vtoc.TotalSectors))
+	}
+
+	if geometry.TotalSectors == enhancedDensitySectors && geometry.SectorSize == 128 {
+		data, err = readSector(image, geometry, VTOC2Sector)
+		if err != nil {
+			return nil, err
+		}
+		vtoc.FreeSectorsVTOC2 = binary.LittleEndian.Uint16(data[vtoc2FreeOffset:])
+	}
+	return vtoc, nil
+}
+
+// IsFree returns true if the bitmap marks sector `sector` as free. Sectors past
+// the end of the bitmap are never free.
+func (vtoc *RawVTOC) IsFree(sector int) bool {
+	if sector < 0 || sector >= vtocBitmapSectors {
+		return false
+	}
+	return vtoc.Bitmap[sector/8]&(0x80>>(sector%8)) != 0
+}
+
+// countFreeInBitmap returns the number of sectors the bitmap marks as free. It
+// should be the same as FreeSectors.
+func (vtoc *RawVTOC) countFreeInBitmap() int {
+	count := 0
+	for sector := 0; sector < vtocBitmapSectors; sector++ {
+		if vtoc.IsFree(sector) {
+			count++
+		}
+	}
+	return count
+}
+
+// statFileSystem returns the statistics of a disk from its VTOC and the
+// directory entries in use.
+func statFileSystem(geometry Geometry, vtoc *RawVTOC, files int) disko.FSStat {
+	free := uint64(vtoc.FreeSectors) + uint64(vtoc.FreeSectorsVTOC2)
+	return disko.FSStat{
+		BlockSize:       uint(geometry.SectorSize),
+		TotalBlocks:     uint64(vtoc.TotalSectors),
+		BlocksFree:      free,
+		BlocksAvailable: free,
+		Files:           uint64(files),
+		FilesFree:       uint64(MaxFiles - files),
+		MaxNameLength:   MaxNameLength,
+	}
+}
@@ -0,0 +1,393 @@
+// Package allocator provides an extent-based block allocator on top of a free
+// space bitmap, for drivers of file systems that track free space that way.
+//
+// The bitmap is used in place, with bit N of the bitmap (the bit with value
+// 1 << (N % 8) in byte N / 8) set if block N is in use. This is the layout used
+// by ext2 and exFAT, among others, so drivers can usually pass in the bitmap
+// exactly as it's stored on disk and write it back after allocating.
+package allocator
+
+import (
+	"fmt"
+
+	"github.com/boljen/go-bitmap"
+	"github.com/dargueta/disko"
+	c "github.com/dargueta/disko/file_systems/common"
+)
+
+// Strategy determines how the allocator picks a run of free blocks for a new
+// extent.
+type Strategy int
+
+const (
+	// FirstFit uses the first run of free blocks at or after the goal that's
+	// big enough. It's fast, and keeps related data close together.
+	FirstFit = Strategy(iota)
+
+	// BestFit uses the smallest run of free blocks that's big enough, which
+	// reduces fragmentation of free space at the cost of scanning the entire
+	// bitmap.
+	BestFit
+)
+
+// NoGoal tells the allocator that the caller has no preference for where
+// blocks should be allocated.
+const NoGoal = c.InvalidPhysicalBlock
+
+// Extent is a run of consecutive blocks.
+type Extent struct {
+	Start  c.PhysicalBlock
+	Length uint
+}
+
+// End returns the block immediately after the last block in the extent.
+func (extent Extent) End() c.PhysicalBlock {
+	return extent.Start + c.PhysicalBlock(extent.Length)
+}
+
+// Allocator allocates blocks from a free space bitmap. It implements
+// [disko.Allocator].
+//
+// Block numbers can start at any value to match the file system's numbering,
+// e.g. 2 for FAT clusters. Bit 0 of the bitmap always corresponds to the first
+// block.
+//
+// Allocator is not safe for concurrent use.
+type Allocator struct {
+	used        bitmap.Bitmap
+	reserved    bitmap.Bitmap
+	totalBlocks uint
+	firstBlock  c.PhysicalBlock
+	freeCount   uint
+	strategy    Strategy
+}
+
+// New creates an allocator for `totalBlocks` blocks, numbered starting at
+// `firstBlock`. `usedBitmap` must have at least `totalBlocks` bits, and is
+// modified in place.
+func New(
+	usedBitmap []byte,
+	totalBlocks uint,
+	firstBlock c.PhysicalBlock,
+	strategy Strategy,
+) (*Allocator, disko.DriverError) {
+	if uint(len(usedBitmap))*8 < totalBlocks {
+		return nil, disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf(
+				"bitmap has %d bits, need at least %d",
+				len(usedBitmap)*8,
+				totalBlocks,
+			),
+		)
+	}
+
+	alloc := &Allocator{
+		used:        bitmap.Bitmap(usedBitmap),
+		reserved:    bitmap.Bitmap(bitmap.NewSlice(int(totalBlocks))),
+		totalBlocks: totalBlocks,
+		firstBlock:  firstBlock,
+		strategy:    strategy,
+	}
+	for i := uint(0); i < totalBlocks; i++ {
+		if !alloc.used.Get(int(i)) {
+			alloc.freeCount++
+		}
+	}
+	return alloc, nil
+}
+
+// Bitmap returns the bitmap of used blocks. It's the same slice that was
+// passed to [New].
+func (alloc *Allocator) Bitmap() []byte {
+	return alloc.used
+}
+
+// TotalBlocks returns the number of blocks the allocator manages.
+func (alloc *Allocator) TotalBlocks() uint {
+	return alloc.totalBlocks
+}
+
+// FreeCount implements [disko.Allocator]. Blocks held by a [Reservation] that
+// haven't been allocated yet aren't counted.
+func (alloc *Allocator) FreeCount() uint64 {
+	return uint64(alloc.freeCount)
+}
+
+// IsAllocated implements [disko.Allocator]. Reserved blocks that haven't been
+// allocated yet are considered free.
+func (alloc *Allocator) IsAllocated(block c.PhysicalBlock) (bool, disko.DriverError) {
+	index, err := alloc.blockToIndex(block)
+	if err != nil {
+		return false, err
+	}
+	return alloc.used.Get(int(index)), nil
+}
+
+// Allocate implements [disko.Allocator]. It allocates blocks in as few extents
+// as possible.
+func (alloc *Allocator) Allocate(count uint) ([]c.PhysicalBlock, disko.DriverError) {
+	extents, err := alloc.AllocateExtents(count, NoGoal)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make([]c.PhysicalBlock, 0, count)
+	for _, extent := range extents {
+		for block := extent.Start; block < extent.End(); block++ {
+			blocks = append(blocks, block)
+		}
+	}
+	sortBlocks(blocks)
+	return blocks, nil
+}
+
+// Free implements [disko.Allocator]. It fails without freeing anything if any
+// of the blocks are invalid, already free, or given more than once.
+func (alloc *Allocator) Free(blocks []c.PhysicalBlock) disko.DriverError {
+	seen := make(map[c.PhysicalBlock]struct{}, len(blocks))
+	for _, block := range blocks {
+		isAllocated, err := alloc.IsAllocated(block)
+		if err != nil {
+			return err
+		}
+		if !isAllocated {
+			return disko.ErrInvalidArgument.WithMessage(
+				fmt.Sprintf("block %d is already free", block))
+		} else if _, duplicate := seen[block]; duplicate {
+			return disko.ErrInvalidArgument.WithMessage(
+				fmt.Sprintf("block %d is listed more than once", block))
+		}
+		seen[block] = struct{}{}
+	}
+
+	for _, block := range blocks {
+		alloc.used.Set(int(block-alloc.firstBlock), false)
+		alloc.freeCount++
+	}
+	return nil
+}
+
+// FreeExtent marks every block in an extent as unused. It fails without freeing
+// anything if any of the blocks are invalid or already free.
+func (alloc *Allocator) FreeExtent(extent Extent) disko.DriverError {
+	blocks := make([]c.PhysicalBlock, extent.Length)
+	for i := range blocks {
+		blocks[i] = extent.Start + c.PhysicalBlock(i)
+	}
+	return alloc.Free(blocks)
+}
+
+// AllocateExtent allocates `length` consecutive blocks. If `goal` isn't
+// [NoGoal], the allocator tries to start the extent there, and failing that
+// looks for space after it. If there's no run of free blocks big enough, it
+// returns [disko.ErrNoSpaceOnDevice] even if there's enough free space in
+// total.
+func (alloc *Allocator) AllocateExtent(length uint, goal c.PhysicalBlock) (Extent, disko.DriverError) {
+	if length == 0 {
+		return Extent{}, disko.ErrInvalidArgument.WithMessage("can't allocate zero blocks")
+	}
+
+	startIndex, found := alloc.findRun(length, alloc.goalToIndex(goal))
+	if !found {
+		return Extent{}, disko.ErrNoSpaceOnDevice.WithMessage(
+			fmt.Sprintf("no run of %d free blocks", length))
+	}
+	return alloc.take(startIndex, length), nil
+}
+
+// AllocateExtents allocates `count` blocks in as few extents as possible. If
+// `goal` isn't [NoGoal], the allocator prefers blocks at or after it. If there
+// aren't enough free blocks, nothing is allocated and it returns
+// [disko.ErrNoSpaceOnDevice].
+func (alloc *Allocator) AllocateExtents(count uint, goal c.PhysicalBlock) ([]Extent, disko.DriverError) {
+	if count > alloc.freeCount {
+		return nil, disko.ErrNoSpaceOnDevice.WithMessage(
+			fmt.Sprintf("can't allocate %d blocks, only %d are free", count, alloc.freeCount))
+	} else if count == 0 {
+		return []Extent{}, nil
+	}
+
+	goalIndex := alloc.goalToIndex(goal)
+	startIndex, found := alloc.findRun(count, goalIndex)
+	if found {
+		return []Extent{alloc.take(startIndex, count)}, nil
+	}
+
+	// There's no single run big enough, so take free blocks in order starting
+	// from the goal, wrapping around to the beginning if necessary.
+	extents := []Extent{}
+	remaining := count
+	for offset := uint(0); offset < alloc.totalBlocks && remaining > 0; {
+		index := (goalIndex + offset) % alloc.totalBlocks
+		if !alloc.isAvailable(index) {
+			offset++
+			continue
+		}
+
+		runLength := alloc.runLengthAt(index, remaining)
+		// Don't let a run wrap past the end of the bitmap.
+		if index+runLength > alloc.totalBlocks {
+			runLength = alloc.totalBlocks - index
+		}
+		extents = append(extents, alloc.take(index, runLength))
+		remaining -= runLength
+		offset += runLength
+	}
+	return extents, nil
+}
+
+// Reserve sets aside a window of up to `length` consecutive free blocks, at or
+// after `goal` if possible, so that a file that's being written a piece at a
+// time can be kept contiguous. Reserved blocks aren't allocated until
+// [Reservation.Allocate] is called, but no other allocation will use them until
+// the reservation is released.
+//
+// If there's no run of free blocks big enough, the window is the biggest run
+// that could be found. It fails only if there are no free blocks at all.
+func (alloc *Allocator) Reserve(length uint, goal c.PhysicalBlock) (*Reservation, disko.DriverError) {
+	goalIndex := alloc.goalToIndex(goal)
+	startIndex, found := alloc.findRun(length, goalIndex)
+	if !found {
+		startIndex, length = alloc.largestRun()
+		if length == 0 {
+			return nil, disko.ErrNoSpaceOnDevice.WithMessage("no free blocks to reserve")
+		}
+	}
+
+	for i := startIndex; i < startIndex+length; i++ {
+		alloc.reserved.Set(int(i), true)
+	}
+	alloc.freeCount -= length
+	return &Reservation{
+		alloc: alloc,
+		window: Extent{
+			Start:  alloc.firstBlock + c.PhysicalBlock(startIndex),
+			Length: length,
+		},
+	}, nil
+}
+
+// blockToIndex converts a block number to an index into the bitmap.
+func (alloc *Allocator) blockToIndex(block c.PhysicalBlock) (uint, disko.DriverError) {
+	if block < alloc.firstBlock || block-alloc.firstBlock >= c.PhysicalBlock(alloc.totalBlocks) {
+		return 0, disko.ErrArgumentOutOfRange.WithMessage(
+			fmt.Sprintf(
+				"block %d not in range [%d, %d)",
+				block,
+				alloc.firstBlock,
+				alloc.firstBlock+c.PhysicalBlock(alloc.totalBlocks),
+			),
+		)
+	}
+	return uint(block - alloc.firstBlock), nil
+}
+
+// goalToIndex converts a goal block to an index into the bitmap, using 0 for
+// [NoGoal] or a goal that's out of range.
+func (alloc *Allocator) goalToIndex(goal c.PhysicalBlock) uint {
+	index, err := alloc.blockToIndex(goal)
+	if err != nil {
+		return 0
+	}
+	return index
+}
+
+// isAvailable returns true if the block at `index` is neither allocated nor
+// reserved.
+func (alloc *Allocator) isAvailable(index uint) bool {
+	return !alloc.used.Get(int(index)) && !alloc.reserved.Get(int(index))
+}
+
+// runLengthAt returns the number of available blocks beginning at `index`, up
+// to `limit`.
+func (alloc *Allocator) runLengthAt(index uint, limit uint) uint {
+	length := uint(0)
+	for index+length < alloc.totalBlocks && length < limit && alloc.isAvailable(index+length) {
+		length++
+	}
+	return length
+}
+
+// findRun returns the index of the first block of a run of at least `length`
+// available blocks, chosen according to the allocator's strategy. Runs are
+// ranked by how far after `goalIndex` they start, wrapping around at the end of
+// the bitmap, so a run beginning exactly at the goal is always preferred.
+func (alloc *Allocator) findRun(length uint, goalIndex uint) (uint, bool) {
+	if length == 0 || length > alloc.totalBlocks {
+		return 0, false
+	}
+
+	bestIndex := uint(0)
+	bestLength := uint(0)
+	bestDistance := uint(0)
+	found := false
+
+	consider := func(index, runLength uint) {
+		if runLength < length {
+			return
+		}
+		distance := (index + alloc.totalBlocks - goalIndex) % alloc.totalBlocks
+		isBetter := !found
+		if found && alloc.strategy == BestFit {
+			isBetter = runLength < bestLength ||
+				(runLength == bestLength && distance < bestDistance)
+		} else if found {
+			isBetter = distance < bestDistance
+		}
+		if isBetter {
+			bestIndex, bestLength, bestDistance, found = index, runLength, distance, true
+		}
+	}
+
+	for index := uint(0); index < alloc.totalBlocks; {
+		runLength := alloc.runLengthAt(index, alloc.totalBlocks)
+		if runLength == 0 {
+			index++
+			continue
+		}
+
+		consider(index, runLength)
+		// If the goal is in the middle of this run, the part starting at the
+		// goal is a candidate too.
+		if goalIndex > index && goalIndex < index+runLength {
+			consider(goalIndex, index+runLength-goalIndex)
+		}
+		index += runLength
+	}
+	return bestIndex, found
+}
+
+// largestRun returns the start and length of the longest run of available
+// blocks.
+func (alloc *Allocator) largestRun() (uint, uint) {
+	bestIndex := uint(0)
+	bestLength := uint(0)
+	for index := uint(0); index < alloc.totalBlocks; {
+		runLength := alloc.runLengthAt(index, alloc.totalBlocks)
+		if runLength > bestLength {
+			bestIndex = index
+			bestLength = runLength
+		}
+		index += runLength + 1
+	}
+	return bestIndex, bestLength
+}
+
+// take marks `length` available blocks beginning at `index` as used.
+func (alloc *Allocator) take(index uint, length uint) Extent {
+	for i := index; i < index+length; i++ {
+		alloc.used.Set(int(i), true)
+	}
+	alloc.freeCount -= length
+	return Extent{Start: alloc.firstBlock + c.PhysicalBlock(index), Length: length}
+}
+
+// sortBlocks sorts block numbers in ascending order. Extents are usually few
+// and already in order, so insertion sort is fine.
+func sortBlocks(blocks []c.PhysicalBlock) {
+	for i := 1; i < len(blocks); i++ {
+		for j := i; j > 0 && blocks[j] < blocks[j-1]; j-- {
+			blocks[j], blocks[j-1] = blocks[j-1], blocks[j]
+		}
+	}
+}
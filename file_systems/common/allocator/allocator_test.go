@@ -0,0 +1,209 @@
+package allocator_test
+
+import (
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/common"
+	"github.com/dargueta/disko/file_systems/common/allocator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeBitmap creates a bitmap where the blocks at the given indexes are in
+// use.
+func makeBitmap(totalBlocks int, used ...int) []byte {
+	bitmap := make([]byte, (totalBlocks+7)/8)
+	for _, index := range used {
+		bitmap[index/8] |= 1 << (index % 8)
+	}
+	return bitmap
+}
+
+func TestNew__CountsFreeBlocks(t *testing.T) {
+	alloc, err := allocator.New(makeBitmap(20, 0, 1, 19), 20, 2, allocator.FirstFit)
+	require.NoError(t, err)
+	assert.EqualValues(t, 17, alloc.FreeCount())
+
+	isAllocated, err := alloc.IsAllocated(2)
+	require.NoError(t, err)
+	assert.True(t, isAllocated, "block 2 (bit 0) should be in use")
+
+	_, err = alloc.IsAllocated(1)
+	assert.ErrorIs(t, err, disko.ErrArgumentOutOfRange)
+	_, err = alloc.IsAllocated(22)
+	assert.ErrorIs(t, err, disko.ErrArgumentOutOfRange)
+}
+
+func TestNew__BitmapTooSmall(t *testing.T) {
+	_, err := allocator.New(make([]byte, 1), 9, 0, allocator.FirstFit)
+	assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+}
+
+func TestAllocateExtent__FirstFit(t *testing.T) {
+	// Free runs: [2, 4), [5, 12), [13, 16)
+	alloc, err := allocator.New(makeBitmap(16, 0, 1, 4, 12), 16, 0, allocator.FirstFit)
+	require.NoError(t, err)
+
+	extent, err := alloc.AllocateExtent(3, allocator.NoGoal)
+	require.NoError(t, err)
+	assert.Equal(t, allocator.Extent{Start: 5, Length: 3}, extent)
+
+	extent, err = alloc.AllocateExtent(2, 13)
+	require.NoError(t, err)
+	assert.Equal(t, allocator.Extent{Start: 13, Length: 2}, extent, "goal ignored")
+}
+
+func TestAllocateExtent__BestFit(t *testing.T) {
+	// Free runs: [2, 4), [5, 12), [13, 16)
+	alloc, err := allocator.New(makeBitmap(16, 0, 1, 4, 12), 16, 0, allocator.BestFit)
+	require.NoError(t, err)
+
+	extent, err := alloc.AllocateExtent(3, allocator.NoGoal)
+	require.NoError(t, err)
+	assert.Equal(t, allocator.Extent{Start: 13, Length: 3}, extent)
+
+	extent, err = alloc.AllocateExtent(2, allocator.NoGoal)
+	require.NoError(t, err)
+	assert.Equal(t, allocator.Extent{Start: 2, Length: 2}, extent)
+}
+
+func TestAllocateExtent__GoalInMiddleOfRun(t *testing.T) {
+	alloc, err := allocator.New(makeBitmap(16, 0), 16, 0, allocator.FirstFit)
+	require.NoError(t, err)
+
+	extent, err := alloc.AllocateExtent(4, 6)
+	require.NoError(t, err)
+	assert.Equal(t, allocator.Extent{Start: 6, Length: 4}, extent)
+}
+
+func TestAllocateExtent__NoContiguousSpace(t *testing.T) {
+	alloc, err := allocator.New(makeBitmap(8, 1, 3, 5, 7), 8, 0, allocator.FirstFit)
+	require.NoError(t, err)
+
+	_, err = alloc.AllocateExtent(2, allocator.NoGoal)
+	assert.ErrorIs(t, err, disko.ErrNoSpaceOnDevice)
+	assert.EqualValues(t, 4, alloc.FreeCount(), "failed allocation changed free count")
+}
+
+func TestAllocateExtents__Fragmented(t *testing.T) {
+	alloc, err := allocator.New(makeBitmap(8, 1, 3, 4, 7), 8, 0, allocator.FirstFit)
+	require.NoError(t, err)
+
+	extents, err := alloc.AllocateExtents(4, 5)
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		[]allocator.Extent{{Start: 5, Length: 2}, {Start: 0, Length: 1}, {Start: 2, Length: 1}},
+		extents,
+	)
+	assert.EqualValues(t, 0, alloc.FreeCount())
+	assert.Equal(t, []byte{0xff}, alloc.Bitmap())
+
+	_, err = alloc.AllocateExtents(1, allocator.NoGoal)
+	assert.ErrorIs(t, err, disko.ErrNoSpaceOnDevice)
+}
+
+func TestAllocateAndFree(t *testing.T) {
+	bitmap := makeBitmap(10)
+	alloc, err := allocator.New(bitmap, 10, 100, allocator.FirstFit)
+	require.NoError(t, err)
+
+	var _ disko.Allocator = alloc
+
+	blocks, err := alloc.Allocate(3)
+	require.NoError(t, err)
+	assert.Equal(t, []common.PhysicalBlock{100, 101, 102}, blocks)
+	assert.Equal(t, byte(0x07), bitmap[0], "bitmap not modified in place")
+
+	require.NoError(t, alloc.Free([]common.PhysicalBlock{101}))
+	assert.EqualValues(t, 8, alloc.FreeCount())
+	assert.Equal(t, byte(0x05), bitmap[0])
+
+	err = alloc.Free([]common.PhysicalBlock{100, 101})
+	assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+	isAllocated, _ := alloc.IsAllocated(100)
+	assert.True(t, isAllocated, "failed Free() freed some blocks anyway")
+
+	require.NoError(t, alloc.FreeExtent(allocator.Extent{Start: 100, Length: 1}))
+	assert.EqualValues(t, 9, alloc.FreeCount())
+}
+
+func TestFree__DuplicateBlocks(t *testing.T) {
+	alloc, err := allocator.New(makeBitmap(10, 0, 1), 10, 100, allocator.FirstFit)
+	require.NoError(t, err)
+
+	err = alloc.Free([]common.PhysicalBlock{100, 101, 100})
+	assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+	assert.ErrorContains(t, err, "block 100 is listed more than once")
+	assert.EqualValues(t, 8, alloc.FreeCount(), "failed Free() changed the free count")
+	isAllocated, _ := alloc.IsAllocated(101)
+	assert.True(t, isAllocated, "failed Free() freed some blocks anyway")
+
+	// The blocks can all be allocated again without running out.
+	extents, err := alloc.AllocateExtents(8, allocator.NoGoal)
+	require.NoError(t, err)
+	assert.Equal(t, []allocator.Extent{{Start: 102, Length: 8}}, extents)
+	_, err = alloc.Allocate(1)
+	assert.ErrorIs(t, err, disko.ErrNoSpaceOnDevice)
+}
+
+func TestReservation(t *testing.T) {
+	alloc, err := allocator.New(makeBitmap(32), 32, 0, allocator.FirstFit)
+	require.NoError(t, err)
+
+	reservation, err := alloc.Reserve(8, allocator.NoGoal)
+	require.NoError(t, err)
+	assert.Equal(t, allocator.Extent{Start: 0, Length: 8}, reservation.Window())
+	assert.EqualValues(t, 24, alloc.FreeCount())
+
+	// Another allocation mustn't use the reserved blocks.
+	other, err := alloc.AllocateExtent(2, allocator.NoGoal)
+	require.NoError(t, err)
+	assert.Equal(t, allocator.Extent{Start: 8, Length: 2}, other)
+
+	extents, err := reservation.Allocate(3)
+	require.NoError(t, err)
+	assert.Equal(t, []allocator.Extent{{Start: 0, Length: 3}}, extents)
+
+	extents, err = reservation.Allocate(7)
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		[]allocator.Extent{{Start: 3, Length: 5}, {Start: 10, Length: 2}},
+		extents,
+		"overflow should go right after the window")
+	assert.EqualValues(t, 0, reservation.Window().Length)
+	assert.EqualValues(t, 20, alloc.FreeCount())
+}
+
+func TestReservation__Release(t *testing.T) {
+	alloc, err := allocator.New(makeBitmap(16, 4), 16, 0, allocator.FirstFit)
+	require.NoError(t, err)
+
+	// There's no run of 8 free blocks before block 5, so the window should be
+	// the first one that's big enough.
+	reservation, err := alloc.Reserve(8, allocator.NoGoal)
+	require.NoError(t, err)
+	assert.Equal(t, allocator.Extent{Start: 5, Length: 8}, reservation.Window())
+
+	_, err = reservation.Allocate(2)
+	require.NoError(t, err)
+	reservation.Release()
+	assert.EqualValues(t, 13, alloc.FreeCount())
+
+	isAllocated, _ := alloc.IsAllocated(7)
+	assert.False(t, isAllocated, "released block is allocated")
+	extent, err := alloc.AllocateExtent(9, allocator.NoGoal)
+	require.NoError(t, err)
+	assert.Equal(t, allocator.Extent{Start: 7, Length: 9}, extent)
+}
+
+func TestReserve__SmallerWindowWhenFragmented(t *testing.T) {
+	alloc, err := allocator.New(makeBitmap(8, 2, 6), 8, 0, allocator.FirstFit)
+	require.NoError(t, err)
+
+	reservation, err := alloc.Reserve(5, allocator.NoGoal)
+	require.NoError(t, err)
+	assert.Equal(t, allocator.Extent{Start: 3, Length: 3}, reservation.Window())
+}
@@ -0,0 +1,70 @@
+package allocator
+
+import (
+	"github.com/dargueta/disko"
+	c "github.com/dargueta/disko/file_systems/common"
+)
+
+// Reservation is a window of consecutive free blocks set aside by
+// [Allocator.Reserve]. Blocks are handed out from the beginning of the window,
+// so a file written a piece at a time stays contiguous even if other files are
+// being written at the same time.
+type Reservation struct {
+	alloc  *Allocator
+	window Extent
+}
+
+// Window returns the blocks still reserved, i.e. not yet allocated or released.
+func (reservation *Reservation) Window() Extent {
+	return reservation.window
+}
+
+// Allocate allocates `count` blocks, taking as many as possible from the
+// reservation window. The rest are allocated from the allocator as close after
+// the window as possible.
+func (reservation *Reservation) Allocate(count uint) ([]Extent, disko.DriverError) {
+	fromWindow := count
+	if fromWindow > reservation.window.Length {
+		fromWindow = reservation.window.Length
+	}
+
+	extents := []Extent{}
+	if count > fromWindow {
+		// Allocate the overflow first so that nothing changes if it fails.
+		overflow, err := reservation.alloc.AllocateExtents(
+			count-fromWindow, reservation.window.End())
+		if err != nil {
+			return nil, err
+		}
+		extents = overflow
+	}
+
+	if fromWindow > 0 {
+		alloc := reservation.alloc
+		startIndex := uint(reservation.window.Start - alloc.firstBlock)
+		for i := startIndex; i < startIndex+fromWindow; i++ {
+			alloc.reserved.Set(int(i), false)
+			alloc.used.Set(int(i), true)
+		}
+
+		extents = append(
+			[]Extent{{Start: reservation.window.Start, Length: fromWindow}},
+			extents...,
+		)
+		reservation.window.Start += c.PhysicalBlock(fromWindow)
+		reservation.window.Length -= fromWindow
+	}
+	return extents, nil
+}
+
+// Release returns the blocks remaining in the window to the allocator. The
+// reservation can't be used afterwards.
+func (reservation *Reservation) Release() {
+	alloc := reservation.alloc
+	startIndex := uint(reservation.window.Start - alloc.firstBlock)
+	for i := startIndex; i < startIndex+reservation.window.Length; i++ {
+		alloc.reserved.Set(int(i), false)
+	}
+	alloc.freeCount += reservation.window.Length
+	reservation.window.Length = 0
+}
@@ -0,0 +1,332 @@
+// Package archivefs implements [disko.FileSystemImplementer] for archive
+// formats that consist of a flat list of members stored in a byte stream, such
+// as LBR, SQ, tar, or ZIP.
+//
+// An archive driver only has to parse its format: it implements [Archive] to
+// list the members and give access to their contents, and [New] takes care of
+// everything else. The file system is read-only and has no directories besides
+// the root.
+package archivefs
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/dargueta/disko"
+	c "github.com/dargueta/disko/file_systems/common"
+)
+
+// Member describes a single file in an archive.
+type Member struct {
+	// Name is the name of the member, without any path component.
+	Name string
+	// Size is the size of the member's contents, in bytes.
+	Size int64
+	// LastModified is the member's modification time, or
+	// [disko.UndefinedTimestamp] if the format doesn't store one.
+	LastModified time.Time
+	// Mode holds the member's permission bits. If 0, 0o444 is used.
+	Mode os.FileMode
+	// Xattrs holds metadata the format stores that has no place in
+	// [disko.FileStat], as extended attributes. It may be nil.
+	Xattrs map[string][]byte
+}
+
+// Archive is implemented by archive format drivers.
+type Archive interface {
+	// Members returns all members of the archive, in the order they're stored.
+	// It's called once, when the file system is mounted.
+	Members() ([]Member, error)
+
+	// OpenMember returns the contents of the member at `index` in the slice
+	// returned by Members. The reader must cover exactly [Member.Size] bytes.
+	OpenMember(index int) (io.ReaderAt, error)
+}
+
+// FileSystem is a read-only [disko.FileSystemImplementer] for an [Archive].
+type FileSystem struct {
+	archive   Archive
+	blockSize uint
+	features  disko.FSFeatures
+	members   []Member
+	// byName maps a member's name to its index in `members`.
+	byName map[string]int
+}
+
+// New creates a [FileSystem] for `archive`. Member contents are presented in
+// blocks of `blockSize` bytes, which should be the archive's own record size if
+// it has one (e.g. 128 for LBR) or anything convenient otherwise. `features`
+// describes the archive format; the fields that don't apply to read-only flat
+// archives are overridden.
+func New(archive Archive, blockSize uint, features disko.FSFeatures) *FileSystem {
+	features.DoesNotRequireFormatting = true
+	features.HasDirectories = false
+	features.HasSymbolicLinks = false
+	features.HasHardLinks = false
+	features.DefaultBlockSize = int(blockSize)
+
+	return &FileSystem{
+		archive:   archive,
+		blockSize: blockSize,
+		features:  features,
+	}
+}
+
+// Mount reads the archive's index. Archives are read-only, so the only flags
+// that have any effect are [disko.MountFlagsAllowRead] and the ones that don't
+// involve modifying the image.
+func (fs *FileSystem) Mount(flags disko.MountFlags) disko.DriverError {
+	members, err := fs.archive.Members()
+	if err != nil {
+		return disko.ErrFileSystemCorrupted.Wrap(err)
+	}
+
+	byName := make(map[string]int, len(members))
+	for i, member := range members {
+		if _, exists := byName[member.Name]; exists {
+			return disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf("archive has more than one member named %q", member.Name))
+		}
+		byName[member.Name] = i
+	}
+
+	fs.members = members
+	fs.byName = byName
+	return nil
+}
+
+func (fs *FileSystem) Flush() disko.DriverError {
+	return nil
+}
+
+func (fs *FileSystem) Unmount() disko.DriverError {
+	fs.members = nil
+	fs.byName = nil
+	return nil
+}
+
+func (fs *FileSystem) CreateObject(
+	name string,
+	parent disko.ObjectHandle,
+	perm os.FileMode,
+) (disko.ObjectHandle, disko.DriverError) {
+	return nil, disko.ErrReadOnlyFileSystem
+}
+
+func (fs *FileSystem) GetObject(
+	name string,
+	parent disko.ObjectHandle,
+) (disko.ObjectHandle, disko.DriverError) {
+	if _, isRoot := parent.(*rootHandle); !isRoot {
+		return nil, disko.ErrNotADirectory.WithMessage(parent.Name())
+	}
+
+	index, ok := fs.byName[name]
+	if !ok {
+		return nil, disko.ErrNotFound.WithMessage(name)
+	}
+
+	reader, err := fs.archive.OpenMember(index)
+	if err != nil {
+		return nil, disko.ErrIOFailed.Wrap(err)
+	}
+	return &memberHandle{fs: fs, index: index, reader: reader}, nil
+}
+
+func (fs *FileSystem) GetRootDirectory() disko.ObjectHandle {
+	return &rootHandle{fs: fs}
+}
+
+func (fs *FileSystem) FSStat() disko.FSStat {
+	var totalBlocks uint64
+	for _, member := range fs.members {
+		totalBlocks += fs.blocksFor(member.Size)
+	}
+
+	return disko.FSStat{
+		BlockSize:     fs.blockSize,
+		TotalBlocks:   totalBlocks,
+		Files:         uint64(len(fs.members)),
+		MaxNameLength: math.MaxUint,
+	}
+}
+
+func (fs *FileSystem) GetFSFeatures() disko.FSFeatures {
+	return fs.features
+}
+
+// blocksFor returns the number of blocks needed to hold `size` bytes.
+func (fs *FileSystem) blocksFor(size int64) uint64 {
+	return (uint64(size) + uint64(fs.blockSize) - 1) / uint64(fs.blockSize)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// readOnlyHandle implements the methods of [disko.ObjectHandle] that modify
+// objects, which all fail for archives.
+type readOnlyHandle struct{}
+
+func (readOnlyHandle) Resize(newSize uint64) disko.DriverError {
+	return disko.ErrReadOnlyFileSystem
+}
+
+func (readOnlyHandle) WriteBlocks(index c.LogicalBlock, data []byte) disko.DriverError {
+	return disko.ErrReadOnlyFileSystem
+}
+
+func (readOnlyHandle) ZeroOutBlocks(startIndex c.LogicalBlock, count uint) disko.DriverError {
+	return disko.ErrReadOnlyFileSystem
+}
+
+func (readOnlyHandle) Unlink() disko.DriverError {
+	return disko.ErrReadOnlyFileSystem
+}
+
+// rootHandle is the [disko.ObjectHandle] for the root directory, which contains
+// all members of the archive.
+type rootHandle struct {
+	readOnlyHandle
+	fs *FileSystem
+}
+
+func (handle *rootHandle) Stat() disko.FileStat {
+	return disko.FileStat{
+		Nlinks:       1,
+		ModeFlags:    os.ModeDir | 0o555,
+		BlockSize:    int64(handle.fs.blockSize),
+		CreatedAt:    disko.UndefinedTimestamp,
+		LastAccessed: disko.UndefinedTimestamp,
+		LastModified: disko.UndefinedTimestamp,
+		LastChanged:  disko.UndefinedTimestamp,
+		DeletedAt:    disko.UndefinedTimestamp,
+	}
+}
+
+func (handle *rootHandle) ReadBlocks(index c.LogicalBlock, buffer []byte) disko.DriverError {
+	return disko.ErrIsADirectory
+}
+
+func (handle *rootHandle) Name() string {
+	return "/"
+}
+
+func (handle *rootHandle) SameAs(other disko.ObjectHandle) bool {
+	otherRoot, ok := other.(*rootHandle)
+	return ok && otherRoot.fs == handle.fs
+}
+
+func (handle *rootHandle) Close() error {
+	return nil
+}
+
+// ListDir implements [disko.SupportsListDirHandle]. Names are returned sorted.
+func (handle *rootHandle) ListDir() ([]string, disko.DriverError) {
+	names := make([]string, 0, len(handle.fs.members))
+	for _, member := range handle.fs.members {
+		names = append(names, member.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// memberHandle is the [disko.ObjectHandle] for a member of the archive.
+type memberHandle struct {
+	readOnlyHandle
+	fs     *FileSystem
+	index  int
+	reader io.ReaderAt
+	closed bool
+}
+
+func (handle *memberHandle) Stat() disko.FileStat {
+	member := handle.fs.members[handle.index]
+	mode := member.Mode & os.ModePerm
+	if mode == 0 {
+		mode = 0o444
+	}
+
+	return disko.FileStat{
+		// Inode 0 is conventionally invalid, and the root directory has no
+		// number, so members start at 1.
+		InodeNumber:  uint64(handle.index) + 1,
+		Nlinks:       1,
+		ModeFlags:    mode,
+		Size:         member.Size,
+		BlockSize:    int64(handle.fs.blockSize),
+		NumBlocks:    int64(handle.fs.blocksFor(member.Size)),
+		CreatedAt:    disko.UndefinedTimestamp,
+		LastAccessed: disko.UndefinedTimestamp,
+		LastModified: member.LastModified,
+		LastChanged:  disko.UndefinedTimestamp,
+		DeletedAt:    disko.UndefinedTimestamp,
+	}
+}
+
+// ReadBlocks reads the member's contents. The part of the last block past the
+// end of the member is filled with null bytes.
+func (handle *memberHandle) ReadBlocks(index c.LogicalBlock, buffer []byte) disko.DriverError {
+	member := handle.fs.members[handle.index]
+	offset := int64(index) * int64(handle.fs.blockSize)
+
+	wanted := buffer
+	if remaining := member.Size - offset; int64(len(wanted)) > remaining {
+		wanted = buffer[:remaining]
+	}
+
+	n, err := handle.reader.ReadAt(wanted, offset)
+	if n < len(wanted) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return disko.ErrIOFailed.Wrap(
+			fmt.Errorf("%s: failed to read block %d: %w", member.Name, index, err))
+	}
+
+	for i := len(wanted); i < len(buffer); i++ {
+		buffer[i] = 0
+	}
+	return nil
+}
+
+func (handle *memberHandle) Name() string {
+	return handle.fs.members[handle.index].Name
+}
+
+func (handle *memberHandle) SameAs(other disko.ObjectHandle) bool {
+	otherMember, ok := other.(*memberHandle)
+	return ok && otherMember.fs == handle.fs && otherMember.index == handle.index
+}
+
+// ListXattrs implements [disko.SupportsXattrHandle].
+func (handle *memberHandle) ListXattrs() ([]string, disko.DriverError) {
+	xattrs := handle.fs.members[handle.index].Xattrs
+	names := make([]string, 0, len(xattrs))
+	for name := range xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// GetXattr implements [disko.SupportsXattrHandle].
+func (handle *memberHandle) GetXattr(name string) ([]byte, disko.DriverError) {
+	member := handle.fs.members[handle.index]
+	value, ok := member.Xattrs[name]
+	if !ok {
+		return nil, disko.ErrNotFound.WithMessage(
+			fmt.Sprintf("%s has no extended attribute %q", member.Name, name))
+	}
+	return value, nil
+}
+
+func (handle *memberHandle) Close() error {
+	if handle.closed {
+		return disko.ErrFileDescriptorBadState
+	}
+	handle.closed = true
+	return nil
+}
@@ -0,0 +1,134 @@
+package archivefs_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/common/archivefs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryArchive is an [archivefs.Archive] whose members are stored back to back
+// in a byte slice.
+type memoryArchive struct {
+	members []archivefs.Member
+	data    []byte
+}
+
+func newMemoryArchive(contents map[string]string, order ...string) *memoryArchive {
+	archive := &memoryArchive{}
+	for _, name := range order {
+		archive.members = append(
+			archive.members,
+			archivefs.Member{
+				Name:         name,
+				Size:         int64(len(contents[name])),
+				LastModified: time.Date(1984, time.May, 1, 12, 0, 0, 0, time.UTC),
+			},
+		)
+		archive.data = append(archive.data, contents[name]...)
+	}
+	return archive
+}
+
+func (archive *memoryArchive) Members() ([]archivefs.Member, error) {
+	return archive.members, nil
+}
+
+func (archive *memoryArchive) OpenMember(index int) (io.ReaderAt, error) {
+	var offset int64
+	for _, member := range archive.members[:index] {
+		offset += member.Size
+	}
+	return io.NewSectionReader(
+		bytes.NewReader(archive.data), offset, archive.members[index].Size), nil
+}
+
+func mountArchive(t *testing.T, archive archivefs.Archive) *driver.BaseDriver {
+	implementation := archivefs.New(archive, 128, disko.FSFeatures{HasModifiedTime: true})
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowRead))
+	return driver.New(implementation, disko.MountFlagsAllowRead)
+}
+
+func TestFileSystem__ReadMembers(t *testing.T) {
+	contents := map[string]string{
+		"README.TXT": "Read me first.\n",
+		"BIG.DAT":    string(bytes.Repeat([]byte("0123456789"), 30)),
+		"EMPTY":      "",
+	}
+	fs := mountArchive(t, newMemoryArchive(contents, "README.TXT", "BIG.DAT", "EMPTY"))
+
+	for name, expected := range contents {
+		data, err := fs.ReadFile("/" + name)
+		require.NoErrorf(t, err, "failed to read %s", name)
+		assert.Equalf(t, expected, string(data), "contents of %s are wrong", name)
+	}
+
+	entries, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"BIG.DAT", "EMPTY", "README.TXT"}, names)
+
+	info, err := fs.Stat("/BIG.DAT")
+	require.NoError(t, err)
+	assert.EqualValues(t, 300, info.Size)
+	assert.Equal(t, os.FileMode(0o444), info.ModeFlags)
+	assert.Equal(t, 1984, info.LastModified.Year())
+}
+
+func TestFileSystem__ReadOnly(t *testing.T) {
+	fs := mountArchive(t, newMemoryArchive(map[string]string{"A": "a"}, "A"))
+
+	_, err := fs.ReadFile("/MISSING")
+	assert.ErrorIs(t, err, disko.ErrNotFound)
+
+	err = fs.WriteFile("/B", []byte("b"), 0o644)
+	assert.Error(t, err, "creating a file in an archive succeeded")
+}
+
+func TestFileSystem__DuplicateNames(t *testing.T) {
+	archive := newMemoryArchive(map[string]string{"A": "a"}, "A", "A")
+	implementation := archivefs.New(archive, 128, disko.FSFeatures{})
+	err := implementation.Mount(disko.MountFlagsAllowRead)
+	assert.ErrorIs(t, err, disko.ErrFileSystemCorrupted)
+}
+
+func TestFileSystem__Xattrs(t *testing.T) {
+	archive := newMemoryArchive(map[string]string{"A": "a", "B": "b"}, "A", "B")
+	archive.members[0].Xattrs = map[string][]byte{
+		"test.second": []byte("2"),
+		"test.first":  []byte("1"),
+	}
+	fs := mountArchive(t, archive)
+
+	names, err := fs.ListXattrs("/A")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test.first", "test.second"}, names)
+
+	value, err := fs.GetXattr("/A", "test.second")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("2"), value)
+
+	_, err = fs.GetXattr("/A", "test.missing")
+	assert.ErrorIs(t, err, disko.ErrNotFound)
+
+	names, err = fs.ListXattrs("/B")
+	require.NoError(t, err)
+	assert.Empty(t, names)
+
+	// The root directory doesn't support extended attributes at all.
+	names, err = fs.ListXattrs("/")
+	require.NoError(t, err)
+	assert.Empty(t, names)
+	_, err = fs.GetXattr("/", "test.first")
+	assert.ErrorIs(t, err, disko.ErrNotFound)
+}
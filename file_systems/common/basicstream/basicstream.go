@@ -77,10 +77,10 @@ func (stream *BasicStream) Close() error {
 
 // Read implements [io.Reader].
 func (stream *BasicStream) Read(buffer []byte) (int, error) {
+	// Advance even if there's an error, since a short read at the end of the
+	// stream returns the data along with io.EOF.
 	totalRead, err := stream.ReadAt(buffer, stream.position)
-	if err == nil {
-		stream.position += int64(totalRead)
-	}
+	stream.position += int64(totalRead)
 	return totalRead, err
 }
 
@@ -278,24 +278,41 @@ func (stream *BasicStream) implWriteAt(buffer []byte, offset int64) (int, error)
 	}
 
 	bufLen := int64(len(buffer))
+	if bufLen == 0 {
+		return 0, nil
+	}
+
+	endOffset := offset + bufLen
 	startBlock, startOffset := stream.convertLinearAddr(offset)
-	lastBlock, _ := stream.convertLinearAddr(offset + bufLen)
+	lastBlock, _ := stream.convertLinearAddr(endOffset - 1)
 
 	// If we're going to end up writing past the end of the stream we need to
 	// grow the file first.
 	if uint(lastBlock) >= stream.data.TotalBlocks() {
-		err := stream.Truncate(offset + bufLen)
+		err := stream.Truncate(endOffset)
 		if err != nil {
 			return 0, err
 		}
 	}
 
-	targetSlice, err := stream.data.GetSlice(startBlock, uint(lastBlock)+1)
+	numBlocks := uint(lastBlock-startBlock) + 1
+	targetSlice, err := stream.data.GetSlice(startBlock, numBlocks)
 	if err != nil {
 		return 0, err
 	}
 
+	// Write the modified blocks back rather than changing them in place, since
+	// a cache that spills to disk returns a copy of its data.
 	copy(targetSlice[startOffset:], buffer)
+	_, err = stream.data.WriteAt(targetSlice, startBlock)
+	if err != nil {
+		return 0, err
+	}
+
+	// The write may have extended the stream without needing a new block.
+	if endOffset > stream.size {
+		stream.size = endOffset
+	}
 
 	if stream.ioFlags.Synchronous() {
 		return len(buffer), stream.Sync()
@@ -326,10 +343,16 @@ func (stream *BasicStream) WriteTo(w io.Writer) (n int64, err error) {
 		blockSize, err := stream.Read(buffer)
 
 		// Always write the data we've read in regardless of whether an error
-		// occurred or not.
+		// occurred or not. A failed write stops the copy, so that writers that
+		// refuse data (e.g. because of a size limit) aren't silently ignored.
 		if blockSize > 0 {
-			w.Write(buffer[:blockSize])
-			totalWritten += int64(blockSize)
+			written, writeErr := w.Write(buffer[:blockSize])
+			totalWritten += int64(written)
+			if writeErr != nil {
+				return totalWritten, writeErr
+			} else if written < blockSize {
+				return totalWritten, io.ErrShortWrite
+			}
 		}
 
 		// If we hit EOF, we're done. Any other error is fatal.
@@ -9,7 +9,9 @@ import (
 	"testing"
 
 	"github.com/dargueta/disko"
+	c "github.com/dargueta/disko/file_systems/common"
 	"github.com/dargueta/disko/file_systems/common/basicstream"
+	"github.com/dargueta/disko/file_systems/common/blockcache"
 	diskotest "github.com/dargueta/disko/testing"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -234,6 +236,82 @@ func TestBasicStream__ReadBasic(t *testing.T) {
 	assert.EqualValues(t, 1, bytesRemaining)
 }
 
+// Appending small chunks that don't need a new block must still grow the stream.
+func TestBasicStream__Write__SmallAppendsGrowStream(t *testing.T) {
+	backingData := make([]byte, 1024)
+	cache := diskotest.CreateDefaultCache(128, 8, true, backingData, t)
+	stream, err := basicstream.New(0, cache, disko.O_RDWR|disko.O_APPEND)
+	require.NoError(t, err, "failed to create stream")
+
+	expected := []byte{}
+	for i := 0; i < 10; i++ {
+		chunk := bytes.Repeat([]byte{byte(i + 1)}, 30)
+		n, err := stream.Write(chunk)
+		require.NoErrorf(t, err, "write %d failed", i)
+		require.EqualValues(t, len(chunk), n, "wrote wrong number of bytes")
+
+		expected = append(expected, chunk...)
+		require.EqualValuesf(t, len(expected), stream.Size(), "size wrong after write %d", i)
+	}
+
+	readBack := make([]byte, len(expected))
+	n, err := stream.ReadAt(readBack, 0)
+	require.NoError(t, err, "failed to read back data")
+	assert.EqualValues(t, len(expected), n, "read back wrong number of bytes")
+	assert.Equal(t, expected, readBack, "data read back is wrong")
+
+	require.NoError(t, stream.Sync(), "failed to flush stream")
+	assert.Equal(t, expected, backingData[:len(expected)], "data wasn't flushed")
+}
+
+// Overwriting data in the middle of a stream must mark the blocks dirty so that
+// they get flushed.
+func TestBasicStream__Write__OverwriteIsFlushed(t *testing.T) {
+	backingData := diskotest.CreateRandomImage(64, 8, t)
+	original := make([]byte, len(backingData))
+	copy(original, backingData)
+
+	cache := diskotest.CreateDefaultCache(64, 8, true, backingData, t)
+	stream, err := basicstream.New(cache.Size(), cache, disko.O_RDWR)
+	require.NoError(t, err, "failed to create stream")
+
+	patch := bytes.Repeat([]byte{0xAA}, 100)
+	_, err = stream.WriteAt(patch, 100)
+	require.NoError(t, err, "write failed")
+	assert.EqualValues(t, 512, stream.Size(), "overwriting changed the stream size")
+
+	require.NoError(t, stream.Sync(), "failed to flush stream")
+	copy(original[100:], patch)
+	assert.Equal(t, original, backingData, "backing data is wrong after flush")
+}
+
+// failingWriter accepts `limit` bytes and then fails.
+type failingWriter struct {
+	limit   int
+	written int
+}
+
+func (writer *failingWriter) Write(data []byte) (int, error) {
+	if writer.written+len(data) > writer.limit {
+		return 0, disko.ErrFileTooLarge
+	}
+	writer.written += len(data)
+	return len(data), nil
+}
+
+// WriteTo stops at the first write that fails, and returns its error.
+func TestBasicStream__WriteTo__WriteFails(t *testing.T) {
+	cache := diskotest.CreateDefaultCache(64, 8, false, nil, t)
+	stream, err := basicstream.New(cache.Size(), cache, disko.O_RDONLY)
+	require.NoError(t, err, "failed to create stream")
+
+	writer := failingWriter{limit: 200}
+	n, err := stream.WriteTo(&writer)
+	assert.ErrorIs(t, err, disko.ErrFileTooLarge)
+	assert.EqualValues(t, 192, n, "wrong number of bytes reported written")
+	assert.EqualValues(t, 256, stream.Tell(), "stream kept reading after the write failed")
+}
+
 // doCheckedSeek performs the requested seek on the stream and checks the results.
 // If the seek fails, it will return an error. The returned offset is always the
 // return value of Seek(), even if it failed.
@@ -298,3 +376,110 @@ func checkStreamRead(
 		n,
 		where)
 }
+
+// Benchmarks ------------------------------------------------------------------
+
+// Read an entire 4 MiB stream from beginning to end in 4 KiB chunks.
+func BenchmarkBasicStream__Read__Sequential(b *testing.B) {
+	data := diskotest.CreateRandomImage(512, 8192, b)
+	buffer := make([]byte, 4096)
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		cache := diskotest.CreateDefaultCache(512, 8192, false, data, b)
+		stream, err := basicstream.New(cache.Size(), cache, disko.O_RDONLY)
+		if err != nil {
+			b.Fatalf("failed to create stream: %s", err)
+		}
+		b.StartTimer()
+
+		for {
+			_, err := stream.Read(buffer)
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				b.Fatalf("read failed at offset %d: %s", stream.Tell(), err)
+			}
+		}
+	}
+}
+
+// Make small reads at random offsets, the typical access pattern for parsing
+// directories and other metadata.
+func BenchmarkBasicStream__ReadAt__Random(b *testing.B) {
+	data := diskotest.CreateRandomImage(512, 8192, b)
+	cache := diskotest.CreateDefaultCache(512, 8192, false, data, b)
+	stream, err := basicstream.New(cache.Size(), cache, disko.O_RDONLY)
+	require.NoError(b, err, "failed to create stream")
+
+	buffer := make([]byte, 32)
+	offsets := make([]int64, 4096)
+	for i := range offsets {
+		offsets[i] = rand.Int63n(int64(len(data) - len(buffer)))
+	}
+
+	b.SetBytes(int64(len(offsets) * len(buffer)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, offset := range offsets {
+			_, err := stream.ReadAt(buffer, offset)
+			if err != nil {
+				b.Fatalf("read of %d bytes at %d failed: %s", len(buffer), offset, err)
+			}
+		}
+	}
+}
+
+// Build up a stream with many small appends, growing it one block at a time.
+func BenchmarkBasicStream__Write__SmallAppends(b *testing.B) {
+	chunk := diskotest.CreateRandomImage(100, 1, b)
+
+	b.SetBytes(int64(len(chunk) * 1000))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		backingData := make([]byte, 0)
+		cache := blockcache.New(
+			512,
+			0,
+			func(index c.LogicalBlock, buffer []byte) error {
+				start := int(index) * 512
+				copy(buffer, backingData[start:start+512])
+				return nil
+			},
+			func(index c.LogicalBlock, buffer []byte) error {
+				start := int(index) * 512
+				copy(backingData[start:start+512], buffer)
+				return nil
+			},
+			func(newTotalBlocks c.LogicalBlock) error {
+				newData := make([]byte, int(newTotalBlocks)*512)
+				copy(newData, backingData)
+				backingData = newData
+				return nil
+			},
+		)
+		stream, err := basicstream.New(0, cache, disko.O_WRONLY|disko.O_APPEND)
+		if err != nil {
+			b.Fatalf("failed to create stream: %s", err)
+		}
+		b.StartTimer()
+
+		for j := 0; j < 1000; j++ {
+			_, err := stream.Write(chunk)
+			if err != nil {
+				b.Fatalf("write %d failed: %s", j, err)
+			}
+		}
+
+		err = stream.Close()
+		if err != nil {
+			b.Fatalf("failed to close stream: %s", err)
+		}
+	}
+}
@@ -49,6 +49,22 @@ type FlushBlockCallback func(blockIndex c.LogicalBlock, buffer []byte) error
 //     FAT 8/12/16.
 type ResizeCallback func(newTotalBlocks c.LogicalBlock) error
 
+// FetchRangesCallback is a pointer to a function that fills the buffer of each
+// range with the contents of the blocks it covers, from the backing storage.
+// Ranges are sorted by their starting block and don't overlap. All guarantees
+// in [FetchBlockCallback] apply to each block, and the ranges are never empty.
+type FetchRangesCallback func(ranges []disko.BlockRange) error
+
+// FlushRangesCallback is a pointer to a function that writes the buffer of each
+// range to the blocks it covers in the backing storage. All guarantees in
+// [FetchRangesCallback] apply here too.
+type FlushRangesCallback func(ranges []disko.BlockRange) error
+
+// HoleCallback is a pointer to a function that returns true if a block in the
+// backing storage is a hole, i.e. it's known to contain only null bytes without
+// having to be read. All guarantees in [FetchBlockCallback] apply.
+type HoleCallback func(blockIndex c.LogicalBlock) bool
+
 // A BlockCache
 type BlockCache struct {
 	// loadedBlocks is a bitmap indicating which blocks are in `data`; 1 means
@@ -63,6 +79,22 @@ type BlockCache struct {
 	bytesPerBlock uint
 	totalBlocks   uint
 	data          []byte
+	// frozen indicates that all blocks have been loaded and the cache must not
+	// be modified anymore. See [BlockCache.Freeze].
+	frozen bool
+	// spill holds the blocks instead of `data` if the cache's memory use is
+	// limited. See [BlockCache.EnableSpilling].
+	spill *spillStore
+	// unmap releases `data` if it's a memory-mapped file. It's nil for caches
+	// that weren't created by [MapFile].
+	unmap func() error
+	// fetchRanges and flushRanges are used instead of `fetch` and `flush` to
+	// access several blocks at once, if set. See [BlockCache.SetRangeCallbacks].
+	fetchRanges FetchRangesCallback
+	flushRanges FlushRangesCallback
+	// isHole, if set, tells us which blocks can be zero-filled instead of
+	// fetched. See [BlockCache.SetHoleCallback].
+	isHole HoleCallback
 }
 
 // New creates a new [BlockCache].
@@ -123,16 +155,7 @@ func WrapStream(
 			return err
 		}
 
-		if read {
-			_, err = stream.Read(buffer)
-		} else {
-			_, err = stream.Write(buffer)
-		}
-
-		if err != nil && err != io.EOF {
-			return err
-		}
-		return nil
+		return transferBlock(stream, block, buffer, read)
 	}
 
 	fetchCb := func(block c.LogicalBlock, buffer []byte) error {
@@ -184,6 +207,38 @@ func WrapSlice(storage []byte, bytesPerBlock uint) *BlockCache {
 	return WrapStream(stream, bytesPerBlock, uint(len(storage))/bytesPerBlock, false)
 }
 
+// transferBlock reads or writes `buffer` at the stream's current position,
+// failing with [disko.ErrIOFailed] if fewer than `len(buffer)` bytes could be
+// transferred. `block` is only used for error messages.
+func transferBlock(stream io.ReadWriter, block c.LogicalBlock, buffer []byte, read bool) error {
+	var n int
+	var err error
+	operation := "read"
+	if read {
+		// A single Read() may legitimately return fewer bytes than asked for,
+		// so keep reading until the buffer is full or we hit EOF.
+		n, err = io.ReadFull(stream, buffer)
+	} else {
+		operation = "write"
+		n, err = stream.Write(buffer)
+	}
+
+	if n < len(buffer) {
+		message := fmt.Sprintf(
+			"short %s of block %d: %d of %d bytes transferred",
+			operation,
+			block,
+			n,
+			len(buffer),
+		)
+		if err == nil || err == io.EOF || err == io.ErrUnexpectedEOF {
+			return disko.ErrIOFailed.WithMessage(message)
+		}
+		return disko.ErrIOFailed.Wrap(fmt.Errorf("%s: %w", message, err))
+	}
+	return err
+}
+
 // seekToBlock sets the stream pointer for a stream to the offset of a block.
 func seekToBlock(stream io.Seeker, block, totalBlocks c.LogicalBlock, bytesPerBlock uint) error {
 	if block >= totalBlocks {
@@ -201,6 +256,74 @@ func seekToBlock(stream io.Seeker, block, totalBlocks c.LogicalBlock, bytesPerBl
 	return err
 }
 
+// SetRangeCallbacks makes the cache load and flush all the blocks it needs at
+// once, as a list of runs of consecutive blocks, instead of one block at a time.
+// Either callback can be nil, in which case the single-block callback given to
+// [New] is used for that direction. Caches that spill to disk always access one
+// block at a time.
+func (cache *BlockCache) SetRangeCallbacks(
+	fetchCb FetchRangesCallback,
+	flushCb FlushRangesCallback,
+) {
+	cache.fetchRanges = fetchCb
+	cache.flushRanges = flushCb
+}
+
+// SetHoleCallback makes the cache fill blocks that `holeCb` says are holes with
+// null bytes when they're loaded, instead of fetching them from the backing
+// storage. Passing nil turns this off.
+func (cache *BlockCache) SetHoleCallback(holeCb HoleCallback) {
+	cache.isHole = holeCb
+}
+
+// fetchBlock fills `buffer` with the contents of a block from the backing
+// storage, or with null bytes if the block is a hole.
+func (cache *BlockCache) fetchBlock(blockIndex c.LogicalBlock, buffer []byte) error {
+	if cache.isHole != nil && cache.isHole(blockIndex) {
+		for i := range buffer {
+			buffer[i] = 0
+		}
+		return nil
+	}
+	return cache.fetch(blockIndex, buffer)
+}
+
+// collectRanges returns the runs of consecutive blocks in [start, start + count)
+// for which `include` returns true, with buffers pointing into the cache's
+// storage.
+func (cache *BlockCache) collectRanges(
+	start c.LogicalBlock,
+	count uint,
+	include func(blockIndex int) bool,
+) []disko.BlockRange {
+	ranges := []disko.BlockRange{}
+	runStart := -1
+	end := int(start) + int(count)
+
+	for blockIndex := int(start); blockIndex <= end; blockIndex++ {
+		if blockIndex < end && include(blockIndex) {
+			if runStart < 0 {
+				runStart = blockIndex
+			}
+			continue
+		} else if runStart < 0 {
+			continue
+		}
+
+		startOffset := uint(runStart) * cache.bytesPerBlock
+		endOffset := uint(blockIndex) * cache.bytesPerBlock
+		ranges = append(
+			ranges,
+			disko.BlockRange{
+				Start: c.LogicalBlock(runStart),
+				Data:  cache.data[startOffset:endOffset],
+			},
+		)
+		runStart = -1
+	}
+	return ranges
+}
+
 // BytesPerBlock returns the size of a single block, in bytes.
 func (cache *BlockCache) BytesPerBlock() uint {
 	return cache.bytesPerBlock
@@ -253,7 +376,8 @@ func (cache *BlockCache) CheckBounds(start c.LogicalBlock, bufferSize uint) erro
 // `start` and continuing for `count` blocks.
 //
 // If the returned slice is modified, the modified blocks MUST be marked as
-// dirty. Use [MarkBlockRangeDirty] for this.
+// dirty. Use [MarkBlockRangeDirty] for this. If the cache spills to disk, the
+// slice is a copy, and changes must be written back with [BlockCache.WriteAt].
 func (cache *BlockCache) GetSlice(
 	start c.LogicalBlock,
 	count uint,
@@ -263,6 +387,10 @@ func (cache *BlockCache) GetSlice(
 		return nil, err
 	}
 
+	if cache.spill != nil {
+		return cache.spilledCopy(start, count)
+	}
+
 	startOffset := uint(start) * cache.bytesPerBlock
 	endOffset := startOffset + (count * cache.bytesPerBlock)
 	return cache.data[startOffset:endOffset], nil
@@ -273,8 +401,13 @@ func (cache *BlockCache) GetSlice(
 // for large files or with inefficient driver implementations.
 //
 // If the returned slice is modified, the modified blocks MUST be marked as
-// dirty. Use [MarkBlockRangeDirty] for this.
+// dirty. Use [MarkBlockRangeDirty] for this. If the cache spills to disk, the
+// slice is a copy; see [BlockCache.GetSlice].
 func (cache *BlockCache) Data() ([]byte, error) {
+	if cache.spill != nil {
+		return cache.GetSlice(0, cache.totalBlocks)
+	}
+
 	err := cache.LoadAll()
 	if err != nil {
 		return nil, err
@@ -288,6 +421,12 @@ func (cache *BlockCache) loadBlockRange(start c.LogicalBlock, count uint) error
 	err := cache.CheckBounds(start, count*cache.bytesPerBlock)
 	if err != nil {
 		return err
+	} else if cache.spill != nil {
+		// Blocks are loaded as they're accessed, since they might not all fit
+		// in memory at once.
+		return nil
+	} else if cache.fetchRanges != nil {
+		return cache.loadBlockRangeBatched(start, count)
 	}
 
 	for blockIndex := uint(start); blockIndex < uint(start)+count; blockIndex++ {
@@ -302,7 +441,7 @@ func (cache *BlockCache) loadBlockRange(start c.LogicalBlock, count uint) error
 		buffer := cache.data[startByteOffset:endByteOffset]
 
 		// Load the block from backing storage directly into the cache.
-		err = cache.fetch(c.LogicalBlock(blockIndex), buffer)
+		err = cache.fetchBlock(c.LogicalBlock(blockIndex), buffer)
 		if err != nil {
 			return fmt.Errorf(
 				"failed to load block %d from source: %w",
@@ -319,12 +458,66 @@ func (cache *BlockCache) loadBlockRange(start c.LogicalBlock, count uint) error
 	return nil
 }
 
+// loadBlockRangeBatched does the same thing as [BlockCache.loadBlockRange],
+// except that all missing blocks are loaded with one call to the fetch ranges
+// callback.
+func (cache *BlockCache) loadBlockRangeBatched(start c.LogicalBlock, count uint) error {
+	// Holes are filled in here so they're left out of the ranges to fetch.
+	if cache.isHole != nil {
+		for blockIndex := uint(start); blockIndex < uint(start)+count; blockIndex++ {
+			if cache.loadedBlocks.Get(int(blockIndex)) ||
+				!cache.isHole(c.LogicalBlock(blockIndex)) {
+				continue
+			}
+
+			startByteOffset := blockIndex * cache.bytesPerBlock
+			block := cache.data[startByteOffset : startByteOffset+cache.bytesPerBlock]
+			for i := range block {
+				block[i] = 0
+			}
+			cache.loadedBlocks.Set(int(blockIndex), true)
+			cache.dirtyBlocks.Set(int(blockIndex), false)
+		}
+	}
+
+	ranges := cache.collectRanges(
+		start,
+		count,
+		func(blockIndex int) bool { return !cache.loadedBlocks.Get(blockIndex) },
+	)
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	err := cache.fetchRanges(ranges)
+	if err != nil {
+		return fmt.Errorf(
+			"failed to load %d block ranges starting at block %d from source: %w",
+			len(ranges),
+			ranges[0].Start,
+			err,
+		)
+	}
+
+	for _, blockRange := range ranges {
+		first := int(blockRange.Start)
+		last := first + len(blockRange.Data)/int(cache.bytesPerBlock)
+		for blockIndex := first; blockIndex < last; blockIndex++ {
+			cache.loadedBlocks.Set(blockIndex, true)
+			cache.dirtyBlocks.Set(blockIndex, false)
+		}
+	}
+	return nil
+}
+
 // flushBlockRange writes out all dirty blocks (and only dirty blocks) to the
 // underlying storage and marks them as clean.
 func (cache *BlockCache) flushBlockRange(start c.LogicalBlock, count uint) error {
 	err := cache.CheckBounds(start, count*cache.bytesPerBlock)
 	if err != nil {
 		return err
+	} else if cache.flushRanges != nil && cache.spill == nil {
+		return cache.flushBlockRangeBatched(start, count)
 	}
 
 	for blockIndex := int(start); uint(blockIndex) < uint(start)+count; blockIndex++ {
@@ -354,14 +547,51 @@ func (cache *BlockCache) flushBlockRange(start c.LogicalBlock, count uint) error
 	return nil
 }
 
+// flushBlockRangeBatched does the same thing as [BlockCache.flushBlockRange],
+// except that all dirty blocks are written with one call to the flush ranges
+// callback.
+func (cache *BlockCache) flushBlockRangeBatched(start c.LogicalBlock, count uint) error {
+	ranges := cache.collectRanges(start, count, cache.dirtyBlocks.Get)
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	err := cache.flushRanges(ranges)
+	if err != nil {
+		return fmt.Errorf(
+			"failed to flush %d block ranges starting at block %d to storage: %w",
+			len(ranges),
+			ranges[0].Start,
+			err,
+		)
+	}
+
+	for _, blockRange := range ranges {
+		first := int(blockRange.Start)
+		last := first + len(blockRange.Data)/int(cache.bytesPerBlock)
+		for blockIndex := first; blockIndex < last; blockIndex++ {
+			cache.dirtyBlocks.Set(blockIndex, false)
+		}
+	}
+	return nil
+}
+
 // LoadAll ensures all missing blocks are loaded from storage into the cache.
 func (cache *BlockCache) LoadAll() error {
+	if cache.totalBlocks == 0 {
+		return nil
+	}
 	return cache.loadBlockRange(0, cache.totalBlocks)
 }
 
 // Flush flushes all dirty blocks from the cache into storage, and marks them
 // as clean.
 func (cache *BlockCache) Flush() error {
+	// An empty cache, e.g. for a file truncated to nothing, has no blocks to
+	// check the bounds of.
+	if cache.totalBlocks == 0 {
+		return nil
+	}
 	return cache.flushBlockRange(0, cache.totalBlocks)
 }
 
@@ -400,6 +630,10 @@ func (cache *BlockCache) ReadAt(buffer []byte, start c.LogicalBlock) (int, error
 // Attempting to write past the end of the cache will result in an error, and
 // the cache will be left unmodified.
 func (cache *BlockCache) WriteAt(buffer []byte, start c.LogicalBlock) (int, error) {
+	if cache.frozen {
+		return 0, disko.ErrReadOnlyFileSystem.WithMessage("cache is frozen")
+	}
+
 	bufLen := uint(len(buffer))
 
 	err := cache.CheckBounds(start, bufLen)
@@ -407,6 +641,14 @@ func (cache *BlockCache) WriteAt(buffer []byte, start c.LogicalBlock) (int, erro
 		return 0, err
 	}
 
+	if cache.spill != nil {
+		err = cache.spilledWrite(buffer, start)
+		if err != nil {
+			return 0, err
+		}
+		return len(buffer), nil
+	}
+
 	totalBlocks := cache.GetMinBlocksForSize(bufLen)
 	targetByteSlice, err := cache.GetSlice(start, totalBlocks)
 	if err != nil {
@@ -431,13 +673,22 @@ func (cache *BlockCache) WriteAt(buffer []byte, start c.LogicalBlock) (int, erro
 // the slice. These new blocks are treated as dirty, so flushing the cache will
 // write them out.
 func (cache *BlockCache) Resize(newTotalBlocks uint) error {
+	if cache.frozen {
+		return disko.ErrReadOnlyFileSystem.WithMessage("cache is frozen")
+	}
+
 	err := cache.resize(c.LogicalBlock(newTotalBlocks))
 	if err != nil {
 		return err
 	}
 
-	newCacheData := make([]byte, uint(newTotalBlocks)*cache.bytesPerBlock)
-	copy(newCacheData, cache.data)
+	var newCacheData []byte
+	if cache.spill != nil {
+		cache.spilledResize(newTotalBlocks)
+	} else {
+		newCacheData = make([]byte, uint(newTotalBlocks)*cache.bytesPerBlock)
+		copy(newCacheData, cache.data)
+	}
 
 	// Allocate new copies of the dirty/present bitmaps of the correct size.
 	newDirtyBlocks := bitmap.Bitmap(bitmap.NewSlice(int(newTotalBlocks)))
@@ -472,11 +723,28 @@ func (cache *BlockCache) MarkBlockRangeDirty(
 	start c.LogicalBlock,
 	count uint,
 ) error {
+	if cache.frozen {
+		return disko.ErrReadOnlyFileSystem.WithMessage("cache is frozen")
+	}
+
 	err := cache.CheckBounds(start, count*cache.bytesPerBlock)
 	if err != nil {
 		return err
 	}
 
+	if cache.spill != nil {
+		// Blocks that aren't loaded have to be fetched first, or else they'd be
+		// treated as zeroed blocks.
+		for i := uint(0); i < count; i++ {
+			_, err = cache.spilledBlockBuffer(uint(start) + i)
+			if err != nil {
+				return err
+			}
+			cache.dirtyBlocks.Set(int(start)+int(i), true)
+		}
+		return nil
+	}
+
 	for i := uint(0); i < count; i++ {
 		// FIXME(dargueta): We can end up with integer overflow here
 		bitIndex := int(start) + int(i)
@@ -485,3 +753,74 @@ func (cache *BlockCache) MarkBlockRangeDirty(
 	}
 	return nil
 }
+
+// MarkBlockRangeClean marks a range of blocks as unmodified, so that they won't
+// be written out to the backing storage unless they're modified again. Any
+// changes already made to them remain in the cache but may be lost.
+func (cache *BlockCache) MarkBlockRangeClean(
+	start c.LogicalBlock,
+	count uint,
+) error {
+	if cache.frozen {
+		return disko.ErrReadOnlyFileSystem.WithMessage("cache is frozen")
+	}
+
+	err := cache.CheckBounds(start, count*cache.bytesPerBlock)
+	if err != nil {
+		return err
+	}
+
+	for i := uint(0); i < count; i++ {
+		cache.dirtyBlocks.Set(int(start)+int(i), false)
+	}
+	return nil
+}
+
+// Freeze loads all blocks from storage and makes the cache immutable. Once
+// frozen, the cache never calls the fetch, flush, or resize callbacks again,
+// and all functions that would modify it fail with [disko.ErrReadOnlyFileSystem].
+//
+// Because a frozen cache never modifies its internal state, it's safe to read
+// from it from multiple goroutines without any locking. Callers must not modify
+// slices returned by [BlockCache.GetSlice] or [BlockCache.Data].
+//
+// Dirty blocks are flushed before the cache is frozen.
+func (cache *BlockCache) Freeze() error {
+	if cache.frozen {
+		return nil
+	} else if cache.spill != nil {
+		return disko.ErrNotSupported.WithMessage("a cache that spills to disk can't be frozen")
+	}
+
+	err := cache.Flush()
+	if err != nil {
+		return err
+	}
+
+	err = cache.LoadAll()
+	if err != nil {
+		return err
+	}
+
+	cache.frozen = true
+	return nil
+}
+
+// Close releases resources held by the cache: the temporary file of a cache
+// that spills to disk, or the mapping of a cache created by [MapFile]. Dirty
+// blocks are not flushed; call [BlockCache.Flush] first. The cache can't be
+// used after this is called. For other caches, this does nothing.
+func (cache *BlockCache) Close() error {
+	if cache.unmap != nil {
+		unmap := cache.unmap
+		cache.unmap = nil
+		cache.data = nil
+		return unmap()
+	}
+	return cache.closeSpillFile()
+}
+
+// IsFrozen returns true if [BlockCache.Freeze] has been called on this cache.
+func (cache *BlockCache) IsFrozen() bool {
+	return cache.frozen
+}
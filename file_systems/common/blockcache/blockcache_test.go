@@ -2,7 +2,9 @@ package blockcache_test
 
 import (
 	"fmt"
+	"io"
 	"math/rand"
+	"sync"
 	"testing"
 
 	disko "github.com/dargueta/disko"
@@ -11,6 +13,7 @@ import (
 	diskotest "github.com/dargueta/disko/testing"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/xaionaro-go/bytesextra"
 )
 
 // Test block fetch functionality with no trickery such as reading past the end
@@ -259,3 +262,341 @@ func TestBlockCache__Write__WriteOverlappingPastEndFails(t *testing.T) {
 	assert.Equal(t, 0, n)
 	assert.Equal(t, copyOfOriginalData, cacheData, "cache data unexpectedly modified")
 }
+
+// Freezing a cache loads all blocks, after which the cache never calls back into
+// the storage again, and all modifications fail.
+func TestBlockCache__Freeze__Basic(t *testing.T) {
+	rawBlocks := diskotest.CreateRandomImage(128, 32, t)
+	fetchCount := 0
+
+	cache := blockcache.New(
+		128,
+		32,
+		func(blockIndex c.LogicalBlock, buffer []byte) error {
+			fetchCount++
+			start := uint(blockIndex) * 128
+			copy(buffer, rawBlocks[start:start+128])
+			return nil
+		},
+		func(blockIndex c.LogicalBlock, buffer []byte) error {
+			t.Errorf("attempted to flush block %d of frozen cache", blockIndex)
+			return nil
+		},
+		nil,
+	)
+
+	require.False(t, cache.IsFrozen(), "cache should not be frozen yet")
+	require.NoError(t, cache.Freeze(), "failed to freeze cache")
+	require.True(t, cache.IsFrozen(), "cache should be frozen")
+	assert.Equal(t, 32, fetchCount, "all blocks should have been fetched exactly once")
+
+	// Freezing twice is harmless.
+	require.NoError(t, cache.Freeze(), "freezing a frozen cache should succeed")
+	assert.Equal(t, 32, fetchCount, "refreezing must not fetch blocks again")
+
+	buffer := make([]byte, 128)
+	_, err := cache.WriteAt(buffer, 0)
+	assert.ErrorIs(t, err, disko.ErrReadOnlyFileSystem, "WriteAt should've failed")
+
+	err = cache.MarkBlockRangeDirty(0, 1)
+	assert.ErrorIs(t, err, disko.ErrReadOnlyFileSystem, "MarkBlockRangeDirty should've failed")
+
+	err = cache.Resize(64)
+	assert.ErrorIs(t, err, disko.ErrReadOnlyFileSystem, "Resize should've failed")
+	assert.EqualValues(t, 32, cache.TotalBlocks(), "cache size changed")
+}
+
+// Reading from a frozen cache from many goroutines at once must return the
+// correct data without calling the fetch callback. Run with `-race` to detect
+// unsynchronized access.
+func TestBlockCache__Freeze__ConcurrentReads(t *testing.T) {
+	rawBlocks := diskotest.CreateRandomImage(128, 64, t)
+	cache := diskotest.CreateDefaultCache(128, 64, false, rawBlocks, t)
+	require.NoError(t, cache.Freeze(), "failed to freeze cache")
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			buffer := make([]byte, 128)
+			for i := 0; i < 64; i++ {
+				block := c.LogicalBlock((i + worker*7) % 64)
+				_, err := cache.ReadAt(buffer, block)
+				if assert.NoErrorf(t, err, "worker %d failed to read block %d", worker, block) {
+					start := block * 128
+					assert.Equalf(
+						t,
+						rawBlocks[start:start+128],
+						buffer,
+						"worker %d read wrong data for block %d",
+						worker,
+						block)
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+}
+
+// Benchmarks ------------------------------------------------------------------
+
+// benchmarkCacheBlocks is the number of blocks in the caches used for benchmarks.
+// With 512-byte blocks this gives a 4 MiB image, about the size of a large
+// early hard drive.
+const benchmarkCacheBlocks = 8192
+
+// Read every block of a cold cache in order.
+func BenchmarkBlockCache__ReadAt__Sequential(b *testing.B) {
+	rawBlocks := diskotest.CreateRandomImage(512, benchmarkCacheBlocks, b)
+	buffer := make([]byte, 512)
+
+	b.SetBytes(int64(len(rawBlocks)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		cache := diskotest.CreateDefaultCache(512, benchmarkCacheBlocks, false, rawBlocks, b)
+		b.StartTimer()
+
+		for block := c.LogicalBlock(0); block < benchmarkCacheBlocks; block++ {
+			_, err := cache.ReadAt(buffer, block)
+			if err != nil {
+				b.Fatalf("failed to read block %d: %s", block, err)
+			}
+		}
+	}
+}
+
+// Read blocks from a cold cache in random order. Some blocks will be read more
+// than once, so this also measures the cost of cache hits.
+func BenchmarkBlockCache__ReadAt__Random(b *testing.B) {
+	rawBlocks := diskotest.CreateRandomImage(512, benchmarkCacheBlocks, b)
+	buffer := make([]byte, 512)
+
+	order := make([]c.LogicalBlock, benchmarkCacheBlocks)
+	for i := range order {
+		order[i] = c.LogicalBlock(rand.Intn(benchmarkCacheBlocks))
+	}
+
+	b.SetBytes(int64(len(rawBlocks)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		cache := diskotest.CreateDefaultCache(512, benchmarkCacheBlocks, false, rawBlocks, b)
+		b.StartTimer()
+
+		for _, block := range order {
+			_, err := cache.ReadAt(buffer, block)
+			if err != nil {
+				b.Fatalf("failed to read block %d: %s", block, err)
+			}
+		}
+	}
+}
+
+// Write every block and flush the whole cache to storage.
+func BenchmarkBlockCache__WriteAt__Flush(b *testing.B) {
+	rawBlocks := diskotest.CreateRandomImage(512, benchmarkCacheBlocks, b)
+	cache := diskotest.CreateDefaultCache(512, benchmarkCacheBlocks, true, rawBlocks, b)
+	buffer := diskotest.CreateRandomImage(512, 1, b)
+
+	b.SetBytes(int64(len(rawBlocks)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for block := c.LogicalBlock(0); block < benchmarkCacheBlocks; block++ {
+			_, err := cache.WriteAt(buffer, block)
+			if err != nil {
+				b.Fatalf("failed to write block %d: %s", block, err)
+			}
+		}
+
+		err := cache.Flush()
+		if err != nil {
+			b.Fatalf("flush failed: %s", err)
+		}
+	}
+}
+
+// With range callbacks set, all missing blocks must be loaded with one call, and
+// all dirty blocks flushed with one call, as runs of consecutive blocks.
+func TestBlockCache__RangeCallbacks(t *testing.T) {
+	backingData := diskotest.CreateRandomImage(64, 16, t)
+	cache := diskotest.CreateDefaultCache(64, 16, true, backingData, t)
+
+	fetchCalls := [][]disko.BlockRange{}
+	flushCalls := [][]disko.BlockRange{}
+	cache.SetRangeCallbacks(
+		func(ranges []disko.BlockRange) error {
+			fetchCalls = append(fetchCalls, ranges)
+			for _, blockRange := range ranges {
+				copy(blockRange.Data, backingData[blockRange.Start*64:])
+			}
+			return nil
+		},
+		func(ranges []disko.BlockRange) error {
+			flushCalls = append(flushCalls, ranges)
+			for _, blockRange := range ranges {
+				copy(backingData[blockRange.Start*64:], blockRange.Data)
+			}
+			return nil
+		},
+	)
+
+	// Load blocks 2 and 5 so that the rest are split into three runs.
+	buffer := make([]byte, 64)
+	_, err := cache.ReadAt(buffer, 2)
+	require.NoError(t, err)
+	_, err = cache.ReadAt(buffer, 5)
+	require.NoError(t, err)
+	fetchCalls = fetchCalls[:0]
+
+	expected := append([]byte{}, backingData...)
+	data, err := cache.Data()
+	require.NoError(t, err)
+	assert.Equal(t, expected, data)
+	require.Len(t, fetchCalls, 1)
+	assert.Len(t, fetchCalls[0], 3)
+	assert.EqualValues(t, 0, fetchCalls[0][0].Start)
+	assert.Len(t, fetchCalls[0][0].Data, 2*64)
+	assert.EqualValues(t, 6, fetchCalls[0][2].Start)
+	assert.Len(t, fetchCalls[0][2].Data, 10*64)
+
+	// Dirty blocks 1-2 and 9; flushing must write exactly those two runs.
+	newData := make([]byte, 128)
+	for i := range newData {
+		newData[i] = 0x5a
+	}
+	_, err = cache.WriteAt(newData, 1)
+	require.NoError(t, err)
+	_, err = cache.WriteAt(newData[:64], 9)
+	require.NoError(t, err)
+
+	require.NoError(t, cache.Flush())
+	require.Len(t, flushCalls, 1)
+	require.Len(t, flushCalls[0], 2)
+	assert.EqualValues(t, 1, flushCalls[0][0].Start)
+	assert.Len(t, flushCalls[0][0].Data, 128)
+	assert.EqualValues(t, 9, flushCalls[0][1].Start)
+	assert.Len(t, flushCalls[0][1].Data, 64)
+
+	copy(expected[64:], newData)
+	copy(expected[9*64:], newData[:64])
+	assert.Equal(t, expected, backingData)
+
+	// Nothing is dirty anymore, so flushing again mustn't write anything.
+	require.NoError(t, cache.Flush())
+	assert.Len(t, flushCalls, 1)
+}
+
+// Reading a block from a truncated image must fail instead of silently giving
+// back a block padded with zeroes.
+func TestWrapStream__TruncatedImage(t *testing.T) {
+	// The image claims to have 8 blocks but only has 5.5.
+	imageData := diskotest.CreateRandomImage(64, 8, t)[:5*64+32]
+	stream := bytesextra.NewReadWriteSeeker(imageData)
+	cache := blockcache.WrapStream(stream, 64, 8, false)
+
+	buffer := make([]byte, 64)
+	_, err := cache.ReadAt(buffer, 4)
+	require.NoError(t, err, "reading a block that's entirely present failed")
+	assert.Equal(t, imageData[4*64:5*64], buffer)
+
+	_, err = cache.ReadAt(buffer, 5)
+	assert.ErrorIs(t, err, disko.ErrIOFailed, "partial block was read")
+	assert.ErrorContains(t, err, "block 5")
+
+	_, err = cache.ReadAt(buffer, 7)
+	assert.ErrorIs(t, err, disko.ErrIOFailed, "missing block was read")
+	assert.ErrorContains(t, err, "block 7")
+}
+
+// shortWriter is an [io.ReadWriteSeeker] that only ever writes half of what
+// it's given.
+type shortWriter struct {
+	io.ReadWriteSeeker
+}
+
+func (writer shortWriter) Write(data []byte) (int, error) {
+	return writer.ReadWriteSeeker.Write(data[:len(data)/2])
+}
+
+func TestWrapStream__ShortWrite(t *testing.T) {
+	imageData := diskotest.CreateRandomImage(64, 4, t)
+	stream := shortWriter{bytesextra.NewReadWriteSeeker(imageData)}
+	cache := blockcache.WrapStream(stream, 64, 4, false)
+
+	_, err := cache.WriteAt(make([]byte, 64), 2)
+	require.NoError(t, err)
+
+	err = cache.Flush()
+	assert.ErrorIs(t, err, disko.ErrIOFailed)
+	assert.ErrorContains(t, err, "block 2")
+}
+
+// Blocks reported as holes must read as zeroes without being fetched, whether
+// blocks are fetched one at a time or in ranges.
+func TestBlockCache__Holes(t *testing.T) {
+	for _, batched := range []bool{false, true} {
+		t.Run(fmt.Sprintf("batched=%t", batched), func(t *testing.T) {
+			backingData := diskotest.CreateRandomImage(32, 8, t)
+			fetched := map[c.LogicalBlock]bool{}
+			cache := blockcache.New(
+				32,
+				8,
+				func(blockIndex c.LogicalBlock, buffer []byte) error {
+					fetched[blockIndex] = true
+					copy(buffer, backingData[blockIndex*32:])
+					return nil
+				},
+				nil,
+				nil,
+			)
+			if batched {
+				cache.SetRangeCallbacks(
+					func(ranges []disko.BlockRange) error {
+						for _, blockRange := range ranges {
+							blocks := uint(len(blockRange.Data)) / 32
+							for i := uint(0); i < blocks; i++ {
+								fetched[blockRange.Start+c.LogicalBlock(i)] = true
+							}
+							copy(blockRange.Data, backingData[blockRange.Start*32:])
+						}
+						return nil
+					},
+					nil,
+				)
+			}
+
+			// Blocks 2, 3, and 6 are holes.
+			cache.SetHoleCallback(func(blockIndex c.LogicalBlock) bool {
+				return blockIndex == 2 || blockIndex == 3 || blockIndex == 6
+			})
+
+			data, err := cache.Data()
+			require.NoError(t, err)
+
+			expected := append([]byte{}, backingData...)
+			for _, hole := range []int{2, 3, 6} {
+				copy(expected[hole*32:(hole+1)*32], make([]byte, 32))
+				assert.Falsef(t, fetched[c.LogicalBlock(hole)], "hole %d was fetched", hole)
+			}
+			assert.Equal(t, expected, data)
+			assert.Len(t, fetched, 5)
+		})
+	}
+}
+
+// Flushing a cache with no blocks, e.g. for a file truncated to nothing, does
+// nothing instead of failing the bounds check.
+func TestBlockCache__Flush__Empty(t *testing.T) {
+	fail := func(index c.LogicalBlock, buffer []byte) error {
+		t.Errorf("block %d accessed in an empty cache", index)
+		return nil
+	}
+	cache := blockcache.New(512, 0, fail, fail, nil)
+	assert.NoError(t, cache.Flush())
+	assert.NoError(t, cache.LoadAll())
+}
@@ -0,0 +1,42 @@
+package blockcache_test
+
+import (
+	"fmt"
+
+	"github.com/dargueta/disko/file_systems/common/blockcache"
+	"github.com/xaionaro-go/bytesextra"
+)
+
+func ExampleWrapStream() {
+	// Any io.ReadWriteSeeker works, such as an os.File for a disk image. Here
+	// we use four 16-byte blocks in memory.
+	image := make([]byte, 64)
+	stream := bytesextra.NewReadWriteSeeker(image)
+	cache := blockcache.WrapStream(stream, 16, 4, false)
+
+	// Writes only modify the cache until it's flushed.
+	_, err := cache.WriteAt([]byte("written to block 2"), 2)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("before flush: %q\n", image[32:50])
+
+	err = cache.Flush()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("after flush: %q\n", image[32:50])
+
+	// Reads can span blocks.
+	buffer := make([]byte, 18)
+	_, err = cache.ReadAt(buffer, 2)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("read back: %q\n", buffer)
+
+	// Output:
+	// before flush: "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"
+	// after flush: "written to block 2"
+	// read back: "written to block 2"
+}
@@ -0,0 +1,87 @@
+package blockcache
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/boljen/go-bitmap"
+	"github.com/dargueta/disko"
+	c "github.com/dargueta/disko/file_systems/common"
+)
+
+// MapMode determines how [MapFile] maps an image into memory.
+type MapMode int
+
+const (
+	// MapReadOnly maps the file read-only. The cache is frozen, so all attempts
+	// to modify it fail with [disko.ErrReadOnlyFileSystem]. Writing to a slice
+	// returned by the cache crashes the program.
+	MapReadOnly MapMode = iota
+	// MapCopyOnWrite maps the file privately. Changes are made to a private
+	// copy of the affected pages and are only written to the file when the
+	// cache is flushed.
+	MapCopyOnWrite
+)
+
+// MapFile creates a [BlockCache] whose storage is the contents of `file`
+// mapped directly into memory, instead of blocks copied into a slice. All
+// blocks are present from the start, so [BlockCache.LoadAll] and
+// [BlockCache.Data] cost nothing, and the operating system's page cache is the
+// only copy of unmodified data.
+//
+// The cache covers as many whole blocks as fit in the file; a partial block at
+// the end is ignored. Mapped caches can't be resized or spill to disk. Call
+// [BlockCache.Close] to unmap the file once the cache is no longer needed, and
+// don't use slices obtained from the cache after that.
+//
+// Mapping is only supported on Unix systems with 64-bit pointers, since images
+// can easily exceed the address space of 32-bit processes. Elsewhere, this
+// returns [disko.ErrNotSupported].
+func MapFile(file *os.File, bytesPerBlock uint, mode MapMode) (*BlockCache, error) {
+	if mode != MapReadOnly && mode != MapCopyOnWrite {
+		return nil, disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("invalid map mode: %d", mode))
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	totalBlocks := uint(info.Size()) / bytesPerBlock
+	data, unmap, err := mapFile(file, int(totalBlocks*bytesPerBlock), mode)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := &BlockCache{
+		loadedBlocks:  bitmap.NewSlice(int(totalBlocks)),
+		dirtyBlocks:   bitmap.NewSlice(int(totalBlocks)),
+		data:          data,
+		bytesPerBlock: bytesPerBlock,
+		totalBlocks:   totalBlocks,
+		unmap:         unmap,
+		fetch: func(blockIndex c.LogicalBlock, buffer []byte) error {
+			// Every block is present from the start, so this is never called.
+			return disko.ErrNotSupported.WithMessage("mapped caches don't fetch blocks")
+		},
+		flush: func(blockIndex c.LogicalBlock, buffer []byte) error {
+			_, err := file.WriteAt(buffer, int64(blockIndex)*int64(bytesPerBlock))
+			return err
+		},
+		resize: func(newTotalBlocks c.LogicalBlock) error {
+			return disko.ErrNotSupported.WithMessage("mapped caches can't be resized")
+		},
+	}
+
+	for i := 0; i < int(totalBlocks); i++ {
+		cache.loadedBlocks.Set(i, true)
+	}
+	cache.frozen = mode == MapReadOnly
+	return cache, nil
+}
+
+// IsMapped returns true if the cache was created with [MapFile].
+func (cache *BlockCache) IsMapped() bool {
+	return cache.unmap != nil
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package blockcache
+
+import (
+	"os"
+
+	"github.com/dargueta/disko"
+)
+
+func mapFile(file *os.File, length int, mode MapMode) ([]byte, func() error, error) {
+	return nil, nil, disko.ErrNotSupported.WithMessage(
+		"mapping files is only supported on Unix systems")
+}
@@ -0,0 +1,113 @@
+//go:build unix
+
+package blockcache_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	disko "github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/common/blockcache"
+	diskotest "github.com/dargueta/disko/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createImageFile writes `data` to a new file and opens it with `flag`.
+func createImageFile(data []byte, flag int, t *testing.T) *os.File {
+	path := filepath.Join(t.TempDir(), "image.bin")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	file, err := os.OpenFile(path, flag, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { file.Close() })
+	return file
+}
+
+func skipIfNot64Bit(t *testing.T) {
+	if strconv.IntSize != 64 {
+		t.Skip("mapping files requires a 64-bit host")
+	}
+}
+
+func TestMapFile__ReadOnly(t *testing.T) {
+	skipIfNot64Bit(t)
+
+	backingData := diskotest.CreateRandomImage(512, 16, t)
+	// Add a partial block at the end, which must be ignored.
+	file := createImageFile(append(backingData, 1, 2, 3), os.O_RDONLY, t)
+
+	cache, err := blockcache.MapFile(file, 512, blockcache.MapReadOnly)
+	require.NoError(t, err)
+	defer cache.Close()
+
+	assert.True(t, cache.IsMapped())
+	assert.True(t, cache.IsFrozen())
+	assert.EqualValues(t, 16, cache.TotalBlocks())
+
+	data, err := cache.Data()
+	require.NoError(t, err)
+	assert.Equal(t, backingData, data)
+
+	_, err = cache.WriteAt([]byte{0}, 0)
+	assert.ErrorIs(t, err, disko.ErrReadOnlyFileSystem)
+	assert.ErrorIs(t, cache.Resize(8), disko.ErrReadOnlyFileSystem)
+}
+
+// Changes to a copy-on-write mapping mustn't reach the file until the cache is
+// flushed.
+func TestMapFile__CopyOnWrite(t *testing.T) {
+	skipIfNot64Bit(t)
+
+	backingData := diskotest.CreateRandomImage(512, 16, t)
+	file := createImageFile(backingData, os.O_RDWR, t)
+
+	cache, err := blockcache.MapFile(file, 512, blockcache.MapCopyOnWrite)
+	require.NoError(t, err)
+	defer cache.Close()
+	assert.False(t, cache.IsFrozen())
+
+	newData := make([]byte, 600)
+	for i := range newData {
+		newData[i] = 0xa5
+	}
+	_, err = cache.WriteAt(newData, 3)
+	require.NoError(t, err)
+
+	contents, err := os.ReadFile(file.Name())
+	require.NoError(t, err)
+	assert.Equal(t, backingData, contents, "file was modified before flushing")
+
+	require.NoError(t, cache.Flush())
+	copy(backingData[3*512:], newData)
+	contents, err = os.ReadFile(file.Name())
+	require.NoError(t, err)
+	assert.Equal(t, backingData, contents, "file wasn't updated by flushing")
+}
+
+func TestMapFile__CantResizeOrSpill(t *testing.T) {
+	skipIfNot64Bit(t)
+
+	file := createImageFile(diskotest.CreateRandomImage(512, 4, t), os.O_RDWR, t)
+	cache, err := blockcache.MapFile(file, 512, blockcache.MapCopyOnWrite)
+	require.NoError(t, err)
+	defer cache.Close()
+
+	assert.ErrorIs(t, cache.Resize(8), disko.ErrNotSupported)
+	assert.EqualValues(t, 4, cache.TotalBlocks())
+
+	err = cache.EnableSpilling(blockcache.SpillOptions{MemoryBudget: 512})
+	assert.ErrorIs(t, err, disko.ErrNotSupported)
+}
+
+func TestMapFile__EmptyFile(t *testing.T) {
+	skipIfNot64Bit(t)
+
+	file := createImageFile(nil, os.O_RDONLY, t)
+	cache, err := blockcache.MapFile(file, 512, blockcache.MapReadOnly)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, cache.TotalBlocks())
+	assert.NoError(t, cache.Close())
+}
@@ -0,0 +1,36 @@
+//go:build unix
+
+package blockcache
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/dargueta/disko"
+)
+
+func mapFile(file *os.File, length int, mode MapMode) ([]byte, func() error, error) {
+	if strconv.IntSize != 64 {
+		return nil, nil, disko.ErrNotSupported.WithMessage(
+			"mapping files is only supported on 64-bit hosts")
+	}
+
+	if length == 0 {
+		// mmap() fails for empty mappings, but there's nothing to map anyway.
+		return []byte{}, func() error { return nil }, nil
+	}
+
+	protection := syscall.PROT_READ
+	flags := syscall.MAP_SHARED
+	if mode == MapCopyOnWrite {
+		protection |= syscall.PROT_WRITE
+		flags = syscall.MAP_PRIVATE
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, length, protection, flags)
+	if err != nil {
+		return nil, nil, disko.ErrIOFailed.Wrap(os.NewSyscallError("mmap", err))
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,266 @@
+package blockcache
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+
+	"github.com/dargueta/disko"
+	c "github.com/dargueta/disko/file_systems/common"
+)
+
+// SpillOptions configures a [BlockCache] to keep a bounded number of blocks in
+// memory. See [BlockCache.EnableSpilling].
+type SpillOptions struct {
+	// MemoryBudget is the maximum number of bytes of block data kept in memory.
+	// It's rounded up to a whole number of blocks, and is at least one block.
+	MemoryBudget uint
+
+	// TempDir is the directory the spill file is created in. If empty, the
+	// default directory for temporary files is used.
+	TempDir string
+}
+
+// spillStore holds the blocks of a cache that spills to disk. A block is in
+// exactly one of these states:
+//
+//   - Not loaded: the loaded bit is clear. Reading it fetches it from storage.
+//   - Resident: it's in `resident`, and may be clean or dirty.
+//   - Spilled: it's dirty and was evicted, so its data is in the spill file at
+//     `spilled[block]`.
+//   - Zeroed: the loaded bit is set but it's neither resident nor spilled. This
+//     is only the case for blocks added by [BlockCache.Resize] that haven't
+//     been touched yet.
+//
+// Clean blocks are evicted by forgetting them, since they can be fetched again.
+type spillStore struct {
+	maxResident uint
+	tempDir     string
+	resident    map[uint]*list.Element
+	// lru orders resident blocks from most to least recently used. Each
+	// element's value is a *residentBlock.
+	lru     *list.List
+	file    *os.File
+	spilled map[uint]int64
+	// freeSlots are offsets in the spill file that are no longer used.
+	freeSlots []int64
+	fileSize  int64
+}
+
+type residentBlock struct {
+	index uint
+	data  []byte
+}
+
+// EnableSpilling limits the memory the cache uses to hold block data. Once the
+// budget in `options` is reached, the least recently used blocks are evicted:
+// clean blocks are dropped and fetched again if needed, and dirty blocks are
+// written to a temporary file and read back from there. This allows editing
+// images larger than the available memory.
+//
+// Spilling changes how the cache's slices behave. [BlockCache.GetSlice] and
+// [BlockCache.Data] return copies of the data, so changes must be written back
+// with [BlockCache.WriteAt] instead of being made in place. Data copies the
+// entire cache, so it should be avoided for large caches. A cache that spills
+// can't be frozen.
+//
+// Call [BlockCache.Close] once the cache is no longer needed to delete the
+// temporary file.
+func (cache *BlockCache) EnableSpilling(options SpillOptions) error {
+	if cache.frozen {
+		return disko.ErrReadOnlyFileSystem.WithMessage("cache is frozen")
+	} else if cache.spill != nil {
+		return disko.ErrAlreadyInProgress.WithMessage("cache already spills to disk")
+	} else if cache.unmap != nil {
+		return disko.ErrNotSupported.WithMessage("a mapped cache can't spill to disk")
+	}
+
+	maxResident := (options.MemoryBudget + cache.bytesPerBlock - 1) / cache.bytesPerBlock
+	if maxResident == 0 {
+		maxResident = 1
+	}
+
+	data := cache.data
+	cache.data = nil
+	cache.spill = &spillStore{
+		maxResident: maxResident,
+		tempDir:     options.TempDir,
+		resident:    map[uint]*list.Element{},
+		lru:         list.New(),
+		spilled:     map[uint]int64{},
+	}
+
+	// Move the blocks that are already loaded over to the spill store.
+	for i := uint(0); i < cache.totalBlocks; i++ {
+		if !cache.loadedBlocks.Get(int(i)) {
+			continue
+		}
+
+		block := make([]byte, cache.bytesPerBlock)
+		copy(block, data[i*cache.bytesPerBlock:])
+		err := cache.addResidentBlock(i, block)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsSpilling returns true if [BlockCache.EnableSpilling] has been called on this
+// cache.
+func (cache *BlockCache) IsSpilling() bool {
+	return cache.spill != nil
+}
+
+// closeSpillFile deletes the temporary file used by a cache that spills to
+// disk, if there is one.
+func (cache *BlockCache) closeSpillFile() error {
+	if cache.spill == nil || cache.spill.file == nil {
+		return nil
+	}
+
+	file := cache.spill.file
+	cache.spill.file = nil
+	closeErr := file.Close()
+	removeErr := os.Remove(file.Name())
+	if closeErr != nil {
+		return closeErr
+	}
+	return removeErr
+}
+
+// spilledBlockBuffer returns the buffer holding a block's data, loading it from
+// storage or the spill file if needed. The buffer remains valid only until the
+// next block is loaded, since loading may evict it.
+func (cache *BlockCache) spilledBlockBuffer(index uint) ([]byte, error) {
+	store := cache.spill
+	if element, ok := store.resident[index]; ok {
+		store.lru.MoveToFront(element)
+		return element.Value.(*residentBlock).data, nil
+	}
+
+	block := make([]byte, cache.bytesPerBlock)
+	if offset, ok := store.spilled[index]; ok {
+		_, err := store.file.ReadAt(block, offset)
+		if err != nil {
+			return nil, disko.ErrIOFailed.Wrap(
+				fmt.Errorf("failed to read spilled block %d: %w", index, err))
+		}
+		delete(store.spilled, index)
+		store.freeSlots = append(store.freeSlots, offset)
+	} else if !cache.loadedBlocks.Get(int(index)) {
+		err := cache.fetchBlock(c.LogicalBlock(index), block)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load block %d from source: %w", index, err)
+		}
+		cache.loadedBlocks.Set(int(index), true)
+		cache.dirtyBlocks.Set(int(index), false)
+	}
+	// Else it's a zeroed block, and `block` is already all zeroes.
+
+	err := cache.addResidentBlock(index, block)
+	if err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// addResidentBlock puts a block in memory, evicting the least recently used
+// blocks if the memory budget is exceeded.
+func (cache *BlockCache) addResidentBlock(index uint, data []byte) error {
+	store := cache.spill
+	store.resident[index] = store.lru.PushFront(&residentBlock{index: index, data: data})
+
+	for uint(store.lru.Len()) > store.maxResident {
+		oldest := store.lru.Back()
+		block := oldest.Value.(*residentBlock)
+
+		if cache.dirtyBlocks.Get(int(block.index)) {
+			err := cache.writeSpilledBlock(block.index, block.data)
+			if err != nil {
+				return err
+			}
+		} else {
+			cache.loadedBlocks.Set(int(block.index), false)
+		}
+
+		store.lru.Remove(oldest)
+		delete(store.resident, block.index)
+	}
+	return nil
+}
+
+// writeSpilledBlock writes a block to the spill file, creating it if needed.
+func (cache *BlockCache) writeSpilledBlock(index uint, data []byte) error {
+	store := cache.spill
+	if store.file == nil {
+		file, err := os.CreateTemp(store.tempDir, "disko-blockcache-*")
+		if err != nil {
+			return disko.ErrIOFailed.Wrap(err)
+		}
+		store.file = file
+	}
+
+	var offset int64
+	if count := len(store.freeSlots); count > 0 {
+		offset = store.freeSlots[count-1]
+		store.freeSlots = store.freeSlots[:count-1]
+	} else {
+		offset = store.fileSize
+		store.fileSize += int64(cache.bytesPerBlock)
+	}
+
+	_, err := store.file.WriteAt(data, offset)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(
+			fmt.Errorf("failed to spill block %d: %w", index, err))
+	}
+	store.spilled[index] = offset
+	return nil
+}
+
+// spilledCopy returns a copy of the data in blocks [start, start + count).
+func (cache *BlockCache) spilledCopy(start c.LogicalBlock, count uint) ([]byte, error) {
+	result := make([]byte, count*cache.bytesPerBlock)
+	for i := uint(0); i < count; i++ {
+		block, err := cache.spilledBlockBuffer(uint(start) + i)
+		if err != nil {
+			return nil, err
+		}
+		copy(result[i*cache.bytesPerBlock:], block)
+	}
+	return result, nil
+}
+
+// spilledWrite copies `buffer` into the blocks beginning at `start` and marks
+// them dirty.
+func (cache *BlockCache) spilledWrite(buffer []byte, start c.LogicalBlock) error {
+	for offset := uint(0); offset < uint(len(buffer)); offset += cache.bytesPerBlock {
+		index := uint(start) + offset/cache.bytesPerBlock
+		block, err := cache.spilledBlockBuffer(index)
+		if err != nil {
+			return err
+		}
+		copy(block, buffer[offset:])
+		cache.dirtyBlocks.Set(int(index), true)
+	}
+	return nil
+}
+
+// spilledResize drops the blocks past the end of the new size. New blocks are
+// zeroed and dirty, like for caches that don't spill.
+func (cache *BlockCache) spilledResize(newTotalBlocks uint) {
+	store := cache.spill
+	for index, element := range store.resident {
+		if index >= newTotalBlocks {
+			store.lru.Remove(element)
+			delete(store.resident, index)
+		}
+	}
+	for index, offset := range store.spilled {
+		if index >= newTotalBlocks {
+			delete(store.spilled, index)
+			store.freeSlots = append(store.freeSlots, offset)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package blockcache_test
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"testing"
+
+	disko "github.com/dargueta/disko"
+	c "github.com/dargueta/disko/file_systems/common"
+	"github.com/dargueta/disko/file_systems/common/blockcache"
+	diskotest "github.com/dargueta/disko/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Random writes across far more blocks than fit in memory must all make it to
+// storage, with evicted dirty blocks going through the spill file.
+func TestBlockCache__Spill__RandomWrites(t *testing.T) {
+	backingData := diskotest.CreateRandomImage(128, 64, t)
+	expected := bytes.Clone(backingData)
+	cache := diskotest.CreateDefaultCache(128, 64, true, backingData, t)
+
+	tempDir := t.TempDir()
+	err := cache.EnableSpilling(
+		blockcache.SpillOptions{MemoryBudget: 4 * 128, TempDir: tempDir})
+	require.NoError(t, err)
+	assert.True(t, cache.IsSpilling())
+
+	rng := rand.New(rand.NewSource(1234))
+	for i := 0; i < 500; i++ {
+		block := rng.Intn(63)
+		data := make([]byte, 200)
+		rng.Read(data)
+
+		_, err := cache.WriteAt(data, c.LogicalBlock(block))
+		require.NoErrorf(t, err, "write %d to block %d failed", i, block)
+		copy(expected[block*128:], data)
+	}
+
+	// Evicted blocks were dirty, so they must have been spilled.
+	entries, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "expected a spill file")
+
+	readBack := make([]byte, 64*128)
+	_, err = cache.ReadAt(readBack, 0)
+	require.NoError(t, err)
+	assert.Equal(t, expected, readBack, "cache contents are wrong before flushing")
+
+	require.NoError(t, cache.Flush())
+	assert.Equal(t, expected, backingData, "storage is wrong after flushing")
+
+	require.NoError(t, cache.Close())
+	entries, err = os.ReadDir(tempDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "spill file wasn't deleted")
+}
+
+// Clean blocks are dropped when evicted and fetched again when needed.
+func TestBlockCache__Spill__CleanBlocksRefetched(t *testing.T) {
+	backingData := diskotest.CreateRandomImage(64, 16, t)
+	fetches := 0
+	cache := blockcache.New(
+		64,
+		16,
+		func(index c.LogicalBlock, buffer []byte) error {
+			fetches++
+			copy(buffer, backingData[index*64:])
+			return nil
+		},
+		func(index c.LogicalBlock, buffer []byte) error {
+			t.Errorf("block %d flushed but nothing was written", index)
+			return nil
+		},
+		nil,
+	)
+
+	tempDir := t.TempDir()
+	err := cache.EnableSpilling(blockcache.SpillOptions{MemoryBudget: 2 * 64, TempDir: tempDir})
+	require.NoError(t, err)
+
+	data, err := cache.Data()
+	require.NoError(t, err)
+	assert.Equal(t, backingData, data)
+	assert.Equal(t, 16, fetches)
+
+	// The last two blocks are still in memory, the first ones must be fetched
+	// again.
+	buffer := make([]byte, 64)
+	_, err = cache.ReadAt(buffer, 15)
+	require.NoError(t, err)
+	assert.Equal(t, 16, fetches)
+
+	_, err = cache.ReadAt(buffer, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 17, fetches)
+	assert.Equal(t, backingData[:64], buffer)
+
+	require.NoError(t, cache.Flush())
+	entries, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "nothing should have been spilled")
+}
+
+// Blocks loaded before spilling is enabled keep their modifications.
+func TestBlockCache__Spill__EnableWithDirtyBlocks(t *testing.T) {
+	backingData := diskotest.CreateRandomImage(32, 8, t)
+	cache := diskotest.CreateDefaultCache(32, 8, true, backingData, t)
+
+	data := bytes.Repeat([]byte{0xAA}, 8*32)
+	_, err := cache.WriteAt(data, 0)
+	require.NoError(t, err)
+
+	err = cache.EnableSpilling(blockcache.SpillOptions{MemoryBudget: 1, TempDir: t.TempDir()})
+	require.NoError(t, err)
+	defer cache.Close()
+
+	require.NoError(t, cache.Flush())
+	assert.Equal(t, data, backingData)
+}
+
+func TestBlockCache__Spill__ResizeAddsZeroedBlocks(t *testing.T) {
+	storage := make([]byte, 4*16)
+	for i := range storage {
+		storage[i] = 0xFF
+	}
+
+	cache := blockcache.New(
+		16,
+		4,
+		func(index c.LogicalBlock, buffer []byte) error {
+			copy(buffer, storage[index*16:])
+			return nil
+		},
+		func(index c.LogicalBlock, buffer []byte) error {
+			copy(storage[index*16:], buffer)
+			return nil
+		},
+		func(newTotalBlocks c.LogicalBlock) error {
+			newStorage := make([]byte, newTotalBlocks*16)
+			copy(newStorage, storage)
+			storage = newStorage
+			return nil
+		},
+	)
+	err := cache.EnableSpilling(blockcache.SpillOptions{MemoryBudget: 16, TempDir: t.TempDir()})
+	require.NoError(t, err)
+	defer cache.Close()
+
+	require.NoError(t, cache.Resize(8))
+	data, err := cache.Data()
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte{0xFF}, 4*16), data[:4*16])
+	assert.Equal(t, make([]byte, 4*16), data[4*16:])
+
+	require.NoError(t, cache.Resize(2))
+	assert.EqualValues(t, 2, cache.TotalBlocks())
+	require.NoError(t, cache.Flush())
+}
+
+func TestBlockCache__Spill__CantFreeze(t *testing.T) {
+	cache := diskotest.CreateDefaultCache(32, 8, false, nil, t)
+	require.NoError(t, cache.EnableSpilling(blockcache.SpillOptions{MemoryBudget: 64}))
+	assert.ErrorIs(t, cache.Freeze(), disko.ErrNotSupported)
+}
@@ -0,0 +1,130 @@
+package blockcache
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dargueta/disko"
+	c "github.com/dargueta/disko/file_systems/common"
+)
+
+// TailPolicy determines how a cache created by [WrapStreamWithTailPolicy]
+// handles a stream whose size isn't a multiple of the block size.
+type TailPolicy int
+
+const (
+	// TailIgnore rounds the size of the stream down to a whole number of
+	// blocks, so the bytes in a trailing partial block can't be accessed. This
+	// is what [WrapStreamWithInferredSize] does.
+	TailIgnore TailPolicy = iota
+	// TailStrict includes the partial block in the cache, but reading or
+	// writing it fails with [disko.ErrIOFailed].
+	TailStrict
+	// TailPad includes the partial block in the cache, with the missing bytes
+	// read as zeroes. Only the bytes that exist in the stream are written, so
+	// the stream never grows.
+	TailPad
+	// TailExtendOnWrite is like [TailPad] when reading, but writing the
+	// partial block writes all of it, growing the stream to a whole number of
+	// blocks.
+	TailExtendOnWrite
+)
+
+// WrapStreamWithTailPolicy creates a [BlockCache] that wraps the entirety of
+// `stream`, using `policy` to decide what to do with a trailing partial block.
+// `allowResize` behaves the same as for [WrapStream].
+func WrapStreamWithTailPolicy(
+	stream io.ReadWriteSeeker,
+	bytesPerBlock uint,
+	allowResize bool,
+	policy TailPolicy,
+) (*BlockCache, error) {
+	if policy < TailIgnore || policy > TailExtendOnWrite {
+		return nil, disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("invalid tail policy: %d", policy))
+	}
+
+	streamSize, err := stream.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	totalBlocks := uint(streamSize) / bytesPerBlock
+	if policy == TailIgnore {
+		return WrapStream(stream, bytesPerBlock, totalBlocks, allowResize), nil
+	} else if uint(streamSize)%bytesPerBlock != 0 {
+		totalBlocks++
+	}
+
+	// runCb reads or writes a block, handling the case where it extends past
+	// the end of the stream according to `policy`. The size of the stream and
+	// the number of blocks are kept up to date as the stream grows or shrinks.
+	runCb := func(block c.LogicalBlock, buffer []byte, read bool) error {
+		err := seekToBlock(stream, block, c.LogicalBlock(totalBlocks), bytesPerBlock)
+		if err != nil {
+			return err
+		}
+
+		blockOffset := int64(block) * int64(bytesPerBlock)
+		available := streamSize - blockOffset
+		if available < 0 {
+			available = 0
+		}
+		if available >= int64(len(buffer)) {
+			return transferBlock(stream, block, buffer, read)
+		}
+
+		if policy == TailStrict {
+			return disko.ErrIOFailed.WithMessage(
+				fmt.Sprintf(
+					"block %d extends past the end of the image: only %d of %d bytes exist",
+					block,
+					available,
+					len(buffer),
+				),
+			)
+		} else if read {
+			for i := available; i < int64(len(buffer)); i++ {
+				buffer[i] = 0
+			}
+			return transferBlock(stream, block, buffer[:available], true)
+		} else if policy == TailPad {
+			return transferBlock(stream, block, buffer[:available], false)
+		}
+
+		err = transferBlock(stream, block, buffer, false)
+		if err != nil {
+			return err
+		}
+		streamSize = blockOffset + int64(len(buffer))
+		return nil
+	}
+
+	fetchCb := func(block c.LogicalBlock, buffer []byte) error {
+		return runCb(block, buffer, true)
+	}
+
+	flushCb := func(block c.LogicalBlock, buffer []byte) error {
+		return runCb(block, buffer, false)
+	}
+
+	truncator, streamHasTruncate := stream.(c.Truncator)
+	resizeCb := func(newTotalBlocks c.LogicalBlock) error {
+		if !allowResize {
+			return disko.ErrNotPermitted
+		} else if !streamHasTruncate {
+			return disko.ErrNotSupported
+		}
+
+		newSize := int64(newTotalBlocks) * int64(bytesPerBlock)
+		err := truncator.Truncate(newSize)
+		if err != nil {
+			return err
+		}
+		streamSize = newSize
+		totalBlocks = uint(newTotalBlocks)
+		return nil
+	}
+
+	return New(bytesPerBlock, totalBlocks, fetchCb, flushCb, resizeCb), nil
+}
@@ -0,0 +1,108 @@
+package blockcache_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	disko "github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/common/blockcache"
+	diskotest "github.com/dargueta/disko/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createTailImage creates a file with 3.5 blocks of 64 bytes of random data,
+// and returns the file and its original contents.
+func createTailImage(t *testing.T) (*os.File, []byte) {
+	data := diskotest.CreateRandomImage(32, 7, t)
+	path := filepath.Join(t.TempDir(), "image.bin")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { file.Close() })
+	return file, data
+}
+
+func TestWrapStreamWithTailPolicy__Ignore(t *testing.T) {
+	file, _ := createTailImage(t)
+	cache, err := blockcache.WrapStreamWithTailPolicy(file, 64, false, blockcache.TailIgnore)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, cache.TotalBlocks())
+}
+
+func TestWrapStreamWithTailPolicy__Strict(t *testing.T) {
+	file, data := createTailImage(t)
+	cache, err := blockcache.WrapStreamWithTailPolicy(file, 64, false, blockcache.TailStrict)
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, cache.TotalBlocks())
+
+	buffer := make([]byte, 64)
+	_, err = cache.ReadAt(buffer, 2)
+	require.NoError(t, err)
+	assert.Equal(t, data[128:192], buffer)
+
+	_, err = cache.ReadAt(buffer, 3)
+	assert.ErrorIs(t, err, disko.ErrIOFailed)
+	assert.ErrorContains(t, err, "block 3")
+}
+
+func TestWrapStreamWithTailPolicy__Pad(t *testing.T) {
+	file, data := createTailImage(t)
+	cache, err := blockcache.WrapStreamWithTailPolicy(file, 64, false, blockcache.TailPad)
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, cache.TotalBlocks())
+
+	buffer := make([]byte, 64)
+	_, err = cache.ReadAt(buffer, 3)
+	require.NoError(t, err)
+	assert.Equal(t, data[192:], buffer[:32])
+	assert.Equal(t, make([]byte, 32), buffer[32:])
+
+	// Only the half of the block that exists may be written.
+	for i := range buffer {
+		buffer[i] = 0xcc
+	}
+	_, err = cache.WriteAt(buffer, 3)
+	require.NoError(t, err)
+	require.NoError(t, cache.Flush())
+
+	contents, err := os.ReadFile(file.Name())
+	require.NoError(t, err)
+	assert.Equal(t, data[:192], contents[:192])
+	assert.Equal(t, buffer[:32], contents[192:])
+}
+
+func TestWrapStreamWithTailPolicy__ExtendOnWrite(t *testing.T) {
+	file, data := createTailImage(t)
+	cache, err := blockcache.WrapStreamWithTailPolicy(
+		file, 64, false, blockcache.TailExtendOnWrite)
+	require.NoError(t, err)
+
+	buffer := make([]byte, 64)
+	_, err = cache.ReadAt(buffer, 3)
+	require.NoError(t, err)
+	assert.Equal(t, data[192:], buffer[:32])
+	assert.Equal(t, make([]byte, 32), buffer[32:])
+
+	// Writing the partial block must extend the image to the full block.
+	for i := range buffer {
+		buffer[i] = 0xcc
+	}
+	_, err = cache.WriteAt(buffer, 3)
+	require.NoError(t, err)
+	require.NoError(t, cache.Flush())
+
+	contents, err := os.ReadFile(file.Name())
+	require.NoError(t, err)
+	require.Len(t, contents, 256)
+	assert.Equal(t, data[:192], contents[:192])
+	assert.Equal(t, buffer, contents[192:])
+}
+
+func TestWrapStreamWithTailPolicy__InvalidPolicy(t *testing.T) {
+	file, _ := createTailImage(t)
+	_, err := blockcache.WrapStreamWithTailPolicy(file, 64, false, blockcache.TailPolicy(99))
+	assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+}
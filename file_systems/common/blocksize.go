@@ -0,0 +1,165 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+)
+
+// blockSizeAdapter is a [DiskImage] that presents another image with a
+// different block size. See [NewBlockSizeAdapter].
+type blockSizeAdapter struct {
+	image         DiskImage
+	bytesPerBlock uint
+	totalBlocks   uint
+}
+
+// NewBlockSizeAdapter returns a [DiskImage] with blocks of `bytesPerBlock`
+// bytes, on top of an image that uses a different block size. This is needed
+// when the file system's logical block size doesn't match the block size of
+// the container it's stored in, such as 128-byte sectors inside an image with
+// 512-byte sectors.
+//
+// The new block size doesn't have to evenly divide the old one or vice versa.
+// If the size of the image isn't a multiple of the new block size, the partial
+// block at the end can't be accessed.
+func NewBlockSizeAdapter(image DiskImage, bytesPerBlock uint) (DiskImage, error) {
+	if bytesPerBlock == 0 {
+		return nil, errors.New("block size must be nonzero")
+	}
+	return &blockSizeAdapter{
+		image:         image,
+		bytesPerBlock: bytesPerBlock,
+		totalBlocks:   uint(image.Size() / int64(bytesPerBlock)),
+	}, nil
+}
+
+func (adapter *blockSizeAdapter) BytesPerBlock() uint {
+	return adapter.bytesPerBlock
+}
+
+func (adapter *blockSizeAdapter) TotalBlocks() uint {
+	return adapter.totalBlocks
+}
+
+func (adapter *blockSizeAdapter) Size() int64 {
+	return int64(adapter.totalBlocks) * int64(adapter.bytesPerBlock)
+}
+
+func (adapter *blockSizeAdapter) GetMinBlocksForSize(size uint) uint {
+	return (size + adapter.bytesPerBlock - 1) / adapter.bytesPerBlock
+}
+
+func (adapter *blockSizeAdapter) ReadAt(buffer []byte, start LogicalBlock) (int, error) {
+	offset, err := adapter.byteOffset(start, uint(len(buffer)))
+	if err != nil {
+		return 0, err
+	}
+	return readImageBytes(adapter.image, buffer, offset)
+}
+
+// byteOffset returns the offset in the underlying image of block `start`, or an
+// error if `size` bytes starting there aren't entirely within the image.
+func (adapter *blockSizeAdapter) byteOffset(start LogicalBlock, size uint) (int64, error) {
+	end := uint64(start) + uint64(adapter.GetMinBlocksForSize(size))
+	if end > uint64(adapter.totalBlocks) {
+		return 0, fmt.Errorf(
+			"can't access %d bytes starting at block %d: range not in [0, %d)",
+			size,
+			start,
+			adapter.totalBlocks,
+		)
+	}
+	return int64(start) * int64(adapter.bytesPerBlock), nil
+}
+
+// containerBlocks returns the range of blocks of the underlying image that
+// `length` blocks starting at block `start` overlap. If `whole` is true, only
+// underlying blocks entirely covered by the range are included.
+func (adapter *blockSizeAdapter) containerBlocks(
+	start LogicalBlock,
+	length uint,
+	whole bool,
+) (LogicalBlock, uint, error) {
+	offset, err := adapter.byteOffset(start, length*adapter.bytesPerBlock)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	containerBlockSize := int64(adapter.image.BytesPerBlock())
+	end := offset + int64(length)*int64(adapter.bytesPerBlock)
+	first := offset / containerBlockSize
+	last := (end + containerBlockSize - 1) / containerBlockSize
+	if whole {
+		first = (offset + containerBlockSize - 1) / containerBlockSize
+		last = end / containerBlockSize
+	}
+
+	if last <= first {
+		return LogicalBlock(first), 0, nil
+	}
+	return LogicalBlock(first), uint(last - first), nil
+}
+
+// writableBlockSizeAdapter is a [WritableDiskImage] that presents another image
+// with a different block size. See [NewWritableBlockSizeAdapter].
+type writableBlockSizeAdapter struct {
+	blockSizeAdapter
+	writer WritableDiskImage
+}
+
+// NewWritableBlockSizeAdapter is the same as [NewBlockSizeAdapter], except that
+// the returned image can be written to. Writes that only cover part of a block
+// of the underlying image read that block first, so that the rest of it is
+// preserved.
+func NewWritableBlockSizeAdapter(
+	image WritableDiskImage,
+	bytesPerBlock uint,
+) (WritableDiskImage, error) {
+	adapter, err := NewBlockSizeAdapter(image, bytesPerBlock)
+	if err != nil {
+		return nil, err
+	}
+	return &writableBlockSizeAdapter{
+		blockSizeAdapter: *adapter.(*blockSizeAdapter),
+		writer:           image,
+	}, nil
+}
+
+func (adapter *writableBlockSizeAdapter) WriteAt(buffer []byte, start LogicalBlock) (int, error) {
+	offset, err := adapter.byteOffset(start, uint(len(buffer)))
+	if err != nil {
+		return 0, err
+	}
+	return ImageReadWriterAt{Image: adapter.writer}.WriteAt(buffer, offset)
+}
+
+func (adapter *writableBlockSizeAdapter) Flush() error {
+	return adapter.writer.Flush()
+}
+
+// MarkBlockRangeDirty marks every block of the underlying image that the range
+// overlaps as dirty.
+func (adapter *writableBlockSizeAdapter) MarkBlockRangeDirty(
+	start LogicalBlock,
+	length uint,
+) error {
+	first, count, err := adapter.containerBlocks(start, length, false)
+	if err != nil || count == 0 {
+		return err
+	}
+	return adapter.writer.MarkBlockRangeDirty(first, count)
+}
+
+// MarkBlockRangeClean marks the blocks of the underlying image that are
+// entirely within the range as clean. Blocks only partly covered by the range
+// are left alone, since the rest of them may still need to be flushed.
+func (adapter *writableBlockSizeAdapter) MarkBlockRangeClean(
+	start LogicalBlock,
+	length uint,
+) error {
+	first, count, err := adapter.containerBlocks(start, length, true)
+	if err != nil || count == 0 {
+		return err
+	}
+	return adapter.writer.MarkBlockRangeClean(first, count)
+}
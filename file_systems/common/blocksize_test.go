@@ -0,0 +1,62 @@
+package common_test
+
+import (
+	"testing"
+
+	c "github.com/dargueta/disko/file_systems/common"
+	diskotest "github.com/dargueta/disko/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 128-byte blocks inside an image with 512-byte blocks.
+func TestBlockSizeAdapter__SmallerBlocks(t *testing.T) {
+	backingData := diskotest.CreateRandomImage(512, 4, t)
+	cache := diskotest.CreateDefaultCache(512, 4, true, backingData, t)
+	expected := append([]byte{}, backingData...)
+
+	adapter, err := c.NewWritableBlockSizeAdapter(cache, 128)
+	require.NoError(t, err)
+	assert.EqualValues(t, 128, adapter.BytesPerBlock())
+	assert.EqualValues(t, 16, adapter.TotalBlocks())
+	assert.EqualValues(t, 2048, adapter.Size())
+
+	buffer := make([]byte, 256)
+	_, err = adapter.ReadAt(buffer, 3)
+	require.NoError(t, err)
+	assert.Equal(t, backingData[384:640], buffer)
+
+	// Write a single small block in the middle of a large one. The rest of the
+	// large block must be preserved.
+	data := make([]byte, 128)
+	for i := range data {
+		data[i] = 0x77
+	}
+	_, err = adapter.WriteAt(data, 5)
+	require.NoError(t, err)
+	require.NoError(t, adapter.Flush())
+	copy(expected[640:], data)
+	assert.Equal(t, expected, backingData)
+
+	_, err = adapter.ReadAt(buffer, 15)
+	assert.Error(t, err, "reading past the end of the image should've failed")
+}
+
+// 1024-byte blocks inside an image with 512-byte blocks, with a leftover
+// 512-byte block at the end that can't be accessed.
+func TestBlockSizeAdapter__LargerBlocks(t *testing.T) {
+	backingData := diskotest.CreateRandomImage(512, 5, t)
+	cache := diskotest.CreateDefaultCache(512, 5, false, backingData, t)
+
+	adapter, err := c.NewBlockSizeAdapter(cache, 1024)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, adapter.TotalBlocks())
+
+	buffer := make([]byte, 1024)
+	_, err = adapter.ReadAt(buffer, 1)
+	require.NoError(t, err)
+	assert.Equal(t, backingData[1024:2048], buffer)
+
+	_, err = adapter.ReadAt(buffer, 2)
+	assert.Error(t, err, "partial block at the end of the image was read")
+}
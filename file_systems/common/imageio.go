@@ -0,0 +1,234 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ImageReaderAt adapts a [DiskImage] to [io.ReaderAt], so that it can be read
+// at arbitrary byte offsets instead of whole blocks. Use [NewSectionReader] to
+// get an [io.ReadSeeker] over a region of the image.
+type ImageReaderAt struct {
+	Image DiskImage
+}
+
+// ReadAt implements [io.ReaderAt]. Reading past the end of the image returns
+// the bytes that exist along with [io.EOF].
+func (reader ImageReaderAt) ReadAt(buffer []byte, offset int64) (int, error) {
+	return readImageBytes(reader.Image, buffer, offset)
+}
+
+// ImageReadWriterAt adapts a [WritableDiskImage] to [io.ReaderAt] and
+// [io.WriterAt]. Writes that don't cover whole blocks read the surrounding data
+// first, so that it's preserved.
+type ImageReadWriterAt struct {
+	Image WritableDiskImage
+}
+
+// ReadAt implements [io.ReaderAt]. See [ImageReaderAt.ReadAt].
+func (readWriter ImageReadWriterAt) ReadAt(buffer []byte, offset int64) (int, error) {
+	return readImageBytes(readWriter.Image, buffer, offset)
+}
+
+// WriteAt implements [io.WriterAt]. Images can't grow this way, so writing past
+// the end of the image writes nothing and returns an error.
+func (readWriter ImageReadWriterAt) WriteAt(data []byte, offset int64) (int, error) {
+	image := readWriter.Image
+	if offset < 0 || offset+int64(len(data)) > image.Size() {
+		return 0, fmt.Errorf(
+			"can't write %d bytes at offset %d: image is only %d bytes",
+			len(data),
+			offset,
+			image.Size(),
+		)
+	} else if len(data) == 0 {
+		return 0, nil
+	}
+
+	first, blocks, err := readCoveringBlocks(image, offset, len(data))
+	if err != nil {
+		return 0, err
+	}
+
+	blockSize := int64(image.BytesPerBlock())
+	copy(blocks[offset-int64(first)*blockSize:], data)
+	_, err = image.WriteAt(blocks, first)
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// NewSectionReader returns an [io.SectionReader] that reads `size` bytes of
+// `image` beginning at byte `offset`. It's useful for handing a region of an
+// image to code that expects an [io.ReadSeeker] or [io.ReaderAt].
+func NewSectionReader(image DiskImage, offset, size int64) *io.SectionReader {
+	return io.NewSectionReader(ImageReaderAt{Image: image}, offset, size)
+}
+
+// readImageBytes implements [io.ReaderAt.ReadAt] for a [DiskImage].
+func readImageBytes(image DiskImage, buffer []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	} else if offset >= image.Size() {
+		return 0, io.EOF
+	}
+
+	wanted := buffer
+	if remaining := image.Size() - offset; int64(len(wanted)) > remaining {
+		wanted = wanted[:remaining]
+	}
+	if len(wanted) == 0 {
+		return 0, nil
+	}
+
+	first, blocks, err := readCoveringBlocks(image, offset, len(wanted))
+	if err != nil {
+		return 0, err
+	}
+
+	n := copy(wanted, blocks[offset-int64(first)*int64(image.BytesPerBlock()):])
+	if n < len(buffer) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readCoveringBlocks reads all the blocks containing the `size` bytes beginning
+// at `offset`, and returns them along with the index of the first one.
+func readCoveringBlocks(image DiskImage, offset int64, size int) (LogicalBlock, []byte, error) {
+	blockSize := int64(image.BytesPerBlock())
+	first := offset / blockSize
+	end := (offset + int64(size) + blockSize - 1) / blockSize
+
+	blocks := make([]byte, (end-first)*blockSize)
+	_, err := image.ReadAt(blocks, LogicalBlock(first))
+	if err != nil {
+		return 0, nil, err
+	}
+	return LogicalBlock(first), blocks, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// subImage is a [DiskImage] made of a range of blocks of another image. See
+// [NewSubImage].
+type subImage struct {
+	image       DiskImage
+	start       LogicalBlock
+	totalBlocks uint
+}
+
+// NewSubImage returns a [DiskImage] consisting of `totalBlocks` blocks of
+// `image` beginning at block `start`. Block 0 of the returned image is block
+// `start` of `image`. Use [NewWritableSubImage] if the sub-image needs to be
+// writable.
+func NewSubImage(image DiskImage, start LogicalBlock, totalBlocks uint) (DiskImage, error) {
+	if uint64(start)+uint64(totalBlocks) > uint64(image.TotalBlocks()) {
+		return nil, fmt.Errorf(
+			"blocks [%d, %d) not in range [0, %d)",
+			start,
+			uint64(start)+uint64(totalBlocks),
+			image.TotalBlocks(),
+		)
+	}
+	return &subImage{image: image, start: start, totalBlocks: totalBlocks}, nil
+}
+
+func (sub *subImage) BytesPerBlock() uint {
+	return sub.image.BytesPerBlock()
+}
+
+func (sub *subImage) TotalBlocks() uint {
+	return sub.totalBlocks
+}
+
+// Size returns the size of the sub-image in bytes. If the sub-image includes
+// the last block of the parent image, this accounts for that block being
+// partial.
+func (sub *subImage) Size() int64 {
+	size := int64(sub.totalBlocks) * int64(sub.BytesPerBlock())
+	available := sub.image.Size() - int64(sub.start)*int64(sub.BytesPerBlock())
+	if available < size {
+		return available
+	}
+	return size
+}
+
+func (sub *subImage) GetMinBlocksForSize(size uint) uint {
+	return sub.image.GetMinBlocksForSize(size)
+}
+
+func (sub *subImage) ReadAt(buffer []byte, start LogicalBlock) (int, error) {
+	err := sub.checkBounds(start, uint(len(buffer)))
+	if err != nil {
+		return 0, err
+	}
+	return sub.image.ReadAt(buffer, sub.start+start)
+}
+
+// checkBounds returns an error if `size` bytes starting at block `start` aren't
+// entirely within the sub-image.
+func (sub *subImage) checkBounds(start LogicalBlock, size uint) error {
+	end := uint64(start) + uint64(sub.GetMinBlocksForSize(size))
+	if end > uint64(sub.totalBlocks) {
+		return fmt.Errorf(
+			"can't access %d bytes starting at block %d: range not in [0, %d)",
+			size,
+			start,
+			sub.totalBlocks,
+		)
+	}
+	return nil
+}
+
+// writableSubImage is a [WritableDiskImage] made of a range of blocks of
+// another image. See [NewWritableSubImage].
+type writableSubImage struct {
+	subImage
+	writer WritableDiskImage
+}
+
+// NewWritableSubImage is the same as [NewSubImage], except that the sub-image
+// can be written to.
+func NewWritableSubImage(
+	image WritableDiskImage,
+	start LogicalBlock,
+	totalBlocks uint,
+) (WritableDiskImage, error) {
+	sub, err := NewSubImage(image, start, totalBlocks)
+	if err != nil {
+		return nil, err
+	}
+	return &writableSubImage{subImage: *sub.(*subImage), writer: image}, nil
+}
+
+func (sub *writableSubImage) WriteAt(buffer []byte, start LogicalBlock) (int, error) {
+	err := sub.checkBounds(start, uint(len(buffer)))
+	if err != nil {
+		return 0, err
+	}
+	return sub.writer.WriteAt(buffer, sub.start+start)
+}
+
+// Flush flushes the entire parent image, not just the sub-image.
+func (sub *writableSubImage) Flush() error {
+	return sub.writer.Flush()
+}
+
+func (sub *writableSubImage) MarkBlockRangeDirty(start LogicalBlock, length uint) error {
+	err := sub.checkBounds(start, length*sub.BytesPerBlock())
+	if err != nil {
+		return err
+	}
+	return sub.writer.MarkBlockRangeDirty(sub.start+start, length)
+}
+
+func (sub *writableSubImage) MarkBlockRangeClean(start LogicalBlock, length uint) error {
+	err := sub.checkBounds(start, length*sub.BytesPerBlock())
+	if err != nil {
+		return err
+	}
+	return sub.writer.MarkBlockRangeClean(sub.start+start, length)
+}
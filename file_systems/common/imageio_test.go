@@ -0,0 +1,108 @@
+package common_test
+
+import (
+	"io"
+	"testing"
+
+	c "github.com/dargueta/disko/file_systems/common"
+	"github.com/dargueta/disko/file_systems/common/blockcache"
+	diskotest "github.com/dargueta/disko/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageReaderAt__UnalignedReads(t *testing.T) {
+	backingData := diskotest.CreateRandomImage(64, 8, t)
+	cache := diskotest.CreateDefaultCache(64, 8, false, backingData, t)
+	reader := c.ImageReaderAt{Image: cache}
+
+	buffer := make([]byte, 100)
+	n, err := reader.ReadAt(buffer, 30)
+	require.NoError(t, err)
+	assert.Equal(t, 100, n)
+	assert.Equal(t, backingData[30:130], buffer)
+
+	// Reading past the end gives back what exists, and io.EOF.
+	n, err = reader.ReadAt(buffer, 500)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 12, n)
+	assert.Equal(t, backingData[500:], buffer[:12])
+
+	_, err = reader.ReadAt(buffer, 512)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+// Unaligned writes must only change the bytes written, not the rest of the
+// blocks they touch.
+func TestImageReadWriterAt__UnalignedWrites(t *testing.T) {
+	backingData := diskotest.CreateRandomImage(64, 8, t)
+	cache := diskotest.CreateDefaultCache(64, 8, true, backingData, t)
+	expected := append([]byte{}, backingData...)
+	readWriter := c.ImageReadWriterAt{Image: cache}
+
+	data := []byte("unaligned write spanning two blocks")
+	n, err := readWriter.WriteAt(data, 50)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	copy(expected[50:], data)
+
+	require.NoError(t, cache.Flush())
+	assert.Equal(t, expected, backingData)
+
+	_, err = readWriter.WriteAt(data, 500)
+	assert.Error(t, err, "writing past the end of the image should've failed")
+}
+
+func TestNewSectionReader(t *testing.T) {
+	backingData := diskotest.CreateRandomImage(64, 8, t)
+	cache := diskotest.CreateDefaultCache(64, 8, false, backingData, t)
+
+	section := c.NewSectionReader(cache, 100, 200)
+	_, err := section.Seek(10, io.SeekStart)
+	require.NoError(t, err)
+
+	contents, err := io.ReadAll(section)
+	require.NoError(t, err)
+	assert.Equal(t, backingData[110:300], contents)
+}
+
+func TestNewSubImage(t *testing.T) {
+	backingData := diskotest.CreateRandomImage(64, 8, t)
+	cache := diskotest.CreateDefaultCache(64, 8, false, backingData, t)
+
+	sub, err := c.NewSubImage(cache, 2, 3)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, sub.TotalBlocks())
+	assert.EqualValues(t, 192, sub.Size())
+
+	buffer := make([]byte, 128)
+	_, err = sub.ReadAt(buffer, 1)
+	require.NoError(t, err)
+	assert.Equal(t, backingData[192:320], buffer)
+
+	_, err = sub.ReadAt(buffer, 2)
+	assert.Error(t, err, "reading past the end of the sub-image should've failed")
+
+	_, err = c.NewSubImage(cache, 6, 3)
+	assert.Error(t, err, "sub-image extending past the end of the image was allowed")
+}
+
+func TestNewWritableSubImage(t *testing.T) {
+	backingData := diskotest.CreateRandomImage(64, 8, t)
+	cache := diskotest.CreateDefaultCache(64, 8, true, backingData, t)
+
+	sub, err := c.NewWritableSubImage(cache, 4, 4)
+	require.NoError(t, err)
+
+	data := make([]byte, 64)
+	_, err = sub.WriteAt(data, 3)
+	require.NoError(t, err)
+	require.NoError(t, sub.Flush())
+	assert.Equal(t, data, backingData[7*64:])
+
+	_, err = sub.WriteAt(data, 4)
+	assert.Error(t, err, "writing past the end of the sub-image should've failed")
+}
+
+// BlockCache is used throughout the tests above as a writable disk image.
+var _ c.WritableDiskImage = (*blockcache.BlockCache)(nil)
@@ -0,0 +1,330 @@
+// Package shortname generates DOS-style 8.3 file names for files with names
+// that don't fit, such as files imported from a modern host onto a FAT or CP/M
+// image.
+//
+// A long name is first reduced to its basis name: ASCII letters are converted
+// to upper case, spaces and leading dots are dropped, characters DOS doesn't
+// allow are replaced with underscores, and the name is truncated to eight
+// characters with an extension of up to three. If two long names in the same
+// directory have the same basis name, the [Policy] decides what happens.
+package shortname
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dargueta/disko"
+)
+
+const (
+	maxBaseLength      = 8
+	maxExtensionLength = 3
+)
+
+// invalidChars are the printable ASCII characters DOS doesn't allow in file
+// names, besides the dot separating the extension.
+const invalidChars = `"*+,/:;<=>?[\]|`
+
+// Policy says what a [Generator] does when a name is already taken.
+type Policy int
+
+const (
+	// PolicyNumericTail replaces the end of the base name with "~1", "~2",
+	// etc., using the first number that gives a free name. This is what DOS
+	// and Windows do, so the names look familiar, but which file gets which
+	// number depends on the order they're added in.
+	PolicyNumericTail = Policy(iota)
+
+	// PolicyHashTail replaces all but the first two characters of the base
+	// name with four hex digits from a hash of the long name, then a numeric
+	// tail. The same long name almost always gets the same short name,
+	// regardless of what else is in the directory.
+	PolicyHashTail
+
+	// PolicyError fails with [disko.ErrExists].
+	PolicyError
+
+	// PolicyAsk calls [Generator.Ask] to choose a different name.
+	PolicyAsk
+)
+
+var policyNames = map[Policy]string{
+	PolicyNumericTail: "numeric",
+	PolicyHashTail:    "hash",
+	PolicyError:       "error",
+	PolicyAsk:         "ask",
+}
+
+func (policy Policy) String() string {
+	if name, ok := policyNames[policy]; ok {
+		return name
+	}
+	return fmt.Sprintf("Policy(%d)", int(policy))
+}
+
+// PolicyNames returns the names [ParsePolicy] accepts, in sorted order.
+func PolicyNames() []string {
+	names := make([]string, 0, len(policyNames))
+	for _, name := range policyNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParsePolicy returns the policy with the given name, as returned by
+// [Policy.String].
+func ParsePolicy(name string) (Policy, error) {
+	for policy, policyName := range policyNames {
+		if strings.EqualFold(name, policyName) {
+			return policy, nil
+		}
+	}
+	return 0, disko.ErrInvalidArgument.WithMessage(
+		fmt.Sprintf(
+			"unknown name collision policy %q; expected one of: %s",
+			name,
+			strings.Join(PolicyNames(), ", "),
+		),
+	)
+}
+
+// Rename records a long name that was stored under a different short name.
+type Rename struct {
+	// Directory is the absolute path of the directory the object is in.
+	Directory string
+	// Name is the original name of the object.
+	Name string
+	// ShortName is the name it was given.
+	ShortName string
+}
+
+func (rename Rename) String() string {
+	return fmt.Sprintf("%s -> %s", rename.Name, rename.ShortName)
+}
+
+// Generator assigns short names to long ones. It remembers the names it's
+// given out in each directory, so the same long name always gets the same
+// short name, and two long names never get the same one. Names are only
+// changed if they aren't already valid 8.3 names.
+//
+// The zero value isn't usable; create generators with [New].
+type Generator struct {
+	// Ask is called with [PolicyAsk] when the basis name of `name` in
+	// `directory` is `taken`. It returns the name to use instead, and is
+	// called again if that isn't a valid 8.3 name or is also taken.
+	Ask func(directory, name, taken string) (string, error)
+
+	policy Policy
+	// assigned maps directories to the long names in them we've shortened,
+	// and the short names they were given.
+	assigned map[string]map[string]string
+	// taken maps directories to the short names we've handed out in them.
+	taken   map[string]map[string]struct{}
+	renames []Rename
+}
+
+// New creates a generator that handles collisions according to `policy`.
+func New(policy Policy) *Generator {
+	return &Generator{
+		policy:   policy,
+		assigned: map[string]map[string]string{},
+		taken:    map[string]map[string]struct{}{},
+	}
+}
+
+// Renames returns every name the generator has changed, in the order they
+// were changed.
+func (generator *Generator) Renames() []Rename {
+	return generator.renames
+}
+
+// MapName returns the 8.3 name to store `name` as in `directory`, an absolute
+// path. `exists` returns true if there's already an object in the directory
+// with a given name. Valid 8.3 names are only converted to upper case, and may
+// be the names of existing objects.
+//
+// A long name is given its basis name if that's free, and otherwise handled as
+// the generator's policy says. Since only this generator knows which long
+// names the short names in the image came from, importing the same files a
+// second time gives them new names.
+func (generator *Generator) MapName(
+	directory string,
+	name string,
+	exists func(name string) bool,
+) (string, error) {
+	if shortName, ok := generator.assigned[directory][name]; ok {
+		return shortName, nil
+	}
+
+	basis, exact := Basis(name)
+	if exact {
+		generator.markTaken(directory, basis)
+		return basis, nil
+	}
+
+	isTaken := func(candidate string) bool {
+		_, ok := generator.taken[directory][candidate]
+		return ok || exists(candidate)
+	}
+
+	shortName := basis
+	if isTaken(basis) {
+		var err error
+		shortName, err = generator.resolveCollision(directory, name, basis, isTaken)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if generator.assigned[directory] == nil {
+		generator.assigned[directory] = map[string]string{}
+	}
+	generator.assigned[directory][name] = shortName
+	generator.markTaken(directory, shortName)
+	generator.renames = append(
+		generator.renames,
+		Rename{Directory: directory, Name: name, ShortName: shortName},
+	)
+	return shortName, nil
+}
+
+func (generator *Generator) markTaken(directory, shortName string) {
+	if generator.taken[directory] == nil {
+		generator.taken[directory] = map[string]struct{}{}
+	}
+	generator.taken[directory][shortName] = struct{}{}
+}
+
+// resolveCollision finds a free name for `name` according to the generator's
+// policy, given that its basis name is taken.
+func (generator *Generator) resolveCollision(
+	directory string,
+	name string,
+	basis string,
+	isTaken func(string) bool,
+) (string, error) {
+	stem, extension, _ := strings.Cut(basis, ".")
+
+	switch generator.policy {
+	case PolicyNumericTail:
+		return withNumericTail(stem, extension, isTaken)
+	case PolicyHashTail:
+		hash := fnv.New32a()
+		hash.Write([]byte(name))
+		prefix := stem
+		if len(prefix) > 2 {
+			prefix = prefix[:2]
+		}
+		stem = fmt.Sprintf("%s%04X", prefix, hash.Sum32()&0xffff)
+		return withNumericTail(stem, extension, isTaken)
+	case PolicyError:
+		return "", disko.ErrExists.WithMessage(
+			fmt.Sprintf(
+				"%q in %q would be stored as %q, which is already taken",
+				name,
+				directory,
+				basis,
+			),
+		)
+	case PolicyAsk:
+		if generator.Ask == nil {
+			return "", disko.ErrInvalidArgument.WithMessage(
+				"name collision policy is \"ask\" but there's no function to ask with")
+		}
+		taken := basis
+		for {
+			answer, err := generator.Ask(directory, name, taken)
+			if err != nil {
+				return "", err
+			}
+
+			candidate, exact := Basis(answer)
+			if exact && !isTaken(candidate) {
+				return candidate, nil
+			}
+			taken = candidate
+		}
+	default:
+		return "", disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("unknown name collision policy %d", int(generator.policy)))
+	}
+}
+
+// withNumericTail returns the first free name made by replacing the end of
+// `stem` with "~1", "~2", and so on.
+func withNumericTail(stem, extension string, isTaken func(string) bool) (string, error) {
+	for number := 1; number < 1000000; number++ {
+		tail := "~" + strconv.Itoa(number)
+		truncated := stem
+		if len(truncated)+len(tail) > maxBaseLength {
+			truncated = truncated[:maxBaseLength-len(tail)]
+		}
+
+		candidate := joinName(truncated+tail, extension)
+		if !isTaken(candidate) {
+			return candidate, nil
+		}
+	}
+	return "", disko.ErrNoSpaceOnDevice.WithMessage(
+		fmt.Sprintf("ran out of short names for %q", joinName(stem, extension)))
+}
+
+// Basis returns the basis name of `name` described in the package
+// documentation. `exact` is true if nothing but the case of letters changed,
+// i.e. `name` is already a valid 8.3 name.
+func Basis(name string) (basis string, exact bool) {
+	upper := []byte(name)
+	for i, char := range upper {
+		if char >= 'a' && char <= 'z' {
+			upper[i] = char - 'a' + 'A'
+		}
+	}
+
+	cleaned := strings.TrimLeft(strings.ReplaceAll(string(upper), " ", ""), ".")
+	stem, extension := cleaned, ""
+	if dot := strings.LastIndexByte(cleaned, '.'); dot >= 0 {
+		stem, extension = cleaned[:dot], cleaned[dot+1:]
+	}
+
+	stem = truncate(replaceInvalid(stem), maxBaseLength)
+	extension = truncate(replaceInvalid(extension), maxExtensionLength)
+	if stem == "" {
+		stem = "_"
+	}
+
+	basis = joinName(stem, extension)
+	return basis, basis == string(upper)
+}
+
+// replaceInvalid replaces the characters in `part` that aren't allowed in a
+// name with underscores. This includes all non-ASCII characters, since we
+// don't know what code page the image uses.
+func replaceInvalid(part string) string {
+	return strings.Map(
+		func(char rune) rune {
+			if char < 0x20 || char >= 0x7f || char == '.' || strings.ContainsRune(invalidChars, char) {
+				return '_'
+			}
+			return char
+		},
+		part,
+	)
+}
+
+func truncate(part string, length int) string {
+	if len(part) > length {
+		return part[:length]
+	}
+	return part
+}
+
+func joinName(stem, extension string) string {
+	if extension == "" {
+		return stem
+	}
+	return stem + "." + extension
+}
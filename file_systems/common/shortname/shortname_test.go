@@ -0,0 +1,148 @@
+package shortname_test
+
+import (
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/common/shortname"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBasis(t *testing.T) {
+	cases := []struct {
+		name  string
+		basis string
+		exact bool
+	}{
+		{"readme.txt", "README.TXT", true},
+		{"COMMAND.COM", "COMMAND.COM", true},
+		{"Makefile", "MAKEFILE", true},
+		{"longfilename.text", "LONGFILE.TEX", false},
+		{"my file.doc", "MYFILE.DOC", false},
+		{".profile", "PROFILE", false},
+		{"archive.tar.gz", "ARCHIVE_.GZ", false},
+		{"a+b=c.txt", "A_B_C.TXT", false},
+		{"café.txt", "CAF_.TXT", false},
+		{"...", "_", false},
+	}
+
+	for _, testCase := range cases {
+		basis, exact := shortname.Basis(testCase.name)
+		assert.Equal(t, testCase.basis, basis, testCase.name)
+		assert.Equal(t, testCase.exact, exact, testCase.name)
+	}
+}
+
+// existingNames returns an `exists` function for MapName that reports the
+// given names as taken.
+func existingNames(names ...string) func(string) bool {
+	return func(name string) bool {
+		for _, existing := range names {
+			if name == existing {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func TestGenerator__NumericTail(t *testing.T) {
+	generator := shortname.New(shortname.PolicyNumericTail)
+	exists := existingNames("LONGFILE.TXT")
+
+	first, err := generator.MapName("/", "longfilename1.txt", exists)
+	require.NoError(t, err)
+	assert.Equal(t, "LONGFI~1.TXT", first)
+
+	second, err := generator.MapName("/", "longfilename2.txt", exists)
+	require.NoError(t, err)
+	assert.Equal(t, "LONGFI~2.TXT", second)
+
+	again, err := generator.MapName("/", "longfilename1.txt", exists)
+	require.NoError(t, err)
+	assert.Equal(t, first, again, "same long name should get the same short name")
+
+	other, err := generator.MapName("/SUBDIR", "longfilename2.txt", existingNames())
+	require.NoError(t, err)
+	assert.Equal(t, "LONGFILE.TXT", other, "directories are independent")
+
+	assert.Equal(
+		t,
+		[]shortname.Rename{
+			{Directory: "/", Name: "longfilename1.txt", ShortName: "LONGFI~1.TXT"},
+			{Directory: "/", Name: "longfilename2.txt", ShortName: "LONGFI~2.TXT"},
+			{Directory: "/SUBDIR", Name: "longfilename2.txt", ShortName: "LONGFILE.TXT"},
+		},
+		generator.Renames(),
+	)
+}
+
+// Valid 8.3 names are kept even if they exist, since that's an overwrite
+// rather than a collision, but long names never take them.
+func TestGenerator__ExactNames(t *testing.T) {
+	generator := shortname.New(shortname.PolicyError)
+
+	name, err := generator.MapName("/", "readme.txt", existingNames("README.TXT"))
+	require.NoError(t, err)
+	assert.Equal(t, "README.TXT", name)
+
+	_, err = generator.MapName("/", "readme.txt.orig", existingNames())
+	require.NoError(t, err)
+
+	_, err = generator.MapName("/", "readme", existingNames())
+	require.NoError(t, err)
+	_, err = generator.MapName("/", "read me", existingNames())
+	assert.ErrorIs(t, err, disko.ErrExists)
+	assert.Len(t, generator.Renames(), 1, "only readme.txt.orig should be renamed")
+}
+
+func TestGenerator__HashTail(t *testing.T) {
+	first := shortname.New(shortname.PolicyHashTail)
+	second := shortname.New(shortname.PolicyHashTail)
+	exists := existingNames("LONGFILE.TXT")
+
+	// The order names are added in doesn't matter.
+	a1, err := first.MapName("/", "longfilename1.txt", exists)
+	require.NoError(t, err)
+	b1, err := first.MapName("/", "longfilename2.txt", exists)
+	require.NoError(t, err)
+
+	b2, err := second.MapName("/", "longfilename2.txt", exists)
+	require.NoError(t, err)
+	a2, err := second.MapName("/", "longfilename1.txt", exists)
+	require.NoError(t, err)
+
+	assert.Equal(t, a1, a2)
+	assert.Equal(t, b1, b2)
+	assert.NotEqual(t, a1, b1)
+	assert.Regexp(t, `^LO[0-9A-F]{4}~1\.TXT$`, a1)
+}
+
+func TestGenerator__Ask(t *testing.T) {
+	generator := shortname.New(shortname.PolicyAsk)
+	answers := []string{"not valid.txt", "TAKEN.TXT", "other.txt"}
+	asked := []string{}
+	generator.Ask = func(directory, name, taken string) (string, error) {
+		asked = append(asked, taken)
+		answer := answers[0]
+		answers = answers[1:]
+		return answer, nil
+	}
+
+	name, err := generator.MapName("/", "longfilename.txt", existingNames("LONGFILE.TXT", "TAKEN.TXT"))
+	require.NoError(t, err)
+	assert.Equal(t, "OTHER.TXT", name)
+	assert.Equal(t, []string{"LONGFILE.TXT", "NOTVALID.TXT", "TAKEN.TXT"}, asked)
+}
+
+func TestParsePolicy(t *testing.T) {
+	for _, name := range shortname.PolicyNames() {
+		policy, err := shortname.ParsePolicy(name)
+		require.NoError(t, err)
+		assert.Equal(t, name, policy.String())
+	}
+
+	_, err := shortname.ParsePolicy("random")
+	assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+}
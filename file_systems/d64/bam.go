@@ -0,0 +1,208 @@
+package d64
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+)
+
+const (
+	// SectorSize is the size of a sector, in bytes.
+	SectorSize = 256
+	// DataBytesPerSector is the number of bytes of a file each sector holds,
+	// after the link to the next sector.
+	DataBytesPerSector = SectorSize - 2
+	// DirectoryTrack is the track holding the BAM and the directory.
+	DirectoryTrack = 18
+	// StandardTracks is the number of tracks on a 1541 disk.
+	StandardTracks = 35
+	// ExtendedTracks is the number of tracks on a disk formatted to use the
+	// extra tracks some drives can reach.
+	ExtendedTracks = 40
+)
+
+// Sizes of the images of standard and extended disks. Images with error
+// information have one more byte for each sector.
+const (
+	StandardImageSize = 683 * SectorSize
+	ExtendedImageSize = 768 * SectorSize
+)
+
+// dosType is the format the BAM gives for disks written by a 1541.
+const dosType = "2A"
+
+// Offsets of the fields of the BAM.
+const (
+	bamEntriesOffset  = 0x04
+	bamEntrySize      = 4
+	bamDiskNameOffset = 0x90
+	bamDiskIDOffset   = 0xA2
+	bamDOSTypeOffset  = 0xA5
+)
+
+// padding is the byte names are padded with, a shifted space in PETSCII.
+const padding = 0xA0
+
+// newGeometry returns the geometry of a disk with `tracks` tracks. Tracks past
+// the 35th have as many sectors as the innermost zone.
+func newGeometry(tracks uint) disks.ZonedGeometry {
+	return disks.ZonedGeometry{
+		BytesPerSector: SectorSize,
+		FirstTrack:     1,
+		Zones: []disks.Zone{
+			{Tracks: 17, SectorsPerTrack: 21},
+			{Tracks: 7, SectorsPerTrack: 19},
+			{Tracks: 6, SectorsPerTrack: 18},
+			{Tracks: tracks - 30, SectorsPerTrack: 17},
+		},
+	}
+}
+
+// geometryForImageSize returns the geometry of the disk in an image that's
+// `size` bytes long.
+func geometryForImageSize(size int64) (disks.ZonedGeometry, disko.DriverError) {
+	switch size {
+	case StandardImageSize, StandardImageSize + StandardImageSize/SectorSize:
+		return newGeometry(StandardTracks), nil
+	case ExtendedImageSize, ExtendedImageSize + ExtendedImageSize/SectorSize:
+		return newGeometry(ExtendedTracks), nil
+	default:
+		return disks.ZonedGeometry{}, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("%d bytes isn't the size of a D64 image", size))
+	}
+}
+
+// TrackSector is the location of a sector on the disk. Tracks are numbered from
+// 1, so track 0 is used to mean "no sector".
+type TrackSector struct {
+	Track  uint8
+	Sector uint8
+}
+
+func (location TrackSector) String() string {
+	return fmt.Sprintf("T%d S%d", location.Track, location.Sector)
+}
+
+// parseTrackSector decodes a track number and sector number stored next to each
+// other.
+func parseTrackSector(data []byte) TrackSector {
+	return TrackSector{Track: data[0], Sector: data[1]}
+}
+
+// BAMEntry is the part of the BAM for one track.
+type BAMEntry struct {
+	FreeSectors uint8
+	// Bitmap has a set bit for each free sector. The least significant bit of
+	// the first byte is sector 0.
+	Bitmap [3]byte
+}
+
+// RawBAM is the block availability map, along with the rest of the disk's
+// header.
+type RawBAM struct {
+	FirstDirectorySector TrackSector
+	DOSVersion           uint8
+	// Entries only covers the first 35 tracks. There's no standard for where
+	// the BAM of an extended disk's other tracks goes.
+	Entries [StandardTracks]BAMEntry
+	// DiskName is the name of the disk in PETSCII, padded with shifted spaces.
+	DiskName [16]byte
+	DiskID   [2]byte
+	DOSType  [2]byte
+}
+
+// readBAM reads the BAM of the disk in `image`, which is `size` bytes long, and
+// returns it with the disk's geometry.
+func readBAM(image io.ReaderAt, size int64) (*RawBAM, disks.ZonedGeometry, disko.DriverError) {
+	geometry, driverErr := geometryForImageSize(size)
+	if driverErr != nil {
+		return nil, geometry, driverErr
+	}
+
+	data, driverErr := readSector(image, geometry, TrackSector{Track: DirectoryTrack})
+	if driverErr != nil {
+		return nil, geometry, driverErr
+	}
+
+	bam := &RawBAM{
+		FirstDirectorySector: parseTrackSector(data[0x00:]),
+		DOSVersion:           data[0x02],
+	}
+	for i := range bam.Entries {
+		entry := data[bamEntriesOffset+i*bamEntrySize:]
+		bam.Entries[i].FreeSectors = entry[0]
+		copy(bam.Entries[i].Bitmap[:], entry[1:])
+	}
+	copy(bam.DiskName[:], data[bamDiskNameOffset:])
+	copy(bam.DiskID[:], data[bamDiskIDOffset:])
+	copy(bam.DOSType[:], data[bamDOSTypeOffset:])
+	return bam, geometry, nil
+}
+
+// IsFree returns true if the BAM marks `location` as free.
+func (bam *RawBAM) IsFree(location TrackSector) bool {
+	if location.Track < 1 || location.Track > StandardTracks || location.Sector >= 24 {
+		return false
+	}
+	bitmap := bam.Entries[location.Track-1].Bitmap
+	return bitmap[location.Sector/8]&(1<<(location.Sector%8)) != 0
+}
+
+// countFree returns the number of free sectors the BAM gives for every track
+// besides the directory track, which is what DOS reports as blocks free.
+func (bam *RawBAM) countFree() int {
+	count := 0
+	for i, entry := range bam.Entries {
+		if i+1 != DirectoryTrack {
+			count += int(entry.FreeSectors)
+		}
+	}
+	return count
+}
+
+// DiskNameString returns the name of the disk, converted the same way as file
+// names.
+func (bam *RawBAM) DiskNameString() string {
+	return convertName(bam.DiskName[:])
+}
+
+// readSector reads the sector at `location` into a new buffer.
+func readSector(
+	image io.ReaderAt,
+	geometry disks.ZonedGeometry,
+	location TrackSector,
+) ([]byte, disko.DriverError) {
+	offset, err := geometry.SectorOffset(uint(location.Track), uint(location.Sector))
+	if err != nil {
+		return nil, disko.ErrFileSystemCorrupted.Wrap(err)
+	}
+
+	data := make([]byte, SectorSize)
+	_, err = image.ReadAt(data, offset)
+	if err != nil {
+		return nil, disko.ErrIOFailed.Wrap(
+			fmt.Errorf("failed to read %s: %w", location, err))
+	}
+	return data, nil
+}
+
+// statFileSystem returns the statistics of a disk from its BAM and geometry,
+// and the number of files on it.
+func statFileSystem(bam *RawBAM, geometry disks.ZonedGeometry, files int) disko.FSStat {
+	free := uint64(bam.countFree())
+	filesFree := uint64(0)
+	if files < MaxDirectoryEntries {
+		filesFree = uint64(MaxDirectoryEntries - files)
+	}
+	return disko.FSStat{
+		BlockSize:       SectorSize,
+		TotalBlocks:     uint64(geometry.TotalSectors()),
+		BlocksFree:      free,
+		BlocksAvailable: free,
+		Files:           uint64(files),
+		FilesFree:       filesFree,
+		MaxNameLength:   MaxNameLength,
+	}
+}
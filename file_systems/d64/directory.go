@@ -0,0 +1,149 @@
+package d64
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+)
+
+const (
+	// DirectoryEntrySize is the size of an entry in the directory, in bytes.
+	DirectoryEntrySize = 32
+	// DirectoryEntriesPerSector is the number of entries in a directory sector.
+	DirectoryEntriesPerSector = SectorSize / DirectoryEntrySize
+	// MaxDirectoryEntries is the number of entries that fit in the directory
+	// track besides the BAM.
+	MaxDirectoryEntries = 18 * DirectoryEntriesPerSector
+	// MaxNameLength is the length of the longest file name.
+	MaxNameLength = 16
+)
+
+// FirstDirectorySector is where DOS begins reading the directory, regardless
+// of what the BAM says.
+var FirstDirectorySector = TrackSector{Track: DirectoryTrack, Sector: 1}
+
+// File types, in the low three bits of [RawDirent.TypeFlags].
+const (
+	FileTypeDeleted    = 0x00
+	FileTypeSequential = 0x01
+	FileTypeProgram    = 0x02
+	FileTypeUser       = 0x03
+	FileTypeRelative   = 0x04
+)
+
+// Flags in [RawDirent.TypeFlags].
+const (
+	FlagLocked = 0x40
+	// FlagClosed is cleared while a file is open for writing. A file without
+	// it was never closed properly, and is listed with an asterisk.
+	FlagClosed = 0x80
+)
+
+// RawDirent is an entry in the directory.
+type RawDirent struct {
+	TypeFlags   uint8
+	FirstSector TrackSector
+	// Name is the file name in PETSCII, padded with shifted spaces.
+	Name [MaxNameLength]byte
+	// SideSector is the first side sector of a relative file, which indexes
+	// its records.
+	SideSector   TrackSector
+	RecordLength uint8
+	// SectorCount is the number of sectors the file uses.
+	SectorCount uint16
+}
+
+// parseRawDirent decodes a directory entry. The first two bytes are ignored,
+// since in the first entry of a sector they're the link to the next sector.
+func parseRawDirent(data []byte) RawDirent {
+	dirent := RawDirent{
+		TypeFlags:    data[0x02],
+		FirstSector:  parseTrackSector(data[0x03:]),
+		SideSector:   parseTrackSector(data[0x15:]),
+		RecordLength: data[0x17],
+		SectorCount:  binary.LittleEndian.Uint16(data[0x1E:]),
+	}
+	copy(dirent.Name[:], data[0x05:0x15])
+	return dirent
+}
+
+// IsScratched returns true if the entry is unused or for a deleted file.
+func (dirent *RawDirent) IsScratched() bool {
+	return dirent.TypeFlags == 0
+}
+
+// FileType returns the type of the file, without flags.
+func (dirent *RawDirent) FileType() uint8 {
+	return dirent.TypeFlags & 0x07
+}
+
+// NameString returns the name of the file converted to ASCII. See
+// [convertName].
+func (dirent *RawDirent) NameString() string {
+	return convertName(dirent.Name[:])
+}
+
+// convertName converts a name from PETSCII to ASCII, without the padding at
+// the end. Characters that are the same in both are kept, and every other byte
+// is written as a percent sign and two hex digits, as are "/" and "%", so the
+// name can't be mistaken for a path and can be converted back.
+func convertName(name []byte) string {
+	end := len(name)
+	for end > 0 && name[end-1] == padding {
+		end--
+	}
+
+	var builder strings.Builder
+	for _, char := range name[:end] {
+		if char >= 0x20 && char <= 0x5D && char != 0x5C && char != '/' && char != '%' {
+			builder.WriteByte(char)
+		} else {
+			fmt.Fprintf(&builder, "%%%02X", char)
+		}
+	}
+	return builder.String()
+}
+
+// readDirectory follows the chain of directory sectors, and returns the entries
+// that aren't scratched.
+func readDirectory(image io.ReaderAt, geometry disks.ZonedGeometry) ([]RawDirent, disko.DriverError) {
+	dirents := []RawDirent{}
+	visited := map[TrackSector]bool{}
+
+	for location := FirstDirectorySector; location.Track != 0; {
+		if visited[location] {
+			return nil, disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf("directory sector chain has a cycle at %s", location))
+		}
+		visited[location] = true
+
+		data, err := readSector(image, geometry, location)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := 0; i < DirectoryEntriesPerSector; i++ {
+			dirent := parseRawDirent(data[i*DirectoryEntrySize:])
+			if !dirent.IsScratched() {
+				dirents = append(dirents, dirent)
+			}
+		}
+		location = parseTrackSector(data[0x00:])
+	}
+	return dirents, nil
+}
+
+// ConvertFlagsToStandard returns the mode of a file with the given type and
+// flags. DOS has no permissions, so files are readable and writable by everyone
+// unless they're locked.
+func ConvertFlagsToStandard(typeFlags uint8) os.FileMode {
+	if typeFlags&FlagLocked != 0 {
+		return 0o444
+	}
+	return 0o666
+}
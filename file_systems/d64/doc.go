@@ -0,0 +1,2 @@
+// https://en.wikipedia.org/wiki/Commodore_1541
+package d64
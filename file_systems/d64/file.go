@@ -0,0 +1,92 @@
+package d64
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+)
+
+// fileSectors follows the chain of sectors of the file with directory entry
+// `dirent`, and returns their locations in order along with the file's size.
+func fileSectors(
+	image io.ReaderAt,
+	geometry disks.ZonedGeometry,
+	dirent *RawDirent,
+) ([]TrackSector, int64, disko.DriverError) {
+	name := dirent.NameString()
+	sectors := []TrackSector{}
+	visited := map[TrackSector]bool{}
+	size := int64(0)
+
+	for location := dirent.FirstSector; location.Track != 0; {
+		if visited[location] {
+			return nil, 0, disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf("%s: sector chain has a cycle at %s", name, location))
+		}
+		visited[location] = true
+
+		_, err := geometry.SectorIndex(uint(location.Track), uint(location.Sector))
+		if err != nil {
+			return nil, 0, disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf("%s: sector %d is at %s, which isn't on the disk", name, len(sectors), location))
+		}
+
+		data, driverErr := readSector(image, geometry, location)
+		if driverErr != nil {
+			return nil, 0, driverErr
+		}
+		sectors = append(sectors, location)
+
+		next := parseTrackSector(data[0x00:])
+		if next.Track != 0 {
+			size += DataBytesPerSector
+		} else if next.Sector >= 2 {
+			// The last sector gives the position of its last byte in use.
+			size += int64(next.Sector) - 1
+		}
+		location = next
+	}
+	return sectors, size, nil
+}
+
+// fileReader is an [io.ReaderAt] for the contents of a file.
+type fileReader struct {
+	image    io.ReaderAt
+	geometry disks.ZonedGeometry
+	sectors  []TrackSector
+	size     int64
+}
+
+func (reader *fileReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	n := 0
+	for n < len(buffer) && offset+int64(n) < reader.size {
+		position := offset + int64(n)
+		location := reader.sectors[position/DataBytesPerSector]
+		start := position % DataBytesPerSector
+
+		chunk := buffer[n:]
+		if int64(len(chunk)) > DataBytesPerSector-start {
+			chunk = chunk[:DataBytesPerSector-start]
+		}
+		if int64(len(chunk)) > reader.size-position {
+			chunk = chunk[:reader.size-position]
+		}
+
+		sectorOffset, err := reader.geometry.SectorOffset(uint(location.Track), uint(location.Sector))
+		if err != nil {
+			return n, err
+		}
+		_, err = reader.image.ReadAt(chunk, sectorOffset+2+start)
+		if err != nil {
+			return n, err
+		}
+		n += len(chunk)
+	}
+
+	if n < len(buffer) {
+		return n, io.EOF
+	}
+	return n, nil
+}
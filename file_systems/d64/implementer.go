@@ -0,0 +1,142 @@
+package d64
+
+import (
+	"io"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+	"github.com/dargueta/disko/file_systems/common/archivefs"
+)
+
+// Driver implements [disko.FileSystemImplementer] for Commodore 1541 disks in
+// D64 images. It only supports mounting images read-only.
+//
+// The disk has no subdirectories, so everything besides reading the BAM, the
+// directory, and sector chains is done by an [archivefs.FileSystem]. Each
+// file's chain is followed when the disk is mounted, since that's the only way
+// to get its size.
+type Driver struct {
+	*archivefs.FileSystem
+	stream   io.ReadWriteSeeker
+	image    *disks.Section
+	geometry disks.ZonedGeometry
+	bam      *RawBAM
+	files    []diskFile
+	stat     disko.FSStat
+}
+
+// diskFile is a file on the disk.
+type diskFile struct {
+	dirent  RawDirent
+	sectors []TrackSector
+	size    int64
+}
+
+// NewDriver creates a 1541 DOS implementation for the image in `stream`. It
+// implements [disko.ImplementerConstructor].
+func NewDriver(stream io.ReadWriteSeeker) (disko.FileSystemImplementer, disko.DriverError) {
+	return &Driver{stream: stream}, nil
+}
+
+func (driver *Driver) Mount(flags disko.MountFlags) disko.DriverError {
+	if driver.bam != nil {
+		return disko.ErrAlreadyInProgress
+	}
+
+	writeFlags := disko.MountFlagsAllowWrite |
+		disko.MountFlagsAllowInsert |
+		disko.MountFlagsAllowDelete |
+		disko.MountFlagsAllowAdminister
+	if flags&writeFlags != 0 && !flags.IsShared() {
+		return disko.ErrReadOnlyFileSystem.WithMessage(
+			"D64 images can only be mounted read-only")
+	}
+
+	size, err := driver.stream.Seek(0, io.SeekEnd)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	image, err := disks.NewWindow(driver.stream, 0, size)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+
+	bam, geometry, driverErr := readBAM(image, size)
+	if driverErr != nil {
+		return driverErr
+	}
+	dirents, driverErr := readDirectory(image, geometry)
+	if driverErr != nil {
+		return driverErr
+	}
+
+	files := make([]diskFile, 0, len(dirents))
+	for i := range dirents {
+		sectors, size, driverErr := fileSectors(image, geometry, &dirents[i])
+		if driverErr != nil {
+			return driverErr
+		}
+		files = append(files, diskFile{dirent: dirents[i], sectors: sectors, size: size})
+	}
+
+	driver.image = image
+	driver.geometry = geometry
+	driver.files = files
+	driver.FileSystem = archivefs.New(driver, SectorSize, Features)
+	driverErr = driver.FileSystem.Mount(flags)
+	if driverErr != nil {
+		driver.FileSystem = nil
+		driver.files = nil
+		return driverErr
+	}
+
+	driver.bam = bam
+	driver.stat = statFileSystem(bam, geometry, len(files))
+	return nil
+}
+
+// Members implements [archivefs.Archive].
+func (driver *Driver) Members() ([]archivefs.Member, error) {
+	members := make([]archivefs.Member, len(driver.files))
+	for i, file := range driver.files {
+		members[i] = archivefs.Member{
+			Name:         file.dirent.NameString(),
+			Size:         file.size,
+			LastModified: disko.UndefinedTimestamp,
+			Mode:         ConvertFlagsToStandard(file.dirent.TypeFlags),
+		}
+	}
+	return members, nil
+}
+
+// OpenMember implements [archivefs.Archive].
+func (driver *Driver) OpenMember(index int) (io.ReaderAt, error) {
+	file := &driver.files[index]
+	return &fileReader{
+		image:    driver.image,
+		geometry: driver.geometry,
+		sectors:  file.sectors,
+		size:     file.size,
+	}, nil
+}
+
+func (driver *Driver) Unmount() disko.DriverError {
+	if driver.FileSystem != nil {
+		driver.FileSystem.Unmount()
+	}
+	driver.FileSystem = nil
+	driver.image = nil
+	driver.bam = nil
+	driver.files = nil
+	return nil
+}
+
+// FSStat implements [disko.FileSystemImplementer], with the free space from
+// the BAM.
+func (driver *Driver) FSStat() disko.FSStat {
+	return driver.stat
+}
+
+func (driver *Driver) GetFSFeatures() disko.FSFeatures {
+	return Features
+}
@@ -0,0 +1,224 @@
+package d64_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/d64"
+	diskotest "github.com/dargueta/disko/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xaionaro-go/bytesextra"
+)
+
+// sectorsBefore gives the number of sectors before each track of a 35-track
+// disk, starting with track 1.
+var sectorsBefore = func() []int {
+	counts := []int{0, 0}
+	for track := 1; track <= d64.StandardTracks; track++ {
+		perTrack := 17
+		switch {
+		case track <= 17:
+			perTrack = 21
+		case track <= 24:
+			perTrack = 19
+		case track <= 30:
+			perTrack = 18
+		}
+		counts = append(counts, counts[track]+perTrack)
+	}
+	return counts
+}()
+
+// d64Image is an image of a 35-track disk.
+type d64Image []byte
+
+// newD64Image creates an image of an empty disk named "TEST DISK" with one
+// directory sector, and every sector outside the directory track free.
+func newD64Image() d64Image {
+	image := d64Image(make([]byte, d64.StandardImageSize))
+
+	bam := image.sector(d64.DirectoryTrack, 0)
+	bam[0x00] = d64.DirectoryTrack
+	bam[0x01] = 1
+	bam[0x02] = 'A'
+	for track := 1; track <= d64.StandardTracks; track++ {
+		if track != d64.DirectoryTrack {
+			sectors := sectorsBefore[track+1] - sectorsBefore[track]
+			bam[4*track] = byte(sectors)
+			binary.LittleEndian.PutUint32(bam[4*track+1:], 1<<sectors-1)
+		}
+	}
+	copy(bam[0x90:0xAB], bytes.Repeat([]byte{0xA0}, 0x1B))
+	copy(bam[0x90:], "TEST DISK")
+	copy(bam[0xA2:], "01")
+	copy(bam[0xA5:], "2A")
+
+	image.sector(d64.DirectoryTrack, 1)[0x01] = 0xFF
+	return image
+}
+
+func (image d64Image) sector(track, sector int) []byte {
+	offset := (sectorsBefore[track] + sector) * d64.SectorSize
+	return image[offset : offset+d64.SectorSize]
+}
+
+// setDirent fills in entry `index` of the directory, which must be in the first
+// directory sector.
+func (image d64Image) setDirent(index int, typeFlags byte, first [2]byte, name string) {
+	dirent := image.sector(d64.DirectoryTrack, 1)[index*d64.DirectoryEntrySize:]
+	dirent[0x02] = typeFlags
+	dirent[0x03] = first[0]
+	dirent[0x04] = first[1]
+	for i := 0; i < d64.MaxNameLength; i++ {
+		dirent[0x05+i] = 0xA0
+		if i < len(name) {
+			dirent[0x05+i] = name[i]
+		}
+	}
+}
+
+// writeFile writes `data` to a chain of sectors at `locations`.
+func (image d64Image) writeFile(data []byte, locations ...[2]byte) {
+	for i, location := range locations {
+		sector := image.sector(int(location[0]), int(location[1]))
+		chunk := data[i*d64.DataBytesPerSector:]
+		if i+1 < len(locations) {
+			sector[0x00] = locations[i+1][0]
+			sector[0x01] = locations[i+1][1]
+			chunk = chunk[:d64.DataBytesPerSector]
+		} else {
+			sector[0x00] = 0
+			sector[0x01] = byte(len(chunk) + 1)
+		}
+		copy(sector[0x02:], chunk)
+	}
+}
+
+var (
+	loaderProgram = []byte{0x01, 0x08, 0x0B, 0x08, 0x0A, 0x00, 0x9E, '2', '0', '6', '1', 0x00}
+	storyText     = bytes.Repeat([]byte("ONCE UPON A TIME\r"), 40)
+)
+
+// makeD64Image creates a disk with these files:
+//
+//	LOADER         program of 12 bytes
+//	(scratched)
+//	STORY          locked sequential file of 680 bytes, over three zones
+//	A/B%           empty user file with characters that must be escaped
+func makeD64Image() d64Image {
+	image := newD64Image()
+
+	image.setDirent(0, d64.FileTypeProgram|d64.FlagClosed, [2]byte{17, 0}, "LOADER")
+	image.writeFile(loaderProgram, [2]byte{17, 0})
+
+	image.setDirent(2, d64.FileTypeSequential|d64.FlagClosed|d64.FlagLocked, [2]byte{17, 20}, "STORY")
+	image.writeFile(storyText, [2]byte{17, 20}, [2]byte{19, 18}, [2]byte{25, 17})
+
+	image.setDirent(3, d64.FileTypeUser|d64.FlagClosed, [2]byte{0, 0}, "A/B%\x5C")
+	return image
+}
+
+func mount(t *testing.T, image []byte) (*driver.BaseDriver, disko.FileSystemImplementer) {
+	implementation := diskotest.MountImplementer(
+		t, d64.NewDriver, image, disko.MountFlagsAllowRead)
+	return driver.New(implementation, disko.MountFlagsAllowRead), implementation
+}
+
+func TestDriver__ReadFiles(t *testing.T) {
+	image := makeD64Image()
+	assert.True(t, d64.Detect(bytes.NewReader(image), int64(len(image))))
+	fs, implementation := mount(t, image)
+
+	entries, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"LOADER", "STORY", "A%2FB%25%5C"}, names)
+
+	data, err := fs.ReadFile("/LOADER")
+	require.NoError(t, err)
+	assert.Equal(t, loaderProgram, data)
+
+	data, err = fs.ReadFile("/STORY")
+	require.NoError(t, err)
+	assert.Equal(t, storyText, data)
+
+	data, err = fs.ReadFile("/A%2FB%25%5C")
+	require.NoError(t, err)
+	assert.Empty(t, data)
+
+	stat, err := fs.Stat("/STORY")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o444), stat.ModeFlags)
+	assert.EqualValues(t, len(storyText), stat.Size)
+
+	fsStat := implementation.FSStat()
+	assert.EqualValues(t, 256, fsStat.BlockSize)
+	assert.EqualValues(t, 683, fsStat.TotalBlocks)
+	assert.EqualValues(t, 664, fsStat.BlocksFree)
+	assert.EqualValues(t, 3, fsStat.Files)
+	assert.EqualValues(t, 141, fsStat.FilesFree)
+}
+
+func TestDriver__ErrorBytes(t *testing.T) {
+	image := append(makeD64Image(), make([]byte, 683)...)
+	assert.True(t, d64.Detect(bytes.NewReader(image), int64(len(image))))
+
+	fs, _ := mount(t, image)
+	data, err := fs.ReadFile("/STORY")
+	require.NoError(t, err)
+	assert.Equal(t, storyText, data)
+}
+
+func TestDriver__SectorOutsideTrack(t *testing.T) {
+	image := makeD64Image()
+	// Track 25 only has 18 sectors.
+	image.sector(19, 18)[0x01] = 18
+
+	implementation, err := d64.NewDriver(bytesextra.NewReadWriteSeeker(image))
+	require.NoError(t, err)
+	err = implementation.Mount(disko.MountFlagsAllowRead)
+	assert.ErrorIs(t, err, disko.ErrFileSystemCorrupted)
+	assert.ErrorContains(t, err, "STORY: sector 2 is at T25 S18, which isn't on the disk")
+}
+
+func TestDriver__ChainCycle(t *testing.T) {
+	image := makeD64Image()
+	image.sector(25, 17)[0x00] = 17
+	image.sector(25, 17)[0x01] = 20
+
+	implementation, err := d64.NewDriver(bytesextra.NewReadWriteSeeker(image))
+	require.NoError(t, err)
+	err = implementation.Mount(disko.MountFlagsAllowRead)
+	assert.ErrorIs(t, err, disko.ErrFileSystemCorrupted)
+	assert.ErrorContains(t, err, "STORY: sector chain has a cycle at T17 S20")
+}
+
+func TestDescribe(t *testing.T) {
+	image := makeD64Image()
+	description, err := d64.Describe(bytes.NewReader(image), int64(len(image)))
+	require.NoError(t, err)
+	assert.Equal(t, "TEST DISK", description.Header[0].Value)
+	assert.Equal(t, "01", description.Header[1].Value)
+	assert.EqualValues(t, 35, description.Header[3].Value)
+}
+
+func TestDetect(t *testing.T) {
+	diskotest.RunDetectConformanceTests(
+		t,
+		d64.Detect,
+		makeD64Image(),
+		map[string][]byte{"image of the wrong size": append(makeD64Image(), 0)},
+	)
+}
+
+func TestDriver__Conformance(t *testing.T) {
+	diskotest.RunReadOnlyConformanceTests(t, d64.NewDriver, makeD64Image())
+}
@@ -0,0 +1,70 @@
+package d64
+
+import (
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+// Features gives the features supported by Commodore 1541 DOS.
+var Features = disko.FSFeatures{
+	DefaultNameEncoding: disko.FSTextEncodingASCII,
+	DefaultBlockSize:    SectorSize,
+	MinTotalBlocks:      StandardImageSize / SectorSize,
+	MaxTotalBlocks:      ExtendedImageSize / SectorSize,
+	// A file can use every sector of an extended disk outside the directory
+	// track.
+	MaxFileSize: (ExtendedImageSize/SectorSize - 19) * DataBytesPerSector,
+}
+
+func init() {
+	disko.RegisterFileSystem(
+		disko.FileSystemRegistration{
+			Name:        "d64",
+			Description: "Commodore 1541 DOS (D64 image)",
+			Features:    Features,
+			Detect:      Detect,
+			Describe:    Describe,
+			New:         NewDriver,
+		},
+	)
+}
+
+// Detect returns true if `image` appears to be a D64 image. It implements the
+// detection function for [disko.FileSystemRegistration].
+//
+// The image must be one of the sizes a D64 image can be, the BAM must give the
+// format written by a 1541, and the directory must be readable.
+func Detect(image io.ReaderAt, size int64) bool {
+	bam, geometry, err := readBAM(image, size)
+	if err != nil || string(bam.DOSType[:]) != dosType {
+		return false
+	}
+	_, err = readDirectory(image, geometry)
+	return err == nil
+}
+
+// Describe decodes the BAM of an image, and counts the files in the directory.
+// It implements the description function for [disko.FileSystemRegistration].
+func Describe(image io.ReaderAt, size int64) (disko.ImageDescription, disko.DriverError) {
+	bam, geometry, err := readBAM(image, size)
+	if err != nil {
+		return disko.ImageDescription{}, err
+	}
+	dirents, err := readDirectory(image, geometry)
+	if err != nil {
+		return disko.ImageDescription{}, err
+	}
+
+	return disko.ImageDescription{
+		Stat: statFileSystem(bam, geometry, len(dirents)),
+		Header: []disko.HeaderField{
+			{Name: "Disk name", Value: bam.DiskNameString()},
+			{Name: "Disk ID", Value: convertName(bam.DiskID[:])},
+			{Name: "DOS type", Value: convertName(bam.DOSType[:])},
+			{Name: "Tracks", Value: geometry.TotalTracks()},
+			{Name: "Blocks free", Value: bam.countFree()},
+			{Name: "Files", Value: len(dirents)},
+		},
+	}, nil
+}
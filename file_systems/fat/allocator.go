@@ -0,0 +1,108 @@
+package fat
+
+import (
+	"fmt"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/common"
+)
+
+// clusterAllocator implements [disko.Allocator] on top of the driver's copy of
+// the FAT. Blocks are cluster numbers, starting from 2.
+type clusterAllocator struct {
+	driver *Driver
+}
+
+// GetAllocator implements [disko.AllocatorImplementer].
+func (driver *Driver) GetAllocator() disko.Allocator {
+	return clusterAllocator{driver: driver}
+}
+
+// checkCluster returns an error if `block` isn't a cluster in the data area.
+func (alloc clusterAllocator) checkCluster(block common.PhysicalBlock) disko.DriverError {
+	if block < 2 || uint64(block) >= uint64(alloc.driver.bootSector.TotalClusters)+2 {
+		return disko.ErrArgumentOutOfRange.WithMessage(
+			fmt.Sprintf(
+				"cluster %d isn't in the range [2, %d)",
+				block,
+				alloc.driver.bootSector.TotalClusters+2,
+			),
+		)
+	}
+	return nil
+}
+
+// Allocate implements [disko.Allocator]. Each newly allocated cluster is marked
+// as a chain of its own.
+func (alloc clusterAllocator) Allocate(count uint) ([]common.PhysicalBlock, disko.DriverError) {
+	driver := alloc.driver
+	version := driver.bootSector.FATVersion
+
+	blocks := make([]common.PhysicalBlock, 0, count)
+	for cluster := uint(2); cluster < driver.bootSector.TotalClusters+2; cluster++ {
+		if uint(len(blocks)) == count {
+			break
+		} else if fatEntry(driver.fat, version, cluster) == 0 {
+			blocks = append(blocks, common.PhysicalBlock(cluster))
+		}
+	}
+	if uint(len(blocks)) < count {
+		return nil, disko.ErrNoSpaceOnDevice.WithMessage(
+			fmt.Sprintf("can't allocate %d clusters, only %d are free", count, len(blocks)))
+	}
+
+	for _, block := range blocks {
+		setFATEntry(driver.fat, version, uint(block), driver.endOfChainMarker())
+	}
+	if len(blocks) > 0 {
+		driver.fatDirty = true
+	}
+	return blocks, nil
+}
+
+// Free implements [disko.Allocator]. Clusters marked as bad can't be freed.
+func (alloc clusterAllocator) Free(blocks []common.PhysicalBlock) disko.DriverError {
+	driver := alloc.driver
+	version := driver.bootSector.FATVersion
+
+	seen := make(map[common.PhysicalBlock]struct{}, len(blocks))
+	for _, block := range blocks {
+		if err := alloc.checkCluster(block); err != nil {
+			return err
+		}
+
+		entry := fatEntry(driver.fat, version, uint(block))
+		if entry == 0 {
+			return disko.ErrInvalidArgument.WithMessage(
+				fmt.Sprintf("cluster %d is already free", block))
+		} else if entry == badClusterMarker(version) {
+			return disko.ErrInvalidArgument.WithMessage(
+				fmt.Sprintf("cluster %d is marked bad and can't be freed", block))
+		} else if _, duplicate := seen[block]; duplicate {
+			return disko.ErrInvalidArgument.WithMessage(
+				fmt.Sprintf("cluster %d is listed more than once", block))
+		}
+		seen[block] = struct{}{}
+	}
+
+	for _, block := range blocks {
+		setFATEntry(driver.fat, version, uint(block), 0)
+	}
+	if len(blocks) > 0 {
+		driver.fatDirty = true
+	}
+	return nil
+}
+
+// FreeCount implements [disko.Allocator].
+func (alloc clusterAllocator) FreeCount() uint64 {
+	return alloc.driver.FSStat().BlocksFree
+}
+
+// IsAllocated implements [disko.Allocator]. Bad clusters count as allocated.
+func (alloc clusterAllocator) IsAllocated(block common.PhysicalBlock) (bool, disko.DriverError) {
+	if err := alloc.checkCluster(block); err != nil {
+		return false, err
+	}
+	return fatEntry(alloc.driver.fat, alloc.driver.bootSector.FATVersion, uint(block)) != 0, nil
+}
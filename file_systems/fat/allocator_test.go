@@ -0,0 +1,58 @@
+package fat_test
+
+import (
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocator__AllocateAndFree(t *testing.T) {
+	fs, implementation := mountFloppy(t, makeFloppyImage())
+	alloc := implementation.(disko.AllocatorImplementer).GetAllocator()
+	initialFree := alloc.FreeCount()
+
+	blocks, err := alloc.Allocate(3)
+	require.NoError(t, err)
+	require.Len(t, blocks, 3)
+	assert.Less(t, blocks[0], blocks[1])
+	assert.Less(t, blocks[1], blocks[2])
+	assert.Equal(t, initialFree-3, alloc.FreeCount())
+
+	// Files created afterwards don't get the allocated clusters.
+	require.NoError(t, fs.WriteFile("/FILE.TXT", []byte("hello"), 0o644))
+	assert.Equal(t, initialFree-4, alloc.FreeCount())
+
+	require.NoError(t, alloc.Free(blocks))
+	assert.Equal(t, initialFree-1, alloc.FreeCount())
+	for _, block := range blocks {
+		isAllocated, err := alloc.IsAllocated(block)
+		require.NoError(t, err)
+		assert.False(t, isAllocated, "cluster %d", block)
+	}
+
+	contents, readErr := fs.ReadFile("/FILE.TXT")
+	require.NoError(t, readErr)
+	assert.Equal(t, []byte("hello"), contents)
+}
+
+func TestAllocator__FreeInvalid(t *testing.T) {
+	_, implementation := mountFloppy(t, makeFloppyImage())
+	alloc := implementation.(disko.AllocatorImplementer).GetAllocator()
+
+	blocks, err := alloc.Allocate(2)
+	require.NoError(t, err)
+
+	err = alloc.Free([]common.PhysicalBlock{blocks[0], blocks[1], blocks[0]})
+	assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+	assert.ErrorContains(t, err, "listed more than once")
+	assert.ErrorIs(t, alloc.Free([]common.PhysicalBlock{100}), disko.ErrInvalidArgument)
+	assert.ErrorIs(t, alloc.Free([]common.PhysicalBlock{1}), disko.ErrArgumentOutOfRange)
+	assert.ErrorIs(t, alloc.Free([]common.PhysicalBlock{2849}), disko.ErrArgumentOutOfRange)
+
+	isAllocated, err := alloc.IsAllocated(blocks[0])
+	require.NoError(t, err)
+	assert.True(t, isAllocated, "failed Free() freed some clusters anyway")
+}
@@ -0,0 +1,109 @@
+package fat
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/utilities/binstruct"
+)
+
+// atariSTExecutableChecksum is the value the big-endian words of a boot sector
+// must add up to for TOS to execute it.
+const atariSTExecutableChecksum = 0x1234
+
+// atariSTBootCodeOffset is where boot code begins in an executable Atari ST
+// boot sector, immediately after the BPB and the TOS loader fields.
+const atariSTBootCodeOffset = 0x1E
+
+// AtariSTBootChecksum returns the sum of the first 256 big-endian words of a
+// boot sector. TOS executes the boot sector if this is 0x1234.
+func AtariSTBootChecksum(sector []byte) uint16 {
+	sum := uint16(0)
+	for offset := 0; offset+1 < 512 && offset+1 < len(sector); offset += 2 {
+		sum += binary.BigEndian.Uint16(sector[offset:])
+	}
+	return sum
+}
+
+// IsAtariSTBootSectorExecutable returns true if TOS would execute the boot
+// sector.
+func IsAtariSTBootSectorExecutable(sector []byte) bool {
+	return AtariSTBootChecksum(sector) == atariSTExecutableChecksum
+}
+
+// LooksLikeAtariSTBootSector returns true if the boot sector appears to have
+// been written by TOS rather than DOS: it's either executable or begins with a
+// 68000 short branch.
+func LooksLikeAtariSTBootSector(sector []byte) bool {
+	return len(sector) >= 512 &&
+		(sector[0] == 0x60 || IsAtariSTBootSectorExecutable(sector))
+}
+
+// AtariSTSerialNumber returns the 24-bit serial number of an Atari ST boot
+// sector. Unlike the volume ID of DOS disks, it's stored in the OEM name area.
+func AtariSTSerialNumber(sector []byte) uint32 {
+	return uint32(sector[8]) | uint32(sector[9])<<8 | uint32(sector[10])<<16
+}
+
+// SetAtariSTBootChecksum changes the last word of a boot sector so that TOS
+// will execute it if `executable` is true, or ignore it if false.
+func SetAtariSTBootChecksum(sector []byte, executable bool) {
+	binary.BigEndian.PutUint16(sector[510:], 0)
+	remainder := atariSTExecutableChecksum - AtariSTBootChecksum(sector)
+	if !executable {
+		// Anything but the executable checksum will do.
+		remainder++
+	}
+	binary.BigEndian.PutUint16(sector[510:], remainder)
+}
+
+// NewAtariSTBootSector creates a 512-byte boot sector that TOS accepts.
+//
+// The JmpBoot field of `bpb` is ignored, and only the first six bytes of its
+// OEMName are used, since on the ST the last three hold the serial number. If
+// `bootCode` is given, the boot sector branches to it and is made executable;
+// otherwise, it's marked as not executable.
+func NewAtariSTBootSector(
+	bpb RawFATBootSectorWithBPB,
+	serialNumber uint32,
+	bootCode []byte,
+) ([]byte, error) {
+	if serialNumber > 0xFFFFFF {
+		return nil, disko.ErrArgumentOutOfRange.WithMessage(
+			fmt.Sprintf("serial number must fit in 24 bits, got %#x", serialNumber))
+	}
+	maxCodeSize := 510 - atariSTBootCodeOffset
+	if len(bootCode) > maxCodeSize {
+		return nil, disko.ErrArgumentOutOfRange.WithMessage(
+			fmt.Sprintf(
+				"boot code can be at most %d bytes, got %d", maxCodeSize, len(bootCode)))
+	}
+
+	sector := make([]byte, 512)
+	err := binstruct.MarshalInto(sector, bpb, binary.LittleEndian)
+	if err != nil {
+		return nil, err
+	}
+
+	// The six bytes after the branch instruction are filler on the ST, and
+	// the serial number follows.
+	copy(sector[2:8], bpb.OEMName[:6])
+	sector[8] = byte(serialNumber)
+	sector[9] = byte(serialNumber >> 8)
+	sector[10] = byte(serialNumber >> 16)
+
+	if bootCode != nil {
+		// BRA.S to the boot code. The offset is relative to the end of the
+		// two-byte instruction.
+		sector[0] = 0x60
+		sector[1] = atariSTBootCodeOffset - 2
+		copy(sector[atariSTBootCodeOffset:], bootCode)
+	} else {
+		sector[0] = 0xE9
+		sector[1] = 0x00
+	}
+
+	SetAtariSTBootChecksum(sector, bootCode != nil)
+	return sector, nil
+}
@@ -0,0 +1,86 @@
+package fat_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// atariSTFloppyBPB is the BPB of a double-sided 720 KiB floppy formatted by TOS.
+var atariSTFloppyBPB = fat.RawFATBootSectorWithBPB{
+	OEMName:           [8]byte{'L', 'o', 'a', 'd', 'e', 'r'},
+	BytesPerSector:    512,
+	SectorsPerCluster: 2,
+	ReservedSectors:   1,
+	NumFATs:           2,
+	RootEntryCount:    112,
+	TotalSectors16:    1440,
+	// TOS formatters don't always write a media descriptor DOS would accept.
+	Media:           0xF7,
+	SectorsPerFAT16: 5,
+	SectorsPerTrack: 9,
+	NumHeads:        2,
+}
+
+func TestNewAtariSTBootSector__Executable(t *testing.T) {
+	bootCode := []byte{0x4E, 0x75} // RTS
+	sector, err := fat.NewAtariSTBootSector(atariSTFloppyBPB, 0xABCDEF, bootCode)
+	require.NoError(t, err)
+	require.Len(t, sector, 512)
+
+	assert.True(t, fat.IsAtariSTBootSectorExecutable(sector))
+	assert.EqualValues(t, 0x1234, fat.AtariSTBootChecksum(sector))
+	assert.EqualValues(t, 0xABCDEF, fat.AtariSTSerialNumber(sector))
+	assert.Equal(t, []byte{0x60, 0x1C}, sector[:2], "wrong branch instruction")
+	assert.Equal(t, bootCode, sector[0x1E:0x20])
+
+	bootSector, err := fat.NewFATBootSectorFromStream(bytes.NewReader(sector))
+	require.NoError(t, err)
+	assert.EqualValues(t, 0xF7, bootSector.Media)
+	assert.EqualValues(t, 1024, bootSector.BytesPerCluster)
+
+	image := make([]byte, 1440*512)
+	copy(image, sector)
+	assert.True(t, fat.Detect(bytes.NewReader(image), int64(len(image))))
+
+	description, err := fat.Describe(bytes.NewReader(image), int64(len(image)))
+	require.NoError(t, err)
+	assert.Contains(
+		t,
+		description.Header,
+		disko.HeaderField{Name: "Atari ST serial number", Value: "ABCDEF"},
+	)
+}
+
+func TestNewAtariSTBootSector__NotExecutable(t *testing.T) {
+	sector, err := fat.NewAtariSTBootSector(atariSTFloppyBPB, 1, nil)
+	require.NoError(t, err)
+	assert.False(t, fat.IsAtariSTBootSectorExecutable(sector))
+	assert.EqualValues(t, 1, fat.AtariSTSerialNumber(sector))
+
+	_, err = fat.NewAtariSTBootSector(atariSTFloppyBPB, 0x1000000, nil)
+	assert.Error(t, err, "serial number over 24 bits should be rejected")
+}
+
+func TestNewFATBootSectorFromStream__AtariSTLargeSectors(t *testing.T) {
+	bpb := atariSTFloppyBPB
+	bpb.BytesPerSector = 8192
+	bpb.TotalSectors16 = 4096
+	bpb.SectorsPerFAT16 = 1
+	sector, err := fat.NewAtariSTBootSector(bpb, 0, nil)
+	require.NoError(t, err)
+
+	_, err = fat.NewFATBootSectorFromStream(bytes.NewReader(sector))
+	assert.Error(t, err, "8 KiB sectors should be rejected without the Atari ST profile")
+
+	bootSector, err := fat.NewFATBootSectorFromStreamWithOptions(
+		bytes.NewReader(sector),
+		fat.CompatibilityOptionsFromMountFlags(fat.MountFlagsAtariST),
+	)
+	require.NoError(t, err)
+	assert.EqualValues(t, 16384, bootSector.BytesPerCluster)
+}
@@ -0,0 +1,53 @@
+package fat
+
+import "github.com/dargueta/disko"
+
+// AttributePolicy controls how the driver treats the attribute flags that have no
+// equivalent in [os.FileMode].
+//
+// The zero value is the default policy:
+//
+//   - [AttrArchived] is set whenever the contents or name of a file or directory
+//     change, i.e. on writes, truncation, creation, and renaming, the same as DOS
+//     does. Changing only the mode or timestamps doesn't set it. The driver never
+//     clears it; that's up to whatever backup tool uses it.
+//   - Directory entries with [AttrHidden] or [AttrSystem] set are included in
+//     directory listings like any other file.
+//
+// Hidden files can always be accessed by path, regardless of the policy.
+type AttributePolicy struct {
+	// PreserveArchiveBit stops the driver from setting [AttrArchived] when a file is
+	// modified. Use this when the archive bits on an image need to be kept exactly
+	// as they were, e.g. to let a backup program on the emulated system decide what
+	// to back up.
+	PreserveArchiveBit bool
+
+	// HideHiddenFiles omits directory entries with [AttrHidden] or [AttrSystem] set
+	// from directory listings, the way DOS's DIR command does.
+	HideHiddenFiles bool
+}
+
+// AttributePolicyFromMountFlags returns the attribute policy selected by the
+// FAT-specific flags in `flags`.
+func AttributePolicyFromMountFlags(flags disko.MountFlags) AttributePolicy {
+	return AttributePolicy{
+		PreserveArchiveBit: flags&MountFlagsPreserveArchiveBit != 0,
+		HideHiddenFiles:    flags&MountFlagsHideHiddenFiles != 0,
+	}
+}
+
+// MarkModified updates the attributes of a directory entry whose contents or name
+// have changed. It must be called before the directory entry is written back.
+func (policy AttributePolicy) MarkModified(dirent *Dirent) {
+	if !policy.PreserveArchiveBit {
+		dirent.AttributeFlags |= AttrArchived
+	}
+}
+
+// IsListed determines whether `dirent` should be included in directory listings.
+func (policy AttributePolicy) IsListed(dirent *Dirent) bool {
+	if !policy.HideHiddenFiles {
+		return true
+	}
+	return dirent.AttributeFlags&(AttrHidden|AttrSystem) == 0
+}
@@ -0,0 +1,49 @@
+package fat_test
+
+import (
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttributePolicyFromMountFlags(t *testing.T) {
+	assert.Equal(
+		t,
+		fat.AttributePolicy{},
+		fat.AttributePolicyFromMountFlags(disko.MountFlagsAllowAll),
+	)
+	assert.Equal(
+		t,
+		fat.AttributePolicy{PreserveArchiveBit: true, HideHiddenFiles: true},
+		fat.AttributePolicyFromMountFlags(
+			fat.MountFlagsPreserveArchiveBit|fat.MountFlagsHideHiddenFiles),
+	)
+}
+
+func TestAttributePolicy__MarkModified(t *testing.T) {
+	dirent := fat.Dirent{AttributeFlags: fat.AttrReadOnly}
+	fat.AttributePolicy{}.MarkModified(&dirent)
+	assert.Equal(t, fat.AttrReadOnly|fat.AttrArchived, dirent.AttributeFlags)
+
+	dirent = fat.Dirent{AttributeFlags: fat.AttrReadOnly}
+	fat.AttributePolicy{PreserveArchiveBit: true}.MarkModified(&dirent)
+	assert.Equal(t, fat.AttrReadOnly, dirent.AttributeFlags)
+}
+
+func TestAttributePolicy__IsListed(t *testing.T) {
+	normal := fat.Dirent{AttributeFlags: fat.AttrArchived}
+	hidden := fat.Dirent{AttributeFlags: fat.AttrHidden}
+	system := fat.Dirent{AttributeFlags: fat.AttrSystem | fat.AttrReadOnly}
+
+	defaultPolicy := fat.AttributePolicy{}
+	assert.True(t, defaultPolicy.IsListed(&normal))
+	assert.True(t, defaultPolicy.IsListed(&hidden))
+	assert.True(t, defaultPolicy.IsListed(&system))
+
+	hidingPolicy := fat.AttributePolicy{HideHiddenFiles: true}
+	assert.True(t, hidingPolicy.IsListed(&normal))
+	assert.False(t, hidingPolicy.IsListed(&hidden))
+	assert.False(t, hidingPolicy.IsListed(&system))
+}
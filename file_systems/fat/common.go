@@ -7,6 +7,7 @@ import (
 	"io"
 
 	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/utilities/binstruct"
 )
 
 type SectorID uint32
@@ -25,13 +26,13 @@ type RawFATBootSectorWithBPB struct {
 	ReservedSectors   uint16
 	NumFATs           uint8
 	RootEntryCount    uint16
-	totalSectors16    uint16
+	TotalSectors16    uint16
 	Media             uint8
-	sectorsPerFAT16   uint16
+	SectorsPerFAT16   uint16
 	SectorsPerTrack   uint16
 	NumHeads          uint16
 	HiddenSectors     uint32
-	totalSectors32    uint32
+	TotalSectors32    uint32
 }
 
 // FATBootSector extends RawFATBootSectorWithBPB with precomputed fields useful in other
@@ -47,6 +48,18 @@ type FATBootSector struct {
 	FirstDataSector   SectorID
 	FATVersion        int
 	DirentsPerCluster int
+	// BPBInferred is true if the image has no BPB, and the fields above were
+	// inferred from its media descriptor instead. See [InferDOS1BootSector].
+	BPBInferred bool
+}
+
+// totalSectors returns the size of the file system in sectors, from whichever
+// field of the BPB has it.
+func (bootSector *FATBootSector) totalSectors() uint {
+	if bootSector.TotalSectors16 != 0 {
+		return uint(bootSector.TotalSectors16)
+	}
+	return uint(bootSector.TotalSectors32)
 }
 
 // DetermineFATVersion determines the version of the FAT file system based on the number
@@ -63,15 +76,50 @@ func DetermineFATVersion(totalClusters uint) int {
 	return 32
 }
 
+// CompatibilityOptions relaxes the validation of the boot sector, to allow
+// reading variants of FAT that don't follow Microsoft's specification.
+type CompatibilityOptions struct {
+	// AllowSmallSectors permits 128- and 256-byte logical sectors, as used by
+	// MSX-DOS and some early DOS variants.
+	AllowSmallSectors bool
+
+	// AtariST permits logical sectors of up to 8192 bytes, which TOS uses for
+	// large partitions. See also [NewAtariSTBootSector].
+	AtariST bool
+
+	// MSXDOS uses the layout MSX-DOS 1 would if the BPB is invalid or its
+	// media descriptor doesn't match the FAT's. See [InferMSXDOSBootSector].
+	MSXDOS bool
+}
+
+// CompatibilityOptionsFromMountFlags returns the compatibility options enabled
+// by FAT-specific bits in `flags`.
+func CompatibilityOptionsFromMountFlags(flags disko.MountFlags) CompatibilityOptions {
+	return CompatibilityOptions{
+		AllowSmallSectors: flags&MountFlagsAllowSmallSectors != 0,
+		AtariST:           flags&MountFlagsAtariST != 0,
+		MSXDOS:            flags&MountFlagsMSXDOS != 0,
+	}
+}
+
 // NewFATBootSectorFromStream reads the first 40 bytes of a disk image and returns a
 // structure with detailed information on the file system.
 //
 // If an error occurs, it returns nil and an error object. There are no guarantees on
 // the position of stream pointer in this case.
 func NewFATBootSectorFromStream(reader io.Reader) (*FATBootSector, error) {
+	return NewFATBootSectorFromStreamWithOptions(reader, CompatibilityOptions{})
+}
+
+// NewFATBootSectorFromStreamWithOptions behaves like [NewFATBootSectorFromStream]
+// but allows relaxing some of the checks on the boot sector.
+func NewFATBootSectorFromStreamWithOptions(
+	reader io.Reader,
+	options CompatibilityOptions,
+) (*FATBootSector, error) {
 	rawHeader := RawFATBootSectorWithBPB{}
 
-	err := binary.Read(reader, binary.LittleEndian, &rawHeader)
+	err := binstruct.Read(reader, binary.LittleEndian, &rawHeader)
 	if err != nil {
 		return nil, disko.ErrIOFailed.Wrap(err)
 	}
@@ -81,36 +129,38 @@ func NewFATBootSectorFromStream(reader io.Reader) (*FATBootSector, error) {
 	if err != nil {
 		return nil, disko.ErrIOFailed.Wrap(err)
 	}
+	return newFATBootSector(rawHeader, sectorsPerFAT32, options)
+}
 
-	var sectorsPerFAT uint
-	if rawHeader.sectorsPerFAT16 != 0 {
-		sectorsPerFAT = uint(rawHeader.sectorsPerFAT16)
-	} else {
-		sectorsPerFAT = uint(sectorsPerFAT32)
-	}
-
-	var totalSectors uint
-	if rawHeader.totalSectors16 != 0 {
-		totalSectors = uint(rawHeader.totalSectors16)
-	} else {
-		totalSectors = uint(rawHeader.totalSectors32)
-	}
-
-	// The number of sectors taken up by the root directory. On FAT32 systems, this will
-	// be 0.
-	rootDirSectors := uint(
-		((rawHeader.RootEntryCount * 32) + (rawHeader.BytesPerSector - 1)) / rawHeader.BytesPerSector)
-
-	totalFATSectors := uint(rawHeader.NumFATs) * sectorsPerFAT
-	dataSectors := totalSectors - uint(rawHeader.ReservedSectors) + totalFATSectors + uint(rootDirSectors)
-	totalClusters := dataSectors / uint(rawHeader.SectorsPerCluster)
+// newFATBootSector validates a BPB and computes the derived fields of the boot
+// sector from it.
+func newFATBootSector(
+	rawHeader RawFATBootSectorWithBPB,
+	sectorsPerFAT32 uint32,
+	options CompatibilityOptions,
+) (*FATBootSector, error) {
 
-	// BytesPerSector must be 512, 1024, 2048, or 4096.
+	// BytesPerSector must be 512, 1024, 2048, or 4096. 128 and 256 are only
+	// allowed if the caller asked for them.
 	switch rawHeader.BytesPerSector {
 	case 512:
 	case 1024:
 	case 2048:
 	case 4096:
+	case 128, 256:
+		if !options.AllowSmallSectors {
+			message := fmt.Sprintf(
+				"BytesPerSector of %d is only valid with small sector support enabled",
+				rawHeader.BytesPerSector)
+			return nil, disko.ErrNotSupported.WithMessage(message)
+		}
+	case 8192:
+		if !options.AtariST {
+			message := fmt.Sprintf(
+				"BytesPerSector of %d is only valid for Atari ST file systems",
+				rawHeader.BytesPerSector)
+			return nil, disko.ErrNotSupported.WithMessage(message)
+		}
 	default:
 		message := fmt.Sprintf(
 			"corruption detected: BytesPerSector must be 512, 1024, 2048, or 4096, got %d",
@@ -135,6 +185,41 @@ func NewFATBootSectorFromStream(reader io.Reader) (*FATBootSector, error) {
 		return nil, disko.ErrFileSystemCorrupted.WithMessage(message)
 	}
 
+	var sectorsPerFAT uint
+	if rawHeader.SectorsPerFAT16 != 0 {
+		sectorsPerFAT = uint(rawHeader.SectorsPerFAT16)
+	} else {
+		sectorsPerFAT = uint(sectorsPerFAT32)
+	}
+
+	var totalSectors uint
+	if rawHeader.TotalSectors16 != 0 {
+		totalSectors = uint(rawHeader.TotalSectors16)
+	} else {
+		totalSectors = uint(rawHeader.TotalSectors32)
+	}
+
+	// The number of sectors taken up by the root directory. On FAT32 systems, this will
+	// be 0.
+	bytesPerSector := uint(rawHeader.BytesPerSector)
+	rootDirSectors := ((uint(rawHeader.RootEntryCount) * 32) + (bytesPerSector - 1)) / bytesPerSector
+
+	totalFATSectors := uint(rawHeader.NumFATs) * sectorsPerFAT
+	firstDataSector := uint(rawHeader.ReservedSectors) + totalFATSectors + rootDirSectors
+	if rawHeader.NumFATs == 0 || sectorsPerFAT == 0 || firstDataSector >= totalSectors {
+		message := fmt.Sprintf(
+			"corruption detected: %d FAT(s) of %d sectors and %d reserved sectors"+
+				" don't fit in a volume of %d sectors",
+			rawHeader.NumFATs,
+			sectorsPerFAT,
+			rawHeader.ReservedSectors,
+			totalSectors)
+		return nil, disko.ErrFileSystemCorrupted.WithMessage(message)
+	}
+
+	dataSectors := totalSectors - firstDataSector
+	totalClusters := dataSectors / uint(rawHeader.SectorsPerCluster)
+
 	fatVersion := DetermineFATVersion(totalClusters)
 	if fatVersion == 32 && rootDirSectors != 0 {
 		message := fmt.Sprintf(
@@ -163,21 +248,21 @@ func NewFATBootSectorFromStream(reader io.Reader) (*FATBootSector, error) {
 			ReservedSectors:   rawHeader.ReservedSectors,
 			NumFATs:           rawHeader.NumFATs,
 			RootEntryCount:    rawHeader.RootEntryCount,
-			totalSectors16:    rawHeader.totalSectors16,
+			TotalSectors16:    rawHeader.TotalSectors16,
 			Media:             rawHeader.Media,
-			sectorsPerFAT16:   rawHeader.sectorsPerFAT16,
+			SectorsPerFAT16:   rawHeader.SectorsPerFAT16,
 			SectorsPerTrack:   rawHeader.SectorsPerTrack,
 			NumHeads:          rawHeader.NumHeads,
 			HiddenSectors:     rawHeader.HiddenSectors,
-			totalSectors32:    rawHeader.totalSectors32,
+			TotalSectors32:    rawHeader.TotalSectors32,
 		},
 		SectorsPerFAT:     sectorsPerFAT,
 		TotalFATSectors:   totalFATSectors,
 		RootDirSectors:    rootDirSectors,
 		BytesPerCluster:   bytesPerCluster,
 		TotalClusters:     totalClusters,
-		TotalDataSectors:  totalSectors - (uint(rawHeader.ReservedSectors) + totalFATSectors + rootDirSectors),
-		FirstDataSector:   SectorID(uint(rawHeader.ReservedSectors) + rootDirSectors),
+		TotalDataSectors:  dataSectors,
+		FirstDataSector:   SectorID(firstDataSector),
 		FATVersion:        fatVersion,
 		DirentsPerCluster: int(bytesPerCluster) / DirentSize,
 	}
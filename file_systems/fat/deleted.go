@@ -0,0 +1,209 @@
+package fat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dargueta/disko"
+)
+
+// DeletedViewName is the name of the virtual directory added by
+// [MountFlagsShowDeleted]. It can't clash with a real object, since it isn't a
+// valid 8.3 name.
+const DeletedViewName = ".deleted"
+
+// recoveredName returns the name of a deleted object as far as it can be
+// recovered. The first character of the name is taken from CreatedTimeMillis
+// like [NewDirentFromRaw] does, and replaced with an underscore if it isn't
+// allowed in a file name.
+func recoveredName(name string) string {
+	if name[0] == ' ' || !isValidNameByte(name[0]) {
+		return "_" + name[1:]
+	}
+	return name
+}
+
+// contiguousChain returns the clusters a deleted object would occupy if it were
+// stored contiguously beginning at `first`, which is the only assumption that
+// can be made once its chain has been freed. `recoverable` is true if none of
+// them have been reallocated since.
+func (driver *Driver) contiguousChain(first uint, count uint) (chain []uint, recoverable bool) {
+	bootSector := driver.bootSector
+	if first == 0 || count == 0 {
+		return nil, true
+	}
+
+	recoverable = true
+	for cluster := first; cluster < first+count; cluster++ {
+		if cluster < 2 || cluster >= bootSector.TotalClusters+2 {
+			return chain, false
+		} else if fatEntry(driver.fat, bootSector.FATVersion, cluster) != 0 {
+			recoverable = false
+		}
+		chain = append(chain, cluster)
+	}
+	return chain, recoverable
+}
+
+// deletedClusterCount returns the number of clusters a deleted object used.
+// Directories don't record their size, so only their first cluster is assumed
+// to be recoverable.
+func (driver *Driver) deletedClusterCount(raw *RawDirent) uint {
+	if raw.AttributeFlags&AttrDirectory != 0 {
+		return 1
+	}
+	bytesPerCluster := driver.bootSector.BytesPerCluster
+	return (uint(raw.FileSize) + bytesPerCluster - 1) / bytesPerCluster
+}
+
+// deletedEntries returns the deleted files and directories in this directory,
+// in the order they appear on disk. Names are made unique by appending "~N" to
+// duplicates, since deleted entries often only differ in the lost character.
+func (handle *objectHandle) deletedEntries() ([]directoryEntry, disko.DriverError) {
+	data, err := handle.readAll()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []directoryEntry{}
+	seen := map[string]int{}
+	for index := 0; (index+1)*DirentSize <= len(data); index++ {
+		raw, rawErr := NewRawDirentFromBytes(data[index*DirentSize:])
+		if rawErr != nil {
+			return nil, disko.CastToDriverError(rawErr)
+		}
+
+		if raw.Name[0] == 0 {
+			break
+		} else if raw.Name[0] != 0xE5 ||
+			raw.AttributeFlags&0x0F == 0x0F ||
+			raw.AttributeFlags&AttrVolumeLabel != 0 {
+			continue
+		}
+
+		dirent, direntErr := NewDirentFromRaw(handle.driver.bootSector, &raw)
+		if direntErr != nil {
+			return nil, disko.CastToDriverError(direntErr)
+		}
+
+		name := recoveredName(dirent.Name())
+		seen[name]++
+		if seen[name] > 1 {
+			name = fmt.Sprintf("%s~%d", name, seen[name])
+		}
+
+		first := uint(raw.FirstClusterLow)
+		if handle.driver.bootSector.FATVersion == 32 {
+			first |= uint(raw.FirstClusterHigh) << 16
+		}
+		_, recoverable := handle.driver.contiguousChain(
+			first, handle.driver.deletedClusterCount(&raw))
+
+		entries = append(
+			entries,
+			directoryEntry{index: index, raw: raw, name: name, recoverable: recoverable},
+		)
+	}
+	return entries, nil
+}
+
+// ListDeletedObjects implements [disko.DeletedObjectsImplementer].
+//
+// FAT doesn't record when an object was deleted, so DeletedAt is always
+// [disko.UndefinedTimestamp]. Deleting a file frees its whole cluster chain, so
+// an object is considered recoverable if the clusters it would occupy if it
+// were stored contiguously are still free.
+func (driver *Driver) ListDeletedObjects(
+	directory disko.ObjectHandle,
+) ([]disko.DeletedObject, disko.DriverError) {
+	parent, err := asDirectory(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := parent.deletedEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := make([]disko.DeletedObject, 0, len(entries))
+	for _, entry := range entries {
+		object := parent.deletedChild(entry)
+		deleted = append(
+			deleted,
+			disko.DeletedObject{
+				Name:        entry.name,
+				Stat:        object.Stat(),
+				Recoverable: entry.recoverable,
+			},
+		)
+	}
+	return deleted, nil
+}
+
+// deletedView returns the handle for the [DeletedViewName] directory inside
+// this one.
+func (handle *objectHandle) deletedView() *objectHandle {
+	return &objectHandle{
+		driver:        handle.driver,
+		parent:        handle,
+		name:          DeletedViewName,
+		isDeletedView: true,
+	}
+}
+
+// deletedChild returns a handle for a deleted entry of this directory.
+func (handle *objectHandle) deletedChild(entry directoryEntry) *objectHandle {
+	return &objectHandle{
+		driver:      handle.driver,
+		parent:      handle,
+		direntIndex: entry.index,
+		raw:         entry.raw,
+		name:        entry.name,
+		isDeleted:   true,
+	}
+}
+
+// listDeletedView implements [objectHandle.ListDir] for a [DeletedViewName]
+// directory. Only recoverable objects are listed.
+func (handle *objectHandle) listDeletedView() ([]string, disko.DriverError) {
+	entries, err := handle.parent.deletedEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if entry.recoverable {
+			names = append(names, entry.name)
+		}
+	}
+	return names, nil
+}
+
+// getInDeletedView implements [Driver.GetObject] for a [DeletedViewName]
+// directory.
+func (handle *objectHandle) getInDeletedView(name string) (disko.ObjectHandle, disko.DriverError) {
+	entries, err := handle.parent.deletedEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.recoverable && strings.EqualFold(entry.name, name) {
+			return handle.parent.deletedChild(entry), nil
+		}
+	}
+	return nil, disko.ErrNotFound.WithMessage(
+		fmt.Sprintf("no recoverable object named %q", name))
+}
+
+// checkWritable fails with [disko.ErrReadOnlyFileSystem] if the object is in a
+// [DeletedViewName] directory, or is the directory itself.
+func (handle *objectHandle) checkWritable() disko.DriverError {
+	if handle.isDeletedView || handle.isDeleted {
+		return disko.ErrReadOnlyFileSystem.WithMessage(
+			fmt.Sprintf("%q is a deleted object and can't be modified", handle.name))
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package fat_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xaionaro-go/bytesextra"
+)
+
+// mountShowingDeleted mounts `image` read-only with [fat.MountFlagsShowDeleted].
+func mountShowingDeleted(t *testing.T, image []byte) *driver.BaseDriver {
+	flags := disko.MountFlagsAllowRead | fat.MountFlagsShowDeleted
+	implementation, err := fat.NewDriver(bytesextra.NewReadWriteSeeker(image))
+	require.NoError(t, err)
+	require.NoError(t, implementation.Mount(flags))
+	return driver.New(implementation, flags)
+}
+
+func TestShowDeleted__RecoverFile(t *testing.T) {
+	image := makeFloppyImage()
+	fs, implementation := mountFloppy(t, image)
+
+	contents := bytes.Repeat([]byte("deleted!"), 100)
+	require.NoError(t, fs.WriteFile("/file.txt", contents, 0o644))
+	require.NoError(t, fs.WriteFile("/keep.txt", []byte("kept"), 0o644))
+	require.NoError(t, fs.Remove("/file.txt"))
+	require.NoError(t, fs.Flush())
+	require.NoError(t, implementation.Unmount())
+
+	fs = mountShowingDeleted(t, image)
+	entries, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "KEEP.TXT", entries[0].Name())
+	assert.Equal(t, fat.DeletedViewName, entries[1].Name())
+	assert.True(t, entries[1].IsDir())
+
+	deleted, err := fs.ListDeleted("/")
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, "FILE.TXT", deleted[0].Name)
+	assert.True(t, deleted[0].Recoverable)
+	assert.True(t, deleted[0].Stat.DeletedAt.Equal(disko.UndefinedTimestamp))
+
+	data, err := fs.ReadFile("/.deleted/FILE.TXT")
+	require.NoError(t, err)
+	assert.Equal(t, contents, data)
+
+	_, err = fs.Stat("/.deleted/KEEP.TXT")
+	assert.ErrorIs(t, err, disko.ErrNotFound)
+}
+
+func TestShowDeleted__OverwrittenIsHidden(t *testing.T) {
+	image := makeFloppyImage()
+	fs, implementation := mountFloppy(t, image)
+
+	require.NoError(t, fs.Mkdir("/dir", 0o755))
+	require.NoError(t, fs.WriteFile("/dir/old.txt", []byte("old"), 0o644))
+	require.NoError(t, fs.Remove("/dir/old.txt"))
+	// Reuses the cluster the deleted file was in, but not its directory entry.
+	require.NoError(t, fs.WriteFile("/new.txt", []byte("new"), 0o644))
+	require.NoError(t, fs.Flush())
+	require.NoError(t, implementation.Unmount())
+
+	fs = mountShowingDeleted(t, image)
+	deleted, err := fs.ListDeleted("/dir")
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, "OLD.TXT", deleted[0].Name)
+	assert.False(t, deleted[0].Recoverable)
+
+	entries, err := fs.ReadDir("/dir")
+	require.NoError(t, err)
+	assert.Empty(t, entries, "no recoverable objects, so no view should be shown")
+}
+
+func TestShowDeleted__RequiresReadOnly(t *testing.T) {
+	implementation, err := fat.NewDriver(bytesextra.NewReadWriteSeeker(makeFloppyImage()))
+	require.NoError(t, err)
+
+	err = implementation.Mount(disko.MountFlagsAllowAll | fat.MountFlagsShowDeleted)
+	assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+}
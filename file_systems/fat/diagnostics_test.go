@@ -0,0 +1,59 @@
+package fat_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dargueta/disko"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDriver__DiagnosticsForChangedValues(t *testing.T) {
+	fs, _ := mountFloppy(t, makeFloppyImage())
+	assert.Empty(t, fs.Diagnostics())
+
+	require.NoError(t, fs.WriteFile("/readme.txt", []byte("asdf"), 0o644))
+	require.NoError(t, fs.WriteFile("/OTHER.TXT", []byte("qwerty"), 0o644))
+	longAgo := time.Date(1970, time.January, 1, 0, 0, 0, 0, time.Local)
+	require.NoError(t, fs.Chtimes("/OTHER.TXT", longAgo, longAgo))
+
+	assert.Equal(
+		t,
+		[]disko.Diagnostic{
+			{
+				Kind:    disko.DiagnosticNameTransliterated,
+				Path:    "/README.TXT",
+				Message: `"readme.txt" was stored as "README.TXT"`,
+			},
+			{
+				Kind:    disko.DiagnosticTimestampClamped,
+				Path:    "/OTHER.TXT",
+				Message: longAgo.Format(time.RFC3339) + " is outside the range FAT can store, 1980 through 2107",
+			},
+		},
+		fs.Diagnostics(),
+	)
+}
+
+// If the copies of the FAT differ, the first is used and written over the
+// others.
+func TestDriver__DiagnosticsForDifferentFATs(t *testing.T) {
+	image := makeFloppyImage()
+	image[10*512+10] = 0xAB
+
+	fs, implementation := mountFloppy(t, image)
+	assert.Equal(
+		t,
+		[]disko.Diagnostic{
+			{
+				Kind:    disko.DiagnosticCopiesDiffer,
+				Message: "copy 1 of the FAT differs from the first, which is used instead",
+			},
+		},
+		fs.Diagnostics(),
+	)
+
+	require.NoError(t, implementation.Unmount())
+	assert.Equal(t, image[512:10*512], image[10*512:19*512])
+}
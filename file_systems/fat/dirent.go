@@ -2,13 +2,12 @@ package fat
 
 import (
 	"encoding/binary"
-	"errors"
 	"os"
-	"strings"
 	"syscall"
 	"time"
 
 	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/utilities/binstruct"
 )
 
 // fatEpoch is the earliest representable timestamp for the FAT file system.
@@ -93,6 +92,12 @@ type Dirent struct {
 	stat           disko.FileStat
 }
 
+// IsDeleted returns true if the directory entry belongs to a deleted file or
+// directory.
+func (d *Dirent) IsDeleted() bool {
+	return d.isDeleted
+}
+
 // GetLastAccessedAt returns the timestamp at which the directory entry was last accessed.
 func (d *Dirent) GetLastAccessedAt() time.Time {
 	return d.stat.LastAccessed
@@ -175,7 +180,7 @@ func DateFromInt(value uint16) time.Time {
 	createMonth := time.Month((value >> 5) & 0x000f)
 	createYear := int(1980 + (value >> 9))
 
-	return time.Date(createYear, createMonth, createDay, 0, 0, 0, 0, nil)
+	return time.Date(createYear, createMonth, createDay, 0, 0, 0, 0, time.Local)
 }
 
 // TimestampFromParts converts a FAT timestamp into a [time.Time] object.
@@ -192,10 +197,60 @@ func TimestampFromParts(datePart uint16, timePart uint16, hundredths uint8) time
 
 	minutes := int((timePart >> 5) & 0x003f)
 	hours := int(timePart >> 11)
-	nanoseconds := int(timePart * 10000)
+	nanoseconds := int(hundredths) * 10_000_000
 
 	return time.Date(
-		dateDt.Year(), dateDt.Month(), dateDt.Day(), hours, minutes, seconds, nanoseconds, nil)
+		dateDt.Year(), dateDt.Month(), dateDt.Day(), hours, minutes, seconds, nanoseconds, time.Local)
+}
+
+// roundTimestamp converts `t` to `resolution` using the rounding policy in
+// [Features], in the local time zone FAT timestamps are stored in. The result
+// can be passed to [TimestampToParts] without losing anything else.
+func roundTimestamp(t time.Time, resolution time.Duration) time.Time {
+	return disko.RoundTimestamp(t.In(time.Local), resolution, Features.TimestampRounding)
+}
+
+// setRawTimestamps stores timestamps in a directory entry, rounded with
+// [roundTimestamp]. Undefined timestamps are left unchanged.
+func setRawTimestamps(raw *RawDirent, createdAt, lastAccessed, lastModified time.Time) {
+	if !createdAt.Equal(disko.UndefinedTimestamp) {
+		raw.CreatedDate, raw.CreatedTime, raw.CreatedTimeMillis = TimestampToParts(
+			roundTimestamp(createdAt, Features.CreatedTimeResolution))
+	}
+	if !lastAccessed.Equal(disko.UndefinedTimestamp) {
+		raw.LastAccessedDate, _, _ = TimestampToParts(
+			roundTimestamp(lastAccessed, Features.AccessedTimeResolution))
+	}
+	if !lastModified.Equal(disko.UndefinedTimestamp) {
+		raw.LastModifiedDate, raw.LastModifiedTime, _ = TimestampToParts(
+			roundTimestamp(lastModified, Features.ModifiedTimeResolution))
+	}
+}
+
+// isTimestampOutOfRange returns true if `t` is defined and outside the range of
+// times FAT can store, so [TimestampToParts] would clamp it.
+func isTimestampOutOfRange(t time.Time) bool {
+	if t.Equal(disko.UndefinedTimestamp) {
+		return false
+	}
+	t = t.In(time.Local)
+	return t.Before(fatEpoch) || t.Year() > 2107
+}
+
+// TimestampToParts is the inverse of [TimestampFromParts]. Times before the FAT
+// epoch are clamped to it, and times after 2107 to the last time FAT can store.
+func TimestampToParts(t time.Time) (datePart uint16, timePart uint16, hundredths uint8) {
+	t = t.In(time.Local)
+	if t.Before(fatEpoch) {
+		t = fatEpoch
+	} else if t.Year() > 2107 {
+		t = time.Date(2107, time.December, 31, 23, 59, 59, 990_000_000, time.Local)
+	}
+
+	datePart = uint16(t.Year()-1980)<<9 | uint16(t.Month())<<5 | uint16(t.Day())
+	timePart = uint16(t.Hour())<<11 | uint16(t.Minute())<<5 | uint16(t.Second()/2)
+	hundredths = uint8((t.Second()%2)*100 + t.Nanosecond()/10_000_000)
+	return datePart, timePart, hundredths
 }
 
 // AttrFlagsToFileMode converts FAT attribute flags into the mode flags used by
@@ -225,22 +280,11 @@ func AttrFlagsToFileMode(flags uint8) os.FileMode {
 // NewRawDirentFromBytes deserializes 32 bytes into a RawDirent struct for further
 // processing.
 func NewRawDirentFromBytes(data []byte) (RawDirent, error) {
-	dirent := RawDirent{
-		AttributeFlags:    data[12],
-		NTReserved:        data[13],
-		CreatedTimeMillis: data[14],
-		CreatedTime:       binary.LittleEndian.Uint16(data[15:17]),
-		CreatedDate:       binary.LittleEndian.Uint16(data[17:19]),
-		LastAccessedDate:  binary.LittleEndian.Uint16(data[19:21]),
-		FirstClusterHigh:  binary.LittleEndian.Uint16(data[21:23]),
-		LastModifiedTime:  binary.LittleEndian.Uint16(data[23:25]),
-		LastModifiedDate:  binary.LittleEndian.Uint16(data[25:27]),
-		FirstClusterLow:   binary.LittleEndian.Uint16(data[27:29]),
-		FileSize:          binary.LittleEndian.Uint32(data[29:32]),
+	dirent := RawDirent{}
+	err := binstruct.Unmarshal(data, binary.LittleEndian, &dirent)
+	if err != nil {
+		return RawDirent{}, disko.ErrFileSystemCorrupted.Wrap(err)
 	}
-
-	copy(dirent.Name[:], data[:8])
-	copy(dirent.Extension[:], data[8:11])
 	return dirent, nil
 }
 
@@ -299,65 +343,20 @@ func NewDirentFromRaw(bootSector *FATBootSector, rawDirent *RawDirent) (Dirent,
 		FirstCluster:   ClusterID(firstCluster),
 	}
 
-	trimmedName := strings.TrimRight(string(rawDirent.Name[:]), " ")
-	trimmedExt := strings.TrimRight(string(rawDirent.Extension[:]), " ")
-
-	if trimmedName[0] == 0xE5 {
+	baseName := rawDirent.Name
+	if baseName[0] == nameByteDeleted {
 		// Represents a deleted file. The real first character of the filename is in
 		// CreatedTimeMillis.
-		trimmedName = string([]byte{rawDirent.CreatedTimeMillis}) + trimmedName[1:]
-	} else if trimmedName[0] == 0x05 {
-		// First character of the filename is E5.
-		trimmedName = "\xe5" + trimmedName[1:]
-	} else if trimmedName[0] == 0 {
+		baseName[0] = rawDirent.CreatedTimeMillis
+	} else if baseName[0] == nameByteFree {
 		// This directory entry is free and thus invalid.
 		return Dirent{}, disko.ErrNotFound
 	}
 
-	if trimmedExt == "" {
-		dirent.name = trimmedName
-	} else {
-		dirent.name = trimmedName + "." + trimmedExt
-	}
-
+	dirent.name = ShortNameToString(baseName, rawDirent.Extension)
 	return dirent, nil
 }
 
-// clusterToDirentSlice processes a slice of bytes the size of a full cluster into a slice
-// of directory entries.
-func (drv *FATDriver) clusterToDirentSlice(data []byte) ([]Dirent, error) {
-	allDirents := []Dirent{}
-	bootSector := drv.fs.GetBootSector()
-
-	for i := 0; i < bootSector.DirentsPerCluster; i++ {
-		offset := i * DirentSize
-		rawDirent, _ := NewRawDirentFromBytes(data[offset : offset+DirentSize])
-
-		dirent, err := NewDirentFromRaw(bootSector, &rawDirent)
-		if err != nil {
-			// If this is a DriverError there may be further action we can take.
-			drverr, ok := err.(disko.DriverError)
-			if !ok {
-				// Not a DriverError, nothing else we can do.
-				return nil, err
-			}
-
-			// If the error code is ENOENT then that means this directory entry is free
-			// and we've hit the end of the directory.
-			if errors.Is(drverr, disko.ErrNotFound) {
-				break
-			}
-			// Else: We failed for a different reason. Pass this error up to the
-			// caller.
-			return nil, err
-		}
-		// Else: Success!
-		allDirents = append(allDirents, dirent)
-	}
-
-	return allDirents, nil
-}
-
 // Dirent implementation of FileInfo -------------------------------------------
 
 // Name returns the name of the directory entry.
@@ -0,0 +1,64 @@
+package fat_test
+
+import (
+	"testing"
+
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDirentFromRaw__Deleted(t *testing.T) {
+	bootSector := fat.FATBootSector{BytesPerCluster: 512}
+	raw := fat.RawDirent{
+		Name:              [8]byte{0xE5, 'E', 'A', 'D', 'M', 'E', ' ', ' '},
+		Extension:         [3]byte{'T', 'X', 'T'},
+		CreatedTimeMillis: 'R',
+		FirstClusterLow:   2,
+		FileSize:          100,
+	}
+
+	dirent, err := fat.NewDirentFromRaw(&bootSector, &raw)
+	require.NoError(t, err)
+	assert.True(t, dirent.IsDeleted())
+	assert.Equal(t, "README.TXT", dirent.Name())
+}
+
+func TestNewDirentFromRaw__NotDeleted(t *testing.T) {
+	bootSector := fat.FATBootSector{BytesPerCluster: 512}
+	raw := fat.RawDirent{
+		Name:      [8]byte{'R', 'E', 'A', 'D', 'M', 'E', ' ', ' '},
+		Extension: [3]byte{'T', 'X', 'T'},
+	}
+
+	dirent, err := fat.NewDirentFromRaw(&bootSector, &raw)
+	require.NoError(t, err)
+	assert.False(t, dirent.IsDeleted())
+}
+
+func TestNewRawDirentFromBytes(t *testing.T) {
+	data := []byte(
+		"README  TXT\x20\x00\x64\x21\x43\x65\x87\xA9\xCB\x01\x00" +
+			"\xED\xFE\xDC\xBA\x02\x00\x78\x56\x34\x12",
+	)
+	raw, err := fat.NewRawDirentFromBytes(data)
+	require.NoError(t, err)
+
+	assert.Equal(t, fat.RawDirent{
+		Name:              [8]byte{'R', 'E', 'A', 'D', 'M', 'E', ' ', ' '},
+		Extension:         [3]byte{'T', 'X', 'T'},
+		AttributeFlags:    fat.AttrArchived,
+		CreatedTimeMillis: 100,
+		CreatedTime:       0x4321,
+		CreatedDate:       0x8765,
+		LastAccessedDate:  0xCBA9,
+		FirstClusterHigh:  1,
+		LastModifiedTime:  0xFEED,
+		LastModifiedDate:  0xBADC,
+		FirstClusterLow:   2,
+		FileSize:          0x12345678,
+	}, raw)
+
+	_, err = fat.NewRawDirentFromBytes(data[:31])
+	assert.Error(t, err)
+}
@@ -0,0 +1,126 @@
+package fat
+
+import (
+	"fmt"
+	posixpath "path"
+
+	"github.com/dargueta/disko"
+)
+
+// This file checks directory entries for attribute combinations that a valid
+// image can't have. Entries with them are skipped if the image is mounted with
+// [disko.MountFlagsLenient], and each problem is recorded as a mount warning.
+// Otherwise, reading the directory fails with [disko.ErrFileSystemCorrupted].
+
+const (
+	// attrLongName is the combination of attributes marking a long file name
+	// entry.
+	attrLongName = AttrReadOnly | AttrHidden | AttrSystem | AttrVolumeLabel
+	// attrLongNameMask gives the attributes compared with attrLongName. The
+	// other two are reserved and ignored, as in Microsoft's specification.
+	attrLongNameMask = attrLongName | AttrDirectory | AttrArchived
+	// lfnChecksumOffset is the offset in a long file name entry of the checksum
+	// of the short entry it belongs to.
+	lfnChecksumOffset = 13
+)
+
+// isLongNameEntry returns true if a directory entry with the given attributes
+// is part of a long file name.
+func isLongNameEntry(attributes uint8) bool {
+	return attributes&attrLongNameMask == attrLongName
+}
+
+// shortNameChecksum returns the checksum that the long file name entries
+// belonging to `raw` store.
+func shortNameChecksum(raw *RawDirent) uint8 {
+	sum := uint8(0)
+	for _, b := range append(raw.Name[:], raw.Extension[:]...) {
+		sum = (sum&1)<<7 + sum>>1 + b
+	}
+	return sum
+}
+
+// longNameRun is a run of long file name entries that hasn't been followed by
+// its short entry yet.
+type longNameRun struct {
+	active   bool
+	start    int
+	checksum uint8
+}
+
+// path returns the absolute path of the object, for error messages.
+func (handle *objectHandle) path() string {
+	if handle.isRoot() {
+		return "/"
+	}
+	return posixpath.Join(handle.parent.path(), handle.name)
+}
+
+// corrupted reports a problem with entry `index` of this directory. The
+// contents of deleted directories may have been overwritten, so problems in
+// them are ignored.
+func (handle *objectHandle) corrupted(problem string, index int, message string) disko.DriverError {
+	if handle.isDeleted {
+		return nil
+	}
+	return handle.driver.corrupted(
+		problem,
+		disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf("%s: entry %d: %s", handle.path(), index, message)),
+	)
+}
+
+// endLongName ends `run`, which is followed by the short entry `short`. It's a
+// problem if the run doesn't belong to that entry, or there's no short entry
+// because `short` is nil.
+func (handle *objectHandle) endLongName(run *longNameRun, short *RawDirent) disko.DriverError {
+	if !run.active {
+		return nil
+	}
+	run.active = false
+	if short != nil && shortNameChecksum(short) == run.checksum {
+		return nil
+	}
+	return handle.corrupted(
+		"long file name without a short entry",
+		run.start,
+		"long file name entries don't belong to a short entry",
+	)
+}
+
+// addLongName adds the long file name entry at `index`, whose checksum is
+// `checksum`, to `run`. A run is ended by an entry with a different checksum.
+func (handle *objectHandle) addLongName(run *longNameRun, index int, checksum uint8) disko.DriverError {
+	if run.active && run.checksum == checksum {
+		return nil
+	}
+
+	err := handle.endLongName(run, nil)
+	*run = longNameRun{active: true, start: index, checksum: checksum}
+	return err
+}
+
+// checkAttributes returns true if short entry `raw` at `index` should be
+// skipped, because it's a volume label or its attributes are invalid.
+func (handle *objectHandle) checkAttributes(index int, raw *RawDirent) (bool, disko.DriverError) {
+	attributes := raw.AttributeFlags
+	name := ShortNameToString(raw.Name, raw.Extension)
+
+	var problem, message string
+	switch {
+	case attributes&AttrReserved != 0:
+		problem = "reserved attribute bits set"
+		message = fmt.Sprintf("%q has reserved attribute bits set (0x%02x)", name, attributes)
+	case attributes&AttrVolumeLabel == 0:
+		return false, nil
+	case attributes&AttrDirectory != 0:
+		problem = "invalid attribute combination"
+		message = fmt.Sprintf("%q is marked as both a volume label and a directory", name)
+	case !handle.isRoot():
+		problem = "volume label outside the root directory"
+		message = fmt.Sprintf("%q is a volume label, but isn't in the root directory", name)
+	default:
+		return true, nil
+	}
+	return true, handle.corrupted(problem, index, message)
+}
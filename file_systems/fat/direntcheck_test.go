@@ -0,0 +1,124 @@
+package fat_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xaionaro-go/bytesextra"
+)
+
+// lfnChecksum computes the checksum of a short name that long file name
+// entries store.
+func lfnChecksum(shortName string) byte {
+	sum := byte(0)
+	for _, b := range []byte(shortName) {
+		sum = (sum&1)<<7 + sum>>1 + b
+	}
+	return sum
+}
+
+// makeImageWithBadEntries creates a floppy with these problems:
+//
+//   - /SUB/A.TXT is a volume label outside the root directory.
+//   - /SUB/B.TXT is both a volume label and a directory.
+//   - /SUB/F.TXT has a reserved attribute bit set.
+//   - If `orphan` is true, the last entry in the root directory is a long file
+//     name entry with no short entry after it.
+//
+// The root directory also has a long file name entry for D.TXT, which is fine.
+func makeImageWithBadEntries(t *testing.T, orphan bool) []byte {
+	image := makeFloppyImage()
+	fs, implementation := mountFloppy(t, image)
+	require.NoError(t, fs.Mkdir("/SUB", 0o755))
+	for _, path := range []string{"/SUB/A.TXT", "/SUB/B.TXT", "/SUB/F.TXT", "/C.TXT", "/D.TXT", "/E.TXT"} {
+		require.NoError(t, fs.WriteFile(path, []byte(path), 0o644))
+	}
+	require.NoError(t, fs.Flush())
+	require.NoError(t, implementation.Unmount())
+
+	entry := func(shortName string) []byte {
+		offset := bytes.Index(image, []byte(shortName))
+		require.GreaterOrEqual(t, offset, 0, shortName)
+		return image[offset : offset+fat.DirentSize]
+	}
+	entry("A       TXT")[11] = fat.AttrVolumeLabel
+	entry("B       TXT")[11] = fat.AttrVolumeLabel | fat.AttrDirectory
+	entry("F       TXT")[11] = fat.AttrReserved | fat.AttrArchived
+
+	longName := entry("C       TXT")
+	longName[0] = 0x41
+	longName[11] = 0x0F
+	longName[13] = lfnChecksum("D       TXT")
+
+	if orphan {
+		lastEntry := entry("E       TXT")
+		lastEntry[0] = 0x41
+		lastEntry[11] = 0x0F
+		lastEntry[13] = lfnChecksum("E       TXT")
+	}
+	return image
+}
+
+func mountWithFlags(t *testing.T, image []byte, flags disko.MountFlags) (*driver.BaseDriver, *fat.Driver) {
+	implementation, err := fat.NewDriver(bytesextra.NewReadWriteSeeker(image))
+	require.NoError(t, err)
+	require.NoError(t, implementation.Mount(flags))
+	return driver.New(implementation, flags), implementation.(*fat.Driver)
+}
+
+func TestDriver__InvalidEntriesStrict(t *testing.T) {
+	fs, _ := mountWithFlags(t, makeImageWithBadEntries(t, true), disko.MountFlagsAllowRead)
+	_, err := fs.ReadDir("/")
+	assert.ErrorIs(t, err, disko.ErrFileSystemCorrupted)
+	assert.ErrorContains(t, err, "/: entry 3: long file name entries")
+
+	fs, _ = mountWithFlags(t, makeImageWithBadEntries(t, false), disko.MountFlagsAllowRead)
+	entries, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	_, err = fs.ReadDir("/SUB")
+	assert.ErrorIs(t, err, disko.ErrFileSystemCorrupted)
+	assert.ErrorContains(t, err, `/SUB: entry 2: "A.TXT" is a volume label`)
+}
+
+func TestDriver__InvalidEntriesLenient(t *testing.T) {
+	fs, implementation := mountWithFlags(
+		t, makeImageWithBadEntries(t, true), disko.MountFlagsAllowRead|disko.MountFlagsLenient)
+
+	// Reading the directories twice shouldn't report anything twice.
+	for i := 0; i < 2; i++ {
+		entries, err := fs.ReadDir("/")
+		require.NoError(t, err)
+		names := []string{}
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		assert.ElementsMatch(t, []string{"SUB", "D.TXT"}, names)
+
+		entries, err = fs.ReadDir("/SUB")
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	}
+
+	features := []string{}
+	for _, warning := range implementation.MountWarnings() {
+		assert.ErrorIs(t, warning.Err, disko.ErrFileSystemCorrupted)
+		features = append(features, warning.Feature)
+	}
+	assert.Equal(
+		t,
+		[]string{
+			"long file name without a short entry",
+			"volume label outside the root directory",
+			"invalid attribute combination",
+			"reserved attribute bits set",
+		},
+		features,
+	)
+}
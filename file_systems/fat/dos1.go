@@ -0,0 +1,129 @@
+package fat
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+// dos1Formats gives the BPB of every floppy format DOS 1.x supports, keyed by
+// media descriptor. These disks have no BPB in their boot sector, so the only
+// way to tell them apart is by the media descriptor in the first FAT entry.
+var dos1Formats = map[uint8]RawFATBootSectorWithBPB{
+	// 160 KiB, single-sided, 8 sectors per track
+	0xFE: {
+		BytesPerSector:    512,
+		SectorsPerCluster: 1,
+		ReservedSectors:   1,
+		NumFATs:           2,
+		RootEntryCount:    64,
+		TotalSectors16:    320,
+		Media:             0xFE,
+		SectorsPerFAT16:   1,
+		SectorsPerTrack:   8,
+		NumHeads:          1,
+	},
+	// 180 KiB, single-sided, 9 sectors per track
+	0xFC: {
+		BytesPerSector:    512,
+		SectorsPerCluster: 1,
+		ReservedSectors:   1,
+		NumFATs:           2,
+		RootEntryCount:    64,
+		TotalSectors16:    360,
+		Media:             0xFC,
+		SectorsPerFAT16:   2,
+		SectorsPerTrack:   9,
+		NumHeads:          1,
+	},
+	// 320 KiB, double-sided, 8 sectors per track
+	0xFF: {
+		BytesPerSector:    512,
+		SectorsPerCluster: 2,
+		ReservedSectors:   1,
+		NumFATs:           2,
+		RootEntryCount:    112,
+		TotalSectors16:    640,
+		Media:             0xFF,
+		SectorsPerFAT16:   1,
+		SectorsPerTrack:   8,
+		NumHeads:          2,
+	},
+	// 360 KiB, double-sided, 9 sectors per track
+	0xFD: {
+		BytesPerSector:    512,
+		SectorsPerCluster: 2,
+		ReservedSectors:   1,
+		NumFATs:           2,
+		RootEntryCount:    112,
+		TotalSectors16:    720,
+		Media:             0xFD,
+		SectorsPerFAT16:   2,
+		SectorsPerTrack:   9,
+		NumHeads:          2,
+	},
+}
+
+// InferDOS1BootSector determines the layout of a DOS 1.x floppy, which has no
+// BPB in its boot sector. The format is identified by the media descriptor in
+// the first FAT entry, and the image must be large enough to hold that format.
+// Trailing data past the end of the file system is ignored, since some imaging
+// tools pad images.
+func InferDOS1BootSector(image io.ReaderAt, size int64) (*FATBootSector, error) {
+	return inferBootSector(image, size, dos1Formats, "DOS 1.x")
+}
+
+// inferBootSector determines the layout of a floppy with no BPB from the media
+// descriptor in its first FAT entry, looking it up in `formats`. `system` names
+// the system the formats belong to, for error messages.
+func inferBootSector(
+	image io.ReaderAt,
+	size int64,
+	formats map[uint8]RawFATBootSectorWithBPB,
+	system string,
+) (*FATBootSector, error) {
+	// These floppies always have one reserved sector, so the FAT starts at
+	// sector 1. The first entry is the media descriptor in the low byte, with
+	// all other bits set.
+	fatStart := make([]byte, 3)
+	_, err := image.ReadAt(fatStart, 512)
+	if err != nil {
+		return nil, disko.ErrIOFailed.Wrap(err)
+	}
+
+	if fatStart[1] != 0xFF || fatStart[2] != 0xFF {
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			"no BPB, and the first FAT entry doesn't hold a media descriptor")
+	}
+
+	rawHeader, ok := formats[fatStart[0]]
+	if !ok {
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf(
+				"no BPB, and media descriptor %#02x isn't a %s floppy format",
+				fatStart[0],
+				system,
+			),
+		)
+	}
+
+	expectedSize := int64(rawHeader.TotalSectors16) * int64(rawHeader.BytesPerSector)
+	if size < expectedSize {
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf(
+				"media descriptor %#02x implies a %d-byte image, but it's only %d bytes",
+				fatStart[0],
+				expectedSize,
+				size,
+			),
+		)
+	}
+
+	bootSector, err := newFATBootSector(rawHeader, 0, CompatibilityOptions{})
+	if err != nil {
+		return nil, err
+	}
+	bootSector.BPBInferred = true
+	return bootSector, nil
+}
@@ -1,5 +1,12 @@
 package fat
 
+import (
+	"encoding/binary"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+)
+
 type RawFAT32BootSector struct {
 	RawFATBootSectorWithBPB
 	fatSize32        uint32
@@ -16,3 +23,64 @@ type RawFAT32BootSector struct {
 	VolumeLabel      [11]byte
 	FileSystemType   [8]byte
 }
+
+// Signatures and field offsets in the FAT32 FSInfo sector.
+const (
+	fsInfoLeadSignature         = 0x41615252
+	fsInfoStructSignature       = 0x61417272
+	fsInfoTrailSignature        = 0xAA550000
+	fsInfoStructSignatureOffset = 484
+	fsInfoNextFreeOffset        = 492
+	fsInfoTrailSignatureOffset  = 508
+)
+
+// readFSInfo finds the FSInfo sector of a FAT32 volume, and returns its offset
+// in the image and the cluster its next free cluster hint points to. The offset
+// is 0 if there's no FSInfo sector or it isn't valid, in which case it's left
+// alone. The hint is 2 if it's unknown or out of range.
+func readFSInfo(
+	image *disks.Section,
+	bootSector *FATBootSector,
+	rawSector []byte,
+) (int64, uint, disko.DriverError) {
+	fsInfoSector := int64(binary.LittleEndian.Uint16(rawSector[fat32FSInfoOffset:]))
+	if fsInfoSector == 0 || fsInfoSector == 0xFFFF || fsInfoSector >= int64(bootSector.ReservedSectors) {
+		return 0, 2, nil
+	}
+
+	offset := fsInfoSector * int64(bootSector.BytesPerSector)
+	rawFSInfo := make([]byte, 512)
+	_, err := image.ReadAt(rawFSInfo, offset)
+	if err != nil {
+		return 0, 2, disko.ErrIOFailed.Wrap(err)
+	}
+
+	if binary.LittleEndian.Uint32(rawFSInfo) != fsInfoLeadSignature ||
+		binary.LittleEndian.Uint32(rawFSInfo[fsInfoStructSignatureOffset:]) != fsInfoStructSignature ||
+		binary.LittleEndian.Uint32(rawFSInfo[fsInfoTrailSignatureOffset:]) != fsInfoTrailSignature {
+		return 0, 2, nil
+	}
+
+	nextFree := uint(binary.LittleEndian.Uint32(rawFSInfo[fsInfoNextFreeOffset:]))
+	if nextFree < 2 || nextFree >= bootSector.TotalClusters+2 {
+		nextFree = 2
+	}
+	return offset, nextFree, nil
+}
+
+// writeFSInfo updates the free cluster count and next free cluster hint in the
+// FSInfo sector, if the volume has one.
+func (driver *Driver) writeFSInfo() disko.DriverError {
+	if driver.fsInfoOffset == 0 {
+		return nil
+	}
+
+	rawFields := make([]byte, 8)
+	binary.LittleEndian.PutUint32(rawFields, uint32(driver.FSStat().BlocksFree))
+	binary.LittleEndian.PutUint32(rawFields[4:], uint32(driver.nextFree))
+	_, err := driver.image.WriteAt(rawFields, driver.fsInfoOffset+fsInfoFreeCountOffset)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package fat_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeFAT32Image creates a freshly formatted 34 MiB FAT32 image with 512-byte
+// clusters, the smallest size that needs FAT32 at that cluster size. The FSInfo
+// sector is right after the boot sector, and starts with the free cluster count
+// and next free cluster hint unknown.
+func makeFAT32Image() []byte {
+	image := make([]byte, 69632*512)
+	copy(image, []byte{0xEB, 0x58, 0x90})
+	copy(image[3:], "MSWIN4.1")
+	binary.LittleEndian.PutUint16(image[11:], 512)   // Bytes per sector
+	image[13] = 1                                    // Sectors per cluster
+	binary.LittleEndian.PutUint16(image[14:], 32)    // Reserved sectors
+	image[16] = 2                                    // Number of FATs
+	image[21] = 0xF8                                 // Media descriptor
+	binary.LittleEndian.PutUint16(image[24:], 63)    // Sectors per track
+	binary.LittleEndian.PutUint16(image[26:], 16)    // Heads
+	binary.LittleEndian.PutUint32(image[32:], 69632) // Total sectors
+	binary.LittleEndian.PutUint32(image[36:], 540)   // Sectors per FAT
+	binary.LittleEndian.PutUint32(image[44:], 2)     // Root directory cluster
+	binary.LittleEndian.PutUint16(image[48:], 1)     // FSInfo sector
+	binary.LittleEndian.PutUint16(image[50:], 6)     // Backup boot sector
+	image[64] = 0x80
+	image[66] = 0x29
+	binary.LittleEndian.PutUint32(image[67:], 0x1234ABCD)
+	copy(image[71:], "FAT32TEST  ")
+	copy(image[82:], "FAT32   ")
+	image[510] = 0x55
+	image[511] = 0xAA
+	copy(image[6*512:7*512], image[:512])
+
+	fsInfo := image[512:1024]
+	binary.LittleEndian.PutUint32(fsInfo, 0x41615252)
+	binary.LittleEndian.PutUint32(fsInfo[484:], 0x61417272)
+	binary.LittleEndian.PutUint32(fsInfo[488:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(fsInfo[492:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(fsInfo[508:], 0xAA550000)
+
+	for _, fatStart := range []int{32 * 512, 572 * 512} {
+		binary.LittleEndian.PutUint32(image[fatStart:], 0x0FFFFFF8)
+		binary.LittleEndian.PutUint32(image[fatStart+4:], 0x0FFFFFFF)
+		// The high four bits of FAT32 entries are reserved, and must be ignored
+		// when reading.
+		binary.LittleEndian.PutUint32(image[fatStart+8:], 0xFFFFFFFF)
+	}
+	return image
+}
+
+// fsInfoFields returns the free cluster count and next free cluster hint from
+// the FSInfo sector of an image made by makeFAT32Image.
+func fsInfoFields(image []byte) (uint32, uint32) {
+	return binary.LittleEndian.Uint32(image[512+488:]), binary.LittleEndian.Uint32(image[512+492:])
+}
+
+func TestDriver__FAT32WriteAndReadBack(t *testing.T) {
+	image := makeFAT32Image()
+	fs, implementation := mountFloppy(t, image)
+	freeBefore := implementation.FSStat().BlocksFree
+	require.EqualValues(t, 68519, freeBefore)
+
+	// Each cluster of the root directory holds 16 entries, so this makes its
+	// chain grow to three clusters.
+	for i := 0; i < 40; i++ {
+		name := fmt.Sprintf("/file%02d.txt", i)
+		require.NoError(t, fs.WriteFile(name, []byte(name), 0o644))
+	}
+	contents := make([]byte, 3000)
+	for i := range contents {
+		contents[i] = byte(i)
+	}
+	require.NoError(t, fs.Mkdir("/data", 0o755))
+	require.NoError(t, fs.WriteFile("/data/big.bin", contents, 0o644))
+	require.NoError(t, fs.Flush())
+	require.NoError(t, implementation.Unmount())
+
+	// 40 small files, two more root clusters, one for /data, six for big.bin.
+	used := uint64(40 + 2 + 1 + 6)
+	freeCount, nextFree := fsInfoFields(image)
+	assert.EqualValues(t, freeBefore-used, freeCount)
+	assert.EqualValues(t, 2+1+used, nextFree, "hint should be after the last cluster allocated")
+
+	fs, implementation = mountFloppy(t, image)
+	entries, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	assert.Len(t, entries, 41)
+
+	data, err := fs.ReadFile("/FILE39.TXT")
+	require.NoError(t, err)
+	assert.Equal(t, "/file39.txt", string(data))
+
+	data, err = fs.ReadFile("/DATA/BIG.BIN")
+	require.NoError(t, err)
+	assert.Equal(t, contents, data)
+	assert.Equal(t, freeBefore-used, implementation.FSStat().BlocksFree)
+
+	// Freed clusters are before the hint, so new ones come from after it.
+	require.NoError(t, fs.Remove("/file00.txt"))
+	require.NoError(t, fs.WriteFile("/new.txt", []byte("new"), 0o644))
+	require.NoError(t, fs.Flush())
+	freeCount, nextFree = fsInfoFields(image)
+	assert.EqualValues(t, freeBefore-used, freeCount)
+	assert.EqualValues(t, 2+1+used+1, nextFree)
+}
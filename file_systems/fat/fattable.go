@@ -0,0 +1,145 @@
+package fat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+// This file has helpers for working directly with the FATs and clusters of an
+// unmounted image, for operations that rewrite large parts of it.
+
+// badClusterMarker returns the FAT entry value that marks a cluster as bad.
+// Entries at or above this value never point to another cluster.
+func badClusterMarker(fatVersion int) uint32 {
+	switch fatVersion {
+	case 12:
+		return 0xFF7
+	case 16:
+		return 0xFFF7
+	default:
+		return 0x0FFFFFF7
+	}
+}
+
+// fatEntry returns the value of the FAT entry for `cluster`.
+func fatEntry(fat []byte, fatVersion int, cluster uint) uint32 {
+	switch fatVersion {
+	case 12:
+		value := uint32(binary.LittleEndian.Uint16(fat[cluster*3/2:]))
+		if cluster%2 == 0 {
+			return value & 0x0FFF
+		}
+		return value >> 4
+	case 16:
+		return uint32(binary.LittleEndian.Uint16(fat[cluster*2:]))
+	default:
+		return binary.LittleEndian.Uint32(fat[cluster*4:]) & 0x0FFFFFFF
+	}
+}
+
+// setFATEntry sets the FAT entry for `cluster` to `value`. On FAT32, the high
+// four bits of the entry are reserved and are preserved.
+func setFATEntry(fat []byte, fatVersion int, cluster uint, value uint32) {
+	switch fatVersion {
+	case 12:
+		offset := cluster * 3 / 2
+		current := binary.LittleEndian.Uint16(fat[offset:])
+		if cluster%2 == 0 {
+			current = current&0xF000 | uint16(value&0x0FFF)
+		} else {
+			current = current&0x000F | uint16(value&0x0FFF)<<4
+		}
+		binary.LittleEndian.PutUint16(fat[offset:], current)
+	case 16:
+		binary.LittleEndian.PutUint16(fat[cluster*2:], uint16(value))
+	default:
+		current := binary.LittleEndian.Uint32(fat[cluster*4:])
+		binary.LittleEndian.PutUint32(fat[cluster*4:], current&0xF0000000|value&0x0FFFFFFF)
+	}
+}
+
+// fatOffset returns the byte offset of the `index`th copy of the FAT.
+func fatOffset(bootSector *FATBootSector, index uint) int64 {
+	bytesPerSector := int64(bootSector.BytesPerSector)
+	return int64(bootSector.ReservedSectors)*bytesPerSector +
+		int64(index)*int64(bootSector.SectorsPerFAT)*bytesPerSector
+}
+
+// readFAT returns the contents of the first copy of the FAT.
+func readFAT(image io.ReaderAt, bootSector *FATBootSector) ([]byte, disko.DriverError) {
+	fat := make([]byte, bootSector.SectorsPerFAT*uint(bootSector.BytesPerSector))
+	_, err := image.ReadAt(fat, fatOffset(bootSector, 0))
+	if err != nil {
+		return nil, disko.ErrIOFailed.Wrap(err)
+	}
+	return fat, nil
+}
+
+// differingFATCopies returns the indexes of the copies of the FAT that don't
+// match `fat`, the contents of the first copy.
+func differingFATCopies(image io.ReaderAt, bootSector *FATBootSector, fat []byte) ([]uint, disko.DriverError) {
+	differing := []uint{}
+	otherCopy := make([]byte, len(fat))
+	for i := uint(1); i < uint(bootSector.NumFATs); i++ {
+		_, err := image.ReadAt(otherCopy, fatOffset(bootSector, i))
+		if err != nil {
+			return nil, disko.ErrIOFailed.Wrap(err)
+		} else if !bytes.Equal(otherCopy, fat) {
+			differing = append(differing, i)
+		}
+	}
+	return differing, nil
+}
+
+// writeFATs writes `fat` to every copy of the FAT.
+func writeFATs(image io.WriterAt, bootSector *FATBootSector, fat []byte) disko.DriverError {
+	for i := uint(0); i < uint(bootSector.NumFATs); i++ {
+		_, err := image.WriteAt(fat, fatOffset(bootSector, i))
+		if err != nil {
+			return disko.ErrIOFailed.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// writeFATEntries writes the sectors of the FAT holding the entries of
+// `clusters` to every copy of the FAT, instead of the whole table.
+func writeFATEntries(
+	image io.WriterAt,
+	bootSector *FATBootSector,
+	fat []byte,
+	clusters []uint,
+) disko.DriverError {
+	bytesPerSector := uint(bootSector.BytesPerSector)
+	sectors := map[uint]struct{}{}
+	for _, cluster := range clusters {
+		// Entries are 1.5, 2, or 4 bytes, so a FAT12 entry can straddle two
+		// sectors.
+		start := cluster * uint(bootSector.FATVersion) / 8
+		end := (cluster*uint(bootSector.FATVersion) + uint(bootSector.FATVersion) - 1) / 8
+		sectors[start/bytesPerSector] = struct{}{}
+		sectors[end/bytesPerSector] = struct{}{}
+	}
+
+	for sector := range sectors {
+		data := fat[sector*bytesPerSector : (sector+1)*bytesPerSector]
+		for i := uint(0); i < uint(bootSector.NumFATs); i++ {
+			_, err := image.WriteAt(data, fatOffset(bootSector, i)+int64(sector*bytesPerSector))
+			if err != nil {
+				return disko.ErrIOFailed.Wrap(err)
+			}
+		}
+	}
+	return nil
+}
+
+// clusterOffset returns the byte offset of a cluster in the data area. The
+// first cluster is 2.
+func clusterOffset(bootSector *FATBootSector, cluster uint) int64 {
+	sector := int64(bootSector.FirstDataSector) +
+		int64(cluster-2)*int64(bootSector.SectorsPerCluster)
+	return sector * int64(bootSector.BytesPerSector)
+}
@@ -0,0 +1,71 @@
+package fat_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeImageWithFileSize creates a floppy with a 1024-byte /FILE.TXT, which
+// takes two clusters, then changes the size in its directory entry to `size`.
+func makeImageWithFileSize(t *testing.T, size uint32) ([]byte, []byte) {
+	image := makeFloppyImage()
+	fs, implementation := mountFloppy(t, image)
+	contents := bytes.Repeat([]byte("0123456789abcdef"), 64)
+	require.NoError(t, fs.WriteFile("/FILE.TXT", contents, 0o644))
+	require.NoError(t, fs.Flush())
+	require.NoError(t, implementation.Unmount())
+
+	offset := bytes.Index(image, []byte("FILE    TXT"))
+	require.GreaterOrEqual(t, offset, 0)
+	binary.LittleEndian.PutUint32(image[offset+28:], size)
+	return image, contents
+}
+
+func TestDriver__FileSizeLargerThanChainStrict(t *testing.T) {
+	image, _ := makeImageWithFileSize(t, 5000)
+	fs, _ := mountWithFlags(t, image, disko.MountFlagsAllowRead)
+
+	_, err := fs.ReadFile("/FILE.TXT")
+	assert.ErrorIs(t, err, disko.ErrFileSystemCorrupted)
+	assert.ErrorContains(t, err, "/FILE.TXT: size is 5000 bytes, but its cluster chain holds 1024")
+}
+
+func TestDriver__FileSizeLargerThanChainLenient(t *testing.T) {
+	image, contents := makeImageWithFileSize(t, 5000)
+	fs, implementation := mountWithFlags(t, image, disko.MountFlagsAllowRead|disko.MountFlagsLenient)
+
+	stat, err := fs.Stat("/FILE.TXT")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1024, stat.Size)
+
+	data, err := fs.ReadFile("/FILE.TXT")
+	require.NoError(t, err)
+	assert.Equal(t, contents, data)
+
+	warnings := implementation.MountWarnings()
+	require.Len(t, warnings, 1)
+	assert.Equal(t, "file size doesn't match cluster chain", warnings[0].Feature)
+	assert.ErrorIs(t, warnings[0].Err, disko.ErrFileSystemCorrupted)
+}
+
+// A chain with clusters past the end of the file is also corruption, but
+// there's nothing to clamp.
+func TestDriver__FileSizeSmallerThanChain(t *testing.T) {
+	image, contents := makeImageWithFileSize(t, 100)
+	fs, _ := mountWithFlags(t, image, disko.MountFlagsAllowRead)
+	_, err := fs.ReadFile("/FILE.TXT")
+	assert.ErrorIs(t, err, disko.ErrFileSystemCorrupted)
+	assert.ErrorContains(t, err, "/FILE.TXT: size is 100 bytes, but its cluster chain holds 1024")
+
+	image, _ = makeImageWithFileSize(t, 100)
+	fs, implementation := mountWithFlags(t, image, disko.MountFlagsAllowRead|disko.MountFlagsLenient)
+	data, err := fs.ReadFile("/FILE.TXT")
+	require.NoError(t, err)
+	assert.Equal(t, contents[:100], data)
+	assert.Len(t, implementation.MountWarnings(), 1)
+}
@@ -0,0 +1,124 @@
+package fat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+	"github.com/dargueta/disko/utilities/binstruct"
+)
+
+// formatFloppyFormats gives the BPB [Driver.FormatImage] writes for each size
+// of image it can format, in sectors. These are the standard PC floppy formats.
+var formatFloppyFormats = map[uint]RawFATBootSectorWithBPB{
+	320: dos1Formats[0xFE],
+	360: dos1Formats[0xFC],
+	640: dos1Formats[0xFF],
+	720: dos1Formats[0xFD],
+	// 720 KiB 3.5" disks use the same layout on MSX-DOS and PC DOS.
+	1440: msxFormats[0xF9],
+	// 1.2 MiB, double-sided, 15 sectors per track
+	2400: {
+		BytesPerSector:    512,
+		SectorsPerCluster: 1,
+		ReservedSectors:   1,
+		NumFATs:           2,
+		RootEntryCount:    224,
+		TotalSectors16:    2400,
+		Media:             0xF9,
+		SectorsPerFAT16:   7,
+		SectorsPerTrack:   15,
+		NumHeads:          2,
+	},
+	// 1.44 MiB, double-sided, 18 sectors per track
+	2880: {
+		BytesPerSector:    512,
+		SectorsPerCluster: 1,
+		ReservedSectors:   1,
+		NumFATs:           2,
+		RootEntryCount:    224,
+		TotalSectors16:    2880,
+		Media:             0xF0,
+		SectorsPerFAT16:   9,
+		SectorsPerTrack:   18,
+		NumHeads:          2,
+	},
+	// 2.88 MiB, double-sided, 36 sectors per track
+	5760: {
+		BytesPerSector:    512,
+		SectorsPerCluster: 2,
+		ReservedSectors:   1,
+		NumFATs:           2,
+		RootEntryCount:    240,
+		TotalSectors16:    5760,
+		Media:             0xF0,
+		SectorsPerFAT16:   9,
+		SectorsPerTrack:   36,
+		NumHeads:          2,
+	},
+}
+
+// formatSizes returns the sizes of image [Driver.FormatImage] accepts, for
+// error messages.
+func formatSizes() string {
+	sizes := make([]int, 0, len(formatFloppyFormats))
+	for sectors := range formatFloppyFormats {
+		sizes = append(sizes, int(sectors))
+	}
+	sort.Ints(sizes)
+
+	names := make([]string, len(sizes))
+	for i, sectors := range sizes {
+		names[i] = fmt.Sprintf("%dK", sectors/2)
+	}
+	return strings.Join(names, ", ")
+}
+
+// FormatImage implements [disko.FormatImageImplementer]. Only the standard PC
+// floppy sizes are supported, from 160 KiB to 2.88 MiB, since the layout of
+// anything else is up to the formatter. The boot sector can't boot, like the
+// one [Reformat] writes, and the serial number is taken from the clock.
+func (driver *Driver) FormatImage(options disks.BasicFormatterOptions) disko.DriverError {
+	if driver.bootSector != nil {
+		return disko.ErrBusy.WithMessage("image must be unmounted before it can be formatted")
+	}
+
+	size := options.TotalSizeBytes()
+	bpb, ok := formatFloppyFormats[uint(size/512)]
+	if !ok || size%512 != 0 {
+		return disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf(
+				"can't format a %d-byte image; sizes supported are %s",
+				size,
+				formatSizes(),
+			),
+		)
+	}
+
+	image, err := disks.NewWindow(driver.stream, 0, size)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+
+	// Only the BPB and the extended BPB's signature are written here. Reformat
+	// fills in the rest of the boot sector, and clears the FATs and root
+	// directory.
+	rawSector := make([]byte, 512)
+	err = binstruct.MarshalInto(rawSector, bpb, binary.LittleEndian)
+	if err != nil {
+		return disko.CastToDriverError(err)
+	}
+	rawSector[fat16ExtendedBPBOffset] = 0x29
+	copy(rawSector[fat16ExtendedBPBOffset+extendedBPBLabelOffset+11:], "FAT12   ")
+	rawSector[510] = 0x55
+	rawSector[511] = 0xAA
+
+	_, err = image.WriteAt(rawSector, 0)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	return Reformat(image, ReformatOptions{SerialNumber: uint32(driver.clock.Now().Unix())})
+}
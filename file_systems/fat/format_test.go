@@ -0,0 +1,48 @@
+package fat_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xaionaro-go/bytesextra"
+)
+
+func TestFormatImage(t *testing.T) {
+	for _, size := range []int64{160, 180, 320, 360, 720, 1200, 1440, 2880} {
+		image := make([]byte, size*1024)
+		implementation, err := fat.NewDriver(bytesextra.NewReadWriteSeeker(image))
+		require.NoError(t, err)
+
+		formatter := implementation.(disko.FormatImageImplementer)
+		require.NoError(t, formatter.FormatImage(disks.FormatterSizeOptions{Size: size * 1024}), size)
+		require.True(t, fat.Detect(bytes.NewReader(image), size*1024), size)
+
+		fs, mounted := mountFloppy(t, image)
+		stat := mounted.FSStat()
+		assert.Equal(t, stat.TotalBlocks, stat.BlocksFree, size)
+		require.NoError(t, fs.WriteFile("/FILE.TXT", []byte("data"), 0o644), size)
+	}
+}
+
+func TestFormatImage__UnsupportedSize(t *testing.T) {
+	image := make([]byte, 1000*1024)
+	implementation, err := fat.NewDriver(bytesextra.NewReadWriteSeeker(image))
+	require.NoError(t, err)
+
+	formatter := implementation.(disko.FormatImageImplementer)
+	err = formatter.FormatImage(disks.FormatterSizeOptions{Size: 1000 * 1024})
+	assert.ErrorIs(t, err, disko.ErrNotSupported)
+	assert.ErrorContains(t, err, "160K, 180K, 320K, 360K, 720K, 1200K, 1440K, 2880K")
+}
+
+func TestFormatImage__Mounted(t *testing.T) {
+	_, implementation := mountFloppy(t, makeFloppyImage())
+	formatter := implementation.(disko.FormatImageImplementer)
+	err := formatter.FormatImage(disks.FormatterSizeOptions{Size: 2880 * 512})
+	assert.ErrorIs(t, err, disko.ErrBusy)
+}
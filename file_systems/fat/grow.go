@@ -0,0 +1,225 @@
+package fat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+// GrowableImage is the interface [GrowImage] needs to modify an image in place.
+// Writing past the end of the image must extend it, as it does for [os.File].
+type GrowableImage interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// Offsets of fields in the boot sector that need to be updated when growing.
+const (
+	totalSectors16Offset   = 19
+	totalSectors32Offset   = 32
+	fat32FSInfoOffset      = 48
+	fat32BackupBootOffset  = 50
+	fat32RootClusterOffset = 44
+	fsInfoFreeCountOffset  = 488
+	// fsInfoUnknown is the value of the FSInfo free cluster count and next free
+	// cluster hint when they're not known.
+	fsInfoUnknown = 0xFFFFFFFF
+)
+
+// GrowImage enlarges the FAT file system in `image` to `newTotalSectors`
+// sectors, extending the image if needed. The new space is added to the end of
+// the data area as free clusters.
+//
+// The FATs, root directory, and data area can't be moved, so this only works if
+// the FATs already have unused entries for the new clusters. Formatters usually
+// leave some slack at the end of the FAT, but not much. Growing past that fails
+// with [disko.ErrNoSpaceOnDevice]. Growing enough to change the FAT version
+// (e.g. FAT12 to FAT16) would change the size of every FAT entry, so this fails
+// with [disko.ErrNotSupported].
+//
+// The image must not be mounted while this is running.
+func GrowImage(image GrowableImage, newTotalSectors uint) disko.DriverError {
+	bootSector, rawSector, err := readBootSectorForResize(image)
+	if err != nil {
+		return err
+	}
+
+	oldTotalSectors := bootSector.totalSectors()
+	if newTotalSectors <= oldTotalSectors {
+		return disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf(
+				"can't grow image from %d sectors to %d: new size must be larger",
+				oldTotalSectors,
+				newTotalSectors,
+			),
+		)
+	} else if newTotalSectors > 0xFFFFFFFF {
+		return disko.ErrArgumentOutOfRange.WithMessage(
+			fmt.Sprintf("FAT images can have at most 2^32 - 1 sectors, not %d", newTotalSectors))
+	}
+
+	newTotalClusters :=
+		(newTotalSectors - uint(bootSector.FirstDataSector)) / uint(bootSector.SectorsPerCluster)
+	newVersion := DetermineFATVersion(newTotalClusters)
+	if newVersion != bootSector.FATVersion {
+		return disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf(
+				"growing to %d sectors would convert FAT%d to FAT%d",
+				newTotalSectors,
+				bootSector.FATVersion,
+				newVersion,
+			),
+		)
+	}
+
+	// The first two entries of the FAT are reserved, so cluster numbers start
+	// at 2.
+	bytesPerFAT := bootSector.SectorsPerFAT * uint(bootSector.BytesPerSector)
+	maxClusters := bytesPerFAT*8/uint(bootSector.FATVersion) - 2
+	if newTotalClusters > maxClusters {
+		return disko.ErrNoSpaceOnDevice.WithMessage(
+			fmt.Sprintf(
+				"the FAT only has room for %d clusters, but growing to %d sectors"+
+					" requires %d",
+				maxClusters,
+				newTotalSectors,
+				newTotalClusters,
+			),
+		)
+	}
+
+	// Extend the image first. If this fails, nothing on the image has changed.
+	bytesPerSector := int64(bootSector.BytesPerSector)
+	_, ioErr := image.WriteAt(
+		make([]byte, bytesPerSector), int64(newTotalSectors-1)*bytesPerSector)
+	if ioErr != nil {
+		return disko.ErrIOFailed.Wrap(ioErr)
+	}
+
+	// Entries past the end of the old FAT aren't guaranteed to be zeroed, so
+	// mark them free explicitly before the boot sector says they're valid.
+	fat, err := readFAT(image, bootSector)
+	if err != nil {
+		return err
+	}
+	for cluster := bootSector.TotalClusters + 2; cluster < newTotalClusters+2; cluster++ {
+		setFATEntry(fat, bootSector.FATVersion, cluster, 0)
+	}
+	err = writeFATs(image, bootSector, fat)
+	if err != nil {
+		return err
+	}
+
+	return updateTotalSectors(
+		image,
+		bootSector,
+		rawSector,
+		newTotalSectors,
+		int64(newTotalClusters)-int64(bootSector.TotalClusters),
+	)
+}
+
+// readBootSectorForResize reads and validates the boot sector of an image being
+// resized. The returned raw sector is truncated to the size of a sector if it's
+// smaller than 512 bytes, so that it can be written back safely.
+func readBootSectorForResize(
+	image io.ReaderAt,
+) (*FATBootSector, []byte, disko.DriverError) {
+	rawSector := make([]byte, 512)
+	_, err := image.ReadAt(rawSector, 0)
+	if err != nil {
+		return nil, nil, disko.ErrIOFailed.Wrap(err)
+	}
+
+	bootSector, err := NewFATBootSectorFromStreamWithOptions(
+		bytes.NewReader(rawSector),
+		CompatibilityOptions{AllowSmallSectors: true, AtariST: true},
+	)
+	if err != nil {
+		return nil, nil, disko.CastToDriverError(err)
+	}
+
+	if int(bootSector.BytesPerSector) < len(rawSector) {
+		rawSector = rawSector[:bootSector.BytesPerSector]
+	}
+	return bootSector, rawSector, nil
+}
+
+// updateTotalSectors writes the new size of the file system to the boot sector,
+// and for FAT32, its backup and the free cluster count in the FSInfo sector.
+// `addedClusters` is negative if the file system shrank.
+func updateTotalSectors(
+	image GrowableImage,
+	bootSector *FATBootSector,
+	rawSector []byte,
+	newTotalSectors uint,
+	addedClusters int64,
+) disko.DriverError {
+	// Changing the BPB invalidates the checksum of a bootable Atari ST boot
+	// sector, so it must be recomputed afterwards.
+	wasExecutable := len(rawSector) >= 512 && IsAtariSTBootSectorExecutable(rawSector)
+
+	// Sector counts that fit are stored in the 16-bit field, unless the image
+	// already used the 32-bit one.
+	if newTotalSectors <= 0xFFFF && bootSector.TotalSectors16 != 0 {
+		binary.LittleEndian.PutUint16(rawSector[totalSectors16Offset:], uint16(newTotalSectors))
+	} else {
+		binary.LittleEndian.PutUint16(rawSector[totalSectors16Offset:], 0)
+		binary.LittleEndian.PutUint32(rawSector[totalSectors32Offset:], uint32(newTotalSectors))
+	}
+
+	if wasExecutable {
+		SetAtariSTBootChecksum(rawSector, true)
+	}
+
+	bytesPerSector := int64(bootSector.BytesPerSector)
+	bootSectorCopies := []int64{0}
+	if bootSector.FATVersion == 32 {
+		backupSector := binary.LittleEndian.Uint16(rawSector[fat32BackupBootOffset:])
+		if backupSector != 0 && backupSector != 0xFFFF {
+			bootSectorCopies = append(bootSectorCopies, int64(backupSector))
+		}
+
+		fsInfoSector := binary.LittleEndian.Uint16(rawSector[fat32FSInfoOffset:])
+		if fsInfoSector != 0 && fsInfoSector != 0xFFFF {
+			err := updateFSInfo(image, int64(fsInfoSector)*bytesPerSector, addedClusters)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, sector := range bootSectorCopies {
+		_, err := image.WriteAt(rawSector, sector*bytesPerSector)
+		if err != nil {
+			return disko.ErrIOFailed.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// updateFSInfo adjusts the free cluster count in the FAT32 FSInfo sector at
+// `offset` by `addedClusters`, unless it's unknown. The hint for where to look
+// for free clusters may no longer be valid, so it's reset to unknown.
+func updateFSInfo(image GrowableImage, offset int64, addedClusters int64) disko.DriverError {
+	rawFields := make([]byte, 8)
+	_, err := image.ReadAt(rawFields, offset+fsInfoFreeCountOffset)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+
+	freeCount := binary.LittleEndian.Uint32(rawFields)
+	if freeCount != fsInfoUnknown {
+		binary.LittleEndian.PutUint32(rawFields, uint32(int64(freeCount)+addedClusters))
+	}
+	binary.LittleEndian.PutUint32(rawFields[4:], fsInfoUnknown)
+
+	_, err = image.WriteAt(rawFields, offset+fsInfoFreeCountOffset)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package fat_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// growableImage is an in-memory image that grows when written past the end.
+// It implements both [fat.GrowableImage] and [fat.ShrinkableImage].
+type growableImage struct {
+	data []byte
+}
+
+func (image *growableImage) ReadAt(buffer []byte, offset int64) (int, error) {
+	return bytes.NewReader(image.data).ReadAt(buffer, offset)
+}
+
+func (image *growableImage) WriteAt(buffer []byte, offset int64) (int, error) {
+	end := int(offset) + len(buffer)
+	if end > len(image.data) {
+		image.data = append(image.data, make([]byte, end-len(image.data))...)
+	}
+	return copy(image.data[offset:], buffer), nil
+}
+
+func (image *growableImage) Truncate(size int64) error {
+	image.data = image.data[:size]
+	return nil
+}
+
+func TestGrowImage__FAT12(t *testing.T) {
+	image := &growableImage{data: makeFloppyImage()}
+
+	// Put garbage in the slack at the end of both FATs to make sure it's cleared.
+	for _, fatStart := range []int{512, 10 * 512} {
+		copy(image.data[fatStart+4300:], []byte{0xAB, 0xCD, 0xEF})
+	}
+
+	require.NoError(t, fat.GrowImage(image, 3000))
+	assert.Len(t, image.data, 3000*512)
+	assert.EqualValues(t, 3000, binary.LittleEndian.Uint16(image.data[19:]))
+
+	bootSector, err := fat.NewFATBootSectorFromStream(bytes.NewReader(image.data))
+	require.NoError(t, err)
+	assert.EqualValues(t, 3000-33, bootSector.TotalClusters)
+
+	for _, fatStart := range []int{512, 10 * 512} {
+		// The existing file's chain must be untouched.
+		assert.Equal(
+			t,
+			[]byte{0xF0, 0xFF, 0xFF, 0x03, 0xF0, 0xFF},
+			image.data[fatStart:fatStart+6],
+		)
+		assert.Equal(t, make([]byte, 3), image.data[fatStart+4300:fatStart+4303])
+	}
+}
+
+func TestGrowImage__FATTooSmall(t *testing.T) {
+	image := &growableImage{data: makeFloppyImage()}
+	original := bytes.Clone(image.data)
+
+	err := fat.GrowImage(image, 4000)
+	assert.ErrorIs(t, err, disko.ErrNoSpaceOnDevice)
+	assert.Equal(t, original, image.data, "image was modified")
+}
+
+func TestGrowImage__Shrink(t *testing.T) {
+	image := &growableImage{data: makeFloppyImage()}
+	err := fat.GrowImage(image, 2000)
+	assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+}
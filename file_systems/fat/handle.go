@@ -0,0 +1,659 @@
+package fat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dargueta/disko"
+	c "github.com/dargueta/disko/file_systems/common"
+	"github.com/dargueta/disko/utilities/binstruct"
+)
+
+// objectHandle is the [disko.ObjectHandle] [Driver] uses for files and
+// directories, including the root directory. Blocks are clusters, except in the
+// fixed-size root directory of FAT12 and FAT16, where everything is delegated
+// to a [rootDirHandle].
+type objectHandle struct {
+	driver *Driver
+	// parent is the directory containing this object's directory entry, or nil
+	// if this is the root directory.
+	parent *objectHandle
+	// direntIndex is the index of this object's directory entry in its parent.
+	direntIndex int
+	// raw is this object's directory entry. It's unused for the root directory,
+	// which doesn't have one.
+	raw    RawDirent
+	name   string
+	closed bool
+	// isDeletedView is true if this is a [DeletedViewName] directory. Its
+	// parent is the directory whose deleted entries it shows.
+	isDeletedView bool
+	// isDeleted is true if this object has been deleted, and can only be read.
+	isDeleted bool
+}
+
+// directoryEntry is a live entry in a directory, as returned by
+// [objectHandle.entries].
+type directoryEntry struct {
+	index int
+	raw   RawDirent
+	name  string
+	// recoverable is only set for deleted entries; see [objectHandle.deletedEntries].
+	recoverable bool
+}
+
+func (handle *objectHandle) isRoot() bool {
+	return handle.parent == nil
+}
+
+func (handle *objectHandle) isDir() bool {
+	return handle.isRoot() ||
+		handle.isDeletedView ||
+		handle.raw.AttributeFlags&AttrDirectory != 0
+}
+
+// fixedRoot returns a handle for the root directory region if this is the root
+// directory of a FAT12 or FAT16 volume, or nil otherwise.
+func (handle *objectHandle) fixedRoot() *rootDirHandle {
+	if !handle.isRoot() || handle.driver.bootSector.FATVersion == 32 {
+		return nil
+	}
+	return &rootDirHandle{image: handle.driver.image, bootSector: handle.driver.bootSector}
+}
+
+// firstCluster returns the first cluster of the object's data, or 0 if it has
+// none.
+func (handle *objectHandle) firstCluster() uint {
+	if handle.isRoot() {
+		return handle.driver.rootCluster
+	}
+
+	cluster := uint(handle.raw.FirstClusterLow)
+	if handle.driver.bootSector.FATVersion == 32 {
+		cluster |= uint(handle.raw.FirstClusterHigh) << 16
+	}
+	return cluster
+}
+
+func (handle *objectHandle) setFirstCluster(cluster uint) {
+	handle.raw.FirstClusterLow = uint16(cluster)
+	if handle.driver.bootSector.FATVersion == 32 {
+		handle.raw.FirstClusterHigh = uint16(cluster >> 16)
+	}
+}
+
+// chain returns the clusters of the object's data. The chains of deleted objects
+// have been freed, so they're assumed to be contiguous.
+func (handle *objectHandle) chain() ([]uint, disko.DriverError) {
+	if handle.isDeletedView {
+		return nil, nil
+	} else if handle.isDeleted {
+		chain, _ := handle.driver.contiguousChain(
+			handle.firstCluster(), handle.driver.deletedClusterCount(&handle.raw))
+		return chain, nil
+	}
+	return handle.driver.chain(handle.firstCluster())
+}
+
+// entryOffset returns the offset in the image of directory entry `index` in
+// this directory. It fails with [disko.ErrNotFound] if the directory doesn't
+// have that many entries.
+func (handle *objectHandle) entryOffset(index int) (int64, disko.DriverError) {
+	if root := handle.fixedRoot(); root != nil {
+		if index >= int(handle.driver.bootSector.RootEntryCount) {
+			return 0, disko.ErrNotFound
+		}
+		return root.offsetOfBlock(0) + int64(index)*DirentSize, nil
+	}
+
+	chain, err := handle.chain()
+	if err != nil {
+		return 0, err
+	}
+
+	bytesPerCluster := int(handle.driver.bootSector.BytesPerCluster)
+	clusterIndex := index * DirentSize / bytesPerCluster
+	if clusterIndex >= len(chain) {
+		return 0, disko.ErrNotFound
+	}
+	return clusterOffset(handle.driver.bootSector, chain[clusterIndex]) +
+		int64(index*DirentSize%bytesPerCluster), nil
+}
+
+// writeDirent writes this object's directory entry to its parent directory.
+func (handle *objectHandle) writeDirent() disko.DriverError {
+	if handle.isRoot() {
+		return nil
+	}
+
+	offset, err := handle.parent.entryOffset(handle.direntIndex)
+	if err != nil {
+		return err
+	}
+
+	data := make([]byte, DirentSize)
+	marshalErr := binstruct.MarshalInto(data, &handle.raw, binary.LittleEndian)
+	if marshalErr != nil {
+		return disko.CastToDriverError(marshalErr)
+	}
+
+	_, writeErr := handle.driver.image.WriteAt(data, offset)
+	if writeErr != nil {
+		return disko.ErrIOFailed.Wrap(writeErr)
+	}
+	return nil
+}
+
+// markModified updates the modification time and archive bit of the object
+// and writes its directory entry.
+func (handle *objectHandle) markModified() disko.DriverError {
+	if handle.isRoot() {
+		return nil
+	}
+
+	setRawTimestamps(
+		&handle.raw,
+		disko.UndefinedTimestamp,
+		disko.UndefinedTimestamp,
+		handle.driver.clock.Now(),
+	)
+	if !handle.driver.policy.PreserveArchiveBit {
+		handle.raw.AttributeFlags |= AttrArchived
+	}
+	return handle.writeDirent()
+}
+
+// readAll returns the entire contents of this directory.
+func (handle *objectHandle) readAll() ([]byte, disko.DriverError) {
+	if root := handle.fixedRoot(); root != nil {
+		bootSector := handle.driver.bootSector
+		data := make([]byte, int(bootSector.RootDirSectors)*int(bootSector.BytesPerSector))
+		err := root.ReadBlocks(0, data)
+		// The root directory's last sector may have room for more entries than
+		// the BPB allows, as on some MSX-DOS disks. The rest of it isn't used.
+		return data[:int(bootSector.RootEntryCount)*DirentSize], err
+	}
+
+	chain, err := handle.chain()
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, uint(len(chain))*handle.driver.bootSector.BytesPerCluster)
+	return data, handle.ReadBlocks(0, data)
+}
+
+// entries returns the live entries of this directory, skipping deleted
+// entries, long file name entries, volume labels, and "." and "..". Entries
+// with invalid attributes are skipped or are an error; see direntcheck.go.
+func (handle *objectHandle) entries() ([]directoryEntry, disko.DriverError) {
+	data, err := handle.readAll()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []directoryEntry{}
+	longName := longNameRun{}
+	for index := 0; (index+1)*DirentSize <= len(data); index++ {
+		raw, rawErr := NewRawDirentFromBytes(data[index*DirentSize:])
+		if rawErr != nil {
+			return nil, disko.CastToDriverError(rawErr)
+		}
+
+		if raw.Name[0] == 0 {
+			// Free entry, so there are no more after it.
+			break
+		} else if raw.Name[0] == 0xE5 {
+			err = handle.endLongName(&longName, nil)
+		} else if isLongNameEntry(raw.AttributeFlags) {
+			err = handle.addLongName(&longName, index, data[index*DirentSize+lfnChecksumOffset])
+		} else {
+			err = handle.endLongName(&longName, &raw)
+		}
+		if err != nil {
+			return nil, err
+		} else if raw.Name[0] == 0xE5 || isLongNameEntry(raw.AttributeFlags) || raw.Name[0] == '.' {
+			continue
+		}
+
+		skip, err := handle.checkAttributes(index, &raw)
+		if err != nil {
+			return nil, err
+		} else if skip {
+			continue
+		}
+
+		dirent, direntErr := NewDirentFromRaw(handle.driver.bootSector, &raw)
+		if direntErr != nil {
+			return nil, disko.CastToDriverError(direntErr)
+		}
+		entries = append(entries, directoryEntry{index: index, raw: raw, name: dirent.Name()})
+	}
+
+	err = handle.endLongName(&longName, nil)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// findFreeEntry returns the index of the first unused entry in this directory,
+// growing it by a cluster if it's full. The fixed-size root directory of FAT12
+// and FAT16 can't grow, so it fails with [disko.ErrNoSpaceOnDevice] instead.
+func (handle *objectHandle) findFreeEntry() (int, disko.DriverError) {
+	data, err := handle.readAll()
+	if err != nil {
+		return 0, err
+	}
+
+	for index := 0; (index+1)*DirentSize <= len(data); index++ {
+		first := data[index*DirentSize]
+		if first == 0 || first == 0xE5 {
+			return index, nil
+		}
+	}
+
+	if handle.fixedRoot() != nil {
+		return 0, disko.ErrNoSpaceOnDevice.WithMessage("the root directory is full")
+	}
+
+	err = handle.Resize(uint64(len(data)) + uint64(handle.driver.bootSector.BytesPerCluster))
+	if err != nil {
+		return 0, err
+	}
+	return len(data) / DirentSize, nil
+}
+
+// initDirectory allocates the first cluster of a new directory, and writes its
+// "." and ".." entries.
+func (handle *objectHandle) initDirectory() disko.DriverError {
+	chain, err := handle.driver.resizeChain(nil, 1)
+	if err != nil {
+		return err
+	}
+	handle.setFirstCluster(chain[0])
+
+	self := handle.raw
+	copy(self.Name[:], ".       ")
+	copy(self.Extension[:], "   ")
+
+	parent := self
+	copy(parent.Name[:], "..      ")
+	parent.FirstClusterLow = 0
+	parent.FirstClusterHigh = 0
+	if !handle.parent.isRoot() {
+		cluster := handle.parent.firstCluster()
+		parent.FirstClusterLow = uint16(cluster)
+		parent.FirstClusterHigh = uint16(cluster >> 16)
+	}
+
+	data := make([]byte, 2*DirentSize)
+	marshalErr := binstruct.MarshalInto(data, &self, binary.LittleEndian)
+	if marshalErr == nil {
+		marshalErr = binstruct.MarshalInto(data[DirentSize:], &parent, binary.LittleEndian)
+	}
+	if marshalErr != nil {
+		return disko.CastToDriverError(marshalErr)
+	}
+
+	_, writeErr := handle.driver.image.WriteAt(
+		data, clusterOffset(handle.driver.bootSector, chain[0]))
+	if writeErr != nil {
+		return disko.ErrIOFailed.Wrap(writeErr)
+	}
+	return nil
+}
+
+func (handle *objectHandle) Stat() disko.FileStat {
+	if root := handle.fixedRoot(); root != nil {
+		return root.Stat()
+	}
+
+	bootSector := handle.driver.bootSector
+	stat := disko.FileStat{
+		InodeNumber:  uint64(handle.firstCluster()),
+		Nlinks:       1,
+		ModeFlags:    os.ModeDir | 0o777,
+		BlockSize:    int64(bootSector.BytesPerCluster),
+		CreatedAt:    disko.UndefinedTimestamp,
+		LastAccessed: disko.UndefinedTimestamp,
+		LastModified: disko.UndefinedTimestamp,
+		LastChanged:  disko.UndefinedTimestamp,
+		DeletedAt:    disko.UndefinedTimestamp,
+	}
+
+	if handle.isDeletedView {
+		stat.ModeFlags = os.ModeDir | 0o555
+		return stat
+	} else if !handle.isRoot() {
+		raw := &handle.raw
+		stat.ModeFlags = AttrFlagsToFileMode(raw.AttributeFlags).Perm()
+		if handle.isDeleted {
+			stat.ModeFlags &^= 0o222
+		}
+		if handle.isDir() {
+			stat.ModeFlags |= os.ModeDir
+		}
+		stat.Size = int64(raw.FileSize)
+		stat.CreatedAt = TimestampFromParts(raw.CreatedDate, raw.CreatedTime, raw.CreatedTimeMillis)
+		stat.LastAccessed = DateFromInt(raw.LastAccessedDate)
+		stat.LastModified = TimestampFromParts(raw.LastModifiedDate, raw.LastModifiedTime, 0)
+	}
+
+	// Directories don't record their size, so it's the length of their chain.
+	chain, err := handle.chain()
+	if err == nil {
+		stat.NumBlocks = int64(len(chain))
+	}
+	if handle.isDir() {
+		stat.Size = stat.NumBlocks * stat.BlockSize
+	} else if err == nil && handle.checkSize(chain) == nil {
+		if stat.Size > stat.NumBlocks*stat.BlockSize {
+			stat.Size = stat.NumBlocks * stat.BlockSize
+		}
+	} else if stat.Size > stat.NumBlocks*stat.BlockSize {
+		// Leave room for the whole size so the file can be opened. Reading the
+		// part the chain doesn't cover fails in ReadBlocks.
+		stat.NumBlocks = (stat.Size + stat.BlockSize - 1) / stat.BlockSize
+	}
+	return stat
+}
+
+// checkSize checks the size in a file's directory entry against its cluster
+// chain. The chain must have exactly as many clusters as the size needs. If it
+// doesn't and the mount is lenient, a warning is recorded and the file is
+// clamped to what the chain holds. Otherwise, this fails with
+// [disko.ErrFileSystemCorrupted].
+func (handle *objectHandle) checkSize(chain []uint) disko.DriverError {
+	if handle.isDir() || handle.isDeleted {
+		return nil
+	}
+
+	clusterSize := int64(handle.driver.bootSector.BytesPerCluster)
+	size := int64(handle.raw.FileSize)
+	chainSize := int64(len(chain)) * clusterSize
+	if size <= chainSize && size > chainSize-clusterSize {
+		return nil
+	} else if size == 0 && len(chain) == 0 {
+		return nil
+	}
+
+	return handle.driver.corrupted(
+		"file size doesn't match cluster chain",
+		disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf(
+				"%s: size is %d bytes, but its cluster chain holds %d",
+				handle.path(),
+				size,
+				chainSize,
+			),
+		),
+	)
+}
+
+// checkBlocks fails with [disko.ErrFileSystemCorrupted] if the blocks of an
+// object starting at `index` and covering `length` bytes go past the end of
+// its cluster chain.
+func (handle *objectHandle) checkBlocks(chain []uint, index c.LogicalBlock, length int) disko.DriverError {
+	bytesPerCluster := int(handle.driver.bootSector.BytesPerCluster)
+	count := (length + bytesPerCluster - 1) / bytesPerCluster
+	if int(index)+count <= len(chain) {
+		return nil
+	}
+	return disko.ErrFileSystemCorrupted.WithMessage(
+		fmt.Sprintf(
+			"%s: blocks %d to %d are past the end of its cluster chain of %d",
+			handle.path(),
+			index,
+			int(index)+count-1,
+			len(chain),
+		),
+	)
+}
+
+// Resize implements [disko.ObjectHandle], allocating or freeing clusters as
+// needed. Directories always keep at least one cluster.
+func (handle *objectHandle) Resize(newSize uint64) disko.DriverError {
+	if err := handle.checkWritable(); err != nil {
+		return err
+	} else if root := handle.fixedRoot(); root != nil {
+		return root.Resize(newSize)
+	} else if !handle.isDir() && newSize > uint64(Features.MaxFileSize) {
+		return disko.ErrFileTooLarge
+	}
+
+	bytesPerCluster := uint64(handle.driver.bootSector.BytesPerCluster)
+	count := uint((newSize + bytesPerCluster - 1) / bytesPerCluster)
+	if handle.isDir() && count == 0 {
+		count = 1
+	}
+
+	chain, err := handle.chain()
+	if err != nil {
+		return err
+	}
+
+	chain, err = handle.driver.resizeChain(chain, count)
+	if err != nil {
+		return err
+	}
+
+	if len(chain) == 0 {
+		handle.setFirstCluster(0)
+	} else {
+		handle.setFirstCluster(chain[0])
+	}
+	if !handle.isDir() {
+		handle.raw.FileSize = uint32(newSize)
+	}
+	return handle.markModified()
+}
+
+func (handle *objectHandle) ReadBlocks(index c.LogicalBlock, buffer []byte) disko.DriverError {
+	if root := handle.fixedRoot(); root != nil {
+		return root.ReadBlocks(index, buffer)
+	}
+
+	chain, err := handle.chain()
+	if err == nil {
+		err = handle.checkSize(chain)
+	}
+	if err == nil {
+		err = handle.checkBlocks(chain, index, len(buffer))
+	}
+	if err != nil {
+		return err
+	}
+
+	bytesPerCluster := int(handle.driver.bootSector.BytesPerCluster)
+	for i := 0; i*bytesPerCluster < len(buffer); i++ {
+		cluster := chain[int(index)+i]
+		_, readErr := handle.driver.image.ReadAt(
+			buffer[i*bytesPerCluster:(i+1)*bytesPerCluster],
+			clusterOffset(handle.driver.bootSector, cluster),
+		)
+		if readErr != nil {
+			return disko.ErrIOFailed.Wrap(readErr)
+		}
+	}
+	return nil
+}
+
+func (handle *objectHandle) WriteBlocks(index c.LogicalBlock, data []byte) disko.DriverError {
+	if err := handle.checkWritable(); err != nil {
+		return err
+	} else if root := handle.fixedRoot(); root != nil {
+		return root.WriteBlocks(index, data)
+	}
+
+	chain, err := handle.chain()
+	if err == nil {
+		err = handle.checkBlocks(chain, index, len(data))
+	}
+	if err != nil {
+		return err
+	}
+
+	bytesPerCluster := int(handle.driver.bootSector.BytesPerCluster)
+	for i := 0; i*bytesPerCluster < len(data); i++ {
+		cluster := chain[int(index)+i]
+		_, writeErr := handle.driver.image.WriteAt(
+			data[i*bytesPerCluster:(i+1)*bytesPerCluster],
+			clusterOffset(handle.driver.bootSector, cluster),
+		)
+		if writeErr != nil {
+			return disko.ErrIOFailed.Wrap(writeErr)
+		}
+	}
+	return handle.markModified()
+}
+
+func (handle *objectHandle) ZeroOutBlocks(startIndex c.LogicalBlock, count uint) disko.DriverError {
+	if err := handle.checkWritable(); err != nil {
+		return err
+	} else if root := handle.fixedRoot(); root != nil {
+		return root.ZeroOutBlocks(startIndex, count)
+	}
+
+	buffer := make([]byte, count*handle.driver.bootSector.BytesPerCluster)
+	return handle.WriteBlocks(startIndex, buffer)
+}
+
+// Unlink implements [disko.ObjectHandle]. The object's clusters are freed, and
+// its directory entry is marked deleted. Like DOS, the first character of the
+// name is saved in CreatedTimeMillis so that it can be undeleted.
+func (handle *objectHandle) Unlink() disko.DriverError {
+	if handle.isRoot() {
+		return disko.ErrNotPermitted.WithMessage("can't delete the root directory")
+	} else if err := handle.checkWritable(); err != nil {
+		return err
+	}
+
+	chain, err := handle.chain()
+	if err != nil {
+		return err
+	}
+
+	handle.raw.CreatedTimeMillis = handle.raw.Name[0]
+	handle.raw.Name[0] = 0xE5
+	err = handle.writeDirent()
+	if err != nil {
+		return err
+	}
+
+	_, err = handle.driver.resizeChain(chain, 0)
+	return err
+}
+
+func (handle *objectHandle) Name() string {
+	return handle.name
+}
+
+func (handle *objectHandle) SameAs(other disko.ObjectHandle) bool {
+	otherHandle, ok := other.(*objectHandle)
+	if !ok || otherHandle.driver != handle.driver {
+		return false
+	} else if handle.isRoot() || otherHandle.isRoot() {
+		return handle.isRoot() && otherHandle.isRoot()
+	}
+	return otherHandle.direntIndex == handle.direntIndex &&
+		otherHandle.isDeletedView == handle.isDeletedView &&
+		otherHandle.isDeleted == handle.isDeleted &&
+		otherHandle.parent.SameAs(handle.parent)
+}
+
+func (handle *objectHandle) Close() error {
+	if handle.closed {
+		return disko.ErrFileDescriptorBadState
+	}
+	handle.closed = true
+	return nil
+}
+
+// ListDir implements [disko.SupportsListDirHandle]. Entries hidden by the
+// driver's [AttributePolicy] are skipped. With [MountFlagsShowDeleted],
+// [DeletedViewName] is included if there are any recoverable deleted entries.
+func (handle *objectHandle) ListDir() ([]string, disko.DriverError) {
+	if handle.isDeletedView {
+		return handle.listDeletedView()
+	}
+
+	entries, err := handle.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		dirent := Dirent{AttributeFlags: int(entry.raw.AttributeFlags)}
+		if handle.driver.policy.IsListed(&dirent) {
+			names = append(names, entry.name)
+		}
+	}
+
+	if !handle.driver.showsDeleted() || handle.isDeleted {
+		return names, nil
+	}
+
+	deleted, err := handle.deletedEntries()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range deleted {
+		if entry.recoverable {
+			return append(names, DeletedViewName), nil
+		}
+	}
+	return names, nil
+}
+
+// Chmod implements [disko.SupportsChmodHandle]. The only permission FAT has is
+// [AttrReadOnly], which is set if the owner can't write to the object.
+func (handle *objectHandle) Chmod(mode os.FileMode) disko.DriverError {
+	if handle.isRoot() {
+		return nil
+	} else if err := handle.checkWritable(); err != nil {
+		return err
+	}
+
+	if mode&0o200 == 0 {
+		handle.raw.AttributeFlags |= AttrReadOnly
+	} else {
+		handle.raw.AttributeFlags &^= AttrReadOnly
+	}
+	return handle.writeDirent()
+}
+
+// Chtimes implements [disko.SupportsChtimesHandle]. FAT only stores the date an
+// object was last accessed, not the time.
+func (handle *objectHandle) Chtimes(
+	createdAt,
+	lastAccessed,
+	lastModified,
+	lastChanged,
+	deletedAt time.Time,
+) disko.DriverError {
+	if handle.isRoot() {
+		return nil
+	} else if err := handle.checkWritable(); err != nil {
+		return err
+	}
+
+	for _, timestamp := range []time.Time{createdAt, lastAccessed, lastModified} {
+		if isTimestampOutOfRange(timestamp) {
+			handle.driver.diagnostics.Add(
+				disko.DiagnosticTimestampClamped,
+				handle.path(),
+				fmt.Sprintf(
+					"%s is outside the range FAT can store, 1980 through 2107",
+					timestamp.Format(time.RFC3339),
+				),
+			)
+		}
+	}
+
+	setRawTimestamps(&handle.raw, createdAt, lastAccessed, lastModified)
+	return handle.writeDirent()
+}
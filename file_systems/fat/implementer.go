@@ -0,0 +1,447 @@
+package fat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+)
+
+// Driver implements [disko.FileSystemImplementer] for FAT12, FAT16, and FAT32,
+// so that FAT images can be used with the driver package's BaseDriver. Blocks
+// of files and directories are clusters.
+//
+// The FAT is kept in memory while the image is mounted, and written to every
+// copy of it on disk by [Driver.Flush]. Cluster data and directory entries are
+// written as soon as they change.
+type Driver struct {
+	stream      io.ReadWriteSeeker
+	image       *disks.Section
+	flags       disko.MountFlags
+	bootSector  *FATBootSector
+	rootCluster uint
+	fat         []byte
+	fatDirty    bool
+	policy      AttributePolicy
+	warnings    *disko.MountWarnings
+	diagnostics *disko.Diagnostics
+	clock       disko.Clock
+
+	// fsInfoOffset is the offset of the FAT32 FSInfo sector in the image, or 0
+	// if there isn't one we can update.
+	fsInfoOffset int64
+	// nextFree is the cluster to start looking for free clusters at. It's
+	// always 2 except on FAT32, where it's kept in the FSInfo sector.
+	nextFree uint
+}
+
+// NewDriver creates a FAT implementation for the image in `stream`. It
+// implements [disko.ImplementerConstructor].
+func NewDriver(stream io.ReadWriteSeeker) (disko.FileSystemImplementer, disko.DriverError) {
+	return &Driver{stream: stream, clock: disko.SystemClock{}}, nil
+}
+
+func (driver *Driver) Mount(flags disko.MountFlags) disko.DriverError {
+	if driver.bootSector != nil {
+		return disko.ErrAlreadyInProgress
+	}
+
+	writeFlags := disko.MountFlagsAllowWrite | disko.MountFlagsAllowInsert | disko.MountFlagsAllowDelete
+	if flags&MountFlagsShowDeleted != 0 && flags&writeFlags != 0 {
+		return disko.ErrInvalidArgument.WithMessage(
+			"deleted objects can only be shown on read-only mounts")
+	}
+
+	size, err := driver.stream.Seek(0, io.SeekEnd)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	} else if size < 512 {
+		return disko.ErrInvalidFileSystem.WithMessage(
+			"image is too small to contain a boot sector")
+	}
+
+	image, err := disks.NewWindow(driver.stream, 0, size)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+
+	rawSector := make([]byte, 512)
+	_, err = image.ReadAt(rawSector, 0)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+
+	options := CompatibilityOptionsFromMountFlags(flags)
+	bootSector, err := NewFATBootSectorFromStreamWithOptions(bytes.NewReader(rawSector), options)
+	if options.MSXDOS {
+		bootSector, err = resolveMSXDOSBootSector(image, size, bootSector, err)
+	}
+	if err != nil {
+		inferred, inferErr := InferDOS1BootSector(image, size)
+		if inferErr != nil {
+			return disko.CastToDriverError(err)
+		}
+		bootSector = inferred
+	}
+
+	fat, driverErr := readFAT(image, bootSector)
+	if driverErr != nil {
+		return driverErr
+	}
+
+	// The first copy of the FAT is the one DOS uses. If any others differ, a
+	// writable mount overwrites them with it on the next flush.
+	diagnostics := disko.NewDiagnostics()
+	differing, driverErr := differingFATCopies(image, bootSector, fat)
+	if driverErr != nil {
+		return driverErr
+	}
+	for _, index := range differing {
+		diagnostics.Add(
+			disko.DiagnosticCopiesDiffer,
+			"",
+			fmt.Sprintf("copy %d of the FAT differs from the first, which is used instead", index),
+		)
+	}
+
+	driver.fsInfoOffset = 0
+	driver.nextFree = 2
+	if bootSector.FATVersion == 32 {
+		driver.rootCluster = uint(binary.LittleEndian.Uint32(rawSector[fat32RootClusterOffset:]))
+		driver.fsInfoOffset, driver.nextFree, driverErr = readFSInfo(image, bootSector, rawSector)
+		if driverErr != nil {
+			return driverErr
+		}
+	}
+	driver.image = image
+	driver.flags = flags
+	driver.bootSector = bootSector
+	driver.fat = fat
+	driver.policy = AttributePolicyFromMountFlags(flags)
+	driver.warnings = disko.NewMountWarnings(flags)
+	driver.diagnostics = diagnostics
+	driver.fatDirty = len(differing) > 0 && flags.CanWrite()
+	return nil
+}
+
+// MountWarnings implements [disko.MountWarningsImplementer]. Problems with
+// directory entries are found as directories are read, so they're added after
+// the mount.
+func (driver *Driver) MountWarnings() []disko.MountWarning {
+	return driver.warnings.List()
+}
+
+// Diagnostics implements [disko.DiagnosticsImplementer].
+func (driver *Driver) Diagnostics() []disko.Diagnostic {
+	return driver.diagnostics.List()
+}
+
+// corrupted returns `err` unless the mount is lenient, in which case it records
+// a warning about `problem` and returns nil.
+func (driver *Driver) corrupted(problem string, err disko.DriverError) disko.DriverError {
+	return driver.warnings.Unsupported(problem, err)
+}
+
+// SetClock implements [disko.ClockImplementer].
+func (driver *Driver) SetClock(clock disko.Clock) {
+	driver.clock = clock
+}
+
+// Flush implements [disko.FileSystemImplementer]. Cluster data and directory
+// entries are written as soon as they change, and so are the FAT entries of
+// newly allocated clusters, before anything refers to them. What remains is
+// the rest of the FAT, i.e. clusters that were freed, along with the FSInfo
+// sector on FAT32.
+func (driver *Driver) Flush() disko.DriverError {
+	if !driver.fatDirty {
+		return nil
+	}
+
+	err := writeFATs(driver.image, driver.bootSector, driver.fat)
+	if err != nil {
+		return err
+	}
+	err = driver.writeFSInfo()
+	if err != nil {
+		return err
+	}
+	driver.fatDirty = false
+	return nil
+}
+
+func (driver *Driver) Unmount() disko.DriverError {
+	err := driver.Flush()
+	if err != nil {
+		return err
+	}
+	driver.bootSector = nil
+	driver.fat = nil
+	return nil
+}
+
+// showsDeleted returns true if directories have a [DeletedViewName] directory
+// in them. See [MountFlagsShowDeleted].
+func (driver *Driver) showsDeleted() bool {
+	return driver.flags&MountFlagsShowDeleted != 0
+}
+
+func (driver *Driver) GetRootDirectory() disko.ObjectHandle {
+	return &objectHandle{driver: driver, name: "/"}
+}
+
+func (driver *Driver) FSStat() disko.FSStat {
+	free := uint64(0)
+	for cluster := uint(2); cluster < driver.bootSector.TotalClusters+2; cluster++ {
+		if fatEntry(driver.fat, driver.bootSector.FATVersion, cluster) == 0 {
+			free++
+		}
+	}
+
+	return disko.FSStat{
+		BlockSize:       driver.bootSector.BytesPerCluster,
+		TotalBlocks:     uint64(driver.bootSector.TotalClusters),
+		BlocksFree:      free,
+		BlocksAvailable: free,
+		MaxNameLength:   12,
+	}
+}
+
+func (driver *Driver) GetFSFeatures() disko.FSFeatures {
+	return Features
+}
+
+func (driver *Driver) GetObject(
+	name string,
+	parent disko.ObjectHandle,
+) (disko.ObjectHandle, disko.DriverError) {
+	directory, err := asDirectory(parent)
+	if err != nil {
+		return nil, err
+	}
+
+	if directory.isDeletedView {
+		return directory.getInDeletedView(name)
+	} else if name == DeletedViewName && driver.showsDeleted() && !directory.isDeleted {
+		return directory.deletedView(), nil
+	}
+
+	entries, err := directory.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if !strings.EqualFold(entry.name, name) {
+			continue
+		} else if directory.isDeleted {
+			// Everything in a deleted directory was deleted along with it.
+			return directory.deletedChild(entry), nil
+		} else {
+			return &objectHandle{
+				driver:      driver,
+				parent:      directory,
+				direntIndex: entry.index,
+				raw:         entry.raw,
+				name:        entry.name,
+			}, nil
+		}
+	}
+	return nil, disko.ErrNotFound.WithMessage(
+		fmt.Sprintf("no file named %q in %q", name, directory.name))
+}
+
+// CreateObject implements [disko.FileSystemImplementer]. `name` must be a valid
+// 8.3 file name, and is converted to upper case. New directories get one
+// cluster, with "." and ".." entries.
+func (driver *Driver) CreateObject(
+	name string,
+	parent disko.ObjectHandle,
+	perm os.FileMode,
+) (disko.ObjectHandle, disko.DriverError) {
+	directory, err := asDirectory(parent)
+	if err != nil {
+		return nil, err
+	} else if err = directory.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	baseName, extension, nameErr := ShortNameFromString(name)
+	if nameErr != nil {
+		return nil, disko.CastToDriverError(nameErr)
+	} else if !perm.IsDir() && !perm.IsRegular() {
+		return nil, disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf("FAT can't store objects of type %s", perm.Type()))
+	}
+
+	index, err := directory.findFreeEntry()
+	if err != nil {
+		return nil, err
+	}
+
+	now := driver.clock.Now()
+	raw := RawDirent{Name: baseName, Extension: extension}
+	setRawTimestamps(&raw, now, now, now)
+	if perm&0o200 == 0 {
+		raw.AttributeFlags |= AttrReadOnly
+	}
+	if !driver.policy.PreserveArchiveBit {
+		raw.AttributeFlags |= AttrArchived
+	}
+
+	dirent, direntErr := NewDirentFromRaw(driver.bootSector, &raw)
+	if direntErr != nil {
+		return nil, disko.CastToDriverError(direntErr)
+	}
+
+	object := &objectHandle{
+		driver:      driver,
+		parent:      directory,
+		direntIndex: index,
+		raw:         raw,
+		name:        dirent.Name(),
+	}
+
+	if perm.IsDir() {
+		object.raw.AttributeFlags |= AttrDirectory
+		err = object.initDirectory()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = object.writeDirent()
+	if err != nil {
+		return nil, err
+	}
+
+	// DOS names are upper case, so the name may not be stored as given.
+	if object.name != name {
+		driver.diagnostics.Add(
+			disko.DiagnosticNameTransliterated,
+			object.path(),
+			fmt.Sprintf("%q was stored as %q", name, object.name),
+		)
+	}
+	return object, nil
+}
+
+// asDirectory returns `handle` as a FAT directory.
+func asDirectory(handle disko.ObjectHandle) (*objectHandle, disko.DriverError) {
+	directory, ok := handle.(*objectHandle)
+	if !ok {
+		return nil, disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("expected a FAT object handle, got %T", handle))
+	} else if !directory.isDir() {
+		return nil, disko.ErrNotADirectory.WithMessage(
+			fmt.Sprintf("%q is not a directory", directory.name))
+	}
+	return directory, nil
+}
+
+// endOfChainMarker returns the FAT entry value written to the last cluster of a
+// chain.
+func (driver *Driver) endOfChainMarker() uint32 {
+	return badClusterMarker(driver.bootSector.FATVersion) + 8
+}
+
+// chain returns the clusters in the chain beginning at `first`, or nil if
+// `first` is 0, i.e. nothing is allocated.
+func (driver *Driver) chain(first uint) ([]uint, disko.DriverError) {
+	if first == 0 {
+		return nil, nil
+	}
+	return readClusterChain(driver.bootSector, driver.fat, first)
+}
+
+// resizeChain grows or shrinks `chain` to `count` clusters, and returns the
+// new chain. New clusters are filled with null bytes. If there aren't enough
+// free clusters, it fails with [disko.ErrNoSpaceOnDevice] without changing
+// anything.
+//
+// Free clusters are searched for starting at the next free cluster hint,
+// wrapping around to cluster 2. On FAT32 the hint is then moved past the last
+// cluster allocated, so large volumes don't rescan the full part of the FAT
+// every time a file grows.
+func (driver *Driver) resizeChain(chain []uint, count uint) ([]uint, disko.DriverError) {
+	bootSector := driver.bootSector
+	current := uint(len(chain))
+
+	if count < current {
+		if count > 0 {
+			setFATEntry(driver.fat, bootSector.FATVersion, chain[count-1], driver.endOfChainMarker())
+		}
+		for _, cluster := range chain[count:] {
+			setFATEntry(driver.fat, bootSector.FATVersion, cluster, 0)
+		}
+		driver.fatDirty = true
+		return chain[:count], nil
+	} else if count == current {
+		return chain, nil
+	}
+
+	newClusters := make([]uint, 0, count-current)
+	cluster := driver.nextFree
+	for scanned := uint(0); scanned < bootSector.TotalClusters; scanned++ {
+		if uint(len(newClusters)) == count-current {
+			break
+		} else if fatEntry(driver.fat, bootSector.FATVersion, cluster) == 0 {
+			newClusters = append(newClusters, cluster)
+		}
+		cluster++
+		if cluster >= bootSector.TotalClusters+2 {
+			cluster = 2
+		}
+	}
+	if uint(len(newClusters)) < count-current {
+		return nil, disko.ErrNoSpaceOnDevice.WithMessage(
+			fmt.Sprintf(
+				"need %d free clusters, only %d available",
+				count-current,
+				len(newClusters),
+			),
+		)
+	}
+
+	zeroes := make([]byte, bootSector.BytesPerCluster)
+	for _, cluster := range newClusters {
+		_, err := driver.image.WriteAt(zeroes, clusterOffset(bootSector, cluster))
+		if err != nil {
+			return nil, disko.ErrIOFailed.Wrap(err)
+		}
+	}
+
+	newChain := append(chain[:current:current], newClusters...)
+	for i := current; i < count; i++ {
+		next := driver.endOfChainMarker()
+		if i+1 < count {
+			next = uint32(newChain[i+1])
+		}
+		setFATEntry(driver.fat, bootSector.FATVersion, newChain[i], next)
+	}
+	if current > 0 {
+		setFATEntry(driver.fat, bootSector.FATVersion, chain[current-1], uint32(newClusters[0]))
+	}
+	if bootSector.FATVersion == 32 {
+		driver.nextFree = cluster
+	}
+	driver.fatDirty = true
+
+	// The caller is about to write a directory entry or a directory's contents
+	// pointing at the new clusters, so they must be marked used on disk first.
+	// Freed clusters can wait for Flush, since the entries that used them were
+	// already written.
+	changed := newClusters
+	if current > 0 {
+		changed = newChain[current-1:]
+	}
+	err := writeFATEntries(driver.image, bootSector, driver.fat, changed)
+	if err != nil {
+		return nil, err
+	}
+	return newChain, nil
+}
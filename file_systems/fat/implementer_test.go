@@ -0,0 +1,234 @@
+package fat_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/fat"
+	diskotest "github.com/dargueta/disko/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xaionaro-go/bytesextra"
+)
+
+// mountFloppy mounts `image` with the FAT implementation and returns a driver
+// for it, along with the implementation so the test can unmount it.
+func mountFloppy(t *testing.T, image []byte) (*driver.BaseDriver, disko.FileSystemImplementer) {
+	implementation, err := fat.NewDriver(bytesextra.NewReadWriteSeeker(image))
+	require.NoError(t, err)
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowAll))
+	return driver.New(implementation, disko.MountFlagsAllowAll), implementation
+}
+
+func TestDriver__WriteAndReadBack(t *testing.T) {
+	image := makeFloppyImage()
+	fs, implementation := mountFloppy(t, image)
+
+	contents := bytes.Repeat([]byte("0123456789"), 150)
+	require.NoError(t, fs.Mkdir("/subdir", 0o755))
+	require.NoError(t, fs.WriteFile("/subdir/file.txt", contents, 0o644))
+	require.NoError(t, fs.Flush())
+	require.NoError(t, implementation.Unmount())
+
+	fs, _ = mountFloppy(t, image)
+	data, err := fs.ReadFile("/SUBDIR/FILE.TXT")
+	require.NoError(t, err)
+	assert.Equal(t, contents, data)
+
+	entries, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "SUBDIR", entries[0].Name())
+	assert.True(t, entries[0].IsDir())
+
+	stat, err := fs.Stat("/subdir/file.txt")
+	require.NoError(t, err)
+	assert.EqualValues(t, len(contents), stat.Size)
+	assert.EqualValues(t, 3, stat.NumBlocks)
+}
+
+// makeFAT16Image creates a freshly formatted 16 MiB FAT16 image with 2 KiB
+// clusters.
+func makeFAT16Image() []byte {
+	image := make([]byte, 32768*512)
+	copy(image, []byte{0xEB, 0x3C, 0x90})
+	copy(image[3:], "MSDOS5.0")
+	binary.LittleEndian.PutUint16(image[11:], 512)   // Bytes per sector
+	image[13] = 4                                    // Sectors per cluster
+	binary.LittleEndian.PutUint16(image[14:], 1)     // Reserved sectors
+	image[16] = 2                                    // Number of FATs
+	binary.LittleEndian.PutUint16(image[17:], 512)   // Root directory entries
+	binary.LittleEndian.PutUint16(image[19:], 32768) // Total sectors
+	image[21] = 0xF8                                 // Media descriptor
+	binary.LittleEndian.PutUint16(image[22:], 32)    // Sectors per FAT
+	binary.LittleEndian.PutUint16(image[24:], 63)    // Sectors per track
+	binary.LittleEndian.PutUint16(image[26:], 16)    // Heads
+	image[38] = 0x29
+	binary.LittleEndian.PutUint32(image[39:], 0x5678CDEF)
+	copy(image[43:], "FAT16TEST  ")
+	copy(image[54:], "FAT16   ")
+	image[510] = 0x55
+	image[511] = 0xAA
+
+	for _, fatStart := range []int{512, 33 * 512} {
+		copy(image[fatStart:], []byte{0xF8, 0xFF, 0xFF, 0xFF})
+	}
+	return image
+}
+
+// Writes to FAT16 images allocate 16-bit FAT entries, including clusters past
+// the 4085 a FAT12 volume can address.
+func TestDriver__FAT16WriteAndReadBack(t *testing.T) {
+	image := makeFAT16Image()
+	fs, implementation := mountFloppy(t, image)
+	freeBefore := implementation.FSStat().BlocksFree
+	require.EqualValues(t, 8167, freeBefore)
+
+	// 5000 clusters' worth of data, so the chain runs past cluster 4085.
+	contents := make([]byte, 5000*2048)
+	for i := range contents {
+		contents[i] = byte(i / 2048)
+	}
+	require.NoError(t, fs.Mkdir("/data", 0o755))
+	require.NoError(t, fs.WriteFile("/data/big.bin", contents, 0o644))
+	require.NoError(t, fs.WriteFile("/small.txt", []byte("hello"), 0o644))
+	require.NoError(t, fs.Flush())
+	require.NoError(t, implementation.Unmount())
+
+	fs, implementation = mountFloppy(t, image)
+	data, err := fs.ReadFile("/DATA/BIG.BIN")
+	require.NoError(t, err)
+	assert.Equal(t, contents, data)
+
+	data, err = fs.ReadFile("/SMALL.TXT")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	// One cluster for the directory, 5000 for the big file, one for the small.
+	assert.Equal(t, freeBefore-5002, implementation.FSStat().BlocksFree)
+
+	require.NoError(t, fs.Remove("/data/big.bin"))
+	assert.Equal(t, freeBefore-2, implementation.FSStat().BlocksFree)
+}
+
+func TestDriver__RemoveFreesClusters(t *testing.T) {
+	fs, implementation := mountFloppy(t, makeFloppyImage())
+	freeBefore := implementation.FSStat().BlocksFree
+
+	require.NoError(t, fs.WriteFile("/file.bin", make([]byte, 4000), 0o644))
+	assert.Equal(t, freeBefore-8, implementation.FSStat().BlocksFree)
+
+	require.NoError(t, fs.Remove("/file.bin"))
+	assert.Equal(t, freeBefore, implementation.FSStat().BlocksFree)
+
+	_, err := fs.Stat("/file.bin")
+	assert.ErrorIs(t, err, disko.ErrNotFound)
+}
+
+func TestDriver__FATWrittenBeforeDirents(t *testing.T) {
+	image := makeFloppyImage()
+	fs, implementation := mountFloppy(t, image)
+
+	contents := bytes.Repeat([]byte("0123456789"), 150)
+	require.NoError(t, fs.Mkdir("/subdir", 0o755))
+	require.NoError(t, fs.WriteFile("/subdir/file.txt", contents, 0o644))
+
+	// Without flushing, the image must already be consistent: every cluster a
+	// directory entry points to is marked used in both copies of the FAT.
+	snapshot := append([]byte(nil), image...)
+	assert.Equal(t, image[512:10*512], snapshot[10*512:19*512])
+
+	snapshotFS, snapshotImplementation := mountFloppy(t, snapshot)
+	assert.Equal(t, implementation.FSStat().BlocksFree, snapshotImplementation.FSStat().BlocksFree)
+	data, err := snapshotFS.ReadFile("/SUBDIR/FILE.TXT")
+	require.NoError(t, err)
+	assert.Equal(t, contents, data)
+}
+
+func TestDriver__SubdirectoryGrows(t *testing.T) {
+	fs, _ := mountFloppy(t, makeFloppyImage())
+	require.NoError(t, fs.Mkdir("/dir", 0o755))
+
+	// A 512-byte cluster holds 16 entries, two of which are "." and "..".
+	for i := 0; i < 20; i++ {
+		require.NoError(t, fs.WriteFile(fmt.Sprintf("/dir/f%d", i), []byte{byte(i)}, 0o644))
+	}
+
+	entries, err := fs.ReadDir("/dir")
+	require.NoError(t, err)
+	assert.Len(t, entries, 20)
+
+	data, err := fs.ReadFile("/dir/f19")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{19}, data)
+}
+
+func TestDriver__RootDirectoryFull(t *testing.T) {
+	fs, _ := mountFloppy(t, makeFloppyImage())
+	for i := 0; i < 224; i++ {
+		require.NoError(t, fs.WriteFile(fmt.Sprintf("/f%d", i), nil, 0o644))
+	}
+
+	err := fs.WriteFile("/onemore", nil, 0o644)
+	assert.ErrorIs(t, err, disko.ErrNoSpaceOnDevice)
+}
+
+func TestDriver__InvalidNames(t *testing.T) {
+	fs, _ := mountFloppy(t, makeFloppyImage())
+
+	err := fs.WriteFile("/longfilename.txt", nil, 0o644)
+	assert.ErrorIs(t, err, disko.ErrNameTooLong)
+
+	err = fs.WriteFile("/a+b.txt", nil, 0o644)
+	assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+}
+
+func TestDriver__PathTooLongForDOS(t *testing.T) {
+	fs, _ := mountFloppy(t, makeFloppyImage())
+
+	// Six levels of eight-character names make a path of 54 bytes.
+	path := ""
+	for i := 1; i <= 6; i++ {
+		path += fmt.Sprintf("/DIR%05d", i)
+		require.NoError(t, fs.Mkdir(path, 0o755))
+	}
+
+	require.NoError(t, fs.WriteFile(path+"/ABCDEFG.J", nil, 0o644))
+	err := fs.WriteFile(path+"/ABCDEFGH.J", nil, 0o644)
+	assert.ErrorIs(t, err, disko.ErrNameTooLong)
+	assert.ErrorContains(t, err, "path is 65 bytes, file system allows at most 64")
+}
+
+func TestDriver__ChtimesIsRoundedPredictably(t *testing.T) {
+	fs, _ := mountFloppy(t, makeFloppyImage())
+	require.NoError(t, fs.WriteFile("/file.txt", []byte("x"), 0o644))
+
+	timestamp := time.Date(1999, time.December, 31, 23, 59, 59, 987_654_321, time.Local)
+	require.NoError(t, fs.Chtimes("/file.txt", timestamp, timestamp))
+
+	stat, err := fs.Stat("/file.txt")
+	require.NoError(t, err)
+
+	features := fs.GetFSFeatures()
+	assert.Equal(
+		t,
+		disko.RoundTimestamp(timestamp, features.ModifiedTimeResolution, features.TimestampRounding),
+		stat.LastModified,
+	)
+	assert.Equal(t, time.Date(1999, time.December, 31, 23, 59, 58, 0, time.Local), stat.LastModified)
+	assert.Equal(
+		t,
+		disko.RoundTimestamp(timestamp, features.AccessedTimeResolution, features.TimestampRounding),
+		stat.LastAccessed,
+	)
+	assert.Equal(t, time.Date(1999, time.December, 31, 0, 0, 0, 0, time.Local), stat.LastAccessed)
+}
+
+func TestDriver__Conformance(t *testing.T) {
+	diskotest.RunImplementerConformanceTests(t, fat.NewDriver, makeFloppyImage())
+}
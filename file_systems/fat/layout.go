@@ -0,0 +1,189 @@
+package fat
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dargueta/disko"
+)
+
+// Layout returns the regions of a FAT image: the boot sector, each copy of the
+// FAT, the root directory and the entries in it, and the data area. It
+// implements the layout function for [disko.FileSystemRegistration].
+//
+// FAT32 keeps its root directory in the data area like any other directory, so
+// for FAT32 images the root directory isn't broken out.
+func Layout(image io.ReaderAt, size int64) ([]disko.LayoutRegion, disko.DriverError) {
+	bootSector, _, err := readBootSector(image, size)
+	if err != nil {
+		return nil, err
+	}
+
+	sectorSize := int64(bootSector.BytesPerSector)
+	regions := []disko.LayoutRegion{
+		{
+			Offset: 0,
+			Length: sectorSize,
+			Name:   "Boot sector",
+			Details: fmt.Sprintf(
+				"FAT%d, %d bytes per sector, %d sectors per cluster",
+				bootSector.FATVersion,
+				bootSector.BytesPerSector,
+				bootSector.SectorsPerCluster,
+			),
+		},
+	}
+
+	if bootSector.ReservedSectors > 1 {
+		regions = append(
+			regions,
+			disko.LayoutRegion{
+				Offset: sectorSize,
+				Length: int64(bootSector.ReservedSectors-1) * sectorSize,
+				Name:   "Reserved sectors",
+			},
+		)
+	}
+
+	fatSize := int64(bootSector.SectorsPerFAT) * sectorSize
+	fatStart := int64(bootSector.ReservedSectors) * sectorSize
+	for i := int64(0); i < int64(bootSector.NumFATs); i++ {
+		regions = append(
+			regions,
+			disko.LayoutRegion{
+				Offset: fatStart + i*fatSize,
+				Length: fatSize,
+				Name:   fmt.Sprintf("FAT copy %d", i+1),
+			},
+		)
+	}
+
+	rootDirStart := fatStart + int64(bootSector.NumFATs)*fatSize
+	rootDirSize := int64(bootSector.RootDirSectors) * sectorSize
+	if rootDirSize > 0 {
+		regions = append(
+			regions,
+			disko.LayoutRegion{
+				Offset:  rootDirStart,
+				Length:  rootDirSize,
+				Name:    "Root directory",
+				Details: fmt.Sprintf("%d entries", bootSector.RootEntryCount),
+			},
+		)
+
+		direntRegions, err := rootDirentRegions(image, rootDirStart, rootDirSize)
+		if err != nil {
+			return nil, err
+		}
+		regions = append(regions, direntRegions...)
+	}
+
+	dataStart := int64(bootSector.FirstDataSector) * sectorSize
+	if dataStart < size {
+		regions = append(
+			regions,
+			disko.LayoutRegion{
+				Offset: dataStart,
+				Length: size - dataStart,
+				Name:   "Data area",
+				Details: fmt.Sprintf(
+					"%d clusters of %d bytes, starting at cluster 2",
+					bootSector.TotalClusters,
+					bootSector.BytesPerCluster,
+				),
+			},
+		)
+	}
+	return regions, nil
+}
+
+// rootDirentRegions returns a region for every directory entry in use in the
+// root directory, stopping at the first entry that marks the end of the
+// directory.
+func rootDirentRegions(
+	image io.ReaderAt,
+	rootDirStart int64,
+	rootDirSize int64,
+) ([]disko.LayoutRegion, disko.DriverError) {
+	rootDir := make([]byte, rootDirSize)
+	_, err := image.ReadAt(rootDir, rootDirStart)
+	if err != nil && err != io.EOF {
+		return nil, disko.ErrIOFailed.Wrap(err)
+	}
+
+	regions := []disko.LayoutRegion{}
+	for offset := 0; offset+32 <= len(rootDir); offset += 32 {
+		rawEntry := rootDir[offset : offset+32]
+		if rawEntry[0] == 0 {
+			// End of directory
+			break
+		}
+
+		dirent, err := NewRawDirentFromBytes(rawEntry)
+		if err != nil {
+			return nil, disko.CastToDriverError(err)
+		}
+
+		name := "Directory entry"
+		if rawEntry[0] == 0xE5 {
+			name = "Deleted directory entry"
+		}
+		regions = append(
+			regions,
+			disko.LayoutRegion{
+				Offset:  rootDirStart + int64(offset),
+				Length:  32,
+				Name:    name,
+				Details: describeRawDirent(&dirent),
+			},
+		)
+	}
+	return regions, nil
+}
+
+// describeRawDirent summarizes a directory entry for [Layout].
+func describeRawDirent(dirent *RawDirent) string {
+	baseName := dirent.Name
+	if baseName[0] == 0xE5 {
+		baseName[0] = '?'
+	}
+	name := ShortNameToString(baseName, dirent.Extension)
+
+	attributes := []string{}
+	for _, flag := range []struct {
+		mask uint8
+		name string
+	}{
+		{AttrReadOnly, "read-only"},
+		{AttrHidden, "hidden"},
+		{AttrSystem, "system"},
+		{AttrVolumeLabel, "volume label"},
+		{AttrDirectory, "directory"},
+		{AttrArchived, "archived"},
+	} {
+		if dirent.AttributeFlags&flag.mask != 0 {
+			attributes = append(attributes, flag.name)
+		}
+	}
+	if len(attributes) == 0 {
+		attributes = append(attributes, "none")
+	}
+
+	firstCluster := uint32(dirent.FirstClusterHigh)<<16 | uint32(dirent.FirstClusterLow)
+	modified := "never"
+	if dirent.LastModifiedDate != 0 {
+		modified = TimestampFromParts(
+			dirent.LastModifiedDate, dirent.LastModifiedTime, 0,
+		).Format("2006-01-02 15:04:05")
+	}
+
+	return fmt.Sprintf(
+		"name=%q attributes=%s size=%d first_cluster=%d modified=%s",
+		name,
+		strings.Join(attributes, ","),
+		dirent.FileSize,
+		firstCluster,
+		modified,
+	)
+}
@@ -0,0 +1,56 @@
+package fat_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayout__FAT12Floppy(t *testing.T) {
+	image := makeFloppyImage()
+
+	// The root directory starts right after the two FATs, at sector 19.
+	rootDir := image[19*512:]
+	copy(rootDir, "README  TXT")
+	rootDir[11] = fat.AttrArchived
+	binary.LittleEndian.PutUint16(rootDir[22:], 12<<11|34<<5|28) // 12:34:56
+	binary.LittleEndian.PutUint16(rootDir[24:], 43<<9|7<<5|4)    // 2023-07-04
+	binary.LittleEndian.PutUint16(rootDir[26:], 2)
+	binary.LittleEndian.PutUint32(rootDir[28:], 1000)
+
+	regions, err := fat.Layout(bytes.NewReader(image), int64(len(image)))
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, region := range regions {
+		names = append(names, region.Name)
+	}
+	assert.Equal(
+		t,
+		[]string{
+			"Boot sector",
+			"FAT copy 1",
+			"FAT copy 2",
+			"Root directory",
+			"Directory entry",
+			"Data area",
+		},
+		names,
+	)
+
+	assert.EqualValues(t, 512, regions[1].Offset, "wrong offset for FAT copy 1")
+	assert.EqualValues(t, 10*512, regions[2].Offset, "wrong offset for FAT copy 2")
+	assert.EqualValues(t, 19*512, regions[3].Offset, "wrong offset for root directory")
+	assert.EqualValues(t, 14*512, regions[3].Length, "wrong root directory size")
+	assert.EqualValues(t, 33*512, regions[5].Offset, "wrong offset for data area")
+	assert.Equal(
+		t,
+		`name="README.TXT" attributes=archived size=1000 first_cluster=2`+
+			` modified=2023-07-04 12:34:56`,
+		regions[4].Details,
+	)
+}
@@ -0,0 +1,28 @@
+package fat
+
+import "github.com/dargueta/disko"
+
+// FAT-specific mount flags. They use the bits from [disko.MountFlagsCustomStart]
+// up, so they can be combined with the flags defined by the API.
+const (
+	// MountFlagsAllowSmallSectors enables
+	// [CompatibilityOptions.AllowSmallSectors].
+	MountFlagsAllowSmallSectors = disko.MountFlagsCustomStart << iota
+
+	// MountFlagsAtariST enables [CompatibilityOptions.AtariST].
+	MountFlagsAtariST
+
+	// MountFlagsPreserveArchiveBit enables [AttributePolicy.PreserveArchiveBit].
+	MountFlagsPreserveArchiveBit
+
+	// MountFlagsHideHiddenFiles enables [AttributePolicy.HideHiddenFiles].
+	MountFlagsHideHiddenFiles
+
+	// MountFlagsShowDeleted adds a virtual directory named [DeletedViewName] to
+	// every directory with deleted entries in it, containing the objects that
+	// look recoverable. It can only be used with read-only mounts.
+	MountFlagsShowDeleted
+
+	// MountFlagsMSXDOS enables [CompatibilityOptions.MSXDOS].
+	MountFlagsMSXDOS
+)
@@ -0,0 +1,30 @@
+package fat_test
+
+import (
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/stretchr/testify/assert"
+)
+
+// Every FAT-specific flag is a single bit of its own, clear of the flags the
+// API defines.
+func TestMountFlags__Distinct(t *testing.T) {
+	flags := []disko.MountFlags{
+		fat.MountFlagsAllowSmallSectors,
+		fat.MountFlagsAtariST,
+		fat.MountFlagsPreserveArchiveBit,
+		fat.MountFlagsHideHiddenFiles,
+		fat.MountFlagsShowDeleted,
+		fat.MountFlagsMSXDOS,
+	}
+
+	seen := disko.MountFlags(0)
+	for _, flag := range flags {
+		assert.Zero(t, flag&(flag-1), "%#x isn't a single bit", flag)
+		assert.GreaterOrEqual(t, flag, disko.MountFlagsCustomStart)
+		assert.Zero(t, seen&flag, "%#x is used more than once", flag)
+		seen |= flag
+	}
+}
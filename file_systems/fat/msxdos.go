@@ -0,0 +1,230 @@
+package fat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+	"github.com/dargueta/disko/utilities/binstruct"
+)
+
+// msxBootCodeOffset is where the disk ROM of an MSX calls the boot sector,
+// immediately after the BPB.
+const msxBootCodeOffset = 0x1E
+
+// msxReturnToBASIC is the boot code [NewMSXDOSBootSector] writes if none is
+// given. It's a Z80 RET, which hands control back to the disk ROM so the
+// machine starts Disk BASIC.
+var msxReturnToBASIC = []byte{0xC9}
+
+// msxFormats gives the BPB of the 3.5" floppy formats MSX-DOS adds to the DOS
+// 1.x ones, keyed by media descriptor. MSX-DOS 1 ignores the BPB and gets the
+// format from the media descriptor in the first FAT entry, so many disks have
+// a BPB that's wrong or missing.
+var msxFormats = map[uint8]RawFATBootSectorWithBPB{
+	// 360 KiB, single-sided, 80 tracks of 9 sectors
+	0xF8: {
+		BytesPerSector:    512,
+		SectorsPerCluster: 2,
+		ReservedSectors:   1,
+		NumFATs:           2,
+		RootEntryCount:    112,
+		TotalSectors16:    720,
+		Media:             0xF8,
+		SectorsPerFAT16:   2,
+		SectorsPerTrack:   9,
+		NumHeads:          1,
+	},
+	// 720 KiB, double-sided, 80 tracks of 9 sectors
+	0xF9: {
+		BytesPerSector:    512,
+		SectorsPerCluster: 2,
+		ReservedSectors:   1,
+		NumFATs:           2,
+		RootEntryCount:    112,
+		TotalSectors16:    1440,
+		Media:             0xF9,
+		SectorsPerFAT16:   3,
+		SectorsPerTrack:   9,
+		NumHeads:          2,
+	},
+	// 320 KiB, single-sided, 80 tracks of 8 sectors
+	0xFA: {
+		BytesPerSector:    512,
+		SectorsPerCluster: 2,
+		ReservedSectors:   1,
+		NumFATs:           2,
+		RootEntryCount:    112,
+		TotalSectors16:    640,
+		Media:             0xFA,
+		SectorsPerFAT16:   1,
+		SectorsPerTrack:   8,
+		NumHeads:          1,
+	},
+	// 640 KiB, double-sided, 80 tracks of 8 sectors
+	0xFB: {
+		BytesPerSector:    512,
+		SectorsPerCluster: 2,
+		ReservedSectors:   1,
+		NumFATs:           2,
+		RootEntryCount:    112,
+		TotalSectors16:    1280,
+		Media:             0xFB,
+		SectorsPerFAT16:   2,
+		SectorsPerTrack:   8,
+		NumHeads:          2,
+	},
+}
+
+// MSXDOSFormat returns the BPB MSX-DOS uses for the floppy format with media
+// descriptor `media`, or false if it isn't one MSX-DOS supports. Besides its
+// own 3.5" formats (0xF8 to 0xFB), MSX-DOS supports the four DOS 1.x formats.
+func MSXDOSFormat(media uint8) (RawFATBootSectorWithBPB, bool) {
+	bpb, ok := msxFormats[media]
+	if !ok {
+		bpb, ok = dos1Formats[media]
+	}
+	return bpb, ok
+}
+
+// MSXDOSFormatForGeometry returns the BPB MSX-DOS uses for floppies with the
+// given geometry, such as the predefined "msx_312in_ds_dd_9". It fails if
+// MSX-DOS has no format for it.
+func MSXDOSFormatForGeometry(geometry disks.DiskGeometry) (RawFATBootSectorWithBPB, error) {
+	for media := 0xF8; media <= 0xFF; media++ {
+		bpb, _ := MSXDOSFormat(uint8(media))
+		tracks := uint(bpb.TotalSectors16) / uint(bpb.SectorsPerTrack) / uint(bpb.NumHeads)
+		if geometry.AddressUnitsPerSector == uint(bpb.BytesPerSector) &&
+			geometry.SectorsPerTrack == uint(bpb.SectorsPerTrack) &&
+			geometry.Heads == uint(bpb.NumHeads) &&
+			geometry.TotalDataTracks == tracks {
+			return bpb, nil
+		}
+	}
+	return RawFATBootSectorWithBPB{}, disko.ErrNotSupported.WithMessage(
+		fmt.Sprintf(
+			"MSX-DOS has no format for %d tracks of %d %d-byte sectors on %d side(s)",
+			geometry.TotalDataTracks,
+			geometry.SectorsPerTrack,
+			geometry.AddressUnitsPerSector,
+			geometry.Heads,
+		),
+	)
+}
+
+// InferMSXDOSBootSector determines the layout of an MSX-DOS floppy from the
+// media descriptor in the first FAT entry, the same way MSX-DOS 1 does. It
+// behaves like [InferDOS1BootSector], but also recognizes the formats in
+// [MSXDOSFormat].
+func InferMSXDOSBootSector(image io.ReaderAt, size int64) (*FATBootSector, error) {
+	formats := make(map[uint8]RawFATBootSectorWithBPB, 8)
+	for media := 0xF8; media <= 0xFF; media++ {
+		formats[uint8(media)], _ = MSXDOSFormat(uint8(media))
+	}
+	return inferBootSector(image, size, formats, "MSX-DOS")
+}
+
+// resolveMSXDOSBootSector picks the layout MSX-DOS would use for an image whose
+// boot sector parsed as `bootSector`, or failed to parse with `bpbErr`. The BPB
+// is used if it's valid and its media descriptor matches the first FAT entry,
+// since MSX-DOS 2 reads it and it may have an unusual root directory size.
+// Otherwise, the layout is inferred from the FAT, as MSX-DOS 1 does. If that
+// fails too, `bootSector` and `bpbErr` are returned unchanged.
+func resolveMSXDOSBootSector(
+	image io.ReaderAt,
+	size int64,
+	bootSector *FATBootSector,
+	bpbErr error,
+) (*FATBootSector, error) {
+	if bpbErr == nil {
+		media := make([]byte, 1)
+		offset := int64(bootSector.ReservedSectors) * int64(bootSector.BytesPerSector)
+		_, err := image.ReadAt(media, offset)
+		if err == nil && media[0] == bootSector.Media {
+			return bootSector, nil
+		}
+	}
+
+	inferred, err := InferMSXDOSBootSector(image, size)
+	if err != nil {
+		return bootSector, bpbErr
+	}
+	return inferred, nil
+}
+
+// NewMSXDOSBootSector creates a 512-byte boot sector that an MSX accepts.
+//
+// The JmpBoot field of `bpb` is ignored. The disk ROM calls the boot code at
+// offset 0x1E of the sector once it's loaded, first with the carry flag clear
+// and then with it set. If `bootCode` is nil, the boot sector returns straight
+// away, and the machine starts Disk BASIC. Booting MSX-DOS needs the loader
+// from an MSX-DOS boot sector, and MSXDOS.SYS and COMMAND.COM on the disk.
+func NewMSXDOSBootSector(bpb RawFATBootSectorWithBPB, bootCode []byte) ([]byte, error) {
+	maxCodeSize := 512 - msxBootCodeOffset
+	if len(bootCode) > maxCodeSize {
+		return nil, disko.ErrArgumentOutOfRange.WithMessage(
+			fmt.Sprintf(
+				"boot code can be at most %d bytes, got %d", maxCodeSize, len(bootCode)))
+	}
+
+	sector := make([]byte, 512)
+	err := binstruct.MarshalInto(sector, bpb, binary.LittleEndian)
+	if err != nil {
+		return nil, err
+	}
+
+	// MSX formatters write an x86 jump to itself, so a PC that tries to boot
+	// the disk hangs instead of running Z80 code. There's deliberately no boot
+	// signature, so PCs don't try.
+	copy(sector, []byte{0xEB, 0xFE, 0x90})
+	if bootCode == nil {
+		bootCode = msxReturnToBASIC
+	}
+	copy(sector[msxBootCodeOffset:], bootCode)
+	return sector, nil
+}
+
+// MSXDOSImageOptions controls what [NewMSXDOSImage] writes to the boot sector.
+type MSXDOSImageOptions struct {
+	// OEMName is the name of the system that formatted the disk. It defaults
+	// to "MSX_04".
+	OEMName string
+
+	// BootCode is passed to [NewMSXDOSBootSector].
+	BootCode []byte
+}
+
+// NewMSXDOSImage creates an empty MSX-DOS floppy image in the format with media
+// descriptor `media`. See [MSXDOSFormat] for the formats available.
+func NewMSXDOSImage(media uint8, options MSXDOSImageOptions) ([]byte, error) {
+	bpb, ok := MSXDOSFormat(media)
+	if !ok {
+		return nil, disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf("media descriptor %#02x isn't an MSX-DOS floppy format", media))
+	}
+
+	oemName := options.OEMName
+	if oemName == "" {
+		oemName = "MSX_04"
+	} else if len(oemName) > 8 {
+		return nil, disko.ErrArgumentOutOfRange.WithMessage(
+			fmt.Sprintf("OEM name can be at most 8 bytes, got %q", oemName))
+	}
+	copy(bpb.OEMName[:], fmt.Sprintf("%-8s", oemName))
+
+	bootSector, err := NewMSXDOSBootSector(bpb, options.BootCode)
+	if err != nil {
+		return nil, err
+	}
+
+	image := make([]byte, int(bpb.TotalSectors16)*int(bpb.BytesPerSector))
+	copy(image, bootSector)
+	fatSize := int(bpb.SectorsPerFAT16) * int(bpb.BytesPerSector)
+	for i := 0; i < int(bpb.NumFATs); i++ {
+		offset := int(bpb.ReservedSectors)*int(bpb.BytesPerSector) + i*fatSize
+		copy(image[offset:], []byte{media, 0xFF, 0xFF})
+	}
+	return image, nil
+}
@@ -0,0 +1,164 @@
+package fat_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xaionaro-go/bytesextra"
+)
+
+// mountMSX mounts `image` with the MSX-DOS profile enabled.
+func mountMSX(t *testing.T, image []byte) (*driver.BaseDriver, disko.FileSystemImplementer) {
+	flags := disko.MountFlagsAllowAll | fat.MountFlagsMSXDOS
+	implementation, err := fat.NewDriver(bytesextra.NewReadWriteSeeker(image))
+	require.NoError(t, err)
+	require.NoError(t, implementation.Mount(flags))
+	return driver.New(implementation, flags), implementation
+}
+
+func TestNewMSXDOSImage(t *testing.T) {
+	for media := 0xF8; media <= 0xFF; media++ {
+		image, err := fat.NewMSXDOSImage(uint8(media), fat.MSXDOSImageOptions{})
+		require.NoError(t, err, "media %#02x", media)
+
+		assert.Equal(t, []byte{0xEB, 0xFE, 0x90}, image[:3], "media %#02x", media)
+		assert.Equal(t, "MSX_04  ", string(image[3:11]), "media %#02x", media)
+		assert.EqualValues(t, 0xC9, image[0x1E], "boot code of media %#02x", media)
+		assert.Equal(t, []byte{0, 0}, image[510:512], "media %#02x", media)
+		assert.True(t, fat.Detect(bytes.NewReader(image), int64(len(image))), "media %#02x", media)
+
+		// The image must also mount without the profile, since its BPB is
+		// valid.
+		fs, implementation := mountFloppy(t, image)
+		require.NoError(t, fs.WriteFile("/AUTOEXEC.BAS", []byte("10 PRINT"), 0o644))
+		require.NoError(t, implementation.Unmount())
+
+		fs, _ = mountMSX(t, image)
+		data, err := fs.ReadFile("/AUTOEXEC.BAS")
+		require.NoError(t, err, "media %#02x", media)
+		assert.Equal(t, "10 PRINT", string(data), "media %#02x", media)
+	}
+
+	_, err := fat.NewMSXDOSImage(0xF0, fat.MSXDOSImageOptions{})
+	assert.ErrorIs(t, err, disko.ErrNotSupported)
+}
+
+func TestNewMSXDOSBootSector__BootCode(t *testing.T) {
+	bpb, ok := fat.MSXDOSFormat(0xF9)
+	require.True(t, ok)
+
+	code := []byte{0xD0, 0x3E, 0x01, 0xC9}
+	sector, err := fat.NewMSXDOSBootSector(bpb, code)
+	require.NoError(t, err)
+	assert.Equal(t, code, sector[0x1E:0x22])
+	assert.EqualValues(t, 1440, binary.LittleEndian.Uint16(sector[19:]))
+
+	_, err = fat.NewMSXDOSBootSector(bpb, make([]byte, 483))
+	assert.ErrorIs(t, err, disko.ErrArgumentOutOfRange)
+}
+
+func TestMSXDOSFormatForGeometry(t *testing.T) {
+	geometry, err := disks.GetPredefinedDiskGeometry("msx_312in_ds_dd_9")
+	require.NoError(t, err)
+	bpb, err := fat.MSXDOSFormatForGeometry(geometry)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0xF9, bpb.Media)
+
+	geometry, err = disks.GetPredefinedDiskGeometry("msdos_514in_ss_dd_8")
+	require.NoError(t, err)
+	bpb, err = fat.MSXDOSFormatForGeometry(geometry)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0xFE, bpb.Media)
+
+	geometry, err = disks.GetPredefinedDiskGeometry("msdos_312in_ds_hd_18")
+	require.NoError(t, err)
+	_, err = fat.MSXDOSFormatForGeometry(geometry)
+	assert.ErrorIs(t, err, disko.ErrNotSupported)
+}
+
+// makeMSXDOS1Image creates a 360 KiB MSX-DOS 1 floppy whose boot sector has no
+// BPB, only the media descriptor in the FAT.
+func makeMSXDOS1Image() []byte {
+	image, err := fat.NewMSXDOSImage(0xF8, fat.MSXDOSImageOptions{})
+	if err != nil {
+		panic(err)
+	}
+	for i := 11; i < 0x1E; i++ {
+		image[i] = 0
+	}
+	return image
+}
+
+func TestMount__MSXDOSWithoutBPB(t *testing.T) {
+	image := makeMSXDOS1Image()
+
+	implementation, err := fat.NewDriver(bytesextra.NewReadWriteSeeker(image))
+	require.NoError(t, err)
+	err = implementation.Mount(disko.MountFlagsAllowAll)
+	assert.Error(t, err, "0xF8 isn't a DOS 1.x format, so this needs the profile")
+
+	fs, implementation := mountMSX(t, image)
+	require.NoError(t, fs.WriteFile("/HELLO.TXT", []byte("hello"), 0o644))
+	stat := implementation.FSStat()
+	// 720 sectors less 1 reserved, 4 FAT, and 7 root directory, in clusters of
+	// two sectors.
+	assert.EqualValues(t, 354, stat.TotalBlocks)
+	assert.EqualValues(t, 353, stat.BlocksFree)
+
+	description, err := fat.Describe(bytes.NewReader(image), int64(len(image)))
+	require.NoError(t, err)
+	assert.EqualValues(t, 354, description.Stat.TotalBlocks)
+}
+
+func TestMount__MSXDOSMediaMismatch(t *testing.T) {
+	// A 720 KiB disk whose BPB claims to be 360 KiB. MSX-DOS 1 goes by the FAT.
+	image, err := fat.NewMSXDOSImage(0xF9, fat.MSXDOSImageOptions{})
+	require.NoError(t, err)
+	bpb, _ := fat.MSXDOSFormat(0xF8)
+	bootSector, err := fat.NewMSXDOSBootSector(bpb, nil)
+	require.NoError(t, err)
+	copy(image, bootSector)
+
+	_, implementation := mountMSX(t, image)
+	stat := implementation.FSStat()
+	// 1440 sectors less 1 reserved, 6 FAT, and 7 root directory.
+	assert.EqualValues(t, 713, stat.TotalBlocks)
+}
+
+func TestMount__MSXDOSOneFATOddRootDirectory(t *testing.T) {
+	image, err := fat.NewMSXDOSImage(0xF9, fat.MSXDOSImageOptions{})
+	require.NoError(t, err)
+	// One FAT, and 100 root directory entries, which doesn't fill the last
+	// sector of the root directory.
+	image[16] = 1
+	binary.LittleEndian.PutUint16(image[17:], 100)
+	for i := 4 * 512; i < 7*512; i++ {
+		image[i] = 0
+	}
+
+	fs, implementation := mountMSX(t, image)
+	bootSector, err := fat.NewFATBootSectorFromStream(bytes.NewReader(image))
+	require.NoError(t, err)
+	// 1 reserved + 3 FAT + 100 * 32 / 512 root directory, rounded up = 11
+	assert.EqualValues(t, 11, bootSector.FirstDataSector)
+
+	for i := 0; i < 100; i++ {
+		name := "/" + string(rune('A'+i/26)) + string(rune('A'+i%26)) + ".TXT"
+		require.NoError(t, fs.WriteFile(name, []byte(name), 0o644), name)
+	}
+	err = fs.WriteFile("/FULL.TXT", nil, 0o644)
+	assert.ErrorIs(t, err, disko.ErrNoSpaceOnDevice)
+	require.NoError(t, implementation.Unmount())
+
+	fs, _ = mountMSX(t, image)
+	data, err := fs.ReadFile("/DV.TXT")
+	require.NoError(t, err)
+	assert.Equal(t, "/DV.TXT", string(data))
+}
@@ -0,0 +1,97 @@
+package fat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dargueta/disko"
+)
+
+// The first byte of a name in a directory entry has special meanings:
+//
+//   - 0x00 marks a free entry, and that all entries after it are free too.
+//   - 0xE5 marks a deleted entry.
+//   - 0x05 stands for a name that really begins with 0xE5, which is a valid
+//     character in some code pages (e.g. "σ" in code page 437).
+//
+// [ShortNameFromString] and [ShortNameToString] are the only places names are
+// converted, so that names written by the driver always read back the same.
+const (
+	nameByteFree      = 0x00
+	nameByteDeleted   = 0xE5
+	nameByteEscapedE5 = 0x05
+)
+
+// invalidNameBytes are the printable ASCII characters DOS doesn't allow in
+// file names.
+const invalidNameBytes = `"*+,./:;<=>?[\]|`
+
+// isValidNameByte returns true if `char` may appear in an 8.3 file name. Bytes
+// 0x80 and up are characters in the volume's OEM code page, and are allowed.
+func isValidNameByte(char byte) bool {
+	return char >= 0x20 && char != 0x7F && strings.IndexByte(invalidNameBytes, char) < 0
+}
+
+// upperCaseName converts ASCII letters in `name` to upper case, the way DOS
+// does. Other bytes are left alone, since their meaning depends on the code
+// page.
+func upperCaseName(name string) string {
+	converted := []byte(name)
+	for i, char := range converted {
+		if char >= 'a' && char <= 'z' {
+			converted[i] = char - 'a' + 'A'
+		}
+	}
+	return string(converted)
+}
+
+// ShortNameFromString converts a file name into the upper-case, space-padded
+// 8.3 form it's stored in on disk. It fails with [disko.ErrNameTooLong] if the
+// name or extension is too long, and [disko.ErrInvalidArgument] if the name has
+// characters DOS doesn't allow in file names.
+//
+// The name is treated as a string of bytes in the volume's code page, not
+// UTF-8. A leading 0xE5 is stored as 0x05; the result never begins with 0x00
+// or 0xE5, so it can't be mistaken for a free or deleted entry.
+func ShortNameFromString(name string) ([8]byte, [3]byte, error) {
+	var base [8]byte
+	var extension [3]byte
+
+	stem, ext, _ := strings.Cut(upperCaseName(name), ".")
+	if stem == "" || stem[0] == ' ' || strings.ContainsAny(ext, ".") {
+		return base, extension, disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("%q is not a valid 8.3 file name", name))
+	} else if len(stem) > len(base) || len(ext) > len(extension) {
+		return base, extension, disko.ErrNameTooLong.WithMessage(
+			fmt.Sprintf("%q doesn't fit in an 8.3 file name", name))
+	}
+
+	for _, char := range []byte(stem + ext) {
+		if !isValidNameByte(char) {
+			return base, extension, disko.ErrInvalidArgument.WithMessage(
+				fmt.Sprintf("%q contains a character not allowed in FAT file names", name))
+		}
+	}
+
+	copy(base[:], stem+strings.Repeat(" ", len(base)-len(stem)))
+	copy(extension[:], ext+strings.Repeat(" ", len(extension)-len(ext)))
+	if base[0] == nameByteDeleted {
+		base[0] = nameByteEscapedE5
+	}
+	return base, extension, nil
+}
+
+// ShortNameToString is the inverse of [ShortNameFromString]. It doesn't check
+// for free or deleted entries; callers must do that before decoding the name.
+func ShortNameToString(base [8]byte, extension [3]byte) string {
+	if base[0] == nameByteEscapedE5 {
+		base[0] = nameByteDeleted
+	}
+
+	stem := strings.TrimRight(string(base[:]), " ")
+	ext := strings.TrimRight(string(extension[:]), " ")
+	if ext == "" {
+		return stem
+	}
+	return stem + "." + ext
+}
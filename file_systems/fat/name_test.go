@@ -0,0 +1,107 @@
+package fat_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expectedValidByte returns true if `char` is allowed in an 8.3 name anywhere
+// but the first character.
+func expectedValidByte(char byte) bool {
+	return char >= 0x20 && char != 0x7F && !strings.ContainsRune(`"*+,./:;<=>?[\]|`, rune(char))
+}
+
+// expectedUpper upper-cases ASCII letters only, like DOS.
+func expectedUpper(name string) string {
+	converted := []byte(name)
+	for i, char := range converted {
+		if char >= 'a' && char <= 'z' {
+			converted[i] -= 'a' - 'A'
+		}
+	}
+	return string(converted)
+}
+
+func TestShortNameFromString__AllFirstBytes(t *testing.T) {
+	for char := 0; char < 256; char++ {
+		name := string([]byte{byte(char)}) + "BC.TXT"
+		base, extension, err := fat.ShortNameFromString(name)
+
+		if char == ' ' || !expectedValidByte(byte(char)) {
+			assert.ErrorIs(t, err, disko.ErrInvalidArgument, "first byte %#02x", char)
+			continue
+		}
+
+		require.NoError(t, err, "first byte %#02x", char)
+		assert.NotEqual(t, byte(0x00), base[0], "first byte %#02x looks like a free entry", char)
+		assert.NotEqual(t, byte(0xE5), base[0], "first byte %#02x looks like a deleted entry", char)
+		assert.Equal(
+			t,
+			expectedUpper(name),
+			fat.ShortNameToString(base, extension),
+			"first byte %#02x didn't round-trip",
+			char,
+		)
+	}
+}
+
+func TestShortNameFromString__AllOtherBytes(t *testing.T) {
+	for char := 0; char < 256; char++ {
+		charString := string([]byte{byte(char)})
+		for _, name := range []string{"A" + charString + "C.TXT", "ABC.T" + charString + "T"} {
+			base, extension, err := fat.ShortNameFromString(name)
+
+			if !expectedValidByte(byte(char)) {
+				assert.Error(t, err, "byte %#02x in %q", char, name)
+				continue
+			}
+
+			require.NoError(t, err, "byte %#02x in %q", char, name)
+			assert.Equal(
+				t,
+				strings.TrimRight(expectedUpper(name), " "),
+				fat.ShortNameToString(base, extension),
+				"byte %#02x didn't round-trip",
+				char,
+			)
+		}
+	}
+}
+
+func TestShortNameFromString__Padding(t *testing.T) {
+	base, extension, err := fat.ShortNameFromString("\xE5x.c")
+	require.NoError(t, err)
+	assert.Equal(t, [8]byte{0x05, 'X', ' ', ' ', ' ', ' ', ' ', ' '}, base)
+	assert.Equal(t, [3]byte{'C', ' ', ' '}, extension)
+}
+
+func TestShortNameToString__EscapedE5(t *testing.T) {
+	name := fat.ShortNameToString(
+		[8]byte{0x05, 'A', 'B', ' ', ' ', ' ', ' ', ' '},
+		[3]byte{' ', ' ', ' '},
+	)
+	assert.Equal(t, "\xE5AB", name)
+}
+
+func TestDriver__LeadingE5RoundTrip(t *testing.T) {
+	image := makeFloppyImage()
+	fs, implementation := mountFloppy(t, image)
+	require.NoError(t, fs.WriteFile("/\xE5data.bin", []byte("sigma"), 0o644))
+	require.NoError(t, fs.Flush())
+	require.NoError(t, implementation.Unmount())
+
+	fs, _ = mountFloppy(t, image)
+	entries, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "\xE5DATA.BIN", entries[0].Name())
+
+	data, err := fs.ReadFile("/\xE5DATA.BIN")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("sigma"), data)
+}
@@ -0,0 +1,246 @@
+package fat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dargueta/disko"
+)
+
+// XattrOS2Prefix is put in front of the names of OS/2 extended attributes to
+// get their names as disko extended attributes, e.g. "os2..LONGNAME".
+const XattrOS2Prefix = "os2."
+
+// EADataFileName is the name of the file in the root directory where OS/2 and
+// Windows NT keep the extended attributes of every file on a FAT12 or FAT16
+// volume. Each file's directory entry has a handle into it, in the bytes FAT32
+// uses for the high word of the first cluster.
+const EADataFileName = "EA DATA. SF"
+
+// The layout of EA DATA. SF. It begins with a 512-byte header, followed by a
+// table with the offset of each handle's EA set in clusters, relative to the
+// base for its group of 128 handles in the header.
+const (
+	eaFileSignature      = 0x4445 // "ED"
+	eaFileBaseTable      = 32
+	eaFileHeaderSize     = 512
+	eaHandlesPerBase     = 128
+	eaMaxBaseIndex       = 240
+	eaUnusedOffset       = 0xFFFF
+	eaSetSignature       = 0x4145 // "EA"
+	eaSetOwnHandleOffset = 2
+	eaSetListSizeOffset  = 26
+	eaSetHeaderSize      = 30
+	eaPackedHeaderSize   = 4
+)
+
+// EANeedEA is set in the flags of an extended attribute that the file can't be
+// used without, such as the version of a program it was written for.
+const EANeedEA = 0x80
+
+// OS2ExtendedAttribute is an extended attribute of a file, as stored in
+// EA DATA. SF.
+type OS2ExtendedAttribute struct {
+	Name string
+	// Value is the attribute's value. OS/2 puts a two-byte type in front of it,
+	// e.g. 0xFFFD for ASCII text, which is kept.
+	Value []byte
+	Flags uint8
+}
+
+// ParseOS2ExtendedAttributes returns the extended attributes with handle
+// `handle` in `eaFile`, the contents of EA DATA. SF, and `bytesPerCluster` is
+// the cluster size of the volume. Handle 0 means a file has no extended
+// attributes, so it always returns nil.
+func ParseOS2ExtendedAttributes(
+	eaFile []byte,
+	bytesPerCluster uint,
+	handle uint16,
+) ([]OS2ExtendedAttribute, disko.DriverError) {
+	if handle == 0 {
+		return nil, nil
+	} else if len(eaFile) < eaFileHeaderSize ||
+		binary.LittleEndian.Uint16(eaFile) != eaFileSignature {
+		return nil, disko.ErrFileSystemCorrupted.WithMessage(
+			EADataFileName + " doesn't have a valid header")
+	}
+
+	baseIndex := int(handle) / eaHandlesPerBase
+	offsetPosition := eaFileHeaderSize + 2*int(handle)
+	if baseIndex >= eaMaxBaseIndex || offsetPosition+2 > len(eaFile) {
+		return nil, disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf("EA handle %d is past the end of the handle table", handle))
+	}
+
+	offset := binary.LittleEndian.Uint16(eaFile[offsetPosition:])
+	if offset == eaUnusedOffset {
+		return nil, disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf("EA handle %d isn't in use", handle))
+	}
+	base := binary.LittleEndian.Uint16(eaFile[eaFileBaseTable+2*baseIndex:])
+	start := (int(base) + int(offset)) * int(bytesPerCluster)
+	if start+eaSetHeaderSize > len(eaFile) {
+		return nil, disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf("EA set of handle %d is past the end of %s", handle, EADataFileName))
+	}
+
+	set := eaFile[start:]
+	if binary.LittleEndian.Uint16(set) != eaSetSignature {
+		return nil, disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf("EA set of handle %d has no signature", handle))
+	} else if owner := binary.LittleEndian.Uint16(set[eaSetOwnHandleOffset:]); owner != handle {
+		return nil, disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf("EA set of handle %d belongs to handle %d", handle, owner))
+	}
+
+	// The size of the list includes the four bytes of the size itself.
+	listSize := int(binary.LittleEndian.Uint32(set[eaSetListSizeOffset:]))
+	if listSize < 4 || eaSetListSizeOffset+listSize > len(set) {
+		return nil, disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf("EA set of handle %d has an invalid size %d", handle, listSize))
+	}
+	return parsePackedEAs(set[eaSetHeaderSize:eaSetListSizeOffset+listSize], handle)
+}
+
+// parsePackedEAs decodes the extended attributes in an EA set. Each one is a
+// flags byte, the length of its name, the length of its value, its name with a
+// null byte after it, and its value.
+func parsePackedEAs(list []byte, handle uint16) ([]OS2ExtendedAttribute, disko.DriverError) {
+	attributes := []OS2ExtendedAttribute{}
+	for len(list) > 0 {
+		if len(list) < eaPackedHeaderSize {
+			return nil, disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf("EA set of handle %d ends in the middle of an attribute", handle))
+		}
+
+		nameLength := int(list[1])
+		valueLength := int(binary.LittleEndian.Uint16(list[2:]))
+		size := eaPackedHeaderSize + nameLength + 1 + valueLength
+		if size > len(list) {
+			return nil, disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf("EA set of handle %d ends in the middle of an attribute", handle))
+		}
+
+		nameEnd := eaPackedHeaderSize + nameLength
+		attributes = append(
+			attributes,
+			OS2ExtendedAttribute{
+				Name:  string(list[eaPackedHeaderSize:nameEnd]),
+				Value: list[nameEnd+1 : size],
+				Flags: list[0],
+			},
+		)
+		list = list[size:]
+	}
+	return attributes, nil
+}
+
+// eaHandle returns the handle of the object's OS/2 extended attributes, or 0 if
+// it has none. FAT32 uses the field for the first cluster, so no object on a
+// FAT32 volume has them.
+func (handle *objectHandle) eaHandle() uint16 {
+	if handle.isRoot() || handle.isDeletedView || handle.driver.bootSector.FATVersion == 32 {
+		return 0
+	}
+	return handle.raw.FirstClusterHigh
+}
+
+// readEADataFile returns the contents of EA DATA. SF, or nil if the volume
+// doesn't have it.
+func (driver *Driver) readEADataFile() ([]byte, disko.DriverError) {
+	root := driver.GetRootDirectory().(*objectHandle)
+	entries, err := root.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if string(entry.raw.Name[:]) != "EA DATA " || string(entry.raw.Extension[:]) != " SF" {
+			continue
+		}
+
+		file := &objectHandle{
+			driver:      driver,
+			parent:      root,
+			direntIndex: entry.index,
+			raw:         entry.raw,
+			name:        entry.name,
+		}
+		chain, err := file.chain()
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, uint(len(chain))*driver.bootSector.BytesPerCluster)
+		err = file.ReadBlocks(0, data)
+		if err != nil {
+			return nil, err
+		} else if int(entry.raw.FileSize) < len(data) {
+			data = data[:entry.raw.FileSize]
+		}
+		return data, nil
+	}
+	return nil, nil
+}
+
+// os2ExtendedAttributes returns the object's OS/2 extended attributes. On a
+// lenient mount, problems with EA DATA. SF are recorded as warnings, and the
+// object is treated as having none.
+func (handle *objectHandle) os2ExtendedAttributes() ([]OS2ExtendedAttribute, disko.DriverError) {
+	eaHandle := handle.eaHandle()
+	if eaHandle == 0 {
+		return nil, nil
+	}
+
+	eaFile, err := handle.driver.readEADataFile()
+	if err != nil {
+		return nil, err
+	} else if eaFile == nil {
+		// Some other systems use the field for something else, such as
+		// DR-DOS's file permissions.
+		return nil, nil
+	}
+
+	attributes, err := ParseOS2ExtendedAttributes(
+		eaFile, handle.driver.bootSector.BytesPerCluster, eaHandle)
+	if err != nil {
+		return nil, handle.driver.corrupted(
+			fmt.Sprintf("%s: extended attributes can't be read", handle.name), err)
+	}
+	return attributes, nil
+}
+
+// ListXattrs implements [disko.SupportsXattrHandle]. The only extended
+// attributes are those OS/2 and Windows NT keep in EA DATA. SF, with
+// [XattrOS2Prefix] in front of their names.
+func (handle *objectHandle) ListXattrs() ([]string, disko.DriverError) {
+	attributes, err := handle.os2ExtendedAttributes()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(attributes))
+	for _, attribute := range attributes {
+		names = append(names, XattrOS2Prefix+attribute.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// GetXattr implements [disko.SupportsXattrHandle].
+func (handle *objectHandle) GetXattr(name string) ([]byte, disko.DriverError) {
+	if strings.HasPrefix(name, XattrOS2Prefix) {
+		attributes, err := handle.os2ExtendedAttributes()
+		if err != nil {
+			return nil, err
+		}
+		for _, attribute := range attributes {
+			if XattrOS2Prefix+attribute.Name == name {
+				return attribute.Value, nil
+			}
+		}
+	}
+	return nil, disko.ErrNotFound.WithMessage(
+		fmt.Sprintf("%s has no extended attribute %q", handle.name, name))
+}
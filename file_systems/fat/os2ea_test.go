@@ -0,0 +1,139 @@
+package fat_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xaionaro-go/bytesextra"
+)
+
+var (
+	longNameValue = append([]byte{0xFD, 0xFF, 12, 0}, "Read me.text"...)
+	typeValue     = append([]byte{0xFD, 0xFF, 10, 0}, "Plain Text"...)
+)
+
+// makeEADataFile creates the contents of an EA DATA. SF file for a volume with
+// 512-byte clusters, with an EA set for handle 1 in the third cluster.
+func makeEADataFile(ownHandle uint16) []byte {
+	data := make([]byte, 3*512)
+	copy(data, "ED")
+	// The base of the first 128 handles is cluster 2, and handle 1 is at offset
+	// 0 from it. No other handle is in use.
+	binary.LittleEndian.PutUint16(data[32:], 2)
+	for handle := 0; handle < 128; handle++ {
+		binary.LittleEndian.PutUint16(data[512+2*handle:], 0xFFFF)
+	}
+	binary.LittleEndian.PutUint16(data[512+2:], 0)
+
+	set := data[1024:]
+	copy(set, "EA")
+	binary.LittleEndian.PutUint16(set[2:], ownHandle)
+	binary.LittleEndian.PutUint32(set[4:], 1)
+	copy(set[8:], "README.TXT")
+
+	list := []byte{}
+	for _, attribute := range []fat.OS2ExtendedAttribute{
+		{Name: ".LONGNAME", Value: longNameValue},
+		{Name: ".TYPE", Value: typeValue, Flags: fat.EANeedEA},
+	} {
+		list = append(list, attribute.Flags, byte(len(attribute.Name)))
+		list = binary.LittleEndian.AppendUint16(list, uint16(len(attribute.Value)))
+		list = append(list, attribute.Name...)
+		list = append(list, 0)
+		list = append(list, attribute.Value...)
+	}
+	binary.LittleEndian.PutUint32(set[26:], uint32(4+len(list)))
+	copy(set[30:], list)
+	return data
+}
+
+// makeOS2Floppy creates a floppy with README.TXT, which has extended attributes,
+// and PLAIN.TXT, which doesn't.
+func makeOS2Floppy(t *testing.T, eaFile []byte) []byte {
+	image := makeFloppyImage()
+	fs, implementation := mountFloppy(t, image)
+	require.NoError(t, fs.WriteFile("/README.TXT", []byte("hello"), 0o644))
+	require.NoError(t, fs.WriteFile("/PLAIN.TXT", []byte("plain"), 0o644))
+	require.NoError(t, fs.WriteFile("/EADATA.SF", eaFile, 0o644))
+	require.NoError(t, implementation.Unmount())
+
+	// The root directory begins after the boot sector and two 9-sector FATs.
+	// Give README.TXT handle 1, and rename EADATA.SF, which can't be created
+	// under its real name since it has spaces in it.
+	root := image[19*512:]
+	binary.LittleEndian.PutUint16(root[0x14:], 1)
+	copy(root[2*fat.DirentSize:], "EA DATA  SF")
+	return image
+}
+
+func TestDriver__OS2ExtendedAttributes(t *testing.T) {
+	fs, _ := mountFloppy(t, makeOS2Floppy(t, makeEADataFile(1)))
+
+	names, err := fs.ListXattrs("/README.TXT")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"os2..LONGNAME", "os2..TYPE"}, names)
+
+	value, err := fs.GetXattr("/README.TXT", "os2..LONGNAME")
+	require.NoError(t, err)
+	assert.Equal(t, longNameValue, value)
+	value, err = fs.GetXattr("/README.TXT", "os2..TYPE")
+	require.NoError(t, err)
+	assert.Equal(t, typeValue, value)
+
+	_, err = fs.GetXattr("/README.TXT", "os2..ICON")
+	assert.ErrorIs(t, err, disko.ErrNotFound)
+
+	names, err = fs.ListXattrs("/PLAIN.TXT")
+	require.NoError(t, err)
+	assert.Empty(t, names)
+}
+
+func TestDriver__OS2ExtendedAttributesCorrupted(t *testing.T) {
+	// The EA set claims to belong to another handle.
+	image := makeOS2Floppy(t, makeEADataFile(2))
+
+	fs, _ := mountFloppy(t, image)
+	_, err := fs.ListXattrs("/README.TXT")
+	assert.ErrorIs(t, err, disko.ErrFileSystemCorrupted)
+	assert.ErrorContains(t, err, "EA set of handle 1 belongs to handle 2")
+
+	flags := disko.MountFlagsAllowRead | disko.MountFlagsLenient
+	implementation, err := fat.NewDriver(bytesextra.NewReadWriteSeeker(image))
+	require.NoError(t, err)
+	require.NoError(t, implementation.Mount(flags))
+	fs = driver.New(implementation, flags)
+
+	names, err := fs.ListXattrs("/README.TXT")
+	require.NoError(t, err)
+	assert.Empty(t, names)
+	assert.Len(t, implementation.(disko.MountWarningsImplementer).MountWarnings(), 1)
+}
+
+func TestParseOS2ExtendedAttributes(t *testing.T) {
+	eaFile := makeEADataFile(1)
+
+	attributes, err := fat.ParseOS2ExtendedAttributes(eaFile, 512, 1)
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		[]fat.OS2ExtendedAttribute{
+			{Name: ".LONGNAME", Value: longNameValue},
+			{Name: ".TYPE", Value: typeValue, Flags: fat.EANeedEA},
+		},
+		attributes,
+	)
+
+	_, err = fat.ParseOS2ExtendedAttributes(eaFile, 512, 5)
+	assert.ErrorIs(t, err, disko.ErrFileSystemCorrupted)
+	assert.ErrorContains(t, err, "EA handle 5 isn't in use")
+
+	// Cut off in the middle of the second attribute.
+	binary.LittleEndian.PutUint32(eaFile[1024+26:], 4+4+10+16+4)
+	_, err = fat.ParseOS2ExtendedAttributes(eaFile, 512, 1)
+	assert.ErrorIs(t, err, disko.ErrFileSystemCorrupted)
+}
@@ -0,0 +1,495 @@
+package fat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+// Offsets of fields in the boot sector that change when the cluster size does.
+const (
+	sectorsPerClusterOffset = 13
+	sectorsPerFAT16Offset   = 22
+	sectorsPerFAT32Offset   = 36
+	fat16FileSystemType     = 54
+)
+
+// ConvertClusterSize copies the FAT file system in `source` to `destination`,
+// changing the number of sectors per cluster to `newSectorsPerCluster`. Everything
+// else about the file system stays the same, including its size. The FATs are
+// resized to fit the new number of clusters.
+//
+// Smaller clusters waste less space on images with lots of small files, while
+// larger ones make the FAT smaller.
+//
+// All files and directories are copied with their directory entries intact,
+// including timestamps, attributes, and long file names. Deleted entries and
+// clusters not belonging to any file are dropped. Files end up contiguous, so
+// this also defragments the image.
+//
+// The FAT version may change between FAT12 and FAT16 if the number of clusters
+// requires it, but conversions to or from FAT32 fail with
+// [disko.ErrNotSupported], since the root directory is stored differently.
+// `destination` should be empty; it's extended to the size of the file system
+// if needed.
+func ConvertClusterSize(
+	source io.ReaderAt,
+	destination io.WriterAt,
+	newSectorsPerCluster uint,
+) disko.DriverError {
+	oldBoot, _, err := readBootSectorForResize(source)
+	if err != nil {
+		return err
+	}
+
+	converter := clusterSizeConverter{
+		source:      source,
+		destination: destination,
+		oldBoot:     oldBoot,
+		nextCluster: 2,
+	}
+	return converter.run(newSectorsPerCluster)
+}
+
+// clusterSizeConverter holds the state of a [ConvertClusterSize] operation.
+type clusterSizeConverter struct {
+	source      io.ReaderAt
+	destination io.WriterAt
+	oldBoot     *FATBootSector
+	oldFAT      []byte
+	newBoot     *FATBootSector
+	newFAT      []byte
+	// nextCluster is the next unallocated cluster in the new file system.
+	// Clusters are allocated sequentially, so every file is contiguous.
+	nextCluster uint
+}
+
+func (converter *clusterSizeConverter) run(newSectorsPerCluster uint) disko.DriverError {
+	oldBoot := converter.oldBoot
+	bytesPerSector := int64(oldBoot.BytesPerSector)
+
+	switch newSectorsPerCluster {
+	case 1, 2, 4, 8, 16, 32, 64, 128:
+	default:
+		return disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf(
+				"sectors per cluster must be a power of 2 in 1-128, got %d",
+				newSectorsPerCluster,
+			),
+		)
+	}
+
+	sectorsPerFAT, newVersion, err := computeSectorsPerFAT(oldBoot, newSectorsPerCluster)
+	if err != nil {
+		return err
+	}
+	if (newVersion == 32) != (oldBoot.FATVersion == 32) {
+		return disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf(
+				"%d sectors per cluster would convert FAT%d to FAT%d",
+				newSectorsPerCluster,
+				oldBoot.FATVersion,
+				newVersion,
+			),
+		)
+	}
+
+	converter.oldFAT, err = readFAT(converter.source, oldBoot)
+	if err != nil {
+		return err
+	}
+
+	// Copy the reserved sectors, which include the boot sector and on FAT32
+	// its backup and the FSInfo sector, and update the BPB.
+	reserved := make([]byte, int64(oldBoot.ReservedSectors)*bytesPerSector)
+	_, ioErr := converter.source.ReadAt(reserved, 0)
+	if ioErr != nil {
+		return disko.ErrIOFailed.Wrap(ioErr)
+	}
+
+	bootSectorCopies := []int64{0}
+	if oldBoot.FATVersion == 32 {
+		backupSector := int64(binary.LittleEndian.Uint16(reserved[fat32BackupBootOffset:]))
+		if backupSector != 0 && backupSector < int64(oldBoot.ReservedSectors) {
+			bootSectorCopies = append(bootSectorCopies, backupSector*bytesPerSector)
+		}
+	}
+	for _, offset := range bootSectorCopies {
+		updateBPBForClusterSize(
+			reserved[offset:offset+bytesPerSector],
+			oldBoot.FATVersion,
+			newVersion,
+			newSectorsPerCluster,
+			sectorsPerFAT,
+		)
+	}
+
+	converter.newBoot, _, err = readBootSectorForResize(bytesReaderAt(reserved))
+	if err != nil {
+		return err
+	}
+	newBoot := converter.newBoot
+	converter.newFAT = make([]byte, newBoot.SectorsPerFAT*uint(newBoot.BytesPerSector))
+
+	// The first two entries hold the media descriptor and an end of chain
+	// marker.
+	endOfChain := badClusterMarker(newVersion) + 8
+	setFATEntry(converter.newFAT, newVersion, 0, endOfChain&^0xFF|uint32(oldBoot.Media))
+	setFATEntry(converter.newFAT, newVersion, 1, endOfChain)
+
+	// Extend the destination to the full size of the file system up front so
+	// that we don't find out it's too small partway through.
+	_, ioErr = converter.destination.WriteAt(
+		make([]byte, bytesPerSector),
+		int64(newBoot.totalSectors()-1)*bytesPerSector,
+	)
+	if ioErr != nil {
+		return disko.ErrIOFailed.Wrap(ioErr)
+	}
+
+	if newVersion == 32 {
+		err = converter.convertFAT32Root(reserved)
+	} else {
+		err = converter.convertFixedRoot()
+	}
+	if err != nil {
+		return err
+	}
+
+	err = writeFATs(converter.destination, newBoot, converter.newFAT)
+	if err != nil {
+		return err
+	}
+
+	if newVersion == 32 {
+		fsInfoSector := int64(binary.LittleEndian.Uint16(reserved[fat32FSInfoOffset:]))
+		if fsInfoSector != 0 && fsInfoSector < int64(oldBoot.ReservedSectors) {
+			fsInfo := reserved[fsInfoSector*bytesPerSector:]
+			freeClusters := newBoot.TotalClusters + 2 - converter.nextCluster
+			binary.LittleEndian.PutUint32(fsInfo[fsInfoFreeCountOffset:], uint32(freeClusters))
+			binary.LittleEndian.PutUint32(fsInfo[fsInfoFreeCountOffset+4:], fsInfoUnknown)
+		}
+	}
+
+	// Write the boot sector last, so the image isn't recognized as valid
+	// until everything else is in place.
+	_, ioErr = converter.destination.WriteAt(reserved, 0)
+	if ioErr != nil {
+		return disko.ErrIOFailed.Wrap(ioErr)
+	}
+	return nil
+}
+
+// convertFixedRoot copies the contents of the FAT12/FAT16 root directory.
+func (converter *clusterSizeConverter) convertFixedRoot() disko.DriverError {
+	rootStart := int64(uint(converter.oldBoot.ReservedSectors)+converter.oldBoot.TotalFATSectors) *
+		int64(converter.oldBoot.BytesPerSector)
+	rootDirectory := make(
+		[]byte, converter.oldBoot.RootDirSectors*uint(converter.oldBoot.BytesPerSector))
+	_, ioErr := converter.source.ReadAt(rootDirectory, rootStart)
+	if ioErr != nil {
+		return disko.ErrIOFailed.Wrap(ioErr)
+	}
+
+	entries := liveDirents(rootDirectory)
+	err := converter.convertDirectoryEntries(entries, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	newRootStart := int64(uint(converter.newBoot.ReservedSectors)+converter.newBoot.TotalFATSectors) *
+		int64(converter.newBoot.BytesPerSector)
+	newRoot := make([]byte, len(rootDirectory))
+	copy(newRoot, entries)
+	_, ioErr = converter.destination.WriteAt(newRoot, newRootStart)
+	if ioErr != nil {
+		return disko.ErrIOFailed.Wrap(ioErr)
+	}
+	return nil
+}
+
+// convertFAT32Root copies the root directory of a FAT32 file system, and
+// updates its first cluster in the boot sector at the beginning of `reserved`.
+func (converter *clusterSizeConverter) convertFAT32Root(reserved []byte) disko.DriverError {
+	oldRoot := uint(binary.LittleEndian.Uint32(reserved[fat32RootClusterOffset:]))
+	newRoot, err := converter.convertDirectory(oldRoot, 0)
+	if err != nil {
+		return err
+	}
+
+	bytesPerSector := int(converter.oldBoot.BytesPerSector)
+	backupSector := int(binary.LittleEndian.Uint16(reserved[fat32BackupBootOffset:]))
+	for _, offset := range []int{0, backupSector * bytesPerSector} {
+		if offset+bytesPerSector <= len(reserved) {
+			binary.LittleEndian.PutUint32(
+				reserved[offset+fat32RootClusterOffset:], uint32(newRoot))
+		}
+	}
+	return nil
+}
+
+// convertDirectory copies the subdirectory beginning at `oldFirstCluster`, and
+// everything in it, returning its first cluster in the new file system.
+// `newParentCluster` is the first cluster of its parent, or 0 for the root
+// directory.
+func (converter *clusterSizeConverter) convertDirectory(
+	oldFirstCluster uint, newParentCluster uint,
+) (uint, disko.DriverError) {
+	data, err := converter.readChain(oldFirstCluster)
+	if err != nil {
+		return 0, err
+	}
+
+	// Allocate space for this directory before its children, so that parents
+	// come before their contents on disk. A directory always has at least one
+	// cluster, even if it's empty.
+	entries := liveDirents(data)
+	size := int64(len(entries))
+	if size == 0 {
+		size = 1
+	}
+	newFirstCluster, err := converter.allocate(size)
+	if err != nil {
+		return 0, err
+	}
+
+	err = converter.convertDirectoryEntries(entries, newFirstCluster, newParentCluster)
+	if err != nil {
+		return 0, err
+	}
+	return newFirstCluster, converter.writeClusters(newFirstCluster, entries)
+}
+
+// convertDirectoryEntries copies the objects pointed to by `entries` and
+// updates the entries to point to the copies. `newSelfCluster` and
+// `newParentCluster` are the new first clusters of the directory and its
+// parent, or 0 for the root directory.
+func (converter *clusterSizeConverter) convertDirectoryEntries(
+	entries []byte, newSelfCluster uint, newParentCluster uint,
+) disko.DriverError {
+	for offset := 0; offset < len(entries); offset += DirentSize {
+		rawDirent := entries[offset : offset+DirentSize]
+		attributes := rawDirent[11]
+		if attributes&0x0F == 0x0F || attributes&AttrVolumeLabel != 0 {
+			// Long file name or volume label; there's no data.
+			continue
+		}
+
+		var newCluster uint
+		var err disko.DriverError
+		oldCluster := direntFirstCluster(converter.oldBoot, rawDirent)
+
+		switch {
+		case string(rawDirent[:11]) == ".          ":
+			newCluster = newSelfCluster
+		case string(rawDirent[:11]) == "..         ":
+			newCluster = newParentCluster
+		case oldCluster == 0:
+			// Empty file.
+		case attributes&AttrDirectory != 0:
+			newCluster, err = converter.convertDirectory(oldCluster, newSelfCluster)
+		default:
+			newCluster, err = converter.convertFile(
+				oldCluster, int64(binary.LittleEndian.Uint32(rawDirent[28:])))
+		}
+		if err != nil {
+			return err
+		}
+
+		binary.LittleEndian.PutUint16(rawDirent[26:], uint16(newCluster))
+		if converter.oldBoot.FATVersion == 32 {
+			binary.LittleEndian.PutUint16(rawDirent[20:], uint16(newCluster>>16))
+		}
+	}
+	return nil
+}
+
+// convertFile copies the first `size` bytes of the file beginning at
+// `oldFirstCluster`, returning its first cluster in the new file system.
+func (converter *clusterSizeConverter) convertFile(
+	oldFirstCluster uint, size int64,
+) (uint, disko.DriverError) {
+	if size == 0 {
+		return 0, nil
+	}
+
+	data, err := converter.readChain(oldFirstCluster)
+	if err != nil {
+		return 0, err
+	}
+	if int64(len(data)) < size {
+		return 0, disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf(
+				"file at cluster %d is %d bytes but its cluster chain only holds %d",
+				oldFirstCluster,
+				size,
+				len(data),
+			),
+		)
+	}
+
+	newFirstCluster, err := converter.allocate(size)
+	if err != nil {
+		return 0, err
+	}
+	return newFirstCluster, converter.writeClusters(newFirstCluster, data[:size])
+}
+
+// readChain returns the contents of every cluster in the chain beginning at
+// `first` in the source.
+func (converter *clusterSizeConverter) readChain(first uint) ([]byte, disko.DriverError) {
+	chain, err := readClusterChain(converter.oldBoot, converter.oldFAT, first)
+	if err != nil {
+		return nil, err
+	}
+
+	bytesPerCluster := int(converter.oldBoot.BytesPerCluster)
+	data := make([]byte, len(chain)*bytesPerCluster)
+	for i, cluster := range chain {
+		_, ioErr := converter.source.ReadAt(
+			data[i*bytesPerCluster:(i+1)*bytesPerCluster],
+			clusterOffset(converter.oldBoot, cluster),
+		)
+		if ioErr != nil {
+			return nil, disko.ErrIOFailed.Wrap(ioErr)
+		}
+	}
+	return data, nil
+}
+
+// allocate reserves enough contiguous clusters in the new file system to hold
+// `size` bytes and chains them together, returning the first one.
+func (converter *clusterSizeConverter) allocate(size int64) (uint, disko.DriverError) {
+	bytesPerCluster := int64(converter.newBoot.BytesPerCluster)
+	count := uint((size + bytesPerCluster - 1) / bytesPerCluster)
+	first := converter.nextCluster
+
+	if first+count > converter.newBoot.TotalClusters+2 {
+		return 0, disko.ErrNoSpaceOnDevice.WithMessage(
+			fmt.Sprintf(
+				"the new file system only has %d clusters of %d bytes, and they're all used",
+				converter.newBoot.TotalClusters,
+				bytesPerCluster,
+			),
+		)
+	}
+
+	version := converter.newBoot.FATVersion
+	for cluster := first; cluster < first+count-1; cluster++ {
+		setFATEntry(converter.newFAT, version, cluster, uint32(cluster+1))
+	}
+	setFATEntry(converter.newFAT, version, first+count-1, badClusterMarker(version)+8)
+
+	converter.nextCluster += count
+	return first, nil
+}
+
+// writeClusters writes `data` to the destination starting at `first`. The
+// clusters must have been allocated with [clusterSizeConverter.allocate].
+func (converter *clusterSizeConverter) writeClusters(first uint, data []byte) disko.DriverError {
+	_, err := converter.destination.WriteAt(data, clusterOffset(converter.newBoot, first))
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	return nil
+}
+
+// computeSectorsPerFAT returns the smallest FAT that can hold an entry for every
+// cluster of the file system described by `bootSector` if it had
+// `sectorsPerCluster` sectors per cluster, and the FAT version it would be.
+func computeSectorsPerFAT(
+	bootSector *FATBootSector, sectorsPerCluster uint,
+) (uint, int, disko.DriverError) {
+	bytesPerSector := uint(bootSector.BytesPerSector)
+	if bytesPerSector*sectorsPerCluster > 32768 {
+		return 0, 0, disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf(
+				"clusters of %d sectors would be %d bytes, more than the limit of 32,768",
+				sectorsPerCluster,
+				bytesPerSector*sectorsPerCluster,
+			),
+		)
+	}
+
+	totalSectors := bootSector.totalSectors()
+	overhead := uint(bootSector.ReservedSectors) + bootSector.RootDirSectors
+	for sectorsPerFAT := uint(1); ; sectorsPerFAT++ {
+		metadataSectors := overhead + uint(bootSector.NumFATs)*sectorsPerFAT
+		if metadataSectors >= totalSectors {
+			return 0, 0, disko.ErrNoSpaceOnDevice.WithMessage(
+				fmt.Sprintf(
+					"the FATs for %d sectors per cluster don't fit in the file system",
+					sectorsPerCluster,
+				),
+			)
+		}
+
+		totalClusters := (totalSectors - metadataSectors) / sectorsPerCluster
+		version := DetermineFATVersion(totalClusters)
+		fatBytes := ((totalClusters+2)*uint(version) + 7) / 8
+		if fatBytes <= sectorsPerFAT*bytesPerSector {
+			return sectorsPerFAT, version, nil
+		}
+	}
+}
+
+// updateBPBForClusterSize changes the cluster and FAT sizes in a boot sector.
+func updateBPBForClusterSize(
+	rawSector []byte,
+	oldVersion int,
+	newVersion int,
+	sectorsPerCluster uint,
+	sectorsPerFAT uint,
+) {
+	wasExecutable := len(rawSector) >= 512 && IsAtariSTBootSectorExecutable(rawSector)
+
+	rawSector[sectorsPerClusterOffset] = uint8(sectorsPerCluster)
+	if newVersion == 32 {
+		binary.LittleEndian.PutUint32(rawSector[sectorsPerFAT32Offset:], uint32(sectorsPerFAT))
+	} else {
+		binary.LittleEndian.PutUint16(rawSector[sectorsPerFAT16Offset:], uint16(sectorsPerFAT))
+	}
+
+	// The file system type is informational only, but update it if it was set.
+	if oldVersion != newVersion && len(rawSector) >= fat16FileSystemType+8 {
+		fsType := rawSector[fat16FileSystemType : fat16FileSystemType+8]
+		if string(fsType) == fmt.Sprintf("FAT%d   ", oldVersion) {
+			copy(fsType, fmt.Sprintf("FAT%d   ", newVersion))
+		}
+	}
+
+	if wasExecutable {
+		SetAtariSTBootChecksum(rawSector, true)
+	}
+}
+
+// liveDirents returns a copy of the directory entries in `directory` that
+// haven't been deleted, stopping at the end of the directory.
+func liveDirents(directory []byte) []byte {
+	entries := []byte{}
+	for offset := 0; offset+DirentSize <= len(directory); offset += DirentSize {
+		rawDirent := directory[offset : offset+DirentSize]
+		if rawDirent[0] == 0x00 {
+			break
+		} else if rawDirent[0] != 0xE5 {
+			entries = append(entries, rawDirent...)
+		}
+	}
+	return entries
+}
+
+// bytesReaderAt lets a byte slice be used as an [io.ReaderAt].
+type bytesReaderAt []byte
+
+func (data bytesReaderAt) ReadAt(buffer []byte, offset int64) (int, error) {
+	if offset >= int64(len(data)) {
+		return 0, io.EOF
+	}
+	n := copy(buffer, data[offset:])
+	if n < len(buffer) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,84 @@
+package fat_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertClusterSize__FAT12(t *testing.T) {
+	source := makeFragmentedFloppyImage()
+	binary.LittleEndian.PutUint32(source[floppyClusterOffset(2700)+64+28:], 5)
+	binary.LittleEndian.PutUint32(source[floppyRootDirOffset+32+28:], 1024)
+	// A deleted file that should be dropped.
+	writeRawDirent(source, floppyRootDirOffset+64, "\xE5ONE    TXT", 0, 2802)
+	writeRawDirent(source, floppyRootDirOffset+96, "LAST    TXT", 0, 0)
+
+	destination := &growableImage{}
+	require.NoError(t, fat.ConvertClusterSize(bytes.NewReader(source), destination, 2))
+	data := destination.data
+	require.Len(t, data, len(source))
+
+	bootSector, err := fat.NewFATBootSectorFromStream(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, bootSector.SectorsPerCluster)
+	// (2880 - 1 - 14 - 2 * 5) / 2 clusters need 2141 bytes of FAT.
+	assert.EqualValues(t, 5, bootSector.SectorsPerFAT)
+	assert.EqualValues(t, 1427, bootSector.TotalClusters)
+	assert.EqualValues(t, 12, bootSector.FATVersion)
+
+	// Data now starts at sector 1 + 2 * 5 + 14 = 25.
+	clusterOffset := func(cluster int) int { return (25 + (cluster-2)*2) * 512 }
+	fatEntry := func(cluster int) uint16 {
+		value := binary.LittleEndian.Uint16(data[512+cluster*3/2:])
+		if cluster%2 == 0 {
+			return value & 0x0FFF
+		}
+		return value >> 4
+	}
+
+	assert.EqualValues(t, 0xFF0, fatEntry(0))
+	assert.EqualValues(t, 0xFFF, fatEntry(1))
+	assert.Equal(t, data[512:512*6], data[512*6:512*11], "FAT copies differ")
+
+	rootDirectory := 11 * 512
+	assert.Equal(t, "SUBDIR     ", string(data[rootDirectory:rootDirectory+11]))
+	assert.Equal(t, "BIG     BIN", string(data[rootDirectory+32:rootDirectory+43]))
+	assert.Equal(t, "LAST    TXT", string(data[rootDirectory+64:rootDirectory+75]))
+	assert.EqualValues(t, 0, data[rootDirectory+96], "root directory not terminated")
+
+	// Parents are allocated before their contents.
+	require.EqualValues(t, 2, direntCluster(data, rootDirectory), "SUBDIR")
+	require.EqualValues(t, 4, direntCluster(data, rootDirectory+32), "BIG.BIN")
+	assert.EqualValues(t, 1024, binary.LittleEndian.Uint32(data[rootDirectory+32+28:]))
+	assert.EqualValues(t, 0, direntCluster(data, rootDirectory+64), "LAST.TXT")
+
+	subdir := clusterOffset(2)
+	assert.EqualValues(t, 2, direntCluster(data, subdir), "SUBDIR/.")
+	assert.EqualValues(t, 0, direntCluster(data, subdir+32), "SUBDIR/..")
+	assert.EqualValues(t, 3, direntCluster(data, subdir+64), "SUBDIR/INNER.TXT")
+
+	assert.Equal(t, []byte("inner"), data[clusterOffset(3):clusterOffset(3)+5])
+	assert.Equal(t, bytes.Repeat([]byte{0xAA}, 512), data[clusterOffset(4):clusterOffset(4)+512])
+	assert.Equal(t, bytes.Repeat([]byte{0xBB}, 512), data[clusterOffset(4)+512:clusterOffset(5)])
+
+	for cluster := 2; cluster <= 4; cluster++ {
+		assert.EqualValues(t, 0xFFF, fatEntry(cluster), "cluster %d", cluster)
+	}
+	assert.EqualValues(t, 0, fatEntry(5))
+}
+
+func TestConvertClusterSize__ClusterTooLarge(t *testing.T) {
+	err := fat.ConvertClusterSize(bytes.NewReader(makeFloppyImage()), &growableImage{}, 128)
+	assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+}
+
+func TestConvertClusterSize__NotPowerOfTwo(t *testing.T) {
+	err := fat.ConvertClusterSize(bytes.NewReader(makeFloppyImage()), &growableImage{}, 3)
+	assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+}
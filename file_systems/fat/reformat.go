@@ -0,0 +1,310 @@
+package fat
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/dargueta/disko"
+)
+
+// Offsets of the fields in the boot sector that [Reformat] replaces when it
+// doesn't preserve the boot sector. The extended BPB is at a different offset
+// on FAT32, after the fields only FAT32 has.
+const (
+	oemNameOffset           = 3
+	fat16ExtendedBPBOffset  = 38
+	fat32ExtendedBPBOffset  = 66
+	extendedBPBSerialOffset = 1
+	extendedBPBLabelOffset  = 5
+	fat16BootCodeOffset     = 62
+	fat32BootCodeOffset     = 90
+)
+
+// nonBootableCode is the boot code [Reformat] writes if it doesn't preserve the
+// existing boot sector. It tells the BIOS to try the next boot device with
+// INT 18h, then halts in case the BIOS returns.
+var nonBootableCode = []byte{0xCD, 0x18, 0xEB, 0xFE}
+
+// ReformatOptions controls what [Reformat] does with the boot sector.
+type ReformatOptions struct {
+	// PreserveBoot keeps the boot sector exactly as it is, including the jump
+	// instruction, boot code, OEM name, volume serial number, and volume label.
+	// The volume label's directory entry is kept as well.
+	//
+	// Otherwise, the boot code is replaced with code that only passes control
+	// to the next boot device, and the fields below are used.
+	PreserveBoot bool
+
+	// OEMName is the name of the system that formatted the volume. It defaults
+	// to "MSWIN4.1", which Microsoft recommends for compatibility.
+	OEMName string
+
+	// SerialNumber is the new volume serial number.
+	SerialNumber uint32
+
+	// Label is the new volume label, in the volume's code page. It defaults to
+	// "NO NAME".
+	Label string
+}
+
+// bootSectorFields returns the OEM name and label to write to the boot sector,
+// with defaults filled in. It fails if either is too long.
+func (options ReformatOptions) bootSectorFields() (string, string, disko.DriverError) {
+	oemName := options.OEMName
+	if oemName == "" {
+		oemName = "MSWIN4.1"
+	}
+	label := options.Label
+	if label == "" {
+		label = "NO NAME"
+	}
+
+	if len(oemName) > 8 {
+		return "", "", disko.ErrArgumentOutOfRange.WithMessage(
+			fmt.Sprintf("OEM name can be at most 8 bytes, got %q", oemName))
+	} else if len(label) > 11 {
+		return "", "", disko.ErrArgumentOutOfRange.WithMessage(
+			fmt.Sprintf("volume label can be at most 11 bytes, got %q", label))
+	}
+	return oemName, label, nil
+}
+
+// Reformat erases the FAT file system in `image`, leaving it empty. The size,
+// geometry, and FAT version stay the same, so it only needs the boot sector
+// to be intact. Clusters marked bad are still marked bad afterwards.
+//
+// Like a DOS quick format, only the FATs and root directory are cleared; the
+// contents of the data area are left alone. See [ReformatOptions] for what
+// happens to the boot sector.
+//
+// The image must not be mounted while this is running.
+func Reformat(image GrowableImage, options ReformatOptions) disko.DriverError {
+	// Check the options before anything is erased.
+	if !options.PreserveBoot {
+		_, _, err := options.bootSectorFields()
+		if err != nil {
+			return err
+		}
+	}
+
+	bootSector, rawSector, err := readBootSectorForResize(image)
+	if err != nil {
+		return err
+	}
+
+	oldFAT, err := readFAT(image, bootSector)
+	if err != nil {
+		return err
+	}
+
+	var label []byte
+	if options.PreserveBoot {
+		label, err = findVolumeLabelEntry(image, bootSector, rawSector, oldFAT)
+		if err != nil {
+			return err
+		}
+	}
+
+	newFAT := make([]byte, len(oldFAT))
+	version := bootSector.FATVersion
+	endOfChain := badClusterMarker(version) + 8
+	setFATEntry(newFAT, version, 0, endOfChain&^0xFF|uint32(bootSector.Media))
+	setFATEntry(newFAT, version, 1, endOfChain)
+	for cluster := uint(2); cluster < bootSector.TotalClusters+2; cluster++ {
+		if fatEntry(oldFAT, version, cluster) == badClusterMarker(version) {
+			setFATEntry(newFAT, version, cluster, badClusterMarker(version))
+		}
+	}
+
+	// The root directory is in the data area on FAT32, and keeps its first
+	// cluster. Elsewhere it's a fixed region between the FATs and the data.
+	bytesPerSector := int64(bootSector.BytesPerSector)
+	rootOffset := fatOffset(bootSector, uint(bootSector.NumFATs))
+	rootSize := int64(bootSector.RootDirSectors) * bytesPerSector
+	if version == 32 {
+		rootCluster := uint(binary.LittleEndian.Uint32(rawSector[fat32RootClusterOffset:]))
+		if rootCluster < 2 || rootCluster >= bootSector.TotalClusters+2 {
+			return disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf("root directory starts at invalid cluster %d", rootCluster))
+		} else if fatEntry(newFAT, version, rootCluster) != 0 {
+			return disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf("root directory starts at bad cluster %d", rootCluster))
+		}
+		setFATEntry(newFAT, version, rootCluster, endOfChain)
+		rootOffset = clusterOffset(bootSector, rootCluster)
+		rootSize = int64(bootSector.BytesPerCluster)
+	}
+
+	rootDirectory := make([]byte, rootSize)
+	copy(rootDirectory, label)
+	_, writeErr := image.WriteAt(rootDirectory, rootOffset)
+	if writeErr != nil {
+		return disko.ErrIOFailed.Wrap(writeErr)
+	}
+
+	err = writeFATs(image, bootSector, newFAT)
+	if err != nil {
+		return err
+	}
+
+	if version == 32 {
+		err = resetFAT32FSInfo(image, bootSector, rawSector)
+		if err != nil {
+			return err
+		}
+	}
+
+	if options.PreserveBoot {
+		return nil
+	}
+	return replaceBootSector(image, bootSector, rawSector, options)
+}
+
+// findVolumeLabelEntry returns the raw directory entry holding the volume label
+// in the root directory, or nil if there isn't one.
+func findVolumeLabelEntry(
+	image GrowableImage,
+	bootSector *FATBootSector,
+	rawSector []byte,
+	fat []byte,
+) ([]byte, disko.DriverError) {
+	var rootDirectory []byte
+	if bootSector.FATVersion == 32 {
+		rootCluster := uint(binary.LittleEndian.Uint32(rawSector[fat32RootClusterOffset:]))
+		chain, err := readClusterChain(bootSector, fat, rootCluster)
+		if err != nil {
+			return nil, err
+		}
+
+		bytesPerCluster := int(bootSector.BytesPerCluster)
+		rootDirectory = make([]byte, len(chain)*bytesPerCluster)
+		for i, cluster := range chain {
+			_, readErr := image.ReadAt(
+				rootDirectory[i*bytesPerCluster:(i+1)*bytesPerCluster],
+				clusterOffset(bootSector, cluster),
+			)
+			if readErr != nil {
+				return nil, disko.ErrIOFailed.Wrap(readErr)
+			}
+		}
+	} else {
+		rootDirectory = make([]byte, int(bootSector.RootDirSectors)*int(bootSector.BytesPerSector))
+		_, readErr := image.ReadAt(rootDirectory, fatOffset(bootSector, uint(bootSector.NumFATs)))
+		if readErr != nil {
+			return nil, disko.ErrIOFailed.Wrap(readErr)
+		}
+	}
+
+	for offset := 0; offset+DirentSize <= len(rootDirectory); offset += DirentSize {
+		entry := rootDirectory[offset : offset+DirentSize]
+		attributes := entry[11]
+		switch {
+		case entry[0] == nameByteFree:
+			return nil, nil
+		case entry[0] == nameByteDeleted:
+			continue
+		case attributes&AttrVolumeLabel != 0 && attributes&0x0F != 0x0F:
+			// Long file name entries have all of the low four attribute bits
+			// set, so they look like volume labels too.
+			return entry, nil
+		}
+	}
+	return nil, nil
+}
+
+// resetFAT32FSInfo marks the free cluster count and next free cluster hint in
+// the FSInfo sector as unknown, so that they're recomputed.
+func resetFAT32FSInfo(
+	image GrowableImage,
+	bootSector *FATBootSector,
+	rawSector []byte,
+) disko.DriverError {
+	fsInfoSector := int64(binary.LittleEndian.Uint16(rawSector[fat32FSInfoOffset:]))
+	if fsInfoSector == 0 || fsInfoSector == 0xFFFF {
+		return nil
+	}
+
+	rawFields := make([]byte, 8)
+	binary.LittleEndian.PutUint32(rawFields, fsInfoUnknown)
+	binary.LittleEndian.PutUint32(rawFields[4:], fsInfoUnknown)
+	_, err := image.WriteAt(
+		rawFields,
+		fsInfoSector*int64(bootSector.BytesPerSector)+fsInfoFreeCountOffset,
+	)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	return nil
+}
+
+// replaceBootSector writes a boot sector that can't boot, with the OEM name,
+// serial number, and label from `options`. The BPB stays the same. On FAT32,
+// the backup boot sector is updated too.
+func replaceBootSector(
+	image GrowableImage,
+	bootSector *FATBootSector,
+	rawSector []byte,
+	options ReformatOptions,
+) disko.DriverError {
+	oemName, label, err := options.bootSectorFields()
+	if err != nil {
+		return err
+	}
+
+	extendedBPB := fat16ExtendedBPBOffset
+	codeOffset := fat16BootCodeOffset
+	if bootSector.FATVersion == 32 {
+		extendedBPB = fat32ExtendedBPBOffset
+		codeOffset = fat32BootCodeOffset
+	}
+
+	copy(rawSector[oemNameOffset:oemNameOffset+8], fmt.Sprintf("%-8s", oemName))
+
+	// Images formatted by DOS 3.x and earlier have no extended BPB, and so
+	// nowhere to put the serial number and label. A signature of 0x28 means
+	// there's a serial number but no label.
+	signature := rawSector[extendedBPB]
+	if signature == 0x28 || signature == 0x29 {
+		binary.LittleEndian.PutUint32(
+			rawSector[extendedBPB+extendedBPBSerialOffset:], options.SerialNumber)
+	}
+	if signature == 0x29 {
+		copy(
+			rawSector[extendedBPB+extendedBPBLabelOffset:extendedBPB+extendedBPBLabelOffset+11],
+			fmt.Sprintf("%-11s", label),
+		)
+	}
+
+	// Sectors smaller than 512 bytes don't have the 0x55AA signature at the
+	// end, so the boot code can run to the end of the sector.
+	codeEnd := len(rawSector)
+	if codeEnd >= 512 {
+		codeEnd = 510
+	}
+	if codeOffset+len(nonBootableCode) <= codeEnd {
+		rawSector[0] = 0xEB
+		rawSector[1] = byte(codeOffset - 2)
+		rawSector[2] = 0x90
+		code := rawSector[codeOffset:codeEnd]
+		copy(code, nonBootableCode)
+		for i := len(nonBootableCode); i < len(code); i++ {
+			code[i] = 0
+		}
+	}
+
+	_, writeErr := image.WriteAt(rawSector, 0)
+	if writeErr != nil {
+		return disko.ErrIOFailed.Wrap(writeErr)
+	}
+
+	if bootSector.FATVersion == 32 {
+		backupSector := int64(binary.LittleEndian.Uint16(rawSector[fat32BackupBootOffset:]))
+		if backupSector != 0 && backupSector != 0xFFFF {
+			_, writeErr = image.WriteAt(rawSector, backupSector*int64(bootSector.BytesPerSector))
+			if writeErr != nil {
+				return disko.ErrIOFailed.Wrap(writeErr)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package fat_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeUsedFloppyImage returns a floppy image with some files, a volume label
+// entry, boot code, and a bad cluster.
+func makeUsedFloppyImage(t *testing.T) []byte {
+	image := makeFloppyImage()
+	fs, implementation := mountFloppy(t, image)
+	require.NoError(t, fs.Mkdir("/dir", 0o755))
+	require.NoError(t, fs.WriteFile("/dir/file.txt", bytes.Repeat([]byte("x"), 5000), 0o644))
+	require.NoError(t, fs.Flush())
+	require.NoError(t, implementation.Unmount())
+
+	// The root directory starts after the boot sector and two 9-sector FATs.
+	// Put the label after the entry for /dir, so that the reformatted directory
+	// has to move it to the front.
+	rootDirectory := 19 * 512
+	label := image[rootDirectory+fat.DirentSize:]
+	copy(label, "MY DISK    ")
+	label[11] = fat.AttrVolumeLabel
+
+	copy(image[62:], []byte{0xFA, 0x33, 0xC0, 0x8E, 0xD0})
+
+	// Mark cluster 100 as bad in both FATs. It's even, so it's the low 12 bits
+	// of the two bytes at 150 * 3 / 2.
+	for _, fatStart := range []int{512, 10 * 512} {
+		binary.LittleEndian.PutUint16(image[fatStart+150:], 0xFF7)
+	}
+	return image
+}
+
+func TestReformat__PreserveBoot(t *testing.T) {
+	image := makeUsedFloppyImage(t)
+	originalBoot := append([]byte{}, image[:512]...)
+
+	require.NoError(t, fat.Reformat(&growableImage{data: image}, fat.ReformatOptions{PreserveBoot: true}))
+	assert.Equal(t, originalBoot, image[:512], "boot sector should be unchanged")
+
+	rootDirectory := 19 * 512
+	assert.Equal(t, "MY DISK    ", string(image[rootDirectory:rootDirectory+11]))
+	assert.EqualValues(t, fat.AttrVolumeLabel, image[rootDirectory+11])
+
+	fs, implementation := mountFloppy(t, image)
+	entries, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// Everything but the bad cluster is free.
+	stat := implementation.FSStat()
+	assert.Equal(t, stat.TotalBlocks-1, stat.BlocksFree)
+
+	require.NoError(t, fs.WriteFile("/new.txt", []byte("hello"), 0o644))
+}
+
+func TestReformat__ReplaceBoot(t *testing.T) {
+	image := makeUsedFloppyImage(t)
+
+	err := fat.Reformat(
+		&growableImage{data: image},
+		fat.ReformatOptions{SerialNumber: 0xCAFEF00D, Label: "FRESH"},
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte{0xEB, 0x3C, 0x90}, image[:3])
+	assert.Equal(t, "MSWIN4.1", string(image[3:11]))
+	assert.EqualValues(t, 0xCAFEF00D, binary.LittleEndian.Uint32(image[39:]))
+	assert.Equal(t, "FRESH      ", string(image[43:54]))
+	assert.Equal(t, []byte{0xCD, 0x18, 0xEB, 0xFE, 0, 0}, image[62:68])
+	assert.Equal(t, []byte{0x55, 0xAA}, image[510:512])
+
+	// The old label's directory entry is gone.
+	rootDirectory := 19 * 512
+	assert.Equal(t, make([]byte, 224*fat.DirentSize), image[rootDirectory:rootDirectory+224*fat.DirentSize])
+
+	description, err := fat.Describe(bytes.NewReader(image), int64(len(image)))
+	require.NoError(t, err)
+	assert.Equal(t, "FRESH", description.Stat.Label)
+}
+
+// Bad options must be caught before anything is erased.
+func TestReformat__LabelTooLong(t *testing.T) {
+	image := makeUsedFloppyImage(t)
+	original := append([]byte{}, image...)
+
+	err := fat.Reformat(
+		&growableImage{data: image},
+		fat.ReformatOptions{Label: "MUCH TOO LONG"},
+	)
+	assert.ErrorIs(t, err, disko.ErrArgumentOutOfRange)
+	assert.Equal(t, original, image)
+}
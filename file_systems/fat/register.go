@@ -0,0 +1,250 @@
+package fat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/dargueta/disko"
+)
+
+// Features gives the features supported by all versions of the FAT file system.
+var Features = disko.FSFeatures{
+	HasDirectories:  true,
+	HasCreatedTime:  true,
+	HasAccessedTime: true,
+	HasModifiedTime: true,
+	TimestampEpoch:  fatEpoch,
+	// Creation times have a separate byte for hundredths of a second, but
+	// modification times only have two-second resolution, and last access
+	// times are only a date.
+	CreatedTimeResolution:  10 * time.Millisecond,
+	AccessedTimeResolution: 24 * time.Hour,
+	ModifiedTimeResolution: 2 * time.Second,
+	TimestampRounding:      disko.TimestampTruncate,
+	DefaultNameEncoding:    disko.FSTextEncodingASCII,
+	SupportsBootCode:       true,
+	// FAT12 and FAT16 have 448 bytes of space for boot code. FAT32 only has
+	// 420, but the boot code may also continue into the reserved sectors.
+	MaxBootCodeSize:    448,
+	DefaultBlockSize:   512,
+	MinTotalBlocks:     1,
+	MaxTotalBlocks:     0xFFFFFFFF,
+	MaxVolumeLabelSize: 11,
+	// File sizes are stored in a 32-bit field.
+	MaxFileSize: 0xFFFFFFFF,
+	// DOS keeps the current directory as the drive letter, a colon, the path,
+	// and a null byte in 67 bytes, leaving 64 for the path.
+	MaxPathLength: 64,
+}
+
+func init() {
+	disko.RegisterFileSystem(
+		disko.FileSystemRegistration{
+			Name:         "fat",
+			Description:  "FAT12/FAT16/FAT32",
+			Features:     Features,
+			Detect:       Detect,
+			HasSignature: true,
+			Describe:     Describe,
+			Layout:       Layout,
+			New:          NewDriver,
+		},
+	)
+}
+
+// readBootSector reads and validates the boot sector of an image. Since this is
+// only used for inspecting images, all compatibility options are enabled. If the
+// boot sector has no valid BPB, or its media descriptor doesn't match the FAT's,
+// the layout is inferred from the FAT with [InferMSXDOSBootSector].
+func readBootSector(image io.ReaderAt, size int64) (*FATBootSector, []byte, disko.DriverError) {
+	if size < 512 {
+		return nil, nil, disko.ErrInvalidFileSystem.WithMessage(
+			"image is too small to contain a boot sector")
+	}
+
+	rawSector := make([]byte, 512)
+	_, err := image.ReadAt(rawSector, 0)
+	if err != nil {
+		return nil, nil, disko.ErrIOFailed.Wrap(err)
+	}
+
+	bootSector, err := NewFATBootSectorFromStreamWithOptions(
+		bytes.NewReader(rawSector),
+		CompatibilityOptions{AllowSmallSectors: true, AtariST: true, MSXDOS: true},
+	)
+	// MSX-DOS supports every DOS 1.x format, so this covers those too.
+	bootSector, err = resolveMSXDOSBootSector(image, size, bootSector, err)
+	if err != nil {
+		return nil, nil, disko.CastToDriverError(err)
+	}
+	return bootSector, rawSector, nil
+}
+
+// Detect returns true if `image` appears to contain a FAT file system. It
+// implements the detection function for [disko.FileSystemRegistration].
+func Detect(image io.ReaderAt, size int64) bool {
+	bootSector, rawSector, err := readBootSector(image, size)
+	if err != nil {
+		return false
+	} else if bootSector.BPBInferred {
+		// DOS 1.x boot sectors don't follow the conventions below, but getting
+		// a geometry from the FAT is already a strong enough signal.
+		return true
+	} else if LooksLikeAtariSTBootSector(rawSector) {
+		// TOS doesn't need an x86 jump, and its formatters don't always write a
+		// standard media descriptor.
+		return true
+	}
+
+	// The boot sector must begin with a jump instruction, either a short jump
+	// followed by a NOP or a near jump.
+	isJump := (bootSector.JmpBoot[0] == 0xEB && bootSector.JmpBoot[2] == 0x90) ||
+		bootSector.JmpBoot[0] == 0xE9
+
+	// Valid media descriptors are 0xF0 and 0xF8-0xFF.
+	isValidMedia := bootSector.Media == 0xF0 || bootSector.Media >= 0xF8
+	return isJump && isValidMedia
+}
+
+// Describe decodes the boot sector of a FAT image and counts its free clusters.
+// It implements the description function for [disko.FileSystemRegistration].
+func Describe(image io.ReaderAt, size int64) (disko.ImageDescription, disko.DriverError) {
+	bootSector, rawSector, err := readBootSector(image, size)
+	if err != nil {
+		return disko.ImageDescription{}, err
+	}
+
+	header := []disko.HeaderField{
+		{Name: "OEM name", Value: strings.TrimRight(string(bootSector.OEMName[:]), " \x00")},
+		{Name: "Bytes per sector", Value: bootSector.BytesPerSector},
+		{Name: "Sectors per cluster", Value: bootSector.SectorsPerCluster},
+		{Name: "Reserved sectors", Value: bootSector.ReservedSectors},
+		{Name: "Number of FATs", Value: bootSector.NumFATs},
+		{Name: "Root directory entries", Value: bootSector.RootEntryCount},
+		{Name: "Media descriptor", Value: fmt.Sprintf("%#02x", bootSector.Media)},
+		{Name: "Sectors per FAT", Value: bootSector.SectorsPerFAT},
+		{Name: "Sectors per track", Value: bootSector.SectorsPerTrack},
+		{Name: "Heads", Value: bootSector.NumHeads},
+		{Name: "Hidden sectors", Value: bootSector.HiddenSectors},
+		{Name: "FAT version", Value: bootSector.FATVersion},
+		{Name: "Total clusters", Value: bootSector.TotalClusters},
+		{Name: "First data sector", Value: bootSector.FirstDataSector},
+	}
+	if bootSector.BPBInferred {
+		header = append(
+			header,
+			disko.HeaderField{Name: "BPB", Value: "none, inferred from media descriptor"},
+		)
+	}
+
+	isAtariST := !bootSector.BPBInferred && LooksLikeAtariSTBootSector(rawSector)
+	if isAtariST {
+		header = append(
+			header,
+			disko.HeaderField{
+				Name:  "Atari ST serial number",
+				Value: fmt.Sprintf("%06X", AtariSTSerialNumber(rawSector)),
+			},
+			disko.HeaderField{
+				Name:  "Atari ST executable",
+				Value: IsAtariSTBootSectorExecutable(rawSector),
+			},
+		)
+	}
+
+	// The extended boot record is at a different place in FAT32.
+	extendedOffset := 36
+	if bootSector.FATVersion == 32 {
+		extendedOffset = 64
+	}
+
+	stat := disko.FSStat{
+		BlockSize:     bootSector.BytesPerCluster,
+		TotalBlocks:   uint64(bootSector.TotalClusters),
+		MaxNameLength: 12,
+	}
+
+	// 0x29 indicates the volume ID, label, and file system type are present.
+	// 0x28 indicates only the volume ID is. Images without a BPB don't have an
+	// extended boot record either, and neither do Atari ST disks.
+	signature := rawSector[extendedOffset+2]
+	if bootSector.BPBInferred || isAtariST {
+		signature = 0
+	}
+	if signature == 0x28 || signature == 0x29 {
+		volumeID := binary.LittleEndian.Uint32(rawSector[extendedOffset+3:])
+		stat.FileSystemID = fmt.Sprintf("%04X-%04X", volumeID>>16, volumeID&0xFFFF)
+		header = append(header, disko.HeaderField{Name: "Volume ID", Value: stat.FileSystemID})
+	}
+	if signature == 0x29 {
+		stat.Label = strings.TrimRight(
+			string(rawSector[extendedOffset+7:extendedOffset+18]), " \x00")
+		header = append(
+			header,
+			disko.HeaderField{Name: "Volume label", Value: stat.Label},
+			disko.HeaderField{
+				Name:  "File system type",
+				Value: strings.TrimRight(string(rawSector[extendedOffset+18:extendedOffset+26]), " "),
+			},
+		)
+	}
+
+	freeClusters, err := countFreeClusters(image, bootSector)
+	if err != nil {
+		return disko.ImageDescription{}, err
+	}
+	stat.BlocksFree = uint64(freeClusters)
+	stat.BlocksAvailable = uint64(freeClusters)
+
+	return disko.ImageDescription{Stat: stat, Header: header}, nil
+}
+
+// getFATEntry returns the value of entry `index` in a raw FAT.
+func getFATEntry(fat []byte, fatVersion int, index uint) uint32 {
+	switch fatVersion {
+	case 12:
+		// Entries are 12 bits, packed two to every three bytes.
+		offset := index + index/2
+		value := uint32(binary.LittleEndian.Uint16(fat[offset:]))
+		if index%2 == 1 {
+			return value >> 4
+		}
+		return value & 0x0FFF
+	case 16:
+		return uint32(binary.LittleEndian.Uint16(fat[index*2:]))
+	default:
+		// The high four bits of a FAT32 entry are reserved.
+		return binary.LittleEndian.Uint32(fat[index*4:]) & 0x0FFFFFFF
+	}
+}
+
+// countFreeClusters reads the first FAT and returns the number of unallocated
+// clusters in it.
+func countFreeClusters(image io.ReaderAt, bootSector *FATBootSector) (uint, disko.DriverError) {
+	fat := make([]byte, bootSector.SectorsPerFAT*uint(bootSector.BytesPerSector))
+	_, err := image.ReadAt(fat, int64(bootSector.ReservedSectors)*int64(bootSector.BytesPerSector))
+	if err != nil && err != io.EOF {
+		return 0, disko.ErrIOFailed.Wrap(err)
+	}
+
+	// The FAT may be too small for the number of clusters the volume claims to
+	// have. Only count the clusters it can describe.
+	maxEntries := uint(len(fat)) * 8 / uint(bootSector.FATVersion)
+	lastCluster := bootSector.TotalClusters + 1
+	if lastCluster >= maxEntries {
+		lastCluster = maxEntries - 1
+	}
+
+	// The first two entries are reserved, so cluster numbering starts at 2.
+	free := uint(0)
+	for cluster := uint(2); cluster <= lastCluster; cluster++ {
+		if getFATEntry(fat, bootSector.FATVersion, cluster) == 0 {
+			free++
+		}
+	}
+	return free, nil
+}
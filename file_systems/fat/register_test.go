@@ -0,0 +1,190 @@
+package fat_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xaionaro-go/bytesextra"
+)
+
+// makeFloppyImage creates a freshly formatted 1.44 MB FAT12 floppy image with
+// one file occupying clusters 2 and 3.
+func makeFloppyImage() []byte {
+	image := make([]byte, 2880*512)
+	copy(image, []byte{0xEB, 0x3C, 0x90})
+	copy(image[3:], "MSDOS5.0")
+	binary.LittleEndian.PutUint16(image[11:], 512)  // Bytes per sector
+	image[13] = 1                                   // Sectors per cluster
+	binary.LittleEndian.PutUint16(image[14:], 1)    // Reserved sectors
+	image[16] = 2                                   // Number of FATs
+	binary.LittleEndian.PutUint16(image[17:], 224)  // Root directory entries
+	binary.LittleEndian.PutUint16(image[19:], 2880) // Total sectors
+	image[21] = 0xF0                                // Media descriptor
+	binary.LittleEndian.PutUint16(image[22:], 9)    // Sectors per FAT
+	binary.LittleEndian.PutUint16(image[24:], 18)   // Sectors per track
+	binary.LittleEndian.PutUint16(image[26:], 2)    // Heads
+	image[38] = 0x29
+	binary.LittleEndian.PutUint32(image[39:], 0x1234ABCD)
+	copy(image[43:], "TESTVOLUME ")
+	copy(image[54:], "FAT12   ")
+	image[510] = 0x55
+	image[511] = 0xAA
+
+	// Media descriptor and end-of-chain marker in entries 0 and 1, then a two
+	// cluster file: 2 -> 3 -> EOC.
+	for _, fatStart := range []int{512, 10 * 512} {
+		copy(image[fatStart:], []byte{0xF0, 0xFF, 0xFF, 0x03, 0xF0, 0xFF})
+	}
+	return image
+}
+
+func TestDetect__FAT12Floppy(t *testing.T) {
+	image := makeFloppyImage()
+	assert.True(t, fat.Detect(bytes.NewReader(image), int64(len(image))))
+
+	matches := disko.Detect(bytes.NewReader(image), int64(len(image)))
+	require.Len(t, matches, 1)
+	assert.Equal(t, "fat", matches[0].Name)
+}
+
+func TestDetect__RejectsGarbage(t *testing.T) {
+	image := bytes.Repeat([]byte{0xEB}, 4096)
+	assert.False(t, fat.Detect(bytes.NewReader(image), int64(len(image))))
+
+	image = make([]byte, 4096)
+	assert.False(t, fat.Detect(bytes.NewReader(image), int64(len(image))))
+}
+
+// Features must be available from a new implementation without mounting it,
+// even if the image isn't a valid FAT file system, and match the registration.
+func TestNewDriver__FeaturesBeforeMount(t *testing.T) {
+	registration, ok := disko.LookUpFileSystem("fat")
+	require.True(t, ok)
+
+	image := make([]byte, 4096)
+	implementation, err := registration.New(bytesextra.NewReadWriteSeeker(image))
+	require.NoError(t, err)
+	assert.Equal(t, registration.Features, implementation.GetFSFeatures())
+
+	assert.Error(t, implementation.Mount(disko.MountFlagsAllowRead))
+	assert.Equal(t, registration.Features, implementation.GetFSFeatures())
+}
+
+func TestDescribe__FAT12Floppy(t *testing.T) {
+	image := makeFloppyImage()
+	description, err := fat.Describe(bytes.NewReader(image), int64(len(image)))
+	require.NoError(t, err)
+
+	// 2880 sectors - 1 reserved - 18 FAT - 14 root directory = 2847 clusters.
+	assert.EqualValues(t, 2847, description.Stat.TotalBlocks)
+	assert.EqualValues(t, 2845, description.Stat.BlocksFree)
+	assert.EqualValues(t, 512, description.Stat.BlockSize)
+	assert.Equal(t, "TESTVOLUME", description.Stat.Label)
+	assert.Equal(t, "1234-ABCD", description.Stat.FileSystemID)
+}
+
+func TestNewFATBootSectorFromStream__FirstDataSector(t *testing.T) {
+	bootSector, err := fat.NewFATBootSectorFromStream(bytes.NewReader(makeFloppyImage()))
+	require.NoError(t, err)
+	assert.EqualValues(t, 12, bootSector.FATVersion)
+	assert.EqualValues(t, 33, bootSector.FirstDataSector)
+	assert.EqualValues(t, 2847, bootSector.TotalDataSectors)
+}
+
+// makeSmallSectorImage creates a FAT12 image with 256-byte sectors, which is
+// outside Microsoft's specification but was used by some early DOS variants.
+func makeSmallSectorImage() []byte {
+	image := make([]byte, 1280*256)
+	copy(image, []byte{0xEB, 0x3C, 0x90})
+	copy(image[3:], "MSX_04  ")
+	binary.LittleEndian.PutUint16(image[11:], 256)  // Bytes per sector
+	image[13] = 2                                   // Sectors per cluster
+	binary.LittleEndian.PutUint16(image[14:], 1)    // Reserved sectors
+	image[16] = 2                                   // Number of FATs
+	binary.LittleEndian.PutUint16(image[17:], 64)   // Root directory entries
+	binary.LittleEndian.PutUint16(image[19:], 1280) // Total sectors
+	image[21] = 0xF9                                // Media descriptor
+	binary.LittleEndian.PutUint16(image[22:], 4)    // Sectors per FAT
+	binary.LittleEndian.PutUint16(image[24:], 16)   // Sectors per track
+	binary.LittleEndian.PutUint16(image[26:], 2)    // Heads
+
+	for _, fatStart := range []int{256, 5 * 256} {
+		copy(image[fatStart:], []byte{0xF9, 0xFF, 0xFF})
+	}
+	return image
+}
+
+func TestNewFATBootSectorFromStream__SmallSectors(t *testing.T) {
+	image := makeSmallSectorImage()
+
+	_, err := fat.NewFATBootSectorFromStream(bytes.NewReader(image))
+	assert.ErrorIs(t, err, disko.ErrNotSupported, "small sectors should be rejected by default")
+
+	bootSector, err := fat.NewFATBootSectorFromStreamWithOptions(
+		bytes.NewReader(image),
+		fat.CompatibilityOptionsFromMountFlags(fat.MountFlagsAllowSmallSectors),
+	)
+	require.NoError(t, err)
+	// 1 reserved + 2 * 4 FAT + 64 * 32 / 256 root directory = 17
+	assert.EqualValues(t, 17, bootSector.FirstDataSector)
+	assert.EqualValues(t, 512, bootSector.BytesPerCluster)
+	assert.EqualValues(t, (1280-17)/2, bootSector.TotalClusters)
+	assert.EqualValues(t, 16, bootSector.DirentsPerCluster)
+}
+
+func TestDescribe__SmallSectors(t *testing.T) {
+	image := makeSmallSectorImage()
+	assert.True(t, fat.Detect(bytes.NewReader(image), int64(len(image))))
+
+	description, err := fat.Describe(bytes.NewReader(image), int64(len(image)))
+	require.NoError(t, err)
+	assert.EqualValues(t, 631, description.Stat.TotalBlocks)
+	assert.EqualValues(t, 631, description.Stat.BlocksFree)
+	assert.EqualValues(t, 512, description.Stat.BlockSize)
+}
+
+// makeDOS1Image creates a 160 KiB DOS 1.x floppy image, which has no BPB.
+func makeDOS1Image() []byte {
+	image := make([]byte, 320*512)
+	// Beginning of the PC DOS 1.0 boot sector. There's code where the BPB would
+	// be in later versions.
+	copy(image, []byte{0xEB, 0x2F, 0x14, 0x00, 0x00, 0x00, 0x60, 0x00, 0x00, 0x00, 0x00})
+	for _, fatStart := range []int{512, 2 * 512} {
+		copy(image[fatStart:], []byte{0xFE, 0xFF, 0xFF, 0x03, 0xF0, 0xFF})
+	}
+	return image
+}
+
+func TestInferDOS1BootSector(t *testing.T) {
+	image := makeDOS1Image()
+
+	_, err := fat.NewFATBootSectorFromStream(bytes.NewReader(image))
+	require.Error(t, err, "image without a BPB should fail normal parsing")
+
+	bootSector, err := fat.InferDOS1BootSector(bytes.NewReader(image), int64(len(image)))
+	require.NoError(t, err)
+	assert.True(t, bootSector.BPBInferred)
+	assert.EqualValues(t, 0xFE, bootSector.Media)
+	// 1 reserved + 2 FAT + 64 * 32 / 512 root directory = 7
+	assert.EqualValues(t, 7, bootSector.FirstDataSector)
+	assert.EqualValues(t, 313, bootSector.TotalClusters)
+
+	_, err = fat.InferDOS1BootSector(bytes.NewReader(image[:300*512]), 300*512)
+	assert.ErrorIs(t, err, disko.ErrInvalidFileSystem, "truncated image should be rejected")
+}
+
+func TestDescribe__DOS1(t *testing.T) {
+	image := makeDOS1Image()
+	assert.True(t, fat.Detect(bytes.NewReader(image), int64(len(image))))
+
+	description, err := fat.Describe(bytes.NewReader(image), int64(len(image)))
+	require.NoError(t, err)
+	assert.EqualValues(t, 313, description.Stat.TotalBlocks)
+	assert.EqualValues(t, 311, description.Stat.BlocksFree)
+	assert.Empty(t, description.Stat.Label)
+}
@@ -0,0 +1,156 @@
+package fat
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dargueta/disko"
+	c "github.com/dargueta/disko/file_systems/common"
+)
+
+// rootDirHandle is the [disko.ObjectHandle] for the fixed-size root directory of
+// a FAT12 or FAT16 file system. See [NewRootDirectoryHandle].
+type rootDirHandle struct {
+	image      io.ReaderAt
+	bootSector *FATBootSector
+	closed     bool
+}
+
+// NewRootDirectoryHandle returns a [disko.ObjectHandle] for the root directory
+// of a FAT12 or FAT16 file system, which isn't stored in a cluster chain but in
+// a fixed region of sectors after the FATs. Its blocks are sectors, and it can't
+// be resized.
+//
+// The handle is writable if `image` also implements [io.WriterAt]. FAT32 root
+// directories are ordinary cluster chains, so this returns [disko.ErrNotSupported]
+// for them.
+func NewRootDirectoryHandle(
+	image io.ReaderAt,
+	bootSector *FATBootSector,
+) (disko.ObjectHandle, disko.DriverError) {
+	if bootSector.FATVersion == 32 {
+		return nil, disko.ErrNotSupported.WithMessage(
+			"FAT32 root directories are stored in a cluster chain")
+	}
+	return &rootDirHandle{image: image, bootSector: bootSector}, nil
+}
+
+// offsetOfBlock returns the offset in the image of sector `index` of the root
+// directory.
+func (handle *rootDirHandle) offsetOfBlock(index c.LogicalBlock) int64 {
+	bootSector := handle.bootSector
+	firstSector := uint(bootSector.ReservedSectors) + bootSector.TotalFATSectors
+	return (int64(firstSector) + int64(index)) * int64(bootSector.BytesPerSector)
+}
+
+func (handle *rootDirHandle) Stat() disko.FileStat {
+	bootSector := handle.bootSector
+	return disko.FileStat{
+		Nlinks:       1,
+		ModeFlags:    os.ModeDir | 0o777,
+		Size:         int64(bootSector.RootEntryCount) * DirentSize,
+		BlockSize:    int64(bootSector.BytesPerSector),
+		NumBlocks:    int64(bootSector.RootDirSectors),
+		CreatedAt:    disko.UndefinedTimestamp,
+		LastAccessed: disko.UndefinedTimestamp,
+		LastModified: disko.UndefinedTimestamp,
+		LastChanged:  disko.UndefinedTimestamp,
+		DeletedAt:    disko.UndefinedTimestamp,
+	}
+}
+
+// Resize fails unless the size isn't changing, since the number of entries in
+// the root directory is set when the file system is formatted.
+func (handle *rootDirHandle) Resize(newSize uint64) disko.DriverError {
+	if newSize == uint64(handle.Stat().Size) {
+		return nil
+	}
+	return disko.ErrNoSpaceOnDevice.WithMessage(
+		fmt.Sprintf(
+			"the root directory has a fixed size of %d entries",
+			handle.bootSector.RootEntryCount,
+		),
+	)
+}
+
+func (handle *rootDirHandle) ReadBlocks(index c.LogicalBlock, buffer []byte) disko.DriverError {
+	_, err := handle.image.ReadAt(buffer, handle.offsetOfBlock(index))
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	return nil
+}
+
+func (handle *rootDirHandle) WriteBlocks(index c.LogicalBlock, data []byte) disko.DriverError {
+	writer, ok := handle.image.(io.WriterAt)
+	if !ok {
+		return disko.ErrReadOnlyFileSystem
+	}
+
+	_, err := writer.WriteAt(data, handle.offsetOfBlock(index))
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	return nil
+}
+
+func (handle *rootDirHandle) ZeroOutBlocks(startIndex c.LogicalBlock, count uint) disko.DriverError {
+	buffer := make([]byte, count*uint(handle.bootSector.BytesPerSector))
+	return handle.WriteBlocks(startIndex, buffer)
+}
+
+func (handle *rootDirHandle) Unlink() disko.DriverError {
+	return disko.ErrNotPermitted.WithMessage("can't delete the root directory")
+}
+
+func (handle *rootDirHandle) Name() string {
+	return "/"
+}
+
+func (handle *rootDirHandle) SameAs(other disko.ObjectHandle) bool {
+	otherRoot, ok := other.(*rootDirHandle)
+	return ok && otherRoot.image == handle.image
+}
+
+func (handle *rootDirHandle) Close() error {
+	if handle.closed {
+		return disko.ErrFileDescriptorBadState
+	}
+	handle.closed = true
+	return nil
+}
+
+// ListDir implements [disko.SupportsListDirHandle]. Deleted entries and the
+// volume label are skipped.
+func (handle *rootDirHandle) ListDir() ([]string, disko.DriverError) {
+	bootSector := handle.bootSector
+	data := make([]byte, int(bootSector.RootDirSectors)*int(bootSector.BytesPerSector))
+	err := handle.ReadBlocks(0, data)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for i := 0; i < int(bootSector.RootEntryCount); i++ {
+		rawDirent, err := NewRawDirentFromBytes(data[i*DirentSize:])
+		if err != nil {
+			return nil, disko.CastToDriverError(err)
+		}
+
+		dirent, err := NewDirentFromRaw(bootSector, &rawDirent)
+		if errors.Is(err, disko.ErrNotFound) {
+			// Free entry, so there are no more after it.
+			break
+		} else if err != nil {
+			return nil, disko.CastToDriverError(err)
+		}
+
+		if dirent.isDeleted || dirent.AttributeFlags&AttrVolumeLabel != 0 {
+			continue
+		}
+		names = append(names, dirent.Name())
+	}
+	return names, nil
+}
@@ -0,0 +1,73 @@
+package fat_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRootDirectoryHandle__Floppy(t *testing.T) {
+	image := makeFloppyImage()
+	writeRawDirent(image, floppyRootDirOffset, "TESTVOLUME ", fat.AttrVolumeLabel, 0)
+	writeRawDirent(image, floppyRootDirOffset+32, "README  TXT", 0, 2)
+	writeRawDirent(image, floppyRootDirOffset+64, "\xE5ELETED TXT", 0, 0)
+	writeRawDirent(image, floppyRootDirOffset+96, "SUBDIR     ", fat.AttrDirectory, 0)
+
+	bootSector, err := fat.NewFATBootSectorFromStream(bytes.NewReader(image))
+	require.NoError(t, err)
+
+	handle, driverErr := fat.NewRootDirectoryHandle(bytes.NewReader(image), bootSector)
+	require.NoError(t, driverErr)
+	defer handle.Close()
+
+	assert.Equal(t, "/", handle.Name())
+
+	stat := handle.Stat()
+	assert.True(t, stat.IsDir())
+	assert.EqualValues(t, 224*32, stat.Size)
+	assert.EqualValues(t, 512, stat.BlockSize)
+	assert.EqualValues(t, 14, stat.NumBlocks)
+
+	lister, ok := handle.(disko.SupportsListDirHandle)
+	require.True(t, ok, "root directory handle can't list its contents")
+	names, driverErr := lister.ListDir()
+	require.NoError(t, driverErr)
+	assert.Equal(t, []string{"README.TXT", "SUBDIR"}, names)
+
+	buffer := make([]byte, 512)
+	require.NoError(t, handle.ReadBlocks(0, buffer))
+	assert.Equal(t, image[floppyRootDirOffset:floppyRootDirOffset+512], buffer)
+
+	assert.ErrorIs(t, handle.WriteBlocks(0, buffer), disko.ErrReadOnlyFileSystem)
+	assert.NoError(t, handle.Resize(uint64(stat.Size)))
+	assert.ErrorIs(t, handle.Resize(uint64(stat.Size)+32), disko.ErrNoSpaceOnDevice)
+}
+
+func TestNewRootDirectoryHandle__Write(t *testing.T) {
+	image := makeFloppyImage()
+	bootSector, err := fat.NewFATBootSectorFromStream(bytes.NewReader(image))
+	require.NoError(t, err)
+
+	file, err := os.CreateTemp(t.TempDir(), "floppy")
+	require.NoError(t, err)
+	defer file.Close()
+	_, err = file.Write(image)
+	require.NoError(t, err)
+
+	handle, driverErr := fat.NewRootDirectoryHandle(file, bootSector)
+	require.NoError(t, driverErr)
+	defer handle.Close()
+
+	block := bytes.Repeat([]byte{0xAB}, 512)
+	require.NoError(t, handle.WriteBlocks(13, block))
+
+	written := make([]byte, 512)
+	_, err = file.ReadAt(written, floppyRootDirOffset+13*512)
+	require.NoError(t, err)
+	assert.Equal(t, block, written)
+}
@@ -0,0 +1,430 @@
+package fat
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/dargueta/disko"
+)
+
+// ShrinkableImage is the interface [ShrinkImage] needs to modify an image in
+// place.
+type ShrinkableImage interface {
+	GrowableImage
+	Truncate(size int64) error
+}
+
+// ShrinkImage reduces the FAT file system in `image` to `newTotalSectors`
+// sectors and truncates the image to match. Clusters in use past the new end
+// of the file system are moved into free clusters before it, and the FAT and
+// every directory entry pointing to them are updated.
+//
+// Like [GrowImage], this can't change the FAT version, and fails with
+// [disko.ErrNotSupported] if the new size would require it. If there aren't
+// enough free clusters to move everything into, it fails with
+// [disko.ErrNoSpaceOnDevice] without modifying the image. See
+// [MinimumTotalSectors] for the smallest size that will work.
+//
+// The image must not be mounted while this is running. If this is interrupted,
+// the image will likely be corrupted, so make a copy first.
+func ShrinkImage(image ShrinkableImage, newTotalSectors uint) disko.DriverError {
+	bootSector, rawSector, err := readBootSectorForResize(image)
+	if err != nil {
+		return err
+	}
+
+	oldTotalSectors := bootSector.totalSectors()
+	if newTotalSectors >= oldTotalSectors {
+		return disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf(
+				"can't shrink image from %d sectors to %d: new size must be smaller",
+				oldTotalSectors,
+				newTotalSectors,
+			),
+		)
+	} else if newTotalSectors <= uint(bootSector.FirstDataSector) {
+		return disko.ErrNoSpaceOnDevice.WithMessage(
+			fmt.Sprintf(
+				"can't shrink image to %d sectors: the data area starts at sector %d",
+				newTotalSectors,
+				bootSector.FirstDataSector,
+			),
+		)
+	}
+
+	newTotalClusters :=
+		(newTotalSectors - uint(bootSector.FirstDataSector)) / uint(bootSector.SectorsPerCluster)
+	newVersion := DetermineFATVersion(newTotalClusters)
+	if newVersion != bootSector.FATVersion {
+		return disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf(
+				"shrinking to %d sectors would convert FAT%d to FAT%d",
+				newTotalSectors,
+				bootSector.FATVersion,
+				newVersion,
+			),
+		)
+	}
+
+	fat, err := readFAT(image, bootSector)
+	if err != nil {
+		return err
+	}
+
+	newEnd := newTotalClusters + 2
+	relocations, err := planRelocations(bootSector, fat, newEnd)
+	if err != nil {
+		return err
+	}
+
+	var rootCluster uint
+	if bootSector.FATVersion == 32 {
+		rootCluster = uint(binary.LittleEndian.Uint32(rawSector[fat32RootClusterOffset:]))
+	}
+
+	// Find all references to clusters before anything is moved, while the
+	// directories can still be read from their old locations.
+	references, err := findClusterReferences(image, bootSector, fat, rootCluster)
+	if err != nil {
+		return err
+	}
+
+	// Copy the data first, so that nothing points to the new clusters until
+	// they have the right contents.
+	clusterData := make([]byte, bootSector.BytesPerCluster)
+	for oldCluster, newCluster := range relocations {
+		_, ioErr := image.ReadAt(clusterData, clusterOffset(bootSector, oldCluster))
+		if ioErr != nil {
+			return disko.ErrIOFailed.Wrap(ioErr)
+		}
+		_, ioErr = image.WriteAt(clusterData, clusterOffset(bootSector, newCluster))
+		if ioErr != nil {
+			return disko.ErrIOFailed.Wrap(ioErr)
+		}
+	}
+
+	err = writeFATs(image, bootSector, relocateFAT(bootSector, fat, relocations, newEnd))
+	if err != nil {
+		return err
+	}
+
+	for _, reference := range references {
+		err = reference.relocate(image, bootSector, relocations)
+		if err != nil {
+			return err
+		}
+	}
+
+	if newRoot, ok := relocations[rootCluster]; ok {
+		binary.LittleEndian.PutUint32(rawSector[fat32RootClusterOffset:], uint32(newRoot))
+	}
+
+	err = updateTotalSectors(
+		image,
+		bootSector,
+		rawSector,
+		newTotalSectors,
+		int64(newTotalClusters)-int64(bootSector.TotalClusters),
+	)
+	if err != nil {
+		return err
+	}
+
+	ioErr := image.Truncate(int64(newTotalSectors) * int64(bootSector.BytesPerSector))
+	if ioErr != nil {
+		return disko.ErrIOFailed.Wrap(ioErr)
+	}
+	return nil
+}
+
+// ResizeImage grows or shrinks the FAT file system in `image` to
+// `newTotalSectors` sectors with [GrowImage] or [ShrinkImage]. It does nothing
+// if the file system is already that size.
+func ResizeImage(image ShrinkableImage, newTotalSectors uint) disko.DriverError {
+	bootSector, _, err := readBootSectorForResize(image)
+	if err != nil {
+		return err
+	}
+
+	totalSectors := bootSector.totalSectors()
+	if newTotalSectors > totalSectors {
+		return GrowImage(image, newTotalSectors)
+	} else if newTotalSectors < totalSectors {
+		return ShrinkImage(image, newTotalSectors)
+	}
+	return nil
+}
+
+// MinimumTotalSectors returns the smallest size, in sectors, that
+// [ShrinkImage] can shrink the file system in `image` to. Bad clusters are
+// counted as used, so this may be slightly larger than necessary.
+func MinimumTotalSectors(image GrowableImage) (uint, disko.DriverError) {
+	bootSector, _, err := readBootSectorForResize(image)
+	if err != nil {
+		return 0, err
+	}
+
+	fat, err := readFAT(image, bootSector)
+	if err != nil {
+		return 0, err
+	}
+
+	usedClusters := uint(0)
+	for cluster := uint(2); cluster < bootSector.TotalClusters+2; cluster++ {
+		if fatEntry(fat, bootSector.FATVersion, cluster) != 0 {
+			usedClusters++
+		}
+	}
+
+	// The file system needs at least one cluster, and enough that it stays the
+	// same FAT version.
+	switch {
+	case bootSector.FATVersion == 16 && usedClusters < 4085:
+		usedClusters = 4085
+	case bootSector.FATVersion == 32 && usedClusters < 65525:
+		usedClusters = 65525
+	case usedClusters == 0:
+		usedClusters = 1
+	}
+
+	return uint(bootSector.FirstDataSector) + usedClusters*uint(bootSector.SectorsPerCluster), nil
+}
+
+// planRelocations picks a free cluster before `newEnd` for every cluster in use
+// at or after it. Bad clusters past the end are dropped rather than moved.
+func planRelocations(
+	bootSector *FATBootSector, fat []byte, newEnd uint,
+) (map[uint]uint, disko.DriverError) {
+	badCluster := badClusterMarker(bootSector.FATVersion)
+
+	freeClusters := []uint{}
+	for cluster := uint(2); cluster < newEnd; cluster++ {
+		if fatEntry(fat, bootSector.FATVersion, cluster) == 0 {
+			freeClusters = append(freeClusters, cluster)
+		}
+	}
+
+	clustersToMove := []uint{}
+	for cluster := newEnd; cluster < bootSector.TotalClusters+2; cluster++ {
+		entry := fatEntry(fat, bootSector.FATVersion, cluster)
+		if entry != 0 && entry != badCluster {
+			clustersToMove = append(clustersToMove, cluster)
+		}
+	}
+
+	if len(clustersToMove) > len(freeClusters) {
+		return nil, disko.ErrNoSpaceOnDevice.WithMessage(
+			fmt.Sprintf(
+				"%d clusters past the new end of the file system are in use, but"+
+					" there are only %d free clusters before it",
+				len(clustersToMove),
+				len(freeClusters),
+			),
+		)
+	}
+
+	relocations := make(map[uint]uint, len(clustersToMove))
+	for i, cluster := range clustersToMove {
+		relocations[cluster] = freeClusters[i]
+	}
+	return relocations, nil
+}
+
+// relocateFAT returns a copy of `fat` with the entries of relocated clusters
+// moved, every pointer to them updated, and all entries at or after `newEnd`
+// cleared.
+func relocateFAT(
+	bootSector *FATBootSector, fat []byte, relocations map[uint]uint, newEnd uint,
+) []byte {
+	version := bootSector.FATVersion
+	newFAT := make([]byte, len(fat))
+	copy(newFAT, fat)
+
+	remap := func(entry uint32) uint32 {
+		if newCluster, ok := relocations[uint(entry)]; ok {
+			return uint32(newCluster)
+		}
+		return entry
+	}
+
+	for cluster := uint(2); cluster < newEnd; cluster++ {
+		setFATEntry(newFAT, version, cluster, remap(fatEntry(fat, version, cluster)))
+	}
+	for oldCluster, newCluster := range relocations {
+		setFATEntry(newFAT, version, newCluster, remap(fatEntry(fat, version, oldCluster)))
+	}
+	for cluster := newEnd; cluster < bootSector.TotalClusters+2; cluster++ {
+		setFATEntry(newFAT, version, cluster, 0)
+	}
+	return newFAT
+}
+
+// clusterReference is the location of a directory entry that points to a
+// cluster. Entries in the fixed root directory of FAT12 and FAT16 have a
+// cluster of 0, and their offset is from the beginning of the image. For all
+// others, the offset is from the beginning of the cluster.
+type clusterReference struct {
+	cluster uint
+	offset  int64
+}
+
+// relocate updates the first cluster of the directory entry if it was moved.
+// The directory entry itself may have been moved, too.
+func (reference clusterReference) relocate(
+	image GrowableImage, bootSector *FATBootSector, relocations map[uint]uint,
+) disko.DriverError {
+	offset := reference.offset
+	if reference.cluster != 0 {
+		cluster := reference.cluster
+		if newCluster, ok := relocations[cluster]; ok {
+			cluster = newCluster
+		}
+		offset += clusterOffset(bootSector, cluster)
+	}
+
+	rawDirent := make([]byte, DirentSize)
+	_, err := image.ReadAt(rawDirent, offset)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+
+	firstCluster, ok := relocations[direntFirstCluster(bootSector, rawDirent)]
+	if !ok {
+		return nil
+	}
+
+	binary.LittleEndian.PutUint16(rawDirent[26:], uint16(firstCluster))
+	if bootSector.FATVersion == 32 {
+		binary.LittleEndian.PutUint16(rawDirent[20:], uint16(firstCluster>>16))
+	}
+	_, err = image.WriteAt(rawDirent, offset)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	return nil
+}
+
+// direntFirstCluster returns the first cluster of a raw directory entry. The
+// high 16 bits are only used by FAT32.
+func direntFirstCluster(bootSector *FATBootSector, rawDirent []byte) uint {
+	cluster := uint(binary.LittleEndian.Uint16(rawDirent[26:]))
+	if bootSector.FATVersion == 32 {
+		cluster |= uint(binary.LittleEndian.Uint16(rawDirent[20:])) << 16
+	}
+	return cluster
+}
+
+// findClusterReferences walks the entire directory tree and returns the
+// location of every directory entry that points to a cluster, including `.` and
+// `..`. `rootCluster` is the first cluster of the root directory on FAT32, and
+// ignored otherwise.
+func findClusterReferences(
+	image GrowableImage, bootSector *FATBootSector, fat []byte, rootCluster uint,
+) ([]clusterReference, disko.DriverError) {
+	references := []clusterReference{}
+	pendingDirectories := []uint{}
+	visited := map[uint]bool{}
+
+	// scanDirectory records the references in a directory's contents. `locate`
+	// gives the location of the directory entry at the given offset into them.
+	scanDirectory := func(data []byte, locate func(offset int) clusterReference) {
+		for offset := 0; offset+DirentSize <= len(data); offset += DirentSize {
+			rawDirent := data[offset : offset+DirentSize]
+			attributes := rawDirent[11]
+
+			if rawDirent[0] == 0x00 {
+				// End of the directory.
+				return
+			} else if rawDirent[0] == 0xE5 || attributes&0x0F == 0x0F {
+				// Deleted entry or long file name.
+				continue
+			} else if attributes&AttrVolumeLabel != 0 {
+				continue
+			}
+
+			cluster := direntFirstCluster(bootSector, rawDirent)
+			if cluster == 0 {
+				continue
+			}
+			references = append(references, locate(offset))
+
+			isDotEntry := rawDirent[0] == '.'
+			if attributes&AttrDirectory != 0 && !isDotEntry && !visited[cluster] {
+				visited[cluster] = true
+				pendingDirectories = append(pendingDirectories, cluster)
+			}
+		}
+	}
+
+	if bootSector.FATVersion == 32 {
+		visited[rootCluster] = true
+		pendingDirectories = append(pendingDirectories, rootCluster)
+	} else {
+		rootStart := int64(uint(bootSector.ReservedSectors)+bootSector.TotalFATSectors) *
+			int64(bootSector.BytesPerSector)
+		rootDirectory := make([]byte, bootSector.RootDirSectors*uint(bootSector.BytesPerSector))
+		_, err := image.ReadAt(rootDirectory, rootStart)
+		if err != nil {
+			return nil, disko.ErrIOFailed.Wrap(err)
+		}
+		scanDirectory(rootDirectory, func(offset int) clusterReference {
+			return clusterReference{offset: rootStart + int64(offset)}
+		})
+	}
+
+	for len(pendingDirectories) > 0 {
+		directory := pendingDirectories[0]
+		pendingDirectories = pendingDirectories[1:]
+
+		chain, err := readClusterChain(bootSector, fat, directory)
+		if err != nil {
+			return nil, err
+		}
+
+		bytesPerCluster := int(bootSector.BytesPerCluster)
+		data := make([]byte, len(chain)*bytesPerCluster)
+		for i, cluster := range chain {
+			_, ioErr := image.ReadAt(
+				data[i*bytesPerCluster:(i+1)*bytesPerCluster],
+				clusterOffset(bootSector, cluster),
+			)
+			if ioErr != nil {
+				return nil, disko.ErrIOFailed.Wrap(ioErr)
+			}
+		}
+
+		scanDirectory(data, func(offset int) clusterReference {
+			return clusterReference{
+				cluster: chain[offset/bytesPerCluster],
+				offset:  int64(offset % bytesPerCluster),
+			}
+		})
+	}
+
+	return references, nil
+}
+
+// readClusterChain returns the clusters in the chain beginning at `first`.
+func readClusterChain(
+	bootSector *FATBootSector, fat []byte, first uint,
+) ([]uint, disko.DriverError) {
+	badCluster := badClusterMarker(bootSector.FATVersion)
+	chain := []uint{}
+
+	for cluster := first; ; {
+		if cluster < 2 || cluster >= bootSector.TotalClusters+2 {
+			return nil, disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf("invalid cluster %d in chain starting at %d", cluster, first))
+		} else if uint(len(chain)) > bootSector.TotalClusters {
+			return nil, disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf("cluster chain starting at %d has a cycle", first))
+		}
+
+		chain = append(chain, cluster)
+		next := fatEntry(fat, bootSector.FATVersion, cluster)
+		if next >= badCluster {
+			return chain, nil
+		}
+		cluster = uint(next)
+	}
+}
@@ -0,0 +1,133 @@
+package fat_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/fat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Layout of the floppy created by makeFloppyImage.
+const (
+	floppyFATSectors    = 9
+	floppyRootDirOffset = 19 * 512
+	floppyDataSector    = 33
+)
+
+func floppyClusterOffset(cluster int) int {
+	return (floppyDataSector + cluster - 2) * 512
+}
+
+func getFAT12Entry(image []byte, cluster int) uint16 {
+	value := binary.LittleEndian.Uint16(image[512+cluster*3/2:])
+	if cluster%2 == 0 {
+		return value & 0x0FFF
+	}
+	return value >> 4
+}
+
+func setFAT12Entry(image []byte, cluster int, value uint16) {
+	for _, fatStart := range []int{512, (1 + floppyFATSectors) * 512} {
+		offset := fatStart + cluster*3/2
+		current := binary.LittleEndian.Uint16(image[offset:])
+		if cluster%2 == 0 {
+			current = current&0xF000 | value
+		} else {
+			current = current&0x000F | value<<4
+		}
+		binary.LittleEndian.PutUint16(image[offset:], current)
+	}
+}
+
+func writeRawDirent(image []byte, offset int, name string, attributes byte, cluster uint16) {
+	copy(image[offset:offset+11], []byte(name))
+	image[offset+11] = attributes
+	binary.LittleEndian.PutUint16(image[offset+26:], cluster)
+}
+
+func direntCluster(image []byte, offset int) uint16 {
+	return binary.LittleEndian.Uint16(image[offset+26:])
+}
+
+// makeFragmentedFloppyImage creates a floppy with a subdirectory and files at
+// the end of the disk:
+//
+//	/SUBDIR       cluster 2700
+//	/SUBDIR/INNER cluster 2750
+//	/BIG.BIN      clusters 2800 and 2801
+func makeFragmentedFloppyImage() []byte {
+	image := makeFloppyImage()
+
+	writeRawDirent(image, floppyRootDirOffset, "SUBDIR     ", fat.AttrDirectory, 2700)
+	writeRawDirent(image, floppyRootDirOffset+32, "BIG     BIN", 0, 2800)
+	setFAT12Entry(image, 2700, 0xFFF)
+	setFAT12Entry(image, 2750, 0xFFF)
+	setFAT12Entry(image, 2800, 2801)
+	setFAT12Entry(image, 2801, 0xFFF)
+
+	subdir := floppyClusterOffset(2700)
+	writeRawDirent(image, subdir, ".          ", fat.AttrDirectory, 2700)
+	writeRawDirent(image, subdir+32, "..         ", fat.AttrDirectory, 0)
+	writeRawDirent(image, subdir+64, "INNER   TXT", 0, 2750)
+
+	copy(image[floppyClusterOffset(2750):], "inner")
+	copy(image[floppyClusterOffset(2800):], bytes.Repeat([]byte{0xAA}, 512))
+	copy(image[floppyClusterOffset(2801):], bytes.Repeat([]byte{0xBB}, 512))
+	return image
+}
+
+func TestShrinkImage__RelocatesClusters(t *testing.T) {
+	image := &growableImage{data: makeFragmentedFloppyImage()}
+
+	require.NoError(t, fat.ShrinkImage(image, 1440))
+	data := image.data
+	assert.Len(t, data, 1440*512)
+	assert.EqualValues(t, 1440, binary.LittleEndian.Uint16(data[19:]))
+
+	// Clusters 2 and 3 are taken by the file makeFloppyImage creates, so
+	// everything should be moved to the first free clusters after them.
+	require.EqualValues(t, 4, direntCluster(data, floppyRootDirOffset), "SUBDIR")
+	require.EqualValues(t, 6, direntCluster(data, floppyRootDirOffset+32), "BIG.BIN")
+
+	subdir := floppyClusterOffset(4)
+	assert.EqualValues(t, 4, direntCluster(data, subdir), "SUBDIR/.")
+	assert.EqualValues(t, 0, direntCluster(data, subdir+32), "SUBDIR/..")
+	assert.EqualValues(t, 5, direntCluster(data, subdir+64), "SUBDIR/INNER.TXT")
+
+	assert.Equal(t, []byte("inner"), data[floppyClusterOffset(5):floppyClusterOffset(5)+5])
+	assert.Equal(t, bytes.Repeat([]byte{0xAA}, 512), data[floppyClusterOffset(6):floppyClusterOffset(7)])
+	assert.Equal(t, bytes.Repeat([]byte{0xBB}, 512), data[floppyClusterOffset(7):floppyClusterOffset(8)])
+
+	assert.EqualValues(t, 0xFFF, getFAT12Entry(data, 4))
+	assert.EqualValues(t, 0xFFF, getFAT12Entry(data, 5))
+	assert.EqualValues(t, 7, getFAT12Entry(data, 6))
+	assert.EqualValues(t, 0xFFF, getFAT12Entry(data, 7))
+	for _, cluster := range []int{2700, 2750, 2800, 2801} {
+		assert.EqualValues(t, 0, getFAT12Entry(data, cluster), "cluster %d not freed", cluster)
+	}
+}
+
+func TestShrinkImage__NotEnoughSpace(t *testing.T) {
+	image := &growableImage{data: makeFragmentedFloppyImage()}
+	original := bytes.Clone(image.data)
+
+	// That leaves room for 3 clusters, but 6 are in use.
+	err := fat.ShrinkImage(image, floppyDataSector+3)
+	assert.ErrorIs(t, err, disko.ErrNoSpaceOnDevice)
+	assert.Equal(t, original, image.data, "image was modified")
+}
+
+func TestMinimumTotalSectors(t *testing.T) {
+	image := &growableImage{data: makeFragmentedFloppyImage()}
+
+	minimum, err := fat.MinimumTotalSectors(image)
+	require.NoError(t, err)
+	assert.EqualValues(t, floppyDataSector+6, minimum)
+
+	require.NoError(t, fat.ResizeImage(image, minimum))
+	assert.Len(t, image.data, int(minimum)*512)
+}
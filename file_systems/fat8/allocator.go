@@ -0,0 +1,96 @@
+package fat8
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/common"
+)
+
+// clusterAllocator implements [disko.Allocator] on top of the driver's copy of
+// the FAT. Blocks are cluster numbers.
+type clusterAllocator struct {
+	driver *FAT8Driver
+}
+
+// GetAllocator implements [disko.AllocatorImplementer].
+func (driver *FAT8Driver) GetAllocator() disko.Allocator {
+	return clusterAllocator{driver: driver}
+}
+
+// Allocate implements [disko.Allocator]. Newly allocated clusters are marked as
+// the last cluster in a file, with no sectors used.
+func (alloc clusterAllocator) Allocate(count uint) ([]common.PhysicalBlock, disko.DriverError) {
+	driver := alloc.driver
+	if count > uint(len(driver.freeClusters)) {
+		return nil, disko.ErrNoSpaceOnDevice.WithMessage(
+			fmt.Sprintf(
+				"can't allocate %d clusters, only %d are free",
+				count,
+				len(driver.freeClusters),
+			),
+		)
+	}
+
+	blocks := make([]common.PhysicalBlock, count)
+	for i, cluster := range driver.freeClusters[:count] {
+		driver.fat[cluster-1] = 0xc0
+		blocks[i] = common.PhysicalBlock(cluster)
+	}
+	driver.freeClusters = driver.freeClusters[count:]
+	return blocks, nil
+}
+
+// Free implements [disko.Allocator]. Listing a cluster more than once is an
+// error, since it would otherwise end up on the free list twice.
+func (alloc clusterAllocator) Free(blocks []common.PhysicalBlock) disko.DriverError {
+	driver := alloc.driver
+	seen := make(map[common.PhysicalBlock]struct{}, len(blocks))
+	for _, block := range blocks {
+		isAllocated, err := alloc.IsAllocated(block)
+		if err != nil {
+			return err
+		}
+		if !isAllocated {
+			return disko.ErrInvalidArgument.WithMessage(
+				fmt.Sprintf("cluster %d is already free", block))
+		} else if driver.fat[block-1] == 0xfe {
+			return disko.ErrInvalidArgument.WithMessage(
+				fmt.Sprintf("cluster %d is reserved and can't be freed", block))
+		} else if _, duplicate := seen[block]; duplicate {
+			return disko.ErrInvalidArgument.WithMessage(
+				fmt.Sprintf("cluster %d is listed more than once", block))
+		}
+		seen[block] = struct{}{}
+	}
+
+	for _, block := range blocks {
+		driver.fat[block-1] = 0xff
+		driver.freeClusters = append(driver.freeClusters, uint8(block))
+	}
+	sort.Slice(
+		driver.freeClusters,
+		func(i, j int) bool { return driver.freeClusters[i] < driver.freeClusters[j] },
+	)
+	return nil
+}
+
+// FreeCount implements [disko.Allocator].
+func (alloc clusterAllocator) FreeCount() uint64 {
+	return uint64(len(alloc.driver.freeClusters))
+}
+
+// IsAllocated implements [disko.Allocator]. Reserved clusters, such as those
+// for the directory track, count as allocated.
+func (alloc clusterAllocator) IsAllocated(block common.PhysicalBlock) (bool, disko.DriverError) {
+	if block > common.PhysicalBlock(alloc.driver.geometry.TotalClusters) ||
+		!alloc.driver.IsValidCluster(PhysicalCluster(block)) {
+		return false, disko.ErrArgumentOutOfRange.WithMessage(
+			MakeInvalidClusterError(
+				PhysicalCluster(block), alloc.driver.geometry.TotalTracks,
+			).Error(),
+		)
+	}
+	return alloc.driver.fat[block-1] != 0xff, nil
+}
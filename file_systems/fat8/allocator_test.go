@@ -0,0 +1,99 @@
+package fat8
+
+import (
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newAllocatorTestDriver creates a driver for a floppy where every cluster is
+// free except the ones given.
+func newAllocatorTestDriver(t *testing.T, reserved ...uint8) *FAT8Driver {
+	geo, err := GetGeometry(2002)
+	require.NoError(t, err)
+
+	driver := &FAT8Driver{geometry: geo, fat: make([]byte, geo.SectorsPerFAT*128)}
+	for i := range driver.fat {
+		driver.fat[i] = 0xff
+	}
+	for _, cluster := range reserved {
+		driver.fat[cluster-1] = 0xfe
+	}
+	for i := uint(0); i < geo.TotalClusters; i++ {
+		if driver.fat[i] == 0xff {
+			driver.freeClusters = append(driver.freeClusters, uint8(i+1))
+		}
+	}
+	return driver
+}
+
+func TestAllocator__AllocateAndFree(t *testing.T) {
+	driver := newAllocatorTestDriver(t, 1, 3)
+	alloc := driver.GetAllocator()
+	initialFree := alloc.FreeCount()
+
+	blocks, err := alloc.Allocate(3)
+	require.NoError(t, err)
+	assert.Equal(t, []common.PhysicalBlock{2, 4, 5}, blocks)
+	assert.Equal(t, initialFree-3, alloc.FreeCount())
+
+	for _, block := range blocks {
+		isAllocated, err := alloc.IsAllocated(block)
+		require.NoError(t, err)
+		assert.Truef(t, isAllocated, "cluster %d should be allocated", block)
+	}
+
+	require.NoError(t, alloc.Free([]common.PhysicalBlock{4}))
+	assert.Equal(t, initialFree-2, alloc.FreeCount())
+
+	blocks, err = alloc.Allocate(1)
+	require.NoError(t, err)
+	assert.Equal(t, []common.PhysicalBlock{4}, blocks, "freed cluster wasn't reused first")
+}
+
+func TestAllocator__NoSpace(t *testing.T) {
+	driver := newAllocatorTestDriver(t)
+	alloc := driver.GetAllocator()
+	initialFree := alloc.FreeCount()
+
+	_, err := alloc.Allocate(uint(initialFree) + 1)
+	assert.ErrorIs(t, err, disko.ErrNoSpaceOnDevice)
+	assert.Equal(t, initialFree, alloc.FreeCount(), "failed allocation changed free count")
+}
+
+func TestAllocator__FreeInvalid(t *testing.T) {
+	driver := newAllocatorTestDriver(t, 1)
+	alloc := driver.GetAllocator()
+
+	assert.Error(t, alloc.Free([]common.PhysicalBlock{2}), "freed a free cluster")
+	assert.Error(t, alloc.Free([]common.PhysicalBlock{1}), "freed a reserved cluster")
+	assert.Error(t, alloc.Free([]common.PhysicalBlock{0}), "freed cluster 0")
+
+	_, err := alloc.IsAllocated(common.PhysicalBlock(driver.geometry.TotalClusters + 1))
+	assert.Error(t, err)
+}
+
+func TestAllocator__FreeDuplicate(t *testing.T) {
+	driver := newAllocatorTestDriver(t)
+	alloc := driver.GetAllocator()
+	initialFree := alloc.FreeCount()
+
+	blocks, err := alloc.Allocate(2)
+	require.NoError(t, err)
+	err = alloc.Free([]common.PhysicalBlock{blocks[0], blocks[1], blocks[0]})
+	assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+	assert.Equal(t, initialFree-2, alloc.FreeCount(), "failed Free() changed the free count")
+
+	// Freeing each cluster once puts it back on the free list once, so two
+	// allocations can't get the same one.
+	require.NoError(t, alloc.Free(blocks))
+	assert.Equal(t, initialFree, alloc.FreeCount())
+	first, err := alloc.Allocate(1)
+	require.NoError(t, err)
+	second, err := alloc.Allocate(1)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+}
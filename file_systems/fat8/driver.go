@@ -1,6 +1,7 @@
 package fat8
 
 import (
+	"errors"
 	"io"
 	"os"
 
@@ -41,6 +42,8 @@ type FAT8Driver struct {
 	// isMounted indicates if the drive is currently mounted.
 	isMounted bool
 	dirents   map[string]DirectoryEntry
+	// warnings holds the problems ignored by the last lenient mount.
+	warnings *disko.MountWarnings
 }
 
 func NewDriverFromFile(stream *os.File) FAT8Driver {
@@ -55,6 +58,7 @@ func (driver *FAT8Driver) Mount(flags disko.MountFlags) error {
 	if driver.isMounted {
 		return disko.ErrAlreadyInProgress
 	}
+	driver.warnings = disko.NewMountWarnings(flags)
 
 	// Determine the size of the image file.
 	offset, err := driver.image.Seek(0, io.SeekEnd)
@@ -67,17 +71,32 @@ func (driver *FAT8Driver) Mount(flags disko.MountFlags) error {
 		return disko.ErrFileSystemCorrupted.Wrap(err)
 	}
 	driver.geometry = geo
+	driver.stat = disko.FSStat{
+		BlockSize:     128,
+		TotalBlocks:   uint64(offset) / 128,
+		MaxNameLength: 10,
+	}
 
 	// All FATs are identical on a clean volume, so we only need to store the
-	// first one. We might add dirty volume checking later.
+	// first one. We can't repair a dirty volume, but a lenient mount can still
+	// use the first copy, which overwrites the others on the next flush.
 	fat, err := driver.GetFAT()
+	if errors.Is(err, disko.ErrFileSystemCorrupted) {
+		err = driver.warnings.Unsupported(
+			"dirty volume recovery", disko.CastToDriverError(err))
+		if err == nil {
+			fat, err = driver.ReadDiskBlocks(
+				driver.geometry.FATsStart, driver.geometry.SectorsPerFAT)
+		}
+	}
 	if err != nil {
 		return err
 	}
 	driver.fat = fat
 
-	// Build a list of all currently free clusters.
-	for i, clusterNumber := range fat {
+	// Build a list of all currently free clusters. Entries past the last
+	// cluster are padding and must be ignored.
+	for i, clusterNumber := range fat[:geo.TotalClusters] {
 		if clusterNumber == 0xff {
 			driver.freeClusters = append(driver.freeClusters, uint8(i+1))
 		}
@@ -95,7 +114,14 @@ func (driver *FAT8Driver) Mount(flags disko.MountFlags) error {
 	return nil
 }
 
-// Flush implements [disko.FileSystemImplementer].
+// MountWarnings implements [disko.MountWarningsImplementer].
+func (driver *FAT8Driver) MountWarnings() []disko.MountWarning {
+	return driver.warnings.List()
+}
+
+// Flush implements [disko.FileSystemImplementer]. Cluster data is written to
+// the image as soon as it's changed, so by the time we get here only the FAT
+// remains, and it can never point at clusters that haven't been written yet.
 func (driver *FAT8Driver) Flush() error {
 	return driver.writeFAT()
 }
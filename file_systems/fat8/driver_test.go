@@ -0,0 +1,51 @@
+package fat8
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeDirtyImage writes a copy of an empty floppy image with the second FAT copy
+// differing from the others to a temporary file.
+func makeDirtyImage(t *testing.T) *os.File {
+	image := bytes.Clone(emptyFloppyImage)
+	geo, err := GetGeometry(uint(len(image) / 128))
+	require.NoError(t, err)
+
+	secondFATStart := (int(geo.FATsStart) + int(geo.SectorsPerFAT)) * 128
+	image[secondFATStart] ^= 0xff
+
+	tmpFile, err := os.CreateTemp("", "")
+	require.NoError(t, err, "failed to create temporary file")
+	t.Cleanup(func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	})
+
+	_, err = tmpFile.Write(image)
+	require.NoError(t, err)
+	return tmpFile
+}
+
+func TestMount__DirtyVolumeStrict(t *testing.T) {
+	driver := NewDriverFromFile(makeDirtyImage(t))
+	err := driver.Mount(disko.MountFlagsAllowRead)
+	assert.ErrorIs(t, err, disko.ErrFileSystemCorrupted)
+	assert.Empty(t, driver.MountWarnings())
+}
+
+func TestMount__DirtyVolumeLenient(t *testing.T) {
+	driver := NewDriverFromFile(makeDirtyImage(t))
+	err := driver.Mount(disko.MountFlagsAllowRead | disko.MountFlagsLenient)
+	require.NoError(t, err)
+
+	warnings := driver.MountWarnings()
+	require.Len(t, warnings, 1)
+	assert.Equal(t, "dirty volume recovery", warnings[0].Feature)
+	assert.ErrorIs(t, warnings[0].Err, disko.ErrFileSystemCorrupted)
+}
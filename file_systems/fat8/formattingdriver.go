@@ -8,12 +8,12 @@ import (
 	"github.com/dargueta/disko/disks"
 )
 
-// Format implements [disko.FormatImageImplementer].
+// FormatImage implements [disko.FormatImageImplementer].
 //
 // This driver only requires the TotalBlocks field to be set in `information`.
 // It must either be 1898 for a floppy image, or 640 for a minifloppy image.
 // 2002 is accepted as a synonym for 1898.
-func (driver *FAT8Driver) FormatImage(options disks.BasicFormatterOptions) error {
+func (driver *FAT8Driver) FormatImage(options disks.BasicFormatterOptions) disko.DriverError {
 	if driver.isMounted {
 		return disko.ErrBusy.WithMessage(
 			"image must be unmounted before it can be formatted")
@@ -29,7 +29,7 @@ func (driver *FAT8Driver) FormatImage(options disks.BasicFormatterOptions) error
 
 	geo, err := GetGeometry(uint(totalBlocks))
 	if err != nil {
-		return err
+		return disko.CastToDriverError(err)
 	}
 
 	// We reserve one track for the directory, so the total number of available
@@ -69,14 +69,14 @@ func (driver *FAT8Driver) FormatImage(options disks.BasicFormatterOptions) error
 	for i := geo.DirectoryTrackStart; i < geo.InfoSectorStart; i++ {
 		err := driver.WriteDiskBlocks(i, sectorFill)
 		if err != nil {
-			return err
+			return disko.CastToDriverError(err)
 		}
 	}
 
 	// Write nulls to the info sector.
 	err = driver.WriteDiskBlocks(geo.InfoSectorStart, bytes.Repeat([]byte{0}, 128))
 	if err != nil {
-		return err
+		return disko.CastToDriverError(err)
 	}
 
 	// The info sector is followed by three copies of the FAT at the end of the
@@ -92,5 +92,5 @@ func (driver *FAT8Driver) FormatImage(options disks.BasicFormatterOptions) error
 
 	// Write all three copies of the FATs
 	allFATs := bytes.Repeat(fat, 3)
-	return driver.WriteDiskBlocks(geo.FATsStart, allFATs)
+	return disko.CastToDriverError(driver.WriteDiskBlocks(geo.FATsStart, allFATs))
 }
@@ -0,0 +1,91 @@
+package fat8
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dargueta/disko"
+)
+
+// Layout returns the regions of a FAT8 image: the directory entries, the info
+// sector, and the three copies of the FAT. It implements the layout function
+// for [disko.FileSystemRegistration].
+//
+// Directory entries are 16 bytes. The first six bytes are the name, the next
+// three the extension, then one byte each for the attributes and the first
+// cluster of the file. A name beginning with 0x00 marks a deleted entry, and
+// one beginning with 0xFF an entry that has never been used.
+func Layout(image io.ReaderAt, size int64) ([]disko.LayoutRegion, disko.DriverError) {
+	if size%128 != 0 {
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			"image size must be a multiple of 128")
+	}
+
+	geo, err := GetGeometry(uint(size / 128))
+	if err != nil {
+		return nil, disko.ErrInvalidFileSystem.Wrap(err)
+	}
+
+	direntsStart := int64(geo.DirectoryTrackStart) * 128
+	direntsSize := int64(geo.InfoSectorStart-geo.DirectoryTrackStart) * 128
+	fatSize := int64(geo.SectorsPerFAT) * 128
+
+	regions := []disko.LayoutRegion{
+		{
+			Offset:  direntsStart,
+			Length:  direntsSize,
+			Name:    "Directory entries",
+			Details: fmt.Sprintf("track %d", geo.DirectoryTrackNumber),
+		},
+		{
+			Offset: int64(geo.InfoSectorStart) * 128,
+			Length: 128,
+			Name:   "Info sector",
+		},
+	}
+	for i := int64(0); i < 3; i++ {
+		regions = append(
+			regions,
+			disko.LayoutRegion{
+				Offset: int64(geo.FATsStart)*128 + i*fatSize,
+				Length: fatSize,
+				Name:   fmt.Sprintf("FAT copy %d", i+1),
+			},
+		)
+	}
+
+	directory := make([]byte, direntsSize)
+	_, ioErr := image.ReadAt(directory, direntsStart)
+	if ioErr != nil && ioErr != io.EOF {
+		return nil, disko.ErrIOFailed.Wrap(ioErr)
+	}
+
+	for offset := 0; offset+16 <= len(directory); offset += 16 {
+		rawEntry := directory[offset : offset+16]
+		if rawEntry[0] == 0xff {
+			continue
+		}
+
+		name := "Directory entry"
+		if rawEntry[0] == 0 {
+			name = "Deleted directory entry"
+		}
+		regions = append(
+			regions,
+			disko.LayoutRegion{
+				Offset: direntsStart + int64(offset),
+				Length: 16,
+				Name:   name,
+				Details: fmt.Sprintf(
+					"name=%q attributes=%#02x first_cluster=%d",
+					strings.TrimRight(string(rawEntry[:6]), " \x00")+"."+
+						strings.TrimRight(string(rawEntry[6:9]), " \x00"),
+					rawEntry[9],
+					rawEntry[10],
+				),
+			},
+		)
+	}
+	return regions, nil
+}
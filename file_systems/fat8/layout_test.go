@@ -0,0 +1,38 @@
+package fat8
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayout__EmptyFloppy(t *testing.T) {
+	image := bytes.Clone(emptyFloppyImage)
+	geo, _ := GetGeometry(2002)
+
+	direntOffset := int(geo.DirectoryTrackStart) * 128
+	copy(image[direntOffset:], "HELLO BAS")
+	image[direntOffset+9] = 0x80
+	image[direntOffset+10] = 12
+
+	regions, err := Layout(bytes.NewReader(image), int64(len(image)))
+	require.NoError(t, err)
+	require.Len(t, regions, 6)
+
+	assert.Equal(t, "Directory entries", regions[0].Name)
+	assert.Equal(t, "Info sector", regions[1].Name)
+	assert.EqualValues(t, int64(geo.InfoSectorStart)*128, regions[1].Offset)
+	for i := 0; i < 3; i++ {
+		assert.EqualValues(
+			t,
+			int64(geo.FATsStart+PhysicalBlock(uint(i)*geo.SectorsPerFAT))*128,
+			regions[2+i].Offset,
+			regions[2+i].Name)
+	}
+
+	assert.Equal(t, "Directory entry", regions[5].Name)
+	assert.EqualValues(t, direntOffset, regions[5].Offset)
+	assert.Equal(t, `name="HELLO.BAS" attributes=0x80 first_cluster=12`, regions[5].Details)
+}
@@ -0,0 +1,136 @@
+package fat8
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+// Features gives the features supported by the FAT8 file system.
+var Features = disko.FSFeatures{
+	DefaultNameEncoding: disko.FSTextEncodingASCII,
+	DefaultBlockSize:    128,
+	MinTotalBlocks:      640,
+	MaxTotalBlocks:      2002,
+	// There are no directories.
+	MaxPathDepth: 1,
+}
+
+// GetFSFeatures implements [disko.FileSystemImplementer].
+func (driver *FAT8Driver) GetFSFeatures() disko.FSFeatures {
+	return Features
+}
+
+func init() {
+	disko.RegisterFileSystem(
+		disko.FileSystemRegistration{
+			Name:        "fat8",
+			Description: "Microsoft 8-bit FAT",
+			Features:    Features,
+			Detect:      Detect,
+			Describe:    Describe,
+			Layout:      Layout,
+		},
+	)
+}
+
+// readFATs gets the geometry of an image from its size and returns the first
+// copy of its FAT. It fails if the copies differ.
+func readFATs(image io.ReaderAt, size int64) (Geometry, []byte, disko.DriverError) {
+	if size%128 != 0 {
+		return Geometry{}, nil, disko.ErrInvalidFileSystem.WithMessage(
+			"image size must be a multiple of 128")
+	}
+
+	geo, err := GetGeometry(uint(size / 128))
+	if err != nil {
+		return Geometry{}, nil, disko.ErrInvalidFileSystem.Wrap(err)
+	}
+
+	fatSize := int(geo.SectorsPerFAT) * 128
+	allFATs := make([]byte, 3*fatSize)
+	_, err = image.ReadAt(allFATs, int64(geo.FATsStart)*128)
+	if err != nil {
+		return Geometry{}, nil, disko.ErrIOFailed.Wrap(err)
+	}
+
+	fat := allFATs[:fatSize]
+	if !bytes.Equal(fat, allFATs[fatSize:2*fatSize]) ||
+		!bytes.Equal(fat, allFATs[2*fatSize:]) {
+		return Geometry{}, nil, disko.ErrFileSystemCorrupted.WithMessage(
+			"copies of the FAT differ")
+	}
+	return geo, fat, nil
+}
+
+// Detect returns true if `image` appears to contain a FAT8 file system. It
+// implements the detection function for [disko.FileSystemRegistration].
+//
+// FAT8 has no signature, so this relies on the image being one of the few
+// valid sizes, all three FATs being identical, every FAT entry being valid,
+// and at least one cluster (the directory track) being marked as reserved.
+func Detect(image io.ReaderAt, size int64) bool {
+	geo, fat, err := readFATs(image, size)
+	if err != nil {
+		return false
+	}
+
+	hasReserved := false
+	for _, entry := range fat[:geo.TotalClusters] {
+		switch {
+		case entry == 0xfe:
+			hasReserved = true
+		case entry == 0xff:
+		case entry >= 0xc0 && entry <= 0xcd:
+			// Last cluster in a file; the low bits are the number of sectors
+			// used in it.
+		case uint(entry) > geo.TotalClusters:
+			return false
+		}
+	}
+	return hasReserved
+}
+
+// Describe returns the geometry and usage of a FAT8 image. It implements the
+// description function for [disko.FileSystemRegistration].
+func Describe(image io.ReaderAt, size int64) (disko.ImageDescription, disko.DriverError) {
+	geo, fat, err := readFATs(image, size)
+	if err != nil {
+		return disko.ImageDescription{}, err
+	}
+
+	freeClusters := uint64(0)
+	for _, entry := range fat[:geo.TotalClusters] {
+		if entry == 0xff {
+			freeClusters++
+		}
+	}
+
+	infoSector := make([]byte, 128)
+	_, ioErr := image.ReadAt(infoSector, int64(geo.InfoSectorStart)*128)
+	if ioErr != nil {
+		return disko.ImageDescription{}, disko.ErrIOFailed.Wrap(ioErr)
+	}
+
+	return disko.ImageDescription{
+		Stat: disko.FSStat{
+			BlockSize:       geo.BytesPerCluster,
+			TotalBlocks:     uint64(geo.TotalClusters),
+			BlocksFree:      freeClusters,
+			BlocksAvailable: freeClusters,
+			MaxNameLength:   10,
+		},
+		Header: []disko.HeaderField{
+			{Name: "Tracks", Value: geo.TotalTracks},
+			{Name: "Physical tracks", Value: geo.TrueTotalTracks},
+			{Name: "Sectors per track", Value: geo.SectorsPerTrack},
+			{Name: "Sectors per cluster", Value: geo.SectorsPerCluster},
+			{Name: "Directory track", Value: geo.DirectoryTrackNumber},
+			{Name: "Info sector", Value: geo.InfoSectorStart},
+			{Name: "First FAT sector", Value: geo.FATsStart},
+			{Name: "Sectors per FAT", Value: geo.SectorsPerFAT},
+			{Name: "Default file attributes", Value: infoSector[0]},
+		},
+	}, nil
+}
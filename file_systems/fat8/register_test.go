@@ -0,0 +1,49 @@
+package fat8
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetect__EmptyImages(t *testing.T) {
+	for name, image := range map[string][]byte{
+		"floppy":     emptyFloppyImage,
+		"minifloppy": emptyMinifloppyImage,
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.True(t, Detect(bytes.NewReader(image), int64(len(image))))
+
+			matches := disko.Detect(bytes.NewReader(image), int64(len(image)))
+			require.Len(t, matches, 1, "wrong number of matches")
+			assert.Equal(t, "fat8", matches[0].Name)
+		})
+	}
+}
+
+func TestDetect__Rejects(t *testing.T) {
+	assert.False(t, Detect(bytes.NewReader(make([]byte, 1000)), 1000), "bad size accepted")
+
+	corrupted := bytes.Clone(emptyFloppyImage)
+	geo, _ := GetGeometry(2002)
+	corrupted[int(geo.FATsStart)*128+5] = 0
+	assert.False(
+		t,
+		Detect(bytes.NewReader(corrupted), int64(len(corrupted))),
+		"mismatched FATs accepted")
+}
+
+func TestDescribe__EmptyFloppy(t *testing.T) {
+	description, err := Describe(
+		bytes.NewReader(emptyFloppyImage), int64(len(emptyFloppyImage)))
+	require.NoError(t, err)
+
+	// Every cluster except the two on the directory track is free.
+	assert.EqualValues(t, 146, description.Stat.TotalBlocks)
+	assert.EqualValues(t, 144, description.Stat.BlocksFree)
+	assert.EqualValues(t, 13*128, description.Stat.BlockSize)
+	assert.NotEmpty(t, description.Header)
+}
@@ -0,0 +1,147 @@
+package memfs
+
+import (
+	"fmt"
+	"os"
+	posixpath "path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dargueta/disko"
+)
+
+// MapFS describes the contents of a [MemoryFS], in the style of
+// [testing/fstest.MapFS]. The keys are slash-separated paths, and the values
+// describe the object at each path. Directories that aren't listed but have
+// something listed in them are created with mode 0755.
+//
+// This is meant for building fixtures in tests:
+//
+//	implementation, err := memfs.MapFS{
+//		"docs/hello.txt": {Data: []byte("Hello!")},
+//		"docs/latest":    {Data: []byte("/docs/hello.txt"), Mode: os.ModeSymlink | 0o777},
+//		"empty":          {Mode: os.ModeDir | 0o700},
+//	}.Build(512, 64)
+type MapFS map[string]*MapFile
+
+// MapFile describes an object in a [MapFS].
+type MapFile struct {
+	// Data is the contents of a regular file, or the target of a symbolic link.
+	// It's ignored for directories.
+	Data []byte
+	// Mode is the type and permissions of the object. If the permission bits
+	// are 0, they default to 0644, or 0755 for directories.
+	Mode os.FileMode
+	// ModTime is the last modified time of the object. It's left undefined if
+	// this is the zero time.
+	ModTime time.Time
+	Uid     int
+	Gid     int
+}
+
+// Build creates a [MemoryFS] with room for `totalBlocks` blocks of `blockSize`
+// bytes each, and fills it with the objects in `m`. The file system isn't
+// mounted.
+func (m MapFS) Build(blockSize uint, totalBlocks uint64) (*MemoryFS, error) {
+	fs := NewMemoryFS(blockSize, totalBlocks)
+
+	// Sort the paths so that a directory listed explicitly is created before
+	// anything in it, and so that inode numbers are the same every time.
+	paths := make([]string, 0, len(m))
+	for path := range m {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		cleanPath := posixpath.Clean("/" + path)
+		if cleanPath == "/" {
+			return nil, disko.ErrInvalidArgument.WithMessage(
+				fmt.Sprintf("%q: can't replace the root directory", path),
+			)
+		}
+
+		parentPath, name := posixpath.Split(cleanPath)
+		parent, err := fs.mkdirAll(parentPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := fs.addMapFile(parent, name, cleanPath, m[path]); err != nil {
+			return nil, err
+		}
+	}
+	return fs, nil
+}
+
+// mkdirAll returns the directory at `path`, creating it and any missing
+// parents with mode 0755.
+func (fs *MemoryFS) mkdirAll(path string) (*memoryObject, disko.DriverError) {
+	directory := fs.root
+	for _, name := range strings.Split(path, "/") {
+		if name == "" {
+			continue
+		}
+
+		child, ok := directory.children[name]
+		if !ok {
+			child = fs.newObject(os.ModeDir | 0o755)
+			directory.children[name] = child
+		} else if child.children == nil {
+			return nil, disko.ErrNotADirectory.WithMessage(
+				fmt.Sprintf("%q isn't a directory", name),
+			)
+		}
+		directory = child
+	}
+	return directory, nil
+}
+
+// addMapFile creates an object named `name` in `directory` as described by
+// `file`. If `file` is a directory that [MemoryFS.mkdirAll] created implicitly,
+// its mode, owner, and timestamp are updated instead.
+func (fs *MemoryFS) addMapFile(
+	directory *memoryObject,
+	name string,
+	path string,
+	file *MapFile,
+) disko.DriverError {
+	if file == nil {
+		file = &MapFile{}
+	}
+
+	mode := file.Mode
+	if mode.Perm() == 0 {
+		if mode.IsDir() {
+			mode |= 0o755
+		} else {
+			mode |= 0o644
+		}
+	}
+
+	object, exists := directory.children[name]
+	if exists && !(object.children != nil && mode.IsDir()) {
+		return disko.ErrExists.WithMessage(path)
+	}
+	if !exists {
+		object = fs.newObject(mode)
+		directory.children[name] = object
+	}
+
+	if !mode.IsDir() {
+		blocks := fs.blocksFor(uint64(len(file.Data)))
+		if blocks > fs.totalBlocks-fs.usedBlocks {
+			return disko.ErrNoSpaceOnDevice.WithMessage(path)
+		}
+		fs.usedBlocks += blocks
+		object.data = append([]byte(nil), file.Data...)
+	}
+
+	object.stat.ModeFlags = mode
+	object.stat.Uid = uint32(file.Uid)
+	object.stat.Gid = uint32(file.Gid)
+	if !file.ModTime.IsZero() {
+		object.stat.LastModified = file.ModTime
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package memfs_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/memfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapFS__Build(t *testing.T) {
+	modTime := time.Date(1985, time.March, 15, 12, 0, 0, 0, time.UTC)
+	implementation, err := memfs.MapFS{
+		"docs/hello.txt": {Data: []byte("Hello!"), ModTime: modTime, Uid: 100, Gid: 20},
+		"docs/latest":    {Data: []byte("/docs/hello.txt"), Mode: os.ModeSymlink | 0o777},
+		"empty":          {Mode: os.ModeDir | 0o700},
+		"/bin/../run.sh": {Data: make([]byte, 600), Mode: 0o755},
+	}.Build(512, 64)
+	require.NoError(t, err)
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowAll))
+	fs := driver.New(implementation, disko.MountFlagsAllowAll)
+
+	names, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	require.Len(t, names, 3)
+	assert.Equal(t, "docs", names[0].Name())
+	assert.Equal(t, "empty", names[1].Name())
+	assert.Equal(t, "run.sh", names[2].Name())
+
+	data, err := fs.ReadFile("/docs/latest")
+	require.NoError(t, err)
+	assert.Equal(t, "Hello!", string(data))
+
+	stat, err := fs.Stat("/docs/hello.txt")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), stat.ModeFlags)
+	assert.Equal(t, modTime, stat.LastModified)
+	assert.EqualValues(t, 100, stat.Uid)
+	assert.EqualValues(t, 20, stat.Gid)
+
+	stat, err = fs.Stat("/docs")
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeDir|0o755, stat.ModeFlags)
+
+	stat, err = fs.Stat("/empty")
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeDir|0o700, stat.ModeFlags)
+
+	// Two blocks for run.sh and one for each of the other files.
+	assert.EqualValues(t, 60, implementation.FSStat().BlocksFree)
+}
+
+func TestMapFS__FileUsedAsDirectory(t *testing.T) {
+	_, err := memfs.MapFS{
+		"a":   {Data: []byte("x")},
+		"a/b": {Data: []byte("y")},
+	}.Build(512, 64)
+	assert.ErrorIs(t, err, disko.ErrNotADirectory)
+}
+
+func TestMapFS__NoSpace(t *testing.T) {
+	_, err := memfs.MapFS{
+		"big": {Data: make([]byte, 5000)},
+	}.Build(512, 8)
+	assert.ErrorIs(t, err, disko.ErrNoSpaceOnDevice)
+}
@@ -0,0 +1,328 @@
+// Package memfs is a file system that keeps everything in memory instead of on
+// a disk image. The driver uses it for its temporary directory, and tests use
+// it to exercise code built on top of the driver without needing an image.
+package memfs
+
+import (
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/dargueta/disko"
+	c "github.com/dargueta/disko/file_systems/common"
+)
+
+// MemoryFS is a [disko.FileSystemImplementer] that keeps everything in memory.
+// It supports directories, symbolic links, hard links, Unix permissions, and
+// all timestamps except the deleted time, so it can be used to test code built
+// on top of the driver without needing a disk image.
+type MemoryFS struct {
+	blockSize   uint
+	totalBlocks uint64
+	usedBlocks  uint64
+	nextInode   uint64
+	root        *memoryObject
+}
+
+// memoryObject is a file, directory, or symbolic link in a [MemoryFS].
+type memoryObject struct {
+	stat disko.FileStat
+	data []byte
+	// children is the contents of a directory. It's nil for other objects.
+	children map[string]*memoryObject
+}
+
+// NewMemoryFS creates an empty [MemoryFS] with room for `totalBlocks` blocks
+// of `blockSize` bytes each.
+func NewMemoryFS(blockSize uint, totalBlocks uint64) *MemoryFS {
+	fs := &MemoryFS{
+		blockSize:   blockSize,
+		totalBlocks: totalBlocks,
+		nextInode:   1,
+	}
+	fs.root = fs.newObject(os.ModeDir | 0o755)
+	return fs
+}
+
+func (fs *MemoryFS) newObject(mode os.FileMode) *memoryObject {
+	object := &memoryObject{
+		stat: disko.FileStat{
+			InodeNumber:  fs.nextInode,
+			Nlinks:       1,
+			ModeFlags:    mode,
+			BlockSize:    int64(fs.blockSize),
+			CreatedAt:    disko.UndefinedTimestamp,
+			LastAccessed: disko.UndefinedTimestamp,
+			LastModified: disko.UndefinedTimestamp,
+			LastChanged:  disko.UndefinedTimestamp,
+			DeletedAt:    disko.UndefinedTimestamp,
+		},
+	}
+	if mode.IsDir() {
+		object.children = map[string]*memoryObject{}
+	}
+	fs.nextInode++
+	return object
+}
+
+// blocksFor returns the number of blocks needed to store `size` bytes.
+func (fs *MemoryFS) blocksFor(size uint64) uint64 {
+	return (size + uint64(fs.blockSize) - 1) / uint64(fs.blockSize)
+}
+
+func (fs *MemoryFS) Mount(flags disko.MountFlags) disko.DriverError {
+	return nil
+}
+
+func (fs *MemoryFS) Flush() disko.DriverError {
+	return nil
+}
+
+func (fs *MemoryFS) Unmount() disko.DriverError {
+	return nil
+}
+
+func (fs *MemoryFS) CreateObject(
+	name string,
+	parent disko.ObjectHandle,
+	perm os.FileMode,
+) (disko.ObjectHandle, disko.DriverError) {
+	directory := parent.(*memoryHandle).object
+	if _, exists := directory.children[name]; exists {
+		return nil, disko.ErrExists.WithMessage(name)
+	}
+
+	object := fs.newObject(perm)
+	directory.children[name] = object
+	return &memoryHandle{fs: fs, object: object, parent: directory, name: name}, nil
+}
+
+func (fs *MemoryFS) GetObject(
+	name string,
+	parent disko.ObjectHandle,
+) (disko.ObjectHandle, disko.DriverError) {
+	directory := parent.(*memoryHandle).object
+	object, ok := directory.children[name]
+	if !ok {
+		return nil, disko.ErrNotFound.WithMessage(name)
+	}
+	return &memoryHandle{fs: fs, object: object, parent: directory, name: name}, nil
+}
+
+func (fs *MemoryFS) GetRootDirectory() disko.ObjectHandle {
+	return &memoryHandle{fs: fs, object: fs.root, name: "/"}
+}
+
+// Owns returns true if `handle` is a handle for an object in this file system.
+func (fs *MemoryFS) Owns(handle disko.ObjectHandle) bool {
+	memHandle, ok := handle.(*memoryHandle)
+	return ok && memHandle.fs == fs
+}
+
+// CreateHardLink implements [disko.HardLinkImplementer].
+func (fs *MemoryFS) CreateHardLink(
+	source disko.ObjectHandle,
+	targetParentDir disko.ObjectHandle,
+	targetName string,
+) (disko.ObjectHandle, disko.DriverError) {
+	object := source.(*memoryHandle).object
+	directory := targetParentDir.(*memoryHandle).object
+	if _, exists := directory.children[targetName]; exists {
+		return nil, disko.ErrExists.WithMessage(targetName)
+	}
+
+	directory.children[targetName] = object
+	object.stat.Nlinks++
+	return &memoryHandle{fs: fs, object: object, parent: directory, name: targetName}, nil
+}
+
+func (fs *MemoryFS) FSStat() disko.FSStat {
+	return disko.FSStat{
+		BlockSize:       fs.blockSize,
+		TotalBlocks:     fs.totalBlocks,
+		BlocksFree:      fs.totalBlocks - fs.usedBlocks,
+		BlocksAvailable: fs.totalBlocks - fs.usedBlocks,
+		Files:           fs.nextInode - 1,
+		FilesFree:       math.MaxUint64,
+		MaxNameLength:   255,
+	}
+}
+
+func (fs *MemoryFS) GetFSFeatures() disko.FSFeatures {
+	return disko.FSFeatures{
+		DoesNotRequireFormatting: true,
+		HasDirectories:           true,
+		HasSymbolicLinks:         true,
+		HasHardLinks:             true,
+		HasCreatedTime:           true,
+		HasAccessedTime:          true,
+		HasModifiedTime:          true,
+		HasChangedTime:           true,
+		HasUnixPermissions:       true,
+		HasUserPermissions:       true,
+		HasGroupPermissions:      true,
+		HasUserID:                true,
+		HasGroupID:               true,
+		DefaultBlockSize:         int(fs.blockSize),
+		MaxTotalBlocks:           int64(fs.totalBlocks),
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// memoryHandle is the [disko.ObjectHandle] for objects in a [MemoryFS].
+type memoryHandle struct {
+	fs     *MemoryFS
+	object *memoryObject
+	// parent is the directory the object was found in. It's nil for the root
+	// directory.
+	parent *memoryObject
+	name   string
+	closed bool
+}
+
+func (handle *memoryHandle) Stat() disko.FileStat {
+	stat := handle.object.stat
+	stat.Size = int64(len(handle.object.data))
+	stat.NumBlocks = int64(handle.fs.blocksFor(uint64(stat.Size)))
+	return stat
+}
+
+func (handle *memoryHandle) Resize(newSize uint64) disko.DriverError {
+	fs := handle.fs
+	oldBlocks := fs.blocksFor(uint64(len(handle.object.data)))
+	newBlocks := fs.blocksFor(newSize)
+	if newBlocks > oldBlocks && newBlocks-oldBlocks > fs.totalBlocks-fs.usedBlocks {
+		return disko.ErrNoSpaceOnDevice
+	}
+
+	fs.usedBlocks = fs.usedBlocks - oldBlocks + newBlocks
+	if newSize <= uint64(len(handle.object.data)) {
+		handle.object.data = handle.object.data[:newSize]
+	} else {
+		handle.object.data = append(
+			handle.object.data,
+			make([]byte, newSize-uint64(len(handle.object.data)))...,
+		)
+	}
+	return nil
+}
+
+func (handle *memoryHandle) ReadBlocks(index c.LogicalBlock, buffer []byte) disko.DriverError {
+	start := uint64(index) * uint64(handle.fs.blockSize)
+	n := copy(buffer, handle.object.data[start:])
+	// The last block may extend past the end of the data.
+	for i := n; i < len(buffer); i++ {
+		buffer[i] = 0
+	}
+	return nil
+}
+
+func (handle *memoryHandle) WriteBlocks(index c.LogicalBlock, data []byte) disko.DriverError {
+	start := uint64(index) * uint64(handle.fs.blockSize)
+	copy(handle.object.data[start:], data)
+	return nil
+}
+
+// ReadExtents implements [disko.SupportsExtentIOHandle].
+func (handle *memoryHandle) ReadExtents(ranges []disko.BlockRange) disko.DriverError {
+	for _, blockRange := range ranges {
+		handle.ReadBlocks(blockRange.Start, blockRange.Data)
+	}
+	return nil
+}
+
+// WriteExtents implements [disko.SupportsExtentIOHandle].
+func (handle *memoryHandle) WriteExtents(ranges []disko.BlockRange) disko.DriverError {
+	for _, blockRange := range ranges {
+		handle.WriteBlocks(blockRange.Start, blockRange.Data)
+	}
+	return nil
+}
+
+func (handle *memoryHandle) ZeroOutBlocks(startIndex c.LogicalBlock, count uint) disko.DriverError {
+	return handle.WriteBlocks(startIndex, make([]byte, count*handle.fs.blockSize))
+}
+
+func (handle *memoryHandle) Unlink() disko.DriverError {
+	if handle.parent == nil {
+		return disko.ErrBusy.WithMessage("can't remove the root directory")
+	}
+
+	delete(handle.parent.children, handle.name)
+	handle.object.stat.Nlinks--
+	if handle.object.stat.Nlinks == 0 {
+		handle.fs.usedBlocks -= handle.fs.blocksFor(uint64(len(handle.object.data)))
+	}
+	return nil
+}
+
+func (handle *memoryHandle) Name() string {
+	return handle.name
+}
+
+func (handle *memoryHandle) SameAs(other disko.ObjectHandle) bool {
+	otherHandle, ok := other.(*memoryHandle)
+	return ok && otherHandle.object == handle.object
+}
+
+func (handle *memoryHandle) Close() error {
+	if handle.closed {
+		return disko.ErrFileDescriptorBadState
+	}
+	handle.closed = true
+	return nil
+}
+
+// ListDir implements [disko.SupportsListDirHandle]. Names are returned sorted,
+// so that tests get the same results every time.
+func (handle *memoryHandle) ListDir() ([]string, disko.DriverError) {
+	if handle.object.children == nil {
+		return nil, disko.ErrNotADirectory.WithMessage(handle.name)
+	}
+
+	names := make([]string, 0, len(handle.object.children))
+	for name := range handle.object.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Chmod implements [disko.SupportsChmodHandle].
+func (handle *memoryHandle) Chmod(mode os.FileMode) disko.DriverError {
+	stat := &handle.object.stat
+	stat.ModeFlags = (stat.ModeFlags &^ os.ModePerm) | (mode & os.ModePerm)
+	return nil
+}
+
+// Chown implements [disko.SupportsChownHandle].
+func (handle *memoryHandle) Chown(uid, gid int) disko.DriverError {
+	handle.object.stat.Uid = uint32(uid)
+	handle.object.stat.Gid = uint32(gid)
+	return nil
+}
+
+// Chtimes implements [disko.SupportsChtimesHandle]. Timestamps passed as
+// [disko.UndefinedTimestamp] are left unchanged.
+func (handle *memoryHandle) Chtimes(
+	createdAt,
+	lastAccessed,
+	lastModified,
+	lastChanged,
+	deletedAt time.Time,
+) disko.DriverError {
+	stat := &handle.object.stat
+	setIfDefined := func(timestamp *time.Time, value time.Time) {
+		if !value.Equal(disko.UndefinedTimestamp) {
+			*timestamp = value
+		}
+	}
+
+	setIfDefined(&stat.CreatedAt, createdAt)
+	setIfDefined(&stat.LastAccessed, lastAccessed)
+	setIfDefined(&stat.LastModified, lastModified)
+	setIfDefined(&stat.LastChanged, lastChanged)
+	return nil
+}
@@ -0,0 +1,26 @@
+package memfs_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/file_systems/memfs"
+	diskotest "github.com/dargueta/disko/testing"
+)
+
+func TestMemoryFS__Conformance(t *testing.T) {
+	// A MemoryFS doesn't use its image, so it's kept with the stream it was
+	// created for. That way, mounting the same stream again gets back the same
+	// contents like it would with a real image.
+	fileSystems := map[io.ReadWriteSeeker]*memfs.MemoryFS{}
+	constructor := func(stream io.ReadWriteSeeker) (disko.FileSystemImplementer, disko.DriverError) {
+		fs, ok := fileSystems[stream]
+		if !ok {
+			fs = memfs.NewMemoryFS(512, 256)
+			fileSystems[stream] = fs
+		}
+		return fs, nil
+	}
+	diskotest.RunImplementerConformanceTests(t, constructor, nil)
+}
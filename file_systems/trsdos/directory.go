@@ -0,0 +1,263 @@
+package trsdos
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks/containers"
+)
+
+const (
+	// DirectoryEntrySize is the size of a directory entry, in bytes.
+	DirectoryEntrySize = 32
+	EntriesPerSector   = SectorSize / DirectoryEntrySize
+	// MaxNameLength is the length of the longest name, with the extension and
+	// the period between them.
+	MaxNameLength = 12
+	// ExtentsPerEntry is the number of extents a directory entry has room for.
+	// The last one is often the link to an extended entry.
+	ExtentsPerEntry = 5
+)
+
+// Bits of the attributes of a directory entry.
+const (
+	// AttrExtended marks an extended entry, which holds more extents for a file
+	// whose primary entry ran out of room.
+	AttrExtended  = 0x80
+	AttrSystem    = 0x40
+	AttrActive    = 0x10
+	AttrInvisible = 0x08
+	// AttrProtectionMask gives the access allowed without the file's password,
+	// from 0 for full access to 7 for none.
+	AttrProtectionMask = 0x07
+)
+
+// Special values of the track of an extent.
+const (
+	// extentEnd marks the end of a file's extents.
+	extentEnd = 0xFF
+	// extentLink means the rest of the file's extents are in an extended entry.
+	// The other byte of the extent is the entry's DEC.
+	extentLink = 0xFE
+)
+
+// DEC is a directory entry code, which identifies an entry by its position in
+// the directory. The low five bits are its sector, counting from the first
+// directory entry sector, and the high three bits are its position in the
+// sector. It's also the entry's index in the HIT.
+type DEC uint8
+
+// newDEC returns the DEC of the entry at `entry` in directory sector `sector`.
+func newDEC(sector, entry uint) DEC {
+	return DEC(entry<<5 | sector)
+}
+
+// Extent is a run of consecutive granules on a track.
+type Extent struct {
+	Track uint8
+	// Granules has the first granule in its three high bits, and the number of
+	// granules minus one in the rest.
+	Granules uint8
+}
+
+// FirstGranule returns the number of the first granule of the extent on its
+// track.
+func (extent Extent) FirstGranule() uint {
+	return uint(extent.Granules >> 5)
+}
+
+// GranuleCount returns the number of granules in the extent.
+func (extent Extent) GranuleCount() uint {
+	return uint(extent.Granules&0x1F) + 1
+}
+
+// RawDirent is a directory entry.
+type RawDirent struct {
+	Attributes uint8
+	// EOFOffset is the number of bytes used in the last sector of the file, or
+	// 0 if it's full.
+	EOFOffset    uint8
+	RecordLength uint8
+	Name         [8]byte
+	Extension    [3]byte
+	// UpdatePasswordHash and AccessPasswordHash are hashes of the passwords
+	// needed to change and read the file.
+	UpdatePasswordHash uint16
+	AccessPasswordHash uint16
+	// EndingRecord is the number of sectors in the file.
+	EndingRecord uint16
+	Extents      [ExtentsPerEntry]Extent
+}
+
+// parseDirent decodes a directory entry.
+func parseDirent(data []byte) RawDirent {
+	dirent := RawDirent{
+		Attributes:         data[0x00],
+		EOFOffset:          data[0x03],
+		RecordLength:       data[0x04],
+		UpdatePasswordHash: binary.LittleEndian.Uint16(data[0x10:]),
+		AccessPasswordHash: binary.LittleEndian.Uint16(data[0x12:]),
+		EndingRecord:       binary.LittleEndian.Uint16(data[0x14:]),
+	}
+	copy(dirent.Name[:], data[0x05:])
+	copy(dirent.Extension[:], data[0x0D:])
+	for i := range dirent.Extents {
+		dirent.Extents[i] = Extent{Track: data[0x16+2*i], Granules: data[0x17+2*i]}
+	}
+	return dirent
+}
+
+// IsActive returns true if the entry is in use.
+func (dirent *RawDirent) IsActive() bool {
+	return dirent.Attributes&AttrActive != 0
+}
+
+// IsExtended returns true if the entry holds extents for another entry.
+func (dirent *RawDirent) IsExtended() bool {
+	return dirent.Attributes&AttrExtended != 0
+}
+
+// NameString returns the file's name and extension, separated by a period.
+// TRS-80 systems separate them with a slash, which can't be used in a path.
+func (dirent *RawDirent) NameString() string {
+	name := strings.TrimRight(convertName(dirent.Name[:]), " ")
+	extension := strings.TrimRight(convertName(dirent.Extension[:]), " ")
+	if extension == "" {
+		return name
+	}
+	return name + "." + extension
+}
+
+// Size returns the size of the file, in bytes.
+func (dirent *RawDirent) Size() int64 {
+	if dirent.EndingRecord == 0 {
+		return 0
+	} else if dirent.EOFOffset == 0 {
+		return int64(dirent.EndingRecord) * SectorSize
+	}
+	return int64(dirent.EndingRecord-1)*SectorSize + int64(dirent.EOFOffset)
+}
+
+// convertName converts a name from the directory to a string. Printable ASCII
+// characters are kept, and every other byte is written as a percent sign and
+// two hex digits, as are "/", ".", and "%", so the name can't be mistaken for a
+// path and can be converted back.
+func convertName(name []byte) string {
+	var builder strings.Builder
+	for _, char := range name {
+		if char >= 0x20 && char < 0x7F && char != '/' && char != '.' && char != '%' {
+			builder.WriteByte(char)
+		} else {
+			fmt.Fprintf(&builder, "%%%02X", char)
+		}
+	}
+	return builder.String()
+}
+
+// directoryEntry is an entry in the directory, along with its DEC.
+type directoryEntry struct {
+	dec    DEC
+	dirent RawDirent
+}
+
+// readDirectory reads every active entry in the directory, including extended
+// ones.
+func readDirectory(
+	disk *containers.Disk,
+	geometry Geometry,
+) (map[DEC]*RawDirent, []directoryEntry, disko.DriverError) {
+	byDEC := map[DEC]*RawDirent{}
+	files := []directoryEntry{}
+
+	for sector := uint(0); sector < geometry.SectorsPerTrack-FirstDirentSector; sector++ {
+		data, err := readDirectorySector(disk, geometry, FirstDirentSector+sector)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for entry := uint(0); entry < EntriesPerSector; entry++ {
+			dirent := parseDirent(data[entry*DirectoryEntrySize:])
+			if !dirent.IsActive() {
+				continue
+			}
+
+			dec := newDEC(sector, entry)
+			byDEC[dec] = &dirent
+			if !dirent.IsExtended() {
+				files = append(files, directoryEntry{dec: dec, dirent: dirent})
+			}
+		}
+	}
+	return byDEC, files, nil
+}
+
+// granuleLocation identifies a granule by its track and position on it.
+type granuleLocation struct {
+	track   uint
+	granule uint
+}
+
+// fileGranules follows the extents of `dirent` and any extended entries after
+// it, and returns the granules of the file in order.
+func fileGranules(
+	geometry Geometry,
+	byDEC map[DEC]*RawDirent,
+	dirent *RawDirent,
+) ([]granuleLocation, disko.DriverError) {
+	name := dirent.NameString()
+	granules := []granuleLocation{}
+	visited := map[*RawDirent]bool{}
+
+	for current := dirent; current != nil; {
+		if visited[current] {
+			return nil, disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf("%s: extended directory entries form a cycle", name))
+		}
+		visited[current] = true
+
+		next := (*RawDirent)(nil)
+		for _, extent := range current.Extents {
+			if extent.Track == extentEnd {
+				break
+			} else if extent.Track == extentLink {
+				linked, ok := byDEC[DEC(extent.Granules)]
+				if !ok || !linked.IsExtended() {
+					return nil, disko.ErrFileSystemCorrupted.WithMessage(
+						fmt.Sprintf(
+							"%s: links to directory entry %#02x, which isn't an extended entry",
+							name,
+							extent.Granules,
+						),
+					)
+				}
+				next = linked
+				break
+			}
+
+			first := extent.FirstGranule()
+			count := extent.GranuleCount()
+			if uint(extent.Track) >= geometry.Tracks ||
+				first+count > geometry.GranulesPerTrack {
+				return nil, disko.ErrFileSystemCorrupted.WithMessage(
+					fmt.Sprintf(
+						"%s: extent of %d granules at track %d granule %d isn't on the disk",
+						name,
+						count,
+						extent.Track,
+						first,
+					),
+				)
+			}
+			for i := uint(0); i < count; i++ {
+				granules = append(
+					granules,
+					granuleLocation{track: uint(extent.Track), granule: first + i},
+				)
+			}
+		}
+		current = next
+	}
+	return granules, nil
+}
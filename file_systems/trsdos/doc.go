@@ -0,0 +1,2 @@
+// https://en.wikipedia.org/wiki/TRSDOS
+package trsdos
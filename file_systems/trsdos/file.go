@@ -0,0 +1,67 @@
+package trsdos
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks/containers"
+)
+
+// fileReader is an [io.ReaderAt] for the contents of a file.
+type fileReader struct {
+	disk     *containers.Disk
+	geometry Geometry
+	granules []granuleLocation
+	size     int64
+}
+
+// sector returns the data of sector `index` of the file.
+func (reader *fileReader) sector(index int64) ([]byte, error) {
+	perGranule := int64(reader.geometry.SectorsPerGranule)
+	location := reader.granules[index/perGranule]
+	number := reader.geometry.FirstSector +
+		location.granule*reader.geometry.SectorsPerGranule +
+		uint(index%perGranule)
+
+	sector, err := reader.disk.Sector(location.track, 0, number)
+	if err != nil {
+		return nil, disko.ErrFileSystemCorrupted.Wrap(err)
+	} else if sector.CRCError {
+		return nil, disko.ErrIOFailed.WithMessage(
+			fmt.Sprintf("track %d sector %d has a CRC error", location.track, number))
+	} else if len(sector.Data) != SectorSize {
+		return nil, disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf(
+				"track %d sector %d is %d bytes, expected %d",
+				location.track,
+				number,
+				len(sector.Data),
+				SectorSize,
+			),
+		)
+	}
+	return sector.Data, nil
+}
+
+func (reader *fileReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	n := 0
+	for n < len(buffer) && offset+int64(n) < reader.size {
+		position := offset + int64(n)
+		data, err := reader.sector(position / SectorSize)
+		if err != nil {
+			return n, err
+		}
+
+		chunk := data[position%SectorSize:]
+		if int64(len(chunk)) > reader.size-position {
+			chunk = chunk[:reader.size-position]
+		}
+		n += copy(buffer[n:], chunk)
+	}
+
+	if n < len(buffer) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,247 @@
+package trsdos
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks/containers"
+)
+
+// SectorSize is the size of every sector the file system uses.
+const SectorSize = 256
+
+// Sectors of the directory track, relative to its first sector.
+const (
+	GATSector = 0
+	HITSector = 1
+	// FirstDirentSector is the first sector of directory entries. They take up
+	// the rest of the track.
+	FirstDirentSector = 2
+)
+
+const (
+	// DefaultDirectoryTrack is where TRSDOS 2.3 puts the directory. Other
+	// systems give its track in the boot sector.
+	DefaultDirectoryTrack = 17
+	// MaxTracks is the number of tracks the GAT has room for.
+	MaxTracks = 0x60
+	// bootDirectoryTrackOffset is the offset of the directory track in the boot
+	// sector.
+	bootDirectoryTrackOffset = 2
+)
+
+// Offsets of fields in the GAT sector.
+const (
+	gatDiskNameOffset = 0xD0
+	gatDiskNameSize   = 8
+	gatDateOffset     = 0xD8
+	gatDateSize       = 8
+)
+
+// Geometry describes how a disk is divided into granules, the unit space is
+// allocated in.
+type Geometry struct {
+	Tracks          uint
+	SectorsPerTrack uint
+	// FirstSector is the number of the first sector on a track, 0 on almost
+	// every disk.
+	FirstSector       uint
+	SectorsPerGranule uint
+	GranulesPerTrack  uint
+	DirectoryTrack    uint
+	DoubleDensity     bool
+}
+
+// sectorsPerGranule gives the size of a granule for each number of sectors
+// per track that's supported.
+var sectorsPerGranule = map[uint]uint{
+	// Single density: two granules of five sectors.
+	10: 5,
+	// Double density: six granules of three sectors.
+	18: 3,
+}
+
+// readGeometry works out the geometry of `disk` from its directory track.
+func readGeometry(disk *containers.Disk) (Geometry, disko.DriverError) {
+	if disk.Sides() > 1 {
+		return Geometry{}, disko.ErrNotSupported.WithMessage(
+			"double-sided disks aren't supported yet")
+	}
+
+	geometry := Geometry{
+		Tracks:         disk.Tracks(),
+		DirectoryTrack: DefaultDirectoryTrack,
+	}
+	if geometry.Tracks > MaxTracks {
+		geometry.Tracks = MaxTracks
+	}
+
+	// Use the directory track from the boot sector if there's a plausible one.
+	bootNumbers := disk.SectorNumbers(0, 0)
+	if len(bootNumbers) > 0 {
+		boot, err := disk.Sector(0, 0, uint(bootNumbers[0]))
+		if err == nil && len(boot.Data) > bootDirectoryTrackOffset {
+			track := uint(boot.Data[bootDirectoryTrackOffset])
+			if track > 0 && track < geometry.Tracks && len(disk.SectorNumbers(track, 0)) > 0 {
+				geometry.DirectoryTrack = track
+			}
+		}
+	}
+
+	numbers := disk.SectorNumbers(geometry.DirectoryTrack, 0)
+	if len(numbers) == 0 {
+		return Geometry{}, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("directory track %d has no sectors", geometry.DirectoryTrack))
+	}
+	geometry.FirstSector = uint(numbers[0])
+	geometry.SectorsPerTrack = uint(len(numbers))
+	if uint(numbers[len(numbers)-1])-geometry.FirstSector+1 != geometry.SectorsPerTrack {
+		return Geometry{}, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf(
+				"sectors on directory track %d aren't numbered consecutively: %v",
+				geometry.DirectoryTrack,
+				numbers,
+			),
+		)
+	}
+
+	perGranule, ok := sectorsPerGranule[geometry.SectorsPerTrack]
+	if !ok {
+		return Geometry{}, disko.ErrNotSupported.WithMessage(
+			fmt.Sprintf(
+				"disks with %d sectors per track aren't supported",
+				geometry.SectorsPerTrack,
+			),
+		)
+	}
+	geometry.SectorsPerGranule = perGranule
+	geometry.GranulesPerTrack = geometry.SectorsPerTrack / perGranule
+
+	gat, err := disk.Sector(geometry.DirectoryTrack, 0, geometry.FirstSector+GATSector)
+	if err != nil {
+		return Geometry{}, disko.ErrFileSystemCorrupted.Wrap(err)
+	}
+	geometry.DoubleDensity = gat.DoubleDensity
+	return geometry, nil
+}
+
+// GranuleBytes returns the size of a granule, in bytes.
+func (geometry Geometry) GranuleBytes() int64 {
+	return int64(geometry.SectorsPerGranule) * SectorSize
+}
+
+// TotalGranules returns the number of granules on the disk.
+func (geometry Geometry) TotalGranules() uint {
+	return geometry.Tracks * geometry.GranulesPerTrack
+}
+
+// DirectoryEntries returns the number of directory entries the directory
+// track has room for.
+func (geometry Geometry) DirectoryEntries() int {
+	return int(geometry.SectorsPerTrack-FirstDirentSector) * EntriesPerSector
+}
+
+// readDirectorySector reads the sector of the directory track `index` sectors
+// after its first.
+func readDirectorySector(
+	disk *containers.Disk,
+	geometry Geometry,
+	index uint,
+) ([]byte, disko.DriverError) {
+	sector, err := disk.Sector(geometry.DirectoryTrack, 0, geometry.FirstSector+index)
+	if err != nil {
+		return nil, disko.ErrFileSystemCorrupted.Wrap(err)
+	} else if len(sector.Data) != SectorSize {
+		return nil, disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf(
+				"directory sector %d is %d bytes, expected %d",
+				index,
+				len(sector.Data),
+				SectorSize,
+			),
+		)
+	}
+	return sector.Data, nil
+}
+
+// RawGAT is the granule allocation table, which is the first sector of the
+// directory track.
+type RawGAT struct {
+	// Allocation has a byte for each track, with a bit set for each granule in
+	// use.
+	Allocation [MaxTracks]byte
+	DiskName   [gatDiskNameSize]byte
+	// Date is the date the disk was formatted, as "MM/DD/YY".
+	Date [gatDateSize]byte
+}
+
+// readGAT reads the GAT of a disk.
+func readGAT(disk *containers.Disk, geometry Geometry) (*RawGAT, disko.DriverError) {
+	data, err := readDirectorySector(disk, geometry, GATSector)
+	if err != nil {
+		return nil, err
+	}
+
+	gat := &RawGAT{}
+	copy(gat.Allocation[:], data)
+	copy(gat.DiskName[:], data[gatDiskNameOffset:])
+	copy(gat.Date[:], data[gatDateOffset:])
+	return gat, nil
+}
+
+// DiskNameString returns the name of the disk without padding.
+func (gat *RawGAT) DiskNameString() string {
+	return strings.TrimRight(convertName(gat.DiskName[:]), " ")
+}
+
+// DateString returns the date the disk was formatted. Unprintable characters
+// are replaced with "?".
+func (gat *RawGAT) DateString() string {
+	date := strings.Map(
+		func(char rune) rune {
+			if char < 0x20 || char >= 0x7F {
+				return '?'
+			}
+			return char
+		},
+		string(gat.Date[:]),
+	)
+	return strings.TrimRight(date, " ")
+}
+
+// IsAllocated returns true if `granule` of `track` is in use.
+func (gat *RawGAT) IsAllocated(track, granule uint) bool {
+	return gat.Allocation[track]&(1<<granule) != 0
+}
+
+// countFree returns the number of free granules on the disk.
+func (gat *RawGAT) countFree(geometry Geometry) uint {
+	free := uint(0)
+	for track := uint(0); track < geometry.Tracks; track++ {
+		for granule := uint(0); granule < geometry.GranulesPerTrack; granule++ {
+			if !gat.IsAllocated(track, granule) {
+				free++
+			}
+		}
+	}
+	return free
+}
+
+// statFileSystem returns information about a disk with `files` files on it.
+func statFileSystem(gat *RawGAT, geometry Geometry, files int) disko.FSStat {
+	free := uint64(gat.countFree(geometry))
+	filesFree := uint64(0)
+	if files < geometry.DirectoryEntries() {
+		filesFree = uint64(geometry.DirectoryEntries() - files)
+	}
+	return disko.FSStat{
+		BlockSize:       uint(geometry.GranuleBytes()),
+		TotalBlocks:     uint64(geometry.TotalGranules()),
+		BlocksFree:      free,
+		BlocksAvailable: free,
+		Files:           uint64(files),
+		FilesFree:       filesFree,
+		MaxNameLength:   MaxNameLength,
+	}
+}
@@ -0,0 +1,198 @@
+package trsdos
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+	"github.com/dargueta/disko/disks/containers"
+	"github.com/dargueta/disko/file_systems/common/archivefs"
+)
+
+// Names of the extended attributes files have.
+const (
+	// XattrProtection is the file's protection level as a single digit, from
+	// 0 for full access to 7 for none.
+	XattrProtection = "trsdos.protection"
+	// XattrFlags lists the file's attributes that have no equivalent in its
+	// mode, separated by commas: "SYS" for system files and "INV" for
+	// invisible ones. Files with neither don't have it.
+	XattrFlags = "trsdos.flags"
+)
+
+// Driver implements [disko.FileSystemImplementer] for TRS-80 disks with a
+// TRSDOS-compatible directory, in JV1, JV3, or DMK images. It only supports
+// mounting images read-only.
+//
+// There are no subdirectories, so everything besides reading the GAT and the
+// directory is done by an [archivefs.FileSystem].
+type Driver struct {
+	*archivefs.FileSystem
+	stream   io.ReadWriteSeeker
+	disk     *containers.Disk
+	geometry Geometry
+	gat      *RawGAT
+	files    []diskFile
+	stat     disko.FSStat
+}
+
+// diskFile is a file on the disk.
+type diskFile struct {
+	dirent   RawDirent
+	granules []granuleLocation
+	size     int64
+}
+
+// NewDriver creates a TRSDOS implementation for the image in `stream`. It
+// implements [disko.ImplementerConstructor].
+func NewDriver(stream io.ReadWriteSeeker) (disko.FileSystemImplementer, disko.DriverError) {
+	return &Driver{stream: stream}, nil
+}
+
+// openDisk decodes the container of an image `size` bytes long and works out
+// the geometry of the disk in it.
+func openDisk(image io.ReaderAt, size int64) (*containers.Disk, Geometry, disko.DriverError) {
+	disk, err := containers.Open(image, size)
+	if err != nil {
+		return nil, Geometry{}, disko.ErrInvalidFileSystem.Wrap(err)
+	}
+	geometry, driverErr := readGeometry(disk)
+	return disk, geometry, driverErr
+}
+
+func (driver *Driver) Mount(flags disko.MountFlags) disko.DriverError {
+	if driver.gat != nil {
+		return disko.ErrAlreadyInProgress
+	}
+
+	writeFlags := disko.MountFlagsAllowWrite |
+		disko.MountFlagsAllowInsert |
+		disko.MountFlagsAllowDelete |
+		disko.MountFlagsAllowAdminister
+	if flags&writeFlags != 0 && !flags.IsShared() {
+		return disko.ErrReadOnlyFileSystem.WithMessage(
+			"TRSDOS disks can only be mounted read-only")
+	}
+
+	size, err := driver.stream.Seek(0, io.SeekEnd)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	image, err := disks.NewWindow(driver.stream, 0, size)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	disk, geometry, driverErr := openDisk(image, size)
+	if driverErr != nil {
+		return driverErr
+	}
+	gat, driverErr := readGAT(disk, geometry)
+	if driverErr != nil {
+		return driverErr
+	}
+	byDEC, entries, driverErr := readDirectory(disk, geometry)
+	if driverErr != nil {
+		return driverErr
+	}
+
+	files := make([]diskFile, 0, len(entries))
+	for i := range entries {
+		dirent := &entries[i].dirent
+		granules, driverErr := fileGranules(geometry, byDEC, dirent)
+		if driverErr != nil {
+			return driverErr
+		}
+
+		size := dirent.Size()
+		allocated := int64(len(granules)) * geometry.GranuleBytes()
+		if size > allocated {
+			size = allocated
+		}
+		files = append(files, diskFile{dirent: *dirent, granules: granules, size: size})
+	}
+
+	driver.disk = disk
+	driver.geometry = geometry
+	driver.files = files
+	driver.FileSystem = archivefs.New(driver, SectorSize, Features)
+	driverErr = driver.FileSystem.Mount(flags)
+	if driverErr != nil {
+		driver.FileSystem = nil
+		driver.files = nil
+		return driverErr
+	}
+
+	driver.gat = gat
+	driver.stat = statFileSystem(gat, geometry, len(files))
+	return nil
+}
+
+// Members implements [archivefs.Archive].
+func (driver *Driver) Members() ([]archivefs.Member, error) {
+	members := make([]archivefs.Member, len(driver.files))
+	for i, file := range driver.files {
+		members[i] = archivefs.Member{
+			Name:         file.dirent.NameString(),
+			Size:         file.size,
+			LastModified: disko.UndefinedTimestamp,
+			Mode:         os.FileMode(0o644),
+			Xattrs:       direntXattrs(&file.dirent),
+		}
+	}
+	return members, nil
+}
+
+// direntXattrs returns the extended attributes of the file with the directory
+// entry `dirent`.
+func direntXattrs(dirent *RawDirent) map[string][]byte {
+	xattrs := map[string][]byte{
+		XattrProtection: []byte(fmt.Sprintf("%d", dirent.Attributes&AttrProtectionMask)),
+	}
+
+	flags := []string{}
+	if dirent.Attributes&AttrSystem != 0 {
+		flags = append(flags, "SYS")
+	}
+	if dirent.Attributes&AttrInvisible != 0 {
+		flags = append(flags, "INV")
+	}
+	if len(flags) > 0 {
+		xattrs[XattrFlags] = []byte(strings.Join(flags, ","))
+	}
+	return xattrs
+}
+
+// OpenMember implements [archivefs.Archive].
+func (driver *Driver) OpenMember(index int) (io.ReaderAt, error) {
+	file := &driver.files[index]
+	return &fileReader{
+		disk:     driver.disk,
+		geometry: driver.geometry,
+		granules: file.granules,
+		size:     file.size,
+	}, nil
+}
+
+func (driver *Driver) Unmount() disko.DriverError {
+	if driver.FileSystem != nil {
+		driver.FileSystem.Unmount()
+	}
+	driver.FileSystem = nil
+	driver.disk = nil
+	driver.gat = nil
+	driver.files = nil
+	return nil
+}
+
+// FSStat implements [disko.FileSystemImplementer], with the free space from
+// the GAT.
+func (driver *Driver) FSStat() disko.FSStat {
+	return driver.stat
+}
+
+func (driver *Driver) GetFSFeatures() disko.FSFeatures {
+	return Features
+}
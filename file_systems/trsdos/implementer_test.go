@@ -0,0 +1,288 @@
+package trsdos_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks/containers"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/trsdos"
+	diskotest "github.com/dargueta/disko/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xaionaro-go/bytesextra"
+)
+
+// trsDisk is a single-sided disk built sector by sector.
+type trsDisk struct {
+	tracks          int
+	sectorsPerTrack int
+	doubleDensity   bool
+	directoryTrack  int
+	data            []byte
+}
+
+// newTRSDisk creates an empty disk with a GAT that marks the directory track as
+// allocated, named "TESTDISK".
+func newTRSDisk(tracks, sectorsPerTrack, directoryTrack int, doubleDensity bool) *trsDisk {
+	disk := &trsDisk{
+		tracks:          tracks,
+		sectorsPerTrack: sectorsPerTrack,
+		doubleDensity:   doubleDensity,
+		directoryTrack:  directoryTrack,
+		data:            make([]byte, tracks*sectorsPerTrack*trsdos.SectorSize),
+	}
+	disk.sector(0, 0)[2] = byte(directoryTrack)
+
+	gat := disk.sector(directoryTrack, trsdos.GATSector)
+	gat[directoryTrack] = byte(1<<(sectorsPerTrack/disk.sectorsPerGranule()) - 1)
+	copy(gat[0xD0:], "TESTDISK10/16/86")
+	return disk
+}
+
+func (disk *trsDisk) sectorsPerGranule() int {
+	if disk.sectorsPerTrack == 10 {
+		return 5
+	}
+	return 3
+}
+
+func (disk *trsDisk) sector(track, number int) []byte {
+	offset := (track*disk.sectorsPerTrack + number) * trsdos.SectorSize
+	return disk.data[offset : offset+trsdos.SectorSize]
+}
+
+// granule returns the data of a granule.
+func (disk *trsDisk) granule(track, granule int) []byte {
+	offset := (track*disk.sectorsPerTrack + granule*disk.sectorsPerGranule()) * trsdos.SectorSize
+	return disk.data[offset : offset+disk.sectorsPerGranule()*trsdos.SectorSize]
+}
+
+// dirent returns the directory entry at `entry` in directory sector `sector`,
+// counting from the first sector of entries.
+func (disk *trsDisk) dirent(sector, entry int) []byte {
+	data := disk.sector(disk.directoryTrack, trsdos.FirstDirentSector+sector)
+	return data[entry*trsdos.DirectoryEntrySize : (entry+1)*trsdos.DirectoryEntrySize]
+}
+
+// setDirent fills in a directory entry. Each extent is a track, first granule,
+// and granule count, and is marked as allocated in the GAT. A link to an
+// extended entry is given as {0xFE, DEC}. Extents of inactive entries aren't
+// marked.
+func (disk *trsDisk) setDirent(
+	sector, entry int,
+	attributes byte,
+	name, extension string,
+	endingRecord uint16,
+	eofOffset byte,
+	extents ...[]int,
+) {
+	dirent := disk.dirent(sector, entry)
+	dirent[0x00] = attributes
+	dirent[0x03] = eofOffset
+	copy(dirent[0x05:0x10], "           ")
+	copy(dirent[0x05:], name)
+	copy(dirent[0x0D:], extension)
+	binary.LittleEndian.PutUint16(dirent[0x14:], endingRecord)
+	for i := 0x16; i < trsdos.DirectoryEntrySize; i++ {
+		dirent[i] = 0xFF
+	}
+
+	gat := disk.sector(disk.directoryTrack, trsdos.GATSector)
+	for i, extent := range extents {
+		if extent[0] == 0xFE {
+			dirent[0x16+2*i] = 0xFE
+			dirent[0x17+2*i] = byte(extent[1])
+			continue
+		}
+		dirent[0x16+2*i] = byte(extent[0])
+		dirent[0x17+2*i] = byte(extent[1]<<5 | (extent[2] - 1))
+		for granule := extent[1]; granule < extent[1]+extent[2]; granule++ {
+			if attributes&trsdos.AttrActive != 0 {
+				gat[extent[0]] |= 1 << granule
+			}
+		}
+	}
+}
+
+// jv1 returns the disk as a JV1 image.
+func (disk *trsDisk) jv1() []byte {
+	return bytes.Clone(disk.data)
+}
+
+// jv3 returns the disk as a JV3 image, with the directory track's sectors
+// marked as deleted.
+func (disk *trsDisk) jv3() []byte {
+	header := bytes.Repeat([]byte{0xFF}, containers.JV3HeaderSize)
+	header[containers.JV3HeaderSize-1] = 0
+	i := 0
+	for track := 0; track < disk.tracks; track++ {
+		for number := 0; number < disk.sectorsPerTrack; number++ {
+			flags := byte(0)
+			if disk.doubleDensity {
+				flags |= containers.JV3FlagDoubleDensity
+			}
+			if track == disk.directoryTrack {
+				flags |= 0x20
+			}
+			copy(header[3*i:], []byte{byte(track), byte(number), flags})
+			i++
+		}
+	}
+	return append(header, disk.data...)
+}
+
+// patternData returns `size` bytes that differ from one sector to the next.
+func patternData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 253)
+	}
+	return data
+}
+
+var (
+	helloData = patternData(300)
+	bigData   = patternData(33 * trsdos.SectorSize)
+)
+
+// makeSingleDensityDisk creates a 35-track single density disk with two files:
+//
+//	HELLO/TXT  300 bytes in one granule
+//	BIG/DAT    33 sectors in seven granules, on six tracks, with two of them
+//	           in an extended directory entry. It's a system file, invisible,
+//	           and has protection level 5.
+func makeSingleDensityDisk() *trsDisk {
+	disk := newTRSDisk(35, 10, trsdos.DefaultDirectoryTrack, false)
+
+	disk.setDirent(0, 0, trsdos.AttrActive, "HELLO", "TXT", 2, 44, []int{5, 0, 1})
+	copy(disk.granule(5, 0), helloData)
+
+	// A deleted file, which must be ignored.
+	disk.setDirent(0, 1, 0, "OLD", "TXT", 1, 0, []int{7, 0, 1})
+
+	disk.setDirent(
+		0, 2,
+		trsdos.AttrActive|trsdos.AttrSystem|trsdos.AttrInvisible|5,
+		"BIG", "DAT", 33, 0,
+		[]int{6, 0, 2},
+		[]int{8, 1, 1},
+		[]int{9, 0, 1},
+		[]int{11, 1, 1},
+		[]int{0xFE, 0x01},
+	)
+	// The extended entry is the first in the second directory sector, so its
+	// DEC is 0x01.
+	disk.setDirent(1, 0, trsdos.AttrActive|trsdos.AttrExtended, "", "", 0, 0, []int{12, 0, 2})
+
+	remaining := bigData
+	for _, granule := range [][2]int{{6, 0}, {6, 1}, {8, 1}, {9, 0}, {11, 1}, {12, 0}, {12, 1}} {
+		remaining = remaining[copy(disk.granule(granule[0], granule[1]), remaining):]
+	}
+	return disk
+}
+
+func mount(t *testing.T, image []byte) (*driver.BaseDriver, disko.FileSystemImplementer) {
+	implementation := diskotest.MountImplementer(
+		t, trsdos.NewDriver, image, disko.MountFlagsAllowRead)
+	return driver.New(implementation, disko.MountFlagsAllowRead), implementation
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestDriver__ReadFiles(t *testing.T) {
+	fs, implementation := mount(t, makeSingleDensityDisk().jv1())
+
+	entries, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "BIG.DAT", entries[0].Name())
+	assert.Equal(t, "HELLO.TXT", entries[1].Name())
+
+	data, err := fs.ReadFile("/HELLO.TXT")
+	require.NoError(t, err)
+	assert.Equal(t, helloData, data)
+
+	data, err = fs.ReadFile("/BIG.DAT")
+	require.NoError(t, err)
+	assert.Equal(t, bigData, data)
+
+	// 35 tracks of two granules, less the directory track and eight granules
+	// used by the files.
+	stat := implementation.FSStat()
+	assert.EqualValues(t, 5*trsdos.SectorSize, stat.BlockSize)
+	assert.EqualValues(t, 70, stat.TotalBlocks)
+	assert.EqualValues(t, 60, stat.BlocksFree)
+	assert.EqualValues(t, 2, stat.Files)
+}
+
+func TestDriver__Xattrs(t *testing.T) {
+	fs, _ := mount(t, makeSingleDensityDisk().jv1())
+
+	value, err := fs.GetXattr("/BIG.DAT", trsdos.XattrProtection)
+	require.NoError(t, err)
+	assert.Equal(t, "5", string(value))
+	value, err = fs.GetXattr("/BIG.DAT", trsdos.XattrFlags)
+	require.NoError(t, err)
+	assert.Equal(t, "SYS,INV", string(value))
+
+	names, err := fs.ListXattrs("/HELLO.TXT")
+	require.NoError(t, err)
+	assert.Equal(t, []string{trsdos.XattrProtection}, names)
+}
+
+func TestDriver__DoubleDensityJV3(t *testing.T) {
+	disk := newTRSDisk(40, 18, 20, true)
+	disk.setDirent(0, 0, trsdos.AttrActive, "PROG", "CMD", 3, 0, []int{3, 4, 1})
+	contents := patternData(3 * trsdos.SectorSize)
+	copy(disk.granule(3, 4), contents)
+
+	fs, implementation := mount(t, disk.jv3())
+	data, err := fs.ReadFile("/PROG.CMD")
+	require.NoError(t, err)
+	assert.Equal(t, contents, data)
+
+	stat := implementation.FSStat()
+	assert.EqualValues(t, 3*trsdos.SectorSize, stat.BlockSize)
+	assert.EqualValues(t, 240, stat.TotalBlocks)
+	assert.EqualValues(t, 240-6-1, stat.BlocksFree)
+}
+
+func TestDriver__BadExtendedEntryLink(t *testing.T) {
+	disk := makeSingleDensityDisk()
+	// Point BIG/DAT's link at HELLO/TXT instead of its extended entry.
+	disk.dirent(0, 2)[0x1F] = 0x00
+
+	implementation, err := trsdos.NewDriver(bytesextra.NewReadWriteSeeker(disk.jv1()))
+	require.NoError(t, err)
+	err = implementation.Mount(disko.MountFlagsAllowRead)
+	assert.ErrorIs(t, err, disko.ErrFileSystemCorrupted)
+	assert.ErrorContains(t, err, "BIG.DAT: links to directory entry 0x00")
+}
+
+func TestDetect(t *testing.T) {
+	// A blank image has no allocated directory track.
+	diskotest.RunDetectConformanceTests(t, trsdos.Detect, makeSingleDensityDisk().jv1(), nil)
+}
+
+func TestDescribe(t *testing.T) {
+	image := makeSingleDensityDisk().jv1()
+	description, err := trsdos.Describe(bytes.NewReader(image), int64(len(image)))
+	require.NoError(t, err)
+	fields := map[string]any{}
+	for _, field := range description.Header {
+		fields[field.Name] = field.Value
+	}
+	assert.Equal(t, "JV1", fields["Image format"])
+	assert.Equal(t, "TESTDISK", fields["Disk name"])
+	assert.Equal(t, "10/16/86", fields["Date"])
+	assert.Equal(t, "single", fields["Density"])
+	assert.EqualValues(t, 60, fields["Granules free"])
+	assert.EqualValues(t, 2, fields["Files"])
+}
+
+func TestDriver__Conformance(t *testing.T) {
+	diskotest.RunReadOnlyConformanceTests(t, trsdos.NewDriver, makeSingleDensityDisk().jv1())
+}
@@ -0,0 +1,96 @@
+package trsdos
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+// Features gives the features supported by TRSDOS.
+var Features = disko.FSFeatures{
+	DefaultNameEncoding: disko.FSTextEncodingASCII,
+	DefaultBlockSize:    SectorSize,
+	// A 35-track single density disk up to an 80-track double density one.
+	MinTotalBlocks: 35 * 10,
+	MaxTotalBlocks: 80 * 18,
+	// A file can use every granule outside the directory track of the largest
+	// disk.
+	MaxFileSize: 79 * 18 * SectorSize,
+}
+
+func init() {
+	disko.RegisterFileSystem(
+		disko.FileSystemRegistration{
+			Name:        "trsdos",
+			Description: "TRS-80 TRSDOS and compatibles (JV1, JV3, or DMK image)",
+			Features:    Features,
+			Detect:      Detect,
+			Describe:    Describe,
+			New:         NewDriver,
+		},
+	)
+}
+
+// Detect returns true if `image` appears to be a TRSDOS disk. It implements the
+// detection function for [disko.FileSystemRegistration].
+//
+// The image must be a JV1, JV3, or DMK image with a supported geometry, the
+// GAT must show the directory track as fully allocated, and the directory must
+// be readable.
+func Detect(image io.ReaderAt, size int64) bool {
+	disk, geometry, err := openDisk(image, size)
+	if err != nil {
+		return false
+	}
+	gat, err := readGAT(disk, geometry)
+	if err != nil {
+		return false
+	}
+	for granule := uint(0); granule < geometry.GranulesPerTrack; granule++ {
+		if !gat.IsAllocated(geometry.DirectoryTrack, granule) {
+			return false
+		}
+	}
+	_, _, err = readDirectory(disk, geometry)
+	return err == nil
+}
+
+// Describe decodes the GAT of an image, and counts the files in the directory.
+// It implements the description function for [disko.FileSystemRegistration].
+func Describe(image io.ReaderAt, size int64) (disko.ImageDescription, disko.DriverError) {
+	disk, geometry, err := openDisk(image, size)
+	if err != nil {
+		return disko.ImageDescription{}, err
+	}
+	gat, err := readGAT(disk, geometry)
+	if err != nil {
+		return disko.ImageDescription{}, err
+	}
+	_, entries, err := readDirectory(disk, geometry)
+	if err != nil {
+		return disko.ImageDescription{}, err
+	}
+
+	density := "single"
+	if geometry.DoubleDensity {
+		density = "double"
+	}
+	return disko.ImageDescription{
+		Stat: statFileSystem(gat, geometry, len(entries)),
+		Header: []disko.HeaderField{
+			{Name: "Image format", Value: disk.Format().String()},
+			{Name: "Disk name", Value: gat.DiskNameString()},
+			{Name: "Date", Value: gat.DateString()},
+			{Name: "Tracks", Value: geometry.Tracks},
+			{Name: "Density", Value: density},
+			{Name: "Directory track", Value: geometry.DirectoryTrack},
+			{
+				Name:  "Granule size",
+				Value: fmt.Sprintf("%d sectors", geometry.SectorsPerGranule),
+			},
+			{Name: "Granules free", Value: gat.countFree(geometry)},
+			{Name: "Files", Value: len(entries)},
+		},
+	}, nil
+}
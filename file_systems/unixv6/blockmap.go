@@ -0,0 +1,116 @@
+package unixv6
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+// maxSmallFileBlocks is the number of blocks a small file can address directly
+// from its inode.
+const maxSmallFileBlocks = 8
+
+// readIndirectBlock returns the block numbers in indirect block `block`.
+func readIndirectBlock(
+	image io.ReaderAt,
+	superblock *RawSuperblock,
+	block BlockNum,
+) ([]BlockNum, disko.DriverError) {
+	if !superblock.isDataBlock(block) {
+		return nil, disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf("indirect block %d is outside the data area", block))
+	}
+
+	data, err := readBlock(image, block)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := make([]BlockNum, addressesPerBlock)
+	for i := range addresses {
+		addresses[i] = BlockNum(binary.LittleEndian.Uint16(data[2*i:]))
+	}
+	return addresses, nil
+}
+
+// fileBlocks returns the physical block numbers of the data blocks of a file
+// with the given inode, in order. Holes are 0.
+func fileBlocks(
+	image io.ReaderAt,
+	superblock *RawSuperblock,
+	inode *RawInode,
+) ([]BlockNum, disko.DriverError) {
+	size := inode.FileSize()
+	count := (size + BlockSize - 1) / BlockSize
+	blocks := make([]BlockNum, 0, count)
+
+	if inode.Flags&FlagIsLargeFile == 0 {
+		if count > maxSmallFileBlocks {
+			return nil, disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf("small file is %d bytes, more than it can address", size))
+		}
+		blocks = append(blocks, inode.Addr[:count]...)
+	} else {
+		// An indirect block that's 0 is a hole of 256 blocks.
+		appendIndirect := func(indirect BlockNum) disko.DriverError {
+			wanted := count - uint(len(blocks))
+			if wanted > addressesPerBlock {
+				wanted = addressesPerBlock
+			}
+			if indirect == 0 {
+				blocks = append(blocks, make([]BlockNum, wanted)...)
+				return nil
+			}
+
+			addresses, err := readIndirectBlock(image, superblock, indirect)
+			if err != nil {
+				return err
+			}
+			blocks = append(blocks, addresses[:wanted]...)
+			return nil
+		}
+
+		for _, indirect := range inode.Addr[:7] {
+			if uint(len(blocks)) == count {
+				break
+			}
+			err := appendIndirect(indirect)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if uint(len(blocks)) < count {
+			var doublyIndirect []BlockNum
+			if inode.Addr[7] == 0 {
+				doublyIndirect = make([]BlockNum, addressesPerBlock)
+			} else {
+				var err disko.DriverError
+				doublyIndirect, err = readIndirectBlock(image, superblock, inode.Addr[7])
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			for _, indirect := range doublyIndirect {
+				if uint(len(blocks)) == count {
+					break
+				}
+				err := appendIndirect(indirect)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	for i, block := range blocks {
+		if block != 0 && !superblock.isDataBlock(block) {
+			return nil, disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf("block %d of the file is %d, outside the data area", i, block))
+		}
+	}
+	return blocks, nil
+}
@@ -1,6 +1,7 @@
 package unixv6
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"time"
@@ -8,6 +9,13 @@ import (
 	"github.com/dargueta/disko"
 )
 
+// BlockSize is the size of a block, in bytes. Everything on the file system is
+// addressed in blocks.
+const BlockSize = 512
+
+// MaxNameLength is the longest a name in a directory can be, in bytes.
+const MaxNameLength = 14
+
 type Inumber uint16
 type BlockNum uint16
 
@@ -21,6 +29,7 @@ type RawSuperblock struct {
 	FLock                uint8         // flock
 	ILock                uint8         // ilock
 	FModFlags            uint8         // fmod
+	ReadOnly             uint8         // ronly
 	SuperblockModifiedAt uint32        // time
 }
 
@@ -69,7 +78,8 @@ func ConvertFSFlagsToStandard(flags uint16) (os.FileMode, error) {
 	case FileTypeBlockDevice:
 		mode |= os.ModeDevice
 	case FileTypeCharDevice:
-		mode |= os.ModeCharDevice
+		// Go considers character devices to be a kind of device.
+		mode |= os.ModeDevice | os.ModeCharDevice
 	case FileTypeDirectory:
 		mode |= os.ModeDir
 	}
@@ -89,7 +99,7 @@ func ConvertStandardFlagsToFS(flags os.FileMode) (uint16, error) {
 	mode := uint16(flags&os.ModePerm) | FlagIsAllocated
 
 	switch flags & os.ModeType {
-	case os.ModeCharDevice:
+	case os.ModeDevice | os.ModeCharDevice, os.ModeCharDevice:
 		mode |= FileTypeCharDevice
 	case os.ModeDevice:
 		mode |= FileTypeBlockDevice
@@ -117,32 +127,65 @@ func ConvertStandardFlagsToFS(flags os.FileMode) (uint16, error) {
 	return mode, nil
 }
 
+// FileSize returns the size of the file, in bytes. The high byte is stored first,
+// followed by the low 16 bits.
+func (inode *RawInode) FileSize() uint {
+	return uint(inode.Size[0])<<16 | uint(inode.Size[1]) | uint(inode.Size[2])<<8
+}
+
 func RawInodeToStat(inumber Inumber, inode RawInode) (disko.FileStat, error) {
 	mode, err := ConvertFSFlagsToStandard(inode.Flags)
 	if err != nil {
 		return disko.FileStat{}, err
 	}
 
-	size := uint(inode.Size[0]) |
-		(uint(inode.Size[1]) << 8) |
-		(uint(inode.Size[2]) << 16)
-
-	blocks := size / 512
-	if size%512 != 0 {
+	size := inode.FileSize()
+	blocks := size / BlockSize
+	if size%BlockSize != 0 {
 		blocks++
 	}
 
+	// Device files have no data, and use the first block address to store the
+	// major and minor device numbers instead.
+	rdev := uint64(0)
+	if mode&os.ModeDevice != 0 {
+		rdev = uint64(inode.Addr[0])
+		size = 0
+		blocks = 0
+	}
+
 	return disko.FileStat{
 		InodeNumber:  uint64(inumber),
 		Nlinks:       uint64(inode.NLink),
 		ModeFlags:    mode,
 		Uid:          uint32(inode.UID),
 		Gid:          uint32(inode.GID),
-		Rdev:         0,
+		Rdev:         rdev,
 		Size:         int64(size),
-		BlockSize:    512,
+		BlockSize:    BlockSize,
 		NumBlocks:    int64(blocks),
-		LastAccessed: time.Unix(int64(inode.AccessedTime), 0),
-		LastModified: time.Unix(int64(inode.ModifiedTime), 0),
+		CreatedAt:    disko.UndefinedTimestamp,
+		LastChanged:  disko.UndefinedTimestamp,
+		LastAccessed: time.Unix(int64(inode.AccessedTime), 0).UTC(),
+		LastModified: time.Unix(int64(inode.ModifiedTime), 0).UTC(),
+		DeletedAt:    disko.UndefinedTimestamp,
 	}, nil
 }
+
+// RawDirent is a directory entry. Directories are files made of these.
+type RawDirent struct {
+	// Inumber is the inode the entry refers to, or 0 if the entry is unused.
+	Inumber Inumber
+	// Name is the name of the entry, padded with null bytes. A name that's
+	// exactly 14 bytes long isn't null-terminated.
+	Name [MaxNameLength]byte
+}
+
+// NameString returns the name of the entry without its padding.
+func (dirent *RawDirent) NameString() string {
+	length := bytes.IndexByte(dirent.Name[:], 0)
+	if length < 0 {
+		length = len(dirent.Name)
+	}
+	return string(dirent.Name[:length])
+}
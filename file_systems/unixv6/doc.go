@@ -1,5 +1,2 @@
-// Package unixv6 implements a driver for the Unix V6 file system.
-//
 // http://man.cat-v.org/unix-6th/5/fs
-
 package unixv6
@@ -0,0 +1,179 @@
+package unixv6
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/dargueta/disko"
+	c "github.com/dargueta/disko/file_systems/common"
+)
+
+// objectHandle implements [disko.ObjectHandle] for any object on the image.
+type objectHandle struct {
+	driver  *Driver
+	inumber Inumber
+	inode   RawInode
+	name    string
+	// blocks gives the physical block numbers of the object's data, in order.
+	// Holes are 0. Device files have no blocks.
+	blocks []BlockNum
+	closed bool
+}
+
+// newHandle reads inode `inumber` and the list of its blocks, and returns a
+// handle for it. `name` is the name of the object in the directory it was
+// found in.
+func (driver *Driver) newHandle(inumber Inumber, name string) (*objectHandle, disko.DriverError) {
+	inode, err := readInode(driver.image, driver.superblock, inumber)
+	if err != nil {
+		return nil, err
+	} else if inode.Flags&FlagIsAllocated == 0 && name != "" {
+		return nil, disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf("directory entry %q refers to free inode %d", name, inumber))
+	}
+
+	var blocks []BlockNum
+	fileType := inode.Flags & FileTypeMask
+	if fileType == FileTypePlainFile || fileType == FileTypeDirectory {
+		blocks, err = fileBlocks(driver.image, driver.superblock, &inode)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &objectHandle{
+		driver:  driver,
+		inumber: inumber,
+		inode:   inode,
+		name:    name,
+		blocks:  blocks,
+	}, nil
+}
+
+func (handle *objectHandle) isDir() bool {
+	return handle.inode.Flags&FileTypeMask == FileTypeDirectory
+}
+
+// entries returns the directory entries in use, including "." and "..".
+func (handle *objectHandle) entries() ([]RawDirent, disko.DriverError) {
+	if !handle.isDir() {
+		return nil, disko.ErrNotADirectory.WithMessage(handle.name)
+	}
+
+	size := int(handle.inode.FileSize())
+	entries := make([]RawDirent, 0, size/direntSize)
+	for i, block := range handle.blocks {
+		if block == 0 {
+			continue
+		}
+
+		data, err := readBlock(handle.driver.image, block)
+		if err != nil {
+			return nil, err
+		}
+		if remaining := size - i*BlockSize; remaining < BlockSize {
+			data = data[:remaining]
+		}
+
+		for offset := 0; offset+direntSize <= len(data); offset += direntSize {
+			entry := RawDirent{
+				Inumber: Inumber(binary.LittleEndian.Uint16(data[offset:])),
+			}
+			if entry.Inumber == 0 {
+				continue
+			}
+			copy(entry.Name[:], data[offset+2:offset+direntSize])
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (handle *objectHandle) Stat() disko.FileStat {
+	// ConvertFSFlagsToStandard never fails.
+	stat, _ := RawInodeToStat(handle.inumber, handle.inode)
+	return stat
+}
+
+// IsHole implements [disko.SupportsHolesHandle].
+func (handle *objectHandle) IsHole(index c.LogicalBlock) bool {
+	return int(index) < len(handle.blocks) && handle.blocks[index] == 0
+}
+
+// ReadBlocks reads the object's data. Holes read as null bytes.
+func (handle *objectHandle) ReadBlocks(index c.LogicalBlock, buffer []byte) disko.DriverError {
+	for offset := 0; offset < len(buffer); offset += BlockSize {
+		blockIndex := int(index) + offset/BlockSize
+		if blockIndex >= len(handle.blocks) {
+			return disko.ErrArgumentOutOfRange.WithMessage(
+				fmt.Sprintf("%s has no block %d", handle.name, blockIndex))
+		}
+
+		chunk := buffer[offset : offset+BlockSize]
+		block := handle.blocks[blockIndex]
+		if block == 0 {
+			for i := range chunk {
+				chunk[i] = 0
+			}
+			continue
+		}
+
+		_, err := handle.driver.image.ReadAt(chunk, int64(block)*BlockSize)
+		if err != nil {
+			return disko.ErrIOFailed.Wrap(
+				fmt.Errorf("%s: failed to read block %d: %w", handle.name, blockIndex, err))
+		}
+	}
+	return nil
+}
+
+func (handle *objectHandle) Resize(newSize uint64) disko.DriverError {
+	return disko.ErrReadOnlyFileSystem
+}
+
+func (handle *objectHandle) WriteBlocks(index c.LogicalBlock, data []byte) disko.DriverError {
+	return disko.ErrReadOnlyFileSystem
+}
+
+func (handle *objectHandle) ZeroOutBlocks(startIndex c.LogicalBlock, count uint) disko.DriverError {
+	return disko.ErrReadOnlyFileSystem
+}
+
+func (handle *objectHandle) Unlink() disko.DriverError {
+	return disko.ErrReadOnlyFileSystem
+}
+
+func (handle *objectHandle) Name() string {
+	return handle.name
+}
+
+func (handle *objectHandle) SameAs(other disko.ObjectHandle) bool {
+	otherHandle, ok := other.(*objectHandle)
+	return ok && otherHandle.driver == handle.driver && otherHandle.inumber == handle.inumber
+}
+
+func (handle *objectHandle) Close() error {
+	if handle.closed {
+		return disko.ErrFileDescriptorBadState
+	}
+	handle.closed = true
+	return nil
+}
+
+// ListDir implements [disko.SupportsListDirHandle]. Names are returned in the
+// order they appear in the directory.
+func (handle *objectHandle) ListDir() ([]string, disko.DriverError) {
+	entries, err := handle.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.NameString()
+		if name != "." && name != ".." {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
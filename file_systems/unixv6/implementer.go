@@ -0,0 +1,185 @@
+package unixv6
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/disks"
+)
+
+// Driver implements [disko.FileSystemImplementer] for Unix V6 images. It only
+// supports mounting images read-only.
+//
+// Only the superblock and root directory are kept in memory. The block lists of
+// other objects are read when handles to them are created, so a mounted Driver
+// never changes and can be used from many goroutines at once.
+type Driver struct {
+	stream     io.ReadWriteSeeker
+	image      *disks.Section
+	superblock *RawSuperblock
+	root       *objectHandle
+	stat       disko.FSStat
+}
+
+// NewDriver creates a Unix V6 implementation for the image in `stream`. It
+// implements [disko.ImplementerConstructor].
+func NewDriver(stream io.ReadWriteSeeker) (disko.FileSystemImplementer, disko.DriverError) {
+	return &Driver{stream: stream}, nil
+}
+
+func (driver *Driver) Mount(flags disko.MountFlags) disko.DriverError {
+	if driver.superblock != nil {
+		return disko.ErrAlreadyInProgress
+	}
+
+	writeFlags := disko.MountFlagsAllowWrite |
+		disko.MountFlagsAllowInsert |
+		disko.MountFlagsAllowDelete |
+		disko.MountFlagsAllowAdminister
+	if flags&writeFlags != 0 && !flags.IsShared() {
+		return disko.ErrReadOnlyFileSystem.WithMessage(
+			"Unix V6 images can only be mounted read-only")
+	}
+
+	size, err := driver.stream.Seek(0, io.SeekEnd)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	image, err := disks.NewWindow(driver.stream, 0, size)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+
+	superblock, driverErr := readSuperblock(image, size)
+	if driverErr != nil {
+		return driverErr
+	}
+
+	stat, driverErr := statFileSystem(image, superblock)
+	if driverErr != nil {
+		return driverErr
+	}
+
+	driver.image = image
+	driver.superblock = superblock
+	root, driverErr := driver.newHandle(RootInumber, "/")
+	if driverErr == nil && !root.isDir() {
+		driverErr = disko.ErrFileSystemCorrupted.WithMessage("root inode isn't a directory")
+	}
+	if driverErr != nil {
+		driver.image = nil
+		driver.superblock = nil
+		return driverErr
+	}
+
+	driver.root = root
+	driver.stat = stat
+	return nil
+}
+
+// statFileSystem counts the free blocks and the used and free inodes.
+func statFileSystem(image io.ReaderAt, superblock *RawSuperblock) (disko.FSStat, disko.DriverError) {
+	freeBlocks, err := countFreeBlocks(image, superblock)
+	if err != nil {
+		return disko.FSStat{}, err
+	}
+
+	usedInodes := uint64(0)
+	for i := uint16(0); i < superblock.NumInodeBlocks; i++ {
+		data, err := readBlock(image, BlockNum(i+2))
+		if err != nil {
+			return disko.FSStat{}, err
+		}
+		for offset := 0; offset < BlockSize; offset += inodeSize {
+			if binary.LittleEndian.Uint16(data[offset:])&FlagIsAllocated != 0 {
+				usedInodes++
+			}
+		}
+	}
+
+	return disko.FSStat{
+		BlockSize:       BlockSize,
+		TotalBlocks:     uint64(superblock.TotalBlocks),
+		BlocksFree:      freeBlocks,
+		BlocksAvailable: freeBlocks,
+		Files:           usedInodes,
+		FilesFree:       uint64(superblock.totalInodes()) - usedInodes,
+		MaxNameLength:   MaxNameLength,
+	}, nil
+}
+
+// Flush implements [disko.FileSystemImplementer]. Images are read-only, so
+// there's never anything to write.
+func (driver *Driver) Flush() disko.DriverError {
+	return nil
+}
+
+func (driver *Driver) Unmount() disko.DriverError {
+	driver.image = nil
+	driver.superblock = nil
+	driver.root = nil
+	return nil
+}
+
+func (driver *Driver) CreateObject(
+	name string,
+	parent disko.ObjectHandle,
+	perm os.FileMode,
+) (disko.ObjectHandle, disko.DriverError) {
+	return nil, disko.ErrReadOnlyFileSystem
+}
+
+func (driver *Driver) GetObject(
+	name string,
+	parent disko.ObjectHandle,
+) (disko.ObjectHandle, disko.DriverError) {
+	directory, ok := parent.(*objectHandle)
+	if !ok {
+		return nil, disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("handle for %q isn't from the Unix V6 driver", parent.Name()))
+	}
+
+	entries, err := directory.entries()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.NameString() == name {
+			return driver.newHandle(entry.Inumber, name)
+		}
+	}
+	return nil, disko.ErrNotFound.WithMessage(name)
+}
+
+func (driver *Driver) GetRootDirectory() disko.ObjectHandle {
+	// The root directory was read when mounting. Each handle can be closed
+	// separately, but they can share the rest since it never changes.
+	root := *driver.root
+	return &root
+}
+
+// GetObjectByID implements [disko.ObjectIDImplementer]. IDs are inumbers.
+func (driver *Driver) GetObjectByID(inodeNumber uint64) (disko.ObjectHandle, disko.DriverError) {
+	if inodeNumber == 0 || inodeNumber > uint64(driver.superblock.totalInodes()) {
+		return nil, disko.ErrNotFound.WithMessage(fmt.Sprintf("no inode %d", inodeNumber))
+	}
+
+	handle, err := driver.newHandle(Inumber(inodeNumber), "")
+	if err != nil {
+		return nil, err
+	} else if handle.inode.Flags&FlagIsAllocated == 0 {
+		return nil, disko.ErrNotFound.WithMessage(fmt.Sprintf("inode %d is free", inodeNumber))
+	}
+	return handle, nil
+}
+
+func (driver *Driver) FSStat() disko.FSStat {
+	return driver.stat
+}
+
+func (driver *Driver) GetFSFeatures() disko.FSFeatures {
+	return Features
+}
@@ -0,0 +1,209 @@
+package unixv6_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/unixv6"
+	diskotest "github.com/dargueta/disko/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	imageBlocks   = 400
+	bigFileSize   = 300*512 + 100
+	sparseBlocks  = 1800
+	readmeModTime = 0x12345678
+)
+
+// v6Image builds a Unix V6 image block by block.
+type v6Image []byte
+
+func (image v6Image) block(number int) []byte {
+	return image[number*512 : (number+1)*512]
+}
+
+func (image v6Image) setInode(inumber int, flags uint16, size int, addresses ...uint16) {
+	inode := image[2*512+(inumber-1)*32:]
+	binary.LittleEndian.PutUint16(inode, flags)
+	inode[2] = 1
+	inode[5] = byte(size >> 16)
+	binary.LittleEndian.PutUint16(inode[6:], uint16(size))
+	for i, address := range addresses {
+		binary.LittleEndian.PutUint16(inode[8+2*i:], address)
+	}
+}
+
+func (image v6Image) setAddresses(block int, addresses ...uint16) {
+	for i, address := range addresses {
+		binary.LittleEndian.PutUint16(image.block(block)[2*i:], address)
+	}
+}
+
+func (image v6Image) setDirectory(block int, entries map[int]string, order ...int) {
+	for i, inumber := range order {
+		entry := image.block(block)[16*i:]
+		binary.LittleEndian.PutUint16(entry, uint16(inumber))
+		copy(entry[2:16], entries[inumber])
+	}
+}
+
+// makeV6Image creates a 400-block Unix V6 image with four blocks of inodes:
+//
+//	/bin/longname14chrs  small file, inode 3, "hello\n"
+//	/big                 large file, inode 4, with a hole at block 5
+//	/sparse              large file, inode 5, only data past the doubly indirect block
+//	/tty                 character device, inode 6
+//
+// Four blocks are free: 350 through 352 in the superblock, and 353 in the next
+// part of the free list.
+func makeV6Image() []byte {
+	image := v6Image(make([]byte, imageBlocks*512))
+
+	superblock := image.block(1)
+	binary.LittleEndian.PutUint16(superblock[0:], 4)
+	binary.LittleEndian.PutUint16(superblock[2:], imageBlocks)
+	binary.LittleEndian.PutUint16(superblock[4:], 3)
+	image.setAddresses(1, 4, imageBlocks, 3, 350, 351, 352)
+	image.setAddresses(350, 2, 0, 353)
+
+	const dir = unixv6.FlagIsAllocated | unixv6.FileTypeDirectory | 0o755
+	const file = unixv6.FlagIsAllocated | 0o644
+	const large = file | unixv6.FlagIsLargeFile
+
+	image.setInode(1, dir, 6*16, 6)
+	image.setDirectory(6, map[int]string{1: ".", 2: "bin", 4: "big", 5: "sparse", 6: "tty"}, 1, 1, 2, 4, 5, 6)
+	copy(image.block(6)[16+2:], "..")
+
+	image.setInode(2, dir, 3*16, 7)
+	image.setDirectory(7, map[int]string{2: ".", 1: "..", 3: "longname14chrs"}, 2, 1, 3)
+
+	image.setInode(3, file, 6, 8)
+	copy(image.block(8), "hello\n")
+	binary.LittleEndian.PutUint16(image[2*512+2*32+28:], readmeModTime>>16)
+	binary.LittleEndian.PutUint16(image[2*512+2*32+30:], readmeModTime&0xFFFF)
+
+	// Data block k of /big is filled with byte k and stored in block 11 + k,
+	// except for the hole.
+	image.setInode(4, large, bigFileSize, 9, 10)
+	for k := 0; k < 301; k++ {
+		address := uint16(11 + k)
+		if k == 5 {
+			address = 0
+		} else {
+			copy(image.block(11+k), bytes.Repeat([]byte{byte(k)}, 512))
+		}
+		binary.LittleEndian.PutUint16(image.block(9 + k/256)[2*(k%256):], address)
+	}
+
+	image.setInode(5, large, sparseBlocks*512, 0, 0, 0, 0, 0, 0, 0, 312)
+	image.setAddresses(312, 313)
+	for k := 0; k < sparseBlocks-7*256; k++ {
+		binary.LittleEndian.PutUint16(image.block(313)[2*k:], uint16(314+k))
+		copy(image.block(314+k), bytes.Repeat([]byte{0xA0 + byte(k)}, 512))
+	}
+
+	image.setInode(6, unixv6.FlagIsAllocated|unixv6.FileTypeCharDevice|0o666, 0, 0x0102)
+	return image
+}
+
+func mountImage(t *testing.T, image []byte) *driver.BaseDriver {
+	implementation := diskotest.MountImplementer(
+		t, unixv6.NewDriver, image, disko.MountFlagsAllowRead)
+	return driver.New(implementation, disko.MountFlagsAllowRead)
+}
+
+func TestDriver__ReadDirectories(t *testing.T) {
+	fs := mountImage(t, makeV6Image())
+
+	entries, err := fs.ReadDir("/")
+	require.NoError(t, err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"bin", "big", "sparse", "tty"}, names)
+
+	data, err := fs.ReadFile("/bin/longname14chrs")
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", string(data))
+
+	stat, err := fs.Stat("/bin/longname14chrs")
+	require.NoError(t, err)
+	assert.Equal(t, time.Unix(readmeModTime, 0).UTC(), stat.LastModified)
+	assert.EqualValues(t, 3, stat.InodeNumber)
+
+	_, err = fs.Stat("/BIN")
+	assert.ErrorIs(t, err, disko.ErrNotFound, "names are case-sensitive")
+}
+
+func TestDriver__LargeFiles(t *testing.T) {
+	fs := mountImage(t, makeV6Image())
+
+	data, err := fs.ReadFile("/big")
+	require.NoError(t, err)
+	require.Len(t, data, bigFileSize)
+	for k := 0; k < 301; k++ {
+		expected := byte(k)
+		if k == 5 {
+			expected = 0
+		}
+		end := (k + 1) * 512
+		if end > bigFileSize {
+			end = bigFileSize
+		}
+		require.Equalf(t, bytes.Repeat([]byte{expected}, end-k*512), data[k*512:end], "block %d", k)
+	}
+
+	data, err = fs.ReadFile("/sparse")
+	require.NoError(t, err)
+	require.Len(t, data, sparseBlocks*512)
+	assert.Equal(t, make([]byte, 7*256*512), data[:7*256*512])
+	for k := 0; k < sparseBlocks-7*256; k++ {
+		start := (7*256 + k) * 512
+		require.Equalf(
+			t, bytes.Repeat([]byte{0xA0 + byte(k)}, 512), data[start:start+512], "block %d", 7*256+k)
+	}
+}
+
+func TestDriver__Devices(t *testing.T) {
+	fs := mountImage(t, makeV6Image())
+
+	stat, err := fs.Stat("/tty")
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeDevice|os.ModeCharDevice|0o666, stat.ModeFlags)
+	assert.EqualValues(t, 0x0102, stat.Rdev)
+	assert.EqualValues(t, 0, stat.Size)
+}
+
+func TestDriver__FSStat(t *testing.T) {
+	implementation := diskotest.MountImplementer(
+		t, unixv6.NewDriver, makeV6Image(), disko.MountFlagsAllowRead)
+
+	stat := implementation.FSStat()
+	assert.EqualValues(t, imageBlocks, stat.TotalBlocks)
+	assert.EqualValues(t, 4, stat.BlocksFree)
+	assert.EqualValues(t, 6, stat.Files)
+	assert.EqualValues(t, 4*16-6, stat.FilesFree)
+	assert.EqualValues(t, 14, stat.MaxNameLength)
+}
+
+func TestDetect(t *testing.T) {
+	// The file system can't be bigger than the image.
+	diskotest.RunDetectConformanceTests(
+		t,
+		unixv6.Detect,
+		makeV6Image(),
+		map[string][]byte{"truncated image": makeV6Image()[:300*512]},
+	)
+}
+
+func TestDriver__Conformance(t *testing.T) {
+	diskotest.RunReadOnlyConformanceTests(t, unixv6.NewDriver, makeV6Image())
+}
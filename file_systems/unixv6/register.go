@@ -0,0 +1,111 @@
+package unixv6
+
+import (
+	"io"
+	"time"
+
+	"github.com/dargueta/disko"
+)
+
+// Features gives the features supported by the Unix V6 file system.
+var Features = disko.FSFeatures{
+	HasDirectories:         true,
+	HasHardLinks:           true,
+	HasAccessedTime:        true,
+	HasModifiedTime:        true,
+	HasUnixPermissions:     true,
+	HasUserPermissions:     true,
+	HasGroupPermissions:    true,
+	HasUserID:              true,
+	HasGroupID:             true,
+	TimestampEpoch:         time.Unix(0, 0).UTC(),
+	AccessedTimeResolution: time.Second,
+	ModifiedTimeResolution: time.Second,
+	TimestampRounding:      disko.TimestampTruncate,
+	DefaultNameEncoding:    disko.FSTextEncodingASCII,
+	SupportsBootCode:       true,
+	MaxBootCodeSize:        BlockSize,
+	DefaultBlockSize:       BlockSize,
+	MinTotalBlocks:         4,
+	MaxTotalBlocks:         0xFFFF,
+	// File sizes are stored in a 24-bit field.
+	MaxFileSize: 0xFFFFFF,
+}
+
+func init() {
+	disko.RegisterFileSystem(
+		disko.FileSystemRegistration{
+			Name:        "unixv6",
+			Description: "Unix V6",
+			Features:    Features,
+			Detect:      Detect,
+			Describe:    Describe,
+			New:         NewDriver,
+		},
+	)
+}
+
+// Detect returns true if `image` appears to contain a Unix V6 file system. It
+// implements the detection function for [disko.FileSystemRegistration].
+//
+// There's no magic number, so this relies on the superblock being consistent
+// with the size of the image, and the root directory being a directory whose
+// "." and ".." entries both point to itself.
+func Detect(image io.ReaderAt, size int64) bool {
+	superblock, err := readSuperblock(image, size)
+	if err != nil {
+		return false
+	}
+
+	root, err := readInode(image, superblock, RootInumber)
+	if err != nil ||
+		root.Flags&FlagIsAllocated == 0 ||
+		root.Flags&FileTypeMask != FileTypeDirectory ||
+		root.Flags&FlagIsLargeFile != 0 ||
+		root.FileSize() < 2*direntSize ||
+		!superblock.isDataBlock(root.Addr[0]) {
+		return false
+	}
+
+	data, err := readBlock(image, root.Addr[0])
+	if err != nil {
+		return false
+	}
+	dot := RawDirent{Inumber: Inumber(data[0]) | Inumber(data[1])<<8}
+	copy(dot.Name[:], data[2:direntSize])
+	dotDot := RawDirent{Inumber: Inumber(data[direntSize]) | Inumber(data[direntSize+1])<<8}
+	copy(dotDot.Name[:], data[direntSize+2:2*direntSize])
+
+	return dot.Inumber == RootInumber && dot.NameString() == "." &&
+		dotDot.Inumber == RootInumber && dotDot.NameString() == ".."
+}
+
+// Describe decodes the superblock of a Unix V6 image and counts its free
+// blocks and inodes. It implements the description function for
+// [disko.FileSystemRegistration].
+func Describe(image io.ReaderAt, size int64) (disko.ImageDescription, disko.DriverError) {
+	superblock, err := readSuperblock(image, size)
+	if err != nil {
+		return disko.ImageDescription{}, err
+	}
+
+	stat, err := statFileSystem(image, superblock)
+	if err != nil {
+		return disko.ImageDescription{}, err
+	}
+
+	return disko.ImageDescription{
+		Stat: stat,
+		Header: []disko.HeaderField{
+			{Name: "Total blocks", Value: superblock.TotalBlocks},
+			{Name: "Inode blocks", Value: superblock.NumInodeBlocks},
+			{Name: "Total inodes", Value: superblock.totalInodes()},
+			{Name: "Cached free blocks", Value: superblock.NumFreeListEntries},
+			{Name: "Cached free inodes", Value: superblock.NumIlistEntries},
+			{
+				Name:  "Last modified",
+				Value: time.Unix(int64(superblock.SuperblockModifiedAt), 0).UTC(),
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,203 @@
+package unixv6
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/dargueta/disko"
+)
+
+// Sizes of the on-disk structures, in bytes.
+const (
+	inodeSize      = 32
+	direntSize     = 16
+	inodesPerBlock = BlockSize / inodeSize
+	// addressesPerBlock is the number of block numbers in an indirect block.
+	addressesPerBlock = BlockSize / 2
+)
+
+// RootInumber is the inumber of the root directory.
+const RootInumber = Inumber(1)
+
+// pdpTime decodes a 32-bit timestamp stored as two words, high word first.
+func pdpTime(data []byte) uint32 {
+	return uint32(binary.LittleEndian.Uint16(data))<<16 | uint32(binary.LittleEndian.Uint16(data[2:]))
+}
+
+// readBlock reads block `block` of the image into a new buffer.
+func readBlock(image io.ReaderAt, block BlockNum) ([]byte, disko.DriverError) {
+	data := make([]byte, BlockSize)
+	_, err := image.ReadAt(data, int64(block)*BlockSize)
+	if err != nil {
+		return nil, disko.ErrIOFailed.Wrap(
+			fmt.Errorf("failed to read block %d: %w", block, err))
+	}
+	return data, nil
+}
+
+// readSuperblock reads and checks the superblock of an image that's `size`
+// bytes long. The file system has no magic number, so this only checks that
+// the sizes and the free list are consistent with each other and the image.
+func readSuperblock(image io.ReaderAt, size int64) (*RawSuperblock, disko.DriverError) {
+	if size < 3*BlockSize {
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			"image is too small to contain a superblock and inode table")
+	}
+
+	data, err := readBlock(image, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	superblock := &RawSuperblock{
+		NumInodeBlocks:       binary.LittleEndian.Uint16(data[0:]),
+		TotalBlocks:          binary.LittleEndian.Uint16(data[2:]),
+		NumFreeListEntries:   binary.LittleEndian.Uint16(data[4:]),
+		NumIlistEntries:      binary.LittleEndian.Uint16(data[206:]),
+		FLock:                data[408],
+		ILock:                data[409],
+		FModFlags:            data[410],
+		ReadOnly:             data[411],
+		SuperblockModifiedAt: pdpTime(data[412:]),
+	}
+	for i := range superblock.FreeList {
+		superblock.FreeList[i] = BlockNum(binary.LittleEndian.Uint16(data[6+2*i:]))
+	}
+	for i := range superblock.InumberList {
+		superblock.InumberList[i] = Inumber(binary.LittleEndian.Uint16(data[208+2*i:]))
+	}
+
+	totalBlocks := int64(superblock.TotalBlocks)
+	switch {
+	case superblock.NumInodeBlocks == 0:
+		return nil, disko.ErrInvalidFileSystem.WithMessage("inode table is empty")
+	case totalBlocks <= int64(superblock.NumInodeBlocks)+2:
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf(
+				"file system is %d blocks, too small for %d blocks of inodes",
+				totalBlocks,
+				superblock.NumInodeBlocks,
+			),
+		)
+	case totalBlocks*BlockSize > size:
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf(
+				"file system is %d blocks but the image is only %d bytes",
+				totalBlocks,
+				size,
+			),
+		)
+	case superblock.NumFreeListEntries > 100:
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("free list has %d entries, expected at most 100", superblock.NumFreeListEntries))
+	case superblock.NumIlistEntries > 100:
+		return nil, disko.ErrInvalidFileSystem.WithMessage(
+			fmt.Sprintf("free inode list has %d entries, expected at most 100", superblock.NumIlistEntries))
+	}
+
+	for _, block := range superblock.FreeList[:superblock.NumFreeListEntries] {
+		if block != 0 && !superblock.isDataBlock(block) {
+			return nil, disko.ErrInvalidFileSystem.WithMessage(
+				fmt.Sprintf("free list contains block %d, outside the data area", block))
+		}
+	}
+	return superblock, nil
+}
+
+// isDataBlock returns true if `block` is in the data area, i.e. after the
+// inode table and before the end of the file system.
+func (superblock *RawSuperblock) isDataBlock(block BlockNum) bool {
+	return uint(block) >= uint(superblock.NumInodeBlocks)+2 && block < BlockNum(superblock.TotalBlocks)
+}
+
+// totalInodes returns the number of inodes in the inode table.
+func (superblock *RawSuperblock) totalInodes() uint {
+	return uint(superblock.NumInodeBlocks) * inodesPerBlock
+}
+
+// countFreeBlocks follows the free list and returns the number of free blocks.
+//
+// The superblock holds the first part of the list. Entry 0 of each part is the
+// block holding the next part, which is itself free, so every nonzero entry is
+// a free block. A part whose entry 0 is 0 is the last one.
+func countFreeBlocks(image io.ReaderAt, superblock *RawSuperblock) (uint64, disko.DriverError) {
+	count := uint64(0)
+	entries := superblock.FreeList[:superblock.NumFreeListEntries]
+
+	// Each part of the list is in a different block, so the list can't be
+	// longer than the file system without going in circles.
+	for parts := 0; len(entries) > 0; parts++ {
+		if parts > int(superblock.TotalBlocks) {
+			return 0, disko.ErrFileSystemCorrupted.WithMessage("free list has a cycle")
+		}
+
+		for _, block := range entries {
+			if block == 0 {
+				continue
+			} else if !superblock.isDataBlock(block) {
+				return 0, disko.ErrFileSystemCorrupted.WithMessage(
+					fmt.Sprintf("free list contains block %d, outside the data area", block))
+			}
+			count++
+		}
+
+		next := entries[0]
+		if next == 0 {
+			break
+		}
+
+		data, err := readBlock(image, next)
+		if err != nil {
+			return 0, err
+		}
+		numEntries := binary.LittleEndian.Uint16(data)
+		if numEntries > 100 {
+			return 0, disko.ErrFileSystemCorrupted.WithMessage(
+				fmt.Sprintf("free list block %d has %d entries, expected at most 100", next, numEntries))
+		}
+
+		entries = make([]BlockNum, numEntries)
+		for i := range entries {
+			entries[i] = BlockNum(binary.LittleEndian.Uint16(data[2+2*i:]))
+		}
+	}
+	return count, nil
+}
+
+// parseRawInode decodes an inode from the inode table.
+func parseRawInode(data []byte) RawInode {
+	inode := RawInode{
+		Flags:        binary.LittleEndian.Uint16(data[0:]),
+		NLink:        data[2],
+		UID:          data[3],
+		GID:          data[4],
+		Size:         [3]uint8{data[5], data[6], data[7]},
+		AccessedTime: pdpTime(data[24:]),
+		ModifiedTime: pdpTime(data[28:]),
+	}
+	for i := range inode.Addr {
+		inode.Addr[i] = BlockNum(binary.LittleEndian.Uint16(data[8+2*i:]))
+	}
+	return inode
+}
+
+// readInode reads inode `inumber` from the inode table.
+func readInode(
+	image io.ReaderAt,
+	superblock *RawSuperblock,
+	inumber Inumber,
+) (RawInode, disko.DriverError) {
+	if inumber == 0 || uint(inumber) > superblock.totalInodes() {
+		return RawInode{}, disko.ErrFileSystemCorrupted.WithMessage(
+			fmt.Sprintf("inumber %d is out of range", inumber))
+	}
+
+	data := make([]byte, inodeSize)
+	_, err := image.ReadAt(data, 2*BlockSize+int64(inumber-1)*inodeSize)
+	if err != nil {
+		return RawInode{}, disko.ErrIOFailed.Wrap(
+			fmt.Errorf("failed to read inode %d: %w", inumber, err))
+	}
+	return parseRawInode(data), nil
+}
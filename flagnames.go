@@ -0,0 +1,189 @@
+package disko
+
+import (
+	"fmt"
+	"strings"
+)
+
+// flagName associates a single flag with its symbolic name.
+type flagName[T ~int] struct {
+	flag T
+	name string
+}
+
+// ioAccessModeNames are the names of the mutually exclusive access modes in
+// [IOFlags]. The first name for each mode is the one [IOFlags.String] uses.
+var ioAccessModeNames = []flagName[IOFlags]{
+	{O_RDONLY, "ro"},
+	{O_WRONLY, "wo"},
+	{O_RDWR, "rw"},
+	{O_RDONLY, "rdonly"},
+	{O_WRONLY, "wronly"},
+	{O_RDWR, "rdwr"},
+}
+
+// ioFlagNames are the names of the [IOFlags] that aren't access modes, in the
+// order [IOFlags.String] prints them.
+var ioFlagNames = []flagName[IOFlags]{
+	{O_APPEND, "append"},
+	{O_CREATE, "create"},
+	{O_TRUNC, "trunc"},
+	{O_EXCL, "excl"},
+	{O_SYNC, "sync"},
+	{O_NOFOLLOW, "nofollow"},
+	{O_DIRECTORY, "directory"},
+	{O_TMPFILE, "tmpfile"},
+	{O_NOATIME, "noatime"},
+	{O_PATH, "path"},
+}
+
+// mountFlagNames are the names of the [MountFlags] defined by the API, in the
+// order [MountFlags.String] prints them.
+var mountFlagNames = []flagName[MountFlags]{
+	{MountFlagsAllowRead, "read"},
+	{MountFlagsAllowWrite, "write"},
+	{MountFlagsAllowInsert, "insert"},
+	{MountFlagsAllowDelete, "delete"},
+	{MountFlagsAllowAdminister, "administer"},
+	{MountFlagsPreserveTimestamps, "preserve-timestamps"},
+	{MountFlagsShared, "shared"},
+	{MountFlagsNoDecompression, "no-decompression"},
+	{MountFlagsVerifyWrites, "verify-writes"},
+	{MountFlagsLenient, "lenient"},
+}
+
+// splitFlagNames splits a string of flag names separated by "|" and normalizes
+// them. Empty names are an error.
+func splitFlagNames(text string) ([]string, error) {
+	parts := strings.Split(text, "|")
+	for i, part := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(part))
+		if parts[i] == "" {
+			return nil, ErrInvalidArgument.WithMessage(
+				fmt.Sprintf("empty flag name in %q", text))
+		}
+	}
+	return parts, nil
+}
+
+// lookUpFlag returns the flag called `name`.
+func lookUpFlag[T ~int](names []flagName[T], name string) (T, bool) {
+	for _, entry := range names {
+		if entry.name == name {
+			return entry.flag, true
+		}
+	}
+	return 0, false
+}
+
+// joinFlagNames returns the names of all flags in `flags` separated by "|",
+// followed by any bits that don't have a name, in hexadecimal.
+func joinFlagNames[T ~int](flags T, names []flagName[T], parts []string) string {
+	for _, entry := range names {
+		if flags&entry.flag != 0 {
+			parts = append(parts, entry.name)
+			flags &^= entry.flag
+		}
+	}
+	if flags != 0 {
+		parts = append(parts, fmt.Sprintf("%#x", int(flags)))
+	}
+	return strings.Join(parts, "|")
+}
+
+// ParseIOFlags converts a string of flag names separated by "|", such as
+// "rw|create|trunc", into [IOFlags]. Names are case-insensitive. At most one
+// access mode ("ro", "wo", "rw", or their aliases "rdonly", "wronly", "rdwr")
+// may be given; if none is, the flags are read-only.
+//
+// The result is checked with [IOFlags.Validate].
+func ParseIOFlags(text string) (IOFlags, error) {
+	names, err := splitFlagNames(text)
+	if err != nil {
+		return 0, err
+	}
+
+	flags := O_RDONLY
+	accessMode := ""
+	for _, name := range names {
+		if mode, ok := lookUpFlag(ioAccessModeNames, name); ok {
+			if accessMode != "" {
+				return 0, ErrInvalidArgument.WithMessage(
+					fmt.Sprintf("conflicting access modes %q and %q", accessMode, name))
+			}
+			accessMode = name
+			flags |= mode
+		} else if flag, ok := lookUpFlag(ioFlagNames, name); ok {
+			flags |= flag
+		} else {
+			return 0, ErrInvalidArgument.WithMessage(
+				fmt.Sprintf("unrecognized I/O flag %q", name))
+		}
+	}
+
+	err = flags.Validate()
+	if err != nil {
+		return 0, err
+	}
+	return flags, nil
+}
+
+// Validate returns [ErrInvalidArgument] if the flags contain a combination that
+// makes no sense, such as truncating a file opened read-only.
+func (flags IOFlags) Validate() error {
+	switch {
+	case flags&O_ACCMODE == O_ACCMODE:
+		return ErrInvalidArgument.WithMessage("wo and rw are mutually exclusive")
+	case flags.Truncate() && !flags.Write():
+		return ErrInvalidArgument.WithMessage("can't truncate a file opened read-only")
+	case flags.Append() && !flags.Write():
+		return ErrInvalidArgument.WithMessage("can't append to a file opened read-only")
+	case flags.Exclusive() && !flags.Create():
+		return ErrInvalidArgument.WithMessage("excl requires create")
+	}
+	return nil
+}
+
+// String returns the flags in the format accepted by [ParseIOFlags], e.g.
+// "rw|create|trunc". The access mode always comes first.
+func (flags IOFlags) String() string {
+	accessMode := fmt.Sprintf("%#x", int(flags&O_ACCMODE))
+	for _, entry := range ioAccessModeNames {
+		if flags&O_ACCMODE == entry.flag {
+			accessMode = entry.name
+			break
+		}
+	}
+	return joinFlagNames(flags&^O_ACCMODE, ioFlagNames, []string{accessMode})
+}
+
+// ParseMountFlags converts a string of flag names separated by "|", such as
+// "read|write|lenient", into [MountFlags]. Names are case-insensitive.
+// Implementation-specific flags can't be given by name.
+func ParseMountFlags(text string) (MountFlags, error) {
+	names, err := splitFlagNames(text)
+	if err != nil {
+		return 0, err
+	}
+
+	var flags MountFlags
+	for _, name := range names {
+		flag, ok := lookUpFlag(mountFlagNames, name)
+		if !ok {
+			return 0, ErrInvalidArgument.WithMessage(
+				fmt.Sprintf("unrecognized mount flag %q", name))
+		}
+		flags |= flag
+	}
+	return flags, nil
+}
+
+// String returns the flags in the format accepted by [ParseMountFlags], e.g.
+// "read|write|lenient". Implementation-specific flags are given in hexadecimal
+// at the end. If no flags are set, this returns "none".
+func (flags MountFlags) String() string {
+	if flags == 0 {
+		return "none"
+	}
+	return joinFlagNames(flags, mountFlagNames, nil)
+}
@@ -0,0 +1,67 @@
+package disko_test
+
+import (
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIOFlags__Basic(t *testing.T) {
+	flags, err := disko.ParseIOFlags("rw|create|trunc")
+	require.NoError(t, err)
+	assert.Equal(t, disko.O_RDWR|disko.O_CREATE|disko.O_TRUNC, flags)
+	assert.Equal(t, "rw|create|trunc", flags.String())
+
+	flags, err = disko.ParseIOFlags(" WRONLY | Append ")
+	require.NoError(t, err)
+	assert.Equal(t, disko.O_WRONLY|disko.O_APPEND, flags)
+	assert.Equal(t, "wo|append", flags.String())
+
+	flags, err = disko.ParseIOFlags("nofollow")
+	require.NoError(t, err)
+	assert.Equal(t, disko.O_RDONLY|disko.O_NOFOLLOW, flags)
+	assert.Equal(t, "ro|nofollow", flags.String())
+}
+
+func TestParseIOFlags__Invalid(t *testing.T) {
+	invalid := []string{
+		"",
+		"rw||create",
+		"rw|bogus",
+		"ro|rw",
+		"ro|trunc",
+		"append",
+		"rw|excl",
+	}
+	for _, text := range invalid {
+		_, err := disko.ParseIOFlags(text)
+		assert.ErrorIsf(t, err, disko.ErrInvalidArgument, "%q was accepted", text)
+	}
+}
+
+func TestMountFlags__String(t *testing.T) {
+	assert.Equal(t, "none", disko.MountFlags(0).String())
+	assert.Equal(t, "read|write", disko.MountFlagsAllowReadWrite.String())
+	assert.Equal(
+		t,
+		"read|lenient|0x800",
+		(disko.MountFlagsAllowRead | disko.MountFlagsLenient | disko.MountFlagsCustomStart<<1).String(),
+	)
+}
+
+func TestParseMountFlags(t *testing.T) {
+	flags, err := disko.ParseMountFlags("read|Write|verify-writes")
+	require.NoError(t, err)
+	assert.Equal(
+		t, disko.MountFlagsAllowReadWrite|disko.MountFlagsVerifyWrites, flags)
+
+	// String() and ParseMountFlags() must round-trip.
+	parsed, err := disko.ParseMountFlags(disko.MountFlagsAllowAll.String())
+	require.NoError(t, err)
+	assert.Equal(t, disko.MountFlagsAllowAll, parsed)
+
+	_, err = disko.ParseMountFlags("read|fly")
+	assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+}
@@ -0,0 +1,60 @@
+package fuse
+
+import (
+	"errors"
+	"syscall"
+
+	"github.com/dargueta/disko"
+)
+
+// errnoClass maps a disko error to the errno reported to the host.
+type errnoClass struct {
+	target error
+	errno  syscall.Errno
+}
+
+// errnoClasses are checked in order, so if an error wraps several of these, the
+// earlier one wins.
+var errnoClasses = []errnoClass{
+	{disko.ErrNotFound, syscall.ENOENT},
+	{disko.ErrExists, syscall.EEXIST},
+	{disko.ErrPermissionDenied, syscall.EACCES},
+	{disko.ErrNotPermitted, syscall.EPERM},
+	{disko.ErrReadOnlyFileSystem, syscall.EROFS},
+	{disko.ErrNotSupported, syscall.ENOTSUP},
+	{disko.ErrNotImplemented, syscall.ENOSYS},
+	{disko.ErrNoSpaceOnDevice, syscall.ENOSPC},
+	{disko.ErrDiskQuotaExceeded, syscall.EDQUOT},
+	{disko.ErrFileTooLarge, syscall.EFBIG},
+	{disko.ErrIsADirectory, syscall.EISDIR},
+	{disko.ErrNotADirectory, syscall.ENOTDIR},
+	{disko.ErrDirectoryNotEmpty, syscall.ENOTEMPTY},
+	{disko.ErrNameTooLong, syscall.ENAMETOOLONG},
+	{disko.ErrCrossDeviceLink, syscall.EXDEV},
+	{disko.ErrTooManyLinks, syscall.EMLINK},
+	{disko.ErrLinkCycleDetected, syscall.ELOOP},
+	{disko.ErrInvalidArgument, syscall.EINVAL},
+	{disko.ErrArgumentOutOfRange, syscall.EDOM},
+	{disko.ErrResultOutOfRange, syscall.ERANGE},
+	{disko.ErrFileSystemCorrupted, syscall.EUCLEAN},
+	{disko.ErrBusy, syscall.EBUSY},
+}
+
+// toErrno converts an error from the driver into the errno reported to the
+// host. Anything unrecognized is reported as an I/O error.
+func toErrno(err error) syscall.Errno {
+	if err == nil {
+		return 0
+	}
+
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return errno
+	}
+	for _, class := range errnoClasses {
+		if errors.Is(err, class.target) {
+			return class.errno
+		}
+	}
+	return syscall.EIO
+}
@@ -0,0 +1,122 @@
+// Package fuse exposes a mounted image to the host operating system through
+// FUSE, so that it can be browsed with a file manager or any other program.
+//
+// Every request is passed on to a [driver.BaseDriver], so anything the driver
+// supports works. Write operations are only allowed if the image was mounted
+// with flags that permit them; otherwise the host sees a read-only file system.
+// Renaming isn't supported, since the driver can't rename objects.
+package fuse
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	gofuse "github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// cacheTimeout is how long the kernel may cache names and attributes. Nothing
+// else changes the image while it's mounted, so this only needs to be short
+// enough that changes made through the driver directly show up promptly.
+const cacheTimeout = time.Second
+
+// Options controls how an image is mounted.
+type Options struct {
+	// Name is shown as the source of the mount, e.g. in `mount` and `df`. It's
+	// usually the path to the image.
+	Name string
+
+	// AllowOther lets users other than the one who mounted the image access
+	// it. This usually requires user_allow_other in /etc/fuse.conf.
+	AllowOther bool
+
+	// Debug logs every FUSE request.
+	Debug bool
+}
+
+// Server is an image mounted on the host.
+type Server struct {
+	server *gofuse.Server
+	fs     *fileSystem
+}
+
+// fileSystem is the state shared by all the nodes of a mounted image.
+type fileSystem struct {
+	driver   *driver.BaseDriver
+	writable bool
+	// lock serializes access to the driver, since FUSE requests are handled
+	// concurrently and the driver isn't thread-safe.
+	lock sync.Mutex
+}
+
+// Mount exposes `image` at `mountPoint` on the host, which must be an existing
+// directory. `flags` must be the flags the image was mounted with; if they
+// don't allow modifying it, the host mount is read-only.
+//
+// The image is served in the background until [Server.Unmount] is called or
+// it's unmounted on the host, e.g. with `fusermount -u`.
+func Mount(
+	image *driver.BaseDriver,
+	flags disko.MountFlags,
+	mountPoint string,
+	options Options,
+) (*Server, error) {
+	fs := &fileSystem{
+		driver:   image,
+		writable: flags.CanWrite() || flags.CanDelete(),
+	}
+
+	timeout := cacheTimeout
+	mountOptions := gofuse.MountOptions{
+		FsName:     options.Name,
+		Name:       "disko",
+		AllowOther: options.AllowOther,
+		Debug:      options.Debug,
+	}
+	if !fs.writable {
+		mountOptions.Options = append(mountOptions.Options, "ro")
+	}
+
+	server, err := fusefs.Mount(
+		mountPoint,
+		&node{fs: fs},
+		&fusefs.Options{
+			MountOptions: mountOptions,
+			EntryTimeout: &timeout,
+			AttrTimeout:  &timeout,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{server: server, fs: fs}, nil
+}
+
+// Wait blocks until the image is unmounted.
+func (server *Server) Wait() {
+	server.server.Wait()
+}
+
+// Unmount unmounts the image from the host and writes out any pending changes.
+// It fails if the mount point is busy, e.g. because a program is using a file
+// in it.
+func (server *Server) Unmount() error {
+	err := server.server.Unmount()
+	if err != nil {
+		return err
+	}
+	return server.fs.flush()
+}
+
+// flush writes out pending changes to the image, if it's writable.
+func (fs *fileSystem) flush() error {
+	if !fs.writable {
+		return nil
+	}
+
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	return fs.driver.Flush()
+}
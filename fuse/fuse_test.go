@@ -0,0 +1,85 @@
+package fuse_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	"github.com/dargueta/disko/file_systems/memfs"
+	"github.com/dargueta/disko/fuse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mountMemoryFS mounts an empty [memfs.MemoryFS] on the host with `flags`,
+// and returns the driver, the mount point, and a function that unmounts it. The
+// image is unmounted when the test ends if that function isn't called. The test
+// is skipped if FUSE isn't available.
+func mountMemoryFS(
+	t *testing.T,
+	flags disko.MountFlags,
+) (*driver.BaseDriver, string, func()) {
+	implementation := memfs.NewMemoryFS(512, 256)
+	require.NoError(t, implementation.Mount(flags))
+	image := driver.New(implementation, flags)
+
+	mountPoint := t.TempDir()
+	server, err := fuse.Mount(image, flags, mountPoint, fuse.Options{Name: t.Name()})
+	if err != nil {
+		t.Skipf("FUSE isn't available: %s", err)
+	}
+
+	var once sync.Once
+	unmount := func() {
+		once.Do(func() { assert.NoError(t, server.Unmount()) })
+	}
+	t.Cleanup(unmount)
+	return image, mountPoint, unmount
+}
+
+func TestMount__ReadWrite(t *testing.T) {
+	image, mountPoint, unmount := mountMemoryFS(t, disko.MountFlagsAllowAll)
+
+	require.NoError(t, os.Mkdir(filepath.Join(mountPoint, "dir"), 0o755))
+	hostPath := filepath.Join(mountPoint, "dir", "file.txt")
+	require.NoError(t, os.WriteFile(hostPath, []byte("hello"), 0o644))
+
+	data, err := os.ReadFile(hostPath)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), data)
+
+	require.NoError(t, os.WriteFile(hostPath, []byte("bye"), 0o644))
+	data, err = os.ReadFile(hostPath)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("bye"), data, "O_TRUNC wasn't honored")
+
+	entries, err := os.ReadDir(filepath.Join(mountPoint, "dir"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "file.txt", entries[0].Name())
+
+	require.NoError(t, os.WriteFile(filepath.Join(mountPoint, "kept.txt"), []byte("kept"), 0o644))
+	require.NoError(t, os.Remove(hostPath))
+
+	// The host may release files after the calls above return, so only look at
+	// the image directly once it's unmounted.
+	unmount()
+	_, err = image.Stat("/dir/file.txt")
+	assert.ErrorIs(t, err, disko.ErrNotFound)
+	data, err = image.ReadFile("/kept.txt")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("kept"), data)
+}
+
+func TestMount__ReadOnly(t *testing.T) {
+	_, mountPoint, _ := mountMemoryFS(t, disko.MountFlagsAllowRead)
+
+	err := os.WriteFile(filepath.Join(mountPoint, "file.txt"), []byte("x"), 0o644)
+	assert.Error(t, err)
+
+	_, err = os.Stat(filepath.Join(mountPoint, "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,503 @@
+package fuse
+
+import (
+	"context"
+	"io"
+	"os"
+	posixpath "path"
+	"syscall"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/driver"
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	gofuse "github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// node is a file, directory, or symbolic link in a mounted image. Nodes only
+// know their path; everything else is looked up through the driver each time.
+type node struct {
+	fusefs.Inode
+	fs *fileSystem
+
+	// file is shared by every handle the host has open on the node, so that
+	// they all see the same data and size. Each driver file caches blocks
+	// separately, so giving each handle its own would let them overwrite each
+	// other's changes. It's nil if no handles are open.
+	file *driver.File
+	// openCount is the number of host handles using `file`.
+	openCount int
+}
+
+var _ = (fusefs.NodeLookuper)((*node)(nil))
+var _ = (fusefs.NodeGetattrer)((*node)(nil))
+var _ = (fusefs.NodeSetattrer)((*node)(nil))
+var _ = (fusefs.NodeReaddirer)((*node)(nil))
+var _ = (fusefs.NodeReadlinker)((*node)(nil))
+var _ = (fusefs.NodeOpener)((*node)(nil))
+var _ = (fusefs.NodeCreater)((*node)(nil))
+var _ = (fusefs.NodeMkdirer)((*node)(nil))
+var _ = (fusefs.NodeUnlinker)((*node)(nil))
+var _ = (fusefs.NodeRmdirer)((*node)(nil))
+var _ = (fusefs.NodeSymlinker)((*node)(nil))
+var _ = (fusefs.NodeLinker)((*node)(nil))
+
+// path returns the absolute path of the node in the image.
+func (n *node) path() string {
+	return "/" + n.Path(nil)
+}
+
+func (n *node) childPath(name string) string {
+	return posixpath.Join(n.path(), name)
+}
+
+// modeToSyscall converts mode flags to the form the kernel expects.
+func modeToSyscall(mode os.FileMode) uint32 {
+	bits := uint32(mode.Perm())
+	switch {
+	case mode.IsDir():
+		bits |= syscall.S_IFDIR
+	case mode&os.ModeSymlink != 0:
+		bits |= syscall.S_IFLNK
+	case mode&os.ModeCharDevice != 0:
+		bits |= syscall.S_IFCHR
+	case mode&os.ModeDevice != 0:
+		bits |= syscall.S_IFBLK
+	case mode&os.ModeNamedPipe != 0:
+		bits |= syscall.S_IFIFO
+	case mode&os.ModeSocket != 0:
+		bits |= syscall.S_IFSOCK
+	default:
+		bits |= syscall.S_IFREG
+	}
+	return bits
+}
+
+// fillAttr converts `stat` into the attributes reported to the kernel.
+// Timestamps the file system doesn't have are reported as the Unix epoch.
+func fillAttr(stat disko.FileStat, out *gofuse.Attr) {
+	out.Mode = modeToSyscall(stat.ModeFlags)
+	out.Size = uint64(stat.Size)
+	out.Blksize = uint32(stat.BlockSize)
+	out.Blocks = uint64(stat.NumBlocks*stat.BlockSize+511) / 512
+	out.Nlink = uint32(stat.Nlinks)
+	if out.Nlink == 0 {
+		out.Nlink = 1
+	}
+	out.Uid = stat.Uid
+	out.Gid = stat.Gid
+	out.Rdev = uint32(stat.Rdev)
+
+	if !stat.LastAccessed.IsZero() {
+		out.SetTimes(&stat.LastAccessed, nil, nil)
+	}
+	if !stat.LastModified.IsZero() {
+		out.SetTimes(nil, &stat.LastModified, nil)
+	}
+	if !stat.LastChanged.IsZero() {
+		out.SetTimes(nil, nil, &stat.LastChanged)
+	} else if !stat.LastModified.IsZero() {
+		out.SetTimes(nil, nil, &stat.LastModified)
+	}
+}
+
+// newChild creates the inode for the object at `absPath`, filling in `out`
+// with its attributes. The caller must hold the lock.
+func (n *node) newChild(
+	ctx context.Context,
+	absPath string,
+	out *gofuse.EntryOut,
+) (*fusefs.Inode, syscall.Errno) {
+	stat, err := n.fs.driver.Lstat(absPath)
+	if err != nil {
+		return nil, toErrno(err)
+	}
+
+	fillAttr(stat, &out.Attr)
+	child := &node{fs: n.fs}
+	return n.NewInode(ctx, child, fusefs.StableAttr{Mode: out.Attr.Mode & syscall.S_IFMT}), 0
+}
+
+func (n *node) Lookup(
+	ctx context.Context,
+	name string,
+	out *gofuse.EntryOut,
+) (*fusefs.Inode, syscall.Errno) {
+	n.fs.lock.Lock()
+	defer n.fs.lock.Unlock()
+	return n.newChild(ctx, n.childPath(name), out)
+}
+
+// stat returns the status of the node. The caller must hold the lock.
+//
+// The driver only updates the size of a file once it's closed, so if the host
+// has the file open, the size is taken from the open file instead.
+func (n *node) stat() (disko.FileStat, error) {
+	stat, err := n.fs.driver.Lstat(n.path())
+	if err != nil {
+		return stat, err
+	}
+	if n.file != nil {
+		stat.Size = n.file.Size()
+	}
+	return stat, nil
+}
+
+func (n *node) Getattr(ctx context.Context, fh fusefs.FileHandle, out *gofuse.AttrOut) syscall.Errno {
+	n.fs.lock.Lock()
+	defer n.fs.lock.Unlock()
+
+	stat, err := n.stat()
+	if err != nil {
+		return toErrno(err)
+	}
+	fillAttr(stat, &out.Attr)
+	return 0
+}
+
+// Setattr handles truncate(2), chmod(2), chown(2), and utimes(2).
+func (n *node) Setattr(
+	ctx context.Context,
+	fh fusefs.FileHandle,
+	in *gofuse.SetAttrIn,
+	out *gofuse.AttrOut,
+) syscall.Errno {
+	n.fs.lock.Lock()
+	defer n.fs.lock.Unlock()
+
+	absPath := n.path()
+	if size, ok := in.GetSize(); ok {
+		if n.file != nil {
+			err := n.file.Truncate(int64(size))
+			if err != nil {
+				return toErrno(err)
+			}
+		} else {
+			file, err := n.fs.driver.OpenFile(absPath, disko.O_WRONLY, 0)
+			if err != nil {
+				return toErrno(err)
+			}
+			err = file.Truncate(int64(size))
+			closeErr := file.Close()
+			if err != nil {
+				return toErrno(err)
+			} else if closeErr != nil {
+				return toErrno(closeErr)
+			}
+		}
+	}
+
+	if mode, ok := in.GetMode(); ok {
+		err := n.fs.driver.Chmod(absPath, os.FileMode(mode).Perm())
+		if err != nil {
+			return toErrno(err)
+		}
+	}
+
+	uid, setUID := in.GetUID()
+	gid, setGID := in.GetGID()
+	if setUID || setGID {
+		stat, err := n.fs.driver.Lstat(absPath)
+		if err != nil {
+			return toErrno(err)
+		}
+		if !setUID {
+			uid = stat.Uid
+		}
+		if !setGID {
+			gid = stat.Gid
+		}
+
+		err = n.fs.driver.Lchown(absPath, int(uid), int(gid))
+		if err != nil {
+			return toErrno(err)
+		}
+	}
+
+	atime, setATime := in.GetATime()
+	mtime, setMTime := in.GetMTime()
+	if setATime || setMTime {
+		// The driver leaves undefined timestamps alone.
+		if !setATime {
+			atime = disko.UndefinedTimestamp
+		}
+		if !setMTime {
+			mtime = disko.UndefinedTimestamp
+		}
+
+		err := n.fs.driver.Chtimes(absPath, atime, mtime)
+		if err != nil {
+			return toErrno(err)
+		}
+	}
+
+	stat, err := n.stat()
+	if err != nil {
+		return toErrno(err)
+	}
+	fillAttr(stat, &out.Attr)
+	return 0
+}
+
+func (n *node) Readdir(ctx context.Context) (fusefs.DirStream, syscall.Errno) {
+	n.fs.lock.Lock()
+	defer n.fs.lock.Unlock()
+
+	entries, err := n.fs.driver.ReadDir(n.path())
+	if err != nil {
+		return nil, toErrno(err)
+	}
+
+	list := make([]gofuse.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		list = append(
+			list,
+			gofuse.DirEntry{
+				Name: entry.Name(),
+				Mode: modeToSyscall(entry.Stat().ModeFlags),
+			},
+		)
+	}
+	return fusefs.NewListDirStream(list), 0
+}
+
+func (n *node) Readlink(ctx context.Context) ([]byte, syscall.Errno) {
+	n.fs.lock.Lock()
+	defer n.fs.lock.Unlock()
+
+	target, err := n.fs.driver.Readlink(n.path())
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	return []byte(target), 0
+}
+
+func (n *node) Open(ctx context.Context, flags uint32) (fusefs.FileHandle, uint32, syscall.Errno) {
+	n.fs.lock.Lock()
+	defer n.fs.lock.Unlock()
+
+	handle, errno := n.open(n.path(), disko.OSFlagsToIOFlags(int(flags)))
+	if errno != 0 {
+		return nil, 0, errno
+	}
+	return handle, 0, 0
+}
+
+func (n *node) Create(
+	ctx context.Context,
+	name string,
+	flags uint32,
+	mode uint32,
+	out *gofuse.EntryOut,
+) (*fusefs.Inode, fusefs.FileHandle, uint32, syscall.Errno) {
+	n.fs.lock.Lock()
+	defer n.fs.lock.Unlock()
+
+	ioFlags := disko.OSFlagsToIOFlags(int(flags))
+	if !n.fs.writable {
+		return nil, nil, 0, syscall.EROFS
+	}
+
+	// Create the file, then open it the same way as an existing one.
+	absPath := n.childPath(name)
+	file, err := n.fs.driver.OpenFile(
+		absPath,
+		disko.O_WRONLY|disko.O_CREATE|(ioFlags&disko.O_EXCL),
+		os.FileMode(mode).Perm(),
+	)
+	if err != nil {
+		return nil, nil, 0, toErrno(err)
+	}
+	err = file.Close()
+	if err != nil {
+		return nil, nil, 0, toErrno(err)
+	}
+
+	child, errno := n.newChild(ctx, absPath, out)
+	if errno != 0 {
+		return nil, nil, 0, errno
+	}
+	// The child isn't in the tree until we return, so it doesn't know its path
+	// yet.
+	handle, errno := child.Operations().(*node).open(absPath, ioFlags)
+	if errno != 0 {
+		return nil, nil, 0, errno
+	}
+	return child, handle, 0, 0
+}
+
+func (n *node) Mkdir(
+	ctx context.Context,
+	name string,
+	mode uint32,
+	out *gofuse.EntryOut,
+) (*fusefs.Inode, syscall.Errno) {
+	n.fs.lock.Lock()
+	defer n.fs.lock.Unlock()
+
+	absPath := n.childPath(name)
+	err := n.fs.driver.Mkdir(absPath, os.FileMode(mode).Perm())
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	return n.newChild(ctx, absPath, out)
+}
+
+func (n *node) Unlink(ctx context.Context, name string) syscall.Errno {
+	n.fs.lock.Lock()
+	defer n.fs.lock.Unlock()
+	return toErrno(n.fs.driver.Remove(n.childPath(name)))
+}
+
+func (n *node) Rmdir(ctx context.Context, name string) syscall.Errno {
+	n.fs.lock.Lock()
+	defer n.fs.lock.Unlock()
+	return toErrno(n.fs.driver.Remove(n.childPath(name)))
+}
+
+func (n *node) Symlink(
+	ctx context.Context,
+	target string,
+	name string,
+	out *gofuse.EntryOut,
+) (*fusefs.Inode, syscall.Errno) {
+	n.fs.lock.Lock()
+	defer n.fs.lock.Unlock()
+
+	absPath := n.childPath(name)
+	err := n.fs.driver.Symlink(target, absPath)
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	return n.newChild(ctx, absPath, out)
+}
+
+func (n *node) Link(
+	ctx context.Context,
+	target fusefs.InodeEmbedder,
+	name string,
+	out *gofuse.EntryOut,
+) (*fusefs.Inode, syscall.Errno) {
+	n.fs.lock.Lock()
+	defer n.fs.lock.Unlock()
+
+	absPath := n.childPath(name)
+	err := n.fs.driver.Link("/"+target.EmbeddedInode().Path(nil), absPath)
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	return n.newChild(ctx, absPath, out)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// fileHandle is a file opened by the host.
+type fileHandle struct {
+	node     *node
+	writable bool
+}
+
+var _ = (fusefs.FileReader)((*fileHandle)(nil))
+var _ = (fusefs.FileWriter)((*fileHandle)(nil))
+var _ = (fusefs.FileFsyncer)((*fileHandle)(nil))
+var _ = (fusefs.FileReleaser)((*fileHandle)(nil))
+
+// open opens the node's file, at `absPath`, for the host. The caller must hold
+// the lock.
+//
+// The driver file is opened for reading and writing if the image is writable,
+// since it's shared by all the host's handles; the kernel checks that each
+// handle is only used the way it was opened. The driver doesn't handle
+// [disko.O_TRUNC] itself, so it's done here.
+func (n *node) open(absPath string, flags disko.IOFlags) (*fileHandle, syscall.Errno) {
+	writable := flags.RequiresWritePerm()
+	if writable && !n.fs.writable {
+		return nil, syscall.EROFS
+	}
+
+	if n.file == nil {
+		sharedFlags := disko.O_RDONLY
+		if n.fs.writable {
+			sharedFlags = disko.O_RDWR
+		}
+
+		file, err := n.fs.driver.OpenFile(absPath, sharedFlags, 0)
+		if err != nil {
+			return nil, toErrno(err)
+		}
+		n.file = &file
+	}
+	n.openCount++
+
+	handle := &fileHandle{node: n, writable: writable}
+	if flags.Truncate() && writable {
+		err := n.file.Truncate(0)
+		if err != nil {
+			handle.release()
+			return nil, toErrno(err)
+		}
+	}
+	return handle, 0
+}
+
+// release drops the handle's reference to the node's file, closing the file if
+// it was the last one. The caller must hold the lock.
+func (handle *fileHandle) release() error {
+	n := handle.node
+	n.openCount--
+	if n.openCount > 0 {
+		return nil
+	}
+
+	err := n.file.Close()
+	n.file = nil
+	return err
+}
+
+func (handle *fileHandle) Read(ctx context.Context, dest []byte, off int64) (gofuse.ReadResult, syscall.Errno) {
+	handle.node.fs.lock.Lock()
+	defer handle.node.fs.lock.Unlock()
+
+	count, err := handle.node.file.ReadAt(dest, off)
+	if err != nil && err != io.EOF {
+		return nil, toErrno(err)
+	}
+	return gofuse.ReadResultData(dest[:count]), 0
+}
+
+func (handle *fileHandle) Write(ctx context.Context, data []byte, off int64) (uint32, syscall.Errno) {
+	handle.node.fs.lock.Lock()
+	defer handle.node.fs.lock.Unlock()
+
+	count, err := handle.node.file.WriteAt(data, off)
+	return uint32(count), toErrno(err)
+}
+
+// Fsync writes the file's data and the file system's metadata to the image.
+func (handle *fileHandle) Fsync(ctx context.Context, flags uint32) syscall.Errno {
+	fs := handle.node.fs
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	err := handle.node.file.Sync()
+	if err != nil {
+		return toErrno(err)
+	}
+	return toErrno(fs.driver.Flush())
+}
+
+// Release closes the handle once the host has no more references to it. Files
+// written to are flushed to the image once the last handle is closed, so that
+// an interrupted mount loses as little as possible.
+func (handle *fileHandle) Release(ctx context.Context) syscall.Errno {
+	fs := handle.node.fs
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	err := handle.release()
+	if err != nil {
+		return toErrno(err)
+	} else if handle.writable && handle.node.file == nil {
+		return toErrno(fs.driver.Flush())
+	}
+	return 0
+}
@@ -0,0 +1,83 @@
+package disko
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MountWarning describes a feature of an image that an implementation doesn't
+// support, and ignored because the image was mounted with [MountFlagsLenient].
+type MountWarning struct {
+	// Feature is a short description of the unsupported feature.
+	Feature string
+	// Err is the error that the mount would have failed with in strict mode.
+	Err DriverError
+}
+
+func (warning MountWarning) String() string {
+	return fmt.Sprintf("%s: %s", warning.Feature, warning.Err.Error())
+}
+
+// MountWarnings collects the warnings generated while an image is mounted.
+// Implementations should create one in [FileSystemImplementer.Mount] and
+// return its contents from [MountWarningsImplementer.MountWarnings].
+//
+// It's safe to use from multiple goroutines, so implementations that check
+// structures as they read them can report problems from a shared mount.
+type MountWarnings struct {
+	lenient  bool
+	lock     sync.Mutex
+	warnings []MountWarning
+}
+
+// NewMountWarnings creates an empty list of warnings for a mount with the given
+// flags.
+func NewMountWarnings(flags MountFlags) *MountWarnings {
+	return &MountWarnings{lenient: flags.IsLenient()}
+}
+
+// Unsupported reports that the image uses `feature`, which the implementation
+// doesn't support. If the mount is lenient, this records a warning and returns
+// nil, and the implementation should carry on without the feature. Otherwise it
+// returns `err` unchanged, and the implementation must fail.
+//
+// A warning identical to one already recorded isn't recorded again, so the
+// same problem can be reported each time the structure with it is read.
+func (warnings *MountWarnings) Unsupported(feature string, err DriverError) DriverError {
+	if !warnings.lenient {
+		return err
+	}
+
+	warnings.lock.Lock()
+	defer warnings.lock.Unlock()
+
+	warning := MountWarning{Feature: feature, Err: err}
+	for _, existing := range warnings.warnings {
+		if existing.String() == warning.String() {
+			return nil
+		}
+	}
+	warnings.warnings = append(warnings.warnings, warning)
+	return nil
+}
+
+// List returns all warnings recorded so far, in the order they were reported.
+func (warnings *MountWarnings) List() []MountWarning {
+	if warnings == nil {
+		return nil
+	}
+
+	warnings.lock.Lock()
+	defer warnings.lock.Unlock()
+	return append([]MountWarning(nil), warnings.warnings...)
+}
+
+// A MountWarningsImplementer reports the features of an image it ignored while
+// mounting it with [MountFlagsLenient].
+type MountWarningsImplementer interface {
+	// MountWarnings returns the warnings generated since the most recent call
+	// to [FileSystemImplementer.Mount]. Implementations that check structures
+	// as they're read may add to them after the mount. It's empty if the mount
+	// was strict.
+	MountWarnings() []MountWarning
+}
@@ -0,0 +1,39 @@
+package disko_test
+
+import (
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMountWarnings__Strict(t *testing.T) {
+	warnings := disko.NewMountWarnings(disko.MountFlagsAllowRead)
+	err := warnings.Unsupported("feature", disko.ErrNotSupported.WithMessage("asdf"))
+
+	assert.ErrorIs(t, err, disko.ErrNotSupported)
+	assert.Empty(t, warnings.List())
+}
+
+func TestMountWarnings__Lenient(t *testing.T) {
+	warnings := disko.NewMountWarnings(disko.MountFlagsAllowRead | disko.MountFlagsLenient)
+	err := warnings.Unsupported("feature", disko.ErrNotSupported.WithMessage("asdf"))
+
+	assert.NoError(t, err)
+	if assert.Len(t, warnings.List(), 1) {
+		warning := warnings.List()[0]
+		assert.Equal(t, "feature", warning.Feature)
+		assert.ErrorIs(t, warning.Err, disko.ErrNotSupported)
+		assert.Equal(t, "feature: Operation not supported: asdf", warning.String())
+	}
+}
+
+// Reporting the same problem again doesn't add another warning.
+func TestMountWarnings__Duplicates(t *testing.T) {
+	warnings := disko.NewMountWarnings(disko.MountFlagsLenient)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, warnings.Unsupported("a", disko.ErrFileSystemCorrupted.WithMessage("x")))
+		assert.NoError(t, warnings.Unsupported("a", disko.ErrFileSystemCorrupted.WithMessage("y")))
+	}
+	assert.Len(t, warnings.List(), 2)
+}
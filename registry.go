@@ -0,0 +1,319 @@
+package disko
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// HeaderField is a single decoded field from a file system's on-disk header,
+// such as a boot sector or superblock.
+type HeaderField struct {
+	Name  string `json:"name"`
+	Value any    `json:"value"`
+}
+
+// ImageDescription is the information a driver can get from an image without
+// mounting it.
+type ImageDescription struct {
+	// Stat gives the same information [FileSystemImplementer.FSStat] would
+	// return if the image were mounted. Fields the driver can't determine
+	// without mounting must be left zeroed.
+	Stat FSStat
+
+	// Header lists the fields of the file system's header(s), in on-disk order
+	// where that makes sense.
+	Header []HeaderField
+}
+
+// LayoutRegion is a range of bytes in an image with a known purpose, such as a
+// copy of the FAT or a single directory entry. Regions may nest.
+type LayoutRegion struct {
+	// Offset is the position of the first byte of the region in the image.
+	Offset int64
+
+	// Length is the size of the region, in bytes.
+	Length int64
+
+	// Name says what the region is, e.g. "FAT copy 1".
+	Name string
+
+	// Details is an optional human-readable decoding of the region's contents,
+	// e.g. the name, size, and first cluster of a directory entry.
+	Details string
+}
+
+// RegistrationAPIVersion is the version of the interface drivers are written
+// against: [FileSystemRegistration], [FileSystemImplementer], and the
+// interfaces they use. It's increased whenever a change would break drivers
+// maintained outside this module.
+const RegistrationAPIVersion = 1
+
+// FileSystemRegistration describes a file system driver so that images can be
+// identified and opened without the caller knowing the format in advance.
+// Drivers register themselves with [RegisterFileSystem] in an init function,
+// so programs only need to import the driver packages they want to support.
+type FileSystemRegistration struct {
+	// APIVersion is the [RegistrationAPIVersion] the driver was written for.
+	// Drivers in this module leave it 0, meaning the current version. Drivers
+	// maintained elsewhere should set it so that they're rejected by versions
+	// of disko they aren't compatible with, rather than misbehaving.
+	APIVersion int
+
+	// Name is a short, unique, lowercase identifier for the file system, e.g.
+	// "fat8". It's what users type on the command line.
+	Name string
+
+	// Description is a human-readable name for the file system.
+	Description string
+
+	// Features gives the features the file system supports. This must be the
+	// same as what [FileSystemImplementer.GetFSFeatures] returns. It's
+	// available without opening an image, so callers that only need the
+	// features should use this rather than creating an implementation.
+	Features FSFeatures
+
+	// Detect returns true if `image`, which is `size` bytes long, appears to
+	// contain this file system. It must not modify the image, and should only
+	// read as much of it as needed to make a reasonable determination.
+	Detect func(image io.ReaderAt, size int64) bool
+
+	// HasSignature is true if Detect looks for a magic number or similar
+	// structure that's unlikely to appear by chance, rather than relying on
+	// things like the size of the image. Only these file systems are searched
+	// for at nonzero offsets by [DetectWithOffset].
+	HasSignature bool
+
+	// Describe decodes information from the image without mounting it.
+	// Optional.
+	Describe func(image io.ReaderAt, size int64) (ImageDescription, DriverError)
+
+	// Layout returns the regions of the image with a structural meaning, in
+	// any order. It's intended for debugging tools, so it should decode as much
+	// as it reasonably can, even from a damaged image. Optional.
+	Layout func(image io.ReaderAt, size int64) ([]LayoutRegion, DriverError)
+
+	// New creates a [FileSystemImplementer] for an image. Optional; it's nil
+	// for drivers that can't mount images yet.
+	New ImplementerConstructor
+}
+
+var registryLock sync.RWMutex
+var registry = map[string]FileSystemRegistration{}
+
+// RegisterFileSystem makes a file system driver available to [Detect] and
+// [LookUpFileSystem]. It panics if [TryRegisterFileSystem] fails.
+func RegisterFileSystem(registration FileSystemRegistration) {
+	err := TryRegisterFileSystem(registration)
+	if err != nil {
+		panic(err.Error())
+	}
+}
+
+// TryRegisterFileSystem is like [RegisterFileSystem], but returns an error
+// instead of panicking. It fails if the registration has no name or detection
+// function, was written for a different [RegistrationAPIVersion], or if a
+// driver with the same name is already registered. It's meant for drivers
+// loaded at run time, where a bad driver shouldn't crash the program.
+func TryRegisterFileSystem(registration FileSystemRegistration) error {
+	if registration.Name == "" || registration.Detect == nil {
+		return ErrInvalidArgument.WithMessage(
+			"file system registration must have a name and a detection function")
+	}
+	if registration.APIVersion != 0 && registration.APIVersion != RegistrationAPIVersion {
+		return ErrNotSupported.WithMessage(
+			fmt.Sprintf(
+				"file system %q was written for driver API version %d, but this is version %d",
+				registration.Name,
+				registration.APIVersion,
+				RegistrationAPIVersion,
+			),
+		)
+	}
+
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if _, exists := registry[registration.Name]; exists {
+		return ErrExists.WithMessage(
+			fmt.Sprintf("file system %q is already registered", registration.Name))
+	}
+	registry[registration.Name] = registration
+	return nil
+}
+
+// LookUpFileSystem returns the registration for the file system with the given
+// name.
+func LookUpFileSystem(name string) (FileSystemRegistration, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	registration, ok := registry[name]
+	return registration, ok
+}
+
+// RegisteredFileSystems returns the registrations of all known file systems,
+// sorted by name.
+func RegisteredFileSystems() []FileSystemRegistration {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	registrations := make([]FileSystemRegistration, 0, len(registry))
+	for _, registration := range registry {
+		registrations = append(registrations, registration)
+	}
+	sort.Slice(
+		registrations,
+		func(i, j int) bool { return registrations[i].Name < registrations[j].Name },
+	)
+	return registrations
+}
+
+// Detect returns the registrations of all file systems that `image` appears to
+// contain, sorted by name. The result is empty if the format couldn't be
+// determined. More than one match is possible for formats that don't have a
+// reliable signature, so callers should be prepared to ask the user.
+func Detect(image io.ReaderAt, size int64) []FileSystemRegistration {
+	matches := []FileSystemRegistration{}
+	for _, registration := range RegisteredFileSystems() {
+		if registration.Detect(image, size) {
+			matches = append(matches, registration)
+		}
+	}
+	return matches
+}
+
+// DetectWithOffset is like [Detect], but also handles images with junk in front
+// of the file system, such as a loader or copy protection data. If nothing is
+// found at the beginning of the image, the file systems with a signature are
+// searched for at every multiple of `alignment` bytes up to and including
+// `maxOffset`. It returns the lowest offset anything was found at, and the
+// registrations of what was found there.
+func DetectWithOffset(
+	image io.ReaderAt,
+	size int64,
+	maxOffset int64,
+	alignment int64,
+) (int64, []FileSystemRegistration) {
+	matches := Detect(image, size)
+	if len(matches) != 0 || alignment <= 0 {
+		return 0, matches
+	}
+
+	candidates := []FileSystemRegistration{}
+	for _, registration := range RegisteredFileSystems() {
+		if registration.HasSignature {
+			candidates = append(candidates, registration)
+		}
+	}
+
+	for offset := alignment; offset <= maxOffset && offset < size; offset += alignment {
+		for _, registration := range candidates {
+			if registration.DetectAt(image, size, offset) {
+				matches = append(matches, registration)
+			}
+		}
+		if len(matches) != 0 {
+			return offset, matches
+		}
+	}
+	return 0, matches
+}
+
+// FindOffset returns the lowest multiple of `alignment` bytes, up to and
+// including `maxOffset`, at which `image` appears to contain this file system.
+// Unlike [DetectWithOffset], it doesn't matter whether the file system has a
+// signature.
+func (registration FileSystemRegistration) FindOffset(
+	image io.ReaderAt,
+	size int64,
+	maxOffset int64,
+	alignment int64,
+) (int64, bool) {
+	if alignment <= 0 {
+		return 0, registration.Detect(image, size)
+	}
+	for offset := int64(0); offset <= maxOffset && offset < size; offset += alignment {
+		if registration.DetectAt(image, size, offset) {
+			return offset, true
+		}
+	}
+	return 0, false
+}
+
+// DetectAt returns true if the part of `image` starting at byte `offset`
+// appears to contain this file system. `size` is the size of the whole image.
+func (registration FileSystemRegistration) DetectAt(
+	image io.ReaderAt,
+	size int64,
+	offset int64,
+) bool {
+	return registration.Detect(io.NewSectionReader(image, offset, size-offset), size-offset)
+}
+
+// EmbeddedImage is a file system found inside another file by
+// [FindEmbeddedImages].
+type EmbeddedImage struct {
+	// Offset is the position of the file system in the file, in bytes.
+	Offset int64
+
+	// Size is the number of bytes of storage the file system reports with
+	// [FileSystemRegistration.Describe], or 0 if none of the drivers can tell
+	// without mounting it. This may not include metadata such as a FAT, so the
+	// image can be somewhat larger.
+	Size int64
+
+	// FileSystems are the registrations of the file systems detected at
+	// Offset, sorted by name.
+	FileSystems []FileSystemRegistration
+}
+
+// FindEmbeddedImages searches all of `file` for file systems with a signature,
+// at every multiple of `alignment` bytes. It's meant for files that contain
+// disk images at fixed offsets, such as emulator save states and ROM packs.
+// Only file systems with a signature are searched for, since the others would
+// match almost anywhere.
+//
+// The candidates are returned in order of increasing offset. Images nested in
+// other images are all returned, as are false positives that happen to look
+// like a signature, so callers should be prepared to let the user choose. A
+// candidate can be mounted through a window onto the file beginning at its
+// offset, such as the one returned by disks.NewWindow.
+func FindEmbeddedImages(file io.ReaderAt, size int64, alignment int64) []EmbeddedImage {
+	if alignment <= 0 {
+		alignment = 1
+	}
+
+	candidates := []FileSystemRegistration{}
+	for _, registration := range RegisteredFileSystems() {
+		if registration.HasSignature {
+			candidates = append(candidates, registration)
+		}
+	}
+
+	found := []EmbeddedImage{}
+	for offset := int64(0); offset < size; offset += alignment {
+		embedded := EmbeddedImage{Offset: offset}
+		for _, registration := range candidates {
+			if !registration.DetectAt(file, size, offset) {
+				continue
+			}
+
+			embedded.FileSystems = append(embedded.FileSystems, registration)
+			if embedded.Size == 0 && registration.Describe != nil {
+				section := io.NewSectionReader(file, offset, size-offset)
+				description, err := registration.Describe(section, size-offset)
+				if err == nil {
+					embedded.Size = int64(description.Stat.TotalBlocks) *
+						int64(description.Stat.BlockSize)
+				}
+			}
+		}
+
+		if len(embedded.FileSystems) != 0 {
+			found = append(found, embedded)
+		}
+	}
+	return found
+}
@@ -0,0 +1,146 @@
+package disko_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterFileSystem__DetectAndLookUp(t *testing.T) {
+	disko.RegisterFileSystem(
+		disko.FileSystemRegistration{
+			Name: "test-magic",
+			Detect: func(image io.ReaderAt, size int64) bool {
+				magic := make([]byte, 4)
+				_, err := image.ReadAt(magic, 0)
+				return err == nil && string(magic) == "MAGC"
+			},
+		},
+	)
+
+	registration, ok := disko.LookUpFileSystem("test-magic")
+	require.True(t, ok, "registered file system not found")
+	assert.Equal(t, "test-magic", registration.Name)
+
+	image := []byte("MAGC and then some data")
+	matches := disko.Detect(bytes.NewReader(image), int64(len(image)))
+	require.Len(t, matches, 1)
+	assert.Equal(t, "test-magic", matches[0].Name)
+
+	image = []byte("nothing recognizable")
+	assert.Empty(t, disko.Detect(bytes.NewReader(image), int64(len(image))))
+}
+
+func TestRegisterFileSystem__DuplicatePanics(t *testing.T) {
+	registration := disko.FileSystemRegistration{
+		Name:   "test-duplicate",
+		Detect: func(io.ReaderAt, int64) bool { return false },
+	}
+	disko.RegisterFileSystem(registration)
+	assert.Panics(t, func() { disko.RegisterFileSystem(registration) })
+	assert.ErrorIs(t, disko.TryRegisterFileSystem(registration), disko.ErrExists)
+}
+
+func TestTryRegisterFileSystem__APIVersion(t *testing.T) {
+	registration := disko.FileSystemRegistration{
+		Name:       "test-future",
+		APIVersion: disko.RegistrationAPIVersion + 1,
+		Detect:     func(io.ReaderAt, int64) bool { return false },
+	}
+	err := disko.TryRegisterFileSystem(registration)
+	assert.ErrorIs(t, err, disko.ErrNotSupported)
+	_, ok := disko.LookUpFileSystem("test-future")
+	assert.False(t, ok, "incompatible file system was registered")
+
+	registration.APIVersion = disko.RegistrationAPIVersion
+	require.NoError(t, disko.TryRegisterFileSystem(registration))
+	_, ok = disko.LookUpFileSystem("test-future")
+	assert.True(t, ok, "registered file system not found")
+}
+
+func TestDetectWithOffset__Basic(t *testing.T) {
+	hasMagic := func(image io.ReaderAt, size int64) bool {
+		magic := make([]byte, 4)
+		_, err := image.ReadAt(magic, 0)
+		return err == nil && string(magic) == "OFST"
+	}
+	disko.RegisterFileSystem(
+		disko.FileSystemRegistration{
+			Name:         "test-offset",
+			Detect:       hasMagic,
+			HasSignature: true,
+		},
+	)
+
+	image := make([]byte, 1024)
+	copy(image[384:], "OFST")
+
+	offset, matches := disko.DetectWithOffset(bytes.NewReader(image), 1024, 512, 128)
+	require.Len(t, matches, 1)
+	assert.Equal(t, "test-offset", matches[0].Name)
+	assert.EqualValues(t, 384, offset)
+
+	// Not aligned, or past the maximum offset.
+	_, matches = disko.DetectWithOffset(bytes.NewReader(image), 1024, 512, 256)
+	assert.Empty(t, matches)
+	_, matches = disko.DetectWithOffset(bytes.NewReader(image), 1024, 256, 128)
+	assert.Empty(t, matches)
+}
+
+func TestFindOffset__NoSignature(t *testing.T) {
+	// Detection depends on the size of the image, so there's no signature.
+	registration := disko.FileSystemRegistration{
+		Name:   "test-find-offset",
+		Detect: func(image io.ReaderAt, size int64) bool { return size == 512 },
+	}
+
+	image := bytes.NewReader(make([]byte, 1024))
+	offset, found := registration.FindOffset(image, 1024, 1024, 128)
+	assert.True(t, found)
+	assert.EqualValues(t, 512, offset)
+
+	_, found = registration.FindOffset(image, 1024, 256, 128)
+	assert.False(t, found)
+}
+
+func TestFindEmbeddedImages__Basic(t *testing.T) {
+	disko.RegisterFileSystem(
+		disko.FileSystemRegistration{
+			Name: "test-embedded",
+			Detect: func(image io.ReaderAt, size int64) bool {
+				magic := make([]byte, 4)
+				_, err := image.ReadAt(magic, 0)
+				return err == nil && string(magic) == "EMBD"
+			},
+			HasSignature: true,
+			Describe: func(image io.ReaderAt, size int64) (disko.ImageDescription, disko.DriverError) {
+				return disko.ImageDescription{
+					Stat: disko.FSStat{BlockSize: 128, TotalBlocks: 2},
+				}, nil
+			},
+		},
+	)
+
+	file := make([]byte, 4096)
+	copy(file[512:], "EMBD")
+	copy(file[2048:], "EMBD")
+	copy(file[3000:], "EMBD") // Not aligned.
+
+	found := []disko.EmbeddedImage{}
+	for _, embedded := range disko.FindEmbeddedImages(bytes.NewReader(file), 4096, 512) {
+		for _, registration := range embedded.FileSystems {
+			if registration.Name == "test-embedded" {
+				found = append(found, embedded)
+			}
+		}
+	}
+
+	require.Len(t, found, 2)
+	assert.EqualValues(t, 512, found[0].Offset)
+	assert.EqualValues(t, 256, found[0].Size)
+	assert.EqualValues(t, 2048, found[1].Offset)
+}
@@ -14,7 +14,7 @@ import (
 
 // Create an image with the given number of blocks and bytes per block. It is
 // guaranteed to either return a valid slice or fail the test and abort.
-func CreateRandomImage(bytesPerBlock, totalBlocks uint, t *testing.T) []byte {
+func CreateRandomImage(bytesPerBlock, totalBlocks uint, t testing.TB) []byte {
 	backingData := make([]byte, bytesPerBlock*totalBlocks)
 
 	_, err := rand.Read(backingData)
@@ -41,7 +41,7 @@ func CreateRandomImage(bytesPerBlock, totalBlocks uint, t *testing.T) []byte {
 //   - backingData: Optional. A byte slice of at least `bytesPerBlock * totalBlocks`
 //     that is used as the underlying storage the cache sits on top of. You can
 //     pass `nil` for this to get completely random data.
-//   - `t`: The testing fixture.
+//   - `t`: The testing fixture. Benchmarks can pass their [testing.B] here.
 //
 // The fetch and flush handlers generated for the cache check bounds and
 // permissions for you, and fail with an appropriate error message. This means
@@ -52,7 +52,7 @@ func CreateDefaultCache(
 	totalBlocks uint,
 	writable bool,
 	backingData []byte,
-	t *testing.T,
+	t testing.TB,
 ) *blockcache.BlockCache {
 	if backingData == nil {
 		backingData = CreateRandomImage(bytesPerBlock, totalBlocks, t)
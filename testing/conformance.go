@@ -0,0 +1,707 @@
+package testing
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/dargueta/disko"
+	c "github.com/dargueta/disko/file_systems/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xaionaro-go/bytesextra"
+)
+
+// Names of the objects the conformance tests create. They're valid on every
+// file system this module supports, including ones with 8.3 names.
+const (
+	conformanceFileName = "TESTFILE.TXT"
+	conformanceLinkName = "TESTLINK.TXT"
+	conformanceDirName  = "TESTDIR"
+)
+
+// RunImplementerConformanceTests checks that the implementations created by
+// `constructor` follow the contract of [disko.FileSystemImplementer] and the
+// optional interfaces they implement, so driver authors don't have to write
+// their own tests for it.
+//
+// Each test calls `constructor` on a fresh copy of `image`, which should be an
+// empty, formatted image. If it already has files in the root directory,
+// they're read and checked too. Tests that modify the image are skipped if the
+// implementation is read-only.
+func RunImplementerConformanceTests(
+	t *testing.T,
+	constructor disko.ImplementerConstructor,
+	image []byte,
+) {
+	conformanceSuite{constructor: constructor, image: image}.run(t)
+}
+
+// RunReadOnlyConformanceTests is like [RunImplementerConformanceTests] for
+// implementations that can only read images. It also checks that they refuse
+// to be mounted for writing.
+func RunReadOnlyConformanceTests(
+	t *testing.T,
+	constructor disko.ImplementerConstructor,
+	image []byte,
+) {
+	conformanceSuite{constructor: constructor, image: image, readOnly: true}.run(t)
+}
+
+// RunDetectConformanceTests checks that `detect`, a detection function for
+// [disko.FileSystemRegistration], recognizes `image`. It must reject a blank
+// image of the same size, and each image in `notImages`, which maps a
+// description of the image to its contents.
+func RunDetectConformanceTests(
+	t *testing.T,
+	detect func(image io.ReaderAt, size int64) bool,
+	image []byte,
+	notImages map[string][]byte,
+) {
+	assert.True(t, detect(bytes.NewReader(image), int64(len(image))), "image not detected")
+
+	blank := make([]byte, len(image))
+	assert.False(t, detect(bytes.NewReader(blank), int64(len(blank))), "blank image detected")
+	for description, notImage := range notImages {
+		assert.False(
+			t, detect(bytes.NewReader(notImage), int64(len(notImage))), "detected %s", description)
+	}
+}
+
+// MountImplementer creates an implementation for `image` with `constructor`
+// and mounts it with `flags`. Changes are written to `image` itself. It's
+// unmounted when the test finishes.
+func MountImplementer(
+	t *testing.T,
+	constructor disko.ImplementerConstructor,
+	image []byte,
+	flags disko.MountFlags,
+) disko.FileSystemImplementer {
+	implementation, err := constructor(bytesextra.NewReadWriteSeeker(image))
+	require.NoError(t, err)
+	require.NoError(t, implementation.Mount(flags))
+	t.Cleanup(func() { implementation.Unmount() })
+	return implementation
+}
+
+type conformanceSuite struct {
+	constructor disko.ImplementerConstructor
+	image       []byte
+	readOnly    bool
+}
+
+func (suite conformanceSuite) run(t *testing.T) {
+	t.Run("Features", suite.testFeatures)
+	t.Run("MountAndUnmount", suite.testMountAndUnmount)
+	t.Run("MountReadWrite", suite.testMountReadWrite)
+	t.Run("RootDirectory", suite.testRootDirectory)
+	t.Run("ExistingObjects", suite.testExistingObjects)
+	t.Run("CreateAndGetObject", suite.testCreateAndGetObject)
+	t.Run("WriteAndReadBack", suite.testWriteAndReadBack)
+	t.Run("Resize", suite.testResize)
+	t.Run("Unlink", suite.testUnlink)
+	t.Run("Directories", suite.testDirectories)
+	t.Run("Chmod", suite.testChmod)
+	t.Run("Chown", suite.testChown)
+	t.Run("Chtimes", suite.testChtimes)
+	t.Run("HardLinks", suite.testHardLinks)
+}
+
+// newStream returns a stream over a new copy of the suite's image.
+func (suite conformanceSuite) newStream() io.ReadWriteSeeker {
+	return bytesextra.NewReadWriteSeeker(bytes.Clone(suite.image))
+}
+
+// construct creates an implementation for `stream` without mounting it.
+func (suite conformanceSuite) construct(
+	t *testing.T,
+	stream io.ReadWriteSeeker,
+) disko.FileSystemImplementer {
+	_, err := stream.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	implementation, driverErr := suite.constructor(stream)
+	require.NoError(t, driverErr)
+	return implementation
+}
+
+// mountReadOnly creates an implementation for a new copy of the image and
+// mounts it for reading. It's unmounted when the test finishes.
+func (suite conformanceSuite) mountReadOnly(t *testing.T) disko.FileSystemImplementer {
+	return MountImplementer(
+		t, suite.constructor, bytes.Clone(suite.image), disko.MountFlagsAllowRead)
+}
+
+// mountWritable is like [conformanceSuite.mountReadOnly] but mounts with all
+// permissions, and skips the test if the implementation is read-only. The
+// stream is returned so that the test can mount the image again.
+func (suite conformanceSuite) mountWritable(
+	t *testing.T,
+) (disko.FileSystemImplementer, io.ReadWriteSeeker) {
+	stream := suite.newStream()
+	implementation := suite.construct(t, stream)
+	err := implementation.Mount(disko.MountFlagsAllowAll)
+	if errors.Is(err, disko.ErrReadOnlyFileSystem) {
+		t.Skip("implementation is read-only")
+	}
+	require.NoError(t, err)
+	return implementation, stream
+}
+
+// createObject creates an object in `parent`, skipping the test if the
+// implementation turns out to be read-only.
+func createObject(
+	t *testing.T,
+	implementation disko.FileSystemImplementer,
+	name string,
+	parent disko.ObjectHandle,
+	perm os.FileMode,
+) disko.ObjectHandle {
+	object, err := implementation.CreateObject(name, parent, perm)
+	if errors.Is(err, disko.ErrReadOnlyFileSystem) {
+		t.Skip("implementation is read-only")
+	}
+	require.NoError(t, err, "failed to create %q", name)
+	t.Cleanup(func() { object.Close() })
+	return object
+}
+
+// listDir returns the names of the entries in `directory` other than "." and
+// "..", sorted. It checks that the directory can be listed with at least one
+// of [disko.SupportsListDirHandle] and [disko.SupportsDirIterHandle], and that
+// they agree if it implements both.
+func listDir(t *testing.T, directory disko.ObjectHandle) []string {
+	var listed, iterated []string
+	lister, canList := directory.(disko.SupportsListDirHandle)
+	if canList {
+		names, err := lister.ListDir()
+		require.NoError(t, err)
+		listed = withoutDotEntries(names)
+	}
+
+	iterable, canIterate := directory.(disko.SupportsDirIterHandle)
+	if canIterate {
+		iterator, err := iterable.OpenDirIter()
+		require.NoError(t, err)
+		for {
+			name, err := iterator.Next()
+			if err == io.EOF {
+				assert.Empty(t, name, "Next() must return an empty name with io.EOF")
+				break
+			}
+			require.NoError(t, err)
+			iterated = append(iterated, name)
+		}
+		require.NoError(t, iterator.Close())
+		iterated = withoutDotEntries(iterated)
+	}
+
+	require.True(
+		t,
+		canList || canIterate,
+		"directory %q implements neither SupportsListDirHandle nor SupportsDirIterHandle",
+		directory.Name(),
+	)
+	if canList && canIterate {
+		assert.Equal(t, listed, iterated, "ListDir() and OpenDirIter() disagree")
+	}
+	if canList {
+		return listed
+	}
+	return iterated
+}
+
+func withoutDotEntries(names []string) []string {
+	result := []string{}
+	for _, name := range names {
+		if name != "." && name != ".." {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// readObject reads the entire contents of `object` with
+// [disko.ObjectHandle.ReadBlocks]. If the object implements
+// [disko.SupportsExtentIOHandle] or [disko.SupportsHolesHandle], it also
+// checks that they're consistent with ReadBlocks.
+func readObject(t *testing.T, object disko.ObjectHandle) []byte {
+	stat := object.Stat()
+	blockSize := int(stat.BlockSize)
+	require.Positive(t, blockSize, "%q has no block size", object.Name())
+	if stat.Size == 0 {
+		return []byte{}
+	}
+
+	totalBlocks := (int(stat.Size) + blockSize - 1) / blockSize
+	data := make([]byte, totalBlocks*blockSize)
+	require.NoError(t, object.ReadBlocks(0, data))
+
+	if holes, ok := object.(disko.SupportsHolesHandle); ok {
+		zeroes := make([]byte, blockSize)
+		for i := 0; i < totalBlocks; i++ {
+			if holes.IsHole(c.LogicalBlock(i)) {
+				assert.Equal(
+					t, zeroes, data[i*blockSize:(i+1)*blockSize], "block %d is a hole", i)
+			}
+		}
+	}
+
+	if extents, ok := object.(disko.SupportsExtentIOHandle); ok {
+		// Read every other block, so that the ranges aren't contiguous.
+		ranges := []disko.BlockRange{}
+		for i := 0; i < totalBlocks; i += 2 {
+			ranges = append(
+				ranges,
+				disko.BlockRange{Start: c.LogicalBlock(i), Data: make([]byte, blockSize)},
+			)
+		}
+		require.NoError(t, extents.ReadExtents(ranges))
+		for _, blockRange := range ranges {
+			start := int(blockRange.Start) * blockSize
+			assert.Equal(
+				t,
+				data[start:start+blockSize],
+				blockRange.Data,
+				"ReadExtents() and ReadBlocks() disagree on block %d",
+				blockRange.Start,
+			)
+		}
+	}
+	return data[:stat.Size]
+}
+
+// patternData returns `size` bytes that don't repeat with a period of a block,
+// so that misplaced blocks are noticed.
+func patternData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func (suite conformanceSuite) testFeatures(t *testing.T) {
+	implementation := suite.construct(t, suite.newStream())
+	before := implementation.GetFSFeatures()
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowRead))
+	defer implementation.Unmount()
+
+	assert.Equal(
+		t,
+		before,
+		implementation.GetFSFeatures(),
+		"GetFSFeatures() must not depend on whether the image is mounted",
+	)
+	if before.MaxTotalBlocks != 0 {
+		assert.LessOrEqual(t, before.MinTotalBlocks, before.MaxTotalBlocks)
+	}
+}
+
+func (suite conformanceSuite) testMountAndUnmount(t *testing.T) {
+	implementation := suite.construct(t, suite.newStream())
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowRead))
+
+	fsStat := implementation.FSStat()
+	assert.Equal(t, fsStat, implementation.FSStat(), "FSStat() changed without modifications")
+	assert.NotZero(t, fsStat.BlockSize, "FSStat() has no block size")
+	assert.LessOrEqual(t, fsStat.BlocksFree, fsStat.TotalBlocks)
+	assert.LessOrEqual(t, fsStat.BlocksAvailable, fsStat.BlocksFree)
+
+	require.NoError(t, implementation.Flush())
+	require.NoError(t, implementation.Unmount())
+}
+
+// Implementations that can't write images must say so when they're mounted
+// for writing, and still be usable for reading afterwards.
+func (suite conformanceSuite) testMountReadWrite(t *testing.T) {
+	implementation := suite.construct(t, suite.newStream())
+	err := implementation.Mount(disko.MountFlagsAllowAll)
+	if suite.readOnly {
+		require.ErrorIs(t, err, disko.ErrReadOnlyFileSystem)
+	} else if !errors.Is(err, disko.ErrReadOnlyFileSystem) {
+		require.NoError(t, err)
+		require.NoError(t, implementation.Unmount())
+		return
+	}
+
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowRead))
+	assert.NotNil(t, implementation.GetRootDirectory())
+	require.NoError(t, implementation.Unmount())
+}
+
+func (suite conformanceSuite) testRootDirectory(t *testing.T) {
+	implementation := suite.mountReadOnly(t)
+	root := implementation.GetRootDirectory()
+	require.NotNil(t, root)
+
+	assert.Equal(t, "/", root.Name(), "the root directory must be named \"/\"")
+	stat := root.Stat()
+	assert.True(t, stat.IsDir(), "the root directory isn't a directory")
+	assert.True(t, root.SameAs(implementation.GetRootDirectory()))
+	listDir(t, root)
+}
+
+func (suite conformanceSuite) testExistingObjects(t *testing.T) {
+	implementation := suite.mountReadOnly(t)
+	root := implementation.GetRootDirectory()
+	names := listDir(t, root)
+	if len(names) == 0 {
+		t.Skip("the image is empty")
+	}
+
+	for _, name := range names {
+		object, err := implementation.GetObject(name, root)
+		require.NoError(t, err, "failed to get %q", name)
+		assert.Equal(t, name, object.Name())
+		assert.False(t, object.SameAs(root), "%q is the same as the root directory", name)
+
+		again, err := implementation.GetObject(name, root)
+		require.NoError(t, err)
+		assert.True(t, object.SameAs(again), "two handles for %q aren't the same", name)
+
+		stat := object.Stat()
+		assert.Equal(t, stat, again.Stat(), "two handles for %q have different stats", name)
+		assert.NotZero(t, stat.Nlinks, "%q has no links", name)
+		if stat.IsFile() {
+			data := readObject(t, object)
+			assert.Len(t, data, int(stat.Size))
+		} else if stat.IsDir() {
+			listDir(t, object)
+		}
+
+		checkXattrs(t, object)
+		checkObjectID(t, implementation, object)
+
+		require.NoError(t, again.Close())
+		require.NoError(t, object.Close())
+		assert.ErrorIs(
+			t,
+			object.Close(),
+			disko.ErrFileDescriptorBadState,
+			"closing %q twice must fail",
+			name,
+		)
+		assert.True(t, object.SameAs(again), "SameAs() must work on closed handles")
+	}
+}
+
+// checkXattrs checks an object's extended attributes if it has any.
+func checkXattrs(t *testing.T, object disko.ObjectHandle) {
+	xattrs, ok := object.(disko.SupportsXattrHandle)
+	if !ok {
+		return
+	}
+
+	names, err := xattrs.ListXattrs()
+	require.NoError(t, err)
+	assert.True(t, sort.StringsAreSorted(names), "ListXattrs() must be sorted")
+	for _, name := range names {
+		_, err := xattrs.GetXattr(name)
+		assert.NoError(t, err, "failed to get listed attribute %q", name)
+	}
+
+	_, err = xattrs.GetXattr("conformance.nonexistent")
+	assert.ErrorIs(t, err, disko.ErrNotFound)
+}
+
+// checkObjectID checks that an object can be found by its inode number if the
+// implementation supports it.
+func checkObjectID(
+	t *testing.T,
+	implementation disko.FileSystemImplementer,
+	object disko.ObjectHandle,
+) {
+	byID, ok := implementation.(disko.ObjectIDImplementer)
+	if !ok {
+		return
+	}
+
+	found, err := byID.GetObjectByID(object.Stat().InodeNumber)
+	require.NoError(t, err, "failed to get %q by ID", object.Name())
+	assert.True(t, found.SameAs(object), "GetObjectByID() returned a different object")
+	found.Close()
+}
+
+func (suite conformanceSuite) testCreateAndGetObject(t *testing.T) {
+	implementation, _ := suite.mountWritable(t)
+	defer implementation.Unmount()
+	root := implementation.GetRootDirectory()
+	namesBefore := listDir(t, root)
+
+	created := createObject(t, implementation, conformanceFileName, root, 0o644)
+	assert.Equal(t, conformanceFileName, created.Name())
+	stat := created.Stat()
+	assert.True(t, stat.IsFile(), "created a %s instead of a file", stat.ModeFlags.Type())
+	assert.Zero(t, stat.Size, "new files must be empty")
+
+	object, err := implementation.GetObject(conformanceFileName, root)
+	require.NoError(t, err)
+	defer object.Close()
+	assert.True(t, object.SameAs(created), "GetObject() returned a different object")
+	assert.False(t, object.SameAs(root))
+	assert.Equal(t, conformanceFileName, object.Name())
+
+	expectedNames := append(namesBefore, conformanceFileName)
+	sort.Strings(expectedNames)
+	assert.Equal(t, expectedNames, listDir(t, root))
+	checkObjectID(t, implementation, object)
+}
+
+func (suite conformanceSuite) testWriteAndReadBack(t *testing.T) {
+	implementation, stream := suite.mountWritable(t)
+	root := implementation.GetRootDirectory()
+	object := createObject(t, implementation, conformanceFileName, root, 0o644)
+
+	blockSize := int(object.Stat().BlockSize)
+	require.Positive(t, blockSize)
+	size := 3*blockSize - 10
+	contents := patternData(size)
+
+	require.NoError(t, object.Resize(uint64(size)))
+	assert.EqualValues(t, size, object.Stat().Size)
+	buffer := make([]byte, 3*blockSize)
+	copy(buffer, contents)
+	require.NoError(t, object.WriteBlocks(0, buffer))
+	assert.Equal(t, contents, readObject(t, object))
+
+	// Zeroing out a block mustn't affect the ones around it.
+	require.NoError(t, object.ZeroOutBlocks(1, 1))
+	copy(contents[blockSize:2*blockSize], make([]byte, blockSize))
+	assert.Equal(t, contents, readObject(t, object))
+	assert.EqualValues(t, size, object.Stat().Size, "ZeroOutBlocks() changed the size")
+
+	// Everything must still be there after mounting the image again.
+	require.NoError(t, implementation.Flush())
+	require.NoError(t, object.Close())
+	require.NoError(t, implementation.Unmount())
+
+	implementation = suite.construct(t, stream)
+	require.NoError(t, implementation.Mount(disko.MountFlagsAllowRead))
+	defer implementation.Unmount()
+
+	object, err := implementation.GetObject(conformanceFileName, implementation.GetRootDirectory())
+	require.NoError(t, err, "file is missing after remounting")
+	defer object.Close()
+	assert.Equal(t, contents, readObject(t, object), "contents changed after remounting")
+}
+
+func (suite conformanceSuite) testResize(t *testing.T) {
+	implementation, _ := suite.mountWritable(t)
+	defer implementation.Unmount()
+	object := createObject(
+		t, implementation, conformanceFileName, implementation.GetRootDirectory(), 0o644)
+
+	blockSize := int(object.Stat().BlockSize)
+	freeBefore := implementation.FSStat().BlocksFree
+
+	require.NoError(t, object.Resize(uint64(4*blockSize)))
+	assert.EqualValues(t, 4*blockSize, object.Stat().Size)
+	assert.Less(
+		t, implementation.FSStat().BlocksFree, freeBefore, "growing a file must use space")
+
+	contents := patternData(4 * blockSize)
+	require.NoError(t, object.WriteBlocks(0, contents))
+
+	// Shrinking keeps the data before the new end.
+	require.NoError(t, object.Resize(uint64(blockSize+1)))
+	assert.EqualValues(t, blockSize+1, object.Stat().Size)
+	assert.Equal(t, contents[:blockSize+1], readObject(t, object))
+
+	require.NoError(t, object.Resize(0))
+	assert.Zero(t, object.Stat().Size)
+	assert.Equal(
+		t,
+		freeBefore,
+		implementation.FSStat().BlocksFree,
+		"truncating a file must free its space",
+	)
+
+	err := object.Resize(uint64(implementation.FSStat().TotalBlocks+1) * uint64(blockSize))
+	assert.Error(t, err, "resizing past the size of the image must fail")
+}
+
+func (suite conformanceSuite) testUnlink(t *testing.T) {
+	implementation, _ := suite.mountWritable(t)
+	defer implementation.Unmount()
+	root := implementation.GetRootDirectory()
+	namesBefore := listDir(t, root)
+	freeBefore := implementation.FSStat().BlocksFree
+
+	object := createObject(t, implementation, conformanceFileName, root, 0o644)
+	blockSize := int(object.Stat().BlockSize)
+	require.NoError(t, object.Resize(uint64(2*blockSize)))
+	require.NoError(t, object.WriteBlocks(0, patternData(2*blockSize)))
+
+	require.NoError(t, object.Unlink())
+	assert.Equal(t, namesBefore, listDir(t, root))
+	assert.Equal(
+		t,
+		freeBefore,
+		implementation.FSStat().BlocksFree,
+		"removing a file must free its space",
+	)
+	assert.NoError(t, object.Close(), "closing a handle to a removed object must succeed")
+}
+
+func (suite conformanceSuite) testDirectories(t *testing.T) {
+	implementation, _ := suite.mountWritable(t)
+	defer implementation.Unmount()
+	if !implementation.GetFSFeatures().HasDirectories {
+		t.Skip("file system doesn't support directories")
+	}
+
+	root := implementation.GetRootDirectory()
+	namesBefore := listDir(t, root)
+	directory := createObject(t, implementation, conformanceDirName, root, os.ModeDir|0o755)
+	stat := directory.Stat()
+	assert.True(t, stat.IsDir(), "created a %s instead of a directory", stat.ModeFlags.Type())
+	assert.Empty(t, listDir(t, directory), "new directories must be empty")
+
+	file := createObject(t, implementation, conformanceFileName, directory, 0o644)
+	assert.Equal(t, []string{conformanceFileName}, listDir(t, directory))
+
+	object, err := implementation.GetObject(conformanceFileName, directory)
+	require.NoError(t, err)
+	assert.True(t, object.SameAs(file))
+	require.NoError(t, object.Close())
+
+	require.NoError(t, file.Unlink())
+	assert.Empty(t, listDir(t, directory))
+	require.NoError(t, directory.Unlink())
+	assert.Equal(t, namesBefore, listDir(t, root))
+}
+
+func (suite conformanceSuite) testChmod(t *testing.T) {
+	implementation, _ := suite.mountWritable(t)
+	defer implementation.Unmount()
+	object := createObject(
+		t, implementation, conformanceFileName, implementation.GetRootDirectory(), 0o644)
+	chmod, ok := object.(disko.SupportsChmodHandle)
+	if !ok {
+		t.Skip("handles don't implement SupportsChmodHandle")
+	}
+
+	modeType := object.Stat().ModeFlags.Type()
+	require.NoError(t, chmod.Chmod(0o640))
+	stat := object.Stat()
+	assert.Equal(t, modeType, stat.ModeFlags.Type(), "Chmod() changed the object's type")
+
+	features := implementation.GetFSFeatures()
+	if features.HasUnixPermissions && features.HasUserPermissions && features.HasGroupPermissions {
+		assert.Equal(t, os.FileMode(0o640), stat.ModeFlags.Perm())
+	}
+}
+
+func (suite conformanceSuite) testChown(t *testing.T) {
+	implementation, _ := suite.mountWritable(t)
+	defer implementation.Unmount()
+	object := createObject(
+		t, implementation, conformanceFileName, implementation.GetRootDirectory(), 0o644)
+	chown, ok := object.(disko.SupportsChownHandle)
+	if !ok {
+		t.Skip("handles don't implement SupportsChownHandle")
+	}
+
+	require.NoError(t, chown.Chown(123, 45))
+	stat := object.Stat()
+	features := implementation.GetFSFeatures()
+	if features.HasUserID {
+		assert.EqualValues(t, 123, stat.Uid)
+	}
+	if features.HasGroupID {
+		assert.EqualValues(t, 45, stat.Gid)
+	}
+}
+
+func (suite conformanceSuite) testChtimes(t *testing.T) {
+	implementation, _ := suite.mountWritable(t)
+	defer implementation.Unmount()
+	object := createObject(
+		t, implementation, conformanceFileName, implementation.GetRootDirectory(), 0o644)
+	chtimes, ok := object.(disko.SupportsChtimesHandle)
+	if !ok {
+		t.Skip("handles don't implement SupportsChtimesHandle")
+	}
+
+	features := implementation.GetFSFeatures()
+	timestamp := time.Date(1999, time.December, 31, 23, 59, 59, 987_654_321, time.Local)
+	expected := func(supported bool, resolution time.Duration) time.Time {
+		if !supported {
+			return disko.UndefinedTimestamp
+		}
+		return disko.RoundTimestamp(timestamp, resolution, features.TimestampRounding)
+	}
+
+	require.NoError(
+		t,
+		chtimes.Chtimes(
+			expected(features.HasCreatedTime, 0),
+			expected(features.HasAccessedTime, 0),
+			expected(features.HasModifiedTime, 0),
+			expected(features.HasChangedTime, 0),
+			disko.UndefinedTimestamp,
+		),
+	)
+
+	stat := object.Stat()
+	checkTimestamp := func(name string, supported bool, resolution time.Duration, actual time.Time) {
+		if supported {
+			assert.True(
+				t,
+				expected(true, resolution).Equal(actual),
+				"%s: expected %s, got %s",
+				name,
+				expected(true, resolution),
+				actual,
+			)
+		}
+	}
+	checkTimestamp("created", features.HasCreatedTime, features.CreatedTimeResolution, stat.CreatedAt)
+	checkTimestamp("accessed", features.HasAccessedTime, features.AccessedTimeResolution, stat.LastAccessed)
+	checkTimestamp("modified", features.HasModifiedTime, features.ModifiedTimeResolution, stat.LastModified)
+	checkTimestamp("changed", features.HasChangedTime, features.ChangedTimeResolution, stat.LastChanged)
+
+	// Undefined timestamps leave the existing ones alone.
+	require.NoError(
+		t,
+		chtimes.Chtimes(
+			disko.UndefinedTimestamp,
+			disko.UndefinedTimestamp,
+			disko.UndefinedTimestamp,
+			disko.UndefinedTimestamp,
+			disko.UndefinedTimestamp,
+		),
+	)
+	assert.Equal(t, stat, object.Stat(), "Chtimes() with undefined timestamps changed the object")
+}
+
+func (suite conformanceSuite) testHardLinks(t *testing.T) {
+	implementation, _ := suite.mountWritable(t)
+	defer implementation.Unmount()
+	linker, ok := implementation.(disko.HardLinkImplementer)
+	if !ok || !implementation.GetFSFeatures().HasHardLinks {
+		t.Skip("file system doesn't support hard links")
+	}
+
+	root := implementation.GetRootDirectory()
+	object := createObject(t, implementation, conformanceFileName, root, 0o644)
+	link, err := linker.CreateHardLink(object, root, conformanceLinkName)
+	require.NoError(t, err)
+	defer link.Close()
+
+	assert.Equal(t, conformanceLinkName, link.Name())
+	assert.True(t, link.SameAs(object), "hard links must be the same as their target")
+	assert.EqualValues(t, 2, object.Stat().Nlinks)
+	assert.Equal(t, object.Stat().InodeNumber, link.Stat().InodeNumber)
+
+	require.NoError(t, link.Unlink())
+	assert.EqualValues(t, 1, object.Stat().Nlinks)
+	assert.NotContains(t, listDir(t, root), conformanceLinkName)
+}
@@ -0,0 +1,67 @@
+package disko
+
+import "time"
+
+// TimestampRounding is how a file system converts timestamps to the resolution
+// it stores them at. See [FSFeatures.TimestampRounding].
+type TimestampRounding int
+
+const (
+	// TimestampTruncate drops everything finer than the resolution, so that
+	// timestamps are never moved into the future. This is what DOS does.
+	TimestampTruncate TimestampRounding = iota
+
+	// TimestampRoundHalfEven rounds to the nearest representable timestamp.
+	// Timestamps exactly halfway between two go to the one that's an even
+	// multiple of the resolution.
+	TimestampRoundHalfEven
+)
+
+func (rounding TimestampRounding) String() string {
+	switch rounding {
+	case TimestampTruncate:
+		return "truncate"
+	case TimestampRoundHalfEven:
+		return "round half to even"
+	default:
+		return "unknown"
+	}
+}
+
+// RoundTimestamp converts `timestamp` to `resolution` the way a file system
+// with the given rounding policy stores it, so that callers can predict what
+// reading it back will return.
+//
+// Rounding is done relative to midnight in the timestamp's own time zone, since
+// that's what file systems storing local dates and times work with. A
+// resolution of 24 hours keeps only the date. `resolution` must evenly divide
+// a day; otherwise, or if it's 0 or negative, or if `timestamp` is
+// [UndefinedTimestamp], `timestamp` is returned unchanged.
+func RoundTimestamp(
+	timestamp time.Time,
+	resolution time.Duration,
+	rounding TimestampRounding,
+) time.Time {
+	const day = 24 * time.Hour
+	if timestamp.IsZero() || resolution <= 0 || day%resolution != 0 {
+		return timestamp
+	}
+
+	midnight := time.Date(
+		timestamp.Year(), timestamp.Month(), timestamp.Day(), 0, 0, 0, 0, timestamp.Location())
+	elapsed := timestamp.Sub(midnight)
+	steps := elapsed / resolution
+
+	if rounding == TimestampRoundHalfEven {
+		remainder := elapsed % resolution
+		if 2*remainder > resolution || (2*remainder == resolution && steps%2 == 1) {
+			steps++
+		}
+	}
+
+	if resolution == day {
+		// Days aren't always 24 hours long when daylight saving time changes.
+		return midnight.AddDate(0, 0, int(steps))
+	}
+	return midnight.Add(steps * resolution)
+}
@@ -0,0 +1,75 @@
+package disko_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dargueta/disko"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundTimestamp__Truncate(t *testing.T) {
+	timestamp := time.Date(1990, time.May, 4, 13, 7, 9, 999_000_000, time.UTC)
+	assert.Equal(
+		t,
+		time.Date(1990, time.May, 4, 13, 7, 8, 0, time.UTC),
+		disko.RoundTimestamp(timestamp, 2*time.Second, disko.TimestampTruncate),
+	)
+	assert.Equal(
+		t,
+		time.Date(1990, time.May, 4, 0, 0, 0, 0, time.UTC),
+		disko.RoundTimestamp(timestamp, 24*time.Hour, disko.TimestampTruncate),
+	)
+}
+
+func TestRoundTimestamp__HalfEven(t *testing.T) {
+	at := func(second, nanosecond int) time.Time {
+		return time.Date(1990, time.May, 4, 13, 7, second, nanosecond, time.UTC)
+	}
+
+	cases := []struct {
+		input    time.Time
+		expected time.Time
+	}{
+		{at(9, 0), at(8, 0)},             // Halfway, rounds to 8 (4 * 2s).
+		{at(11, 0), at(12, 0)},           // Halfway, rounds to 12 (6 * 2s).
+		{at(9, 1), at(10, 0)},            // Past halfway.
+		{at(8, 999_999_999), at(8, 0)},   // Before halfway.
+		{at(59, 500_000_000), at(60, 0)}, // Rolls over into the next minute.
+	}
+	for _, testCase := range cases {
+		assert.Equal(
+			t,
+			testCase.expected,
+			disko.RoundTimestamp(testCase.input, 2*time.Second, disko.TimestampRoundHalfEven),
+			"rounding %s",
+			testCase.input,
+		)
+	}
+
+	assert.Equal(
+		t,
+		time.Date(1990, time.May, 5, 0, 0, 0, 0, time.UTC),
+		disko.RoundTimestamp(
+			time.Date(1990, time.May, 4, 12, 0, 0, 1, time.UTC),
+			24*time.Hour,
+			disko.TimestampRoundHalfEven,
+		),
+	)
+}
+
+func TestRoundTimestamp__Unchanged(t *testing.T) {
+	timestamp := time.Date(1990, time.May, 4, 13, 7, 9, 123, time.UTC)
+	assert.Equal(t, timestamp, disko.RoundTimestamp(timestamp, 0, disko.TimestampTruncate))
+	assert.Equal(
+		t,
+		timestamp,
+		disko.RoundTimestamp(timestamp, 7*time.Second, disko.TimestampTruncate),
+		"7s doesn't divide a day evenly",
+	)
+	assert.True(
+		t,
+		disko.RoundTimestamp(disko.UndefinedTimestamp, time.Second, disko.TimestampTruncate).
+			Equal(disko.UndefinedTimestamp),
+	)
+}
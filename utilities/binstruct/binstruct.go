@@ -0,0 +1,366 @@
+// Package binstruct converts between structs and the fixed-layout records used
+// by on-disk formats. It's like [encoding/binary], except that field tags can
+// describe layouts Go types can't express on their own, such as 24-bit integers,
+// fields in a different byte order than the rest of the record, or reserved
+// bytes between fields.
+//
+// Fields are stored in the order they're declared, with no padding between
+// them. Unsigned and signed integers, bools, arrays, and nested structs are
+// supported. A field named "_" is skipped over when reading and zeroed when
+// writing, like in [encoding/binary]. The layout of a field can be changed with
+// a `bin` tag containing any of these, separated by commas:
+//
+//   - "-": The field isn't stored.
+//   - "le" or "be": The field, or every integer in it if it's an array or
+//     struct, is little- or big-endian regardless of the byte order passed in.
+//   - "size=N": The integer is stored in N bytes instead of its natural size.
+//     This is needed for 24-bit values, and fields narrower than the integer
+//     type they're converted to.
+//   - "pad=N": N reserved bytes follow the field. They're ignored when reading
+//     and zeroed when writing.
+//
+// For example, a 16-byte record with a 24-bit big-endian length followed by
+// five reserved bytes is:
+//
+//	type Record struct {
+//		Name   [8]byte
+//		Length uint32 `bin:"size=3,be,pad=5"`
+//	}
+package binstruct
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// fieldTag is the parsed form of a field's `bin` tag.
+type fieldTag struct {
+	ignore  bool
+	order   binary.ByteOrder
+	size    int
+	padding int
+}
+
+func parseFieldTag(field reflect.StructField) (fieldTag, error) {
+	tag := fieldTag{}
+	text, ok := field.Tag.Lookup("bin")
+	if !ok || text == "" {
+		return tag, nil
+	}
+
+	for _, option := range strings.Split(text, ",") {
+		name, value, hasValue := strings.Cut(strings.TrimSpace(option), "=")
+		var err error
+		switch {
+		case name == "-" && !hasValue:
+			tag.ignore = true
+		case name == "le" && !hasValue:
+			tag.order = binary.LittleEndian
+		case name == "be" && !hasValue:
+			tag.order = binary.BigEndian
+		case name == "size" && hasValue:
+			tag.size, err = strconv.Atoi(value)
+			if err == nil && (tag.size < 1 || tag.size > 8) {
+				err = fmt.Errorf("size must be between 1 and 8, got %d", tag.size)
+			}
+		case name == "pad" && hasValue:
+			tag.padding, err = strconv.Atoi(value)
+			if err == nil && tag.padding < 0 {
+				err = fmt.Errorf("padding can't be negative, got %d", tag.padding)
+			}
+		default:
+			err = fmt.Errorf("unrecognized option %q", option)
+		}
+		if err != nil {
+			return tag, fmt.Errorf("field %s: invalid tag %q: %w", field.Name, text, err)
+		}
+	}
+	return tag, nil
+}
+
+// codec walks a struct, reading it from or writing it to a byte slice. If
+// `data` is nil, it only computes the size.
+type codec struct {
+	data    []byte
+	offset  int
+	writing bool
+}
+
+// isBigEndian returns true if `order` stores the most significant byte first.
+func isBigEndian(order binary.ByteOrder) bool {
+	probe := []byte{0, 0}
+	order.PutUint16(probe, 1)
+	return probe[1] == 1
+}
+
+// bytes returns the next `size` bytes of the buffer and advances past them, or
+// nil if only the size is being computed.
+func (c *codec) bytes(size int) ([]byte, error) {
+	start := c.offset
+	c.offset += size
+	if c.data == nil {
+		return nil, nil
+	} else if c.offset > len(c.data) {
+		return nil, fmt.Errorf(
+			"need at least %d bytes, got %d: %w", c.offset, len(c.data), io.ErrUnexpectedEOF)
+	}
+	return c.data[start:c.offset], nil
+}
+
+// integer reads or writes an integer of `size` bytes. If `signed` is true, it's
+// sign-extended when read.
+func (c *codec) integer(
+	value reflect.Value,
+	order binary.ByteOrder,
+	size int,
+	signed bool,
+) error {
+	buffer, err := c.bytes(size)
+	if buffer == nil {
+		return err
+	}
+
+	bigEndian := isBigEndian(order)
+	if c.writing {
+		var raw uint64
+		if signed {
+			raw = uint64(value.Int())
+		} else {
+			raw = value.Uint()
+		}
+		for i := 0; i < size; i++ {
+			index := i
+			if bigEndian {
+				index = size - 1 - i
+			}
+			buffer[index] = byte(raw >> (8 * i))
+		}
+		return nil
+	}
+
+	raw := uint64(0)
+	for i := 0; i < size; i++ {
+		index := i
+		if bigEndian {
+			index = size - 1 - i
+		}
+		raw |= uint64(buffer[index]) << (8 * i)
+	}
+
+	if signed {
+		shift := 64 - 8*size
+		value.SetInt(int64(raw<<shift) >> shift)
+	} else {
+		value.SetUint(raw)
+	}
+	return nil
+}
+
+// value reads or writes a single value. `size` overrides the size of integers
+// if nonzero.
+func (c *codec) value(value reflect.Value, order binary.ByteOrder, size int) error {
+	kind := value.Kind()
+	switch kind {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		naturalSize := int(value.Type().Size())
+		if size == 0 {
+			size = naturalSize
+		} else if size > naturalSize {
+			return fmt.Errorf("%d-byte field can't hold a %s", size, value.Type())
+		}
+		signed := kind >= reflect.Int8 && kind <= reflect.Int64
+		return c.integer(value, order, size, signed)
+	}
+
+	if size != 0 {
+		return fmt.Errorf("size only applies to integers, not %s", value.Type())
+	}
+
+	switch kind {
+	case reflect.Bool:
+		buffer, err := c.bytes(1)
+		if buffer == nil {
+			return err
+		} else if c.writing {
+			buffer[0] = 0
+			if value.Bool() {
+				buffer[0] = 1
+			}
+		} else {
+			value.SetBool(buffer[0] != 0)
+		}
+		return nil
+	case reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			err := c.value(value.Index(i), order, 0)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Struct:
+		return c.structure(value, order)
+	}
+	return fmt.Errorf("unsupported type %s", value.Type())
+}
+
+// padding skips over `size` reserved bytes, zeroing them if writing.
+func (c *codec) padding(size int) error {
+	buffer, err := c.bytes(size)
+	if c.writing {
+		for i := range buffer {
+			buffer[i] = 0
+		}
+	}
+	return err
+}
+
+func (c *codec) structure(value reflect.Value, order binary.ByteOrder) error {
+	structType := value.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		tag, err := parseFieldTag(field)
+		if err != nil {
+			return err
+		} else if tag.ignore {
+			continue
+		}
+
+		fieldOrder := order
+		if tag.order != nil {
+			fieldOrder = tag.order
+		}
+
+		if field.Name == "_" {
+			// Blank fields can't be read or set, so measure a scratch value of
+			// the same type instead.
+			sizer := codec{}
+			err = sizer.value(reflect.New(field.Type).Elem(), fieldOrder, tag.size)
+			if err == nil {
+				err = c.padding(sizer.offset)
+			}
+		} else if !field.IsExported() {
+			err = fmt.Errorf("field %s of %s is unexported", field.Name, structType)
+		} else {
+			err = c.value(value.Field(i), fieldOrder, tag.size)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = c.padding(tag.padding)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// structValue returns the struct `value` points to, or `value` itself if it's
+// a struct and `needPointer` is false.
+func structValue(value any, needPointer bool) (reflect.Value, error) {
+	reflected := reflect.ValueOf(value)
+	if reflected.Kind() == reflect.Pointer && !reflected.IsNil() {
+		reflected = reflected.Elem()
+	} else if needPointer {
+		return reflect.Value{}, fmt.Errorf("need a pointer to a struct, got %T", value)
+	}
+
+	if reflected.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("need a struct, got %T", value)
+	}
+	return reflected, nil
+}
+
+// Size returns the number of bytes `value`, a struct or pointer to one, takes
+// up when serialized.
+func Size(value any) (int, error) {
+	reflected, err := structValue(value, false)
+	if err != nil {
+		return 0, err
+	}
+
+	c := codec{}
+	err = c.structure(reflected, binary.LittleEndian)
+	if err != nil {
+		return 0, err
+	}
+	return c.offset, nil
+}
+
+// Unmarshal fills in the struct `value` points to from `data`, using `order`
+// for integers without an explicit byte order. Bytes in `data` past the end of
+// the struct are ignored.
+func Unmarshal(data []byte, order binary.ByteOrder, value any) error {
+	reflected, err := structValue(value, true)
+	if err != nil {
+		return err
+	}
+
+	if data == nil {
+		data = []byte{}
+	}
+	c := codec{data: data}
+	return c.structure(reflected, order)
+}
+
+// Marshal serializes `value`, a struct or pointer to one, using `order` for
+// integers without an explicit byte order.
+func Marshal(value any, order binary.ByteOrder) ([]byte, error) {
+	size, err := Size(value)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, size)
+	err = MarshalInto(data, value, order)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// MarshalInto is like [Marshal], but writes to the beginning of `data` instead
+// of allocating a new slice. Bytes in `data` past the end of the struct are left
+// alone.
+func MarshalInto(data []byte, value any, order binary.ByteOrder) error {
+	reflected, err := structValue(value, false)
+	if err != nil {
+		return err
+	}
+
+	c := codec{data: data, writing: true}
+	return c.structure(reflected, order)
+}
+
+// Read reads exactly as many bytes as the struct `value` points to needs from
+// `reader`, and unmarshals them into it. If there aren't enough bytes, it
+// returns [io.ErrUnexpectedEOF], or [io.EOF] if nothing could be read at all.
+func Read(reader io.Reader, order binary.ByteOrder, value any) error {
+	size, err := Size(value)
+	if err != nil {
+		return err
+	}
+
+	data := make([]byte, size)
+	_, err = io.ReadFull(reader, data)
+	if err != nil {
+		return err
+	}
+	return Unmarshal(data, order, value)
+}
+
+// Write marshals `value` and writes it to `writer`.
+func Write(writer io.Writer, order binary.ByteOrder, value any) error {
+	data, err := Marshal(value, order)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(data)
+	return err
+}
@@ -0,0 +1,154 @@
+package binstruct_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/dargueta/disko/utilities/binstruct"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type inner struct {
+	Flags uint8
+	Count uint16 `bin:"be"`
+}
+
+type record struct {
+	Name     [4]byte
+	Length   uint32 `bin:"size=3"`
+	Offset   int32  `bin:"size=3,be,pad=2"`
+	Enabled  bool
+	Inner    inner
+	_        uint16
+	Values   [2]uint16
+	Computed int `bin:"-"`
+}
+
+// recordBytes is the serialized form of sampleRecord.
+var recordBytes = []byte{
+	'T', 'E', 'S', 'T', // Name
+	0x56, 0x34, 0x12, // Length, 24-bit little-endian
+	0xFF, 0xFF, 0xFE, // Offset, 24-bit big-endian
+	0, 0, // Padding
+	1,          // Enabled
+	0x80,       // Inner.Flags
+	0x01, 0x02, // Inner.Count, big-endian
+	0, 0, // Blank field
+	0x34, 0x12, 0x78, 0x56, // Values
+}
+
+var sampleRecord = record{
+	Name:    [4]byte{'T', 'E', 'S', 'T'},
+	Length:  0x123456,
+	Offset:  -2,
+	Enabled: true,
+	Inner:   inner{Flags: 0x80, Count: 0x0102},
+	Values:  [2]uint16{0x1234, 0x5678},
+}
+
+func TestSize(t *testing.T) {
+	size, err := binstruct.Size(record{})
+	require.NoError(t, err)
+	assert.Equal(t, len(recordBytes), size)
+
+	size, err = binstruct.Size(&record{})
+	require.NoError(t, err)
+	assert.Equal(t, len(recordBytes), size)
+}
+
+func TestUnmarshal(t *testing.T) {
+	decoded := record{Computed: 123}
+	err := binstruct.Unmarshal(recordBytes, binary.LittleEndian, &decoded)
+	require.NoError(t, err)
+
+	expected := sampleRecord
+	expected.Computed = 123
+	assert.Equal(t, expected, decoded)
+}
+
+func TestUnmarshal__TooShort(t *testing.T) {
+	decoded := record{}
+	err := binstruct.Unmarshal(recordBytes[:len(recordBytes)-1], binary.LittleEndian, &decoded)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestUnmarshal__NotAPointer(t *testing.T) {
+	err := binstruct.Unmarshal(recordBytes, binary.LittleEndian, record{})
+	assert.Error(t, err)
+}
+
+func TestMarshal(t *testing.T) {
+	data, err := binstruct.Marshal(sampleRecord, binary.LittleEndian)
+	require.NoError(t, err)
+	assert.Equal(t, recordBytes, data)
+}
+
+func TestMarshalInto__ZeroesPadding(t *testing.T) {
+	data := bytes.Repeat([]byte{0xAA}, len(recordBytes)+2)
+	err := binstruct.MarshalInto(data, &sampleRecord, binary.LittleEndian)
+	require.NoError(t, err)
+
+	assert.Equal(t, recordBytes, data[:len(recordBytes)])
+	assert.Equal(t, []byte{0xAA, 0xAA}, data[len(recordBytes):], "trailing bytes changed")
+}
+
+func TestReadWrite__RoundTrip(t *testing.T) {
+	buffer := bytes.Buffer{}
+	require.NoError(t, binstruct.Write(&buffer, binary.BigEndian, sampleRecord))
+
+	decoded := record{}
+	require.NoError(t, binstruct.Read(&buffer, binary.BigEndian, &decoded))
+	assert.Equal(t, sampleRecord, decoded)
+
+	err := binstruct.Read(&buffer, binary.BigEndian, &decoded)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestInvalidTags(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value any
+	}{
+		{
+			"unknown option",
+			&struct {
+				A uint8 `bin:"bogus"`
+			}{},
+		},
+		{
+			"size too large for type",
+			&struct {
+				A uint16 `bin:"size=3"`
+			}{},
+		},
+		{
+			"size on an array",
+			&struct {
+				A [2]uint8 `bin:"size=1"`
+			}{},
+		},
+		{
+			"unsupported type",
+			&struct {
+				A string
+			}{},
+		},
+		{
+			"unexported field",
+			&struct {
+				a uint8
+			}{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := binstruct.Size(tc.value)
+			assert.Error(t, err)
+			assert.Error(t, binstruct.Unmarshal(make([]byte, 16), binary.LittleEndian, tc.value))
+		})
+	}
+}
@@ -0,0 +1,190 @@
+// Package checksum provides the CRC algorithms used by disk image and archive
+// formats, so that file system implementations don't each need their own.
+//
+// CRC-16 variants are described by [CRC16Params] and computed with a
+// [CRC16Table]. Tables for the common variants are predefined: [CCITT],
+// [XMODEM], [Kermit], and [ARC]. CRC-32 variants use the tables in
+// [hash/crc32].
+package checksum
+
+import (
+	"hash"
+	"hash/crc32"
+)
+
+// CRC16Params describes a CRC-16 algorithm, using the parameters from the
+// catalogue of parametrised CRC algorithms.
+type CRC16Params struct {
+	// Polynomial is the generator polynomial, in normal (not reversed) form.
+	Polynomial uint16
+	// Init is the initial value of the register, before any reflection.
+	Init uint16
+	// Reflected indicates that input bytes are processed least significant bit
+	// first, and the final value is reflected.
+	Reflected bool
+	// XorOut is XORed with the register to give the final CRC.
+	XorOut uint16
+}
+
+// CRC16Table computes a CRC-16 algorithm a byte at a time.
+type CRC16Table struct {
+	params CRC16Params
+	table  [256]uint16
+}
+
+// CCITT is CRC-16/CCITT-FALSE (also known as CRC-16/IBM-3740), used for floppy
+// disk ID and data fields and many archive formats.
+var CCITT = MakeCRC16Table(CRC16Params{Polynomial: 0x1021, Init: 0xffff})
+
+// XMODEM is CRC-16/XMODEM, the same as [CCITT] but with an initial value of 0.
+var XMODEM = MakeCRC16Table(CRC16Params{Polynomial: 0x1021})
+
+// Kermit is CRC-16/KERMIT, the reflected form of [XMODEM].
+var Kermit = MakeCRC16Table(CRC16Params{Polynomial: 0x1021, Reflected: true})
+
+// ARC is CRC-16/ARC, used by ARC and LHA archives.
+var ARC = MakeCRC16Table(CRC16Params{Polynomial: 0x8005, Reflected: true})
+
+// MakeCRC16Table creates a [CRC16Table] for the algorithm described by
+// `params`.
+func MakeCRC16Table(params CRC16Params) *CRC16Table {
+	table := &CRC16Table{params: params}
+	if params.Reflected {
+		polynomial := reflect16(params.Polynomial)
+		for i := range table.table {
+			crc := uint16(i)
+			for bit := 0; bit < 8; bit++ {
+				if crc&1 != 0 {
+					crc = crc>>1 ^ polynomial
+				} else {
+					crc >>= 1
+				}
+			}
+			table.table[i] = crc
+		}
+	} else {
+		for i := range table.table {
+			crc := uint16(i) << 8
+			for bit := 0; bit < 8; bit++ {
+				if crc&0x8000 != 0 {
+					crc = crc<<1 ^ params.Polynomial
+				} else {
+					crc <<= 1
+				}
+			}
+			table.table[i] = crc
+		}
+	}
+	return table
+}
+
+// Params returns the parameters the table was created with.
+func (table *CRC16Table) Params() CRC16Params {
+	return table.params
+}
+
+// Checksum returns the CRC of `data`.
+func (table *CRC16Table) Checksum(data []byte) uint16 {
+	init := table.params.Init
+	if table.params.Reflected {
+		init = reflect16(init)
+	}
+	return table.Update(init^table.params.XorOut, data)
+}
+
+// Update returns the CRC of the data that gave `crc`, followed by `data`. This
+// allows computing a CRC over data that isn't all available at once:
+//
+//	crc := table.Checksum(first)
+//	crc = table.Update(crc, second)
+//
+// For algorithms with no final XOR, such as [CCITT], running a block including
+// its trailing big-endian CRC through Update gives 0 if the block is intact.
+func (table *CRC16Table) Update(crc uint16, data []byte) uint16 {
+	register := crc ^ table.params.XorOut
+	if table.params.Reflected {
+		for _, value := range data {
+			register = register>>8 ^ table.table[byte(register)^value]
+		}
+	} else {
+		for _, value := range data {
+			register = register<<8 ^ table.table[byte(register>>8)^value]
+		}
+	}
+	return register ^ table.params.XorOut
+}
+
+// New returns a [hash.Hash] computing this CRC. The sum is written big-endian.
+func (table *CRC16Table) New() Hash16 {
+	digest := &crc16Digest{table: table}
+	digest.Reset()
+	return digest
+}
+
+// Hash16 is the common interface implemented by all 16-bit hash functions, like
+// [hash.Hash32] for 32-bit ones.
+type Hash16 interface {
+	hash.Hash
+	Sum16() uint16
+}
+
+type crc16Digest struct {
+	table *CRC16Table
+	crc   uint16
+}
+
+func (digest *crc16Digest) Write(data []byte) (int, error) {
+	digest.crc = digest.table.Update(digest.crc, data)
+	return len(data), nil
+}
+
+func (digest *crc16Digest) Sum(buffer []byte) []byte {
+	return append(buffer, byte(digest.crc>>8), byte(digest.crc))
+}
+
+func (digest *crc16Digest) Reset() {
+	digest.crc = digest.table.Checksum(nil)
+}
+
+func (digest *crc16Digest) Size() int {
+	return 2
+}
+
+func (digest *crc16Digest) BlockSize() int {
+	return 1
+}
+
+func (digest *crc16Digest) Sum16() uint16 {
+	return digest.crc
+}
+
+func reflect16(value uint16) uint16 {
+	var result uint16
+	for bit := 0; bit < 16; bit++ {
+		result = result<<1 | value&1
+		value >>= 1
+	}
+	return result
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+var koopmanTable = crc32.MakeTable(crc32.Koopman)
+
+// CRC32 returns the standard (IEEE 802.3) CRC-32 of `data`, as used by ZIP,
+// gzip, and PNG.
+func CRC32(data []byte) uint32 {
+	return crc32.ChecksumIEEE(data)
+}
+
+// CRC32C returns the CRC-32C (Castagnoli) of `data`, as used by iSCSI, ext4,
+// and Btrfs.
+func CRC32C(data []byte) uint32 {
+	return crc32.Checksum(data, castagnoliTable)
+}
+
+// CRC32K returns the CRC-32K (Koopman) of `data`.
+func CRC32K(data []byte) uint32 {
+	return crc32.Checksum(data, koopmanTable)
+}
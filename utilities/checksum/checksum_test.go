@@ -0,0 +1,93 @@
+package checksum_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dargueta/disko/utilities/checksum"
+	"github.com/stretchr/testify/assert"
+)
+
+// The check values are the CRCs of "123456789" given in the catalogue of
+// parametrised CRC algorithms.
+var checkInput = []byte("123456789")
+
+func TestCRC16Tables(t *testing.T) {
+	testCases := []struct {
+		name     string
+		table    *checksum.CRC16Table
+		expected uint16
+	}{
+		{"CCITT", checksum.CCITT, 0x29b1},
+		{"XMODEM", checksum.XMODEM, 0x31c3},
+		{"Kermit", checksum.Kermit, 0x2189},
+		{"ARC", checksum.ARC, 0xbb3d},
+		{
+			"X-25",
+			checksum.MakeCRC16Table(
+				checksum.CRC16Params{
+					Polynomial: 0x1021,
+					Init:       0xffff,
+					Reflected:  true,
+					XorOut:     0xffff,
+				},
+			),
+			0x906e,
+		},
+		{
+			"GENIBUS",
+			checksum.MakeCRC16Table(
+				checksum.CRC16Params{Polynomial: 0x1021, Init: 0xffff, XorOut: 0xffff},
+			),
+			0xd64e,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, testCase.table.Checksum(checkInput))
+
+			// Splitting the input up must give the same result.
+			crc := testCase.table.Checksum(checkInput[:4])
+			crc = testCase.table.Update(crc, checkInput[4:])
+			assert.Equal(t, testCase.expected, crc, "incremental CRC is wrong")
+
+			digest := testCase.table.New()
+			digest.Write(checkInput[:2])
+			digest.Write(checkInput[2:])
+			assert.Equal(t, testCase.expected, digest.Sum16())
+			assert.Equal(
+				t,
+				[]byte{byte(testCase.expected >> 8), byte(testCase.expected)},
+				digest.Sum(nil),
+			)
+		})
+	}
+}
+
+// Running a CCITT CRC over a block followed by its CRC must give 0.
+func TestCCITT__Residue(t *testing.T) {
+	crc := checksum.CCITT.Checksum(checkInput)
+	block := append(append([]byte{}, checkInput...), byte(crc>>8), byte(crc))
+	assert.EqualValues(t, 0, checksum.CCITT.Checksum(block))
+}
+
+func TestCRC32Variants(t *testing.T) {
+	testCases := []struct {
+		name     string
+		function func([]byte) uint32
+		expected uint32
+	}{
+		{"CRC32", checksum.CRC32, 0xcbf43926},
+		{"CRC32C", checksum.CRC32C, 0xe3069283},
+		{"CRC32K", checksum.CRC32K, 0x2d3dd0ae},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			result := testCase.function(checkInput)
+			assert.Equal(
+				t, testCase.expected, result, fmt.Sprintf("got %#08x", result))
+		})
+	}
+}
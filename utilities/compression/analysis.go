@@ -0,0 +1,264 @@
+package compression
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// zeroBlockSize is the size of the blocks [AnalyzeImage] checks for being all
+// null bytes. It's the most common sector size.
+const zeroBlockSize = 512
+
+// RunLengthBucket counts the runs in an image whose lengths are in the range
+// [MinLength, MaxLength]. MaxLength is 0 for the last bucket, which has no
+// upper limit.
+type RunLengthBucket struct {
+	MinLength int   `json:"min_length"`
+	MaxLength int   `json:"max_length,omitempty"`
+	Runs      int64 `json:"runs"`
+	Bytes     int64 `json:"bytes"`
+}
+
+// runLengthBucketLimits are the upper limits of the buckets in
+// [ImageAnalysis.RunLengths]. Runs of 2 are worth calling out because RLE8
+// stores them in three bytes, and 257 is the longest run that fits in one
+// RLE8 triple.
+var runLengthBucketLimits = []int{1, 2, 16, maxRLE8Run, 4096, 65536}
+
+// RegionEntropy gives the Shannon entropy of one region of an image, in bits
+// per byte. Regions that are all the same byte have an entropy of 0, and random
+// data approaches 8.
+type RegionEntropy struct {
+	Offset  int64   `json:"offset"`
+	Size    int64   `json:"size"`
+	Entropy float64 `json:"entropy"`
+}
+
+// CodecSize is the size an image would be compressed to with a codec.
+type CodecSize struct {
+	Codec string `json:"codec"`
+	Size  int64  `json:"size"`
+}
+
+// ImageAnalysis describes how compressible an image is. See [AnalyzeImage].
+type ImageAnalysis struct {
+	Size       int64             `json:"size"`
+	RunLengths []RunLengthBucket `json:"run_lengths"`
+	// ZeroBlocks is the number of 512-byte blocks that are all null bytes. A
+	// partial block at the end of the image is counted if it's all null bytes.
+	ZeroBlocks  int64 `json:"zero_blocks"`
+	TotalBlocks int64 `json:"total_blocks"`
+	// Regions gives the entropy of each region of the image, in order.
+	Regions []RegionEntropy `json:"regions"`
+	// Codecs gives the compressed size of the image with each codec, in the
+	// same order as [CodecNames].
+	Codecs []CodecSize `json:"codecs"`
+}
+
+// ZeroBlockRatio returns the fraction of blocks in the image that are all null
+// bytes.
+func (analysis *ImageAnalysis) ZeroBlockRatio() float64 {
+	if analysis.TotalBlocks == 0 {
+		return 0
+	}
+	return float64(analysis.ZeroBlocks) / float64(analysis.TotalBlocks)
+}
+
+// CodecNames gives the names of the codecs [AnalyzeImage] measures:
+//
+//   - "rle8": RLE8 alone, as described in the package documentation.
+//   - "rle8+gzip": RLE8 followed by gzip, what [CompressImage] does.
+//   - "uleb128": RLE8 with the repeat count stored in ULEB128 instead of one
+//     byte, so that runs of any length take one group.
+//   - "uleb128+gzip": The above followed by gzip.
+//   - "gzip": gzip alone.
+//
+// All gzip sizes use the best compression level, the same as [CompressImage].
+var CodecNames = []string{"rle8", "rle8+gzip", "uleb128", "uleb128+gzip", "gzip"}
+
+// AnalyzeImage reads an image from `input` and measures how well it can be
+// compressed. The entropy is computed for every `regionSize` bytes of the
+// image. Everything is done in one pass, without holding the image in memory.
+func AnalyzeImage(input io.Reader, regionSize int64) (ImageAnalysis, error) {
+	if regionSize <= 0 {
+		return ImageAnalysis{}, fmt.Errorf("region size must be positive, got %d", regionSize)
+	}
+
+	analysis := ImageAnalysis{}
+	for i, limit := range runLengthBucketLimits {
+		bucket := RunLengthBucket{MinLength: 1, MaxLength: limit}
+		if i > 0 {
+			bucket.MinLength = runLengthBucketLimits[i-1] + 1
+		}
+		analysis.RunLengths = append(analysis.RunLengths, bucket)
+	}
+	analysis.RunLengths = append(
+		analysis.RunLengths,
+		RunLengthBucket{MinLength: runLengthBucketLimits[len(runLengthBucketLimits)-1] + 1},
+	)
+
+	// The sizes of the codecs' output are all we need, so nothing is kept.
+	sizes := make([]countingWriter, len(CodecNames))
+	for i := range sizes {
+		sizes[i].Writer = io.Discard
+	}
+	rleGzip, err := gzip.NewWriterLevel(&sizes[1], gzip.BestCompression)
+	if err != nil {
+		return analysis, err
+	}
+	ulebGzip, err := gzip.NewWriterLevel(&sizes[3], gzip.BestCompression)
+	if err != nil {
+		return analysis, err
+	}
+	plainGzip, err := gzip.NewWriterLevel(&sizes[4], gzip.BestCompression)
+	if err != nil {
+		return analysis, err
+	}
+	rleOutput := io.MultiWriter(&sizes[0], rleGzip)
+	ulebOutput := io.MultiWriter(&sizes[2], ulebGzip)
+
+	scanner := &byteStatistics{regionSize: regionSize}
+	grouper := NewRLEGrouperFromReader(io.TeeReader(input, io.MultiWriter(scanner, plainGzip)))
+	for {
+		run, getRunErr := grouper.GetNextRun()
+		if getRunErr != nil && !errors.Is(getRunErr, io.EOF) {
+			return analysis, getRunErr
+		}
+
+		if run.RunLength > 0 {
+			bucket := len(analysis.RunLengths) - 1
+			for i, limit := range runLengthBucketLimits {
+				if run.RunLength <= limit {
+					bucket = i
+					break
+				}
+			}
+			analysis.RunLengths[bucket].Runs++
+			analysis.RunLengths[bucket].Bytes += int64(run.RunLength)
+
+			_, err = writeRLE8Run(run, rleOutput)
+			if err != nil {
+				return analysis, err
+			}
+			_, err = writeULEB128Run(run, ulebOutput)
+			if err != nil {
+				return analysis, err
+			}
+		}
+
+		if getRunErr != nil {
+			break
+		}
+	}
+
+	for _, writer := range []io.Closer{rleGzip, ulebGzip, plainGzip} {
+		err = writer.Close()
+		if err != nil {
+			return analysis, err
+		}
+	}
+	scanner.finish()
+
+	analysis.Size = scanner.size
+	analysis.ZeroBlocks = scanner.zeroBlocks
+	analysis.TotalBlocks = scanner.totalBlocks
+	analysis.Regions = scanner.regions
+	for i, name := range CodecNames {
+		analysis.Codecs = append(analysis.Codecs, CodecSize{Codec: name, Size: sizes[i].BytesWritten})
+	}
+	return analysis, nil
+}
+
+// writeULEB128Run writes `run` the same way as RLE8, but with the repeat count
+// encoded as ULEB128 so the run is never split.
+func writeULEB128Run(run ByteRun, output io.Writer) (int64, error) {
+	if run.RunLength == 1 {
+		n, err := output.Write([]byte{run.Byte})
+		return int64(n), err
+	}
+
+	encoded := []byte{run.Byte, run.Byte}
+	encoded = binary.AppendUvarint(encoded, uint64(run.RunLength-2))
+	n, err := output.Write(encoded)
+	return int64(n), err
+}
+
+// byteStatistics is an [io.Writer] that counts zero blocks and computes the
+// entropy of each region of what's written to it.
+type byteStatistics struct {
+	regionSize int64
+	size       int64
+
+	histogram    [256]int64
+	regionOffset int64
+
+	blockIsZero bool
+	blockFill   int64
+	zeroBlocks  int64
+	totalBlocks int64
+
+	regions []RegionEntropy
+}
+
+func (stats *byteStatistics) Write(data []byte) (int, error) {
+	for _, b := range data {
+		if stats.blockFill == 0 {
+			stats.blockIsZero = true
+		}
+		stats.blockIsZero = stats.blockIsZero && b == 0
+		stats.blockFill++
+		if stats.blockFill == zeroBlockSize {
+			stats.endBlock()
+		}
+
+		stats.histogram[b]++
+		stats.size++
+		if stats.size-stats.regionOffset == stats.regionSize {
+			stats.endRegion()
+		}
+	}
+	return len(data), nil
+}
+
+// finish accounts for the partial block and region at the end of the data.
+func (stats *byteStatistics) finish() {
+	if stats.blockFill > 0 {
+		stats.endBlock()
+	}
+	if stats.size > stats.regionOffset {
+		stats.endRegion()
+	}
+}
+
+func (stats *byteStatistics) endBlock() {
+	stats.totalBlocks++
+	if stats.blockIsZero {
+		stats.zeroBlocks++
+	}
+	stats.blockFill = 0
+}
+
+func (stats *byteStatistics) endRegion() {
+	regionSize := stats.size - stats.regionOffset
+	entropy := 0.0
+	for i, count := range stats.histogram {
+		if count == 0 {
+			continue
+		}
+		probability := float64(count) / float64(regionSize)
+		entropy -= probability * math.Log2(probability)
+		stats.histogram[i] = 0
+	}
+
+	// Rounding errors can give -0 for regions that are all the same byte.
+	entropy = math.Abs(entropy)
+	stats.regions = append(
+		stats.regions,
+		RegionEntropy{Offset: stats.regionOffset, Size: regionSize, Entropy: entropy},
+	)
+	stats.regionOffset = stats.size
+}
@@ -0,0 +1,72 @@
+package compression_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	c "github.com/dargueta/disko/utilities/compression"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzeImage(t *testing.T) {
+	// Two empty blocks, then a block of random data, then half a block with
+	// two runs.
+	random := make([]byte, 512)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	image := make([]byte, 1024)
+	image = append(image, random...)
+	image = append(image, bytes.Repeat([]byte{7}, 200)...)
+	image = append(image, bytes.Repeat([]byte{0}, 56)...)
+
+	analysis, err := c.AnalyzeImage(bytes.NewReader(image), 1024)
+	require.NoError(t, err)
+
+	assert.EqualValues(t, len(image), analysis.Size)
+	assert.EqualValues(t, 2, analysis.ZeroBlocks)
+	assert.EqualValues(t, 4, analysis.TotalBlocks)
+	assert.Equal(t, 0.5, analysis.ZeroBlockRatio())
+
+	require.Len(t, analysis.Regions, 2)
+	assert.Equal(t, c.RegionEntropy{Offset: 0, Size: 1024, Entropy: 0}, analysis.Regions[0])
+	assert.EqualValues(t, 1024, analysis.Regions[1].Offset)
+	assert.EqualValues(t, 768, analysis.Regions[1].Size)
+	assert.Greater(t, analysis.Regions[1].Entropy, 4.0)
+
+	totalRuns := int64(0)
+	totalBytes := int64(0)
+	for _, bucket := range analysis.RunLengths {
+		totalRuns += bucket.Runs
+		totalBytes += bucket.Bytes
+	}
+	assert.EqualValues(t, len(image), totalBytes)
+	assert.Greater(t, totalRuns, int64(3))
+
+	// The largest bucket that has anything is 4096, for the leading zeroes.
+	last := analysis.RunLengths[len(analysis.RunLengths)-1]
+	assert.Zero(t, last.Runs)
+
+	// RLE8 output is exactly what CompressRLE8 writes.
+	compressed := bytes.Buffer{}
+	rleSize, err := c.CompressRLE8(bytes.NewReader(image), &compressed)
+	require.NoError(t, err)
+
+	require.Len(t, analysis.Codecs, len(c.CodecNames))
+	assert.Equal(t, "rle8", analysis.Codecs[0].Codec)
+	assert.Equal(t, rleSize, analysis.Codecs[0].Size)
+
+	// The leading 1024 null bytes take four RLE8 triples but one four-byte
+	// ULEB128 group, and the 200 sevens take one more byte in ULEB128.
+	assert.Equal(t, "uleb128", analysis.Codecs[2].Codec)
+	assert.Equal(t, rleSize-7, analysis.Codecs[2].Size)
+}
+
+func TestAnalyzeImage__Empty(t *testing.T) {
+	analysis, err := c.AnalyzeImage(bytes.NewReader(nil), 1024)
+	require.NoError(t, err)
+	assert.Zero(t, analysis.Size)
+	assert.Empty(t, analysis.Regions)
+	assert.Zero(t, analysis.ZeroBlockRatio())
+}
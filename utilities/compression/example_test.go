@@ -0,0 +1,36 @@
+package compression_test
+
+import (
+	"bytes"
+	"fmt"
+
+	c "github.com/dargueta/disko/utilities/compression"
+)
+
+func ExampleCompressRLE8() {
+	// Disk images are mostly long runs of the same byte, such as this freshly
+	// formatted sector: a short header and the boot signature, with nothing
+	// but null bytes in between.
+	sector := make([]byte, 512)
+	copy(sector, "\xEB\x3C\x90MSDOS5.0")
+	sector[510] = 0x55
+	sector[511] = 0xAA
+
+	var compressed bytes.Buffer
+	compressedSize, err := c.CompressRLE8(bytes.NewReader(sector), &compressed)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("compressed %d bytes to %d\n", len(sector), compressedSize)
+
+	var decompressed bytes.Buffer
+	_, err = c.DecompressRLE8(&compressed, &decompressed)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("round trip matches:", bytes.Equal(decompressed.Bytes(), sector))
+
+	// Output:
+	// compressed 512 bytes to 19
+	// round trip matches: true
+}
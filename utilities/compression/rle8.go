@@ -8,6 +8,10 @@ import (
 	"io"
 )
 
+// maxRLE8Run is the longest run that can be encoded in one triple: two copies
+// of the byte, then a repeat count of up to 255.
+const maxRLE8Run = 257
+
 // CompressRLE8 reads bytes from the input and writes compressed data from the
 // output until the input is exhausted. The return value is the number of bytes
 // written, only valid if no error occurred.
@@ -22,28 +26,10 @@ func CompressRLE8(input io.Reader, output io.Writer) (int64, error) {
 			return totalBytesWritten, getRunErr
 		}
 
-		for run.RunLength >= 2 {
-			var repeatCount int
-			if run.RunLength > 257 {
-				repeatCount = 255
-			} else {
-				repeatCount = run.RunLength - 2
-			}
-
-			n, err := output.Write([]byte{run.Byte, run.Byte, byte(repeatCount)})
-			if err != nil {
-				return totalBytesWritten, err
-			}
-			totalBytesWritten += int64(n)
-			run.RunLength -= repeatCount + 2
-		}
-
-		if run.RunLength == 1 {
-			n, err := output.Write([]byte{run.Byte})
-			if err != nil {
-				return totalBytesWritten, err
-			}
-			totalBytesWritten += int64(n)
+		n, err := writeRLE8Run(run, output)
+		totalBytesWritten += n
+		if err != nil {
+			return totalBytesWritten, err
 		}
 
 		// We bail at the beginning of the loop if an error occurred and it's
@@ -55,6 +41,39 @@ func CompressRLE8(input io.Reader, output io.Writer) (int64, error) {
 	}
 }
 
+// writeRLE8Run writes the RLE8 encoding of `run` to `output`, and returns the
+// number of bytes written.
+func writeRLE8Run(run ByteRun, output io.Writer) (int64, error) {
+	totalBytesWritten := int64(0)
+
+	// Runs longer than maxRLE8Run are split into full triples. Whatever is
+	// left over is either another shorter triple, or a single byte if only
+	// one remains. The single byte can't be mistaken for the start of a
+	// pair, because the next run always has a different byte.
+	for run.RunLength >= 2 {
+		repeatCount := run.RunLength - 2
+		if run.RunLength > maxRLE8Run {
+			repeatCount = maxRLE8Run - 2
+		}
+
+		n, err := output.Write([]byte{run.Byte, run.Byte, byte(repeatCount)})
+		totalBytesWritten += int64(n)
+		if err != nil {
+			return totalBytesWritten, err
+		}
+		run.RunLength -= repeatCount + 2
+	}
+
+	if run.RunLength == 1 {
+		n, err := output.Write([]byte{run.Byte})
+		totalBytesWritten += int64(n)
+		if err != nil {
+			return totalBytesWritten, err
+		}
+	}
+	return totalBytesWritten, nil
+}
+
 func DecompressRLE8(input io.Reader, output io.Writer) (int64, error) {
 	source := bufio.NewReader(input)
 	lastByteRead := -1
@@ -51,6 +51,26 @@ func TestCompressRLE8__Basic(t *testing.T) {
 			[]byte{8, 8, 255, 8, 8, 0},
 			"259",
 		},
+		{
+			bytes.Repeat([]byte{8}, 514),
+			[]byte{8, 8, 255, 8, 8, 255},
+			"514",
+		},
+		{
+			bytes.Repeat([]byte{8}, 515),
+			[]byte{8, 8, 255, 8, 8, 255, 8},
+			"515",
+		},
+		{
+			bytes.Repeat([]byte{8}, 516),
+			[]byte{8, 8, 255, 8, 8, 255, 8, 8, 0},
+			"516",
+		},
+		{
+			append(bytes.Repeat([]byte{8}, 258), 8, 9, 9),
+			[]byte{8, 8, 255, 8, 8, 0, 9, 9, 0},
+			"259 then another run",
+		},
 	}
 
 	for _, test := range tests {
@@ -79,6 +99,17 @@ func TestRLE8RoundTrip__EntirelyNonNullRun(t *testing.T) {
 	runRoundTripTestCase(t, bytes.Repeat([]byte{182}, 934))
 }
 
+// Every run length up to and past three full triples round-trips, both alone
+// and between other bytes, since a leftover single byte at the end of a run
+// mustn't be mistaken for the start of a new pair.
+func TestRLE8RoundTrip__RunLengths(t *testing.T) {
+	for length := 1; length <= 3*257+3; length++ {
+		run := bytes.Repeat([]byte{0xAA}, length)
+		runRoundTripTestCase(t, run)
+		runRoundTripTestCase(t, append(append([]byte{1}, run...), 2, 2))
+	}
+}
+
 func TestRLE8RoundTrip__Empty(t *testing.T) {
 	runRoundTripTestCase(t, []byte{})
 }
@@ -138,3 +169,14 @@ func runRoundTripTestCase(t *testing.T, originalData []byte) {
 		bytes.Equal(originalData, outputBuffer),
 		"decompressed data doesn't match original")
 }
+
+// Compress a 256 MiB image that's mostly empty space.
+func BenchmarkCompressRLE8(b *testing.B) {
+	b.SetBytes(benchmarkImageSize)
+	for i := 0; i < b.N; i++ {
+		_, err := c.CompressRLE8(&syntheticImage{size: benchmarkImageSize}, io.Discard)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
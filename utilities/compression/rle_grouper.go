@@ -27,6 +27,9 @@ var InvalidRLERun = ByteRun{0, 0}
 // This functions much like the `uniq` command line utility.
 type RLEGrouper struct {
 	rd io.ByteScanner
+	// buffered is rd if it's a [bufio.Reader], in which case runs are found by
+	// scanning its buffer directly instead of reading a byte at a time.
+	buffered *bufio.Reader
 }
 
 // NewRLEGrouperFromReader constructs an [RLEGrouper] from an [io.Reader].
@@ -34,9 +37,11 @@ func NewRLEGrouperFromReader(rd io.Reader) RLEGrouper {
 	return NewRLEGrouperFromByteScanner(bufio.NewReader(rd))
 }
 
-// NewRLEGrouper constructs an [RLEGrouper] from an [io.ByteScanner].
+// NewRLEGrouper constructs an [RLEGrouper] from an [io.ByteScanner]. It's
+// considerably faster if `rd` is a [bufio.Reader].
 func NewRLEGrouperFromByteScanner(rd io.ByteScanner) RLEGrouper {
-	return RLEGrouper{rd: rd}
+	buffered, _ := rd.(*bufio.Reader)
+	return RLEGrouper{rd: rd, buffered: buffered}
 }
 
 // GetNextRun returns a [ByteRun] for the next byte or run of byte values in the
@@ -47,6 +52,10 @@ func NewRLEGrouperFromByteScanner(rd io.ByteScanner) RLEGrouper {
 // the returned run length is non-zero, the error will either be nil or [io.EOF].
 // If it's zero, the error is either [io.EOF] or another (non-nil) error.
 func (grouper RLEGrouper) GetNextRun() (ByteRun, error) {
+	if grouper.buffered != nil {
+		return grouper.getNextBufferedRun()
+	}
+
 	firstByte, err := grouper.rd.ReadByte()
 	// Bail if any error occurred, including EOF.
 	if err != nil {
@@ -81,3 +90,46 @@ func (grouper RLEGrouper) GetNextRun() (ByteRun, error) {
 	// before the end of the run, we return early to avoid overflow.
 	return ByteRun{Byte: firstByte, RunLength: runLength}, nil
 }
+
+// getNextBufferedRun is [RLEGrouper.GetNextRun] for a [bufio.Reader]. Rather
+// than reading one byte at a time through an interface, it scans everything
+// that's buffered for the end of the run, and only goes back to the underlying
+// reader when the run reaches the end of the buffer.
+func (grouper RLEGrouper) getNextBufferedRun() (ByteRun, error) {
+	reader := grouper.buffered
+	firstByte, err := reader.ReadByte()
+	if err != nil {
+		return InvalidRLERun, err
+	}
+
+	runLength := 1
+	for runLength < math.MaxInt {
+		// Peeking at one byte refills the buffer if it's empty, which is also
+		// how we find out we've hit EOF or an error.
+		_, err := reader.Peek(1)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return ByteRun{Byte: firstByte, RunLength: runLength}, io.EOF
+			}
+			return InvalidRLERun, err
+		}
+
+		chunk, _ := reader.Peek(reader.Buffered())
+		if len(chunk) > math.MaxInt-runLength {
+			chunk = chunk[:math.MaxInt-runLength]
+		}
+
+		matched := 0
+		for matched < len(chunk) && chunk[matched] == firstByte {
+			matched++
+		}
+		reader.Discard(matched)
+		runLength += matched
+
+		if matched < len(chunk) {
+			// Hit a different byte.
+			break
+		}
+	}
+	return ByteRun{Byte: firstByte, RunLength: runLength}, nil
+}
@@ -1,11 +1,13 @@
 package compression_test
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"testing"
+	"testing/iotest"
 
 	c "github.com/dargueta/disko/utilities/compression"
 	"github.com/stretchr/testify/assert"
@@ -204,3 +206,126 @@ func TestRLEGrouper__ErrorWhileReadingARun(t *testing.T) {
 	result, err = grouper.GetNextRun()
 	assert.ErrorIs(t, err, expectedError, "run 2 succeeded unexpectedly")
 }
+
+// The fast path for [bufio.Reader] must give the same runs as reading a byte at
+// a time, including for runs that cross the end of the buffer.
+func TestRLEGrouper__Buffered(t *testing.T) {
+	data := []byte{1, 9}
+	data = append(data, bytes.Repeat([]byte{4}, 40)...)
+	data = append(data, 6, 6, 0)
+	data = append(data, bytes.Repeat([]byte{0}, 17)...)
+	data = append(data, 3)
+
+	expectedRuns := []c.ByteRun{
+		{byte(1), 1}, {byte(9), 1}, {byte(4), 40}, {byte(6), 2}, {byte(0), 18},
+		{byte(3), 1},
+	}
+
+	// 16 bytes is the smallest buffer bufio allows.
+	grouper := c.NewRLEGrouperFromByteScanner(bufio.NewReaderSize(bytes.NewReader(data), 16))
+	for i, expectedRun := range expectedRuns {
+		result, err := grouper.GetNextRun()
+		assert.Equalf(t, expectedRun, result, "run %d is wrong", i)
+		if i == len(expectedRuns)-1 {
+			assert.ErrorIs(t, err, io.EOF)
+		} else {
+			assert.NoErrorf(t, err, "run %d failed", i)
+		}
+	}
+
+	result, err := grouper.GetNextRun()
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, c.InvalidRLERun, result)
+}
+
+func TestRLEGrouper__BufferedErrorWhileReadingARun(t *testing.T) {
+	expectedError := errors.New("this is the expected error")
+	reader := io.MultiReader(
+		bytes.NewReader([]byte{1, 1, 1, 2, 2}),
+		iotest.ErrReader(expectedError),
+	)
+	grouper := c.NewRLEGrouperFromReader(reader)
+
+	result, err := grouper.GetNextRun()
+	require.NoError(t, err, "run 1 failed")
+	assert.Equal(t, c.ByteRun{Byte: 1, RunLength: 3}, result)
+
+	result, err = grouper.GetNextRun()
+	assert.ErrorIs(t, err, expectedError, "run 2 succeeded unexpectedly")
+	assert.Equal(t, c.InvalidRLERun, result)
+}
+
+// Benchmarks ------------------------------------------------------------------
+
+// syntheticImagePattern is repeated to make a [syntheticImage]: a block of
+// varied data followed by empty space.
+var syntheticImagePattern = func() []byte {
+	pattern := make([]byte, 65536)
+	for i := 0; i < 4096; i++ {
+		pattern[i] = byte(i / 3)
+	}
+	return pattern
+}()
+
+// syntheticImage is an [io.Reader] giving `size` bytes that look roughly like a
+// disk image: mostly empty, with a block of varied data every 64 KiB. It
+// doesn't allocate the image, so benchmarks can use large ones.
+type syntheticImage struct {
+	size   int64
+	offset int64
+}
+
+func (image *syntheticImage) Read(buffer []byte) (int, error) {
+	if image.offset >= image.size {
+		return 0, io.EOF
+	}
+	if int64(len(buffer)) > image.size-image.offset {
+		buffer = buffer[:image.size-image.offset]
+	}
+
+	n := 0
+	for n < len(buffer) {
+		patternOffset := (image.offset + int64(n)) % int64(len(syntheticImagePattern))
+		n += copy(buffer[n:], syntheticImagePattern[patternOffset:])
+	}
+	image.offset += int64(n)
+	return n, nil
+}
+
+const benchmarkImageSize = 256 * 1024 * 1024
+
+// Group a 256 MiB image through a bufio.Reader, which uses the fast path.
+func BenchmarkRLEGrouper__Buffered(b *testing.B) {
+	b.SetBytes(benchmarkImageSize)
+	for i := 0; i < b.N; i++ {
+		grouper := c.NewRLEGrouperFromReader(&syntheticImage{size: benchmarkImageSize})
+		for {
+			_, err := grouper.GetNextRun()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// The same as BenchmarkRLEGrouper__Buffered, but hiding the bufio.Reader so the
+// image is read a byte at a time.
+func BenchmarkRLEGrouper__ByteAtATime(b *testing.B) {
+	b.SetBytes(benchmarkImageSize)
+	for i := 0; i < b.N; i++ {
+		scanner := struct{ io.ByteScanner }{
+			bufio.NewReader(&syntheticImage{size: benchmarkImageSize}),
+		}
+		grouper := c.NewRLEGrouperFromByteScanner(scanner)
+		for {
+			_, err := grouper.GetNextRun()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package compression
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SqueezeMagic is the two bytes every file compressed with Richard Greenlaw's
+// SQ (Squeeze) program begins with. Squeezed files were common on CP/M and
+// early MS-DOS systems, and were conventionally named by replacing the middle
+// letter of the extension with "Q", e.g. "README.TQT".
+var SqueezeMagic = []byte{0x76, 0xFF}
+
+// squeezeEOF is the Huffman symbol marking the end of the compressed data.
+const squeezeEOF = 256
+
+// squeezeMaxNodes is the maximum number of nodes in the Huffman tree: one for
+// every possible byte value plus the end-of-data symbol, minus one.
+const squeezeMaxNodes = 256
+
+// squeezeRunEscape introduces a run in the data after Huffman decoding. It's
+// followed by a count byte: 0 means a literal 0x90, anything else means the
+// preceding byte is repeated until it occurs `count` times in total.
+const squeezeRunEscape = 0x90
+
+// DecompressSqueezed decompresses data produced by SQ and writes it to
+// `output`. The return value is the number of bytes written, only valid if no
+// error occurred.
+//
+// The file begins with a header consisting of the magic number, a 16-bit
+// checksum of the original data, the original file name terminated by a null
+// byte, and the Huffman tree. The data follows, Huffman encoded with bits read
+// from least to most significant, and additionally run-length encoded.
+func DecompressSqueezed(input io.Reader, output io.Writer) (int64, error) {
+	source := bufio.NewReader(input)
+
+	header := make([]byte, 4)
+	_, err := io.ReadFull(source, header)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read squeezed file header: %w", err)
+	}
+	if header[0] != SqueezeMagic[0] || header[1] != SqueezeMagic[1] {
+		return 0, errors.New("not a squeezed file: bad magic number")
+	}
+	expectedChecksum := binary.LittleEndian.Uint16(header[2:])
+
+	// Skip the original file name.
+	_, err = source.ReadBytes(0)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read original file name: %w", err)
+	}
+
+	var numNodes uint16
+	err = binary.Read(source, binary.LittleEndian, &numNodes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read Huffman tree size: %w", err)
+	}
+	if numNodes > squeezeMaxNodes {
+		return 0, fmt.Errorf(
+			"Huffman tree has too many nodes: %d > %d", numNodes, squeezeMaxNodes)
+	}
+
+	// Each node has two children. Non-negative values are the index of another
+	// node; a negative value -(S + 1) is a leaf for symbol S.
+	nodes := make([][2]int16, numNodes)
+	err = binary.Read(source, binary.LittleEndian, nodes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read Huffman tree: %w", err)
+	}
+
+	writer := bufio.NewWriter(output)
+	expander := squeezeRunExpander{output: writer}
+
+	if numNodes > 0 {
+		err = decodeSqueezedData(source, nodes, &expander)
+		if err != nil {
+			return expander.bytesWritten, err
+		}
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return expander.bytesWritten, err
+	}
+	if expander.checksum != expectedChecksum {
+		return expander.bytesWritten, fmt.Errorf(
+			"checksum mismatch: expected %#04x, got %#04x",
+			expectedChecksum,
+			expander.checksum,
+		)
+	}
+	return expander.bytesWritten, nil
+}
+
+// decodeSqueezedData decodes Huffman-encoded symbols from `source` until it
+// hits the end-of-data symbol, passing them to `expander`.
+func decodeSqueezedData(
+	source io.ByteReader,
+	nodes [][2]int16,
+	expander *squeezeRunExpander,
+) error {
+	currentByte := byte(0)
+	bitsLeft := 0
+
+	for {
+		// Walk the tree from the root until we hit a leaf.
+		child := int16(0)
+		for child >= 0 {
+			if int(child) >= len(nodes) {
+				return fmt.Errorf("corrupted Huffman tree: bad node index %d", child)
+			}
+
+			if bitsLeft == 0 {
+				var err error
+				currentByte, err = source.ReadByte()
+				if errors.Is(err, io.EOF) {
+					return errors.New("unexpected end of squeezed data")
+				} else if err != nil {
+					return err
+				}
+				bitsLeft = 8
+			}
+
+			child = nodes[child][currentByte&1]
+			currentByte >>= 1
+			bitsLeft--
+		}
+
+		symbol := -(int(child) + 1)
+		if symbol == squeezeEOF {
+			return nil
+		} else if symbol > squeezeEOF {
+			return fmt.Errorf("corrupted Huffman tree: bad symbol %d", symbol)
+		}
+
+		err := expander.WriteByte(byte(symbol))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// squeezeRunExpander undoes the run-length encoding SQ applies before Huffman
+// encoding, and keeps a running checksum of the output.
+type squeezeRunExpander struct {
+	output       io.ByteWriter
+	bytesWritten int64
+	checksum     uint16
+	lastByte     byte
+	inRun        bool
+}
+
+func (expander *squeezeRunExpander) WriteByte(b byte) error {
+	if !expander.inRun {
+		if b == squeezeRunEscape {
+			expander.inRun = true
+			return nil
+		}
+		expander.lastByte = b
+		return expander.emit(b)
+	}
+
+	expander.inRun = false
+	if b == 0 {
+		expander.lastByte = squeezeRunEscape
+		return expander.emit(squeezeRunEscape)
+	}
+
+	// The byte before the escape has already been written once.
+	for i := 1; i < int(b); i++ {
+		err := expander.emit(expander.lastByte)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (expander *squeezeRunExpander) emit(b byte) error {
+	err := expander.output.WriteByte(b)
+	if err != nil {
+		return err
+	}
+	expander.bytesWritten++
+	expander.checksum += uint16(b)
+	return nil
+}
@@ -0,0 +1,120 @@
+package compression_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	c "github.com/dargueta/disko/utilities/compression"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// squeezeSymbols builds a squeezed file from a sequence of symbols that have
+// already been run-length encoded. It uses a degenerate Huffman tree where
+// node N has the Nth distinct symbol as its left child and node N+1 as its
+// right child, so it's not efficient but it is valid.
+func squeezeSymbols(t *testing.T, checksum uint16, symbols []int) []byte {
+	distinct := []int{}
+	codes := map[int][]int{}
+	for _, symbol := range append(symbols, 256) {
+		if _, ok := codes[symbol]; !ok {
+			codes[symbol] = nil
+			distinct = append(distinct, symbol)
+		}
+	}
+	require.GreaterOrEqual(t, len(distinct), 2, "need at least two distinct symbols")
+
+	nodes := make([][2]int16, len(distinct)-1)
+	for i := range nodes {
+		nodes[i][0] = int16(-(distinct[i] + 1))
+		nodes[i][1] = int16(i + 1)
+
+		code := make([]int, i+1)
+		for j := 0; j < i; j++ {
+			code[j] = 1
+		}
+		codes[distinct[i]] = code
+	}
+	last := len(nodes) - 1
+	nodes[last][1] = int16(-(distinct[last+1] + 1))
+	lastCode := make([]int, last+1)
+	for j := range lastCode {
+		lastCode[j] = 1
+	}
+	codes[distinct[last+1]] = lastCode
+
+	var output bytes.Buffer
+	output.Write(c.SqueezeMagic)
+	binary.Write(&output, binary.LittleEndian, checksum)
+	output.WriteString("TEST.TXT\x00")
+	binary.Write(&output, binary.LittleEndian, uint16(len(nodes)))
+	binary.Write(&output, binary.LittleEndian, nodes)
+
+	currentByte := byte(0)
+	bitIndex := 0
+	for _, symbol := range append(symbols, 256) {
+		for _, bit := range codes[symbol] {
+			currentByte |= byte(bit) << bitIndex
+			bitIndex++
+			if bitIndex == 8 {
+				output.WriteByte(currentByte)
+				currentByte = 0
+				bitIndex = 0
+			}
+		}
+	}
+	if bitIndex > 0 {
+		output.WriteByte(currentByte)
+	}
+	return output.Bytes()
+}
+
+func checksumOf(data []byte) uint16 {
+	sum := uint16(0)
+	for _, b := range data {
+		sum += uint16(b)
+	}
+	return sum
+}
+
+func TestDecompressSqueezed__Basic(t *testing.T) {
+	expected := []byte("hello")
+	squeezed := squeezeSymbols(t, checksumOf(expected), []int{'h', 'e', 'l', 'l', 'o'})
+
+	var output bytes.Buffer
+	n, err := c.DecompressSqueezed(bytes.NewReader(squeezed), &output)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(expected), n)
+	assert.Equal(t, expected, output.Bytes())
+}
+
+func TestDecompressSqueezed__Runs(t *testing.T) {
+	// "ab" followed by a run of 5 "b" in total, then a literal 0x90.
+	expected := []byte{'a', 'b', 'b', 'b', 'b', 'b', 0x90, 'c'}
+	squeezed := squeezeSymbols(
+		t, checksumOf(expected), []int{'a', 'b', 0x90, 5, 0x90, 0, 'c'})
+
+	var output bytes.Buffer
+	_, err := c.DecompressSqueezed(bytes.NewReader(squeezed), &output)
+	require.NoError(t, err)
+	assert.Equal(t, expected, output.Bytes())
+}
+
+func TestDecompressSqueezed__BadChecksum(t *testing.T) {
+	squeezed := squeezeSymbols(t, 1234, []int{'x', 'y'})
+	_, err := c.DecompressSqueezed(bytes.NewReader(squeezed), &bytes.Buffer{})
+	assert.ErrorContains(t, err, "checksum mismatch")
+}
+
+func TestDecompressSqueezed__BadMagic(t *testing.T) {
+	_, err := c.DecompressSqueezed(bytes.NewReader([]byte{1, 2, 3, 4, 0}), &bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestDecompressSqueezed__Truncated(t *testing.T) {
+	squeezed := squeezeSymbols(t, 0, []int{'a', 'b', 'c', 'd', 'e', 'f', 'g'})
+	_, err := c.DecompressSqueezed(
+		bytes.NewReader(squeezed[:len(squeezed)-2]), &bytes.Buffer{})
+	assert.Error(t, err)
+}
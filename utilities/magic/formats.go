@@ -0,0 +1,310 @@
+package magic
+
+import "bytes"
+
+// DOS executables ------------------------------------------------------------
+
+// matchDOSExecutable recognizes the MZ header of DOS .EXE files. Some linkers
+// wrote the signature backwards, so "ZM" is accepted too.
+func matchDOSExecutable(name string, header []byte, size int64) (Confidence, bool) {
+	if len(header) < 28 {
+		return 0, false
+	}
+	if !bytes.HasPrefix(header, []byte("MZ")) && !bytes.HasPrefix(header, []byte("ZM")) {
+		return 0, false
+	}
+
+	bytesInLastPage := uint16At(header, 2)
+	totalPages := uint16At(header, 4)
+	headerParagraphs := uint16At(header, 8)
+	if bytesInLastPage >= 512 || totalPages == 0 || int64(headerParagraphs)*16 > size {
+		return 0, false
+	}
+	return Signature, true
+}
+
+// CP/M executables -----------------------------------------------------------
+
+// cpmMaxCommandSize is the largest a CP/M .COM file can be: it's loaded at
+// 0x100, and must leave at least a page for BDOS at the top of memory.
+const cpmMaxCommandSize = 0xfe00
+
+// matchCPMCommand guesses that a .COM file is a CP/M program. They're raw 8080
+// machine code with no header, so the only thing to go on is the name, and that
+// it's not a DOS executable in disguise.
+func matchCPMCommand(name string, header []byte, size int64) (Confidence, bool) {
+	if extension(name) != "COM" || size == 0 || size > cpmMaxCommandSize {
+		return 0, false
+	}
+	if _, isEXE := matchDOSExecutable(name, header, size); isEXE {
+		return 0, false
+	}
+	return Guess, true
+}
+
+// dBase ----------------------------------------------------------------------
+
+// dBase field types, from the descriptor of each column.
+const dBaseFieldTypes = "CNLDMFBGP"
+
+// validDate returns true if `month` and `day` could be from a dBase header.
+// The year is only two digits (or an offset from 1900), so anything goes.
+func validDate(month, day byte) bool {
+	return month >= 1 && month <= 12 && day >= 1 && day <= 31
+}
+
+// matchDBase3 recognizes the header of dBase III and IV .DBF files.
+//
+// The header is 32 bytes, followed by one 32-byte descriptor per field and a
+// 0x0D terminator. Every record is the same size and starts with a deletion
+// flag.
+func matchDBase3(name string, header []byte, size int64) (Confidence, bool) {
+	if len(header) < 65 {
+		return 0, false
+	}
+
+	switch header[0] {
+	case 0x03, 0x04, 0x05, 0x83, 0x8b, 0x8e, 0xf5:
+	default:
+		return 0, false
+	}
+	if !validDate(header[2], header[3]) {
+		return 0, false
+	}
+
+	numRecords := uint32At(header, 4)
+	headerSize := uint16At(header, 8)
+	recordSize := uint16At(header, 10)
+	if headerSize < 65 || recordSize < 2 || int64(headerSize)+numRecords*int64(recordSize) > size {
+		return 0, false
+	}
+
+	// Check as many of the field descriptors as we have.
+	recordSizeFromFields := 1
+	for offset := 32; offset < headerSize && offset < len(header); offset += 32 {
+		if header[offset] == 0x0d {
+			if offset == 32 || recordSizeFromFields != recordSize {
+				return 0, false
+			}
+			return Signature, true
+		}
+		if offset+32 > len(header) {
+			break
+		}
+		if bytes.IndexByte([]byte(dBaseFieldTypes), header[offset+11]) < 0 {
+			return 0, false
+		}
+		recordSizeFromFields += int(header[offset+16])
+	}
+
+	// The header was cut off before the terminator, but everything up to that
+	// point was fine.
+	return Signature, headerSize > len(header)
+}
+
+// dBaseIIHeaderSize is the size of a dBase II header, which always has room
+// for 32 fields.
+const dBaseIIHeaderSize = 521
+
+// matchDBase2 recognizes the header of dBase II .DBF files.
+//
+// The header is 8 bytes, followed by 32 16-byte field descriptors. Unused ones
+// come after a 0x0D terminator.
+func matchDBase2(name string, header []byte, size int64) (Confidence, bool) {
+	if len(header) < 8+16 || header[0] != 0x02 {
+		return 0, false
+	}
+
+	numRecords := uint16At(header, 1)
+	recordSize := uint16At(header, 6)
+	if !validDate(header[3], header[4]) || recordSize < 2 {
+		return 0, false
+	}
+	if dBaseIIHeaderSize+int64(numRecords)*int64(recordSize) > size {
+		return 0, false
+	}
+
+	recordSizeFromFields := 1
+	for offset := 8; offset+16 <= len(header) && offset < dBaseIIHeaderSize-1; offset += 16 {
+		if header[offset] == 0x0d {
+			if offset == 8 || recordSizeFromFields != recordSize {
+				return 0, false
+			}
+			return Signature, true
+		}
+		if bytes.IndexByte([]byte("CNL"), header[offset+11]) < 0 {
+			return 0, false
+		}
+		recordSizeFromFields += int(header[offset+12])
+	}
+	return 0, false
+}
+
+// Microsoft BASIC ------------------------------------------------------------
+
+// maxBASICLineNumber is the largest line number Microsoft BASIC allows.
+const maxBASICLineNumber = 65529
+
+// basicConstantSizes gives the number of bytes following each token that
+// introduces a binary constant in a tokenized line. These may contain null
+// bytes, so they have to be skipped when looking for the end of the line.
+var basicConstantSizes = map[byte]int{
+	0x0b: 2, // Octal integer
+	0x0c: 2, // Hexadecimal integer
+	0x0d: 2, // Line pointer
+	0x0e: 2, // Line number
+	0x0f: 1, // One-byte integer
+	0x1c: 2, // Two-byte integer
+	0x1d: 4, // Single-precision float
+	0x1f: 8, // Double-precision float
+}
+
+// endOfBASICLine returns the offset of the null byte that ends the tokenized
+// line starting at `offset`, or -1 if it isn't in `data`.
+func endOfBASICLine(data []byte, offset int) int {
+	for offset < len(data) {
+		token := data[offset]
+		if token == 0 {
+			return offset
+		}
+		offset += 1 + basicConstantSizes[token]
+	}
+	return -1
+}
+
+// matchTokenizedBASIC recognizes programs saved by MBASIC on CP/M or GW-BASIC
+// and BASICA on DOS, which use the same format. After a 0xFF marker, each line
+// is a pointer to the next line in memory, the line number, and the tokenized
+// text ending in a null byte. A null pointer ends the program.
+//
+// The pointers are addresses in the interpreter's memory, not offsets in the
+// file, but they're all off from the file offsets by the same amount. If we
+// can check that for at least two lines, we're sure it's a BASIC program.
+func matchTokenizedBASIC(name string, header []byte, size int64) (Confidence, bool) {
+	if len(header) < 3 || header[0] != 0xff {
+		return 0, false
+	}
+
+	var loadAddress int
+	consistentPointers := 0
+	previousLineNumber := -1
+	offset := 1
+
+	for offset+4 <= len(header) {
+		nextLine := uint16At(header, offset)
+		if nextLine == 0 {
+			break
+		}
+
+		lineNumber := uint16At(header, offset+2)
+		if lineNumber <= previousLineNumber || lineNumber > maxBASICLineNumber {
+			return 0, false
+		}
+		previousLineNumber = lineNumber
+
+		end := endOfBASICLine(header, offset+4)
+		if end < 0 {
+			break
+		}
+
+		// The pointer is to the line following this one.
+		if consistentPointers == 0 {
+			loadAddress = nextLine - (end + 1)
+		} else if nextLine-(end+1) != loadAddress {
+			return 0, false
+		}
+		consistentPointers++
+		offset = end + 1
+	}
+
+	switch {
+	case consistentPointers >= 2:
+		return Signature, true
+	case consistentPointers == 1:
+		return Guess, true
+	default:
+		return 0, false
+	}
+}
+
+// matchProtectedBASIC guesses that a .BAS file starting with 0xFE is a BASIC
+// program saved with the P option. The rest of it is encrypted, so there's
+// nothing else to check.
+func matchProtectedBASIC(name string, header []byte, size int64) (Confidence, bool) {
+	if len(header) < 3 || header[0] != 0xfe || extension(name) != "BAS" {
+		return 0, false
+	}
+	return Guess, true
+}
+
+// WordStar -------------------------------------------------------------------
+
+// wordStarHeaderSize is the size of the header of WordStar 5 and later.
+const wordStarHeaderSize = 128
+
+// wordStarControls are the control characters WordStar uses in documents for
+// formatting: bold, underline, subscripts, and so on.
+var wordStarControls = map[byte]bool{
+	0x01: true, // Alternate pitch
+	0x02: true, // Bold
+	0x03: true, // Pause for input
+	0x04: true, // Double strike
+	0x05: true, // Custom print control
+	0x06: true, // Phantom space
+	0x07: true, // Phantom rubout
+	0x08: true, // Overprint character
+	0x09: true, // Tab
+	0x0a: true, // Line feed
+	0x0c: true, // Form feed
+	0x0d: true, // Carriage return
+	0x0e: true, // Standard pitch
+	0x0f: true, // Non-break space
+	0x11: true, // Custom print control
+	0x12: true, // Custom print control
+	0x13: true, // Underline
+	0x14: true, // Superscript
+	0x16: true, // Subscript
+	0x17: true, // Custom print control
+	0x18: true, // Strikeout
+	0x19: true, // Italics
+	0x1a: true, // End of file
+	0x1f: true, // Soft hyphen
+}
+
+// matchWordStar recognizes WordStar documents.
+//
+// WordStar 5 and later start with a header beginning with 0x1D 0x7D. Earlier
+// versions have no header. Instead, we look for text that only uses WordStar's
+// control characters, and has soft spaces (0xA0) or soft carriage returns
+// (0x8D) that WordStar inserts when it reflows paragraphs. Plain text doesn't
+// have those, so it isn't mistaken for a WordStar document.
+func matchWordStar(name string, header []byte, size int64) (Confidence, bool) {
+	if size >= wordStarHeaderSize && bytes.HasPrefix(header, []byte{0x1d, 0x7d}) {
+		return Signature, true
+	}
+
+	if end := bytes.IndexByte(header, 0x1a); end >= 0 {
+		header = header[:end]
+	}
+	if len(header) == 0 {
+		return 0, false
+	}
+
+	softBreaks := 0
+	for _, char := range header {
+		stripped := char & 0x7f
+		if stripped < 0x20 && !wordStarControls[stripped] {
+			return 0, false
+		} else if stripped == 0x7f {
+			return 0, false
+		}
+		if char == 0xa0 || char == 0x8d {
+			softBreaks++
+		}
+	}
+
+	if softBreaks == 0 {
+		return 0, false
+	}
+	return Guess, true
+}
@@ -0,0 +1,146 @@
+// Package magic identifies the types of files found on vintage disks from their
+// contents, much like file(1) does, but with signatures for formats from the
+// era of the file systems Disko supports: CP/M and DOS executables, WordStar
+// documents, dBase databases, and tokenized Microsoft BASIC programs.
+//
+// Some of these formats have no magic number at all, so besides exact
+// signatures there are heuristics that only give a [Guess].
+package magic
+
+import (
+	posixpath "path"
+	"sort"
+	"strings"
+)
+
+// PeekSize is the number of bytes at the beginning of a file [Detect] looks
+// at. Passing more is harmless, but the extra bytes are ignored.
+const PeekSize = 4096
+
+// Confidence is how sure [Detect] is that a file is of a given type.
+type Confidence int
+
+const (
+	// Guess means the file is consistent with the type, but the type has no
+	// signature, or only one short enough to appear by chance.
+	Guess Confidence = iota
+	// Signature means the file has a magic number or header structure that's
+	// unlikely to appear by chance.
+	Signature
+)
+
+func (confidence Confidence) String() string {
+	switch confidence {
+	case Guess:
+		return "guess"
+	case Signature:
+		return "signature"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements [encoding.TextMarshaler], so that confidences are
+// written by name in JSON.
+func (confidence Confidence) MarshalText() ([]byte, error) {
+	return []byte(confidence.String()), nil
+}
+
+// FileType is a kind of file [Detect] can recognize.
+type FileType struct {
+	// Name is a short, unique, lowercase identifier for the type, e.g.
+	// "dos-exe".
+	Name string `json:"name"`
+	// Description is a human-readable name for the type.
+	Description string `json:"description"`
+}
+
+// Match is a type a file could be.
+type Match struct {
+	FileType
+	Confidence Confidence `json:"confidence"`
+}
+
+// matcher checks if a file could be of one type. `name` is the file's name,
+// which may be empty if it's unknown, `header` is up to [PeekSize] bytes from
+// the start of the file, and `size` is the size of the whole file.
+type matcher func(name string, header []byte, size int64) (Confidence, bool)
+
+type signature struct {
+	fileType FileType
+	match    matcher
+}
+
+// signatures are the types Detect knows about. When two matches have the same
+// confidence, the one listed here first is reported first.
+var signatures = []signature{
+	{
+		FileType{"dos-exe", "DOS executable (MZ)"},
+		matchDOSExecutable,
+	},
+	{
+		FileType{"dbase3", "dBase III/IV database"},
+		matchDBase3,
+	},
+	{
+		FileType{"dbase2", "dBase II database"},
+		matchDBase2,
+	},
+	{
+		FileType{"mbasic", "Microsoft BASIC program, tokenized"},
+		matchTokenizedBASIC,
+	},
+	{
+		FileType{"mbasic-protected", "Microsoft BASIC program, protected"},
+		matchProtectedBASIC,
+	},
+	{
+		FileType{"wordstar", "WordStar document"},
+		matchWordStar,
+	},
+	{
+		FileType{"cpm-com", "CP/M executable (COM)"},
+		matchCPMCommand,
+	},
+}
+
+// Detect returns the types a file could be, most likely first. `name` is the
+// file's name, or an empty string if it's unknown; a few formats can only be
+// guessed at from their extensions. `header` is the beginning of the file, at
+// least [PeekSize] bytes unless the file is smaller, and `size` is the size of
+// the whole file.
+//
+// An empty list means the type couldn't be determined.
+func Detect(name string, header []byte, size int64) []Match {
+	if len(header) > PeekSize {
+		header = header[:PeekSize]
+	}
+
+	matches := []Match{}
+	for _, sig := range signatures {
+		confidence, ok := sig.match(name, header, size)
+		if ok {
+			matches = append(matches, Match{FileType: sig.fileType, Confidence: confidence})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Confidence > matches[j].Confidence
+	})
+	return matches
+}
+
+// extension returns the extension of `name` in uppercase, without the dot.
+func extension(name string) string {
+	return strings.ToUpper(strings.TrimPrefix(posixpath.Ext(name), "."))
+}
+
+// uint16At reads a little-endian 16-bit integer.
+func uint16At(data []byte, offset int) int {
+	return int(data[offset]) | int(data[offset+1])<<8
+}
+
+// uint32At reads a little-endian 32-bit integer.
+func uint32At(data []byte, offset int) int64 {
+	return int64(uint16At(data, offset)) | int64(uint16At(data, offset+2))<<16
+}
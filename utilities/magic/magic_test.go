@@ -0,0 +1,164 @@
+package magic_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/dargueta/disko/utilities/magic"
+	"github.com/stretchr/testify/assert"
+)
+
+func dosExecutable() []byte {
+	header := make([]byte, 600)
+	copy(header, "MZ")
+	binary.LittleEndian.PutUint16(header[2:], 600%512)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[8:], 2)
+	return header
+}
+
+// dBase3Table creates a dBase III table with a 10-character NAME column and a
+// 5-digit AGE column.
+func dBase3Table(numRecords int) []byte {
+	header := []byte{0x03, 86, 5, 12}
+	header = binary.LittleEndian.AppendUint32(header, uint32(numRecords))
+	header = binary.LittleEndian.AppendUint16(header, 32+2*32+1)
+	header = binary.LittleEndian.AppendUint16(header, 1+10+5)
+	header = append(header, make([]byte, 20)...)
+
+	for _, field := range []struct {
+		name   string
+		kind   byte
+		length byte
+	}{{"NAME", 'C', 10}, {"AGE", 'N', 5}} {
+		descriptor := make([]byte, 32)
+		copy(descriptor, field.name)
+		descriptor[11] = field.kind
+		descriptor[16] = field.length
+		header = append(header, descriptor...)
+	}
+	header = append(header, 0x0d)
+
+	for i := 0; i < numRecords; i++ {
+		header = append(header, []byte(" ALICE        42")...)
+	}
+	return append(header, 0x1a)
+}
+
+func dBase2Table() []byte {
+	table := make([]byte, 521+16)
+	table[0] = 0x02
+	binary.LittleEndian.PutUint16(table[1:], 1)
+	table[3] = 5
+	table[4] = 12
+	table[5] = 83
+	binary.LittleEndian.PutUint16(table[6:], 1+10+5)
+	copy(table[8:], "NAME")
+	table[8+11] = 'C'
+	table[8+12] = 10
+	copy(table[24:], "AGE")
+	table[24+11] = 'N'
+	table[24+12] = 5
+	table[40] = 0x0d
+	return table
+}
+
+// basicProgram tokenizes `lines` as if the program were loaded at 0x8000.
+func basicProgram(lines ...[]byte) []byte {
+	const loadAddress = 0x8000
+
+	program := []byte{0xff}
+	for i, text := range lines {
+		next := loadAddress + len(program) + 4 + len(text) + 1
+		program = binary.LittleEndian.AppendUint16(program, uint16(next))
+		program = binary.LittleEndian.AppendUint16(program, uint16((i+1)*10))
+		program = append(program, text...)
+		program = append(program, 0)
+	}
+	return append(program, 0, 0, 0x1a)
+}
+
+func wordStarDocument() []byte {
+	return []byte(
+		"\x02Chapter One\x02\r\n\r\nIt was a dark\xa0and stormy night;\x8d\n" +
+			"the rain fell in\xa0\xa0torrents.\r\n\x1a\x1a\x1a",
+	)
+}
+
+func TestDetect(t *testing.T) {
+	testCases := []struct {
+		description string
+		name        string
+		data        []byte
+		expected    string
+		confidence  magic.Confidence
+	}{
+		{"DOS EXE", "FOO.EXE", dosExecutable(), "dos-exe", magic.Signature},
+		{"DOS EXE named .COM", "COMMAND.COM", dosExecutable(), "dos-exe", magic.Signature},
+		{"CP/M COM", "PIP.COM", []byte{0xc3, 0x00, 0x01, 0x76}, "cpm-com", magic.Guess},
+		{"dBase III", "PEOPLE.DBF", dBase3Table(3), "dbase3", magic.Signature},
+		{"dBase III, empty", "", dBase3Table(0), "dbase3", magic.Signature},
+		{"dBase II", "PEOPLE.DBF", dBase2Table(), "dbase2", magic.Signature},
+		{
+			"BASIC",
+			"",
+			// 10 PRINT "HI": 20 A=1000: 30 END; the integer constant has a
+			// null byte in it.
+			basicProgram(
+				[]byte("\x91 \"HI\""),
+				[]byte{'A', 0xe7, 0x1c, 0x00, 0x04},
+				[]byte{0x81},
+			),
+			"mbasic",
+			magic.Signature,
+		},
+		{"BASIC, one line", "", basicProgram([]byte{0x81}), "mbasic", magic.Guess},
+		{"protected BASIC", "GAME.BAS", []byte{0xfe, 0x12, 0x34, 0x56}, "mbasic-protected", magic.Guess},
+		{"WordStar 4", "LETTER.DOC", wordStarDocument(), "wordstar", magic.Guess},
+		{
+			"WordStar 5",
+			"LETTER.DOC",
+			append([]byte{0x1d, 0x7d}, make([]byte, 200)...),
+			"wordstar",
+			magic.Signature,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			matches := magic.Detect(testCase.name, testCase.data, int64(len(testCase.data)))
+			if assert.NotEmpty(t, matches) {
+				assert.Equal(t, testCase.expected, matches[0].Name)
+				assert.Equal(t, testCase.confidence, matches[0].Confidence)
+			}
+		})
+	}
+}
+
+func TestDetect__NoMatch(t *testing.T) {
+	testCases := []struct {
+		description string
+		name        string
+		data        []byte
+	}{
+		{"plain text", "README.TXT", []byte("Hello, world!\r\nThis is plain text.\r\n\x1a")},
+		{"Latin-1 text", "", []byte("Caf\xe9 cr\xe8me\r\n")},
+		{"empty", "EMPTY.COM", []byte{}},
+		{"COM too big", "BIG.COM", bytes.Repeat([]byte{0xc3}, 0xff00)},
+		{"protected BASIC without a name", "", []byte{0xfe, 0x12, 0x34, 0x56}},
+		{"truncated dBase III", "", dBase3Table(3)[:120]},
+		{
+			"BASIC with line numbers out of order",
+			"",
+			[]byte{0xff, 0x07, 0x80, 0x14, 0x00, 0x81, 0x00, 0x0e, 0x80, 0x0a, 0x00, 0x81, 0x00},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			matches := magic.Detect(testCase.name, testCase.data, int64(len(testCase.data)))
+			assert.Empty(t, matches)
+		})
+	}
+}
@@ -0,0 +1,202 @@
+// Package pathfilter selects paths for bulk operations, such as exporting or
+// copying a directory tree, using include and exclude patterns and a maximum
+// depth.
+//
+// Paths are relative to the root of the operation, use "/" as the separator,
+// and have no leading slash, e.g. "bin/ls".
+//
+// Patterns are globs unless they begin with "re:", in which case the rest is a
+// regular expression that must match the entire path. In globs, "*" matches
+// anything except "/", "?" matches one character other than "/", "[...]" is a
+// character class, and "**" matches any number of path components, including
+// none. A glob with no "/" in it is matched against every component of the
+// path, so "*.bak" matches backup files at any depth, like in .gitignore.
+//
+// A pattern that matches a directory also matches everything in it.
+package pathfilter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dargueta/disko"
+)
+
+// Filter decides which paths a bulk operation should process. The zero value
+// accepts everything.
+type Filter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+
+	// maxDepth is the number of path components allowed, or 0 for no limit.
+	maxDepth int
+}
+
+// New creates a [Filter]. If `include` is empty, everything not excluded is
+// accepted. Otherwise, a path must match at least one of the include patterns
+// and none of the exclude patterns. If `maxDepth` is positive, paths with more
+// components than that are rejected; a depth of 1 only accepts objects directly
+// in the root.
+func New(include, exclude []string, maxDepth int) (*Filter, error) {
+	if maxDepth < 0 {
+		return nil, disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("maximum depth can't be negative, got %d", maxDepth))
+	}
+
+	filter := &Filter{maxDepth: maxDepth}
+	var err error
+
+	filter.include, err = compilePatterns(include)
+	if err != nil {
+		return nil, err
+	}
+	filter.exclude, err = compilePatterns(exclude)
+	if err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// Includes returns true if the object at `path` should be processed.
+func (filter *Filter) Includes(path string) bool {
+	if filter == nil {
+		return true
+	}
+	path = strings.Trim(path, "/")
+	if filter.tooDeep(path) || matchesAny(filter.exclude, path) {
+		return false
+	}
+	return len(filter.include) == 0 || matchesAny(filter.include, path)
+}
+
+// ShouldDescend returns true if the directory at `path` could contain objects
+// that [Filter.Includes] accepts, so that walks can skip directories that
+// don't. "" is the root, which is always descended into.
+func (filter *Filter) ShouldDescend(path string) bool {
+	if filter == nil {
+		return true
+	}
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return true
+	}
+
+	// Children of the directory are one level deeper than it.
+	if filter.maxDepth > 0 && depth(path) >= filter.maxDepth {
+		return false
+	}
+	return !matchesAny(filter.exclude, path)
+}
+
+func (filter *Filter) tooDeep(path string) bool {
+	return filter.maxDepth > 0 && depth(path) > filter.maxDepth
+}
+
+// depth returns the number of components in a path.
+func depth(path string) int {
+	if path == "" {
+		return 0
+	}
+	return strings.Count(path, "/") + 1
+}
+
+// matchesAny returns true if any of the patterns match `path` or a directory
+// containing it.
+func matchesAny(patterns []*regexp.Regexp, path string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+
+	for prefix := path; prefix != ""; {
+		for _, pattern := range patterns {
+			if pattern.MatchString(prefix) {
+				return true
+			}
+		}
+
+		lastSlash := strings.LastIndexByte(prefix, '/')
+		if lastSlash < 0 {
+			break
+		}
+		prefix = prefix[:lastSlash]
+	}
+	return false
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		var expression string
+		if strings.HasPrefix(pattern, "re:") {
+			expression = "^(?:" + pattern[3:] + ")$"
+		} else {
+			translated, err := globToRegexp(pattern)
+			if err != nil {
+				return nil, err
+			}
+			expression = translated
+		}
+
+		regex, err := regexp.Compile(expression)
+		if err != nil {
+			return nil, disko.ErrInvalidArgument.WithMessage(
+				fmt.Sprintf("invalid pattern %q: %s", pattern, err.Error()))
+		}
+		compiled = append(compiled, regex)
+	}
+	return compiled, nil
+}
+
+// globToRegexp converts a glob pattern to an anchored regular expression.
+func globToRegexp(glob string) (string, error) {
+	glob = strings.Trim(glob, "/")
+	if glob == "" {
+		return "", disko.ErrInvalidArgument.WithMessage("empty pattern")
+	}
+
+	var builder strings.Builder
+	if !strings.Contains(glob, "/") {
+		// Unanchored: match the last component at any depth.
+		builder.WriteString("^(?:.*/)?")
+	} else {
+		builder.WriteString("^")
+	}
+
+	for i := 0; i < len(glob); i++ {
+		switch char := glob[i]; char {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					// "**/" matches zero or more leading directories.
+					i++
+					builder.WriteString("(?:.*/)?")
+				} else {
+					builder.WriteString(".*")
+				}
+			} else {
+				builder.WriteString("[^/]*")
+			}
+		case '?':
+			builder.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return "", disko.ErrInvalidArgument.WithMessage(
+					fmt.Sprintf("invalid pattern %q: unterminated character class", glob))
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			builder.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
+
+	builder.WriteString("$")
+	return builder.String(), nil
+}
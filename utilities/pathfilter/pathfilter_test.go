@@ -0,0 +1,101 @@
+package pathfilter_test
+
+import (
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/utilities/pathfilter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter__Nil(t *testing.T) {
+	var filter *pathfilter.Filter
+	assert.True(t, filter.Includes("anything/at/all"))
+	assert.True(t, filter.ShouldDescend("anything"))
+}
+
+func TestFilter__UnanchoredGlob(t *testing.T) {
+	filter, err := pathfilter.New(nil, []string{"*.bak"}, 0)
+	require.NoError(t, err)
+
+	assert.True(t, filter.Includes("readme.txt"))
+	assert.False(t, filter.Includes("readme.bak"))
+	assert.False(t, filter.Includes("docs/old/readme.bak"))
+	assert.True(t, filter.Includes("docs/readme.bak.txt"))
+}
+
+func TestFilter__AnchoredGlob(t *testing.T) {
+	filter, err := pathfilter.New([]string{"bin/*.com"}, nil, 0)
+	require.NoError(t, err)
+
+	assert.True(t, filter.Includes("bin/command.com"))
+	assert.False(t, filter.Includes("command.com"))
+	assert.False(t, filter.Includes("bin/sub/command.com"))
+	assert.False(t, filter.Includes("usr/bin/command.com"))
+	assert.True(t, filter.ShouldDescend("bin"))
+}
+
+func TestFilter__DoubleStar(t *testing.T) {
+	filter, err := pathfilter.New([]string{"usr/**/*.h"}, nil, 0)
+	require.NoError(t, err)
+
+	assert.True(t, filter.Includes("usr/stdio.h"))
+	assert.True(t, filter.Includes("usr/include/sys/types.h"))
+	assert.False(t, filter.Includes("usr/include/stdio.c"))
+}
+
+func TestFilter__DirectoryMatchesContents(t *testing.T) {
+	filter, err := pathfilter.New([]string{"etc"}, []string{"etc/secret"}, 0)
+	require.NoError(t, err)
+
+	assert.True(t, filter.Includes("etc"))
+	assert.True(t, filter.Includes("etc/passwd"))
+	assert.False(t, filter.Includes("etc/secret"))
+	assert.False(t, filter.Includes("etc/secret/key"))
+	assert.False(t, filter.Includes("bin/ls"))
+	assert.False(t, filter.ShouldDescend("etc/secret"))
+}
+
+func TestFilter__Regex(t *testing.T) {
+	filter, err := pathfilter.New(nil, []string{`re:.*\.(o|a)`}, 0)
+	require.NoError(t, err)
+
+	assert.False(t, filter.Includes("lib/libc.a"))
+	assert.False(t, filter.Includes("main.o"))
+	assert.True(t, filter.Includes("main.c"))
+	// Regular expressions must match the entire path.
+	assert.True(t, filter.Includes("main.org"))
+}
+
+func TestFilter__MaxDepth(t *testing.T) {
+	filter, err := pathfilter.New(nil, nil, 2)
+	require.NoError(t, err)
+
+	assert.True(t, filter.Includes("a"))
+	assert.True(t, filter.Includes("a/b"))
+	assert.False(t, filter.Includes("a/b/c"))
+	assert.True(t, filter.ShouldDescend("a"))
+	assert.False(t, filter.ShouldDescend("a/b"))
+}
+
+func TestFilter__CharacterClass(t *testing.T) {
+	filter, err := pathfilter.New([]string{"file[0-9].txt", "data[!a-z]"}, nil, 0)
+	require.NoError(t, err)
+
+	assert.True(t, filter.Includes("file1.txt"))
+	assert.False(t, filter.Includes("filex.txt"))
+	assert.True(t, filter.Includes("data_"))
+	assert.False(t, filter.Includes("datax"))
+}
+
+func TestNew__InvalidPatterns(t *testing.T) {
+	_, err := pathfilter.New([]string{"re:("}, nil, 0)
+	assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+
+	_, err = pathfilter.New([]string{"file[0-9"}, nil, 0)
+	assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+
+	_, err = pathfilter.New(nil, nil, -1)
+	assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+}
@@ -0,0 +1,234 @@
+// Package signing authenticates disk images using Ed25519 signatures.
+//
+// Signatures are computed over the raw bytes of a stream, so the same functions
+// can sign either an image itself or a manifest describing it, such as a block
+// checksum sidecar from [github.com/dargueta/disko/disks/checksums]. Signing
+// the manifest is much cheaper for large images, and the image can then be
+// verified block by block as it's read.
+package signing
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dargueta/disko"
+)
+
+// signatureMagic is the first line of every signature file.
+const signatureMagic = "# disko signature v1"
+
+// ErrBadSignature is returned when a signature doesn't match the data, or was
+// made with a key that isn't trusted.
+var ErrBadSignature = disko.ErrPermissionDenied.WithMessage("image signature is invalid")
+
+// Signature is a detached signature over an image or manifest.
+type Signature struct {
+	// PublicKey is the public half of the key that made the signature.
+	PublicKey ed25519.PublicKey
+
+	// Value is the Ed25519ph signature of the SHA-512 digest of the data.
+	Value []byte
+}
+
+// GenerateKey creates a new random key pair for signing images.
+func GenerateKey() (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	return ed25519.GenerateKey(rand.Reader)
+}
+
+// digestStream returns the SHA-512 digest of everything in `data`.
+func digestStream(data io.Reader) ([]byte, error) {
+	h := sha512.New()
+	_, err := io.Copy(h, data)
+	if err != nil {
+		return nil, disko.ErrIOFailed.Wrap(err)
+	}
+	return h.Sum(nil), nil
+}
+
+// Sign reads `data` until EOF and signs it with `key`. The data is hashed as
+// it's read, so arbitrarily large images can be signed without loading them
+// into memory.
+func Sign(data io.Reader, key ed25519.PrivateKey) (Signature, error) {
+	digest, err := digestStream(data)
+	if err != nil {
+		return Signature{}, err
+	}
+
+	value, err := key.Sign(nil, digest, &ed25519.Options{Hash: crypto.SHA512})
+	if err != nil {
+		return Signature{}, disko.ErrInvalidArgument.Wrap(err)
+	}
+
+	return Signature{
+		PublicKey: key.Public().(ed25519.PublicKey),
+		Value:     value,
+	}, nil
+}
+
+// Verify reads `data` until EOF and checks that `sig` is a valid signature of
+// it made by one of the keys in `trustedKeys`. It returns [ErrBadSignature] if
+// the signature doesn't match or the key that made it isn't trusted.
+func Verify(data io.Reader, sig Signature, trustedKeys ...ed25519.PublicKey) error {
+	isTrusted := false
+	for _, key := range trustedKeys {
+		if key.Equal(sig.PublicKey) {
+			isTrusted = true
+			break
+		}
+	}
+	if !isTrusted {
+		return ErrBadSignature.WithMessage(
+			fmt.Sprintf("key %s is not trusted", hex.EncodeToString(sig.PublicKey)),
+		)
+	}
+
+	digest, err := digestStream(data)
+	if err != nil {
+		return err
+	}
+
+	err = ed25519.VerifyWithOptions(
+		sig.PublicKey, digest, sig.Value, &ed25519.Options{Hash: crypto.SHA512})
+	if err != nil {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// RequireValidSignature verifies the signature of an image about to be mounted,
+// then rewinds it to the beginning so it can be passed to a driver. Callers
+// that only want to mount authenticated images should call this first and
+// refuse to mount if it fails.
+func RequireValidSignature(
+	image io.ReadSeeker,
+	sig Signature,
+	trustedKeys ...ed25519.PublicKey,
+) error {
+	_, err := image.Seek(0, io.SeekStart)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+
+	err = Verify(image, sig, trustedKeys...)
+	if err != nil {
+		return err
+	}
+
+	_, err = image.Seek(0, io.SeekStart)
+	if err != nil {
+		return disko.ErrIOFailed.Wrap(err)
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// WriteTo writes the signature to a stream in a line-oriented text format. It
+// implements [io.WriterTo].
+func (sig Signature) WriteTo(w io.Writer) (int64, error) {
+	buffer := bytes.Buffer{}
+	fmt.Fprintln(&buffer, signatureMagic)
+	fmt.Fprintf(&buffer, "key %s\n", hex.EncodeToString(sig.PublicKey))
+	fmt.Fprintf(&buffer, "signature %s\n", hex.EncodeToString(sig.Value))
+	return buffer.WriteTo(w)
+}
+
+// ReadSignature parses a signature file written by [Signature.WriteTo].
+func ReadSignature(r io.Reader) (Signature, error) {
+	scanner := bufio.NewScanner(r)
+	sig := Signature{}
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		if lineNumber == 1 {
+			if line != signatureMagic {
+				return Signature{}, disko.ErrInvalidArgument.WithMessage(
+					"not a signature file: header is missing",
+				)
+			}
+			continue
+		} else if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+		var err error
+
+		switch key {
+		case "key":
+			sig.PublicKey, err = DecodePublicKey(value)
+		case "signature":
+			sig.Value, err = hex.DecodeString(value)
+		default:
+			err = fmt.Errorf("unrecognized line %q", line)
+		}
+
+		if err != nil {
+			return Signature{}, disko.ErrInvalidArgument.WithMessage(
+				fmt.Sprintf("bad signature file, line %d: %s", lineNumber, err.Error()),
+			)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return Signature{}, disko.ErrIOFailed.Wrap(err)
+	}
+	if sig.PublicKey == nil || len(sig.Value) != ed25519.SignatureSize {
+		return Signature{}, disko.ErrInvalidArgument.WithMessage(
+			"bad signature file: key or signature missing",
+		)
+	}
+	return sig, nil
+}
+
+// EncodePublicKey returns the hex representation of a public key, suitable for
+// storing in a file or passing on the command line.
+func EncodePublicKey(key ed25519.PublicKey) string {
+	return hex.EncodeToString(key)
+}
+
+// DecodePublicKey parses a public key in the format produced by
+// [EncodePublicKey].
+func DecodePublicKey(text string) (ed25519.PublicKey, error) {
+	raw, err := hex.DecodeString(strings.TrimSpace(text))
+	if err != nil {
+		return nil, disko.ErrInvalidArgument.Wrap(err)
+	} else if len(raw) != ed25519.PublicKeySize {
+		return nil, disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf(
+				"public key must be %d bytes, got %d", ed25519.PublicKeySize, len(raw)),
+		)
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// EncodePrivateKey returns the hex representation of a private key's seed,
+// suitable for storing in a file.
+func EncodePrivateKey(key ed25519.PrivateKey) string {
+	return hex.EncodeToString(key.Seed())
+}
+
+// DecodePrivateKey parses a private key in the format produced by
+// [EncodePrivateKey].
+func DecodePrivateKey(text string) (ed25519.PrivateKey, error) {
+	seed, err := hex.DecodeString(strings.TrimSpace(text))
+	if err != nil {
+		return nil, disko.ErrInvalidArgument.Wrap(err)
+	} else if len(seed) != ed25519.SeedSize {
+		return nil, disko.ErrInvalidArgument.WithMessage(
+			fmt.Sprintf("private key must be %d bytes, got %d", ed25519.SeedSize, len(seed)),
+		)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
@@ -0,0 +1,85 @@
+package signing_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/dargueta/disko"
+	"github.com/dargueta/disko/utilities/signing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSign__RoundTrip(t *testing.T) {
+	publicKey, privateKey, err := signing.GenerateKey()
+	require.NoError(t, err, "failed to generate key")
+
+	image := make([]byte, 65536)
+	rand.Read(image)
+
+	sig, err := signing.Sign(bytes.NewReader(image), privateKey)
+	require.NoError(t, err, "failed to sign image")
+
+	sigFile := bytes.Buffer{}
+	_, err = sig.WriteTo(&sigFile)
+	require.NoError(t, err, "failed to serialize signature")
+
+	loaded, err := signing.ReadSignature(&sigFile)
+	require.NoError(t, err, "failed to parse signature")
+	assert.Equal(t, sig, loaded)
+
+	err = signing.Verify(bytes.NewReader(image), loaded, publicKey)
+	assert.NoError(t, err, "valid signature rejected")
+
+	image[1234] ^= 1
+	err = signing.Verify(bytes.NewReader(image), loaded, publicKey)
+	assert.ErrorIs(t, err, disko.ErrPermissionDenied, "modified image accepted")
+}
+
+func TestVerify__UntrustedKey(t *testing.T) {
+	_, privateKey, err := signing.GenerateKey()
+	require.NoError(t, err)
+	otherPublicKey, _, err := signing.GenerateKey()
+	require.NoError(t, err)
+
+	image := []byte("not really a disk image")
+	sig, err := signing.Sign(bytes.NewReader(image), privateKey)
+	require.NoError(t, err)
+
+	err = signing.Verify(bytes.NewReader(image), sig, otherPublicKey)
+	assert.ErrorIs(t, err, signing.ErrBadSignature, "signature from untrusted key accepted")
+}
+
+func TestRequireValidSignature__Rewinds(t *testing.T) {
+	publicKey, privateKey, err := signing.GenerateKey()
+	require.NoError(t, err)
+
+	image := bytes.NewReader([]byte("0123456789"))
+	sig, err := signing.Sign(image, privateKey)
+	require.NoError(t, err)
+
+	err = signing.RequireValidSignature(image, sig, publicKey)
+	require.NoError(t, err)
+
+	first := make([]byte, 1)
+	_, err = image.Read(first)
+	require.NoError(t, err)
+	assert.Equal(t, byte('0'), first[0], "image wasn't rewound after verification")
+}
+
+func TestKeyEncoding__RoundTrip(t *testing.T) {
+	publicKey, privateKey, err := signing.GenerateKey()
+	require.NoError(t, err)
+
+	decodedPublic, err := signing.DecodePublicKey(signing.EncodePublicKey(publicKey))
+	require.NoError(t, err)
+	assert.True(t, publicKey.Equal(decodedPublic))
+
+	decodedPrivate, err := signing.DecodePrivateKey(signing.EncodePrivateKey(privateKey) + "\n")
+	require.NoError(t, err)
+	assert.True(t, privateKey.Equal(decodedPrivate))
+
+	_, err = signing.DecodePublicKey("abcd")
+	assert.ErrorIs(t, err, disko.ErrInvalidArgument)
+}
@@ -0,0 +1,149 @@
+// Package transcode converts text files from old systems into UTF-8 with Unix
+// line endings, so that they're readable on a modern machine.
+//
+// Old text files differ from modern ones in up to three ways:
+//
+//   - They use a character set other than ASCII, such as IBM code page 437 on
+//     DOS or EBCDIC on IBM mainframes.
+//   - Lines end with CR LF (CP/M, DOS), a bare CR (classic Mac OS), or NEL
+//     (EBCDIC) rather than LF.
+//   - CP/M only records file sizes in 128-byte records, so text files end with
+//     a ^Z (SUB, 0x1A) and are padded out to the end of the record with junk.
+//     DOS kept the ^Z convention.
+package transcode
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/transform"
+)
+
+// encodings are the character sets [Options.Encoding] can name. "ascii" is
+// passed through as is, so that it can be used with only the other options.
+var encodings = map[string]encoding.Encoding{
+	"ascii":  encoding.Nop,
+	"cp437":  charmap.CodePage437,
+	"cp850":  charmap.CodePage850,
+	"ebcdic": charmap.CodePage037,
+	"latin1": charmap.ISO8859_1,
+}
+
+// EncodingNames returns the names of the encodings [NewReader] supports, in
+// sorted order.
+func EncodingNames() []string {
+	names := make([]string, 0, len(encodings))
+	for name := range encodings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Options controls how [NewReader] converts text.
+type Options struct {
+	// Encoding is the name of the character set of the input, e.g. "cp437". See
+	// [EncodingNames] for the supported ones. Empty is the same as "ascii".
+	Encoding string
+
+	// ConvertNewlines changes CR LF, bare CR, and NEL line endings to LF.
+	ConvertNewlines bool
+
+	// StripSUB drops the first ^Z and everything after it.
+	StripSUB bool
+}
+
+// NewReader returns a reader that converts text from `source` to UTF-8 as
+// specified by `options`. It fails if the encoding isn't supported.
+func NewReader(source io.Reader, options Options) (io.Reader, error) {
+	name := strings.ToLower(options.Encoding)
+	if name == "" {
+		name = "ascii"
+	}
+
+	textEncoding, ok := encodings[name]
+	if !ok {
+		return nil, fmt.Errorf(
+			"unsupported encoding %q; expected one of: %s",
+			options.Encoding,
+			strings.Join(EncodingNames(), ", "),
+		)
+	}
+
+	// Line endings and ^Z are handled after decoding, since they're different
+	// bytes in EBCDIC.
+	return transform.NewReader(
+		source,
+		transform.Chain(
+			textEncoding.NewDecoder(),
+			&lineFilter{
+				convertNewlines: options.ConvertNewlines,
+				stripSUB:        options.StripSUB,
+			},
+		),
+	), nil
+}
+
+// nextLine is U+0085 NEXT LINE, the line ending in EBCDIC, encoded in UTF-8.
+const nextLine = "\u0085"
+
+// lineFilter is a [transform.Transformer] that converts line endings and drops
+// everything after a ^Z in UTF-8 text.
+type lineFilter struct {
+	convertNewlines bool
+	stripSUB        bool
+	// sawSUB is set once a ^Z has been seen, after which all input is dropped.
+	sawSUB bool
+}
+
+func (filter *lineFilter) Reset() {
+	filter.sawSUB = false
+}
+
+func (filter *lineFilter) Transform(dst, src []byte, atEOF bool) (int, int, error) {
+	nDst, nSrc := 0, 0
+	for nSrc < len(src) {
+		if filter.sawSUB {
+			return nDst, len(src), nil
+		}
+
+		char := src[nSrc]
+		consumed := 1
+		output := char
+
+		switch {
+		case char == 0x1a && filter.stripSUB:
+			filter.sawSUB = true
+			continue
+		case char == '\r' && filter.convertNewlines:
+			// We need to see the next byte to know if this is CR LF or just CR.
+			if nSrc+1 == len(src) && !atEOF {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			if nSrc+1 < len(src) && src[nSrc+1] == '\n' {
+				consumed = 2
+			}
+			output = '\n'
+		case char == nextLine[0] && filter.convertNewlines:
+			if nSrc+1 == len(src) && !atEOF {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			if nSrc+1 < len(src) && src[nSrc+1] == nextLine[1] {
+				consumed = 2
+				output = '\n'
+			}
+		}
+
+		if nDst == len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		dst[nDst] = output
+		nDst++
+		nSrc += consumed
+	}
+	return nDst, nSrc, nil
+}
@@ -0,0 +1,76 @@
+package transcode_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/dargueta/disko/utilities/transcode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewReader(t *testing.T) {
+	testCases := []struct {
+		description string
+		input       string
+		options     transcode.Options
+		expected    string
+	}{
+		{
+			"no options",
+			"A\r\nB\x1ajunk",
+			transcode.Options{},
+			"A\r\nB\x1ajunk",
+		},
+		{
+			"CP/M text",
+			"Line 1\r\nLine 2\r\n\x1a\x1a\xe5\xe5\xe5",
+			transcode.Options{ConvertNewlines: true, StripSUB: true},
+			"Line 1\nLine 2\n",
+		},
+		{
+			"bare CR",
+			"A\rB\r\rC\r",
+			transcode.Options{ConvertNewlines: true},
+			"A\nB\n\nC\n",
+		},
+		{
+			"CP437",
+			"\xc9\xcd\xbb 25\xf8C \x9b",
+			transcode.Options{Encoding: "CP437"},
+			"╔═╗ 25°C ¢",
+		},
+		{
+			"EBCDIC",
+			"\xc8\x85\x93\x93\x96\x15\xe6\x96\x99\x93\x84\x25\x3f\xc1",
+			transcode.Options{Encoding: "ebcdic", ConvertNewlines: true, StripSUB: true},
+			"Hello\nWorld\n",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			reader, err := transcode.NewReader(strings.NewReader(testCase.input), testCase.options)
+			require.NoError(t, err)
+			output, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, string(output))
+
+			// Reading a byte at a time splits CR LF and multibyte characters
+			// across reads, which must give the same result.
+			reader, err = transcode.NewReader(
+				iotest.OneByteReader(strings.NewReader(testCase.input)), testCase.options)
+			require.NoError(t, err)
+			output, err = io.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, string(output), "one byte at a time")
+		})
+	}
+}
+
+func TestNewReader__UnsupportedEncoding(t *testing.T) {
+	_, err := transcode.NewReader(strings.NewReader(""), transcode.Options{Encoding: "petscii"})
+	assert.ErrorContains(t, err, "cp437")
+}